@@ -2,9 +2,10 @@ module github.com/hightemp/ip2cc
 
 go 1.23.5
 
-require github.com/spf13/cobra v1.8.0
-
 require (
-	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
+	github.com/klauspost/compress v1.17.11
+	github.com/spf13/cobra v1.8.0
+	github.com/spf13/pflag v1.0.5
 )
+
+require github.com/inconshreveable/mousetrap v1.1.0 // indirect
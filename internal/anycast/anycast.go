@@ -0,0 +1,86 @@
+// Package anycast recognizes well-known anycast prefixes, whose addresses
+// are announced from many locations: the registration country says little
+// about where an anycast address is served from.
+package anycast
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// builtin are well-known anycast prefixes: the DNS root servers, public
+// resolvers, and CDN edge networks.
+var builtin = []string{
+	// DNS root servers a to m
+	"198.41.0.0/24", "2001:503:ba3e::/48",
+	"170.247.170.0/24", "2801:1b8:10::/48",
+	"192.33.4.0/24", "2001:500:2::/48",
+	"199.7.91.0/24", "2001:500:2d::/48",
+	"192.203.230.0/24", "2001:500:a8::/48",
+	"192.5.5.0/24", "2001:500:2f::/48",
+	"192.112.36.0/24", "2001:500:12::/48",
+	"198.97.190.0/24", "2001:500:1::/48",
+	"192.36.148.0/24", "2001:7fe::/33",
+	"192.58.128.0/24", "2001:503:c27::/48",
+	"193.0.14.0/24", "2001:7fd::/48",
+	"199.7.83.0/24", "2001:500:9f::/48",
+	"202.12.27.0/24", "2001:dc3::/32",
+
+	// Public DNS resolvers: Cloudflare, Google, Quad9, OpenDNS
+	"1.1.1.0/24", "1.0.0.0/24", "2606:4700:4700::/48",
+	"8.8.8.0/24", "8.8.4.0/24", "2001:4860:4860::/48",
+	"9.9.9.0/24", "149.112.112.0/24", "2620:fe::/48",
+	"208.67.222.0/24", "208.67.220.0/24", "2620:119:35::/48", "2620:119:53::/48",
+
+	// CDNs: Cloudflare, Fastly
+	"104.16.0.0/13", "172.64.0.0/13", "2606:4700::/32",
+	"151.101.0.0/16", "2a04:4e42::/32",
+}
+
+// List is a set of anycast prefixes.
+type List struct {
+	prefixes []netip.Prefix
+}
+
+// Builtin returns the built-in list.
+func Builtin() *List {
+	l := &List{prefixes: make([]netip.Prefix, 0, len(builtin))}
+	for _, s := range builtin {
+		l.prefixes = append(l.prefixes, netip.MustParsePrefix(s))
+	}
+	return l
+}
+
+// New creates the built-in list extended by the extra prefixes, e.g. from
+// the configuration file.
+func New(extra []string) (*List, error) {
+	l := Builtin()
+	for _, s := range extra {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid anycast prefix: %w", err)
+		}
+		l.prefixes = append(l.prefixes, prefix.Masked())
+	}
+	return l, nil
+}
+
+// Contains reports whether ip is in an anycast prefix.
+func (l *List) Contains(ip netip.Addr) bool {
+	return l.ContainsRange(ip, ip)
+}
+
+// ContainsRange reports whether all of the inclusive range [start, end]
+// lies in a single anycast prefix. A nil list contains nothing.
+func (l *List) ContainsRange(start, end netip.Addr) bool {
+	if l == nil {
+		return false
+	}
+	start, end = start.Unmap(), end.Unmap()
+	for _, p := range l.prefixes {
+		if p.Contains(start) && p.Contains(end) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package anycast
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestContains(t *testing.T) {
+	l, err := New([]string{"192.0.2.0/24"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	tests := []struct {
+		ip       string
+		expected bool
+	}{
+		{"1.1.1.1", true},
+		{"8.8.8.8", true},
+		{"2001:4860:4860::8888", true},
+		{"193.0.14.129", true}, // k-root
+		{"::ffff:9.9.9.9", true},
+		{"192.0.2.10", true}, // extra prefix
+		{"8.8.9.1", false},
+		{"193.0.6.139", false},
+	}
+	for _, tc := range tests {
+		if got := l.Contains(netip.MustParseAddr(tc.ip)); got != tc.expected {
+			t.Errorf("Contains(%s) = %v, expected %v", tc.ip, got, tc.expected)
+		}
+	}
+
+	if !l.ContainsRange(netip.MustParseAddr("1.1.1.0"), netip.MustParseAddr("1.1.1.255")) {
+		t.Error("ContainsRange(1.1.1.0-1.1.1.255) = false, expected true")
+	}
+	if l.ContainsRange(netip.MustParseAddr("1.0.0.0"), netip.MustParseAddr("1.1.1.255")) {
+		t.Error("ContainsRange(1.0.0.0-1.1.1.255) = true, expected false")
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	if _, err := New([]string{"not-a-prefix"}); err == nil {
+		t.Error("New should reject an invalid prefix")
+	}
+}
@@ -0,0 +1,248 @@
+// Package archive reads and writes distributable snapshot archives.
+//
+// An archive is a zstd-compressed tar file. Its first entry is
+// manifest.json, followed by the snapshot files the manifest lists
+// (metadata.json, index_v4.bin, index_v6.bin). Every file carries its
+// size and SHA-256 in the manifest so a downloaded archive can be
+// verified before it is installed.
+package archive
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/config"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// ManifestName is the name of the manifest entry.
+	ManifestName = "manifest.json"
+
+	// FormatVersion is the current archive format version.
+	FormatVersion = 1
+
+	// Extension is the conventional archive file extension.
+	Extension = ".tar.zst"
+
+	// maxFileSize bounds a single archive entry to guard against corrupt input.
+	maxFileSize = 1 << 30
+)
+
+// Manifest describes the contents of a snapshot archive.
+type Manifest struct {
+	FormatVersion int       `json:"format_version"`
+	Date          string    `json:"date"`
+	CreatedAt     time.Time `json:"created_at"`
+	Files         []File    `json:"files"`
+}
+
+// File is a single file listed in the manifest.
+type File struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// SnapshotFiles are the files every archive must contain.
+var SnapshotFiles = []string{
+	config.MetadataFileName,
+	config.IndexV4FileName,
+	config.IndexV6FileName,
+}
+
+// Create writes an archive of the snapshot in snapshotDir to w.
+func Create(w io.Writer, snapshotDir, date string) (*Manifest, error) {
+	manifest := &Manifest{
+		FormatVersion: FormatVersion,
+		Date:          date,
+		CreatedAt:     time.Now().UTC(),
+	}
+
+	contents := make([][]byte, len(SnapshotFiles))
+	for i, name := range SnapshotFiles {
+		data, err := os.ReadFile(filepath.Join(snapshotDir, name))
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		contents[i] = data
+		manifest.Files = append(manifest.Files, File{
+			Name:   name,
+			Size:   int64(len(data)),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	zw, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	if err != nil {
+		return nil, err
+	}
+	tw := tar.NewWriter(zw)
+
+	writeEntry := func(name string, data []byte) error {
+		header := &tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(data)),
+			ModTime: manifest.CreatedAt,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	if err := writeEntry(ManifestName, manifestData); err != nil {
+		return nil, err
+	}
+	for i, name := range SnapshotFiles {
+		if err := writeEntry(name, contents[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// CreateFile writes an archive of the snapshot to path via a temporary file.
+func CreateFile(path, snapshotDir, date string) (*Manifest, error) {
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := Create(f, snapshotDir, date)
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// FileName returns the conventional archive name for a snapshot date.
+func FileName(date string) string {
+	return date + Extension
+}
+
+// Extract unpacks an archive into dir, verifying every file against the
+// manifest. dir must exist; on error it may contain partial output.
+func Extract(r io.Reader, dir string) (*Manifest, error) {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+
+	header, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+	if header.Name != ManifestName {
+		return nil, fmt.Errorf("first entry is %q, expected %s", header.Name, ManifestName)
+	}
+	var manifest Manifest
+	if err := json.NewDecoder(io.LimitReader(tr, maxFileSize)).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("decode manifest: %w", err)
+	}
+	if manifest.FormatVersion != FormatVersion {
+		return nil, fmt.Errorf("unsupported archive format version: %d", manifest.FormatVersion)
+	}
+	// The date names the snapshot directory the archive is installed into
+	if _, err := time.Parse("2006-01-02", manifest.Date); err != nil {
+		return nil, fmt.Errorf("invalid snapshot date in manifest: %q", manifest.Date)
+	}
+
+	expected := make(map[string]File, len(manifest.Files))
+	for _, f := range manifest.Files {
+		if f.Name != filepath.Base(f.Name) || f.Name == ManifestName {
+			return nil, fmt.Errorf("invalid file name in manifest: %q", f.Name)
+		}
+		expected[f.Name] = f
+	}
+	for _, name := range SnapshotFiles {
+		if _, ok := expected[name]; !ok {
+			return nil, fmt.Errorf("manifest does not list %s", name)
+		}
+	}
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read archive: %w", err)
+		}
+
+		f, ok := expected[header.Name]
+		if !ok {
+			return nil, fmt.Errorf("unexpected file in archive: %q", header.Name)
+		}
+		delete(expected, header.Name)
+
+		if err := extractFile(tr, filepath.Join(dir, f.Name), f); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+
+	for name := range expected {
+		return nil, fmt.Errorf("archive is missing %s", name)
+	}
+
+	return &manifest, nil
+}
+
+func extractFile(r io.Reader, path string, f File) error {
+	if f.Size < 0 || f.Size > maxFileSize {
+		return fmt.Errorf("invalid size %d", f.Size)
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, h), io.LimitReader(r, f.Size+1))
+	if err != nil {
+		return err
+	}
+	if n != f.Size {
+		return fmt.Errorf("size mismatch: got %d bytes, expected %d", n, f.Size)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != f.SHA256 {
+		return fmt.Errorf("checksum mismatch: got %s, expected %s", sum, f.SHA256)
+	}
+	return out.Close()
+}
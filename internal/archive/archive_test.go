@@ -0,0 +1,162 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// buildArchive creates an archive for date whose manifest lists files;
+// contents overrides what is actually stored for a name.
+func buildArchive(t *testing.T, date string, files map[string]string, contents map[string]string) []byte {
+	t.Helper()
+
+	manifest := Manifest{FormatVersion: FormatVersion, Date: date, CreatedAt: time.Now().UTC()}
+	for _, name := range SnapshotFiles {
+		data, ok := files[name]
+		if !ok {
+			continue
+		}
+		sum := sha256.Sum256([]byte(data))
+		manifest.Files = append(manifest.Files, File{Name: name, Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])})
+	}
+	manifestData, _ := json.Marshal(manifest)
+
+	var buf bytes.Buffer
+	zw, _ := zstd.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	write := func(name, data string) {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data))})
+		tw.Write([]byte(data))
+	}
+	write(ManifestName, string(manifestData))
+	for _, name := range SnapshotFiles {
+		data, ok := files[name]
+		if c, override := contents[name]; override {
+			data, ok = c, true
+		}
+		if ok {
+			write(name, data)
+		}
+	}
+	tw.Close()
+	zw.Close()
+	return buf.Bytes()
+}
+
+var testFiles = map[string]string{
+	"metadata.json": `{"requested_time":"2025-01-01"}`,
+	"index_v4.bin":  "v4 index",
+	"index_v6.bin":  "v6 index",
+}
+
+func TestExtract(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	manifest, err := Extract(bytes.NewReader(buildArchive(t, "2025-01-01", testFiles, nil)), tmpDir)
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	if manifest.Date != "2025-01-01" {
+		t.Errorf("Date = %s, expected 2025-01-01", manifest.Date)
+	}
+
+	for name, want := range testFiles {
+		got, err := os.ReadFile(filepath.Join(tmpDir, name))
+		if err != nil {
+			t.Fatalf("ReadFile(%s) failed: %v", name, err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, expected %q", name, got, want)
+		}
+	}
+}
+
+func TestExtractRejectsBadArchives(t *testing.T) {
+	tests := []struct {
+		name     string
+		date     string
+		files    map[string]string
+		contents map[string]string
+		errText  string
+	}{
+		{"checksum", "2025-01-01", testFiles, map[string]string{"index_v4.bin": "v4 inDex"}, "checksum mismatch"},
+		{"size", "2025-01-01", testFiles, map[string]string{"index_v6.bin": "v6 index!"}, "size mismatch"},
+		{"unlisted", "2025-01-01", map[string]string{"metadata.json": "{}", "index_v4.bin": "x"}, nil, "does not list index_v6.bin"},
+		{"date traversal", "../../..", testFiles, nil, "invalid snapshot date"},
+		{"date format", "2025-1-1", testFiles, nil, "invalid snapshot date"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(tmpDir)
+
+			_, err = Extract(bytes.NewReader(buildArchive(t, tt.date, tt.files, tt.contents)), tmpDir)
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("Extract error = %v, expected %q", err, tt.errText)
+			}
+		})
+	}
+}
+
+func TestCreateExtractRoundTrip(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	srcDir := filepath.Join(tmpDir, "src")
+	dstDir := filepath.Join(tmpDir, "dst")
+	os.MkdirAll(srcDir, 0755)
+	os.MkdirAll(dstDir, 0755)
+	for name, data := range testFiles {
+		os.WriteFile(filepath.Join(srcDir, name), []byte(data), 0644)
+	}
+
+	path := filepath.Join(tmpDir, FileName("2025-01-01"))
+	created, err := CreateFile(path, srcDir, "2025-01-01")
+	if err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+	if len(created.Files) != len(SnapshotFiles) {
+		t.Errorf("Files = %d, expected %d", len(created.Files), len(SnapshotFiles))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	extracted, err := Extract(f, dstDir)
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	if extracted.Date != created.Date {
+		t.Errorf("Date = %s, expected %s", extracted.Date, created.Date)
+	}
+	for name, want := range testFiles {
+		got, _ := os.ReadFile(filepath.Join(dstDir, name))
+		if string(got) != want {
+			t.Errorf("%s = %q, expected %q", name, got, want)
+		}
+	}
+}
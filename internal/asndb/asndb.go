@@ -0,0 +1,236 @@
+// Package asndb maintains an offline IP-to-ASN database for provider
+// resolution without network access.
+//
+// The database is built from an iptoasn.com style TSV dump
+// (range_start, range_end, AS_number, country_code, AS_description) and
+// stored as two index tries carrying the origin ASN per prefix plus a
+// holder table.
+package asndb
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/config"
+	"github.com/hightemp/ip2cc/internal/countries"
+	"github.com/hightemp/ip2cc/internal/index"
+	"github.com/hightemp/ip2cc/internal/iprange"
+)
+
+const (
+	// DefaultURL is the default source of the ip-to-ASN table.
+	DefaultURL = "https://iptoasn.com/data/ip2asn-combined.tsv.gz"
+
+	// DownloadTimeout bounds the download of the table.
+	DownloadTimeout = 5 * time.Minute
+
+	indexV4FileName = "asn_v4.bin"
+	indexV6FileName = "asn_v6.bin"
+	holdersFileName = "holders.json"
+)
+
+// DB is a loaded ASN database.
+type DB struct {
+	V4      *index.Trie
+	V6      *index.Trie
+	Holders map[uint32]string
+}
+
+// Entry is the result of a database lookup.
+type Entry struct {
+	ASN    uint32
+	Holder string
+	Prefix string
+}
+
+// Lookup returns the origin AS announcing ip.
+func (db *DB) Lookup(ip netip.Addr) (*Entry, bool) {
+	ip = ip.Unmap()
+	var data *index.PrefixData
+	if ip.Is4() {
+		data = db.V4.Lookup(ip)
+	} else {
+		data = db.V6.Lookup(ip)
+	}
+	if data == nil || data.ASN == 0 {
+		return nil, false
+	}
+	return &Entry{ASN: data.ASN, Holder: db.Holders[data.ASN], Prefix: data.Prefix(ip).String()}, true
+}
+
+// AS is the summary of an autonomous system in the database.
+type AS struct {
+	ASN    uint32
+	Holder string
+	// Country is the country most of the AS's prefixes are registered to.
+	Country string
+	// Prefixes is the number of prefixes the AS originates.
+	Prefixes int
+}
+
+// LookupAS summarizes the prefixes originated by asn. It reports false if
+// the database knows nothing about asn.
+func (db *DB) LookupAS(asn uint32) (*AS, bool) {
+	as := &AS{ASN: asn, Holder: db.Holders[asn]}
+	counts := make(map[string]int)
+	for _, trie := range []*index.Trie{db.V4, db.V6} {
+		_, data := trie.Export()
+		for _, d := range data {
+			if d.ASN != asn {
+				continue
+			}
+			as.Prefixes++
+			if d.CountryCode == "" {
+				continue
+			}
+			counts[d.CountryCode]++
+			if counts[d.CountryCode] > counts[as.Country] ||
+				(counts[d.CountryCode] == counts[as.Country] && d.CountryCode < as.Country) {
+				as.Country = d.CountryCode
+			}
+		}
+	}
+	if as.Prefixes == 0 && as.Holder == "" {
+		return nil, false
+	}
+	return as, true
+}
+
+// Parse reads an ip-to-ASN TSV table. Unrouted ranges (AS 0) are skipped.
+func Parse(r io.Reader) (*DB, error) {
+	db := &DB{
+		V4:      index.NewTrie(false),
+		V6:      index.NewTrie(true),
+		Holders: make(map[uint32]string),
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 3 {
+			continue
+		}
+
+		asn, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid ASN %q", line, fields[2])
+		}
+		if asn == 0 {
+			continue
+		}
+		start, err := netip.ParseAddr(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		end, err := netip.ParseAddr(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		prefixes, err := iprange.ToPrefixes(start, end)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		cc := ""
+		if len(fields) > 3 && len(fields[3]) == 2 {
+			cc = countries.Normalize(fields[3])
+		}
+		if len(fields) > 4 && fields[4] != "" {
+			db.Holders[uint32(asn)] = fields[4]
+		}
+
+		trie := db.V4
+		if start.Is6() {
+			trie = db.V6
+		}
+		for _, p := range prefixes {
+			if err := trie.Insert(p, index.PrefixData{CountryCode: cc, ASN: uint32(asn)}); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Download fetches and parses the table at url. Gzip-compressed tables
+// are detected and decompressed.
+func Download(ctx context.Context, url string) (*DB, error) {
+	ctx, cancel := context.WithTimeout(ctx, DownloadTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", config.AppName+"/1.0")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download %s: HTTP %d", url, resp.StatusCode)
+	}
+
+	body := bufio.NewReader(resp.Body)
+	if magic, _ := body.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return Parse(zr)
+	}
+	return Parse(body)
+}
+
+// Save writes the database to dir.
+func (db *DB) Save(dir string) error {
+	if err := config.EnsureDir(dir); err != nil {
+		return err
+	}
+	if err := index.SaveIndex(filepath.Join(dir, indexV4FileName), filepath.Join(dir, indexV6FileName), db.V4, db.V6); err != nil {
+		return err
+	}
+	data, err := json.Marshal(db.Holders)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, holdersFileName), data, 0644)
+}
+
+// Load reads a database written by Save.
+func Load(dir string) (*DB, error) {
+	v4, v6, err := index.LoadIndex(filepath.Join(dir, indexV4FileName), filepath.Join(dir, indexV6FileName))
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, holdersFileName))
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{V4: v4, V6: v6}
+	if err := json.Unmarshal(data, &db.Holders); err != nil {
+		return nil, fmt.Errorf("decode holders: %w", err)
+	}
+	return db, nil
+}
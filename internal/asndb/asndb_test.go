@@ -0,0 +1,99 @@
+package asndb
+
+import (
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"strings"
+	"testing"
+)
+
+const sampleTable = "1.0.0.0\t1.0.0.255\t13335\tUS\tCLOUDFLARENET\n" +
+	"1.0.1.0\t1.0.3.255\t0\tNone\tNot routed\n" +
+	"8.8.8.0\t8.8.8.255\t15169\tUS\tGOOGLE\n" +
+	"2001:4860::\t2001:4860:ffff:ffff:ffff:ffff:ffff:ffff\t15169\tUS\tGOOGLE\n"
+
+func TestParseAndLookup(t *testing.T) {
+	db, err := Parse(strings.NewReader(sampleTable))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	tests := []struct {
+		ip     string
+		asn    uint32
+		holder string
+		found  bool
+	}{
+		{"1.0.0.1", 13335, "CLOUDFLARENET", true},
+		{"8.8.8.8", 15169, "GOOGLE", true},
+		{"2001:4860:4860::8888", 15169, "GOOGLE", true},
+		{"1.0.2.1", 0, "", false}, // not routed
+		{"9.9.9.9", 0, "", false},
+	}
+
+	for _, tc := range tests {
+		entry, ok := db.Lookup(netip.MustParseAddr(tc.ip))
+		if ok != tc.found {
+			t.Errorf("Lookup(%s) found = %v, expected %v", tc.ip, ok, tc.found)
+			continue
+		}
+		if ok && (entry.ASN != tc.asn || entry.Holder != tc.holder) {
+			t.Errorf("Lookup(%s) = AS%d %s, expected AS%d %s", tc.ip, entry.ASN, entry.Holder, tc.asn, tc.holder)
+		}
+	}
+}
+
+func TestDownloadSaveLoad(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		zw := gzip.NewWriter(w)
+		zw.Write([]byte(sampleTable))
+		zw.Close()
+	}))
+	defer server.Close()
+
+	db, err := Download(context.Background(), server.URL+"/ip2asn.tsv.gz")
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := db.Save(tmpDir); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	loaded, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	entry, ok := loaded.Lookup(netip.MustParseAddr("8.8.8.8"))
+	if !ok || entry.ASN != 15169 || entry.Holder != "GOOGLE" {
+		t.Errorf("Lookup(8.8.8.8) = %+v, %v, expected AS15169 GOOGLE", entry, ok)
+	}
+}
+
+func TestLookupAS(t *testing.T) {
+	db, err := Parse(strings.NewReader(sampleTable))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	as, ok := db.LookupAS(15169)
+	if !ok {
+		t.Fatalf("LookupAS(15169) found nothing")
+	}
+	if as.Holder != "GOOGLE" || as.Country != "US" || as.Prefixes != 2 {
+		t.Errorf("LookupAS(15169) = %+v, expected GOOGLE US with 2 prefixes", as)
+	}
+	if as, ok := db.LookupAS(64500); ok {
+		t.Errorf("LookupAS(64500) = %+v, expected nothing", as)
+	}
+}
@@ -0,0 +1,150 @@
+package batch
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+
+	"github.com/hightemp/ip2cc/internal/output"
+)
+
+// csvColumns are the columns appended to each row in CSV/TSV mode.
+var csvColumns = []string{"country_code", "country_name", "network", "provider"}
+
+// SetCSVInput switches batch input to delimited rows separated by comma
+// (',' for CSV, '\t' for TSV). The address is read from the 1-based column;
+// text output repeats every row with csvColumns appended. A first row whose
+// column is not an address or CIDR is treated as a header.
+func (p *Processor) SetCSVInput(comma rune, column int) error {
+	if column < 1 {
+		return fmt.Errorf("invalid IP column %d: columns are numbered from 1", column)
+	}
+	p.csvComma = comma
+	p.csvColumn = column - 1
+	return nil
+}
+
+// processCSV is ProcessInput for delimited input.
+func (p *Processor) processCSV(ctx context.Context, r io.Reader, w io.Writer, jsonOutput bool) error {
+	jsonOutput = jsonOutput && p.out == nil
+	br := bufio.NewReaderSize(r, inputBufferSize)
+	cr := csv.NewReader(br)
+	cr.Comma = p.csvComma
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	cw := csv.NewWriter(w)
+	cw.Comma = p.csvComma
+
+	var results []*output.LookupResult
+	var rows [][]string
+	var chunk []string
+
+	flush := func() error {
+		if len(rows) == 0 {
+			return nil
+		}
+		chunkResults := p.processChunk(ctx, chunk, len(chunk) >= PartitionThreshold)
+		for i, result := range chunkResults {
+			switch {
+			case p.skip(result):
+			case p.summary != nil:
+				p.summary.Add(result)
+			case p.out != nil:
+				if err := p.out.Write(result); err != nil {
+					return err
+				}
+			case jsonOutput:
+				results = append(results, result)
+			default:
+				if err := cw.Write(append(rows[i], csvFields(result)...)); err != nil {
+					return err
+				}
+			}
+		}
+		cw.Flush()
+		rows, chunk = rows[:0], chunk[:0]
+		return cw.Error()
+	}
+
+	for first := true; ; first = false {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		input := ""
+		if p.csvColumn < len(row) {
+			input = strings.TrimSpace(row[p.csvColumn])
+		}
+		if first && !isAddrOrPrefix(input) {
+			if !jsonOutput && p.out == nil && p.summary == nil {
+				if err := cw.Write(append(row, csvColumns...)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		rows = append(rows, row)
+		chunk = append(chunk, input)
+		if len(chunk) >= maxChunkSize || br.Buffered() == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+
+	if jsonOutput && p.summary == nil {
+		batch := &output.BatchResult{Results: results}
+		jsonStr, err := batch.FormatJSON()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, jsonStr)
+	}
+	return nil
+}
+
+// csvFields returns the csvColumns values of result; they are empty when
+// the lookup failed.
+func csvFields(result *output.LookupResult) []string {
+	if result.Error != "" {
+		return make([]string, len(csvColumns))
+	}
+	countryCode := result.CountryCode
+	if result.Alpha3 && result.CountryAlpha3 != "" {
+		countryCode = result.CountryAlpha3
+	}
+	if countryCode == "" && len(result.Countries) > 1 {
+		countryCode = strings.Join(result.Countries, ",")
+	}
+	provider := ""
+	if result.Provider != nil {
+		provider = result.Provider.GetHolderString()
+	}
+	return []string{countryCode, result.CountryName, result.Network, provider}
+}
+
+// isAddrOrPrefix reports whether s is an IP address or CIDR.
+func isAddrOrPrefix(s string) bool {
+	if _, err := netip.ParseAddr(s); err == nil {
+		return true
+	}
+	_, err := netip.ParsePrefix(s)
+	return err == nil
+}
@@ -0,0 +1,56 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestProcessInputCSV(t *testing.T) {
+	p := newTestProcessor(t)
+	if err := p.SetCSVInput(',', 2); err != nil {
+		t.Fatalf("SetCSVInput failed: %v", err)
+	}
+
+	input := "time,client,path\n10:00,8.8.8.8,\"/a,b\"\n10:01,bogus,/\n10:02\n"
+	var out bytes.Buffer
+	if err := p.ProcessInput(context.Background(), strings.NewReader(input), &out, false); err != nil {
+		t.Fatalf("ProcessInput failed: %v", err)
+	}
+
+	expected := "time,client,path,country_code,country_name,network,provider\n" +
+		"10:00,8.8.8.8,\"/a,b\",US,United States,8.8.8.0/24,\n" +
+		"10:01,bogus,/,,,,\n" +
+		"10:02,,,,\n"
+	if out.String() != expected {
+		t.Errorf("Output = %q, expected %q", out.String(), expected)
+	}
+}
+
+func TestProcessInputTSVWithoutHeader(t *testing.T) {
+	p := newTestProcessor(t)
+	if err := p.SetCSVInput('\t', 1); err != nil {
+		t.Fatalf("SetCSVInput failed: %v", err)
+	}
+	if err := p.SetCSVInput('\t', 0); err == nil {
+		t.Error("SetCSVInput accepted column 0")
+	}
+
+	input := "1.1.1.1\tx\n2001:4860::1\ty\n"
+	var out bytes.Buffer
+	if err := p.ProcessInput(context.Background(), strings.NewReader(input), &out, false); err != nil {
+		t.Fatalf("ProcessInput failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	expected := []string{"1.1.1.1\tx\tAU\t", "2001:4860::1\ty\tUS\t"}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d output lines, got %d: %q", len(expected), len(lines), out.String())
+	}
+	for i, prefix := range expected {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("Line %d = %q, expected prefix %q", i, lines[i], prefix)
+		}
+	}
+}
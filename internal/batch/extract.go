@@ -0,0 +1,115 @@
+package batch
+
+import (
+	"net/netip"
+	"regexp"
+	"strings"
+
+	"github.com/hightemp/ip2cc/internal/output"
+)
+
+// ipv4Pattern finds IPv4 addresses inside a run that is not an address as
+// a whole, such as "1.2.3.4:80".
+var ipv4Pattern = regexp.MustCompile(`\d{1,3}(?:\.\d{1,3}){3}`)
+
+// addrMatch is an address found in a line and its byte range.
+type addrMatch struct {
+	addr       netip.Addr
+	start, end int
+}
+
+// SetExtract enables extract mode: every IPv4 and IPv6 address found in a
+// line is looked up, and lines without addresses are skipped. With annotate
+// set, text output repeats each input line with the country inserted after
+// every address instead of writing one result per address.
+func (p *Processor) SetExtract(enabled, annotate bool) {
+	p.extract = enabled || annotate
+	p.annotate = annotate
+}
+
+// extractAddrs returns the addresses found in line, in order. Candidates
+// are runs of hex digits, dots and colons; brackets, ports and trailing
+// punctuation around an address are tolerated.
+func extractAddrs(line string) []addrMatch {
+	var matches []addrMatch
+	for i := 0; i < len(line); {
+		if !isAddrChar(line[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(line) && isAddrChar(line[j]) {
+			j++
+		}
+		matches = append(matches, matchRun(line, i, j)...)
+		i = j
+	}
+	return matches
+}
+
+// matchRun returns the addresses in line[start:end].
+func matchRun(line string, start, end int) []addrMatch {
+	run := strings.TrimRight(line[start:end], ".:")
+	if strings.ContainsAny(run, "0123456789") {
+		if addr, err := netip.ParseAddr(run); err == nil {
+			return []addrMatch{{addr: addr.Unmap(), start: start, end: start + len(run)}}
+		}
+	}
+
+	var matches []addrMatch
+	for _, loc := range ipv4Pattern.FindAllStringIndex(run, -1) {
+		// Skip pieces of longer dotted numbers
+		if loc[0] > 0 && isDigitOrDot(run[loc[0]-1]) || loc[1] < len(run) && isDigitOrDot(run[loc[1]]) {
+			continue
+		}
+		if addr, err := netip.ParseAddr(run[loc[0]:loc[1]]); err == nil {
+			matches = append(matches, addrMatch{addr: addr, start: start + loc[0], end: start + loc[1]})
+		}
+	}
+	return matches
+}
+
+func isAddrChar(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F' || c == '.' || c == ':'
+}
+
+func isDigitOrDot(c byte) bool {
+	return c >= '0' && c <= '9' || c == '.'
+}
+
+// extractInputs returns the lookup inputs of the addresses in line.
+func extractInputs(line string) []string {
+	matches := extractAddrs(line)
+	inputs := make([]string, len(matches))
+	for i, m := range matches {
+		inputs[i] = m.addr.String()
+	}
+	return inputs
+}
+
+// annotateLine inserts the country of each result after the matching
+// address in line, e.g. "8.8.8.8[US]" or "[2001:db8::1][US]:443".
+func annotateLine(line string, results []*output.LookupResult) string {
+	matches := extractAddrs(line)
+	if len(matches) != len(results) {
+		return line
+	}
+
+	var b strings.Builder
+	last := 0
+	for i, m := range matches {
+		cc := results[i].CountryCode
+		if cc == "" {
+			cc = "-"
+		}
+		end := m.end
+		if m.start > 0 && line[m.start-1] == '[' && end < len(line) && line[end] == ']' {
+			end++
+		}
+		b.WriteString(line[last:end])
+		b.WriteString("[" + cc + "]")
+		last = end
+	}
+	b.WriteString(line[last:])
+	return b.String()
+}
@@ -0,0 +1,68 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractAddrs(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected []string
+	}{
+		{`8.8.8.8 - - [10/Oct/2024:13:55:36 +0000] "GET / HTTP/1.1" 200`, []string{"8.8.8.8"}},
+		{"from 1.2.3.4:443 to [2001:4860::1]:80.", []string{"1.2.3.4", "2001:4860::1"}},
+		{"client=::ffff:1.1.1.1, upstream=10.0.0.1.", []string{"1.1.1.1", "10.0.0.1"}},
+		{"host01.2.3.4 version 1.2.3.4.5 at 12:34:56", nil},
+		{"mac aa:bb:cc:dd:ee:ff deadbeef ::", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, m := range extractAddrs(tt.line) {
+			got = append(got, m.addr.String())
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("extractAddrs(%q) = %v, expected %v", tt.line, got, tt.expected)
+		}
+	}
+}
+
+func TestProcessInputExtract(t *testing.T) {
+	p := newTestProcessor(t)
+	input := "GET from 8.8.8.8 and 9.9.9.9\nno addresses here\n[2001:4860::1]:443 ok\n"
+
+	tests := []struct {
+		annotate bool
+		expected []string
+	}{
+		{false, []string{"8.8.8.8\tUS", "9.9.9.9\t-", "2001:4860::1\tUS"}},
+		{true, []string{"GET from 8.8.8.8[US] and 9.9.9.9[-]", "no addresses here", "[2001:4860::1][US]:443 ok"}},
+	}
+	for _, tt := range tests {
+		p.SetExtract(true, tt.annotate)
+		ctx := context.Background()
+		var sequential, concurrent bytes.Buffer
+		if err := p.ProcessInput(ctx, strings.NewReader(input), &sequential, false); err != nil {
+			t.Fatalf("ProcessInput failed: %v", err)
+		}
+		if err := p.ProcessInputConcurrent(ctx, strings.NewReader(input), &concurrent, false); err != nil {
+			t.Fatalf("ProcessInputConcurrent failed: %v", err)
+		}
+		if sequential.String() != concurrent.String() {
+			t.Errorf("annotate=%v: concurrent output %q differs from sequential output %q", tt.annotate, concurrent.String(), sequential.String())
+		}
+
+		lines := strings.Split(strings.TrimSpace(sequential.String()), "\n")
+		if len(lines) != len(tt.expected) {
+			t.Fatalf("annotate=%v: expected %d output lines, got %d: %q", tt.annotate, len(tt.expected), len(lines), sequential.String())
+		}
+		for i, prefix := range tt.expected {
+			if !strings.HasPrefix(lines[i], prefix) {
+				t.Errorf("annotate=%v: line %d = %q, expected prefix %q", tt.annotate, i, lines[i], prefix)
+			}
+		}
+	}
+}
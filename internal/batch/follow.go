@@ -0,0 +1,81 @@
+package batch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hightemp/ip2cc/internal/output"
+)
+
+// ProcessFollow reads lines from r until it ends or ctx is done, writing the
+// results of each line as soon as the line is complete. It suits endless
+// streams such as tail -f: unlike ProcessInput, nothing is held back for
+// chunking, results of earlier lines are not kept, and JSON output is one
+// object per line (JSON Lines) instead of an array. A final line without a
+// newline is looked up once r ends. Errors writing to w, such as a closed
+// pipe, stop processing and are returned.
+func (p *Processor) ProcessFollow(ctx context.Context, r io.Reader, w io.Writer, jsonOutput bool) error {
+	if p.csvComma != 0 || p.summary != nil {
+		return fmt.Errorf("follow mode reads plain lines and writes per-line results")
+	}
+	annotate := p.annotate && !jsonOutput && p.out == nil
+
+	br := bufio.NewReader(r)
+	for ctx.Err() == nil {
+		line, err := br.ReadString('\n')
+		if line = strings.TrimSpace(line); line != "" {
+			if werr := p.followLine(ctx, w, line, jsonOutput, annotate); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// followLine looks up one line and writes its results.
+func (p *Processor) followLine(ctx context.Context, w io.Writer, line string, jsonOutput, annotate bool) error {
+	inputs, targets := p.expandLine(ctx, line)
+	results := make([]*output.LookupResult, len(inputs))
+	for i, input := range inputs {
+		results[i] = p.processIP(ctx, input)
+		if targets != nil {
+			applyHost(results[i], targets[i])
+		}
+	}
+
+	if annotate {
+		_, err := fmt.Fprintln(w, annotateLine(line, results))
+		return err
+	}
+	for _, result := range results {
+		if p.skip(result) {
+			continue
+		}
+		var err error
+		if p.out != nil {
+			err = p.out.Write(result)
+		} else if jsonOutput {
+			var data []byte
+			if data, err = json.Marshal(result); err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(w, "%s\n", data)
+		} else {
+			_, err = fmt.Fprintln(w, result.FormatText())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/hightemp/ip2cc/internal/output"
+)
+
+func TestProcessFollowAnswersEachLine(t *testing.T) {
+	p := newTestProcessor(t)
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- p.ProcessFollow(context.Background(), inR, outW, false)
+		outW.Close()
+	}()
+
+	answers := bufio.NewReader(outR)
+	// Each line is answered before the next one is sent
+	for _, tt := range []struct{ input, prefix string }{
+		{"8.8.8.8\n", "8.8.8.8\tUS"},
+		{"\n1.1.", ""},
+		{"1.1\n", "1.1.1.1\tAU"},
+	} {
+		io.WriteString(inW, tt.input)
+		if tt.prefix == "" {
+			continue
+		}
+		line, err := answers.ReadString('\n')
+		if err != nil {
+			t.Fatalf("ReadString failed: %v", err)
+		}
+		if !strings.HasPrefix(line, tt.prefix) {
+			t.Errorf("Answer = %q, expected prefix %q", line, tt.prefix)
+		}
+	}
+
+	// A final line without newline is answered at the end of input
+	io.WriteString(inW, "2001:4860::1")
+	inW.Close()
+	rest, _ := io.ReadAll(answers)
+	if !strings.HasPrefix(string(rest), "2001:4860::1\tUS") {
+		t.Errorf("Last answer = %q, expected 2001:4860::1", rest)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("ProcessFollow failed: %v", err)
+	}
+}
+
+func TestProcessFollowJSONLines(t *testing.T) {
+	p := newTestProcessor(t)
+
+	var out bytes.Buffer
+	if err := p.ProcessFollow(context.Background(), strings.NewReader("8.8.8.8\nbogus\n"), &out, true); err != nil {
+		t.Fatalf("ProcessFollow failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 output lines, got %d: %q", len(lines), out.String())
+	}
+	var result output.LookupResult
+	if err := json.Unmarshal([]byte(lines[0]), &result); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if result.CountryCode != "US" {
+		t.Errorf("CountryCode = %s, expected US", result.CountryCode)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func TestProcessFollowStopsOnWriteError(t *testing.T) {
+	p := newTestProcessor(t)
+
+	err := p.ProcessFollow(context.Background(), strings.NewReader("8.8.8.8\n1.1.1.1\n"), failingWriter{}, false)
+	if !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("ProcessFollow error = %v, expected %v", err, io.ErrClosedPipe)
+	}
+}
@@ -0,0 +1,112 @@
+package batch
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/hightemp/ip2cc/internal/output"
+	"github.com/hightemp/ip2cc/internal/provider"
+)
+
+// maxResultMemoEntries bounds the distinct inputs remembered by resultMemo;
+// further inputs are looked up without being stored.
+const maxResultMemoEntries = 1 << 18
+
+// providerMemo shares provider results between the lookups of one batch
+// run, so each distinct IP or prefix is resolved only once even when
+// duplicates are looked up concurrently.
+type providerMemo struct {
+	mu      sync.Mutex
+	entries map[string]*memoEntry
+}
+
+type memoEntry struct {
+	done   chan struct{}
+	result *provider.Result
+}
+
+func newProviderMemo() *providerMemo {
+	return &providerMemo{entries: make(map[string]*memoEntry)}
+}
+
+// resolve returns the result stored under key, calling fn for the first
+// lookup and waiting for it in concurrent ones. Shared results are marked
+// as cached.
+func (m *providerMemo) resolve(key string, fn func() *provider.Result) *provider.Result {
+	m.mu.Lock()
+	if e, ok := m.entries[key]; ok {
+		m.mu.Unlock()
+		<-e.done
+		if e.result == nil {
+			return nil
+		}
+		shared := *e.result
+		shared.Cached = true
+		return &shared
+	}
+	e := &memoEntry{done: make(chan struct{})}
+	m.entries[key] = e
+	m.mu.Unlock()
+
+	e.result = fn()
+	close(e.done)
+	return e.result
+}
+
+// MemoStats counts the lookups of a batch run and how many of them reused
+// the result of an identical earlier input.
+type MemoStats struct {
+	Lookups int64
+	Hits    int64
+}
+
+// resultMemo shares lookup results between identical inputs of one batch
+// run, which are common in logs.
+type resultMemo struct {
+	mu      sync.Mutex
+	entries map[string]*resultEntry
+	lookups atomic.Int64
+	hits    atomic.Int64
+}
+
+type resultEntry struct {
+	done   chan struct{}
+	result *output.LookupResult
+}
+
+func newResultMemo() *resultMemo {
+	return &resultMemo{entries: make(map[string]*resultEntry)}
+}
+
+// resolve returns a copy of the result stored under input, calling fn for
+// the first lookup and waiting for it in concurrent ones. Callers may
+// modify the returned result.
+func (m *resultMemo) resolve(input string, fn func() *output.LookupResult) *output.LookupResult {
+	m.lookups.Add(1)
+	m.mu.Lock()
+	e, ok := m.entries[input]
+	if !ok {
+		if len(m.entries) >= maxResultMemoEntries {
+			m.mu.Unlock()
+			return fn()
+		}
+		e = &resultEntry{done: make(chan struct{})}
+		m.entries[input] = e
+		m.mu.Unlock()
+
+		e.result = fn()
+		close(e.done)
+	} else {
+		m.mu.Unlock()
+		m.hits.Add(1)
+		<-e.done
+	}
+
+	shared := *e.result
+	return &shared
+}
+
+// stats returns the lookup counters.
+func (m *resultMemo) stats() MemoStats {
+	return MemoStats{Lookups: m.lookups.Load(), Hits: m.hits.Load()}
+}
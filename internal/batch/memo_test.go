@@ -0,0 +1,100 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/output"
+	"github.com/hightemp/ip2cc/internal/provider"
+)
+
+func TestProviderMemo(t *testing.T) {
+	memo := newProviderMemo()
+	var calls int32
+
+	fn := func() *provider.Result {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		return &provider.Result{Holders: []string{"GOOGLE LLC"}}
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*provider.Result, 16)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = memo.resolve("ip:8.8.8.8", fn)
+		}(i)
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("resolver called %d times, expected 1", calls)
+	}
+	cached := 0
+	for _, r := range results {
+		if r.GetHolderString() != "GOOGLE LLC" {
+			t.Errorf("Holder = %q, expected GOOGLE LLC", r.GetHolderString())
+		}
+		if r.Cached {
+			cached++
+		}
+	}
+	if cached != len(results)-1 {
+		t.Errorf("%d results marked cached, expected %d", cached, len(results)-1)
+	}
+
+	memo.resolve("ip:1.1.1.1", fn)
+	if calls != 2 {
+		t.Errorf("resolver called %d times, expected 2", calls)
+	}
+}
+
+func TestProcessInputReusesDuplicates(t *testing.T) {
+	p := newTestProcessor(t)
+	input := "8.8.8.8\n1.1.1.1\n8.8.8.8\nbogus\n8.8.8.8\nbogus\n"
+
+	var out bytes.Buffer
+	if err := p.ProcessInput(context.Background(), strings.NewReader(input), &out, false); err != nil {
+		t.Fatalf("ProcessInput failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	expected := []string{"8.8.8.8\tUS", "1.1.1.1\tAU", "8.8.8.8\tUS", "bogus\t-", "8.8.8.8\tUS", "bogus\t-"}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d output lines, got %d: %q", len(expected), len(lines), out.String())
+	}
+	for i, prefix := range expected {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("Line %d = %q, expected prefix %q", i, lines[i], prefix)
+		}
+	}
+
+	stats := p.MemoStats()
+	if stats.Lookups != 6 || stats.Hits != 3 {
+		t.Errorf("MemoStats = %+v, expected 6 lookups and 3 hits", stats)
+	}
+}
+
+func TestResultMemoReturnsCopies(t *testing.T) {
+	memo := newResultMemo()
+	fn := func() *output.LookupResult {
+		return &output.LookupResult{IP: "8.8.8.8", CountryCode: "US"}
+	}
+
+	first := memo.resolve("8.8.8.8", fn)
+	first.Hostname = "dns.google"
+	second := memo.resolve("8.8.8.8", fn)
+	if second.Hostname != "" {
+		t.Errorf("Hostname = %q, expected the memoized result to be unchanged", second.Hostname)
+	}
+	if second.CountryCode != "US" {
+		t.Errorf("CountryCode = %q, expected US", second.CountryCode)
+	}
+}
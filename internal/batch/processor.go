@@ -7,14 +7,22 @@ import (
 	"fmt"
 	"io"
 	"net/netip"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/hightemp/ip2cc/internal/anycast"
 	"github.com/hightemp/ip2cc/internal/countries"
+	"github.com/hightemp/ip2cc/internal/enrich"
 	"github.com/hightemp/ip2cc/internal/index"
+	"github.com/hightemp/ip2cc/internal/iplist"
+	"github.com/hightemp/ip2cc/internal/iprange"
 	"github.com/hightemp/ip2cc/internal/output"
+	"github.com/hightemp/ip2cc/internal/override"
 	"github.com/hightemp/ip2cc/internal/provider"
 	"github.com/hightemp/ip2cc/internal/snapshot"
+	"github.com/hightemp/ip2cc/internal/special"
 )
 
 // Processor handles batch IP lookups.
@@ -24,6 +32,26 @@ type Processor struct {
 	resolver    *provider.Resolver
 	meta        *snapshot.Metadata
 	concurrency int
+	memo        *providerMemo
+	results     *resultMemo
+	abuse       bool
+	geo         bool
+	lookupHost  func(ctx context.Context, host string) ([]netip.Addr, error)
+	extract     bool
+	annotate    bool
+	csvComma    rune
+	csvColumn   int
+	summary     *Summary
+	skipSpecial bool
+	alpha3      bool
+	groups      *countries.Groups
+	enrichers   []enrich.Enricher
+	nat64       []netip.Prefix
+	anycast     *anycast.List
+	tags        *iplist.Tags
+	timing      *timingTotals
+	out         output.ResultWriter
+	cache       *ResultCache
 }
 
 // NewProcessor creates a new batch processor.
@@ -34,108 +62,514 @@ func NewProcessor(v4, v6 *index.Trie, resolver *provider.Resolver, meta *snapsho
 		resolver:    resolver,
 		meta:        meta,
 		concurrency: 4,
+		memo:        newProviderMemo(),
+		results:     newResultMemo(),
+		nat64:       []netip.Prefix{special.WellKnownNAT64Prefix},
+		anycast:     anycast.Builtin(),
 	}
 }
 
+// SetConcurrency sets the number of workers of ProcessInputConcurrent.
+func (p *Processor) SetConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	p.concurrency = n
+}
+
+// SetResultWriter writes results to rw, such as an output.ProtoWriter,
+// instead of as text or JSON to the writer given to ProcessInput. The
+// caller closes rw.
+func (p *Processor) SetResultWriter(rw output.ResultWriter) {
+	p.out = rw
+}
+
+// SetResultCache answers lookups from results of earlier runs kept in c,
+// and adds new results to it. It is not used with SetTiming. The caller
+// loads and saves c.
+func (p *Processor) SetResultCache(c *ResultCache) {
+	p.cache = c
+}
+
+// SetSkipSpecial drops results for special-purpose addresses (private,
+// loopback, multicast, ...) from the output.
+func (p *Processor) SetSkipSpecial(enabled bool) {
+	p.skipSpecial = enabled
+}
+
+// skip reports whether result is left out of the output.
+func (p *Processor) skip(result *output.LookupResult) bool {
+	return p.skipSpecial && result.Special
+}
+
+// SetAlpha3 shows ISO-3166 alpha-3 codes in text output.
+func (p *Processor) SetAlpha3(enabled bool) {
+	p.alpha3 = enabled
+}
+
+// SetGroups enables reporting the country groups of each result.
+func (p *Processor) SetGroups(g *countries.Groups) {
+	p.groups = g
+}
+
+// SetNAT64Prefixes sets the prefixes of NAT64 translators whose addresses
+// are looked up as the IPv4 address they were synthesized from. The default
+// is the well-known prefix 64:ff9b::/96.
+func (p *Processor) SetNAT64Prefixes(prefixes []netip.Prefix) {
+	p.nat64 = prefixes
+}
+
+// SetAnycast sets the anycast prefixes whose addresses are marked as
+// anycast. The default is the built-in list.
+func (p *Processor) SetAnycast(l *anycast.List) {
+	p.anycast = l
+}
+
+// SetTags enables reporting the tag lists containing each result.
+func (p *Processor) SetTags(t *iplist.Tags) {
+	p.tags = t
+}
+
+// SetTiming adds a timing breakdown to every result. indexLoad is the time
+// it took to load the index, reported with each result.
+func (p *Processor) SetTiming(indexLoad time.Duration) {
+	p.timing = &timingTotals{indexLoad: indexLoad}
+}
+
+// AddEnricher registers an enricher that runs on every result found.
+// Enrichers run in the order they were added, once per distinct input.
+func (p *Processor) AddEnricher(e enrich.Enricher) {
+	p.enrichers = append(p.enrichers, e)
+}
+
+// SetAbuseContacts enables looking up the abuse contacts of each result's
+// network. It needs a resolver.
+func (p *Processor) SetAbuseContacts(enabled bool) {
+	p.abuse = enabled
+}
+
+// SetGeolocation enables looking up the best-guess location of each
+// result's network. It needs a resolver.
+func (p *Processor) SetGeolocation(enabled bool) {
+	p.geo = enabled
+}
+
+// MemoStats returns how many lookups this processor made and how many were
+// answered from the result of an identical earlier input.
+func (p *Processor) MemoStats() MemoStats {
+	return p.results.stats()
+}
+
+const (
+	// PartitionThreshold is the chunk size from which lookups are reordered
+	// by address family and high-order bits to improve trie cache locality.
+	PartitionThreshold = 1024
+
+	// maxChunkSize bounds the number of lines buffered before results are written.
+	maxChunkSize = 65536
+
+	// inputBufferSize is the read buffer size for batch input.
+	inputBufferSize = 1 << 20
+
+	// orderWindow bounds the lines in flight in ProcessInputConcurrent,
+	// including finished results waiting for an earlier, slower one.
+	orderWindow = 4096
+)
+
 // ProcessInput reads IPs from input and writes results to output.
+// Lines already available in the read buffer are looked up together as a
+// chunk; slow streams are still answered line by line.
 func (p *Processor) ProcessInput(ctx context.Context, r io.Reader, w io.Writer, jsonOutput bool) error {
-	scanner := bufio.NewScanner(r)
+	if p.csvComma != 0 {
+		return p.processCSV(ctx, r, w, jsonOutput)
+	}
+	br := bufio.NewReaderSize(r, inputBufferSize)
 	var results []*output.LookupResult
+	var chunk []string
+	// hosts maps chunk entries resolved from hostnames to their targets
+	hosts := make(map[int]hostTarget)
+	// spans maps input lines to their chunk entries when annotating
+	type span struct {
+		line        string
+		first, last int
+	}
+	jsonOutput = jsonOutput && p.out == nil
+	annotate := p.annotate && !jsonOutput && p.out == nil && p.summary == nil
+	var spans []span
 
-	if jsonOutput {
-		// Collect all results for JSON array output
-		for scanner.Scan() {
-			line := strings.TrimSpace(scanner.Text())
-			if line == "" {
-				continue
+	flush := func() error {
+		if len(chunk) == 0 && len(spans) == 0 {
+			return nil
+		}
+		chunkResults := p.processChunk(ctx, chunk, len(chunk) >= PartitionThreshold)
+		for i, h := range hosts {
+			applyHost(chunkResults[i], h)
+			delete(hosts, i)
+		}
+		chunk = chunk[:0]
+		if annotate {
+			for _, s := range spans {
+				if _, err := fmt.Fprintln(w, annotateLine(s.line, chunkResults[s.first:s.last])); err != nil {
+					return err
+				}
 			}
-			result := p.processIP(ctx, line)
-			results = append(results, result)
 		}
+		spans = spans[:0]
+		for _, result := range chunkResults {
+			var err error
+			switch {
+			case annotate || p.skip(result):
+			case p.summary != nil:
+				p.summary.Add(result)
+			case p.out != nil:
+				err = p.out.Write(result)
+			case jsonOutput:
+				// Collect all results for JSON array output
+				results = append(results, result)
+			default:
+				// Stream output chunk by chunk
+				_, err = fmt.Fprintln(w, result.FormatText())
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
 
+	for {
+		line, err := br.ReadString('\n')
+		if line = strings.TrimSpace(line); line != "" {
+			inputs, targets := p.expandLine(ctx, line)
+			for i, h := range targets {
+				hosts[len(chunk)+i] = h
+			}
+			if annotate {
+				spans = append(spans, span{line: line, first: len(chunk), last: len(chunk) + len(inputs)})
+			}
+			chunk = append(chunk, inputs...)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(chunk) >= maxChunkSize || len(spans) >= maxChunkSize || br.Buffered() == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	if jsonOutput && p.summary == nil {
 		batch := &output.BatchResult{Results: results}
 		jsonStr, err := batch.FormatJSON()
 		if err != nil {
 			return err
 		}
-		fmt.Fprintln(w, jsonStr)
-	} else {
-		// Stream output line by line
-		for scanner.Scan() {
-			line := strings.TrimSpace(scanner.Text())
-			if line == "" {
-				continue
-			}
-			result := p.processIP(ctx, line)
-			fmt.Fprintln(w, result.FormatText())
+		if _, err := fmt.Fprintln(w, jsonStr); err != nil {
+			return err
 		}
 	}
 
-	return scanner.Err()
+	return nil
 }
 
-// ProcessInputConcurrent processes IPs concurrently.
-func (p *Processor) ProcessInputConcurrent(ctx context.Context, r io.Reader, w io.Writer, jsonOutput bool) error {
-	scanner := bufio.NewScanner(r)
-	var lines []string
-
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" {
-			lines = append(lines, line)
+// processChunk looks up a chunk of lines, returning results in input order.
+// When partition is set, lookups are performed grouped by address family and
+// high-order bits so that consecutive lookups walk the same trie paths.
+func (p *Processor) processChunk(ctx context.Context, lines []string, partition bool) []*output.LookupResult {
+	results := make([]*output.LookupResult, len(lines))
+	if !partition {
+		for i, line := range lines {
+			results[i] = p.lookupInput(ctx, line, netip.Addr{})
 		}
+		return results
 	}
 
-	if err := scanner.Err(); err != nil {
-		return err
+	addrs := make([]netip.Addr, len(lines))
+	keys := make([]uint32, len(lines))
+	order := make([]int, len(lines))
+	for i, line := range lines {
+		addrs[i], _ = netip.ParseAddr(line)
+		keys[i] = partitionKey(addrs[i])
+		order[i] = i
 	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return keys[order[a]] < keys[order[b]]
+	})
 
-	results := make([]*output.LookupResult, len(lines))
-	var wg sync.WaitGroup
-	sem := make(chan struct{}, p.concurrency)
+	for _, i := range order {
+		results[i] = p.lookupInput(ctx, lines[i], addrs[i])
+	}
+	return results
+}
 
-	for i, line := range lines {
+// partitionKey orders addresses by family and then by their top 16 bits.
+func partitionKey(ip netip.Addr) uint32 {
+	if !ip.IsValid() {
+		return 0
+	}
+	var family uint32 = 1
+	if ip.Is6() {
+		family = 2
+	}
+	b := ip.AsSlice()
+	return family<<16 | uint32(b[0])<<8 | uint32(b[1])
+}
+
+// ProcessInputConcurrent looks up IPs with a pool of workers, writing
+// results in input order as soon as they are ready. Memory use is bounded
+// by orderWindow lines regardless of the input size. Delimited input (see
+// SetCSVInput) is processed sequentially.
+func (p *Processor) ProcessInputConcurrent(ctx context.Context, r io.Reader, w io.Writer, jsonOutput bool) error {
+	if p.csvComma != 0 {
+		return p.processCSV(ctx, r, w, jsonOutput)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type job struct {
+		seq  int
+		line string
+	}
+	type done struct {
+		seq     int
+		line    string
+		results []*output.LookupResult
+	}
+
+	jobs := make(chan job, p.concurrency)
+	results := make(chan done, p.concurrency)
+	// window limits how far reading may run ahead of writing
+	window := make(chan struct{}, orderWindow)
+
+	var readErr error
+	go func() {
+		defer close(jobs)
+		scanner := bufio.NewScanner(r)
+		for seq := 0; scanner.Scan(); {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			jobs <- job{seq: seq, line: line}
+			seq++
+		}
+		readErr = scanner.Err()
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < p.concurrency; i++ {
 		wg.Add(1)
-		go func(idx int, ip string) {
+		go func() {
 			defer wg.Done()
-			sem <- struct{}{}
-			defer func() { <-sem }()
-			results[idx] = p.processIP(ctx, ip)
-		}(i, line)
+			for j := range jobs {
+				results <- done{seq: j.seq, line: j.line, results: p.processLine(ctx, j.line)}
+			}
+		}()
 	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
 
-	wg.Wait()
+	var jsonWriter *output.JSONArrayWriter
+	if jsonOutput && p.out == nil && p.summary == nil {
+		jsonWriter = output.NewJSONArrayWriter(w)
+	}
+	emit := func(result *output.LookupResult) error {
+		if p.skip(result) {
+			return nil
+		}
+		if p.out != nil {
+			return p.out.Write(result)
+		}
+		if jsonWriter != nil {
+			return jsonWriter.Write(result)
+		}
+		_, err := fmt.Fprintln(w, result.FormatText())
+		return err
+	}
 
-	if jsonOutput {
-		batch := &output.BatchResult{Results: results}
-		jsonStr, err := batch.FormatJSON()
-		if err != nil {
+	emitLine := func(d done) error {
+		if p.summary != nil {
+			for _, result := range d.results {
+				if !p.skip(result) {
+					p.summary.Add(result)
+				}
+			}
+			return nil
+		}
+		if p.annotate && jsonWriter == nil && p.out == nil {
+			_, err := fmt.Fprintln(w, annotateLine(d.line, d.results))
 			return err
 		}
-		fmt.Fprintln(w, jsonStr)
-	} else {
-		for _, result := range results {
-			fmt.Fprintln(w, result.FormatText())
+		for _, result := range d.results {
+			if err := emit(result); err != nil {
+				return err
+			}
 		}
+		return nil
 	}
 
+	// Results arrive out of order; hold them until their turn
+	pending := make(map[int]done)
+	next := 0
+	for d := range results {
+		pending[d.seq] = d
+		for ready, ok := pending[next]; ok; ready, ok = pending[next] {
+			delete(pending, next)
+			next++
+			<-window
+			if err := emitLine(ready); err != nil {
+				cancel()
+				for range results {
+				}
+				return err
+			}
+		}
+	}
+
+	// The reader has finished once the results channel is closed
+	if readErr != nil {
+		return readErr
+	}
+	if jsonWriter != nil {
+		return jsonWriter.Close()
+	}
 	return nil
 }
 
+// Lookup resolves a single IP address.
+func (p *Processor) Lookup(ctx context.Context, ipStr string) *output.LookupResult {
+	return p.processIP(ctx, ipStr)
+}
+
+// processLine looks up one input line, which yields several results for a
+// hostname with several addresses.
+func (p *Processor) processLine(ctx context.Context, line string) []*output.LookupResult {
+	inputs, targets := p.expandLine(ctx, line)
+	results := make([]*output.LookupResult, len(inputs))
+	for i, input := range inputs {
+		results[i] = p.lookupInput(ctx, input, netip.Addr{})
+		if targets != nil {
+			applyHost(results[i], targets[i])
+		}
+	}
+	return results
+}
+
+// lookupInput looks up input, reusing the result of an identical earlier
+// input of this run or, with a result cache, of an earlier run. ip is the
+// parsed input, if already known.
+func (p *Processor) lookupInput(ctx context.Context, input string, ip netip.Addr) *output.LookupResult {
+	return p.results.resolve(input, func() *output.LookupResult {
+		if p.cache == nil || p.timing != nil {
+			return p.process(ctx, input, ip)
+		}
+		if result, ok := p.cache.Get(input); ok {
+			return p.restoreCached(result)
+		}
+		result := p.process(ctx, input, ip)
+		// Invalid is not stored, and invalid input is quick to look up
+		if !result.Invalid && (result.Provider == nil || result.Provider.Error == "") {
+			p.cache.Add(input, result)
+		}
+		return result
+	})
+}
+
+func (p *Processor) process(ctx context.Context, input string, ip netip.Addr) *output.LookupResult {
+	if ip.IsValid() {
+		return p.processAddr(ctx, input, ip)
+	}
+	return p.processIP(ctx, input)
+}
+
+// restoreCached sets the fields of a result from the result cache that are
+// not stored with it, and marks its provider information as cached.
+func (p *Processor) restoreCached(result *output.LookupResult) *output.LookupResult {
+	result.Alpha3 = p.alpha3
+	result.GeoRequested = p.geo && p.resolver != nil && !result.Special && result.Error == "" && result.Network != ""
+	if result.Provider != nil {
+		prov := *result.Provider
+		prov.Cached = true
+		result.Provider = &prov
+	}
+	return result
+}
+
 func (p *Processor) processIP(ctx context.Context, ipStr string) *output.LookupResult {
-	result := &output.LookupResult{
-		IP:           ipStr,
-		SnapshotTime: p.meta.RequestedTime,
-		IndexBuiltAt: p.meta.CreatedAt,
+	result := p.newResult(ipStr)
+
+	if strings.Contains(ipStr, "/") {
+		prefix, err := netip.ParsePrefix(ipStr)
+		if err != nil {
+			result.Error = fmt.Sprintf("invalid CIDR: %v", err)
+			result.Invalid = true
+			return result
+		}
+		return p.extend(ctx, p.lookupPrefixes(ctx, result, []netip.Prefix{prefix.Masked()}))
+	}
+	if iprange.LooksLikeRange(ipStr) {
+		start, end, err := iprange.Parse(ipStr)
+		if err != nil {
+			result.Error = fmt.Sprintf("invalid range: %v", err)
+			result.Invalid = true
+			return result
+		}
+		prefixes, _ := iprange.ToPrefixes(start, end)
+		return p.extend(ctx, p.lookupPrefixes(ctx, result, prefixes))
 	}
 
 	// Parse IP
 	ip, err := netip.ParseAddr(ipStr)
 	if err != nil {
 		result.Error = fmt.Sprintf("invalid IP: %v", err)
+		result.Invalid = true
 		return result
 	}
 
+	return p.extend(ctx, p.lookupAddr(ctx, result, ip))
+}
+
+// processAddr looks up an already parsed address.
+func (p *Processor) processAddr(ctx context.Context, ipStr string, ip netip.Addr) *output.LookupResult {
+	return p.extend(ctx, p.lookupAddr(ctx, p.newResult(ipStr), ip))
+}
+
+// extend runs the registered enrichers on result.
+func (p *Processor) extend(ctx context.Context, result *output.LookupResult) *output.LookupResult {
+	enrich.Apply(ctx, p.enrichers, result)
+	return result
+}
+
+func (p *Processor) newResult(ipStr string) *output.LookupResult {
+	return &output.LookupResult{
+		IP:           ipStr,
+		SnapshotTime: p.meta.RequestedTime,
+		IndexBuiltAt: p.meta.CreatedAt,
+		Alpha3:       p.alpha3,
+	}
+}
+
+func (p *Processor) lookupAddr(ctx context.Context, result *output.LookupResult, ip netip.Addr) *output.LookupResult {
+	if v4, kind, ok := special.TranslatedIPv4(ip, p.nat64); ok {
+		// The IPv6 index does not cover addresses derived from IPv4 ones
+		result.EmbeddedIPv4, result.Embedding = v4.String(), kind
+		ip = v4
+	}
+
 	// Select trie based on IP version
 	var trie *index.Trie
 	if ip.Is4() {
@@ -144,22 +578,139 @@ func (p *Processor) processIP(ctx context.Context, ipStr string) *output.LookupR
 		trie = p.v6Trie
 	}
 
-	// Lookup in trie
+	// Lookup in trie; overrides may map special-purpose addresses
+	start := time.Now()
 	data := trie.Lookup(ip)
+	if sr, ok := special.Lookup(ip); ok && !override.IsOverride(data) {
+		result.SetSpecial(sr)
+		p.setGroups(result)
+		p.setTags(result, []netip.Prefix{netip.PrefixFrom(ip, ip.BitLen())})
+		p.setTiming(result, time.Since(start), 0)
+		return result
+	}
+	lookupTime := time.Since(start)
 	if data == nil {
 		result.Error = "not found in index"
+		p.setTiming(result, lookupTime, 0)
 		return result
 	}
 
-	result.CountryCode = data.CountryCode
-	result.CountryName = countries.GetName(data.CountryCode)
-	result.Network = data.PrefixStr
+	result.SetCountry(data.CountryCode)
+	p.setCountrySource(result, data)
+	result.RIR, result.Allocated = data.RIR.String(), data.AllocatedDate()
+	result.Anycast = p.anycast.Contains(ip)
+	p.setGroups(result)
+	p.setTags(result, []netip.Prefix{netip.PrefixFrom(ip, ip.BitLen())})
+	result.Network = data.Prefix(ip).String()
+
+	start = time.Now()
+	p.enrich(ctx, result, ip, data)
+	p.setTiming(result, lookupTime, time.Since(start))
+	return result
+}
+
+// lookupPrefixes reports the countries of the assignments a CIDR, or a
+// range split into CIDRs, overlaps and whether it lies within a single one.
+func (p *Processor) lookupPrefixes(ctx context.Context, result *output.LookupResult, prefixes []netip.Prefix) *output.LookupResult {
+	prefix := prefixes[0]
+	trie := p.v4Trie
+	if prefix.Addr().Is6() {
+		trie = p.v6Trie
+	}
+
+	start := time.Now()
+	match := trie.LookupPrefixes(prefixes)
+	if sr, ok := special.LookupRange(prefix.Addr(), iprange.LastAddr(prefixes[len(prefixes)-1])); ok && !override.IsOverride(match.Covering) {
+		result.SetSpecial(sr)
+		p.setGroups(result)
+		p.setTags(result, prefixes)
+		p.setTiming(result, time.Since(start), 0)
+		return result
+	}
+	lookupTime := time.Since(start)
+	if match.Containment == index.NotFound {
+		result.Error = "not found in index"
+		p.setTiming(result, lookupTime, 0)
+		return result
+	}
 
-	// Resolve provider if resolver is available
-	if p.resolver != nil {
-		provResult, _ := p.resolver.Resolve(ctx, ipStr, data.PrefixStr)
-		result.Provider = provResult
+	result.Containment = match.Containment.String()
+	result.Countries = match.Countries
+	if len(match.Countries) == 1 {
+		result.SetCountry(match.Countries[0])
+		if match.Covering != nil {
+			p.setCountrySource(result, match.Covering)
+		}
+	}
+	result.Anycast = p.anycast.ContainsRange(prefix.Addr(), iprange.LastAddr(prefixes[len(prefixes)-1]))
+	p.setGroups(result)
+	p.setTags(result, prefixes)
+	if match.Covering != nil {
+		result.Network = match.Covering.Prefix(prefix.Addr()).String()
+		result.RIR, result.Allocated = match.Covering.RIR.String(), match.Covering.AllocatedDate()
+	} else {
+		result.Network = prefix.String()
 	}
 
+	// Provider information is that of the first address of the block
+	start = time.Now()
+	p.enrich(ctx, result, prefix.Addr(), match.Covering)
+	p.setTiming(result, lookupTime, time.Since(start))
 	return result
 }
+
+// setCountrySource records where the country of data comes from, when the
+// index has a geofeed or override overlay.
+func (p *Processor) setCountrySource(result *output.LookupResult, data *index.PrefixData) {
+	if p.meta != nil && p.meta.Overlaid() {
+		result.CountrySource = data.CountrySource()
+	}
+}
+
+// setGroups adds the groups of the result's country, if requested.
+func (p *Processor) setGroups(result *output.LookupResult) {
+	if p.groups != nil {
+		result.SetGroups(p.groups)
+	}
+}
+
+// setTags adds the tag lists containing the address range made up of the
+// prefixes, if any are configured.
+func (p *Processor) setTags(result *output.LookupResult, prefixes []netip.Prefix) {
+	if p.tags != nil {
+		result.Tags = p.tags.Match(prefixes)
+	}
+}
+
+// enrich adds provider, abuse contact and geolocation information for ip
+// in result.Network, as far as a resolver is available. A provider set by
+// the overrides file wins; without a resolver, the holder embedded in the
+// index, if any, is the provider. data may be nil.
+func (p *Processor) enrich(ctx context.Context, result *output.LookupResult, ip netip.Addr, data *index.PrefixData) {
+	result.Provider = override.Provider(data)
+	if p.resolver == nil {
+		if result.Provider == nil && data != nil && data.Holder != "" {
+			result.Provider = provider.EmbeddedResult(data.Holder)
+		}
+		return
+	}
+	network := result.Network
+
+	if result.Provider == nil {
+		key := p.resolver.MemoKey(ip.String(), network)
+		result.Provider = p.memo.resolve(key, func() *provider.Result {
+			provResult, _ := p.resolver.Resolve(ctx, ip.String(), network)
+			return provResult
+		})
+	}
+	if p.abuse {
+		result.AbuseContacts, _ = p.resolver.AbuseContacts(ctx, network)
+		if result.AbuseContacts == nil {
+			result.AbuseContacts = []string{}
+		}
+	}
+	if p.geo {
+		result.GeoRequested = true
+		result.Geolocation, _ = p.resolver.Geolocate(ctx, network)
+	}
+}
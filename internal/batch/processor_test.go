@@ -0,0 +1,625 @@
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hightemp/ip2cc/internal/anycast"
+	"github.com/hightemp/ip2cc/internal/countries"
+	"github.com/hightemp/ip2cc/internal/index"
+	"github.com/hightemp/ip2cc/internal/iplist"
+	"github.com/hightemp/ip2cc/internal/output"
+	"github.com/hightemp/ip2cc/internal/override"
+	"github.com/hightemp/ip2cc/internal/provider"
+	"github.com/hightemp/ip2cc/internal/snapshot"
+	"github.com/hightemp/ip2cc/internal/special"
+)
+
+func newTestProcessor(t testing.TB) *Processor {
+	t.Helper()
+
+	v4 := index.NewTrie(false)
+	v6 := index.NewTrie(true)
+	prefixes := []struct {
+		cidr string
+		cc   string
+	}{
+		{"8.8.8.0/24", "US"},
+		{"1.0.0.0/8", "AU"},
+		{"2001:4860::/32", "US"},
+	}
+	for _, p := range prefixes {
+		trie := v4
+		if strings.Contains(p.cidr, ":") {
+			trie = v6
+		}
+		if err := trie.InsertCIDR(p.cidr, p.cc); err != nil {
+			t.Fatalf("InsertCIDR failed: %v", err)
+		}
+	}
+
+	return NewProcessor(v4, v6, nil, snapshot.NewMetadata())
+}
+
+func TestProcessInputText(t *testing.T) {
+	p := newTestProcessor(t)
+
+	input := "8.8.8.8\n\n2001:4860::1\nbogus\n1.1.1.1\n"
+	var out bytes.Buffer
+	if err := p.ProcessInput(context.Background(), strings.NewReader(input), &out, false); err != nil {
+		t.Fatalf("ProcessInput failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected 4 output lines, got %d: %q", len(lines), out.String())
+	}
+	expected := []string{"8.8.8.8\tUS", "2001:4860::1\tUS", "bogus\t-", "1.1.1.1\tAU"}
+	for i, prefix := range expected {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("Line %d = %q, expected prefix %q", i, lines[i], prefix)
+		}
+	}
+}
+
+func TestProcessInputCIDR(t *testing.T) {
+	p := newTestProcessor(t)
+
+	var out bytes.Buffer
+	input := "8.8.8.0/25\n8.8.0.0/16\n0.0.0.0/4\n9.9.9.0/24\n1.2.3.4/40\n"
+	if err := p.ProcessInput(context.Background(), strings.NewReader(input), &out, true); err != nil {
+		t.Fatalf("ProcessInput failed: %v", err)
+	}
+
+	var results []*output.LookupResult
+	if err := json.Unmarshal(out.Bytes(), &results); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if len(results) != 5 {
+		t.Fatalf("Expected 5 results, got %d", len(results))
+	}
+
+	expected := []struct {
+		containment string
+		countries   string
+		network     string
+	}{
+		{"contained", "US", "8.8.8.0/24"},
+		{"partial", "US", "8.8.0.0/16"},
+		{"multiple", "AU,US", "0.0.0.0/4"},
+		{"", "", ""},
+		{"", "", ""},
+	}
+	for i, e := range expected {
+		r := results[i]
+		if r.Containment != e.containment || strings.Join(r.Countries, ",") != e.countries || r.Network != e.network {
+			t.Errorf("Result %d = %s %v %s, expected %s %s %s", i, r.Containment, r.Countries, r.Network, e.containment, e.countries, e.network)
+		}
+	}
+	if results[3].Error == "" || results[4].Error == "" {
+		t.Errorf("Expected errors for unknown and invalid CIDRs, got %q and %q", results[3].Error, results[4].Error)
+	}
+}
+
+func TestLookupInvalid(t *testing.T) {
+	p := newTestProcessor(t)
+
+	tests := []struct {
+		input   string
+		invalid bool
+	}{
+		{"8.8.8.8", false},
+		{"9.9.9.9", false},
+		{"9.9.9.0/24", false},
+		{"bogus", true},
+		{"1.2.3.4/40", true},
+		{"10.0.0.9-10.0.0.1", true},
+	}
+	for _, tc := range tests {
+		if got := p.Lookup(context.Background(), tc.input).Invalid; got != tc.invalid {
+			t.Errorf("Lookup(%s).Invalid = %v, expected %v", tc.input, got, tc.invalid)
+		}
+	}
+}
+
+func TestProcessInputRange(t *testing.T) {
+	p := newTestProcessor(t)
+
+	var out bytes.Buffer
+	input := "8.8.8.10-8.8.8.200\n8.8.7.200 - 8.8.8.20\n1.255.255.0-8.8.8.20\n192.0.2.10-192.0.2.200\n8.8.8.9-8.8.8.1\n"
+	if err := p.ProcessInput(context.Background(), strings.NewReader(input), &out, true); err != nil {
+		t.Fatalf("ProcessInput failed: %v", err)
+	}
+
+	var results []*output.LookupResult
+	if err := json.Unmarshal(out.Bytes(), &results); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if len(results) != 5 {
+		t.Fatalf("Expected 5 results, got %d", len(results))
+	}
+
+	expected := []struct {
+		containment string
+		countries   string
+		network     string
+	}{
+		{"contained", "US", "8.8.8.0/24"},
+		{"partial", "US", "8.8.7.200/29"},
+		{"multiple", "AU,US", "1.255.255.0/24"},
+		{"", "", "192.0.2.0/24"},
+		{"", "", ""},
+	}
+	for i, e := range expected {
+		r := results[i]
+		if r.Containment != e.containment || strings.Join(r.Countries, ",") != e.countries || r.Network != e.network {
+			t.Errorf("Result %d = %s %v %s, expected %s %s %s", i, r.Containment, r.Countries, r.Network, e.containment, e.countries, e.network)
+		}
+	}
+	if results[0].CountryCode != "US" || results[2].CountryCode != "" {
+		t.Errorf("Country codes = %q and %q, expected US and none", results[0].CountryCode, results[2].CountryCode)
+	}
+	if !results[3].Special {
+		t.Errorf("Result 3 = %+v, expected a special-purpose range", results[3])
+	}
+	if results[4].Error == "" {
+		t.Error("Expected an error for a reversed range")
+	}
+}
+
+func TestProcessInputAnycast(t *testing.T) {
+	p := newTestProcessor(t)
+	l, err := anycast.New([]string{"1.2.3.0/24"})
+	if err != nil {
+		t.Fatalf("anycast.New failed: %v", err)
+	}
+	p.SetAnycast(l)
+
+	var out bytes.Buffer
+	input := "8.8.8.8\n8.8.9.1\n1.2.3.4\n1.2.4.4\n8.8.8.0/25\n8.8.8.0-8.8.9.255\n"
+	if err := p.ProcessInput(context.Background(), strings.NewReader(input), &out, true); err != nil {
+		t.Fatalf("ProcessInput failed: %v", err)
+	}
+
+	var results []*output.LookupResult
+	if err := json.Unmarshal(out.Bytes(), &results); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	expected := []bool{true, false, true, false, true, false}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, got %d", len(expected), len(results))
+	}
+	for i, e := range expected {
+		if results[i].Anycast != e {
+			t.Errorf("Anycast of %s = %v, expected %v", results[i].IP, results[i].Anycast, e)
+		}
+	}
+}
+
+func TestProcessInputTags(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	path := filepath.Join(tmpDir, "vpn.txt")
+	if err := os.WriteFile(path, []byte("10.8.0.0/16\n8.8.8.0/25\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tags, err := iplist.LoadTags(map[string]string{"corp-vpn": path})
+	if err != nil {
+		t.Fatalf("LoadTags failed: %v", err)
+	}
+
+	p := newTestProcessor(t)
+	p.SetTags(tags)
+	var out bytes.Buffer
+	input := "10.8.1.1\n8.8.8.8\n8.8.8.200\n8.8.8.0/25\n8.8.8.0/24\n"
+	if err := p.ProcessInput(context.Background(), strings.NewReader(input), &out, true); err != nil {
+		t.Fatalf("ProcessInput failed: %v", err)
+	}
+
+	var results []*output.LookupResult
+	if err := json.Unmarshal(out.Bytes(), &results); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	expected := []string{"corp-vpn", "corp-vpn", "", "corp-vpn", ""}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, got %d", len(expected), len(results))
+	}
+	for i, e := range expected {
+		if got := strings.Join(results[i].Tags, ","); got != e {
+			t.Errorf("Tags of %s = %q, expected %q", results[i].IP, got, e)
+		}
+	}
+}
+
+func TestProcessInputOverrides(t *testing.T) {
+	p := newTestProcessor(t)
+	entries := []override.Entry{
+		{Prefix: netip.MustParsePrefix("10.20.0.0/16"), CountryCode: "DE", Provider: "Frankfurt office"},
+		{Prefix: netip.MustParsePrefix("8.8.8.0/25"), CountryCode: "CH"},
+	}
+	n, err := override.Apply(p.v4Trie, p.v6Trie, entries)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	p.meta.OverridePrefixes = n
+
+	var out bytes.Buffer
+	input := "10.20.1.1\n10.21.0.1\n8.8.8.8\n8.8.8.200\n10.20.0.0/24\n"
+	if err := p.ProcessInput(context.Background(), strings.NewReader(input), &out, true); err != nil {
+		t.Fatalf("ProcessInput failed: %v", err)
+	}
+
+	var results []*output.LookupResult
+	if err := json.Unmarshal(out.Bytes(), &results); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	expected := []struct {
+		country string
+		source  string
+		holder  string
+	}{
+		{"DE", "override", "Frankfurt office"},
+		{"PRIVATE", "", ""},
+		{"CH", "override", ""},
+		{"US", "rir", ""},
+		{"DE", "override", "Frankfurt office"},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, got %d", len(expected), len(results))
+	}
+	for i, e := range expected {
+		r := results[i]
+		holder := ""
+		if r.Provider != nil {
+			holder = r.Provider.GetHolderString()
+		}
+		if r.CountryCode != e.country || r.CountrySource != e.source || holder != e.holder {
+			t.Errorf("Result for %s = %s %s %q, expected %s %s %q", r.IP, r.CountryCode, r.CountrySource, holder, e.country, e.source, e.holder)
+		}
+	}
+}
+
+func TestProcessInputJSON(t *testing.T) {
+	p := newTestProcessor(t)
+
+	var out bytes.Buffer
+	if err := p.ProcessInput(context.Background(), strings.NewReader("8.8.8.8\n1.1.1.1"), &out, true); err != nil {
+		t.Fatalf("ProcessInput failed: %v", err)
+	}
+
+	var results []*output.LookupResult
+	if err := json.Unmarshal(out.Bytes(), &results); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if len(results) != 2 || results[0].CountryCode != "US" || results[1].CountryCode != "AU" {
+		t.Errorf("Unexpected results: %+v", results)
+	}
+}
+
+func TestProcessInputProto(t *testing.T) {
+	p := newTestProcessor(t)
+
+	for _, concurrent := range []bool{false, true} {
+		var out bytes.Buffer
+		p.SetResultWriter(output.NewProtoWriter(&out))
+		process := p.ProcessInput
+		if concurrent {
+			process = p.ProcessInputConcurrent
+		}
+		if err := process(context.Background(), strings.NewReader("8.8.8.8\n1.1.1.1\n"), io.Discard, true); err != nil {
+			t.Fatalf("ProcessInput failed: %v", err)
+		}
+
+		br := bufio.NewReader(&out)
+		var codes []string
+		for {
+			result, err := output.ReadProto(br)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("ReadProto failed: %v", err)
+			}
+			codes = append(codes, result.CountryCode)
+		}
+		if strings.Join(codes, ",") != "US,AU" {
+			t.Errorf("concurrent=%v: countries = %v, expected [US AU]", concurrent, codes)
+		}
+	}
+}
+
+func TestProcessInputWriteError(t *testing.T) {
+	p := newTestProcessor(t)
+
+	for _, proto := range []bool{false, true} {
+		for _, concurrent := range []bool{false, true} {
+			var w io.Writer = failingWriter{}
+			if proto {
+				p.SetResultWriter(output.NewProtoWriter(failingWriter{}))
+				w = io.Discard
+			} else {
+				p.SetResultWriter(nil)
+			}
+			process := p.ProcessInput
+			if concurrent {
+				process = p.ProcessInputConcurrent
+			}
+			err := process(context.Background(), strings.NewReader("8.8.8.8\n1.1.1.1\n"), w, false)
+			if !errors.Is(err, io.ErrClosedPipe) {
+				t.Errorf("proto=%v concurrent=%v: ProcessInput error = %v, expected %v", proto, concurrent, err, io.ErrClosedPipe)
+			}
+		}
+	}
+}
+
+func TestProcessInputConcurrentOrdered(t *testing.T) {
+	p := newTestProcessor(t)
+	lines := randomLines(2*orderWindow+100, rand.New(rand.NewSource(2)))
+	lines = append(lines, "bogus", "2001:4860::1")
+	input := strings.Join(lines, "\n") + "\n"
+
+	for _, jsonOutput := range []bool{false, true} {
+		var sequential, concurrent bytes.Buffer
+		ctx := context.Background()
+		if err := p.ProcessInput(ctx, strings.NewReader(input), &sequential, jsonOutput); err != nil {
+			t.Fatalf("ProcessInput failed: %v", err)
+		}
+		if err := p.ProcessInputConcurrent(ctx, strings.NewReader(input), &concurrent, jsonOutput); err != nil {
+			t.Fatalf("ProcessInputConcurrent failed: %v", err)
+		}
+		if sequential.String() != concurrent.String() {
+			t.Errorf("json=%v: concurrent output differs from sequential output", jsonOutput)
+		}
+	}
+}
+
+func TestProcessChunkPartitionedMatchesSequential(t *testing.T) {
+	p := newTestProcessor(t)
+	lines := randomLines(5000, rand.New(rand.NewSource(1)))
+	lines = append(lines, "bogus", "2001:4860::8888", "8.8.8.8")
+
+	ctx := context.Background()
+	sequential := p.processChunk(ctx, lines, false)
+	partitioned := p.processChunk(ctx, lines, true)
+
+	for i := range lines {
+		if sequential[i].FormatText() != partitioned[i].FormatText() {
+			t.Fatalf("Line %d: partitioned %q != sequential %q", i, partitioned[i].FormatText(), sequential[i].FormatText())
+		}
+	}
+}
+
+func TestPartitionKey(t *testing.T) {
+	v4 := partitionKey(netip.MustParseAddr("255.255.0.1"))
+	v6 := partitionKey(netip.MustParseAddr("::1"))
+	if v4 >= v6 {
+		t.Errorf("IPv4 keys should sort before IPv6 keys: %x >= %x", v4, v6)
+	}
+	if partitionKey(netip.MustParseAddr("10.1.2.3")) != partitionKey(netip.MustParseAddr("10.1.200.200")) {
+		t.Error("Addresses sharing the top 16 bits should share a key")
+	}
+}
+
+// randomLines returns random IPv4 addresses, with one in ten being IPv6.
+func randomLines(n int, rng *rand.Rand) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		if i%10 == 0 {
+			var b [16]byte
+			rng.Read(b[:])
+			b[0], b[1] = 0x20, 0x01
+			lines[i] = netip.AddrFrom16(b).String()
+			continue
+		}
+		var b [4]byte
+		rng.Read(b[:])
+		lines[i] = netip.AddrFrom4(b).String()
+	}
+	return lines
+}
+
+// newBenchProcessor builds a processor over a large synthetic IPv4 index.
+func newBenchProcessor(b *testing.B) *Processor {
+	rng := rand.New(rand.NewSource(42))
+	v4 := index.NewTrie(false)
+	for i := 0; i < 600000; i++ {
+		var a [4]byte
+		rng.Read(a[:])
+		prefix := netip.PrefixFrom(netip.AddrFrom4(a), 16+rng.Intn(9)).Masked()
+		v4.Insert(prefix, index.PrefixData{CountryCode: "US"})
+	}
+	return NewProcessor(v4, index.NewTrie(true), nil, snapshot.NewMetadata())
+}
+
+// clusteredLines returns shuffled addresses drawn from a limited set of /24
+// networks, resembling the repetition found in real access logs.
+func clusteredLines(n, networks int, rng *rand.Rand) []string {
+	bases := make([][4]byte, networks)
+	for i := range bases {
+		rng.Read(bases[i][:3])
+	}
+	lines := make([]string, n)
+	for i := range lines {
+		a := bases[rng.Intn(networks)]
+		a[3] = byte(rng.Intn(256))
+		lines[i] = netip.AddrFrom4(a).String()
+	}
+	return lines
+}
+
+func benchmarkProcessChunk(b *testing.B, partition bool) {
+	p := newBenchProcessor(b)
+	lines := clusteredLines(maxChunkSize, 4096, rand.New(rand.NewSource(7)))
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Measure trie lookups rather than reuse of earlier results
+		p.results = newResultMemo()
+		p.processChunk(ctx, lines, partition)
+	}
+}
+
+func BenchmarkProcessChunkSequential(b *testing.B) {
+	benchmarkProcessChunk(b, false)
+}
+
+func BenchmarkProcessChunkPartitioned(b *testing.B) {
+	benchmarkProcessChunk(b, true)
+}
+
+func TestProcessInputSpecial(t *testing.T) {
+	p := newTestProcessor(t)
+	input := "10.1.2.3\n8.8.8.8\nfe80::1\n192.168.0.0/24\n"
+
+	var out bytes.Buffer
+	if err := p.ProcessInput(context.Background(), strings.NewReader(input), &out, false); err != nil {
+		t.Fatalf("ProcessInput failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	expected := []string{"10.1.2.3\tPRIVATE\t", "8.8.8.8\tUS", "fe80::1\tLINKLOCAL\t", "192.168.0.0/24\tPRIVATE\t"}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d output lines, got %d: %q", len(expected), len(lines), out.String())
+	}
+	for i, prefix := range expected {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("Line %d = %q, expected prefix %q", i, lines[i], prefix)
+		}
+	}
+
+	p.SetSkipSpecial(true)
+	out.Reset()
+	if err := p.ProcessInput(context.Background(), strings.NewReader(input), &out, true); err != nil {
+		t.Fatalf("ProcessInput failed: %v", err)
+	}
+	var results []*output.LookupResult
+	if err := json.Unmarshal(out.Bytes(), &results); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if len(results) != 1 || results[0].IP != "8.8.8.8" {
+		t.Errorf("Expected only 8.8.8.8 with --skip-special, got %d results", len(results))
+	}
+}
+
+func TestLookupEmbeddedIPv4(t *testing.T) {
+	p := newTestProcessor(t)
+
+	tests := []struct {
+		ip        string
+		cc        string
+		embedding string
+	}{
+		{"::ffff:8.8.8.8", "US", special.IPv4Mapped},
+		{"2002:808:808::1", "US", special.SixToFour},
+		{"2001:0:4136:e378:8000:63bf:f7f7:f7f7", "US", special.Teredo},
+		{"2002:a00:1::1", special.Private, special.SixToFour},
+		{"64:ff9b::8.8.8.8", "US", special.NAT64},
+		{"2001:4860::1", "US", ""},
+	}
+	for _, tt := range tests {
+		result := p.Lookup(context.Background(), tt.ip)
+		if result.CountryCode != tt.cc || result.Embedding != tt.embedding {
+			t.Errorf("Lookup(%s) = %s %q, expected %s %q", tt.ip, result.CountryCode, result.Embedding, tt.cc, tt.embedding)
+		}
+		if tt.embedding != "" && result.EmbeddedIPv4 == "" {
+			t.Errorf("Lookup(%s) EmbeddedIPv4 is empty", tt.ip)
+		}
+	}
+
+	// A network-specific NAT64 prefix inside an indexed IPv6 block
+	p.SetNAT64Prefixes([]netip.Prefix{netip.MustParsePrefix("2001:4860:1::/96")})
+	if result := p.Lookup(context.Background(), "2001:4860:1::1.0.0.1"); result.CountryCode != "AU" || result.EmbeddedIPv4 != "1.0.0.1" {
+		t.Errorf("Lookup(2001:4860:1::1.0.0.1) = %s via %q, expected AU via 1.0.0.1", result.CountryCode, result.EmbeddedIPv4)
+	}
+	if result := p.Lookup(context.Background(), "64:ff9b::8.8.8.8"); result.Embedding != "" {
+		t.Errorf("Lookup(64:ff9b::8.8.8.8) embedding = %q after replacing the NAT64 prefixes", result.Embedding)
+	}
+}
+
+func TestProcessInputGroups(t *testing.T) {
+	p := newTestProcessor(t)
+	groups, err := countries.NewGroups(map[string][]string{"anz": {"AU", "NZ"}})
+	if err != nil {
+		t.Fatalf("NewGroups failed: %v", err)
+	}
+	p.SetGroups(groups)
+
+	var out bytes.Buffer
+	if err := p.ProcessInput(context.Background(), strings.NewReader("1.1.1.1\n8.8.8.8\n10.0.0.1\n"), &out, false); err != nil {
+		t.Fatalf("ProcessInput failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	expected := []string{"anz", "-", "-"}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d output lines, got %d: %q", len(expected), len(lines), out.String())
+	}
+	for i, groups := range expected {
+		parts := strings.Split(lines[i], "\t")
+		if last := parts[len(parts)-1]; last != groups {
+			t.Errorf("Line %d groups = %q, expected %q", i, last, groups)
+		}
+	}
+}
+
+// countingEnricher tags results with their country and counts its calls.
+type countingEnricher struct {
+	calls int
+}
+
+func (e *countingEnricher) Name() string { return "counting" }
+
+func (e *countingEnricher) Enrich(ctx context.Context, result *output.LookupResult) error {
+	e.calls++
+	result.SetExtra("tag", "cc-"+result.CountryCode)
+	return nil
+}
+
+func TestProcessInputEnricher(t *testing.T) {
+	p := newTestProcessor(t)
+	e := &countingEnricher{}
+	p.AddEnricher(e)
+
+	var out bytes.Buffer
+	input := "8.8.8.8\n8.8.8.8\n9.9.9.9\n"
+	if err := p.ProcessInput(context.Background(), strings.NewReader(input), &out, false); err != nil {
+		t.Fatalf("ProcessInput failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 output lines, got %d: %q", len(lines), out.String())
+	}
+	for i := 0; i < 2; i++ {
+		if !strings.HasSuffix(lines[i], "\ttag=cc-US") {
+			t.Errorf("Line %d = %q, expected tag=cc-US column", i, lines[i])
+		}
+	}
+	if e.calls != 1 {
+		t.Errorf("Enricher calls = %d, expected 1 for a duplicate input and a miss", e.calls)
+	}
+}
+
+func TestLookupEmbeddedHolder(t *testing.T) {
+	p := newTestProcessor(t)
+	p.v4Trie.SetHolder(netip.MustParsePrefix("8.8.8.0/24"), "GOOGLE")
+
+	result := p.Lookup(context.Background(), "8.8.8.8")
+	if result.Provider == nil || result.Provider.GetHolderString() != "GOOGLE" || result.Provider.Mode != provider.ModeIndex {
+		t.Errorf("Provider = %+v, expected the embedded holder GOOGLE", result.Provider)
+	}
+	if result := p.Lookup(context.Background(), "1.1.1.1"); result.Provider != nil {
+		t.Errorf("Provider = %+v for a prefix without holder, expected nil", result.Provider)
+	}
+}
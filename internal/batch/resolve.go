@@ -0,0 +1,84 @@
+package batch
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/hightemp/ip2cc/internal/iprange"
+	"github.com/hightemp/ip2cc/internal/output"
+)
+
+// hostTarget marks a chunk entry that was resolved from a hostname.
+type hostTarget struct {
+	hostname string
+	err      error
+}
+
+// SetResolveHostnames enables resolving inputs that are neither addresses
+// nor CIDRs as hostnames. Every A and AAAA address is looked up, and the
+// results carry the hostname.
+func (p *Processor) SetResolveHostnames(enabled bool) {
+	if !enabled {
+		p.lookupHost = nil
+		return
+	}
+	p.lookupHost = func(ctx context.Context, host string) ([]netip.Addr, error) {
+		return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	}
+}
+
+// isHostname reports whether line is to be resolved as a hostname.
+func (p *Processor) isHostname(line string) bool {
+	if p.lookupHost == nil || strings.Contains(line, "/") || iprange.LooksLikeRange(line) {
+		return false
+	}
+	_, err := netip.ParseAddr(line)
+	return err != nil
+}
+
+// resolveHost returns the addresses of host as lookup inputs.
+func (p *Processor) resolveHost(ctx context.Context, host string) ([]string, error) {
+	addrs, err := p.lookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	inputs := make([]string, len(addrs))
+	for i, addr := range addrs {
+		inputs[i] = addr.Unmap().String()
+	}
+	return inputs, nil
+}
+
+// expandLine returns the lookup inputs for line and, for hostnames, the
+// matching targets. In extract mode the inputs are the addresses found in
+// the line.
+func (p *Processor) expandLine(ctx context.Context, line string) ([]string, []hostTarget) {
+	if p.extract {
+		return extractInputs(line), nil
+	}
+	if !p.isHostname(line) {
+		return []string{line}, nil
+	}
+	inputs, err := p.resolveHost(ctx, line)
+	if err != nil || len(inputs) == 0 {
+		return []string{line}, []hostTarget{{hostname: line, err: err}}
+	}
+	targets := make([]hostTarget, len(inputs))
+	for i := range targets {
+		targets[i].hostname = line
+	}
+	return inputs, targets
+}
+
+// applyHost records the hostname a result was resolved from.
+func applyHost(result *output.LookupResult, h hostTarget) {
+	result.Hostname = h.hostname
+	switch {
+	case h.err != nil:
+		result.Error = "resolve: " + h.err.Error()
+	case result.IP == h.hostname:
+		result.Error = "resolve: no addresses found"
+	}
+}
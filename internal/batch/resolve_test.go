@@ -0,0 +1,54 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestProcessInputResolveHostnames(t *testing.T) {
+	p := newTestProcessor(t)
+	p.lookupHost = func(ctx context.Context, host string) ([]netip.Addr, error) {
+		switch host {
+		case "dns.example":
+			return []netip.Addr{netip.MustParseAddr("8.8.8.8"), netip.MustParseAddr("2001:4860::1")}, nil
+		case "mapped.example":
+			return []netip.Addr{netip.MustParseAddr("::ffff:1.1.1.1")}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	input := "dns.example\n9.9.9.9\nmapped.example\nmissing.example\n"
+	expected := []string{
+		"dns.example (8.8.8.8)\tUS",
+		"dns.example (2001:4860::1)\tUS",
+		"9.9.9.9\t-",
+		"mapped.example (1.1.1.1)\tAU",
+		"missing.example\t-\t-\t-\tERROR: resolve: no such host",
+	}
+
+	ctx := context.Background()
+	var sequential, concurrent bytes.Buffer
+	if err := p.ProcessInput(ctx, strings.NewReader(input), &sequential, false); err != nil {
+		t.Fatalf("ProcessInput failed: %v", err)
+	}
+	if err := p.ProcessInputConcurrent(ctx, strings.NewReader(input), &concurrent, false); err != nil {
+		t.Fatalf("ProcessInputConcurrent failed: %v", err)
+	}
+	if sequential.String() != concurrent.String() {
+		t.Errorf("Concurrent output %q differs from sequential output %q", concurrent.String(), sequential.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(sequential.String()), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d output lines, got %d: %q", len(expected), len(lines), sequential.String())
+	}
+	for i, prefix := range expected {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("Line %d = %q, expected prefix %q", i, lines[i], prefix)
+		}
+	}
+}
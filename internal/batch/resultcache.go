@@ -0,0 +1,211 @@
+package batch
+
+import (
+	"container/list"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/output"
+)
+
+// resultCacheVersion is the current on-disk result cache format version.
+const resultCacheVersion = 2
+
+// DefaultResultCacheSize is the default number of results kept across runs.
+const DefaultResultCacheSize = 100000
+
+// resultCacheFile is the on-disk result cache layout. Entries are ordered
+// from the least to the most recently used.
+type resultCacheFile struct {
+	Version int                `json:"version"`
+	Key     string             `json:"key"`
+	Entries []resultCacheEntry `json:"entries"`
+}
+
+type resultCacheEntry struct {
+	Input  string               `json:"input"`
+	Result *output.LookupResult `json:"result"`
+	// ExpiresAt is set for results that hold live provider data.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// ResultCache keeps complete lookup results across batch runs, so that
+// repeated runs over overlapping inputs skip both the trie and provider
+// lookups. It holds the most recently used results up to its size. The
+// results are only valid for the snapshot and lookup options they were
+// made with, which the key identifies: a cache file with another key is
+// discarded on load. Results holding live provider data also expire with
+// the TTL set with SetTTL.
+type ResultCache struct {
+	mu      sync.Mutex
+	path    string
+	key     string
+	size    int
+	ttl     time.Duration
+	order   *list.List // of *resultCacheEntry, most recently used first
+	entries map[string]*list.Element
+	hits    int64
+	dirty   bool
+}
+
+// NewResultCache creates a result cache stored at path for results
+// identified by key.
+func NewResultCache(path, key string, size int) *ResultCache {
+	if size < 1 {
+		size = DefaultResultCacheSize
+	}
+	return &ResultCache{
+		path:    path,
+		key:     key,
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// SetTTL makes the results added from now on expire after ttl, for
+// results that hold provider data looked up live, which the provider cache
+// only keeps that long. Zero keeps results as long as the key.
+func (c *ResultCache) SetTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttl = ttl
+}
+
+// Load loads the cache from disk. A missing file, or one made for another
+// key, leaves the cache empty.
+func (c *ResultCache) Load() error {
+	data, err := os.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var f resultCacheFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	if f.Version != resultCacheVersion || f.Key != c.key {
+		// Made for another snapshot: rewrite it on save
+		c.dirty = true
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for i := range f.Entries {
+		e := &f.Entries[i]
+		if e.Result == nil || expired(e, now) {
+			// Dropped entries are only dropped from the file on save
+			c.dirty = true
+			continue
+		}
+		c.add(e.Input, e.Result, e.ExpiresAt)
+	}
+	return nil
+}
+
+// Save writes the cache to disk if it changed.
+func (c *ResultCache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+
+	f := resultCacheFile{
+		Version: resultCacheVersion,
+		Key:     c.key,
+		Entries: make([]resultCacheEntry, 0, c.order.Len()),
+	}
+	for e := c.order.Back(); e != nil; e = e.Prev() {
+		f.Entries = append(f.Entries, *e.Value.(*resultCacheEntry))
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
+// Get returns a copy of the result cached for input.
+func (c *ResultCache) Get(input string) (*output.LookupResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[input]
+	if !ok {
+		return nil, false
+	}
+	if expired(e.Value.(*resultCacheEntry), time.Now()) {
+		c.order.Remove(e)
+		delete(c.entries, input)
+		c.dirty = true
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	c.hits++
+	result := *e.Value.(*resultCacheEntry).Result
+	return &result, true
+}
+
+// Add caches result for input, evicting the least recently used result
+// when the cache is full.
+func (c *ResultCache) Add(input string, result *output.LookupResult) {
+	stored := *result
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var expiresAt *time.Time
+	if c.ttl > 0 {
+		t := time.Now().Add(c.ttl)
+		expiresAt = &t
+	}
+	c.add(input, &stored, expiresAt)
+	c.dirty = true
+}
+
+func (c *ResultCache) add(input string, result *output.LookupResult, expiresAt *time.Time) {
+	if e, ok := c.entries[input]; ok {
+		entry := e.Value.(*resultCacheEntry)
+		entry.Result, entry.ExpiresAt = result, expiresAt
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[input] = c.order.PushFront(&resultCacheEntry{Input: input, Result: result, ExpiresAt: expiresAt})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*resultCacheEntry).Input)
+	}
+}
+
+// expired reports whether e has expired at now.
+func expired(e *resultCacheEntry, now time.Time) bool {
+	return e.ExpiresAt != nil && now.After(*e.ExpiresAt)
+}
+
+// Len returns the number of cached results.
+func (c *ResultCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Hits returns how many lookups were answered from the cache.
+func (c *ResultCache) Hits() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits
+}
@@ -0,0 +1,142 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/output"
+)
+
+func TestResultCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewResultCache(filepath.Join(t.TempDir(), "results.json"), "key", 2)
+	c.Add("a", &output.LookupResult{IP: "a"})
+	c.Add("b", &output.LookupResult{IP: "b"})
+	c.Get("a")
+	c.Add("c", &output.LookupResult{IP: "c"})
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("Get(b) found the least recently used result")
+	}
+	for _, input := range []string{"a", "c"} {
+		if r, ok := c.Get(input); !ok || r.IP != input {
+			t.Errorf("Get(%s) = %v, %v, expected the cached result", input, r, ok)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d, expected 2", c.Len())
+	}
+}
+
+func TestResultCacheSaveLoad(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	path := filepath.Join(tempDir, "results.json")
+
+	c := NewResultCache(path, "snapshot-1", 2)
+	c.Add("a", &output.LookupResult{IP: "a", CountryCode: "US"})
+	c.Add("b", &output.LookupResult{IP: "b", CountryCode: "AU"})
+	c.Get("a")
+	if err := c.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded := NewResultCache(path, "snapshot-1", 2)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if r, ok := loaded.Get("b"); !ok || r.CountryCode != "AU" {
+		t.Errorf("Get(b) = %v, %v, expected AU", r, ok)
+	}
+	// a was used last before saving, so b is evicted first after loading
+	loaded.Add("c", &output.LookupResult{IP: "c"})
+	if _, ok := loaded.Get("b"); !ok {
+		t.Error("Get(b) after Add(c) found nothing, expected a to be evicted")
+	}
+
+	other := NewResultCache(path, "snapshot-2", 2)
+	if err := other.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if other.Len() != 0 {
+		t.Errorf("Len() = %d for another snapshot, expected 0", other.Len())
+	}
+}
+
+func TestResultCacheTTL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.json")
+
+	c := NewResultCache(path, "snapshot", 10)
+	c.Add("kept", &output.LookupResult{IP: "kept"})
+	c.SetTTL(time.Hour)
+	c.Add("live", &output.LookupResult{IP: "live"})
+	c.SetTTL(time.Nanosecond)
+	c.Add("stale", &output.LookupResult{IP: "stale"})
+	time.Sleep(time.Millisecond)
+	if err := c.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if _, ok := c.Get("stale"); ok {
+		t.Error("Get(stale) found an expired result")
+	}
+
+	loaded := NewResultCache(path, "snapshot", 10)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.Len() != 2 {
+		t.Errorf("Len() = %d, expected 2", loaded.Len())
+	}
+	for _, input := range []string{"kept", "live"} {
+		if _, ok := loaded.Get(input); !ok {
+			t.Errorf("Get(%s) found nothing, expected the cached result", input)
+		}
+	}
+}
+
+func TestProcessInputResultCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.json")
+	input := "8.8.8.8\n9.9.9.9\n10.0.0.1\n"
+
+	run := func() (string, int, *ResultCache) {
+		t.Helper()
+		c := NewResultCache(path, "snapshot", 10)
+		if err := c.Load(); err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		p := newTestProcessor(t)
+		e := &countingEnricher{}
+		p.AddEnricher(e)
+		p.SetResultCache(c)
+		var out bytes.Buffer
+		if err := p.ProcessInput(context.Background(), strings.NewReader(input), &out, false); err != nil {
+			t.Fatalf("ProcessInput failed: %v", err)
+		}
+		if err := c.Save(); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		return out.String(), e.calls, c
+	}
+
+	first, calls, _ := run()
+	if calls != 2 {
+		t.Errorf("First run enricher calls = %d, expected 2", calls)
+	}
+	second, calls, c := run()
+	if calls != 0 {
+		t.Errorf("Second run enricher calls = %d, expected 0", calls)
+	}
+	if c.Hits() != 3 {
+		t.Errorf("Hits() = %d, expected 3", c.Hits())
+	}
+	if second != first {
+		t.Errorf("Second run output = %q, expected %q", second, first)
+	}
+}
@@ -0,0 +1,138 @@
+package batch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/hightemp/ip2cc/internal/countries"
+	"github.com/hightemp/ip2cc/internal/output"
+)
+
+// SummaryBy selects what results are grouped by in summary mode.
+type SummaryBy string
+
+const (
+	SummaryByCountry   SummaryBy = "country"
+	SummaryByContinent SummaryBy = "continent"
+	SummaryByASN       SummaryBy = "asn"
+)
+
+// ParseSummaryBy parses a summary grouping name.
+func ParseSummaryBy(s string) (SummaryBy, error) {
+	switch by := SummaryBy(strings.ToLower(s)); by {
+	case SummaryByCountry, SummaryByContinent, SummaryByASN:
+		return by, nil
+	default:
+		return "", fmt.Errorf("invalid summary grouping: %s (use country, continent, or asn)", s)
+	}
+}
+
+// SummaryRow is the count of one country or AS.
+type SummaryRow struct {
+	Key     string  `json:"key"`
+	Name    string  `json:"name"`
+	Count   int     `json:"count"`
+	Percent float64 `json:"percent"`
+}
+
+// Summary counts batch results per country or origin AS instead of
+// writing them. Results without a country or AS are counted under "-".
+type Summary struct {
+	by     SummaryBy
+	total  int
+	counts map[string]*SummaryRow
+}
+
+// NewSummary creates an empty summary grouped by by.
+func NewSummary(by SummaryBy) *Summary {
+	return &Summary{by: by, counts: make(map[string]*SummaryRow)}
+}
+
+// SetSummary makes the processor count results in s instead of writing
+// them; the caller writes the summary once the input is processed.
+func (p *Processor) SetSummary(s *Summary) {
+	p.summary = s
+}
+
+// Add counts result.
+func (s *Summary) Add(result *output.LookupResult) {
+	key, name := s.group(result)
+	row, ok := s.counts[key]
+	if !ok {
+		row = &SummaryRow{Key: key, Name: name}
+		s.counts[key] = row
+	}
+	row.Count++
+	s.total++
+}
+
+// group returns the key and display name result is counted under.
+func (s *Summary) group(result *output.LookupResult) (string, string) {
+	if result.Error != "" {
+		return "-", "unknown"
+	}
+	if s.by == SummaryByContinent {
+		if result.Continent == "" {
+			return "-", "unknown"
+		}
+		return result.Continent, countries.ContinentName(result.Continent)
+	}
+	if s.by == SummaryByASN {
+		if result.Provider == nil || len(result.Provider.ASNs) == 0 {
+			return "-", "unknown"
+		}
+		return fmt.Sprintf("AS%d", result.Provider.ASNs[0]), result.Provider.GetHolderString()
+	}
+	if result.CountryCode == "" && len(result.Countries) > 1 {
+		return strings.Join(result.Countries, ","), "multiple countries"
+	}
+	return result.CountryCode, result.CountryName
+}
+
+// Total returns the number of results counted.
+func (s *Summary) Total() int {
+	return s.total
+}
+
+// Rows returns the counts, largest first, limited to the top entries if
+// top is positive.
+func (s *Summary) Rows(top int) []SummaryRow {
+	rows := make([]SummaryRow, 0, len(s.counts))
+	for _, row := range s.counts {
+		r := *row
+		r.Percent = 100 * float64(r.Count) / float64(s.total)
+		rows = append(rows, r)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Count != rows[j].Count {
+			return rows[i].Count > rows[j].Count
+		}
+		return rows[i].Key < rows[j].Key
+	})
+	if top > 0 && len(rows) > top {
+		rows = rows[:top]
+	}
+	return rows
+}
+
+// Write writes the top rows as tab-separated text or as a JSON array.
+func (s *Summary) Write(w io.Writer, top int, jsonOutput bool) error {
+	rows := s.Rows(top)
+	if jsonOutput {
+		data, err := json.MarshalIndent(rows, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	}
+	for _, row := range rows {
+		if _, err := fmt.Fprintf(w, "%s\t%s\t%d\t%.1f%%\n", row.Key, row.Name, row.Count, row.Percent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
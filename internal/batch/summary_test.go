@@ -0,0 +1,87 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hightemp/ip2cc/internal/output"
+	"github.com/hightemp/ip2cc/internal/provider"
+)
+
+func TestProcessInputSummary(t *testing.T) {
+	p := newTestProcessor(t)
+	summary := NewSummary(SummaryByCountry)
+	p.SetSummary(summary)
+
+	input := "8.8.8.8\n1.1.1.1\n2001:4860::1\nbogus\n8.8.8.1\n"
+	var out bytes.Buffer
+	if err := p.ProcessInput(context.Background(), strings.NewReader(input), &out, false); err != nil {
+		t.Fatalf("ProcessInput failed: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("Expected no per-line output, got %q", out.String())
+	}
+	if summary.Total() != 5 {
+		t.Errorf("Total = %d, expected 5", summary.Total())
+	}
+
+	out.Reset()
+	if err := summary.Write(&out, 2, false); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	expected := "US\tUnited States\t3\t60.0%\n-\tunknown\t1\t20.0%\n"
+	if out.String() != expected {
+		t.Errorf("Summary = %q, expected %q", out.String(), expected)
+	}
+}
+
+func TestSummaryByASN(t *testing.T) {
+	summary := NewSummary(SummaryByASN)
+	google := &provider.Result{ASNs: []int{15169}, Holders: []string{"GOOGLE"}}
+	summary.Add(&output.LookupResult{CountryCode: "US", Provider: google})
+	summary.Add(&output.LookupResult{CountryCode: "US", Provider: google})
+	summary.Add(&output.LookupResult{CountryCode: "AU"})
+
+	rows := summary.Rows(0)
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(rows))
+	}
+	if rows[0].Key != "AS15169" || rows[0].Name != "GOOGLE" || rows[0].Count != 2 {
+		t.Errorf("rows[0] = %+v, expected AS15169 GOOGLE with count 2", rows[0])
+	}
+	if rows[1].Key != "-" || rows[1].Count != 1 {
+		t.Errorf("rows[1] = %+v, expected - with count 1", rows[1])
+	}
+
+	if _, err := ParseSummaryBy("city"); err == nil {
+		t.Error("ParseSummaryBy accepted an invalid grouping")
+	}
+}
+
+func TestSummaryByContinent(t *testing.T) {
+	p := newTestProcessor(t)
+	summary := NewSummary(SummaryByContinent)
+	p.SetSummary(summary)
+
+	input := "8.8.8.8\n1.1.1.1\n2001:4860::1\n10.0.0.1\n"
+	if err := p.ProcessInput(context.Background(), strings.NewReader(input), &bytes.Buffer{}, false); err != nil {
+		t.Fatalf("ProcessInput failed: %v", err)
+	}
+
+	rows := summary.Rows(0)
+	expected := []SummaryRow{
+		{Key: "NA", Name: "North America", Count: 2, Percent: 50},
+		{Key: "-", Name: "unknown", Count: 1, Percent: 25},
+		{Key: "OC", Name: "Oceania", Count: 1, Percent: 25},
+	}
+	if len(rows) != len(expected) {
+		t.Fatalf("Expected %d rows, got %+v", len(expected), rows)
+	}
+	for i := range expected {
+		if rows[i] != expected[i] {
+			t.Errorf("rows[%d] = %+v, expected %+v", i, rows[i], expected[i])
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package batch
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/output"
+)
+
+// TimingStats sums the time spent on the lookups of a run (--timing).
+// Duplicate inputs answered from an earlier result are not counted.
+type TimingStats struct {
+	IndexLoad time.Duration
+	Lookups   int64
+	Lookup    time.Duration
+	Provider  time.Duration
+}
+
+type timingTotals struct {
+	indexLoad time.Duration
+	lookups   atomic.Int64
+	lookup    atomic.Int64
+	provider  atomic.Int64
+}
+
+// setTiming records the durations of one lookup in result and the totals,
+// if timing is enabled.
+func (p *Processor) setTiming(result *output.LookupResult, lookup, provider time.Duration) {
+	if p.timing == nil {
+		return
+	}
+	result.Timing = output.NewTiming(p.timing.indexLoad, lookup, provider)
+	p.timing.lookups.Add(1)
+	p.timing.lookup.Add(int64(lookup))
+	p.timing.provider.Add(int64(provider))
+}
+
+// TimingStats returns the summed lookup durations; it is empty unless
+// SetTiming was called.
+func (p *Processor) TimingStats() TimingStats {
+	if p.timing == nil {
+		return TimingStats{}
+	}
+	return TimingStats{
+		IndexLoad: p.timing.indexLoad,
+		Lookups:   p.timing.lookups.Load(),
+		Lookup:    time.Duration(p.timing.lookup.Load()),
+		Provider:  time.Duration(p.timing.provider.Load()),
+	}
+}
@@ -0,0 +1,28 @@
+package batch
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLookupTiming(t *testing.T) {
+	p := newTestProcessor(t)
+	if result := p.Lookup(context.Background(), "8.8.8.8"); result.Timing != nil {
+		t.Errorf("Timing = %+v without SetTiming, expected nil", result.Timing)
+	}
+
+	p.SetTiming(1500 * time.Microsecond)
+	for _, ip := range []string{"8.8.8.8", "10.0.0.1", "1.0.0.0/24", "9.9.9.9"} {
+		result := p.Lookup(context.Background(), ip)
+		if result.Timing == nil {
+			t.Fatalf("Lookup(%s) has no timing", ip)
+		}
+		if result.Timing.IndexLoadMS != 1.5 {
+			t.Errorf("Lookup(%s) IndexLoadMS = %v, expected 1.5", ip, result.Timing.IndexLoadMS)
+		}
+	}
+	if stats := p.TimingStats(); stats.Lookups != 4 || stats.IndexLoad != 1500*time.Microsecond {
+		t.Errorf("TimingStats = %+v, expected 4 lookups", stats)
+	}
+}
@@ -0,0 +1,162 @@
+// Package bundle reads and writes single-file snapshot bundles.
+//
+// A bundle packs everything needed for lookups into one file:
+//
+//	magic     [8]byte  "IP2CCBDL"
+//	version   uint32
+//	count     uint32   number of sections
+//	sections:
+//	  kind    uint32
+//	  length  uint64
+//	  data    [length]byte
+//
+// Index sections hold index files verbatim; metadata and provider tables are JSON.
+// All integers are little-endian. Unknown section kinds are skipped.
+package bundle
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hightemp/ip2cc/internal/config"
+	"github.com/hightemp/ip2cc/internal/index"
+	"github.com/hightemp/ip2cc/internal/snapshot"
+)
+
+const (
+	// Magic bytes for bundle files
+	Magic = "IP2CCBDL"
+	// Version is the current bundle format version.
+	Version uint32 = 1
+	// Extension is the conventional bundle file extension.
+	Extension = ".ip2cc"
+)
+
+// Section kinds
+const (
+	SectionMetadata uint32 = iota + 1
+	SectionIndexV4
+	SectionIndexV6
+	SectionProviderCache
+)
+
+// Bundle is an opened bundle file.
+type Bundle struct {
+	Metadata *snapshot.Metadata
+	V4       *index.Trie
+	V6       *index.Trie
+	// ProviderCache is the ASN holder table, if the bundle carries one.
+	ProviderCache []byte
+}
+
+type section struct {
+	kind uint32
+	path string
+}
+
+// Create writes a bundle from a snapshot directory. providerCachePath is
+// optional; when set and present, the ASN holder table is included.
+func Create(path, snapshotDir, providerCachePath string) error {
+	sections := []section{
+		{SectionMetadata, config.MetadataPath(snapshotDir)},
+		{SectionIndexV4, config.IndexV4Path(snapshotDir)},
+		{SectionIndexV6, config.IndexV6Path(snapshotDir)},
+	}
+	if providerCachePath != "" {
+		if _, err := os.Stat(providerCachePath); err == nil {
+			sections = append(sections, section{SectionProviderCache, providerCachePath})
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	var header [16]byte
+	copy(header[:8], Magic)
+	binary.LittleEndian.PutUint32(header[8:12], Version)
+	binary.LittleEndian.PutUint32(header[12:16], uint32(len(sections)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+
+	for _, s := range sections {
+		data, err := os.ReadFile(s.path)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", s.path, err)
+		}
+		var sh [12]byte
+		binary.LittleEndian.PutUint32(sh[:4], s.kind)
+		binary.LittleEndian.PutUint64(sh[4:], uint64(len(data)))
+		if _, err := w.Write(sh[:]); err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Open reads a bundle file and loads its indices.
+func Open(path string) (*Bundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 16 || string(data[:8]) != Magic {
+		return nil, fmt.Errorf("%s is not an ip2cc bundle", path)
+	}
+	if v := binary.LittleEndian.Uint32(data[8:12]); v != Version {
+		return nil, fmt.Errorf("unsupported bundle version %d (expected %d)", v, Version)
+	}
+	count := binary.LittleEndian.Uint32(data[12:16])
+
+	b := &Bundle{}
+	pos := 16
+	for i := uint32(0); i < count; i++ {
+		if pos+12 > len(data) {
+			return nil, fmt.Errorf("section %d: %w", i, io.ErrUnexpectedEOF)
+		}
+		kind := binary.LittleEndian.Uint32(data[pos : pos+4])
+		length := binary.LittleEndian.Uint64(data[pos+4 : pos+12])
+		pos += 12
+		if length > uint64(len(data)-pos) {
+			return nil, fmt.Errorf("section %d: %w", i, io.ErrUnexpectedEOF)
+		}
+		body := data[pos : pos+int(length)]
+		pos += int(length)
+
+		switch kind {
+		case SectionMetadata:
+			if b.Metadata, err = snapshot.ParseMetadata(body); err != nil {
+				return nil, fmt.Errorf("parse metadata: %w", err)
+			}
+		case SectionIndexV4:
+			if b.V4, err = index.Decode(body, false); err != nil {
+				return nil, fmt.Errorf("load IPv4 index: %w", err)
+			}
+		case SectionIndexV6:
+			if b.V6, err = index.Decode(body, true); err != nil {
+				return nil, fmt.Errorf("load IPv6 index: %w", err)
+			}
+		case SectionProviderCache:
+			b.ProviderCache = body
+		}
+	}
+
+	if b.Metadata == nil || b.V4 == nil || b.V6 == nil {
+		return nil, fmt.Errorf("bundle %s is missing required sections", path)
+	}
+	return b, nil
+}
@@ -0,0 +1,118 @@
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hightemp/ip2cc/internal/config"
+	"github.com/hightemp/ip2cc/internal/index"
+	"github.com/hightemp/ip2cc/internal/snapshot"
+)
+
+// writeSnapshot creates a minimal snapshot directory.
+func writeSnapshot(t *testing.T, dir string) {
+	t.Helper()
+
+	v4 := index.NewTrie(false)
+	v6 := index.NewTrie(true)
+	v4.InsertCIDR("8.8.8.0/24", "US")
+	v6.InsertCIDR("2a00:1450::/32", "IE")
+	if err := index.SaveIndex(config.IndexV4Path(dir), config.IndexV6Path(dir), v4, v6); err != nil {
+		t.Fatalf("SaveIndex failed: %v", err)
+	}
+
+	meta := snapshot.NewMetadata()
+	meta.RequestedTime = "2025-01-15"
+	meta.PrefixesV4 = 1
+	meta.PrefixesV6 = 1
+	if err := meta.Save(config.MetadataPath(dir)); err != nil {
+		t.Fatalf("Save metadata failed: %v", err)
+	}
+}
+
+func TestCreateAndOpen(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	writeSnapshot(t, tmpDir)
+	cachePath := filepath.Join(tmpDir, "provider_cache.json")
+	os.WriteFile(cachePath, []byte(`{"15169":{"holder":"GOOGLE LLC"}}`), 0644)
+
+	path := filepath.Join(tmpDir, "test"+Extension)
+	if err := Create(path, tmpDir, cachePath); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	b, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	if b.Metadata.RequestedTime != "2025-01-15" {
+		t.Errorf("RequestedTime = %s, expected 2025-01-15", b.Metadata.RequestedTime)
+	}
+	result, _ := b.V4.LookupString("8.8.8.8")
+	if result == nil || result.CountryCode != "US" {
+		t.Errorf("IPv4 lookup = %+v, expected US", result)
+	}
+	result, _ = b.V6.LookupString("2a00:1450::1")
+	if result == nil || result.CountryCode != "IE" {
+		t.Errorf("IPv6 lookup = %+v, expected IE", result)
+	}
+	if len(b.ProviderCache) == 0 {
+		t.Error("Provider cache section missing")
+	}
+}
+
+func TestCreateWithoutProviderCache(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	writeSnapshot(t, tmpDir)
+	path := filepath.Join(tmpDir, "test"+Extension)
+	if err := Create(path, tmpDir, filepath.Join(tmpDir, "missing.json")); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	b, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if b.ProviderCache != nil {
+		t.Error("Expected no provider cache section")
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	writeSnapshot(t, tmpDir)
+	path := filepath.Join(tmpDir, "test"+Extension)
+	if err := Create(path, tmpDir, ""); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	// Truncated bundle
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, data[:len(data)-10], 0644)
+	if _, err := Open(path); err == nil {
+		t.Error("Expected error opening truncated bundle")
+	}
+
+	// Not a bundle
+	os.WriteFile(path, []byte("not a bundle"), 0644)
+	if _, err := Open(path); err == nil {
+		t.Error("Expected error opening invalid file")
+	}
+}
@@ -0,0 +1,269 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hightemp/ip2cc/internal/asndb"
+	"github.com/hightemp/ip2cc/internal/config"
+	"github.com/hightemp/ip2cc/internal/countries"
+	"github.com/hightemp/ip2cc/internal/index"
+	"github.com/hightemp/ip2cc/internal/provider"
+	"github.com/hightemp/ip2cc/internal/ripestat"
+	"github.com/spf13/cobra"
+)
+
+var (
+	asnPrefixes bool
+	asnJSON     bool
+
+	// asnLookup is the ASN given with --asn to the main command.
+	asnLookup string
+)
+
+var asnCmd = &cobra.Command{
+	Use:   "asn <asn>",
+	Short: "Show the holder of an ASN and the prefixes it announces",
+	Long: `Looks up an autonomous system in RIPEstat. With --prefixes, lists every
+prefix the ASN currently announces, each annotated with its registry
+country from the local index.
+
+Examples:
+  ip2cc asn AS3333
+  ip2cc asn 3333 --prefixes
+  ip2cc asn AS15169 --prefixes --json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runASN,
+}
+
+func init() {
+	asnCmd.Flags().BoolVar(&asnPrefixes, "prefixes", false, "list announced prefixes with their registry country")
+	asnCmd.Flags().BoolVar(&asnJSON, "json", false, "output in JSON format")
+}
+
+// announcedPrefix is a prefix announced by an ASN with its registry countries.
+type announcedPrefix struct {
+	Prefix      string   `json:"prefix"`
+	Countries   []string `json:"countries"`
+	Containment string   `json:"containment"`
+}
+
+func runASN(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	asn, err := parseASN(args[0])
+	if err != nil {
+		exitWithCode(ExitInvalidInput, err.Error())
+		return nil
+	}
+
+	fc, err := loadFileConfig()
+	if err != nil {
+		return err
+	}
+	client := ripestat.NewClient(ripestat.WithBaseURL(ripestatBaseURL(fc)))
+
+	if !asnPrefixes {
+		overview, err := client.GetASOverview(ctx, asn)
+		if err != nil {
+			return err
+		}
+		if asnJSON {
+			return printJSON(struct {
+				ASN       int    `json:"asn"`
+				Holder    string `json:"holder"`
+				Announced bool   `json:"announced"`
+			}{asn, overview.Holder, overview.Announced})
+		}
+		announced := "not announced"
+		if overview.Announced {
+			announced = "announced"
+		}
+		fmt.Printf("AS%d\t%s\t%s\n", asn, overview.Holder, announced)
+		return nil
+	}
+
+	result, err := client.GetAnnouncedPrefixes(ctx, asn)
+	if err != nil {
+		return err
+	}
+	prefixes, err := annotatePrefixes(result.Prefixes)
+	if err != nil {
+		return err
+	}
+
+	if asnJSON {
+		return printJSON(prefixes)
+	}
+	for _, p := range prefixes {
+		countries := "-"
+		if len(p.Countries) > 0 {
+			countries = strings.Join(p.Countries, ",")
+		}
+		fmt.Printf("%s\t%s\n", p.Prefix, countries)
+	}
+	return nil
+}
+
+// annotatePrefixes looks up the registry countries of prefixes in the
+// latest snapshot.
+func annotatePrefixes(prefixes []string) ([]announcedPrefix, error) {
+	snap, err := openSnapshot("")
+	if err != nil {
+		return nil, fmt.Errorf("%w\nRun 'ip2cc update' to download data", err)
+	}
+
+	annotated := make([]announcedPrefix, 0, len(prefixes))
+	for _, s := range prefixes {
+		entry := announcedPrefix{Prefix: s, Countries: []string{}, Containment: index.NotFound.String()}
+		if p, err := netip.ParsePrefix(s); err == nil {
+			trie := snap.v4
+			if p.Addr().Is6() {
+				trie = snap.v6
+			}
+			match := trie.LookupPrefix(p.Masked())
+			entry.Containment = match.Containment.String()
+			if match.Countries != nil {
+				entry.Countries = match.Countries
+			}
+		}
+		annotated = append(annotated, entry)
+	}
+	return annotated, nil
+}
+
+// asnLookupResult is the summary of an ASN looked up with the main command.
+type asnLookupResult struct {
+	ASN         int    `json:"asn"`
+	Holder      string `json:"holder,omitempty"`
+	CountryCode string `json:"country_code,omitempty"`
+	CountryName string `json:"country_name,omitempty"`
+	Prefixes    int    `json:"prefixes"`
+	// Source is where the result came from: ripestat, or local for the
+	// offline ASN database.
+	Source string `json:"source"`
+}
+
+// isASNInput reports whether a lookup argument is an ASN such as "AS13335".
+func isASNInput(s string) bool {
+	if len(s) < 3 || !strings.EqualFold(s[:2], "AS") {
+		return false
+	}
+	_, err := parseASN(s)
+	return err == nil
+}
+
+// lookupASNInput looks up the ASN given as the argument or with --asn: its
+// holder, registration country and number of announced prefixes. RIPEstat
+// answers unless --offline or --provider-mode local is given; the offline
+// ASN database of 'ip2cc update --asn-db' answers then, and whenever
+// RIPEstat fails.
+func lookupASNInput(ctx context.Context, args []string) error {
+	input := asnLookup
+	if input == "" {
+		input = args[0]
+	} else if len(args) > 0 {
+		return exitErr(ExitInvalidInput, "Error: --asn cannot be combined with an argument")
+	}
+	if resultWriter != nil {
+		return exitErr(ExitInvalidInput, fmt.Sprintf("Error: --format %s is not available for ASN lookups", outputFormat))
+	}
+	asn, err := parseASN(input)
+	if err != nil {
+		return exitErr(ExitInvalidInput, fmt.Sprintf("Error: %v", err))
+	}
+
+	var result *asnLookupResult
+	var ripestatErr error
+	if !offline && providerMode != string(provider.ModeLocal) {
+		result, ripestatErr = lookupASNRIPEstat(ctx, asn)
+	}
+	if result == nil {
+		db, err := asndb.Load(config.ASNDBDir(cacheDir))
+		if err != nil {
+			if ripestatErr != nil {
+				return ripestatErr
+			}
+			return exitErr(ExitNoSnapshot, fmt.Sprintf("Error: no ASN database: %v\nRun 'ip2cc update --asn-db' to download it.", err))
+		}
+		if ripestatErr != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v; using the local ASN database\n", ripestatErr)
+		}
+		as, ok := db.LookupAS(uint32(asn))
+		if !ok {
+			return exitErr(ExitNotFound, fmt.Sprintf("AS%d not found in the local ASN database", asn))
+		}
+		result = &asnLookupResult{ASN: asn, Holder: as.Holder, CountryCode: as.Country, Prefixes: as.Prefixes, Source: "local"}
+	}
+	result.CountryName = countries.GetName(result.CountryCode)
+
+	if jsonOutput {
+		return printJSON(result)
+	}
+	holder, country := result.Holder, result.CountryCode
+	if holder == "" {
+		holder = "-"
+	}
+	if country == "" {
+		country = "-"
+	} else if result.CountryName != "" {
+		country += "\t" + result.CountryName
+	}
+	fmt.Printf("AS%d\t%s\t%s\t%d prefixes\n", asn, holder, country, result.Prefixes)
+	return nil
+}
+
+// lookupASNRIPEstat summarizes an ASN from RIPEstat's as-overview,
+// rir-stats-country and announced-prefixes endpoints.
+func lookupASNRIPEstat(ctx context.Context, asn int) (*asnLookupResult, error) {
+	fc, err := loadFileConfig()
+	if err != nil {
+		return nil, err
+	}
+	client := ripestat.NewClient(ripestat.WithBaseURL(ripestatBaseURL(fc)))
+
+	overview, err := client.GetASOverview(ctx, asn)
+	if err != nil {
+		return nil, err
+	}
+	country, err := client.GetRIRStatsCountry(ctx, fmt.Sprintf("AS%d", asn))
+	if err != nil {
+		return nil, err
+	}
+	announced, err := client.GetAnnouncedPrefixes(ctx, asn)
+	if err != nil {
+		return nil, err
+	}
+	return &asnLookupResult{
+		ASN:         asn,
+		Holder:      overview.Holder,
+		CountryCode: countries.Normalize(country),
+		Prefixes:    len(announced.Prefixes),
+		Source:      "ripestat",
+	}, nil
+}
+
+// parseASN parses an AS number given as "AS3333" or "3333".
+func parseASN(s string) (int, error) {
+	digits := strings.TrimPrefix(strings.ToUpper(s), "AS")
+	asn, err := strconv.ParseUint(digits, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ASN: %s", s)
+	}
+	return int(asn), nil
+}
+
+// printJSON writes v to stdout as indented JSON.
+func printJSON(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
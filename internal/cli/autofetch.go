@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hightemp/ip2cc/internal/snapshot"
+)
+
+// autoFetch makes a lookup with --time build the missing snapshot for that
+// date instead of failing.
+var autoFetch bool
+
+// fetchMissingSnapshot builds the snapshot for date when there is none in
+// the cache, with --auto-fetch or after asking on the terminal, and reports
+// whether it did.
+func fetchMissingSnapshot(date string) bool {
+	if date == "" || offline || bundlePath != "" || mmdbPath != "" {
+		return false
+	}
+	mgr := snapshot.NewManager(cacheDir)
+	if mgr.SnapshotExists(date) {
+		return false
+	}
+	if !autoFetch {
+		// Only ask when the answer cannot be mistaken for batch input
+		if !isTerminal(os.Stdin) || !isTerminal(os.Stderr) {
+			return false
+		}
+		fmt.Fprintf(os.Stderr, "No snapshot for %s. Download it now? [y/N] ", date)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			return false
+		}
+	}
+
+	// The update reports its progress on stdout, which belongs to the
+	// lookup results here
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	defer func() { os.Stdout = stdout }()
+
+	// A snapshot fetched for a past lookup does not replace the latest one
+	if _, _, err := mgr.GetLatestSnapshot(); err == nil {
+		keepLatest = true
+	}
+	if err := runUpdate(updateCmd, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return false
+	}
+	return true
+}
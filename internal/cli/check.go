@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hightemp/ip2cc/internal/batch"
+	"github.com/hightemp/ip2cc/internal/countries"
+	"github.com/hightemp/ip2cc/internal/output"
+	"github.com/spf13/cobra"
+)
+
+var (
+	checkAllow string
+	checkDeny  string
+	checkQuiet bool
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check [ip|cidr...]",
+	Short: "Check addresses against allowed or denied countries",
+	Long: `Looks up the addresses given as arguments, or read from stdin one per
+line, and checks their countries against a policy: either the allowed
+countries (--allow) or the denied ones (--deny). Entries are country codes
+or country group names such as eu. A CIDR or range passes only if all its
+countries do. Addresses of unknown country, including private and other
+special-purpose addresses, are denied by --allow and allowed by --deny.
+
+Each address is printed with its country and "allowed" or "denied". The
+exit code is 0 if all addresses are allowed, 1 if any is denied, and 2 if
+any input is invalid.
+
+Examples:
+  ip2cc check --allow US,CA,GB 203.0.113.5
+  ip2cc check --deny cn,ru --quiet < clients.txt || echo "blocked client"`,
+	RunE: runCheck,
+}
+
+func init() {
+	checkCmd.Flags().StringVar(&checkAllow, "allow", "", "comma-separated countries or groups to allow")
+	checkCmd.Flags().StringVar(&checkDeny, "deny", "", "comma-separated countries or groups to deny")
+	checkCmd.Flags().BoolVarP(&checkQuiet, "quiet", "q", false, "print nothing, only set the exit code")
+	checkCmd.Flags().StringVar(&timeFlag, "time", "", "check against the snapshot of a specific date (YYYY-MM-DD)")
+	checkCmd.Flags().BoolVar(&nearest, "nearest", false, "with --time: use the snapshot closest to the date when there is none for it")
+	checkCmd.Flags().StringVar(&bundlePath, "bundle", "", "check against a snapshot bundle file instead of the cache")
+	checkCmd.Flags().BoolVar(&noGeofeed, "no-geofeed", false, "check against the RIR data without the geofeed overlay")
+}
+
+func runCheck(cmd *cobra.Command, args []string) error {
+	policy, err := checkPolicy()
+	if err != nil {
+		exitWithCode(ExitInvalidInput, fmt.Sprintf("Error: %v", err))
+		return nil
+	}
+
+	inputs := args
+	if len(inputs) == 0 {
+		if inputs, err = readCheckInputs(); err != nil {
+			return fmt.Errorf("read stdin: %w", err)
+		}
+	}
+	if len(inputs) == 0 {
+		exitWithCode(ExitInvalidInput, "Error: no addresses given")
+		return nil
+	}
+
+	snap, err := openSnapshot(timeFlag)
+	if err != nil {
+		exitWithCode(ExitNoSnapshot, fmt.Sprintf("Error: %v\nRun 'ip2cc update' to download data.", err))
+		return nil
+	}
+	prefixes, err := nat64Prefixes()
+	if err != nil {
+		exitWithCode(ExitInvalidInput, fmt.Sprintf("Error: %v", err))
+		return nil
+	}
+	processor := batch.NewProcessor(snap.v4, snap.v6, nil, snap.meta)
+	processor.SetNAT64Prefixes(prefixes)
+
+	ctx := context.Background()
+	w := bufio.NewWriter(os.Stdout)
+	invalid, denied := false, false
+	for _, input := range inputs {
+		result := processor.Lookup(ctx, input)
+		if result.Invalid {
+			invalid = true
+			fmt.Fprintf(os.Stderr, "%s: %s\n", input, result.Error)
+			continue
+		}
+
+		verdict := "allowed"
+		if !policy.Allows(checkCountries(result)) {
+			verdict = "denied"
+			denied = true
+		}
+		if !checkQuiet {
+			cc := result.CountryCode
+			if len(result.Countries) > 1 {
+				cc = strings.Join(result.Countries, ",")
+			}
+			if cc == "" {
+				cc = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", input, cc, verdict)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	switch {
+	case invalid:
+		exitWithCode(ExitInvalidInput, "Error: invalid input")
+	case denied:
+		stopProfiling()
+		os.Exit(ExitDenied)
+	}
+	return nil
+}
+
+// checkPolicy creates the policy given with --allow or --deny.
+func checkPolicy() (*countries.Policy, error) {
+	if (checkAllow == "") == (checkDeny == "") {
+		return nil, fmt.Errorf("give either --allow or --deny")
+	}
+	groups, err := loadGroups()
+	if err != nil {
+		return nil, err
+	}
+	if checkDeny != "" {
+		return countries.NewPolicy(strings.Split(checkDeny, ","), true, groups)
+	}
+	return countries.NewPolicy(strings.Split(checkAllow, ","), false, groups)
+}
+
+// checkCountries returns the countries of result, leaving out special
+// addresses. A block only partly in the index has no countries, as the
+// country of the rest is unknown.
+func checkCountries(result *output.LookupResult) []string {
+	switch {
+	case result.Error != "", result.Special, result.Containment == "partial":
+		return nil
+	case len(result.Countries) > 0:
+		return result.Countries
+	case result.CountryCode != "":
+		return []string{result.CountryCode}
+	}
+	return nil
+}
+
+// readCheckInputs reads the addresses to check from stdin, skipping blank
+// lines and comments.
+func readCheckInputs() ([]string, error) {
+	var inputs []string
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			inputs = append(inputs, line)
+		}
+	}
+	return inputs, scanner.Err()
+}
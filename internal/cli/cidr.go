@@ -0,0 +1,173 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/hightemp/ip2cc/internal/countries"
+	"github.com/hightemp/ip2cc/internal/export"
+	"github.com/hightemp/ip2cc/internal/iprange"
+	"github.com/spf13/cobra"
+)
+
+// countryOperand starts a cidr operand selecting the prefixes of countries
+// in the index rather than naming a file.
+const countryOperand = "country:"
+
+var cidrCmd = &cobra.Command{
+	Use:   "cidr",
+	Short: "Aggregate, subtract, or intersect prefix lists",
+	Long: `Computes set operations over prefix lists and prints the resulting
+prefixes, one per line, as the minimal sorted list of CIDRs.
+
+Each operand is a file with one CIDR, address, or range per line ('-' for
+stdin), or country:CODES for the prefixes the local index assigns to the
+countries or country groups, e.g. country:ru or country:eu,ch. Nested
+prefixes of the index are resolved as in lookups.
+
+Examples:
+  ip2cc cidr aggregate blocklist.txt
+  ip2cc cidr subtract country:ru allowlist.txt
+  ip2cc cidr intersect country:de cloud-ranges.txt`,
+}
+
+var cidrAggregateCmd = &cobra.Command{
+	Use:   "aggregate OPERAND...",
+	Short: "Merge prefix lists into the minimal list of prefixes",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: runCIDR(func(operands [][]netip.Prefix) []netip.Prefix {
+		var all []netip.Prefix
+		for _, prefixes := range operands {
+			all = append(all, prefixes...)
+		}
+		return iprange.Aggregate(all)
+	}),
+}
+
+var cidrSubtractCmd = &cobra.Command{
+	Use:   "subtract OPERAND OPERAND...",
+	Short: "Print the prefixes of the first operand not in any other",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: runCIDR(func(operands [][]netip.Prefix) []netip.Prefix {
+		result := iprange.Aggregate(operands[0])
+		for _, prefixes := range operands[1:] {
+			result = iprange.Subtract(result, prefixes)
+		}
+		return result
+	}),
+}
+
+var cidrIntersectCmd = &cobra.Command{
+	Use:   "intersect OPERAND OPERAND...",
+	Short: "Print the prefixes contained in all operands",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: runCIDR(func(operands [][]netip.Prefix) []netip.Prefix {
+		result := iprange.Aggregate(operands[0])
+		for _, prefixes := range operands[1:] {
+			result = iprange.Intersect(result, prefixes)
+		}
+		return result
+	}),
+}
+
+func init() {
+	cidrCmd.PersistentFlags().StringVar(&timeFlag, "time", "", "select countries from the snapshot of a specific date (YYYY-MM-DD)")
+	cidrCmd.PersistentFlags().BoolVar(&nearest, "nearest", false, "with --time: use the snapshot closest to the date when there is none for it")
+	cidrCmd.PersistentFlags().StringVar(&bundlePath, "bundle", "", "select countries from a snapshot bundle file instead of the cache")
+	cidrCmd.PersistentFlags().BoolVar(&noGeofeed, "no-geofeed", false, "select countries from the RIR data without the geofeed overlay")
+	cidrCmd.AddCommand(cidrAggregateCmd)
+	cidrCmd.AddCommand(cidrSubtractCmd)
+	cidrCmd.AddCommand(cidrIntersectCmd)
+}
+
+// runCIDR returns a command printing the result of combining the prefix
+// lists of its operands with op.
+func runCIDR(op func(operands [][]netip.Prefix) []netip.Prefix) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		var snap *loadedSnapshot
+		operands := make([][]netip.Prefix, len(args))
+		for i, arg := range args {
+			if !strings.HasPrefix(arg, countryOperand) {
+				prefixes, err := readPrefixList(arg)
+				if err != nil {
+					exitWithCode(ExitInvalidInput, fmt.Sprintf("Error: %v", err))
+					return nil
+				}
+				operands[i] = prefixes
+				continue
+			}
+
+			codes, err := operandCountries(strings.TrimPrefix(arg, countryOperand))
+			if err != nil {
+				exitWithCode(ExitInvalidInput, fmt.Sprintf("Error: %v", err))
+				return nil
+			}
+			if snap == nil {
+				if snap, err = openSnapshot(timeFlag); err != nil {
+					exitWithCode(ExitNoSnapshot, fmt.Sprintf("Error: %v\nRun 'ip2cc update' to download data.", err))
+					return nil
+				}
+			}
+			for _, set := range export.Collect(snap.v4, snap.v6, codes) {
+				operands[i] = append(operands[i], set.V4...)
+				operands[i] = append(operands[i], set.V6...)
+			}
+		}
+
+		w := bufio.NewWriter(os.Stdout)
+		for _, p := range op(operands) {
+			fmt.Fprintln(w, p)
+		}
+		return w.Flush()
+	}
+}
+
+// readPrefixList reads the prefix list file at path, or stdin for "-".
+func readPrefixList(path string) ([]netip.Prefix, error) {
+	if path == "-" {
+		return iprange.ParseList(os.Stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	prefixes, err := iprange.ParseList(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return prefixes, nil
+}
+
+// operandCountries returns the country codes of a comma-separated list of
+// countries and country groups.
+func operandCountries(list string) ([]string, error) {
+	groups, err := loadGroups()
+	if err != nil {
+		return nil, err
+	}
+	var codes []string
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if members, ok := groups.Members(entry); ok {
+			codes = append(codes, members...)
+			continue
+		}
+		cc := countries.Normalize(entry)
+		if !countries.IsValid(cc) {
+			return nil, fmt.Errorf("invalid country code or group: %s", entry)
+		}
+		codes = append(codes, cc)
+	}
+	if len(codes) == 0 {
+		return nil, fmt.Errorf("%s needs at least one country code", countryOperand)
+	}
+	return codes, nil
+}
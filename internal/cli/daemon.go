@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/config"
+	"github.com/hightemp/ip2cc/internal/iprange"
+	"github.com/hightemp/ip2cc/internal/output"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Daemon client flags
+var (
+	useDaemon    bool
+	daemonSocket string
+)
+
+// daemonDialTimeout bounds connecting to the daemon socket, so that a stuck
+// daemon does not hang one-off lookups.
+const daemonDialTimeout = time.Second
+
+// daemonFlags are the lookup flags a daemon connection honours. The daemon
+// answers with its own snapshot and provider settings, so any other flag
+// makes the lookup run locally.
+var daemonFlags = map[string]bool{
+	"use-daemon":    true,
+	"daemon-socket": true,
+	"cache-dir":     true,
+	"config":        true,
+	"no-progress":   true,
+}
+
+// dialDaemon connects to the lookup daemon for --use-daemon. It returns nil
+// when the lookup should run locally: the flags ask for something the
+// daemon cannot answer, or no daemon is listening.
+func dialDaemon(cmd *cobra.Command) net.Conn {
+	if !useDaemon {
+		return nil
+	}
+	compatible := true
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if !daemonFlags[f.Name] {
+			compatible = false
+		}
+	})
+	if !compatible {
+		return nil
+	}
+
+	path := daemonSocket
+	if path == "" {
+		path = config.SocketPath(cacheDir)
+	}
+	conn, err := net.DialTimeout("unix", path, daemonDialTimeout)
+	if err != nil {
+		return nil
+	}
+	return conn
+}
+
+// lookupDaemon forwards the argument, or the lines of stdin, to the daemon
+// on conn and prints the answers.
+func lookupDaemon(conn net.Conn, args []string) error {
+	defer conn.Close()
+
+	if len(args) == 1 {
+		// The JSON answer tells invalid input from a failed lookup
+		input := strings.TrimSpace(args[0])
+		fmt.Fprintf(conn, "FORMAT json\n%s\n", input)
+		line, err := bufio.NewReader(conn).ReadBytes('\n')
+		if err != nil {
+			return fmt.Errorf("read daemon answer: %w", err)
+		}
+		var result output.LookupResult
+		if err := json.Unmarshal(line, &result); err != nil {
+			return fmt.Errorf("decode daemon answer: %w", err)
+		}
+
+		// Report errors as a local lookup would
+		kind, invalid := "IP", "Invalid IP address"
+		if strings.Contains(input, "/") {
+			kind, invalid = "CIDR", "Invalid CIDR"
+		} else if iprange.LooksLikeRange(input) {
+			kind, invalid = "Range", "Invalid range"
+		}
+		switch {
+		case result.Invalid:
+			return exitErr(ExitInvalidInput, fmt.Sprintf("%s: %s", invalid, input))
+		case result.Error != "":
+			return exitErr(ExitNotFound, fmt.Sprintf("%s %s: %s", kind, input, result.Error))
+		}
+		result.GeoRequested = result.Geolocation != nil
+		fmt.Println(result.FormatText())
+		return nil
+	}
+
+	// The daemon may answer in JSON by default; batches are copied as text
+	fmt.Fprintln(conn, "FORMAT text")
+
+	// Batch mode: stream stdin while copying the answers
+	sendErr := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(conn, os.Stdin)
+		if uc, ok := conn.(*net.UnixConn); ok {
+			uc.CloseWrite()
+		}
+		sendErr <- err
+	}()
+	w := bufio.NewWriter(os.Stdout)
+	if _, err := io.Copy(w, conn); err != nil {
+		return fmt.Errorf("read daemon answers: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return <-sendErr
+}
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hightemp/ip2cc/internal/enrich"
+	"github.com/hightemp/ip2cc/internal/iplist"
+)
+
+// enrichCommands are the plugin command lines given with --enrich.
+var enrichCommands []string
+
+// resultEnrichers run on the results of single lookups.
+var resultEnrichers []enrich.Enricher
+
+// startEnrichers starts the enrichment plugins from the configuration file
+// followed by those given with --enrich, after flagging addresses on the
+// snapshot's lists, if it has any. Callers release them with enrich.Close.
+func startEnrichers(lists iplist.Lists) ([]enrich.Enricher, error) {
+	fc, err := loadFileConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var enrichers []enrich.Enricher
+	if len(lists) > 0 {
+		enrichers = append(enrichers, iplist.NewEnricher(lists))
+	}
+	start := func(name string, argv []string) error {
+		c, err := enrich.NewCommand(name, argv)
+		if err != nil {
+			enrich.Close(enrichers)
+			return err
+		}
+		enrichers = append(enrichers, c)
+		return nil
+	}
+	for _, ec := range fc.Enrichers {
+		if err := start(ec.Name, ec.Command); err != nil {
+			return nil, fmt.Errorf("config enrichers: %w", err)
+		}
+	}
+	for _, line := range enrichCommands {
+		if err := start("", strings.Fields(line)); err != nil {
+			return nil, err
+		}
+	}
+	return enrichers, nil
+}
@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hightemp/ip2cc/internal/countries"
+	"github.com/hightemp/ip2cc/internal/export"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportFormat    string
+	exportCountries string
+	exportOutput    string
+	exportName      string
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export country prefixes in the format of other tools",
+	Long: `Writes the prefixes of the selected countries (all if none are given)
+from the local index in the format of a firewall or other tool. Nested
+prefixes are resolved as in lookups and adjacent ones are merged.
+
+Formats:
+` + exportFormatList() + `
+Examples:
+  ip2cc export --format nftset --country cn,ru > geoblock.nft
+  ip2cc export --format ipset --country cn -o cn.ipset && ipset restore < cn.ipset`,
+	Args: cobra.NoArgs,
+	RunE: runExport,
+}
+
+func init() {
+	exportCmd.Flags().StringVar(&exportFormat, "format", "", "output format (required)")
+	exportCmd.Flags().StringVar(&exportCountries, "country", "", "comma-separated country codes to export (default: all)")
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "output file (default: stdout)")
+	exportCmd.Flags().StringVar(&exportName, "name", "", "name of the generated table, set prefix, or zone (default depends on format)")
+	exportCmd.Flags().StringVar(&timeFlag, "time", "", "export the snapshot of a specific date (YYYY-MM-DD)")
+	exportCmd.Flags().BoolVar(&nearest, "nearest", false, "with --time: use the snapshot closest to the date when there is none for it")
+	exportCmd.Flags().StringVar(&bundlePath, "bundle", "", "export from a snapshot bundle file instead of the cache")
+	exportCmd.Flags().BoolVar(&noGeofeed, "no-geofeed", false, "export the RIR data without the geofeed overlay")
+	exportCmd.MarkFlagRequired("format")
+}
+
+// exportFormatList describes the export formats for the help text.
+func exportFormatList() string {
+	var sb strings.Builder
+	for _, f := range export.Formats() {
+		fmt.Fprintf(&sb, "  %-15s %s\n", f.Name, f.Description)
+	}
+	return sb.String()
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	format, err := export.Get(exportFormat)
+	if err != nil {
+		exitWithCode(ExitInvalidInput, fmt.Sprintf("Error: %v", err))
+		return nil
+	}
+
+	var codes []string
+	for _, cc := range strings.Split(exportCountries, ",") {
+		cc = countries.Normalize(cc)
+		if cc == "" {
+			continue
+		}
+		if !countries.IsValid(cc) {
+			exitWithCode(ExitInvalidInput, fmt.Sprintf("Error: invalid country code: %s", cc))
+			return nil
+		}
+		codes = append(codes, cc)
+	}
+
+	snap, err := openSnapshot(timeFlag)
+	if err != nil {
+		exitWithCode(ExitNoSnapshot, fmt.Sprintf("Error: %v\nRun 'ip2cc update' to download data.", err))
+		return nil
+	}
+
+	data := &export.Data{
+		Sets:     export.Collect(snap.v4, snap.v6, codes),
+		Name:     exportName,
+		Snapshot: snap.meta.RequestedTime,
+	}
+
+	w := os.Stdout
+	if exportOutput != "" {
+		f, err := os.Create(exportOutput)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := format.Write(w, data); err != nil {
+		return err
+	}
+	if exportOutput != "" {
+		return w.Close()
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/hightemp/ip2cc/internal/archive"
+	"github.com/hightemp/ip2cc/internal/config"
+	"github.com/hightemp/ip2cc/internal/index"
+	"github.com/hightemp/ip2cc/internal/signing"
+	"github.com/hightemp/ip2cc/internal/snapshot"
+)
+
+// installFromURL downloads a prebuilt snapshot archive, verifies it and
+// installs it as a local snapshot. Plain paths and file:// URLs are read
+// from disk. When trusted keys are configured the archive must carry a
+// valid signature (<url>.minisig) from one of them.
+func installFromURL(ctx context.Context, url string) error {
+	fc, err := loadFileConfig()
+	if err != nil {
+		return err
+	}
+	trusted := make([]*signing.PublicKey, 0, len(fc.TrustedKeys))
+	for _, k := range fc.TrustedKeys {
+		pk, err := signing.ParsePublicKey(k)
+		if err != nil {
+			return fmt.Errorf("trusted key %q: %w", k, err)
+		}
+		trusted = append(trusted, pk)
+	}
+
+	fmt.Printf("Fetching snapshot archive from %s...\n", url)
+	data, err := fetch(ctx, url)
+	if err != nil {
+		return fmt.Errorf("fetch archive: %w", err)
+	}
+
+	if len(trusted) > 0 {
+		sig, err := fetch(ctx, url+signing.SignatureExtension)
+		if err != nil {
+			return fmt.Errorf("fetch signature: %w", err)
+		}
+		key, comment, err := signing.Verify(trusted, data, sig)
+		if err != nil {
+			return fmt.Errorf("verify signature: %w", err)
+		}
+		fmt.Printf("Signature verified (key %s): %s\n", key.KeyID(), comment)
+	} else {
+		fmt.Println("Warning: no trusted keys configured, archive signature not checked")
+	}
+
+	snapshotsDir := config.SnapshotsDir(cacheDir)
+	if err := config.EnsureDir(snapshotsDir); err != nil {
+		return fmt.Errorf("create snapshots dir: %w", err)
+	}
+	tmpDir, err := os.MkdirTemp(snapshotsDir, ".install-*")
+	if err != nil {
+		return fmt.Errorf("create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	manifest, err := archive.Extract(bytes.NewReader(data), tmpDir)
+	if err != nil {
+		return fmt.Errorf("verify archive: %w", err)
+	}
+
+	meta, err := snapshot.LoadMetadata(config.MetadataPath(tmpDir))
+	if err != nil {
+		return fmt.Errorf("load metadata: %w", err)
+	}
+	if meta.RequestedTime != manifest.Date {
+		return fmt.Errorf("metadata date %s does not match manifest date %s", meta.RequestedTime, manifest.Date)
+	}
+	if _, _, err := index.LoadIndex(config.IndexV4Path(tmpDir), config.IndexV6Path(tmpDir)); err != nil {
+		return fmt.Errorf("verify indices: %w", err)
+	}
+
+	l, err := lockCache(true)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+
+	date := manifest.Date
+	mgr := snapshot.NewManager(cacheDir)
+	if !force && mgr.SnapshotExists(date) {
+		fmt.Printf("Snapshot for %s already exists. Use --force to replace it.\n", date)
+		return nil
+	}
+
+	snapshotDir, err := mgr.Install(tmpDir, date)
+	if err != nil {
+		return err
+	}
+
+	// Only move latest forward
+	if _, latest, err := mgr.GetLatestSnapshot(); err != nil || latest.RequestedTime <= date {
+		if err := mgr.SetLatest(date); err != nil {
+			fmt.Printf("Warning: could not update latest symlink: %v\n", err)
+		}
+	}
+
+	fmt.Printf("Installed snapshot %s\n", date)
+	fmt.Printf("  IPv4 prefixes: %d\n", meta.PrefixesV4)
+	fmt.Printf("  IPv6 prefixes: %d\n", meta.PrefixesV6)
+	fmt.Printf("  Location: %s\n", snapshotDir)
+	return nil
+}
+
+// fetch reads a URL or local file into memory.
+func fetch(ctx context.Context, url string) ([]byte, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return os.ReadFile(strings.TrimPrefix(url, "file://"))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", config.AppName+"/"+Version)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/batch"
+)
+
+// followFlag keeps reading stdin as it grows (--follow).
+var followFlag bool
+
+// followPollInterval is how often a regular file on stdin is checked for
+// new data once its end is reached.
+const followPollInterval = 250 * time.Millisecond
+
+// followInput looks up the lines of stdin as they arrive until stdin ends
+// or the process is interrupted. A regular file on stdin is followed like
+// tail -f and never ends; a pipe ends when its writer closes it.
+func followInput(processor *batch.Processor) error {
+	// Report a closed stdout as a write error instead of dying of SIGPIPE,
+	// so that the provider cache is saved and plugins are stopped
+	signal.Ignore(syscall.SIGPIPE)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var input io.Reader = os.Stdin
+	if stat, err := os.Stdin.Stat(); err == nil && stat.Mode().IsRegular() {
+		input = &tailReader{ctx: ctx, f: os.Stdin}
+	}
+
+	// Reads from stdin cannot be interrupted; stop waiting for them instead
+	done := make(chan error, 1)
+	go func() {
+		done <- processor.ProcessFollow(ctx, input, os.Stdout, jsonOutput)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+	}
+	if errors.Is(err, syscall.EPIPE) || errors.Is(err, context.Canceled) {
+		// The reader went away, or the user stopped us
+		return nil
+	}
+	return err
+}
+
+// tailReader reads a file that is still being written, waiting for new data
+// at its end instead of returning io.EOF, until ctx is done.
+type tailReader struct {
+	ctx context.Context
+	f   *os.File
+}
+
+func (t *tailReader) Read(p []byte) (int, error) {
+	for {
+		n, err := t.f.Read(p)
+		if n > 0 || err != io.EOF {
+			return n, err
+		}
+		select {
+		case <-t.ctx.Done():
+			return 0, io.EOF
+		case <-time.After(followPollInterval):
+		}
+	}
+}
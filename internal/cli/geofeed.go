@@ -0,0 +1,225 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/config"
+	"github.com/hightemp/ip2cc/internal/geofeed"
+	"github.com/hightemp/ip2cc/internal/iprange"
+	"github.com/hightemp/ip2cc/internal/rdap"
+	"github.com/spf13/cobra"
+)
+
+var (
+	noGeofeed        bool
+	geofeedDiscovers []string
+)
+
+var geofeedCmd = &cobra.Command{
+	Use:   "geofeed",
+	Short: "Manage the geofeed overlay over the RIR data",
+	Long: `Network operators publish where their prefixes are used in geofeeds
+(RFC 8805), CSV files of prefix and country. Ingested feeds are laid over the
+RIR data: lookups within a feed prefix report the feed's country, and JSON
+results say in "country_source" whether the country came from the RIR data
+or a geofeed.`,
+}
+
+var geofeedUpdateCmd = &cobra.Command{
+	Use:   "update [url...]",
+	Short: "Download geofeeds and rebuild the overlay",
+	Long: `Downloads the feeds given as arguments, listed under "geofeeds" in the
+configuration file, or ingested before, and rebuilds the overlay from them.
+
+With --discover, the registry record of the network containing an address is
+looked up over RDAP, and the feed named in its "Geofeed" remark is added. Such
+a feed only counts for prefixes within that network.
+
+Examples:
+  ip2cc geofeed update https://example.com/geofeed.csv
+  ip2cc geofeed update --discover 8.8.8.8
+  ip2cc geofeed update                  # Refresh the known feeds`,
+	RunE: runGeofeedUpdate,
+}
+
+var geofeedListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the ingested geofeeds",
+	Args:  cobra.NoArgs,
+	RunE:  runGeofeedList,
+}
+
+var geofeedClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove the geofeed overlay",
+	Args:  cobra.NoArgs,
+	RunE:  runGeofeedClear,
+}
+
+func init() {
+	geofeedUpdateCmd.Flags().StringArrayVar(&geofeedDiscovers, "discover", nil, "add the feed named in the registry remarks of the network containing this IP or CIDR (repeatable)")
+	geofeedCmd.AddCommand(geofeedUpdateCmd)
+	geofeedCmd.AddCommand(geofeedListCmd)
+	geofeedCmd.AddCommand(geofeedClearCmd)
+}
+
+func runGeofeedUpdate(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	fc, err := loadFileConfig()
+	if err != nil {
+		return err
+	}
+	dir := config.GeofeedDir(cacheDir)
+
+	// Known feeds keep the scope they were discovered with
+	var feeds []geofeed.Feed
+	seen := make(map[string]bool)
+	add := func(f geofeed.Feed) {
+		if !seen[f.URL] {
+			seen[f.URL] = true
+			feeds = append(feeds, f)
+		}
+	}
+	for _, url := range append(fc.Geofeeds, args...) {
+		add(geofeed.Feed{URL: url})
+	}
+	for _, resource := range geofeedDiscovers {
+		f, err := discoverGeofeed(ctx, resource)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Found geofeed %s for %s\n", f.URL, strings.Join(f.Scope, ", "))
+		add(f)
+	}
+	lastFetched := make(map[string]time.Time)
+	if known, err := geofeed.LoadFeeds(dir); err == nil {
+		for _, f := range known {
+			add(geofeed.Feed{URL: f.URL, Scope: f.Scope})
+			lastFetched[f.URL] = f.FetchedAt
+		}
+	}
+	if len(feeds) == 0 {
+		return fmt.Errorf("no geofeeds to download: pass URLs, --discover, or list them under \"geofeeds\" in the configuration file")
+	}
+
+	db := geofeed.New()
+	failed := 0
+	for _, f := range feeds {
+		f.FetchedAt = time.Now().UTC()
+		entries, err := geofeed.Fetch(ctx, f.URL)
+		if err != nil {
+			// Keep the entries of the last successful download rather than
+			// dropping the feed's prefixes over a temporary failure
+			f.Error = err.Error()
+			failed++
+			fmt.Printf("  %s: %v\n", f.URL, err)
+			entries = nil
+			if old, lerr := geofeed.LoadEntries(dir, f.URL); lerr == nil && len(old) > 0 {
+				entries = old
+				f.FetchedAt = lastFetched[f.URL]
+				fmt.Printf("  %s: keeping %d prefixes from %s\n", f.URL, len(old), f.FetchedAt.Format(time.RFC3339))
+			}
+		}
+		db.Add(f, entries)
+		if err == nil {
+			fmt.Printf("  %s: %d prefixes\n", f.URL, db.Feeds[len(db.Feeds)-1].Prefixes)
+		}
+	}
+
+	l, err := lockCache(true)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+	if err := db.Save(dir); err != nil {
+		return fmt.Errorf("save geofeed overlay: %w", err)
+	}
+	fmt.Printf("Geofeed overlay: %d IPv4 / %d IPv6 prefixes from %d feeds\n", db.V4.Count, db.V6.Count, len(feeds)-failed)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d geofeeds failed to download", failed, len(feeds))
+	}
+	return nil
+}
+
+// discoverGeofeed finds the feed named in the registry record of the
+// network containing resource, scoped to that network.
+func discoverGeofeed(ctx context.Context, resource string) (geofeed.Feed, error) {
+	network, err := rdap.NewClient().LookupIP(ctx, resource)
+	if err != nil {
+		return geofeed.Feed{}, fmt.Errorf("discover geofeed for %s: %w", resource, err)
+	}
+	if network.Geofeed == "" {
+		return geofeed.Feed{}, fmt.Errorf("no geofeed registered for %s (%s)", resource, network.Handle)
+	}
+	start, err1 := netip.ParseAddr(network.StartAddress)
+	end, err2 := netip.ParseAddr(network.EndAddress)
+	if err1 != nil || err2 != nil {
+		return geofeed.Feed{}, fmt.Errorf("discover geofeed for %s: invalid network range %s - %s", resource, network.StartAddress, network.EndAddress)
+	}
+	prefixes, err := iprange.ToPrefixes(start, end)
+	if err != nil {
+		return geofeed.Feed{}, fmt.Errorf("discover geofeed for %s: %w", resource, err)
+	}
+	f := geofeed.Feed{URL: network.Geofeed}
+	for _, p := range prefixes {
+		f.Scope = append(f.Scope, p.String())
+	}
+	return f, nil
+}
+
+func runGeofeedList(cmd *cobra.Command, args []string) error {
+	feeds, err := geofeed.LoadFeeds(config.GeofeedDir(cacheDir))
+	if os.IsNotExist(err) {
+		fmt.Println("No geofeeds ingested. Run 'ip2cc geofeed update <url>'.")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, f := range feeds {
+		status := fmt.Sprintf("%d prefixes", f.Prefixes)
+		if f.Error != "" && f.Prefixes > 0 {
+			status += " (kept), ERROR: " + f.Error
+		} else if f.Error != "" {
+			status = "ERROR: " + f.Error
+		}
+		line := fmt.Sprintf("%s\t%s\t%s", f.URL, f.FetchedAt.Format("2006-01-02 15:04"), status)
+		if len(f.Scope) > 0 {
+			line += "\tscope " + strings.Join(f.Scope, ",")
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+func runGeofeedClear(cmd *cobra.Command, args []string) error {
+	l, err := lockCache(true)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+	if err := os.RemoveAll(config.GeofeedDir(cacheDir)); err != nil {
+		return err
+	}
+	fmt.Println("Geofeed overlay removed")
+	return nil
+}
+
+// overlayGeofeeds lays the geofeed overlay, if there is one, over the
+// index of snap.
+func overlayGeofeeds(snap *loadedSnapshot) error {
+	db, err := geofeed.Load(config.GeofeedDir(cacheDir))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("load geofeed overlay: %w", err)
+	}
+	snap.meta.GeofeedPrefixes = db.Overlay(snap.v4, snap.v6)
+	return nil
+}
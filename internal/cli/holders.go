@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+
+	"github.com/hightemp/ip2cc/internal/config"
+	"github.com/hightemp/ip2cc/internal/index"
+	"github.com/hightemp/ip2cc/internal/provider"
+)
+
+// embedHoldersMode parses the provider mode of --embed-holders.
+func embedHoldersMode(name string) (provider.Mode, error) {
+	mode, err := provider.ParseMode(name)
+	if err != nil {
+		return "", err
+	}
+	if mode == provider.ModeOff {
+		return "", fmt.Errorf("--embed-holders needs a provider mode other than off")
+	}
+	return mode, nil
+}
+
+// embedProviderHolders resolves the main provider of every prefix of the
+// tries with the provider mode named by modeName and stores it in them
+// (--embed-holders). Prefixes whose provider cannot be resolved are left
+// without one.
+func embedProviderHolders(ctx context.Context, modeName string, tries ...*index.Trie) error {
+	mode, err := embedHoldersMode(modeName)
+	if err != nil {
+		return err
+	}
+	opts, err := resolverOptions()
+	if err != nil {
+		return err
+	}
+	opts.Concurrency = config.DefaultProviderLookupConcurrency
+	resolver := provider.NewResolver(mode, opts)
+	defer resolver.SaveCache()
+
+	var prefixes []netip.Prefix
+	for _, trie := range tries {
+		p, _ := trie.Export()
+		prefixes = append(prefixes, p...)
+	}
+
+	holders := make([]string, len(prefixes))
+	var done, found atomic.Int64
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				p := prefixes[i]
+				result, err := resolver.Resolve(ctx, p.Addr().String(), p.String())
+				if err == nil && result.Error == "" && len(result.Holders) > 0 {
+					holders[i] = index.TruncateHolder(result.Holders[0])
+					found.Add(1)
+				}
+				if n := done.Add(1); n%1000 == 0 {
+					fmt.Printf("\rEmbedding holders: %d/%d prefixes...", n, len(prefixes))
+				}
+			}
+		}()
+	}
+	for i := range prefixes {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i, p := range prefixes {
+		if holders[i] == "" {
+			continue
+		}
+		for _, trie := range tries {
+			if p.Addr().Is6() == trie.IsIPv6 {
+				trie.SetHolder(p, holders[i])
+			}
+		}
+	}
+	fmt.Printf("\rEmbedding holders: %d/%d prefixes have a %s holder\n", found.Load(), len(prefixes), mode)
+	return nil
+}
@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/hightemp/ip2cc/internal/config"
+	"github.com/hightemp/ip2cc/internal/index"
+	"github.com/hightemp/ip2cc/internal/snapshot"
+	"github.com/spf13/cobra"
+)
+
+var indexCmd = &cobra.Command{
+	Use:   "index",
+	Short: "Manage index files",
+}
+
+var indexConvertCmd = &cobra.Command{
+	Use:   "convert [date...]",
+	Short: "Rewrite index files in the current format",
+	Long: `Rewrites snapshot index files written by older versions of ip2cc in the
+current portable format. Without arguments, all snapshots are converted.
+
+Examples:
+  ip2cc index convert              # Convert all snapshots
+  ip2cc index convert 2025-01-01   # Convert a single snapshot`,
+	RunE: runIndexConvert,
+}
+
+func init() {
+	indexCmd.AddCommand(indexConvertCmd)
+}
+
+func runIndexConvert(cmd *cobra.Command, args []string) error {
+	l, err := lockCache(true)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+
+	mgr := snapshot.NewManager(cacheDir)
+
+	dates := args
+	if len(dates) == 0 {
+		var err error
+		if dates, err = mgr.ListSnapshots(); err != nil {
+			return fmt.Errorf("list snapshots: %w", err)
+		}
+	}
+
+	for _, date := range dates {
+		dir := mgr.GetSnapshotDir(date)
+		converted := false
+
+		for _, f := range []struct {
+			path   string
+			isIPv6 bool
+		}{
+			{config.IndexV4Path(dir), false},
+			{config.IndexV6Path(dir), true},
+		} {
+			from, err := index.ConvertFile(f.path, f.isIPv6)
+			if err != nil {
+				return fmt.Errorf("convert %s: %w", f.path, err)
+			}
+			if from != config.IndexFormatVersion {
+				converted = true
+			}
+		}
+
+		if !converted {
+			fmt.Printf("%s: already at version %d\n", date, config.IndexFormatVersion)
+			continue
+		}
+
+		// Keep metadata in sync with the files
+		metaPath := config.MetadataPath(dir)
+		if meta, err := snapshot.LoadMetadata(metaPath); err == nil {
+			meta.IndexFormatVersion = int(config.IndexFormatVersion)
+			if err := meta.Save(metaPath); err != nil {
+				return fmt.Errorf("save metadata: %w", err)
+			}
+		}
+		fmt.Printf("%s: converted to version %d\n", date, config.IndexFormatVersion)
+	}
+
+	return nil
+}
@@ -3,78 +3,566 @@ package cli
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/netip"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/hightemp/ip2cc/internal/anycast"
 	"github.com/hightemp/ip2cc/internal/batch"
+	"github.com/hightemp/ip2cc/internal/bundle"
 	"github.com/hightemp/ip2cc/internal/config"
 	"github.com/hightemp/ip2cc/internal/countries"
+	"github.com/hightemp/ip2cc/internal/enrich"
 	"github.com/hightemp/ip2cc/internal/index"
+	"github.com/hightemp/ip2cc/internal/iplist"
+	"github.com/hightemp/ip2cc/internal/iprange"
+	"github.com/hightemp/ip2cc/internal/mmdb"
 	"github.com/hightemp/ip2cc/internal/output"
+	"github.com/hightemp/ip2cc/internal/override"
 	"github.com/hightemp/ip2cc/internal/provider"
 	"github.com/hightemp/ip2cc/internal/snapshot"
+	"github.com/hightemp/ip2cc/internal/special"
 	"github.com/spf13/cobra"
 )
 
 func runLookup(cmd *cobra.Command, args []string) error {
+	if schemaFlag {
+		return runSchema(cmd, args)
+	}
+	if err := setOutputFormat(cmd); err != nil {
+		exitWithCode(ExitInvalidInput, fmt.Sprintf("Error: %v", err))
+		return nil
+	}
+	closeOutput, err := openOutput()
+	if err != nil {
+		exitWithCode(ExitInvalidInput, fmt.Sprintf("Error: %v", err))
+		return nil
+	}
+	err = lookupArgs(cmd, args)
+	if cerr := closeOutput(); err == nil {
+		err = cerr
+	}
+	var exit *exitError
+	if errors.As(err, &exit) {
+		exitWithCode(exit.code, exit.msg)
+	}
+	return err
+}
+
+// lookupArgs looks up the argument, or the lines of stdin.
+func lookupArgs(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
 
-	// Load snapshot
-	mgr := snapshot.NewManager(cacheDir)
-	var snapshotDir string
-	var meta *snapshot.Metadata
-	var err error
+	// ASN lookups need neither the index nor the daemon
+	if asnLookup != "" || (len(args) == 1 && isASNInput(args[0])) {
+		return lookupASNInput(ctx, args)
+	}
 
-	if timeFlag != "" {
-		snapshotDir, meta, err = mgr.GetSnapshotByDate(timeFlag)
-	} else {
-		snapshotDir, meta, err = mgr.GetLatestSnapshot()
+	if len(args) == 0 {
+		// Check if stdin is a terminal
+		if stat, _ := os.Stdin.Stat(); (stat.Mode() & os.ModeCharDevice) != 0 {
+			// stdin is a terminal, show help
+			return cmd.Help()
+		}
 	}
 
-	if err != nil {
-		exitWithCode(ExitNoSnapshot, fmt.Sprintf("Error: %v\nRun 'ip2cc update' to download data.", err))
-		return nil
+	// A running daemon answers without loading the index
+	if conn := dialDaemon(cmd); conn != nil {
+		return lookupDaemon(conn, args)
 	}
 
-	// Load indices
-	v4Trie, v6Trie, err := index.LoadIndex(
-		config.IndexV4Path(snapshotDir),
-		config.IndexV6Path(snapshotDir),
-	)
+	// Load snapshot
+	loadStart := time.Now()
+	snap, err := openSnapshot(timeFlag)
+	if err != nil && fetchMissingSnapshot(timeFlag) {
+		loadStart = time.Now()
+		snap, err = openSnapshot(timeFlag)
+	}
+	indexLoadTime = time.Since(loadStart)
 	if err != nil {
-		exitWithCode(ExitNoSnapshot, fmt.Sprintf("Error loading index: %v", err))
-		return nil
+		return exitErr(ExitNoSnapshot, fmt.Sprintf("Error: %v\nRun 'ip2cc update' to download data.", err))
+	}
+	v4Trie, v6Trie, meta := snap.v4, snap.v6, snap.meta
+
+	if lookupConcurrency < 1 {
+		lookupConcurrency = 1
+	}
+	if lookupConcurrency > config.MaxLookupConcurrency {
+		lookupConcurrency = config.MaxLookupConcurrency
 	}
 
 	// Setup provider resolver
-	var resolver *provider.Resolver
-	if !offline {
-		mode, err := provider.ParseMode(providerMode)
+	resolver, err := newResolver(snap)
+	if err != nil {
+		return exitErr(ExitInvalidInput, err.Error())
+	}
+	if resolver != nil {
+		defer resolver.SaveCache()
+	}
+
+	var summary *batch.Summary
+	batchResolver := resolver
+	if summaryFlag {
+		by, err := batch.ParseSummaryBy(summaryBy)
 		if err != nil {
-			exitWithCode(ExitInvalidInput, err.Error())
-			return nil
+			return exitErr(ExitInvalidInput, fmt.Sprintf("Error: %v", err))
+		}
+		summary = batch.NewSummary(by)
+		if by != batch.SummaryByASN {
+			// Country counts need no provider lookups
+			batchResolver = nil
 		}
-		resolver = provider.NewResolver(mode, cacheDir, true)
-		defer resolver.SaveCache()
+	}
+
+	processor := batch.NewProcessor(v4Trie, v6Trie, batchResolver, meta)
+	processor.SetSummary(summary)
+	processor.SetConcurrency(lookupConcurrency)
+	processor.SetSkipSpecial(skipSpecial)
+	processor.SetAlpha3(alpha3Flag)
+	if timingFlag {
+		processor.SetTiming(indexLoadTime)
+	}
+	if nat64, err = nat64Prefixes(); err != nil {
+		return exitErr(ExitInvalidInput, fmt.Sprintf("Error: %v", err))
+	}
+	processor.SetNAT64Prefixes(nat64)
+	if anycastList, err = loadAnycast(); err != nil {
+		return exitErr(ExitInvalidInput, fmt.Sprintf("Error: %v", err))
+	}
+	processor.SetAnycast(anycastList)
+	if groupsFlag {
+		if countryGroups, err = loadGroups(); err != nil {
+			return exitErr(ExitInvalidInput, fmt.Sprintf("Error: %v", err))
+		}
+		processor.SetGroups(countryGroups)
+	}
+	if tagLists, err = loadTags(); err != nil {
+		return exitErr(ExitInvalidInput, fmt.Sprintf("Error: %v", err))
+	}
+	processor.SetTags(tagLists)
+	if resultEnrichers, err = startEnrichers(snap.lists); err != nil {
+		return exitErr(ExitInvalidInput, fmt.Sprintf("Error: %v", err))
+	}
+	defer enrich.Close(resultEnrichers)
+	for _, e := range resultEnrichers {
+		processor.AddEnricher(e)
+	}
+	processor.SetAbuseContacts(abuseFlag && !offline)
+	processor.SetGeolocation(geoFlag && !offline)
+	processor.SetResolveHostnames(resolveFlag && !offline)
+	if annotateFlag && jsonOutput {
+		return exitErr(ExitInvalidInput, "Error: --annotate cannot be combined with --json")
+	}
+	if resultWriter != nil && (annotateFlag || summary != nil) {
+		return exitErr(ExitInvalidInput, fmt.Sprintf("Error: --format %s cannot be combined with --annotate or --summary", outputFormat))
+	}
+	processor.SetResultWriter(resultWriter)
+	resultCache := openResultCache(meta, batchResolver != nil)
+	defer saveResultCache(resultCache)
+	processor.SetResultCache(resultCache)
+	processor.SetExtract(extractFlag, annotateFlag)
+	if followFlag && (summary != nil || inputFormat != "lines" || len(args) == 1) {
+		return exitErr(ExitInvalidInput, "Error: --follow reads plain lines from stdin and cannot be combined with --summary, --input-format, or an argument")
+	}
+	if err := setInputFormat(processor); err != nil {
+		return exitErr(ExitInvalidInput, fmt.Sprintf("Error: %v", err))
 	}
 
 	// Check if we have an IP argument or should read from stdin
 	if len(args) == 1 {
+		if _, err := netip.ParseAddr(args[0]); err != nil && resolveFlag && !strings.Contains(args[0], "/") && !iprange.LooksLikeRange(args[0]) {
+			// Hostname: one result per resolved address
+			return processor.ProcessInput(ctx, strings.NewReader(args[0]), os.Stdout, jsonOutput)
+		}
+		if strings.Contains(args[0], "/") || iprange.LooksLikeRange(args[0]) {
+			// CIDR or start-end range lookup
+			return lookupCIDR(ctx, args[0], v4Trie, v6Trie, resolver, meta)
+		}
 		// Single IP lookup
 		return lookupSingle(ctx, args[0], v4Trie, v6Trie, resolver, meta)
 	}
 
-	// Check if stdin is a terminal
-	stat, _ := os.Stdin.Stat()
-	if (stat.Mode() & os.ModeCharDevice) != 0 {
-		// stdin is a terminal, show help
-		return cmd.Help()
+	if followFlag {
+		return followInput(processor)
 	}
 
 	// Batch mode from stdin
-	processor := batch.NewProcessor(v4Trie, v6Trie, resolver, meta)
-	return processor.ProcessInput(ctx, os.Stdin, os.Stdout, jsonOutput)
+	var input io.Reader = os.Stdin
+	var progress *progressReporter
+	if wantProgress(summary != nil) {
+		progress, input = startProgress(processor, os.Stdin)
+	}
+	if batchResolver != nil && lookupConcurrency > 1 {
+		// Provider lookups wait on the network; run them in parallel
+		err = processor.ProcessInputConcurrent(ctx, input, os.Stdout, jsonOutput)
+	} else {
+		err = processor.ProcessInput(ctx, input, os.Stdout, jsonOutput)
+	}
+	if progress != nil {
+		progress.Stop()
+	}
+	if err != nil {
+		return err
+	}
+	if verbose {
+		printMemoStats(processor.MemoStats())
+		if resultCache != nil {
+			fmt.Fprintf(os.Stderr, "Result cache: %d lookups answered from earlier runs, %d results kept\n",
+				resultCache.Hits(), resultCache.Len())
+		}
+	}
+	if timingFlag && !jsonOutput {
+		printTimingStats(processor.TimingStats())
+	}
+	if summary != nil {
+		return summary.Write(os.Stdout, summaryTop, jsonOutput)
+	}
+	return nil
+}
+
+// printMemoStats reports on stderr how many batch lookups were answered
+// from the results of duplicate inputs.
+func printMemoStats(stats batch.MemoStats) {
+	rate := 0.0
+	if stats.Lookups > 0 {
+		rate = 100 * float64(stats.Hits) / float64(stats.Lookups)
+	}
+	fmt.Fprintf(os.Stderr, "Processed %d inputs: %d looked up, %d duplicates reused (%.1f%%)\n",
+		stats.Lookups, stats.Lookups-stats.Hits, stats.Hits, rate)
+}
+
+// printTimingStats reports on stderr where the time of a batch run went
+// (--timing).
+func printTimingStats(stats batch.TimingStats) {
+	avg := time.Duration(0)
+	if stats.Lookups > 0 {
+		avg = stats.Lookup / time.Duration(stats.Lookups)
+	}
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	fmt.Fprintf(os.Stderr, "Timing: index load %.3fms, %d lookups %.3fms (%.3fms each), provider %.3fms\n",
+		ms(stats.IndexLoad), stats.Lookups, ms(stats.Lookup), ms(avg), ms(stats.Provider))
+}
+
+// indexLoadTime is how long loading the snapshot took, for --timing.
+var indexLoadTime time.Duration
+
+// setTiming adds the timing breakdown of a single lookup if --timing is set.
+func setTiming(result *output.LookupResult, lookup, provider time.Duration) {
+	if timingFlag {
+		result.Timing = output.NewTiming(indexLoadTime, lookup, provider)
+	}
+}
+
+// printTiming reports the timing of a failed single lookup on stderr if
+// --timing is set, since no result is printed.
+func printTiming(lookup time.Duration) {
+	if timingFlag {
+		fmt.Fprintln(os.Stderr, output.NewTiming(indexLoadTime, lookup, 0))
+	}
+}
+
+// countryGroups resolves group memberships for single lookups (--groups).
+var countryGroups *countries.Groups
+
+// loadGroups creates the built-in country groups plus those defined in the
+// configuration file.
+func loadGroups() (*countries.Groups, error) {
+	fc, err := loadFileConfig()
+	if err != nil {
+		return nil, err
+	}
+	groups, err := countries.NewGroups(fc.Groups)
+	if err != nil {
+		return nil, fmt.Errorf("config groups: %w", err)
+	}
+	return groups, nil
+}
+
+// tagLists holds the tag lists for single lookups, if any are configured.
+var tagLists *iplist.Tags
+
+// loadTags reads the tag lists of the configuration file. It returns nil
+// if there are none.
+func loadTags() (*iplist.Tags, error) {
+	fc, err := loadFileConfig()
+	if err != nil {
+		return nil, err
+	}
+	if len(fc.Tags) == 0 {
+		return nil, nil
+	}
+	tags, err := iplist.LoadTags(fc.Tags)
+	if err != nil {
+		return nil, fmt.Errorf("config tags: %w", err)
+	}
+	return tags, nil
+}
+
+// setTags adds the tag lists containing the address range made up of the
+// prefixes to result, if any are configured.
+func setTags(result *output.LookupResult, prefixes []netip.Prefix) {
+	if tagLists != nil {
+		result.Tags = tagLists.Match(prefixes)
+	}
+}
+
+// nat64 holds the NAT64 prefixes for single lookups.
+var nat64 []netip.Prefix
+
+// nat64Prefixes returns the NAT64 prefixes given with --nat64-prefix, or
+// else in the configuration file, or else the well-known prefix.
+func nat64Prefixes() ([]netip.Prefix, error) {
+	list := nat64Flags
+	if len(list) == 0 {
+		fc, err := loadFileConfig()
+		if err != nil {
+			return nil, err
+		}
+		list = fc.NAT64Prefixes
+	}
+	if len(list) == 0 {
+		return []netip.Prefix{special.WellKnownNAT64Prefix}, nil
+	}
+
+	prefixes := make([]netip.Prefix, 0, len(list))
+	for _, s := range list {
+		prefix, err := special.ParseNAT64Prefix(s)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// anycastList holds the anycast prefixes for single lookups.
+var anycastList *anycast.List
+
+// loadAnycast returns the built-in anycast prefixes extended by those in
+// the configuration file.
+func loadAnycast() (*anycast.List, error) {
+	fc, err := loadFileConfig()
+	if err != nil {
+		return nil, err
+	}
+	l, err := anycast.New(fc.AnycastPrefixes)
+	if err != nil {
+		return nil, fmt.Errorf("config anycast_prefixes: %w", err)
+	}
+	return l, nil
+}
+
+// setInputFormat configures the batch input format from --input-format.
+func setInputFormat(processor *batch.Processor) error {
+	switch inputFormat {
+	case "lines":
+		return nil
+	case "csv":
+		return processor.SetCSVInput(',', ipColumn)
+	case "tsv":
+		return processor.SetCSVInput('\t', ipColumn)
+	default:
+		return fmt.Errorf("invalid input format: %s (use lines, csv, or tsv)", inputFormat)
+	}
+}
+
+// newResolver creates the provider resolver from flags, or nil in offline mode.
+// The local ASN database needs no network, so it keeps answering offline.
+// ASN holder tables shipped with the snapshot are merged into its cache.
+func newResolver(snap *loadedSnapshot) (*provider.Resolver, error) {
+	mode, err := provider.ParseMode(providerMode)
+	if err != nil {
+		return nil, err
+	}
+	if offline && mode != provider.ModeLocal {
+		return nil, nil
+	}
+	opts, err := resolverOptions()
+	if err != nil {
+		return nil, err
+	}
+	resolver := provider.NewResolver(mode, opts)
+	if snap.providerCache != nil {
+		if err := resolver.ImportCache(snap.providerCache); err != nil {
+			return nil, fmt.Errorf("import provider cache: %w", err)
+		}
+	}
+	return resolver, nil
+}
+
+// resolverOptions combines the provider cache and RIPEstat flags with the configuration
+// file; flags take precedence.
+func resolverOptions() (provider.Options, error) {
+	opts := provider.Options{CacheDir: cacheDir, UseCache: true, Concurrency: lookupConcurrency}
+
+	fc, err := loadFileConfig()
+	if err != nil {
+		return opts, err
+	}
+	opts.CachePath = fc.ProviderCachePath
+	opts.RIPEstatURL = ripestatBaseURL(fc)
+	ttl := fc.ProviderCacheTTL
+	if providerCachePath != "" {
+		opts.CachePath = providerCachePath
+	}
+	if providerCacheTTL != "" {
+		ttl = providerCacheTTL
+	}
+
+	if ttl != "" {
+		if opts.CacheTTL, err = config.ParseTTL(ttl); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+// loadedSnapshot holds the indices and metadata of an opened snapshot.
+type loadedSnapshot struct {
+	dir  string
+	meta *snapshot.Metadata
+	v4   *index.Trie
+	v6   *index.Trie
+	// providerCache is the ASN holder table shipped in a bundle, if any.
+	providerCache []byte
+	// lists are the address lists downloaded with update --lists, if any.
+	lists iplist.Lists
+}
+
+// openSnapshot loads the snapshot for the given date, or the latest one if
+// date is empty. A MaxMind DB given with --db or a bundle file given with
+// --bundle takes precedence.
+func openSnapshot(date string) (*loadedSnapshot, error) {
+	if mmdbPath != "" {
+		return openMMDB(mmdbPath)
+	}
+	if bundlePath != "" {
+		b, err := bundle.Open(bundlePath)
+		if err != nil {
+			return nil, fmt.Errorf("open bundle: %w", err)
+		}
+		return &loadedSnapshot{meta: b.Metadata, v4: b.V4, v6: b.V6, providerCache: b.ProviderCache}, nil
+	}
+
+	// Keep updates from replacing the snapshot while it is read
+	l, err := lockCache(false)
+	if err != nil {
+		return nil, err
+	}
+	defer l.Release()
+
+	snap, err := findSnapshot(date)
+	if err != nil {
+		return nil, err
+	}
+
+	snap.v4, snap.v6, err = index.LoadIndex(
+		config.IndexV4Path(snap.dir),
+		config.IndexV6Path(snap.dir),
+	)
+	if err != nil && date != "" {
+		return nil, fmt.Errorf("load index: %w (run 'ip2cc update --repair --time %s')", err, date)
+	}
+	if err != nil {
+		// A damaged latest snapshot does not stop lookups while an older
+		// one loads
+		damaged := snap.meta.RequestedTime
+		fmt.Fprintf(os.Stderr, "Warning: snapshot %s is damaged: %v\n", damaged, err)
+		if snap, err = loadPreviousSnapshot(damaged); err != nil {
+			return nil, fmt.Errorf("load index: %w (run 'ip2cc update --repair')", err)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: using snapshot %s instead; run 'ip2cc update --repair' to rebuild %s\n", snap.meta.RequestedTime, damaged)
+	}
+	if snap.lists, err = iplist.Load(config.ListsDir(snap.dir)); err != nil {
+		return nil, err
+	}
+
+	if !noGeofeed {
+		if err := overlayGeofeeds(snap); err != nil {
+			return nil, err
+		}
+	}
+	// Overrides go last, to take precedence over the geofeeds too
+	if err := applyOverrides(snap); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// loadPreviousSnapshot loads the most recent snapshot before date whose
+// indices load.
+func loadPreviousSnapshot(date string) (*loadedSnapshot, error) {
+	mgr := snapshot.NewManager(cacheDir)
+	for {
+		prev, ok := mgr.PreviousSnapshot(date)
+		if !ok {
+			return nil, fmt.Errorf("no older snapshot to fall back to")
+		}
+		snap, err := findSnapshot(prev)
+		if err == nil {
+			snap.v4, snap.v6, err = index.LoadIndex(config.IndexV4Path(snap.dir), config.IndexV6Path(snap.dir))
+			if err == nil {
+				return snap, nil
+			}
+		}
+		fmt.Fprintf(os.Stderr, "Warning: snapshot %s is damaged: %v\n", prev, err)
+		date = prev
+	}
+}
+
+// openMMDB loads a MaxMind DB in place of a snapshot. Its build date
+// stands in for the snapshot date.
+func openMMDB(path string) (*loadedSnapshot, error) {
+	r, err := mmdb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open MaxMind DB: %w", err)
+	}
+	v4, v6, err := r.LoadIndex()
+	if err != nil {
+		return nil, fmt.Errorf("load MaxMind DB: %w", err)
+	}
+
+	meta := snapshot.NewMetadata()
+	meta.CreatedAt = r.Metadata.BuildTime
+	meta.RequestedTime = r.Metadata.BuildTime.Format("2006-01-02")
+	meta.ActualQueryTime = meta.RequestedTime
+	meta.PrefixesV4 = v4.Count
+	meta.PrefixesV6 = v6.Count
+	meta.Source = "MaxMind DB " + r.Metadata.DatabaseType
+	return &loadedSnapshot{meta: meta, v4: v4, v6: v6}, nil
+}
+
+// findSnapshot locates the snapshot for the given date (latest if empty),
+// or with --nearest the one closest to it, and loads its metadata, without
+// loading the indices.
+func findSnapshot(date string) (*loadedSnapshot, error) {
+	mgr := snapshot.NewManager(cacheDir)
+	var snapshotDir string
+	var meta *snapshot.Metadata
+	var err error
+
+	if date != "" && nearest && !mgr.SnapshotExists(date) {
+		requested := date
+		if date, err = mgr.NearestSnapshot(date); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "No snapshot for %s; using %s, the nearest one\n", requested, date)
+	}
+	if date != "" {
+		snapshotDir, meta, err = mgr.GetSnapshotByDate(date)
+	} else {
+		snapshotDir, meta, err = mgr.GetLatestSnapshot()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &loadedSnapshot{dir: snapshotDir, meta: meta}, nil
 }
 
 func lookupSingle(ctx context.Context, ipStr string, v4, v6 *index.Trie, resolver *provider.Resolver, meta *snapshot.Metadata) error {
@@ -82,13 +570,18 @@ func lookupSingle(ctx context.Context, ipStr string, v4, v6 *index.Trie, resolve
 		IP:           ipStr,
 		SnapshotTime: meta.RequestedTime,
 		IndexBuiltAt: meta.CreatedAt,
+		Alpha3:       alpha3Flag,
 	}
 
 	// Parse IP
 	ip, err := netip.ParseAddr(ipStr)
 	if err != nil {
-		exitWithCode(ExitInvalidInput, fmt.Sprintf("Invalid IP address: %s", ipStr))
-		return nil
+		return exitErr(ExitInvalidInput, fmt.Sprintf("Invalid IP address: %s", ipStr))
+	}
+	if embedded, kind, ok := special.TranslatedIPv4(ip, nat64); ok {
+		// The IPv6 index does not cover addresses derived from IPv4 ones
+		result.EmbeddedIPv4, result.Embedding = embedded.String(), kind
+		ip = embedded
 	}
 
 	// Select trie based on IP version
@@ -99,24 +592,265 @@ func lookupSingle(ctx context.Context, ipStr string, v4, v6 *index.Trie, resolve
 		trie = v6
 	}
 
-	// Lookup in trie
+	// Lookup in trie; overrides may map special-purpose addresses
+	start := time.Now()
 	data := trie.Lookup(ip)
+	if sr, ok := special.Lookup(ip); ok && !override.IsOverride(data) {
+		result.SetSpecial(sr)
+		if countryGroups != nil {
+			result.SetGroups(countryGroups)
+		}
+		setTags(result, []netip.Prefix{netip.PrefixFrom(ip, ip.BitLen())})
+		setTiming(result, time.Since(start), 0)
+		enrich.Apply(ctx, resultEnrichers, result)
+		return printResult(result)
+	}
+	lookupTime := time.Since(start)
 	if data == nil {
-		exitWithCode(ExitNotFound, fmt.Sprintf("IP %s not found in index", ipStr))
-		return nil
+		printTiming(lookupTime)
+		return exitErr(ExitNotFound, fmt.Sprintf("IP %s not found in index", ipStr))
 	}
 
-	result.CountryCode = data.CountryCode
-	result.CountryName = countries.GetName(data.CountryCode)
-	result.Network = data.PrefixStr
+	result.SetCountry(data.CountryCode)
+	if meta.Overlaid() {
+		result.CountrySource = data.CountrySource()
+	}
+	result.Anycast = anycastList.Contains(ip)
+	setTags(result, []netip.Prefix{netip.PrefixFrom(ip, ip.BitLen())})
+	result.Network = data.Prefix(ip).String()
+	result.RIR, result.Allocated = data.RIR.String(), data.AllocatedDate()
 
 	// Resolve provider
-	if resolver != nil {
-		provResult, _ := resolver.Resolve(ctx, ipStr, data.PrefixStr)
+	start = time.Now()
+	if p := override.Provider(data); p != nil {
+		result.Provider = p
+	} else if resolver != nil {
+		provResult, _ := resolver.Resolve(ctx, ip.String(), result.Network)
 		result.Provider = provResult
+	} else if data.Holder != "" {
+		result.Provider = provider.EmbeddedResult(data.Holder)
+	}
+	result.AbuseContacts = lookupAbuse(ctx, resolver, result.Network)
+	lookupGeo(ctx, resolver, result)
+	setTiming(result, lookupTime, time.Since(start))
+	if countryGroups != nil {
+		result.SetGroups(countryGroups)
 	}
+	enrich.Apply(ctx, resultEnrichers, result)
+
+	return printResult(result)
+}
 
-	// Output
+// lookupCIDR looks up a CIDR or a start-end range.
+func lookupCIDR(ctx context.Context, cidr string, v4, v6 *index.Trie, resolver *provider.Resolver, meta *snapshot.Metadata) error {
+	result := &output.LookupResult{
+		IP:           cidr,
+		SnapshotTime: meta.RequestedTime,
+		IndexBuiltAt: meta.CreatedAt,
+		Alpha3:       alpha3Flag,
+	}
+
+	// Parse CIDR, or split a range into CIDRs
+	var prefixes []netip.Prefix
+	kind := "CIDR"
+	if strings.Contains(cidr, "/") {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return exitErr(ExitInvalidInput, fmt.Sprintf("Invalid CIDR: %s", cidr))
+		}
+		prefixes = []netip.Prefix{prefix.Masked()}
+	} else {
+		first, last, err := iprange.Parse(cidr)
+		if err != nil {
+			return exitErr(ExitInvalidInput, fmt.Sprintf("Invalid range: %s (%v)", cidr, err))
+		}
+		prefixes, _ = iprange.ToPrefixes(first, last)
+		kind = "Range"
+	}
+	prefix := prefixes[0]
+
+	// Select trie based on IP version
+	var trie *index.Trie
+	if prefix.Addr().Is4() {
+		trie = v4
+	} else {
+		trie = v6
+	}
+
+	start := time.Now()
+	match := trie.LookupPrefixes(prefixes)
+	if sr, ok := special.LookupRange(prefix.Addr(), iprange.LastAddr(prefixes[len(prefixes)-1])); ok && !override.IsOverride(match.Covering) {
+		result.SetSpecial(sr)
+		if countryGroups != nil {
+			result.SetGroups(countryGroups)
+		}
+		setTags(result, prefixes)
+		setTiming(result, time.Since(start), 0)
+		enrich.Apply(ctx, resultEnrichers, result)
+		return printResult(result)
+	}
+
+	lookupTime := time.Since(start)
+	if match.Containment == index.NotFound {
+		printTiming(lookupTime)
+		return exitErr(ExitNotFound, fmt.Sprintf("%s %s not found in index", kind, cidr))
+	}
+
+	result.Containment = match.Containment.String()
+	result.Countries = match.Countries
+	if len(match.Countries) == 1 {
+		result.SetCountry(match.Countries[0])
+		if match.Covering != nil && meta.Overlaid() {
+			result.CountrySource = match.Covering.CountrySource()
+		}
+	}
+	if match.Covering != nil {
+		result.Network = match.Covering.Prefix(prefix.Addr()).String()
+		result.RIR, result.Allocated = match.Covering.RIR.String(), match.Covering.AllocatedDate()
+	} else {
+		result.Network = prefix.String()
+	}
+	result.Anycast = anycastList.ContainsRange(prefix.Addr(), iprange.LastAddr(prefixes[len(prefixes)-1]))
+	setTags(result, prefixes)
+
+	// Resolve provider for the first address of the block
+	start = time.Now()
+	if p := override.Provider(match.Covering); p != nil {
+		result.Provider = p
+	} else if resolver != nil {
+		provResult, _ := resolver.Resolve(ctx, prefix.Addr().String(), result.Network)
+		result.Provider = provResult
+	} else if match.Covering != nil && match.Covering.Holder != "" {
+		result.Provider = provider.EmbeddedResult(match.Covering.Holder)
+	}
+	result.AbuseContacts = lookupAbuse(ctx, resolver, result.Network)
+	lookupGeo(ctx, resolver, result)
+	setTiming(result, lookupTime, time.Since(start))
+	if countryGroups != nil {
+		result.SetGroups(countryGroups)
+	}
+	enrich.Apply(ctx, resultEnrichers, result)
+
+	return printResult(result)
+}
+
+// lookupAbuse returns the abuse contacts of network if --abuse is set, an
+// empty list if none could be found, and nil if they were not requested.
+func lookupAbuse(ctx context.Context, resolver *provider.Resolver, network string) []string {
+	if !abuseFlag || offline || resolver == nil {
+		return nil
+	}
+	contacts, err := resolver.AbuseContacts(ctx, network)
+	if err != nil || contacts == nil {
+		return []string{}
+	}
+	return contacts
+}
+
+// lookupGeo adds the geolocation of the result's network if --geo is set.
+func lookupGeo(ctx context.Context, resolver *provider.Resolver, result *output.LookupResult) {
+	if !geoFlag || offline || resolver == nil {
+		return
+	}
+	result.GeoRequested = true
+	result.Geolocation, _ = resolver.Geolocate(ctx, result.Network)
+}
+
+// setOutputFormat checks --format; json is the same as --json. Without
+// --format, an --output file named *.db, *.sqlite or *.parquet selects the
+// format of that name.
+func setOutputFormat(cmd *cobra.Command) error {
+	if !cmd.Flags().Changed("format") && !jsonOutput {
+		switch strings.ToLower(filepath.Ext(outputPath)) {
+		case ".db", ".sqlite", ".sqlite3":
+			outputFormat = "sqlite"
+		case ".parquet":
+			outputFormat = "parquet"
+		}
+	}
+	switch outputFormat {
+	case "", "text":
+		return nil
+	case "json":
+		jsonOutput = true
+		return nil
+	case "proto", "parquet", "sqlite", "cef", "leef", "ecs":
+		if jsonOutput {
+			return fmt.Errorf("--json cannot be combined with --format %s", outputFormat)
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid output format: %s (use text, json, proto, parquet, sqlite, cef, leef, or ecs)", outputFormat)
+}
+
+// resultWriter writes the results in the streaming formats of --format,
+// such as protobuf; it is nil for text and JSON.
+var resultWriter output.ResultWriter
+
+// openOutput redirects stdout to the --output file, if given, and sets up
+// resultWriter. The returned function finishes the output.
+func openOutput() (func() error, error) {
+	closeFile := func() error { return nil }
+	if outputPath != "" {
+		f, err := os.Create(outputPath)
+		if err != nil {
+			return nil, fmt.Errorf("create output file: %w", err)
+		}
+		stdout := os.Stdout
+		os.Stdout = f
+		closeFile = func() error {
+			os.Stdout = stdout
+			return f.Close()
+		}
+	}
+
+	switch outputFormat {
+	case "proto":
+		resultWriter = output.NewProtoWriter(os.Stdout)
+	case "cef":
+		resultWriter = output.NewCEFWriter(os.Stdout, Version)
+	case "leef":
+		resultWriter = output.NewLEEFWriter(os.Stdout, Version)
+	case "ecs":
+		resultWriter = output.NewECSWriter(os.Stdout)
+	case "parquet":
+		if isTerminal(os.Stdout) {
+			closeFile()
+			return nil, fmt.Errorf("--format parquet writes a binary file; give it with --output")
+		}
+		pw, err := output.NewParquetWriter(os.Stdout)
+		if err != nil {
+			closeFile()
+			return nil, err
+		}
+		resultWriter = pw
+	case "sqlite":
+		if outputPath == "" {
+			return nil, fmt.Errorf("--format sqlite writes a database file; give it with --output")
+		}
+		sw, err := output.NewSQLiteWriter(os.Stdout)
+		if err != nil {
+			closeFile()
+			return nil, err
+		}
+		resultWriter = sw
+	default:
+		return closeFile, nil
+	}
+	return func() error {
+		err := resultWriter.Close()
+		if cerr := closeFile(); err == nil {
+			err = cerr
+		}
+		return err
+	}, nil
+}
+
+// printResult writes a single lookup result to stdout.
+func printResult(result *output.LookupResult) error {
+	if resultWriter != nil {
+		return resultWriter.Write(result)
+	}
 	if jsonOutput {
 		jsonStr, err := result.FormatJSON()
 		if err != nil {
@@ -125,6 +859,9 @@ func lookupSingle(ctx context.Context, ipStr string, v4, v6 *index.Trie, resolve
 		fmt.Println(jsonStr)
 	} else {
 		fmt.Println(result.FormatText())
+		if result.Timing != nil {
+			fmt.Fprintln(os.Stderr, result.Timing)
+		}
 	}
 
 	return nil
@@ -0,0 +1,399 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/config"
+	"github.com/hightemp/ip2cc/internal/countries"
+	"github.com/hightemp/ip2cc/internal/index"
+	"github.com/hightemp/ip2cc/internal/rawstore"
+	"github.com/hightemp/ip2cc/internal/snapshot"
+	"github.com/hightemp/ip2cc/internal/source"
+)
+
+// runMerge refreshes the given countries and replaces their prefixes in
+// the latest snapshot, leaving all other countries as they are.
+func runMerge(ctx context.Context, countryCodes []string, rawFmt rawstore.Format) error {
+	if len(countryCodes) == 0 {
+		return fmt.Errorf("--merge needs the countries to refresh (--countries or --countries-file)")
+	}
+
+	if err := checkUpdateSource("", keepRaw); err != nil {
+		return err
+	}
+	fc, err := loadFileConfig()
+	if err != nil {
+		return err
+	}
+
+	mgr := snapshot.NewManager(cacheDir)
+	dir, meta, err := mgr.GetLatestSnapshot()
+	if err != nil {
+		return fmt.Errorf("no snapshot to merge into, run 'ip2cc update' first: %w", err)
+	}
+	fmt.Printf("Refreshing %d countries in snapshot %s...\n", len(countryCodes), meta.RequestedTime)
+
+	var prev *previousLists
+	if !force && sourceName == "ripestat" {
+		prev = loadPreviousLists(mgr)
+	}
+
+	// Raw responses kept by the snapshot are carried over, except those of
+	// the refreshed countries, which are replaced with --keep-raw
+	var stage *rawstore.Stage
+	if keepRaw || hasRaw(dir) {
+		stage, err = rawstore.NewStage(config.SnapshotsDir(cacheDir), rawFmt)
+		if err != nil {
+			return fmt.Errorf("create raw staging dir: %w", err)
+		}
+		defer stage.Remove()
+	}
+
+	var raw *rawstore.Stage
+	if keepRaw {
+		raw = stage
+	}
+	src := newUpdateSource(fc, "", raw, prev)
+
+	startTime := time.Now()
+	var results []*source.Result
+	var errors []string
+	err = src.Load(ctx, countryCodes, func(result *source.Result) {
+		if result.Err != nil {
+			errors = append(errors, fmt.Sprintf("%s: %v", strings.ToLower(result.CountryCode), result.Err))
+			return
+		}
+		results = append(results, result)
+	})
+	if err != nil {
+		return fmt.Errorf("load countries: %w", err)
+	}
+	if len(errors) > 0 {
+		// Failed countries keep the prefixes they had
+		sort.Strings(errors)
+		fmt.Printf("Warning: %d countries had errors and were left unchanged:\n", len(errors))
+		for _, e := range errors {
+			fmt.Printf("  - %s\n", e)
+		}
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("no country data downloaded")
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].CountryCode < results[j].CountryCode })
+
+	l, err := lockCache(true)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+
+	v4Trie, v6Trie, err := index.LoadIndex(config.IndexV4Path(dir), config.IndexV6Path(dir))
+	if err != nil {
+		return fmt.Errorf("load snapshot %s: %w", meta.RequestedTime, err)
+	}
+
+	merged := make([]string, len(results))
+	var fresh []string
+	for i, result := range results {
+		merged[i] = result.CountryCode
+		if !result.Reused {
+			fresh = append(fresh, result.CountryCode)
+		}
+	}
+
+	// Rebuild the indices from the kept prefixes and the refreshed ones
+	// the same way update builds them, so that the refreshed prefixes keep
+	// their registry data and the conflicts report sees them
+	refreshed := make(map[string]bool, len(merged))
+	for _, cc := range merged {
+		refreshed[countries.Normalize(cc)] = true
+	}
+	v4Builder, v6Builder := index.NewBuilder(false), index.NewBuilder(true)
+	holders := make(map[netip.Prefix]string)
+	removedV4 := rebuildKept(v4Builder, v4Trie, refreshed, holders)
+	removedV6 := rebuildKept(v6Builder, v6Trie, refreshed, holders)
+	keptDups := restoreDuplicates(dir, refreshed, v4Builder, v6Builder)
+
+	if meta.CountryStats == nil {
+		meta.CountryStats = make(map[string]snapshot.CountryStats)
+	}
+	addedV4, addedV6 := 0, 0
+	for _, result := range results {
+		c := insertCountry(v4Builder, v6Builder, result)
+		addedV4 += c.v4
+		addedV6 += c.v6
+		meta.CountryStats[result.CountryCode] = snapshot.CountryStats{
+			ETag:         result.ETag,
+			LastModified: result.LastModified,
+			PrefixesV4:   c.v4,
+			PrefixesV6:   c.v6,
+		}
+	}
+	v4Trie, v6Trie = v4Builder.Trie(), v6Builder.Trie()
+	if meta.Holders != "" {
+		if err := mergeHolders(ctx, meta.Holders, holders, v4Trie, v6Trie); err != nil {
+			return fmt.Errorf("embed holders: %w", err)
+		}
+	}
+	fmt.Printf("IPv4: -%d / +%d prefixes\n", removedV4, addedV4)
+	fmt.Printf("IPv6: -%d / +%d prefixes\n", removedV6, addedV6)
+
+	if err := mergeCountryLists(dir, results); err != nil {
+		return fmt.Errorf("save country lists: %w", err)
+	}
+	if err := replaceIndices(dir, v4Trie, v6Trie); err != nil {
+		return fmt.Errorf("save indices: %w", err)
+	}
+
+	duplicates := append(v4Builder.Duplicates(), v6Builder.Duplicates()...)
+	duplicates = append(duplicates, keptDups...)
+	sort.Slice(duplicates, func(i, j int) bool {
+		a, b := duplicates[i].Prefix, duplicates[j].Prefix
+		if a.Addr() != b.Addr() {
+			return a.Addr().Less(b.Addr())
+		}
+		return a.Bits() < b.Bits()
+	})
+	if err := saveConflicts(dir, v4Trie, v6Trie, duplicates); err != nil {
+		return err
+	}
+
+	if stage != nil {
+		if err := mergeRaw(dir, stage, fresh); err != nil {
+			return fmt.Errorf("save raw data: %w", err)
+		}
+	}
+
+	meta.Countries = mergeCountries(meta.Countries, merged)
+	meta.CountriesCount = len(meta.Countries)
+	meta.FailedCountries = removeCountries(meta.FailedCountries, merged)
+	meta.PrefixesV4 = v4Trie.Count
+	meta.PrefixesV6 = v6Trie.Count
+	meta.Changelog = buildChangelog(mgr, meta.RequestedTime, v4Trie, v6Trie)
+	if err := meta.Save(config.MetadataPath(dir)); err != nil {
+		return fmt.Errorf("save metadata: %w", err)
+	}
+
+	fmt.Printf("\nMerged %d countries into snapshot %s in %v\n", len(results), meta.RequestedTime, time.Since(startTime).Round(time.Second))
+	fmt.Printf("  IPv4 prefixes: %d\n", meta.PrefixesV4)
+	fmt.Printf("  IPv6 prefixes: %d\n", meta.PrefixesV6)
+	return nil
+}
+
+// rebuildKept adds the prefixes of trie that are not of the refreshed
+// countries to b, and records their embedded holders in holders. It
+// returns how many prefixes were left out.
+func rebuildKept(b *index.Builder, trie *index.Trie, refreshed map[string]bool, holders map[netip.Prefix]string) int {
+	removed := 0
+	prefixes, data := trie.Export()
+	for i, p := range prefixes {
+		if data[i].Holder != "" {
+			holders[p] = data[i].Holder
+		}
+		if refreshed[data[i].CountryCode] {
+			removed++
+			continue
+		}
+		b.Add(p, data[i])
+	}
+	return removed
+}
+
+// mergeHolders gives the prefixes of the merged tries the holders they
+// had before, and embeds holders resolved with mode for the new ones.
+func mergeHolders(ctx context.Context, mode string, holders map[netip.Prefix]string, tries ...*index.Trie) error {
+	var missing []*index.Trie
+	count := 0
+	for _, trie := range tries {
+		m := index.NewTrie(trie.IsIPv6)
+		prefixes, data := trie.Export()
+		for i, p := range prefixes {
+			if h, ok := holders[p]; ok {
+				trie.SetHolder(p, h)
+			} else {
+				m.Insert(p, data[i])
+			}
+		}
+		missing = append(missing, m)
+		count += m.Count
+	}
+	if count == 0 {
+		return nil
+	}
+	if err := embedProviderHolders(ctx, mode, missing...); err != nil {
+		return err
+	}
+	for i, m := range missing {
+		prefixes, data := m.Export()
+		for j, p := range prefixes {
+			if data[j].Holder != "" {
+				tries[i].SetHolder(p, data[j].Holder)
+			}
+		}
+	}
+	return nil
+}
+
+// restoreDuplicates reads the duplicates of the conflicts report of the
+// snapshot in dir, whose index only has the kept country of each. Where
+// that country is refreshed, the prefix is added again for the other
+// countries. Duplicates between countries that are not refreshed are
+// returned, as the builders cannot see them again.
+func restoreDuplicates(dir string, refreshed map[string]bool, v4, v6 *index.Builder) []index.Duplicate {
+	conflicts, err := snapshot.LoadConflicts(config.ConflictsPath(dir))
+	if err != nil {
+		return nil
+	}
+	var kept []index.Duplicate
+	for _, d := range conflicts.Duplicates {
+		p, err := netip.ParsePrefix(d.Prefix)
+		if err != nil {
+			continue
+		}
+		if !refreshed[countries.Normalize(d.Kept)] {
+			if !slices.ContainsFunc(d.Countries, func(cc string) bool { return refreshed[countries.Normalize(cc)] }) {
+				kept = append(kept, index.Duplicate{Prefix: p, Countries: d.Countries})
+			}
+			continue
+		}
+		b := v4
+		if p.Addr().Is6() {
+			b = v6
+		}
+		for _, cc := range d.Countries {
+			if !refreshed[countries.Normalize(cc)] {
+				b.Add(p, index.PrefixData{CountryCode: countries.Normalize(cc)})
+			}
+		}
+	}
+	return kept
+}
+
+// replaceIndices writes the indices of the snapshot in dir next to the
+// old ones and renames them over them, so that readers never see a partly
+// written file.
+func replaceIndices(dir string, v4Trie, v6Trie *index.Trie) error {
+	v4Path, v6Path := config.IndexV4Path(dir), config.IndexV6Path(dir)
+	if err := index.SaveIndex(v4Path+".tmp", v6Path+".tmp", v4Trie, v6Trie); err != nil {
+		return err
+	}
+	for _, path := range []string{v4Path, v6Path} {
+		if err := os.Rename(path+".tmp", path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeCountryLists replaces the lists of the downloaded countries in the
+// country lists of the snapshot in dir. Without lists to start from, it
+// keeps only those of the downloaded countries.
+func mergeCountryLists(dir string, results []*source.Result) error {
+	lists, err := loadCountryLists(dir)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Warning: could not read the country lists of the snapshot, only the merged ones are kept: %v\n", err)
+	}
+	if lists == nil {
+		lists = make(map[string]snapshot.CountryList)
+	}
+	for _, result := range results {
+		cc := strings.ToUpper(result.CountryCode)
+		lists[cc] = snapshot.CountryList{CountryCode: cc, IPv4: result.IPv4, IPv6: result.IPv6}
+	}
+
+	codes := make([]string, 0, len(lists))
+	for cc := range lists {
+		codes = append(codes, cc)
+	}
+	sort.Strings(codes)
+	w, err := snapshot.CreateCountryLists(config.CountryListsPath(dir))
+	if err != nil {
+		return err
+	}
+	for _, cc := range codes {
+		if err := w.Write(lists[cc]); err != nil {
+			w.Abort()
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// hasRaw reports whether the snapshot in dir kept raw responses.
+func hasRaw(dir string) bool {
+	for _, path := range []string{config.RawDir(dir), config.RawArchivePath(dir)} {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeRaw adds the raw responses kept by the snapshot in dir to stage,
+// except those of the downloaded countries, and replaces the snapshot's raw
+// responses with the result.
+func mergeRaw(dir string, stage *rawstore.Stage, downloaded []string) error {
+	replaced := make(map[string]bool, len(downloaded))
+	for _, cc := range downloaded {
+		replaced[strings.ToUpper(cc)] = true
+	}
+	err := rawstore.Read(dir, func(cc string, data []byte) error {
+		if replaced[strings.ToUpper(cc)] {
+			return nil
+		}
+		return stage.Write(cc, data)
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// The snapshot may have kept them in another format
+	if err := os.RemoveAll(config.RawDir(dir)); err != nil {
+		return err
+	}
+	if err := os.Remove(config.RawArchivePath(dir)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return stage.Commit(dir)
+}
+
+// mergeCountries returns the lowercase country list of a snapshot with
+// the merged (uppercase) countries added.
+func mergeCountries(list, merged []string) []string {
+	seen := make(map[string]bool, len(list))
+	for _, cc := range list {
+		seen[strings.ToLower(cc)] = true
+	}
+	for _, cc := range merged {
+		if cc = strings.ToLower(cc); !seen[cc] {
+			seen[cc] = true
+			list = append(list, cc)
+		}
+	}
+	return list
+}
+
+// removeCountries returns list without the merged countries.
+func removeCountries(list, merged []string) []string {
+	var result []string
+	for _, cc := range list {
+		keep := true
+		for _, m := range merged {
+			if strings.EqualFold(cc, m) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			result = append(result, cc)
+		}
+	}
+	return result
+}
@@ -0,0 +1,27 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/hightemp/ip2cc/internal/override"
+)
+
+// applyOverrides applies the overrides file of the configuration, if any,
+// to the snapshot's indices.
+func applyOverrides(snap *loadedSnapshot) error {
+	fc, err := loadFileConfig()
+	if err != nil {
+		return err
+	}
+	if fc.OverridesFile == "" {
+		return nil
+	}
+	entries, err := override.Load(fc.OverridesFile)
+	if err != nil {
+		return fmt.Errorf("load overrides: %w", err)
+	}
+	if snap.meta.OverridePrefixes, err = override.Apply(snap.v4, snap.v6, entries); err != nil {
+		return fmt.Errorf("apply overrides: %w", err)
+	}
+	return nil
+}
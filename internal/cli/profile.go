@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"runtime/trace"
+
+	"github.com/hightemp/ip2cc/internal/server"
+	"github.com/spf13/cobra"
+)
+
+// Profiling flags; hidden, as they are meant for performance
+// investigations rather than everyday use
+var (
+	cpuProfile string
+	memProfile string
+	traceFile  string
+	pprofFlag  bool
+)
+
+// stopProfiling finishes the profiles started by startProfiling; it is
+// set while they run.
+var stopProfiling = func() {}
+
+func init() {
+	flags := rootCmd.PersistentFlags()
+	flags.StringVar(&cpuProfile, "cpuprofile", "", "write a CPU profile to this file")
+	flags.StringVar(&memProfile, "memprofile", "", "write a heap profile to this file on exit")
+	flags.StringVar(&traceFile, "trace", "", "write an execution trace to this file")
+	for _, name := range []string{"cpuprofile", "memprofile", "trace"} {
+		flags.MarkHidden(name)
+	}
+	rootCmd.PersistentPreRunE = startProfiling
+
+	serveCmd.Flags().BoolVar(&pprofFlag, "pprof", false, "serve pprof endpoints under /debug/pprof/")
+	serveCmd.Flags().MarkHidden("pprof")
+}
+
+// startProfiling starts the profiles requested with --cpuprofile and
+// --trace. The heap profile is written when they stop.
+func startProfiling(cmd *cobra.Command, args []string) error {
+	var stops []func()
+	stop := func() {
+		for i := len(stops) - 1; i >= 0; i-- {
+			stops[i]()
+		}
+		stopProfiling = func() {}
+	}
+
+	if cpuProfile != "" {
+		f, err := os.Create(cpuProfile)
+		if err != nil {
+			return fmt.Errorf("create CPU profile: %w", err)
+		}
+		if err := runtimepprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return fmt.Errorf("start CPU profile: %w", err)
+		}
+		stops = append(stops, func() {
+			runtimepprof.StopCPUProfile()
+			f.Close()
+		})
+	}
+
+	if traceFile != "" {
+		f, err := os.Create(traceFile)
+		if err != nil {
+			stop()
+			return fmt.Errorf("create trace: %w", err)
+		}
+		if err := trace.Start(f); err != nil {
+			f.Close()
+			stop()
+			return fmt.Errorf("start trace: %w", err)
+		}
+		stops = append(stops, func() {
+			trace.Stop()
+			f.Close()
+		})
+	}
+
+	if memProfile != "" {
+		stops = append(stops, func() {
+			if err := writeHeapProfile(memProfile); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+		})
+	}
+
+	stopProfiling = stop
+	return nil
+}
+
+// writeHeapProfile writes the heap profile, as of the last garbage
+// collection, to path.
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create heap profile: %w", err)
+	}
+	defer f.Close()
+	runtime.GC()
+	if err := runtimepprof.WriteHeapProfile(f); err != nil {
+		return fmt.Errorf("write heap profile: %w", err)
+	}
+	return f.Close()
+}
+
+// addPprof registers the pprof endpoints on srv when --pprof is given.
+// They sit behind the server's API keys and rate limit like the lookups.
+func addPprof(srv *server.Server) {
+	if !pprofFlag {
+		return
+	}
+	srv.Handle("/debug/pprof/", http.HandlerFunc(pprof.Index))
+	srv.Handle("/debug/pprof/cmdline", http.HandlerFunc(pprof.Cmdline))
+	srv.Handle("/debug/pprof/profile", http.HandlerFunc(pprof.Profile))
+	srv.Handle("/debug/pprof/symbol", http.HandlerFunc(pprof.Symbol))
+	srv.Handle("/debug/pprof/trace", http.HandlerFunc(pprof.Trace))
+}
@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/batch"
+)
+
+// progressInterval is how often batch progress is redrawn.
+const progressInterval = 500 * time.Millisecond
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// progressReporter redraws the processed count, rate and, for input of
+// known size, the ETA of a batch run on stderr.
+type progressReporter struct {
+	processor *batch.Processor
+	input     *countingReader
+	size      int64
+	start     time.Time
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// wantProgress reports whether batch progress should be shown: only when
+// stderr is a terminal and --no-progress is not set. Results written to
+// the same terminal would scroll the progress line away, so it is only
+// shown with them in summary mode.
+func wantProgress(summary bool) bool {
+	if noProgress || !isTerminal(os.Stderr) {
+		return false
+	}
+	return summary || !isTerminal(os.Stdout)
+}
+
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// startProgress starts reporting the progress of processor reading input.
+// The ETA is estimated from the bytes read if input is a regular file.
+func startProgress(processor *batch.Processor, input *os.File) (*progressReporter, io.Reader) {
+	p := &progressReporter{
+		processor: processor,
+		input:     &countingReader{r: input},
+		start:     time.Now(),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if stat, err := input.Stat(); err == nil && stat.Mode().IsRegular() {
+		p.size = stat.Size()
+	}
+
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fmt.Fprint(os.Stderr, "\r\033[K"+p.line())
+			case <-p.stop:
+				fmt.Fprint(os.Stderr, "\r\033[K")
+				return
+			}
+		}
+	}()
+	return p, p.input
+}
+
+// line formats the current progress.
+func (p *progressReporter) line() string {
+	processed := p.processor.MemoStats().Lookups
+	elapsed := time.Since(p.start)
+	line := fmt.Sprintf("Processed %d inputs (%.0f/s)", processed, float64(processed)/elapsed.Seconds())
+
+	read := p.input.n.Load()
+	if p.size > 0 && read > 0 {
+		remaining := time.Duration(float64(elapsed) * float64(p.size-read) / float64(read))
+		line += fmt.Sprintf(", %.0f%%, ETA %s", 100*float64(read)/float64(p.size), remaining.Round(time.Second))
+	}
+	return line
+}
+
+// Stop clears the progress line.
+func (p *progressReporter) Stop() {
+	close(p.stop)
+	<-p.done
+}
@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/countries"
+	"github.com/hightemp/ip2cc/internal/export"
+	"github.com/hightemp/ip2cc/internal/iprange"
+	"github.com/spf13/cobra"
+)
+
+var (
+	randomCountries string
+	randomCount     int
+	randomIPv6      bool
+	randomSeed      int64
+)
+
+var randomCmd = &cobra.Command{
+	Use:   "random",
+	Short: "Print random addresses of a country",
+	Long: `Samples addresses uniformly at random from the address space the local
+index assigns to the given countries, e.g. for test fixtures and load tests
+of geo-aware systems. Nested prefixes are resolved as in lookups, so every
+address looks up to one of the countries. Addresses are drawn with
+replacement and may repeat.
+
+Examples:
+  ip2cc random --country DE --count 100
+  ip2cc random --country de,at,ch --ipv6 --seed 42 > fixtures.txt`,
+	Args: cobra.NoArgs,
+	RunE: runRandom,
+}
+
+func init() {
+	randomCmd.Flags().StringVar(&randomCountries, "country", "", "comma-separated country codes to sample from (required)")
+	randomCmd.Flags().IntVarP(&randomCount, "count", "n", 10, "number of addresses")
+	randomCmd.Flags().BoolVar(&randomIPv6, "ipv6", false, "sample IPv6 addresses instead of IPv4")
+	randomCmd.Flags().Int64Var(&randomSeed, "seed", 0, "random seed, for reproducible output (default: random)")
+	randomCmd.Flags().StringVar(&timeFlag, "time", "", "sample from the snapshot of a specific date (YYYY-MM-DD)")
+	randomCmd.Flags().BoolVar(&nearest, "nearest", false, "with --time: use the snapshot closest to the date when there is none for it")
+	randomCmd.Flags().StringVar(&bundlePath, "bundle", "", "sample from a snapshot bundle file instead of the cache")
+	randomCmd.Flags().BoolVar(&noGeofeed, "no-geofeed", false, "sample from the RIR data without the geofeed overlay")
+	randomCmd.MarkFlagRequired("country")
+}
+
+func runRandom(cmd *cobra.Command, args []string) error {
+	var codes []string
+	for _, cc := range strings.Split(randomCountries, ",") {
+		cc = countries.Normalize(cc)
+		if cc == "" {
+			continue
+		}
+		if !countries.IsValid(cc) {
+			exitWithCode(ExitInvalidInput, fmt.Sprintf("Error: invalid country code: %s", cc))
+			return nil
+		}
+		codes = append(codes, cc)
+	}
+	if len(codes) == 0 || randomCount < 0 {
+		exitWithCode(ExitInvalidInput, "Error: --country needs at least one country code and --count must not be negative")
+		return nil
+	}
+
+	snap, err := openSnapshot(timeFlag)
+	if err != nil {
+		exitWithCode(ExitNoSnapshot, fmt.Sprintf("Error: %v\nRun 'ip2cc update' to download data.", err))
+		return nil
+	}
+
+	var prefixes []netip.Prefix
+	for _, set := range export.Collect(snap.v4, snap.v6, codes) {
+		if randomIPv6 {
+			prefixes = append(prefixes, set.V6...)
+		} else {
+			prefixes = append(prefixes, set.V4...)
+		}
+	}
+	sampler := iprange.NewSampler(prefixes)
+	if sampler.Size().Sign() == 0 {
+		family := "IPv4"
+		if randomIPv6 {
+			family = "IPv6"
+		}
+		exitWithCode(ExitNotFound, fmt.Sprintf("No %s addresses of %s in the index", family, strings.Join(codes, ", ")))
+		return nil
+	}
+
+	seed := randomSeed
+	if !cmd.Flags().Changed("seed") {
+		seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(seed))
+
+	w := bufio.NewWriter(os.Stdout)
+	for i := 0; i < randomCount; i++ {
+		fmt.Fprintln(w, sampler.Sample(rng))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,184 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/config"
+	"github.com/hightemp/ip2cc/internal/index"
+	"github.com/hightemp/ip2cc/internal/rawstore"
+	"github.com/hightemp/ip2cc/internal/ripestat"
+	"github.com/hightemp/ip2cc/internal/snapshot"
+	"github.com/hightemp/ip2cc/internal/source"
+	"github.com/spf13/cobra"
+)
+
+// keepLatest stops an update from moving the latest symlink, for a repair
+// of a snapshot that was not the latest.
+var keepLatest bool
+
+// baselineTimes holds the earliest time of each country of a baseline
+// being repaired, which is rebuilt for its date without looking them up
+// again.
+var baselineTimes map[string]string
+
+// runRepair rebuilds the indices of the snapshot selected with --time, or
+// the latest one, when they fail to load: from the raw responses kept with
+// the snapshot if it has them, or else by downloading its countries again
+// for its date.
+func runRepair(cmd *cobra.Command, args []string) error {
+	mgr := snapshot.NewManager(cacheDir)
+	var dir string
+	var meta *snapshot.Metadata
+	var err error
+	if timeFlag != "" {
+		dir, meta, err = mgr.GetSnapshotByDate(timeFlag)
+	} else {
+		dir, meta, err = mgr.GetLatestSnapshot()
+	}
+	if err != nil {
+		return err
+	}
+	date := meta.RequestedTime
+
+	_, _, loadErr := index.LoadIndex(config.IndexV4Path(dir), config.IndexV6Path(dir))
+	if loadErr == nil && !force {
+		fmt.Printf("Snapshot %s loads fine. Use --force to rebuild it anyway.\n", date)
+		return nil
+	}
+	if loadErr != nil {
+		fmt.Printf("Snapshot %s is damaged: %v\n", date, loadErr)
+	}
+
+	if hasRaw(dir) {
+		fmt.Println("Rebuilding indices from the raw responses...")
+		err := repairFromRaw(context.Background(), dir, meta)
+		if err == nil {
+			fmt.Printf("Repaired snapshot %s: %d IPv4 / %d IPv6 prefixes\n", date, meta.PrefixesV4, meta.PrefixesV6)
+			return nil
+		}
+		fmt.Printf("Could not rebuild from the raw responses: %v\n", err)
+	}
+
+	// Downloading again starts a new update, which would discard the
+	// progress of an unfinished one
+	if _, err := loadUpdateRun(config.UpdateStateDir(cacheDir)); err == nil {
+		return fmt.Errorf("an unfinished update would be discarded; finish it with 'ip2cc update --resume' before repairing %s", date)
+	}
+
+	// Download the snapshot's countries again for its date; a baseline
+	// stays marked as one
+	fmt.Printf("Downloading snapshot %s again...\n", date)
+	latest, latestMeta, err := mgr.GetLatestSnapshot()
+	keepLatest = err != nil || latest != dir || latestMeta.RequestedTime != date
+	earliest = meta.Baseline
+	timeFlag = ""
+	if earliest || date != time.Now().Format("2006-01-02") {
+		timeFlag = date
+	}
+	if earliest {
+		baselineTimes = make(map[string]string)
+		for cc, s := range meta.CountryStats {
+			if s.QueryTime != "" {
+				baselineTimes[cc] = s.QueryTime
+			}
+		}
+	}
+	if meta.Source == (&source.Delegated{}).Name() {
+		if timeFlag != "" || earliest {
+			return fmt.Errorf("snapshot %s was built from RIR delegated files, which only provide current data; build a new one with 'ip2cc update --source rir'", date)
+		}
+		sourceName = "rir"
+	}
+	if len(meta.Countries) > 0 {
+		countryList = meta.Countries
+	}
+	// Embedded holders are resolved again the way they were
+	embedHolders = meta.Holders
+	force, repair = true, false
+	return runUpdate(cmd, args)
+}
+
+// repairFromRaw rebuilds the indices of the snapshot in dir from its raw
+// responses, which must cover every country it did not fail to download.
+// Holders embedded in the snapshot are resolved again; if that fails, the
+// indices are saved without them.
+func repairFromRaw(ctx context.Context, dir string, meta *snapshot.Metadata) error {
+	l, err := lockCache(true)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+
+	v4Builder, v6Builder := index.NewBuilder(false), index.NewBuilder(true)
+	counts := make(map[string]countryCount)
+	lists, err := snapshot.CreateCountryLists(config.CountryListsPath(dir))
+	if err != nil {
+		return fmt.Errorf("create country lists: %w", err)
+	}
+	defer lists.Abort()
+	err = rawstore.Read(dir, func(cc string, data []byte) error {
+		list, err := ripestat.ParseCountryResourceList(cc, data)
+		if err != nil {
+			return err
+		}
+		if err := lists.Write(snapshot.CountryList{CountryCode: list.CountryCode, IPv4: list.IPv4, IPv6: list.IPv6}); err != nil {
+			return err
+		}
+		counts[list.CountryCode] = insertCountry(v4Builder, v6Builder, &source.Result{
+			CountryCode: list.CountryCode,
+			IPv4:        list.IPv4,
+			IPv6:        list.IPv6,
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	failed := make(map[string]bool)
+	for _, cc := range meta.FailedCountries {
+		failed[strings.ToUpper(cc)] = true
+	}
+	for _, cc := range meta.Countries {
+		cc = strings.ToUpper(cc)
+		if _, ok := counts[cc]; !ok && !failed[cc] {
+			return fmt.Errorf("no raw response for %s", cc)
+		}
+	}
+
+	v4Trie, v6Trie := v4Builder.Trie(), v6Builder.Trie()
+	if meta.Holders != "" {
+		if err := embedProviderHolders(ctx, meta.Holders, v4Trie, v6Trie); err != nil {
+			fmt.Printf("Warning: could not embed holders again, the repaired snapshot has none: %v\n", err)
+			meta.Holders = ""
+		}
+	}
+	if err := replaceIndices(dir, v4Trie, v6Trie); err != nil {
+		return fmt.Errorf("save indices: %w", err)
+	}
+	if err := saveConflicts(dir, v4Trie, v6Trie, append(v4Builder.Duplicates(), v6Builder.Duplicates()...)); err != nil {
+		return err
+	}
+	if err := lists.Close(); err != nil {
+		return fmt.Errorf("save country lists: %w", err)
+	}
+
+	if meta.CountryStats == nil {
+		meta.CountryStats = make(map[string]snapshot.CountryStats)
+	}
+	for cc, c := range counts {
+		s := meta.CountryStats[cc]
+		s.PrefixesV4, s.PrefixesV6 = c.v4, c.v6
+		meta.CountryStats[cc] = s
+	}
+	meta.PrefixesV4 = v4Trie.Count
+	meta.PrefixesV6 = v6Trie.Count
+	meta.IndexFormatVersion = int(config.IndexFormatVersion)
+	if err := meta.Save(config.MetadataPath(dir)); err != nil {
+		return fmt.Errorf("save metadata: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/batch"
+	"github.com/hightemp/ip2cc/internal/config"
+	"github.com/hightemp/ip2cc/internal/snapshot"
+)
+
+var (
+	// resultCacheFlag keeps lookup results across batch runs (--result-cache).
+	resultCacheFlag bool
+	resultCacheSize int
+)
+
+// openResultCache loads the result cache for batch lookups in meta with
+// the current options. It returns nil when the cache is disabled; a cache
+// that cannot be read is started over with a warning. Results with
+// provider data expire with the provider cache.
+func openResultCache(meta *snapshot.Metadata, withProvider bool) *batch.ResultCache {
+	if !resultCacheFlag || timingFlag {
+		return nil
+	}
+	c := batch.NewResultCache(config.ResultCachePath(cacheDir), resultCacheKey(meta, withProvider), resultCacheSize)
+	if withProvider {
+		ttl := time.Duration(config.DefaultProviderCacheTTLDays) * 24 * time.Hour
+		if opts, err := resolverOptions(); err == nil && opts.CacheTTL > 0 {
+			ttl = opts.CacheTTL
+		}
+		c.SetTTL(ttl)
+	}
+	if err := c.Load(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: result cache: %v\n", err)
+	}
+	return c
+}
+
+// resultCacheKey identifies the snapshot and the options results depend
+// on; results cached under another key are discarded.
+func resultCacheKey(meta *snapshot.Metadata, withProvider bool) string {
+	parts := []string{
+		meta.RequestedTime,
+		meta.CreatedAt.UTC().Format(time.RFC3339Nano),
+		"bundle=" + bundlePath,
+		"db=" + mmdbPath,
+	}
+	if !noGeofeed {
+		// The overlay is rewritten, not edited, so its directory changes
+		// with every update
+		if stat, err := os.Stat(config.GeofeedDir(cacheDir)); err == nil {
+			parts = append(parts, "geofeed="+stat.ModTime().UTC().Format(time.RFC3339Nano))
+		}
+	}
+	if withProvider {
+		parts = append(parts, "provider="+providerMode)
+		if offline {
+			parts = append(parts, "offline")
+		}
+		if abuseFlag {
+			parts = append(parts, "abuse")
+		}
+		if geoFlag {
+			parts = append(parts, "geo")
+		}
+	}
+	if groupsFlag {
+		parts = append(parts, "groups")
+	}
+	if fc, err := loadFileConfig(); err == nil {
+		// Tag lists and overrides are edited in place, so their modification
+		// times count
+		var tags []string
+		for name, path := range fc.Tags {
+			tag := "tag=" + name
+			if stat, err := os.Stat(path); err == nil {
+				tag += "@" + stat.ModTime().UTC().Format(time.RFC3339Nano)
+			}
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		parts = append(parts, tags...)
+		if fc.OverridesFile != "" {
+			overrides := "overrides=" + fc.OverridesFile
+			if stat, err := os.Stat(fc.OverridesFile); err == nil {
+				overrides += "@" + stat.ModTime().UTC().Format(time.RFC3339Nano)
+			}
+			parts = append(parts, overrides)
+		}
+		anycastPrefixes := slices.Clone(fc.AnycastPrefixes)
+		sort.Strings(anycastPrefixes)
+		for _, prefix := range anycastPrefixes {
+			parts = append(parts, "anycast="+prefix)
+		}
+	}
+	for _, prefix := range nat64 {
+		parts = append(parts, "nat64="+prefix.String())
+	}
+	for _, command := range enrichCommands {
+		parts = append(parts, "enrich="+command)
+	}
+	return strings.Join(parts, " ")
+}
+
+// saveResultCache writes c to disk, warning when it cannot.
+func saveResultCache(c *batch.ResultCache) {
+	if c == nil {
+		return
+	}
+	if err := c.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: save result cache: %v\n", err)
+	}
+}
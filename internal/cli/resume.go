@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// updateRun records the options of an update in its state directory, so
+// that update --resume continues it with the same ones.
+type updateRun struct {
+	Date      string   `json:"date"`
+	QueryTime string   `json:"query_time,omitempty"`
+	Earliest  bool     `json:"earliest,omitempty"`
+	Countries []string `json:"countries"`
+	KeepRaw   bool     `json:"keep_raw,omitempty"`
+	RawFormat string   `json:"raw_format,omitempty"`
+	Source    string   `json:"source,omitempty"`
+	// EmbedHolders is the provider mode of --embed-holders
+	EmbedHolders string `json:"embed_holders,omitempty"`
+	// EarliestTimes maps the uppercase country codes of an --earliest run
+	// to the time of their earliest data, once it has been found
+	EarliestTimes map[string]string `json:"earliest_times,omitempty"`
+}
+
+func updateRunPath(stateDir string) string {
+	return filepath.Join(stateDir, "run.json")
+}
+
+// loadUpdateRun reads the options of the unfinished update in stateDir.
+func loadUpdateRun(stateDir string) (*updateRun, error) {
+	data, err := os.ReadFile(updateRunPath(stateDir))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no unfinished update to resume")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var run updateRun
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", updateRunPath(stateDir), err)
+	}
+	return &run, nil
+}
+
+// startUpdateRun discards the state of any unfinished update and records
+// the options of a new one.
+func startUpdateRun(stateDir string, run *updateRun) error {
+	if err := os.RemoveAll(stateDir); err != nil {
+		return fmt.Errorf("remove update state: %w", err)
+	}
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return fmt.Errorf("create update state: %w", err)
+	}
+	return saveJSON(updateRunPath(stateDir), run)
+}
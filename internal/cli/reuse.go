@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hightemp/ip2cc/internal/config"
+	"github.com/hightemp/ip2cc/internal/rawstore"
+	"github.com/hightemp/ip2cc/internal/ripestat"
+	"github.com/hightemp/ip2cc/internal/snapshot"
+)
+
+// previousLists holds the country lists of the latest snapshot, so that
+// countries RIPEstat reports unchanged (HTTP 304) are reused instead of
+// downloaded again.
+type previousLists struct {
+	date  string
+	dir   string
+	stats map[string]snapshot.CountryStats
+	lists map[string]snapshot.CountryList
+}
+
+// loadPreviousLists loads the latest snapshot for conditional requests. It
+// returns nil if there is no usable snapshot, it carries no validators, or
+// it kept neither its country lists nor its raw responses: the index
+// keeps one country per prefix, so it cannot give the lists back.
+func loadPreviousLists(mgr *snapshot.Manager) *previousLists {
+	dir, meta, err := mgr.GetLatestSnapshot()
+	if err != nil || len(meta.CountryStats) == 0 {
+		return nil
+	}
+	lists, err := loadCountryLists(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		fmt.Printf("Warning: could not load snapshot %s for conditional requests: %v\n", meta.RequestedTime, err)
+		return nil
+	}
+
+	return &previousLists{
+		date:  meta.RequestedTime,
+		dir:   dir,
+		stats: meta.CountryStats,
+		lists: lists,
+	}
+}
+
+// loadCountryLists reads the country lists of the snapshot in dir, or
+// parses them from its raw responses if it has no lists file.
+func loadCountryLists(dir string) (map[string]snapshot.CountryList, error) {
+	lists, err := snapshot.LoadCountryLists(config.CountryListsPath(dir))
+	if !os.IsNotExist(err) {
+		return lists, err
+	}
+	lists = make(map[string]snapshot.CountryList)
+	err = rawstore.Read(dir, func(cc string, data []byte) error {
+		list, err := ripestat.ParseCountryResourceList(cc, data)
+		if err != nil {
+			return err
+		}
+		lists[list.CountryCode] = snapshot.CountryList{CountryCode: list.CountryCode, IPv4: list.IPv4, IPv6: list.IPv6}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+// stageRaw copies the raw responses of the reused countries from the
+// previous snapshot, if it kept them.
+func (p *previousLists) stageRaw(stage *rawstore.Stage, reused map[string]bool) error {
+	err := rawstore.Read(p.dir, func(cc string, data []byte) error {
+		if !reused[strings.ToUpper(cc)] {
+			return nil
+		}
+		return stage.Write(cc, data)
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Validators implements source.Previous. Countries that failed in the
+// previous snapshot, or whose list it did not keep, have none.
+func (p *previousLists) Validators(countryCode string) (string, string) {
+	stats := p.stats[countryCode]
+	if _, ok := p.lists[strings.ToUpper(countryCode)]; !ok || stats.Error != "" {
+		return "", ""
+	}
+	return stats.ETag, stats.LastModified
+}
+
+// Lists implements source.Previous.
+func (p *previousLists) Lists(countryCode string) ([]string, []string) {
+	list := p.lists[strings.ToUpper(countryCode)]
+	return list.IPv4, list.IPv6
+}
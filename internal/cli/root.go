@@ -2,10 +2,14 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
+	"github.com/hightemp/ip2cc/internal/batch"
 	"github.com/hightemp/ip2cc/internal/config"
+	"github.com/hightemp/ip2cc/internal/lock"
+	"github.com/hightemp/ip2cc/internal/ripestat"
 	"github.com/spf13/cobra"
 )
 
@@ -19,15 +23,43 @@ var (
 // Global flags
 var (
 	cacheDir     string
+	configPath   string
 	providerMode string
 	offline      bool
 	jsonOutput   bool
+	outputFormat string
+	outputPath   string
 	timeFlag     string
+	nearest      bool
+	bundlePath   string
+	mmdbPath     string
+	ripestatURL  string
+	abuseFlag    bool
+	geoFlag      bool
+	resolveFlag  bool
+	extractFlag  bool
+	annotateFlag bool
+	inputFormat  string
+	ipColumn     int
+	verbose      bool
+	summaryFlag  bool
+	summaryBy    string
+	summaryTop   int
+	noProgress   bool
+	skipSpecial  bool
+	alpha3Flag   bool
+	groupsFlag   bool
+	nat64Flags   []string
+	timingFlag   bool
+
+	providerCacheTTL  string
+	providerCachePath string
+	lookupConcurrency int
 )
 
 // rootCmd represents the base command
 var rootCmd = &cobra.Command{
-	Use:   "ip2cc [ip]",
+	Use:   "ip2cc [ip|cidr|asn]",
 	Short: "IP to Country Code - lookup country and provider for IP addresses",
 	Long: `ip2cc is a CLI tool that looks up country and provider information
 for IP addresses using data from RIPEstat.
@@ -35,9 +67,27 @@ for IP addresses using data from RIPEstat.
 For single IP lookup:
   ip2cc 8.8.8.8
 
+For CIDR lookup (reports whether the block spans several countries):
+  ip2cc 8.8.8.0/24
+
+For ASN lookup (holder, registration country and announced prefixes):
+  ip2cc AS13335
+
 For batch processing (read from stdin):
   cat ips.txt | ip2cc
 
+To look up every address in log lines:
+  cat access.log | ip2cc --extract
+
+To look up addresses of a growing log as they are written:
+  tail -f access.log | ip2cc --extract --annotate --follow
+
+To count addresses per country:
+  cat access.log | ip2cc --extract --summary --top 10
+
+To ask a running 'ip2cc serve --socket' daemon instead of loading the index:
+  ip2cc --use-daemon 8.8.8.8
+
 Data is derived from RIR (Regional Internet Registry) allocation data.
 Note: This represents IP address registration/delegation, not physical geolocation.`,
 	Args: cobra.MaximumNArgs(1),
@@ -46,7 +96,9 @@ Note: This represents IP address registration/delegation, not physical geolocati
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+	stopProfiling()
+	if err != nil {
 		os.Exit(1)
 	}
 }
@@ -54,28 +106,131 @@ func Execute() {
 func init() {
 	// Global flags
 	rootCmd.PersistentFlags().StringVar(&cacheDir, "cache-dir", config.DefaultCacheDir(), "cache directory path")
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", config.DefaultConfigPath(), "configuration file path")
+	rootCmd.PersistentFlags().StringVar(&ripestatURL, "ripestat-url", "", "RIPEstat Data API base URL, e.g. a caching proxy (default "+ripestat.BaseURL+")")
 
 	// Lookup-specific flags
-	rootCmd.Flags().StringVar(&providerMode, "provider-mode", "bgp", "provider resolution mode: bgp, whois, or off")
+	rootCmd.Flags().StringVar(&providerMode, "provider-mode", "bgp", "provider resolution mode: bgp, whois, whois43, rdap, local, auto, or off")
 	rootCmd.Flags().BoolVar(&offline, "offline", false, "offline mode (no network calls)")
 	rootCmd.Flags().BoolVar(&jsonOutput, "json", false, "output in JSON format")
+	rootCmd.Flags().StringVar(&outputFormat, "format", "text", "output format: text, json, proto (length-delimited protobuf messages), parquet, sqlite, cef, or leef (SIEM records), or ecs (Elastic Common Schema JSON)")
+	rootCmd.Flags().StringVarP(&outputPath, "output", "o", "", "write the results to this file instead of stdout; a .db or .parquet name selects that format (SQLite text values are truncated to 512 bytes)")
+	rootCmd.Flags().StringVar(&asnLookup, "asn", "", "look up an ASN (e.g. 13335 or AS13335) instead of an IP address")
 	rootCmd.Flags().StringVar(&timeFlag, "time", "", "use snapshot for specific date (YYYY-MM-DD)")
+	rootCmd.Flags().BoolVar(&nearest, "nearest", false, "with --time: use the snapshot closest to the date when there is none for it")
+	rootCmd.Flags().BoolVar(&autoFetch, "auto-fetch", false, "with --time: download the snapshot for the date if there is none, without asking")
+	rootCmd.Flags().BoolVar(&abuseFlag, "abuse", false, "add the network's abuse contact email addresses (needs network access)")
+	rootCmd.Flags().BoolVar(&geoFlag, "geo", false, "add a best-guess city and coordinates of the network (not the registration country; needs network access)")
+	rootCmd.Flags().BoolVar(&resolveFlag, "resolve", false, "resolve hostname inputs (A and AAAA) and look up every address")
+	rootCmd.Flags().BoolVar(&extractFlag, "extract", false, "batch mode: find and look up every IP address in each input line, e.g. log files")
+	rootCmd.Flags().BoolVar(&annotateFlag, "annotate", false, "with --extract: print each input line with the country inserted after every address")
+	rootCmd.Flags().StringVar(&inputFormat, "input-format", "lines", "batch input format: lines, csv, or tsv")
+	rootCmd.Flags().IntVar(&ipColumn, "ip-column", 1, "with --input-format csv/tsv: column holding the IP address (1-based)")
+	rootCmd.Flags().BoolVar(&summaryFlag, "summary", false, "batch mode: print counts and percentages per country instead of per-line results")
+	rootCmd.Flags().StringVar(&summaryBy, "summary-by", "country", "with --summary: group by country, continent, or asn")
+	rootCmd.Flags().IntVar(&summaryTop, "top", 0, "with --summary: show only the N largest groups")
+	rootCmd.Flags().IntVar(&lookupConcurrency, "concurrency", config.DefaultProviderLookupConcurrency, "parallel batch and provider lookups (max 32); lower it to stay within rate limits")
+	rootCmd.Flags().BoolVar(&groupsFlag, "groups", false, "add the country groups (eu, eea, schengen, and groups from the config file) of each result")
+	rootCmd.Flags().BoolVar(&alpha3Flag, "alpha3", false, "show ISO-3166 alpha-3 country codes (e.g. USA) in text output")
+	rootCmd.Flags().StringArrayVar(&nat64Flags, "nat64-prefix", nil, "NAT64 prefix whose addresses are looked up as the embedded IPv4 address (repeatable; default 64:ff9b::/96)")
+	rootCmd.Flags().BoolVar(&skipSpecial, "skip-special", false, "batch mode: leave private, loopback, multicast and other special-purpose addresses out of the output")
+	rootCmd.Flags().StringArrayVar(&enrichCommands, "enrich", nil, "run an enrichment plugin command that adds fields to each result (repeatable)")
+	rootCmd.Flags().BoolVarP(&followFlag, "follow", "f", false, "batch mode: keep reading stdin as it grows (like tail -f) and print each result immediately")
+	rootCmd.Flags().BoolVar(&noProgress, "no-progress", false, "do not show batch progress on stderr")
+	rootCmd.Flags().BoolVar(&schemaFlag, "schema", false, "print the JSON Schema of the JSON output and exit")
+	rootCmd.Flags().BoolVar(&timingFlag, "timing", false, "report index load, trie lookup and provider durations (in JSON output, or on stderr)")
+	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "print batch statistics to stderr")
+	rootCmd.Flags().BoolVar(&useDaemon, "use-daemon", false, "forward lookups to a running 'ip2cc serve --socket' daemon, falling back to loading the index locally")
+	rootCmd.Flags().StringVar(&daemonSocket, "daemon-socket", "", "with --use-daemon: daemon socket path (default <cache-dir>/ip2cc.sock)")
+	rootCmd.Flags().StringVar(&bundlePath, "bundle", "", "look up from a snapshot bundle file instead of the cache")
+	rootCmd.Flags().StringVar(&mmdbPath, "db", "", "look up from a MaxMind DB file (e.g. GeoLite2-Country.mmdb) instead of the cache")
+	rootCmd.Flags().BoolVar(&noGeofeed, "no-geofeed", false, "ignore the geofeed overlay and report the RIR country only")
+	rootCmd.Flags().StringVar(&providerCacheTTL, "provider-cache-ttl", "", "provider cache lifetime, e.g. 7d or 12h (default 7d)")
+	rootCmd.Flags().BoolVar(&resultCacheFlag, "result-cache", false, "batch mode: keep results in <cache-dir>/result_cache.json and reuse them in later runs on the same snapshot")
+	rootCmd.Flags().IntVar(&resultCacheSize, "result-cache-size", batch.DefaultResultCacheSize, "with --result-cache: number of results kept (least recently used are dropped)")
+	rootCmd.Flags().StringVar(&providerCachePath, "provider-cache-path", "", "provider cache file (default <cache-dir>/provider_cache.json)")
 
 	// Add subcommands
 	rootCmd.AddCommand(updateCmd)
 	rootCmd.AddCommand(versionCmd)
+	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(indexCmd)
+	rootCmd.AddCommand(snapshotCmd)
+	rootCmd.AddCommand(asnCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(geofeedCmd)
+	rootCmd.AddCommand(schemaCmd)
+	rootCmd.AddCommand(randomCmd)
+	rootCmd.AddCommand(checkCmd)
+	rootCmd.AddCommand(cidrCmd)
 }
 
 // ExitCode constants
 const (
 	ExitSuccess        = 0
+	ExitDenied         = 1
 	ExitInvalidInput   = 2
 	ExitNoSnapshot     = 3
 	ExitNotFound       = 4
 	ExitProviderFailed = 5
 )
 
+// loadFileConfig reads the configuration file selected with --config.
+func loadFileConfig() (*config.FileConfig, error) {
+	fc, err := config.LoadFileConfig(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("load config: %w", err)
+	}
+	return fc, nil
+}
+
+// ripestatBaseURL returns the RIPEstat base URL from --ripestat-url or the
+// configuration file; empty means the default.
+func ripestatBaseURL(fc *config.FileConfig) string {
+	if ripestatURL != "" {
+		return ripestatURL
+	}
+	return fc.RIPEstatURL
+}
+
+// lockCache takes the cache directory lock: exclusive for writers, shared
+// for readers. It tells the user when it has to wait for another process.
+func lockCache(exclusive bool) (*lock.Lock, error) {
+	if err := config.EnsureDir(cacheDir); err != nil {
+		return nil, fmt.Errorf("create cache dir: %w", err)
+	}
+	path := config.LockPath(cacheDir)
+
+	l, err := lock.TryAcquire(path, exclusive)
+	if errors.Is(err, lock.ErrLocked) {
+		fmt.Fprintln(os.Stderr, "Waiting for another ip2cc process to release the cache lock...")
+		l, err = lock.Acquire(path, exclusive)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lock cache: %w", err)
+	}
+	return l, nil
+}
+
 func exitWithCode(code int, msg string) {
 	fmt.Fprintln(os.Stderr, msg)
+	stopProfiling()
 	os.Exit(code)
 }
+
+// exitError ends a command with an exit code like exitWithCode, but is
+// returned instead, so that deferred cleanup runs first: the output file is
+// finished and the caches are saved.
+type exitError struct {
+	code int
+	msg  string
+}
+
+func (e *exitError) Error() string {
+	return e.msg
+}
+
+// exitErr returns an exitError for code and msg.
+func exitErr(code int, msg string) error {
+	return &exitError{code: code, msg: msg}
+}
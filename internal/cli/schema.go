@@ -0,0 +1,29 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/hightemp/ip2cc/internal/output"
+	"github.com/spf13/cobra"
+)
+
+// schemaFlag prints the JSON Schema of the output instead of looking up.
+var schemaFlag bool
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of the JSON output",
+	Long: `Prints the JSON Schema (draft 2020-12) of the results written with --json:
+a result object for a single lookup, or an array of them in batch mode.
+
+The schema is versioned, its "$id" ending in the version. Within a version
+fields are only added; a field is never removed, renamed or given another
+type without a new version.`,
+	Args: cobra.NoArgs,
+	RunE: runSchema,
+}
+
+func runSchema(cmd *cobra.Command, args []string) error {
+	_, err := os.Stdout.Write(output.JSONSchema())
+	return err
+}
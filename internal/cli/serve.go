@@ -0,0 +1,302 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/enrich"
+	"github.com/hightemp/ip2cc/internal/index"
+	"github.com/hightemp/ip2cc/internal/iplist"
+	"github.com/hightemp/ip2cc/internal/server"
+	"github.com/spf13/cobra"
+)
+
+var (
+	listenAddr   string
+	socketPath   string
+	socketFormat string
+	tlsCert      string
+	tlsKey       string
+	tlsClientCA  string
+	swaggerUI    bool
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run an HTTP lookup server",
+	Long: `Loads the snapshot once and answers lookups over HTTP.
+
+Endpoints:
+  GET /lookup/{ip}   lookup result as JSON
+  POST /lookup       results for a JSON array or list of addresses
+  GET /snapshot      snapshot metadata (date, counts, age, failed countries)
+  GET /openapi.json  OpenAPI 3.1 description of the endpoints
+  GET /docs          Swagger UI for the description (with --swagger-ui)
+
+With --tls-cert and --tls-key, the server answers HTTPS; with
+--tls-client-ca it also requires client certificates signed by those CAs.
+
+With --socket, lookups are answered on a Unix domain socket, or on TCP
+for tcp://HOST:PORT, instead of HTTP: send one IP address or CIDR per line
+and receive one tab-separated result line, as printed by the CLI. With
+--socket-format json, every line is answered with a JSON result object
+instead, for the enrichment stages of log shippers such as Vector or
+Fluent Bit; a "FORMAT json" or "FORMAT text" line switches the format of
+a connection. On TCP, the api_keys of the configuration file are required
+with an "AUTH <key>" first line, and rate_limit applies per client.
+
+Send SIGHUP to reload the snapshot (e.g. after 'ip2cc update') and the TLS
+certificates without interrupting lookups in progress.
+
+Examples:
+  ip2cc serve                          # Listen on 127.0.0.1:8080
+  ip2cc serve --listen :9000 --offline # No provider lookups
+  ip2cc serve --listen :8443 --tls-cert server.crt --tls-key server.key
+  ip2cc serve --socket /run/ip2cc.sock --offline
+  ip2cc serve --socket tcp://127.0.0.1:9700 --socket-format json`,
+	Args: cobra.NoArgs,
+	RunE: runServe,
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&listenAddr, "listen", "127.0.0.1:8080", "address to listen on")
+	serveCmd.Flags().StringVar(&socketPath, "socket", "", "answer a line protocol on this Unix domain socket, or tcp://HOST:PORT, instead of HTTP")
+	serveCmd.Flags().StringVar(&socketFormat, "socket-format", "text", "with --socket: answer lines as text or json (one result object per line)")
+	serveCmd.Flags().StringVar(&tlsCert, "tls-cert", "", "serve HTTPS with this PEM certificate (chain) file")
+	serveCmd.Flags().StringVar(&tlsKey, "tls-key", "", "with --tls-cert: PEM private key file")
+	serveCmd.Flags().BoolVar(&swaggerUI, "swagger-ui", false, "serve a Swagger UI page at /docs (loads its scripts from unpkg.com)")
+	serveCmd.Flags().StringVar(&tlsClientCA, "tls-client-ca", "", "with --tls-cert: require client certificates signed by the CAs in this PEM file")
+	serveCmd.Flags().StringVar(&providerMode, "provider-mode", "bgp", "provider resolution mode: bgp, whois, whois43, rdap, local, auto, or off")
+	serveCmd.Flags().BoolVar(&offline, "offline", false, "offline mode (no network calls)")
+	serveCmd.Flags().StringVar(&timeFlag, "time", "", "use snapshot for specific date (YYYY-MM-DD)")
+	serveCmd.Flags().BoolVar(&nearest, "nearest", false, "with --time: use the snapshot closest to the date when there is none for it")
+	serveCmd.Flags().StringVar(&bundlePath, "bundle", "", "serve from a snapshot bundle file instead of the cache")
+	serveCmd.Flags().StringVar(&mmdbPath, "db", "", "serve from a MaxMind DB file (e.g. GeoLite2-Country.mmdb) instead of the cache")
+	serveCmd.Flags().BoolVar(&noGeofeed, "no-geofeed", false, "ignore the geofeed overlay and report the RIR country only")
+	serveCmd.Flags().StringArrayVar(&enrichCommands, "enrich", nil, "run an enrichment plugin command that adds fields to each result (repeatable)")
+	serveCmd.Flags().StringArrayVar(&nat64Flags, "nat64-prefix", nil, "NAT64 prefix whose addresses are looked up as the embedded IPv4 address (repeatable; default 64:ff9b::/96)")
+	serveCmd.Flags().StringVar(&providerCacheTTL, "provider-cache-ttl", "", "provider cache lifetime, e.g. 7d or 12h (default 7d)")
+	serveCmd.Flags().StringVar(&providerCachePath, "provider-cache-path", "", "provider cache file (default <cache-dir>/provider_cache.json)")
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+	switch {
+	case socketFormat != "text" && socketFormat != "json":
+		exitWithCode(ExitInvalidInput, fmt.Sprintf("Error: invalid socket format: %s (use text or json)", socketFormat))
+		return nil
+	case socketFormat != "text" && socketPath == "":
+		exitWithCode(ExitInvalidInput, "Error: --socket-format needs --socket")
+		return nil
+	}
+
+	snap, err := openSnapshot(timeFlag)
+	if err != nil {
+		exitWithCode(ExitNoSnapshot, fmt.Sprintf("Error: %v\nRun 'ip2cc update' to download data.", err))
+		return nil
+	}
+
+	resolver, err := newResolver(snap)
+	if err != nil {
+		exitWithCode(ExitInvalidInput, err.Error())
+		return nil
+	}
+	if resolver != nil {
+		defer resolver.SaveCache()
+	}
+
+	srv := server.New(&index.Index{V4: snap.v4, V6: snap.v6}, resolver, snap.meta)
+	enrichers, err := startEnrichers(nil)
+	if err != nil {
+		exitWithCode(ExitInvalidInput, fmt.Sprintf("Error: %v", err))
+		return nil
+	}
+	defer enrich.Close(enrichers)
+	// The list enricher is kept across reloads and takes the lists of the
+	// reloaded snapshot
+	var listEnricher *iplist.Enricher
+	if len(snap.lists) > 0 {
+		listEnricher = iplist.NewEnricher(snap.lists)
+		srv.AddEnricher(listEnricher)
+	}
+	for _, e := range enrichers {
+		srv.AddEnricher(e)
+	}
+	prefixes, err := nat64Prefixes()
+	if err != nil {
+		exitWithCode(ExitInvalidInput, fmt.Sprintf("Error: %v", err))
+		return nil
+	}
+	srv.SetNAT64Prefixes(prefixes)
+	anycastPrefixes, err := loadAnycast()
+	if err != nil {
+		exitWithCode(ExitInvalidInput, fmt.Sprintf("Error: %v", err))
+		return nil
+	}
+	srv.SetAnycast(anycastPrefixes)
+	tags, err := loadTags()
+	if err != nil {
+		exitWithCode(ExitInvalidInput, fmt.Sprintf("Error: %v", err))
+		return nil
+	}
+	srv.SetTags(tags)
+	srv.SetSwaggerUI(swaggerUI)
+	if err := setServeAccess(srv); err != nil {
+		exitWithCode(ExitInvalidInput, fmt.Sprintf("Error: %v", err))
+		return nil
+	}
+
+	serverTLS, err := loadServeTLS()
+	if err != nil {
+		exitWithCode(ExitInvalidInput, fmt.Sprintf("Error: %v", err))
+		return nil
+	}
+
+	addPprof(srv)
+	httpServer := &http.Server{
+		Addr:              listenAddr,
+		Handler:           srv.Handler(),
+		ReadHeaderTimeout: server.ReadHeaderTimeout,
+		IdleTimeout:       server.IdleTimeout,
+	}
+	if serverTLS != nil {
+		httpServer.TLSConfig = serverTLS.Config()
+	}
+
+	// Shut down cleanly on interrupt so the provider cache gets saved
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	// Reload the snapshot on SIGHUP without dropping requests
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go func() {
+		for range hup {
+			next, err := openSnapshot(timeFlag)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Reload failed: %v\n", err)
+				continue
+			}
+			srv.Reload(&index.Index{V4: next.v4, V6: next.v6}, next.meta)
+			if listEnricher != nil {
+				listEnricher.Swap(next.lists)
+			}
+			if serverTLS != nil {
+				if err := serverTLS.Reload(); err != nil {
+					fmt.Fprintf(os.Stderr, "TLS reload failed, keeping the old certificate: %v\n", err)
+				}
+			}
+			fmt.Printf("Reloaded snapshot %s\n", next.meta.RequestedTime)
+		}
+	}()
+
+	if socketPath != "" {
+		return serveSocket(ctx, srv, snap.meta.RequestedTime)
+	}
+
+	if serverTLS != nil {
+		fmt.Printf("Serving snapshot %s on https://%s\n", snap.meta.RequestedTime, listenAddr)
+		err = httpServer.ListenAndServeTLS("", "")
+	} else {
+		fmt.Printf("Serving snapshot %s on http://%s\n", snap.meta.RequestedTime, listenAddr)
+		err = httpServer.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// loadServeTLS loads the certificates given with --tls-cert, --tls-key and
+// --tls-client-ca. It returns nil without --tls-cert.
+func loadServeTLS() (*server.TLS, error) {
+	if tlsCert == "" {
+		if tlsKey != "" || tlsClientCA != "" {
+			return nil, fmt.Errorf("--tls-key and --tls-client-ca need --tls-cert")
+		}
+		return nil, nil
+	}
+	if tlsKey == "" {
+		return nil, fmt.Errorf("--tls-cert needs --tls-key")
+	}
+	if socketPath != "" {
+		return nil, fmt.Errorf("--socket cannot be combined with TLS")
+	}
+	return server.NewTLS(tlsCert, tlsKey, tlsClientCA)
+}
+
+// setServeAccess sets up the API keys and rate limit of the configuration
+// file.
+func setServeAccess(srv *server.Server) error {
+	fc, err := loadFileConfig()
+	if err != nil {
+		return err
+	}
+	if fc.RateLimit < 0 || fc.RateBurst < 0 {
+		return fmt.Errorf("config rate_limit and rate_burst must not be negative")
+	}
+	if len(fc.APIKeys) > 0 {
+		srv.SetAPIKeys(fc.APIKeys)
+	}
+	if fc.RateLimit > 0 {
+		srv.SetRateLimit(fc.RateLimit, fc.RateBurst)
+	}
+	return nil
+}
+
+// tcpSocketPrefix starts a --socket value naming a TCP address rather than
+// the path of a Unix domain socket.
+const tcpSocketPrefix = "tcp://"
+
+// serveSocket answers the line protocol on the socket given with --socket
+// until ctx is done.
+func serveSocket(ctx context.Context, srv *server.Server, date string) error {
+	var l net.Listener
+	if addr, ok := strings.CutPrefix(socketPath, tcpSocketPrefix); ok {
+		var err error
+		if l, err = net.Listen("tcp", addr); err != nil {
+			return err
+		}
+	} else {
+		if conn, err := net.Dial("unix", socketPath); err == nil {
+			conn.Close()
+			return fmt.Errorf("socket %s is in use by another process", socketPath)
+		}
+		// Remove a socket left behind by a process that did not exit cleanly
+		if fi, err := os.Lstat(socketPath); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(socketPath)
+		}
+
+		var err error
+		if l, err = net.Listen("unix", socketPath); err != nil {
+			return err
+		}
+	}
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	if l.Addr().Network() == "tcp" {
+		fmt.Printf("Serving snapshot %s on tcp://%s\n", date, l.Addr())
+	} else {
+		fmt.Printf("Serving snapshot %s on unix:%s\n", date, socketPath)
+	}
+	if socketFormat == "json" {
+		return srv.ServeLinesJSON(ctx, l)
+	}
+	return srv.ServeLines(ctx, l)
+}
@@ -0,0 +1,398 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/archive"
+	"github.com/hightemp/ip2cc/internal/bundle"
+	"github.com/hightemp/ip2cc/internal/config"
+	"github.com/hightemp/ip2cc/internal/signing"
+	"github.com/hightemp/ip2cc/internal/snapshot"
+	"github.com/spf13/cobra"
+)
+
+var (
+	bundleOutput        string
+	bundleProviderCache bool
+	showJSON            bool
+	showCountries       bool
+	packOutput          string
+	publishTarget       string
+	signKeyPath         string
+	keygenOutput        string
+)
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Manage local snapshots",
+}
+
+var snapshotBundleCmd = &cobra.Command{
+	Use:   "bundle [date]",
+	Short: "Export a snapshot as a single self-contained bundle file",
+	Long: `Writes a snapshot's indices and metadata (and optionally the ASN holder
+cache) into one .ip2cc file that can be copied to other machines and used
+directly with --bundle.
+
+Examples:
+  ip2cc snapshot bundle -o data.ip2cc                   # Latest snapshot
+  ip2cc snapshot bundle 2025-01-01 -o 2025-01-01.ip2cc
+  ip2cc --bundle data.ip2cc 8.8.8.8`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runSnapshotBundle,
+}
+
+var snapshotShowCmd = &cobra.Command{
+	Use:   "show [date]",
+	Short: "Show snapshot metadata and the changes since the previous snapshot",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runSnapshotShow,
+}
+
+var snapshotPackCmd = &cobra.Command{
+	Use:   "pack [date]",
+	Short: "Package a snapshot as a distributable .tar.zst archive",
+	Long: `Packs a snapshot's indices and metadata into a zstd-compressed tar archive
+with a manifest of SHA-256 checksums. The archive can be installed on other
+machines with 'ip2cc update --from-url'.
+
+Examples:
+  ip2cc snapshot pack                          # Latest snapshot -> <date>.tar.zst
+  ip2cc snapshot pack 2025-01-01 -o snap.tar.zst`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runSnapshotPack,
+}
+
+var snapshotPublishCmd = &cobra.Command{
+	Use:   "publish [date]",
+	Short: "Pack a snapshot and publish it to a directory or HTTP endpoint",
+	Long: `Packs a snapshot and publishes it as both <date>.tar.zst and latest.tar.zst.
+
+The target is either a local directory (for example a synced bucket or a web
+root) or an http(s) URL prefix that accepts PUT uploads, such as an object
+storage bucket endpoint.
+
+Examples:
+  ip2cc snapshot publish --to /var/www/ip2cc
+  ip2cc snapshot publish --to https://storage.example.com/ip2cc/`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runSnapshotPublish,
+}
+
+var snapshotKeygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Generate an Ed25519 key pair for signing snapshot archives",
+	Long: `Generates a key pair for signing archives created with 'snapshot pack' and
+'snapshot publish'. The public key is written in minisign format next to the
+secret key (<file>.pub). Add it to "trusted_keys" in the configuration file
+on machines that install snapshots with 'update --from-url'.
+
+Examples:
+  ip2cc snapshot keygen -o ip2cc.key
+  ip2cc snapshot pack --sign-key ip2cc.key`,
+	Args: cobra.NoArgs,
+	RunE: runSnapshotKeygen,
+}
+
+func init() {
+	snapshotKeygenCmd.Flags().StringVarP(&keygenOutput, "output", "o", "ip2cc.key", "secret key file")
+	snapshotCmd.AddCommand(snapshotKeygenCmd)
+
+	snapshotPackCmd.Flags().StringVarP(&packOutput, "output", "o", "", "output file (default: <date>.tar.zst)")
+	snapshotPackCmd.Flags().StringVar(&signKeyPath, "sign-key", "", "secret key to sign the archive with (writes <output>.minisig)")
+	snapshotCmd.AddCommand(snapshotPackCmd)
+
+	snapshotPublishCmd.Flags().StringVar(&publishTarget, "to", "", "target directory or http(s) URL prefix")
+	snapshotPublishCmd.Flags().StringVar(&signKeyPath, "sign-key", "", "secret key to sign the archives with")
+	snapshotPublishCmd.MarkFlagRequired("to")
+	snapshotCmd.AddCommand(snapshotPublishCmd)
+
+	snapshotShowCmd.Flags().BoolVar(&showJSON, "json", false, "print raw metadata as JSON")
+	snapshotShowCmd.Flags().BoolVar(&showCountries, "countries", false, "print per-country prefix counts")
+	snapshotCmd.AddCommand(snapshotShowCmd)
+
+	snapshotBundleCmd.Flags().StringVarP(&bundleOutput, "output", "o", "", "output file (default: <date>.ip2cc)")
+	snapshotBundleCmd.Flags().BoolVar(&bundleProviderCache, "with-provider-cache", false, "include the ASN holder cache")
+
+	snapshotCmd.AddCommand(snapshotBundleCmd)
+}
+
+func runSnapshotBundle(cmd *cobra.Command, args []string) error {
+	date := ""
+	if len(args) == 1 {
+		date = args[0]
+	}
+
+	snap, err := findSnapshot(date)
+	if err != nil {
+		exitWithCode(ExitNoSnapshot, fmt.Sprintf("Error: %v", err))
+		return nil
+	}
+
+	out := bundleOutput
+	if out == "" {
+		out = snap.meta.RequestedTime + bundle.Extension
+	}
+
+	cachePath := ""
+	if bundleProviderCache {
+		opts, err := resolverOptions()
+		if err != nil {
+			return err
+		}
+		cachePath = opts.CachePath
+		if cachePath == "" {
+			cachePath = config.ProviderCachePath(cacheDir)
+		}
+	}
+
+	if err := bundle.Create(out, snap.dir, cachePath); err != nil {
+		return fmt.Errorf("create bundle: %w", err)
+	}
+	fmt.Printf("Bundle for %s written to %s\n", snap.meta.RequestedTime, out)
+	return nil
+}
+
+func runSnapshotShow(cmd *cobra.Command, args []string) error {
+	date := ""
+	if len(args) == 1 {
+		date = args[0]
+	}
+
+	snap, err := findSnapshot(date)
+	if err != nil {
+		exitWithCode(ExitNoSnapshot, fmt.Sprintf("Error: %v", err))
+		return nil
+	}
+	meta := snap.meta
+
+	if showJSON {
+		data, err := json.MarshalIndent(meta, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	fmt.Printf("Snapshot:      %s\n", meta.RequestedTime)
+	fmt.Printf("Query time:    %s\n", meta.ActualQueryTime)
+	fmt.Printf("Created:       %s\n", meta.CreatedAt.Format("2006-01-02 15:04:05 MST"))
+	fmt.Printf("Countries:     %d\n", meta.CountriesCount)
+	if len(meta.FailedCountries) > 0 {
+		fmt.Printf("Failed:        %s\n", strings.Join(meta.FailedCountries, ", "))
+	}
+	fmt.Printf("IPv4 prefixes: %d\n", meta.PrefixesV4)
+	fmt.Printf("IPv6 prefixes: %d\n", meta.PrefixesV6)
+	fmt.Printf("Location:      %s\n", snap.dir)
+
+	if showCountries {
+		printCountryStats(meta.CountryStats)
+	}
+
+	cl := meta.Changelog
+	if cl == nil {
+		fmt.Println("\nNo changelog recorded (first snapshot or built by an older version).")
+		return nil
+	}
+
+	fmt.Printf("\nChanges since %s: +%d / -%d prefixes\n", cl.Previous, cl.Added, cl.Removed)
+	for _, cc := range cl.CountryCodes() {
+		c := cl.Countries[cc]
+		fmt.Printf("  %s  +%d / -%d\n", cc, c.Added, c.Removed)
+	}
+	return nil
+}
+
+func runSnapshotPack(cmd *cobra.Command, args []string) error {
+	date := ""
+	if len(args) == 1 {
+		date = args[0]
+	}
+
+	snap, err := findSnapshot(date)
+	if err != nil {
+		exitWithCode(ExitNoSnapshot, fmt.Sprintf("Error: %v", err))
+		return nil
+	}
+
+	out := packOutput
+	if out == "" {
+		out = archive.FileName(snap.meta.RequestedTime)
+	}
+
+	sk, err := loadSignKey()
+	if err != nil {
+		return err
+	}
+
+	if _, err := archive.CreateFile(out, snap.dir, snap.meta.RequestedTime); err != nil {
+		return fmt.Errorf("pack snapshot: %w", err)
+	}
+	fmt.Printf("Archive for %s written to %s\n", snap.meta.RequestedTime, out)
+
+	if sk != nil {
+		data, err := os.ReadFile(out)
+		if err != nil {
+			return err
+		}
+		sig := signing.Sign(sk, data, signatureComment(snap.meta.RequestedTime))
+		if err := os.WriteFile(out+signing.SignatureExtension, sig, 0644); err != nil {
+			return fmt.Errorf("write signature: %w", err)
+		}
+		fmt.Printf("Signature written to %s\n", out+signing.SignatureExtension)
+	}
+	return nil
+}
+
+func runSnapshotPublish(cmd *cobra.Command, args []string) error {
+	date := ""
+	if len(args) == 1 {
+		date = args[0]
+	}
+
+	snap, err := findSnapshot(date)
+	if err != nil {
+		exitWithCode(ExitNoSnapshot, fmt.Sprintf("Error: %v", err))
+		return nil
+	}
+	date = snap.meta.RequestedTime
+
+	sk, err := loadSignKey()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if _, err := archive.Create(&buf, snap.dir, date); err != nil {
+		return fmt.Errorf("pack snapshot: %w", err)
+	}
+	var sig []byte
+	if sk != nil {
+		sig = signing.Sign(sk, buf.Bytes(), signatureComment(date))
+	}
+
+	for _, name := range []string{archive.FileName(date), archive.FileName(config.LatestSymlink)} {
+		// Signature first, so readers never see an archive without one
+		if sig != nil {
+			dest, err := publishArchive(cmd.Context(), publishTarget, name+signing.SignatureExtension, sig)
+			if err != nil {
+				return fmt.Errorf("publish %s: %w", name+signing.SignatureExtension, err)
+			}
+			fmt.Printf("Published %s\n", dest)
+		}
+		dest, err := publishArchive(cmd.Context(), publishTarget, name, buf.Bytes())
+		if err != nil {
+			return fmt.Errorf("publish %s: %w", name, err)
+		}
+		fmt.Printf("Published %s\n", dest)
+	}
+	return nil
+}
+
+func runSnapshotKeygen(cmd *cobra.Command, args []string) error {
+	if _, err := os.Stat(keygenOutput); err == nil {
+		return fmt.Errorf("%s already exists", keygenOutput)
+	}
+
+	pk, sk, err := signing.GenerateKey()
+	if err != nil {
+		return fmt.Errorf("generate key: %w", err)
+	}
+	if err := sk.Save(keygenOutput); err != nil {
+		return fmt.Errorf("save secret key: %w", err)
+	}
+	pubPath := keygenOutput + signing.PublicKeyExtension
+	if err := os.WriteFile(pubPath, pk.Encode(), 0644); err != nil {
+		return fmt.Errorf("save public key: %w", err)
+	}
+
+	fmt.Printf("Secret key written to %s (keep it private)\n", keygenOutput)
+	fmt.Printf("Public key written to %s\n", pubPath)
+	fmt.Printf("\nAdd to \"trusted_keys\" in %s on installing machines:\n  %s\n", configPath, pk.String())
+	return nil
+}
+
+// loadSignKey loads the --sign-key secret key, or returns nil if unset.
+func loadSignKey() (*signing.SecretKey, error) {
+	if signKeyPath == "" {
+		return nil, nil
+	}
+	sk, err := signing.LoadSecretKey(signKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("load sign key: %w", err)
+	}
+	return sk, nil
+}
+
+// signatureComment is the trusted comment embedded in archive signatures.
+func signatureComment(date string) string {
+	return fmt.Sprintf("ip2cc snapshot %s timestamp:%d", date, time.Now().Unix())
+}
+
+// publishArchive stores data as name under target and returns where it went.
+func publishArchive(ctx context.Context, target, name string, data []byte) (string, error) {
+	if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+		if err := config.EnsureDir(target); err != nil {
+			return "", err
+		}
+		dest := filepath.Join(target, name)
+		tmp := dest + ".tmp"
+		if err := os.WriteFile(tmp, data, 0644); err != nil {
+			return "", err
+		}
+		return dest, os.Rename(tmp, dest)
+	}
+
+	dest := strings.TrimSuffix(target, "/") + "/" + name
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, dest, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/zstd")
+	req.Header.Set("User-Agent", config.AppName+"/"+Version)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return dest, nil
+}
+
+func printCountryStats(stats map[string]snapshot.CountryStats) {
+	if len(stats) == 0 {
+		fmt.Println("\nNo per-country statistics recorded (built by an older version).")
+		return
+	}
+
+	codes := make([]string, 0, len(stats))
+	for cc := range stats {
+		codes = append(codes, cc)
+	}
+	sort.Strings(codes)
+
+	fmt.Printf("\n%-4s %8s %8s\n", "CC", "IPv4", "IPv6")
+	for _, cc := range codes {
+		s := stats[cc]
+		if s.Error != "" {
+			fmt.Printf("%-4s failed: %s\n", cc, s.Error)
+			continue
+		}
+		fmt.Printf("%-4s %8d %8d\n", cc, s.PrefixesV4, s.PrefixesV6)
+	}
+}
@@ -4,25 +4,47 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/netip"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
 	"sync"
-	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/hightemp/ip2cc/internal/asndb"
 	"github.com/hightemp/ip2cc/internal/config"
 	"github.com/hightemp/ip2cc/internal/countries"
 	"github.com/hightemp/ip2cc/internal/index"
+	"github.com/hightemp/ip2cc/internal/iplist"
+	"github.com/hightemp/ip2cc/internal/rawstore"
 	"github.com/hightemp/ip2cc/internal/ripestat"
 	"github.com/hightemp/ip2cc/internal/snapshot"
+	"github.com/hightemp/ip2cc/internal/source"
 	"github.com/spf13/cobra"
 )
 
 var (
 	concurrency   int
 	countriesFile string
+	countryList   []string
+	merge         bool
 	keepRaw       bool
+	rawFormat     string
 	force         bool
+	earliest      bool
+	fromURL       string
+	fromMirror    bool
+	asnDB         bool
+	asnDBURL      string
+	resume        bool
+	sourceName    string
+	repair        bool
+	embedHolders  string
+	withLists     bool
 )
 
 var updateCmd = &cobra.Command{
@@ -34,21 +56,71 @@ index for fast IP lookups.
 Examples:
   ip2cc update                     # Build latest snapshot
   ip2cc update --time 2025-01-01   # Build snapshot for specific date
-  ip2cc update --concurrency 4     # Limit parallel downloads`,
+  ip2cc update --earliest          # Build baseline from earliest available data
+  ip2cc update --concurrency 4     # Limit parallel downloads
+  ip2cc update --source rir        # Build from the RIRs' delegated statistics files
+  ip2cc update --lists             # Also flag Tor exit nodes and hosting networks
+  ip2cc update --resume            # Continue an interrupted update
+  ip2cc update --countries us,de --merge  # Refresh two countries in the latest snapshot
+  ip2cc update --repair            # Rebuild the latest snapshot if it is damaged
+  ip2cc update --from-mirror       # Install the prebuilt official snapshot
+  ip2cc update --from-url https://example.com/2025-01-01.tar.zst`,
 	RunE: runUpdate,
 }
 
 func init() {
 	updateCmd.Flags().IntVar(&concurrency, "concurrency", config.DefaultConcurrency, "parallel download limit (max 8)")
 	updateCmd.Flags().StringVar(&countriesFile, "countries-file", "", "file with country codes (one per line)")
+	updateCmd.Flags().StringSliceVar(&countryList, "countries", nil, "country codes to download (comma-separated)")
+	updateCmd.Flags().BoolVar(&merge, "merge", false, "refresh only the listed countries in the latest snapshot instead of building a new one")
 	updateCmd.Flags().BoolVar(&keepRaw, "keep-raw", false, "keep raw JSON responses")
+	updateCmd.Flags().StringVar(&rawFormat, "raw-format", "gzip", "storage for --keep-raw: gzip, tar.zst, or json")
 	updateCmd.Flags().BoolVar(&force, "force", false, "rebuild even if snapshot exists")
 	updateCmd.Flags().StringVar(&timeFlag, "time", "", "build snapshot for specific date (YYYY-MM-DD)")
+	updateCmd.Flags().BoolVar(&earliest, "earliest", false, "build a baseline snapshot from the earliest data RIPEstat has")
+	updateCmd.Flags().StringVar(&fromURL, "from-url", "", "install a prebuilt snapshot archive from a URL or file instead of querying RIPEstat")
+	updateCmd.Flags().BoolVar(&fromMirror, "from-mirror", false, "install the prebuilt snapshot from the official mirror")
+	updateCmd.Flags().BoolVar(&asnDB, "asn-db", false, "also download the ip-to-ASN table for --provider-mode local")
+	updateCmd.Flags().StringVar(&asnDBURL, "asn-db-url", asndb.DefaultURL, "source of the ip-to-ASN table (TSV, optionally gzipped)")
+	updateCmd.Flags().StringVar(&sourceName, "source", "ripestat", "data source: ripestat (per-country queries) or rir (the five RIRs' delegated-extended files)")
+	updateCmd.Flags().BoolVar(&resume, "resume", false, "continue an interrupted or partly failed update, fetching only the countries it did not get")
+	updateCmd.Flags().StringVar(&embedHolders, "embed-holders", "", "store the main provider of every prefix in the index for --offline lookups, resolved with this provider mode: local (the --asn-db table, no API calls) or bgp, whois, rdap (one API call per prefix not in the provider cache)")
+	updateCmd.Flags().BoolVar(&repair, "repair", false, "rebuild the indices of the latest snapshot (or --time) if they are damaged, from its raw responses or by downloading it again")
+	updateCmd.Flags().BoolVar(&withLists, "lists", false, "also download the Tor exit list and hosting/VPN prefix lists into the snapshot, to flag listed addresses in lookups")
+	updateCmd.MarkFlagsMutuallyExclusive("time", "earliest", "from-url", "from-mirror")
+	updateCmd.MarkFlagsMutuallyExclusive("resume", "from-url", "from-mirror")
+	updateCmd.MarkFlagsMutuallyExclusive("countries", "countries-file")
+	updateCmd.MarkFlagsMutuallyExclusive("merge", "time", "earliest", "resume", "from-url", "from-mirror")
+	// --repair excludes each of these, which may be combined with each other
+	for _, name := range []string{"merge", "earliest", "resume", "from-url", "from-mirror", "countries", "countries-file", "source"} {
+		updateCmd.MarkFlagsMutuallyExclusive("repair", name)
+	}
+	// --lists excludes each of these, the current lists only going with a
+	// new snapshot of the current data
+	for _, name := range []string{"repair", "merge", "time", "earliest", "from-url", "from-mirror"} {
+		updateCmd.MarkFlagsMutuallyExclusive("lists", name)
+	}
 }
 
 func runUpdate(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
 
+	if asnDB {
+		if err := updateASNDB(ctx); err != nil {
+			return fmt.Errorf("update ASN database: %w", err)
+		}
+	}
+
+	if repair {
+		return runRepair(cmd, args)
+	}
+	if fromMirror {
+		return installFromURL(ctx, config.DefaultMirrorURL)
+	}
+	if fromURL != "" {
+		return installFromURL(ctx, fromURL)
+	}
+
 	// Validate concurrency
 	if concurrency < 1 {
 		concurrency = 1
@@ -57,95 +129,240 @@ func runUpdate(cmd *cobra.Command, args []string) error {
 		concurrency = config.MaxConcurrency
 	}
 
-	// Determine snapshot date
+	rawFmt, err := rawstore.ParseFormat(rawFormat)
+	if err != nil {
+		return err
+	}
+	if embedHolders != "" {
+		if _, err := embedHoldersMode(embedHolders); err != nil {
+			return err
+		}
+	}
+
+	if merge {
+		countryCodes, err := selectedCountries()
+		if err != nil {
+			return err
+		}
+		return runMerge(ctx, countryCodes, rawFmt)
+	}
+
+	fc, err := loadFileConfig()
+	if err != nil {
+		return err
+	}
+
+	// An unfinished update keeps its progress and options in the state
+	// directory; --resume continues it with those options
+	stateDir := config.UpdateStateDir(cacheDir)
+	var run *updateRun
+	if resume {
+		if run, err = loadUpdateRun(stateDir); err != nil {
+			return err
+		}
+		if timeFlag != "" && timeFlag != run.Date || earliest && !run.Earliest {
+			return fmt.Errorf("the unfinished update is for a different date; run it without --resume to start over")
+		}
+		earliest = run.Earliest
+		keepRaw, rawFmt = run.KeepRaw, rawstore.Format(run.RawFormat)
+		if run.Source != "" {
+			sourceName = run.Source
+		}
+		embedHolders = run.EmbedHolders
+	}
+
+	// Determine snapshot date; for --earliest it is only known once the
+	// earliest data of every country has been found, unless a baseline is
+	// being repaired
 	snapshotDate := timeFlag
-	if snapshotDate == "" {
+	queryTime := timeFlag
+	if earliest && timeFlag == "" {
+		queryTime = ripestat.EarliestQueryTime
+	} else if snapshotDate == "" {
 		snapshotDate = time.Now().Format("2006-01-02")
 	}
+	if run != nil {
+		// Resumed on a later day, the update still builds its own date
+		snapshotDate, queryTime = run.Date, run.QueryTime
+	}
+
+	if err := checkUpdateSource(queryTime, keepRaw); err != nil {
+		return err
+	}
 
-	// Check if snapshot already exists
+	// Check if snapshot already exists; a resumed update rebuilds it
 	mgr := snapshot.NewManager(cacheDir)
-	if !force && mgr.SnapshotExists(snapshotDate) {
+	if !earliest {
+		if err := checkNotBaseline(mgr, snapshotDate); err != nil {
+			return err
+		}
+	}
+	if !earliest && !force && !resume && mgr.SnapshotExists(snapshotDate) {
 		fmt.Printf("Snapshot for %s already exists. Use --force to rebuild.\n", snapshotDate)
 		return nil
 	}
 
 	// Get country list
 	var countryCodes []string
-	if countriesFile != "" {
-		content, err := os.ReadFile(countriesFile)
-		if err != nil {
-			return fmt.Errorf("read countries file: %w", err)
+	if run != nil {
+		countryCodes = run.Countries
+	} else if countryCodes, err = selectedCountries(); err != nil {
+		return err
+	} else if countryCodes == nil {
+		countryCodes = countries.AllCodesLower()
+	}
+
+	if run == nil {
+		run = &updateRun{
+			Date:      snapshotDate,
+			QueryTime: queryTime,
+			Earliest:  earliest,
+			Countries: countryCodes,
+			KeepRaw:   keepRaw,
+			RawFormat: string(rawFmt),
+			Source:    sourceName,
+
+			EmbedHolders:  embedHolders,
+			EarliestTimes: baselineTimes,
 		}
-		countryCodes, err = countries.LoadFromFile(string(content))
-		if err != nil {
-			return fmt.Errorf("parse countries file: %w", err)
+		if err := startUpdateRun(stateDir, run); err != nil {
+			return err
+		}
+	}
+	checkpoint := &source.Checkpoint{Dir: filepath.Join(stateDir, "countries")}
+
+	// A baseline is built at the first date all countries have data, so
+	// that it holds the data of a single date like an update --time
+	if earliest {
+		if run.Date == "" {
+			if err := findBaselineDate(ctx, fc, stateDir, run); err != nil {
+				return err
+			}
+			if !force && mgr.SnapshotExists(run.Date) {
+				fmt.Printf("Snapshot for %s already exists. Use --force to rebuild.\n", run.Date)
+				return os.RemoveAll(stateDir)
+			}
 		}
+		snapshotDate, queryTime = run.Date, run.QueryTime
+		fmt.Printf("Building baseline snapshot for %s with %d countries...\n", snapshotDate, len(countryCodes))
 	} else {
-		countryCodes = countries.AllCodesLower()
+		fmt.Printf("Building snapshot for %s with %d countries...\n", snapshotDate, len(countryCodes))
+	}
+	if resume {
+		fmt.Printf("Resuming: %d countries were downloaded before\n", checkpoint.Saved())
 	}
 
-	fmt.Printf("Building snapshot for %s with %d countries...\n", snapshotDate, len(countryCodes))
-
-	// Create snapshot directory
-	snapshotDir, err := mgr.CreateSnapshot(snapshotDate)
-	if err != nil {
-		return fmt.Errorf("create snapshot: %w", err)
+	// Countries unchanged since the latest snapshot are reused from it;
+	// only current RIPEstat data can be compared, and --force refetches
+	// everything
+	var prev *previousLists
+	if queryTime == "" && !force && sourceName == "ripestat" {
+		prev = loadPreviousLists(mgr)
 	}
 
-	// Create raw directory if needed
+	// Raw responses are written to disk as they download, and kept with
+	// the update state until the snapshot is complete
+	var stage *rawstore.Stage
 	if keepRaw {
-		if err := config.EnsureDir(config.RawDir(snapshotDir)); err != nil {
-			return fmt.Errorf("create raw dir: %w", err)
+		stage, err = rawstore.OpenStage(filepath.Join(stateDir, "raw"), rawFmt)
+		if err != nil {
+			return fmt.Errorf("create raw staging dir: %w", err)
 		}
 	}
 
-	// Download country resources
-	client := ripestat.NewClient()
-	results := make([]*ripestat.CountryResourceListResult, len(countryCodes))
-	var mu sync.Mutex
-	var completed int64
-	var errors []string
+	src := newUpdateSource(fc, queryTime, stage, prev)
+	checkpoint.Source = src
 
-	sem := make(chan struct{}, concurrency)
-	var wg sync.WaitGroup
+	// The lists of every country are kept with the snapshot, so that the
+	// next update can reuse them as the source listed them
+	listsPath := filepath.Join(stateDir, config.CountryListsFileName)
+	countryLists, err := snapshot.CreateCountryLists(listsPath)
+	if err != nil {
+		return fmt.Errorf("create country lists: %w", err)
+	}
+	defer countryLists.Abort()
+	var listsErr error
+
+	// Download country resources; each country's prefixes go into the tries
+	// as it arrives, so its response can be released right away
+	v4Builder, v6Builder := index.NewBuilder(false), index.NewBuilder(true)
+	inserted := make(chan countryCount)
+	pending := make(chan *source.Result, config.MaxConcurrency)
+	var insertWG sync.WaitGroup
+	for w := 0; w < runtime.GOMAXPROCS(0); w++ {
+		insertWG.Add(1)
+		go func() {
+			defer insertWG.Done()
+			for result := range pending {
+				inserted <- insertCountry(v4Builder, v6Builder, result)
+			}
+		}()
+	}
+	counts := make(chan map[string]countryCount)
+	go func() {
+		m := make(map[string]countryCount, len(countryCodes))
+		for c := range inserted {
+			m[c.countryCode] = c
+		}
+		counts <- m
+	}()
+
+	queryTimes := make(map[string]string, len(countryCodes))
+	reused := make(map[string]bool)
+	var errors []string
+	var failed []string
+	stats := make(map[string]snapshot.CountryStats, len(countryCodes))
 
 	startTime := time.Now()
 
-	for i, cc := range countryCodes {
-		wg.Add(1)
-		go func(idx int, countryCode string) {
-			defer wg.Done()
-			sem <- struct{}{}
-			defer func() { <-sem }()
-
-			result, err := client.GetCountryResourceList(ctx, countryCode, timeFlag)
-
-			mu.Lock()
-			if err != nil {
-				errors = append(errors, fmt.Sprintf("%s: %v", countryCode, err))
-			} else {
-				results[idx] = result
-
-				// Save raw JSON if requested
-				if keepRaw {
-					rawPath := filepath.Join(config.RawDir(snapshotDir), countryCode+".json")
-					os.WriteFile(rawPath, result.RawJSON, 0644)
-				}
+	// Stop downloading on Ctrl-C; finished countries are kept for --resume
+	loadCtx, stopLoad := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stopLoad()
+	err = checkpoint.Load(loadCtx, countryCodes, func(result *source.Result) {
+		if result.Err != nil {
+			errors = append(errors, fmt.Sprintf("%s: %v", strings.ToLower(result.CountryCode), result.Err))
+			failed = append(failed, strings.ToLower(result.CountryCode))
+			stats[result.CountryCode] = snapshot.CountryStats{Error: result.Err.Error()}
+		} else {
+			queryTimes[result.CountryCode] = result.QueryTime
+			if listsErr == nil {
+				listsErr = countryLists.Write(snapshot.CountryList{CountryCode: result.CountryCode, IPv4: result.IPv4, IPv6: result.IPv6})
 			}
-
-			count := atomic.AddInt64(&completed, 1)
-			mu.Unlock()
-
-			// Progress update
-			if count%10 == 0 || count == int64(len(countryCodes)) {
-				fmt.Printf("\rDownloading: %d/%d countries...", count, len(countryCodes))
+			pending <- result
+			s := snapshot.CountryStats{ETag: result.ETag, LastModified: result.LastModified}
+			if earliest {
+				s.QueryTime = run.EarliestTimes[result.CountryCode]
 			}
-		}(i, cc)
-	}
+			stats[result.CountryCode] = s
+			if result.Reused {
+				reused[result.CountryCode] = true
+			}
+		}
 
-	wg.Wait()
+		// Progress update
+		count := len(stats)
+		if count%10 == 0 || count == len(countryCodes) {
+			fmt.Printf("\rDownloading: %d/%d countries...", count, len(countryCodes))
+		}
+	})
 	fmt.Println()
+	stopLoad()
+	close(pending)
+	insertWG.Wait()
+	close(inserted)
+	prefixCounts := <-counts
+	if err != nil {
+		return fmt.Errorf("load countries: %w (run 'ip2cc update --resume' to continue)", err)
+	}
+	if listsErr == nil {
+		listsErr = countryLists.Close()
+	}
+	if listsErr != nil {
+		return fmt.Errorf("write country lists: %w", listsErr)
+	}
+	if len(reused) > 0 && prev != nil {
+		fmt.Printf("Reused %d unchanged countries from snapshot %s\n", len(reused), prev.date)
+	}
 
 	if len(errors) > 0 {
 		fmt.Printf("Warning: %d countries had errors:\n", len(errors))
@@ -157,36 +374,58 @@ func runUpdate(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// Build indices
-	fmt.Print("Building IPv4 index...")
-	v4Trie := index.NewTrie(false)
-	v4Count := 0
-	for _, result := range results {
-		if result == nil {
-			continue
+	var lists iplist.Lists
+	if withLists {
+		if lists, err = downloadLists(ctx, fc); err != nil {
+			return err
 		}
-		for _, prefix := range result.IPv4 {
-			if err := v4Trie.InsertCIDR(prefix, result.CountryCode); err == nil {
-				v4Count++
+	}
+
+	// Downloads run unlocked; writing the snapshot and moving latest do not
+	l, err := lockCache(true)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+	if !force && !resume && mgr.SnapshotExists(snapshotDate) {
+		fmt.Printf("Snapshot for %s was created by another update. Use --force to rebuild.\n", snapshotDate)
+		return nil
+	}
+
+	// Create snapshot directory
+	snapshotDir, err := mgr.CreateSnapshot(snapshotDate)
+	if err != nil {
+		return fmt.Errorf("create snapshot: %w", err)
+	}
+
+	// Save raw JSON if requested
+	if stage != nil {
+		if len(reused) > 0 && prev != nil {
+			if err := prev.stageRaw(stage, reused); err != nil {
+				return fmt.Errorf("copy raw data from %s: %w", prev.date, err)
 			}
 		}
+		if err := stage.Commit(snapshotDir); err != nil {
+			return fmt.Errorf("save raw data: %w", err)
+		}
 	}
-	fmt.Printf(" %d prefixes\n", v4Count)
 
-	fmt.Print("Building IPv6 index...")
-	v6Trie := index.NewTrie(true)
-	v6Count := 0
-	for _, result := range results {
-		if result == nil {
-			continue
-		}
-		for _, prefix := range result.IPv6 {
-			if err := v6Trie.InsertCIDR(prefix, result.CountryCode); err == nil {
-				v6Count++
-			}
+	// Finish the indices from the shards filled during download
+	fmt.Print("Building indices...")
+	for cc, c := range prefixCounts {
+		s := stats[cc]
+		s.PrefixesV4, s.PrefixesV6 = c.v4, c.v6
+		stats[cc] = s
+	}
+	v4Trie, v6Trie := v4Builder.Trie(), v6Builder.Trie()
+	v4Count, v6Count := v4Trie.Count, v6Trie.Count
+	fmt.Printf(" %d IPv4 / %d IPv6 prefixes\n", v4Count, v6Count)
+
+	if embedHolders != "" {
+		if err := embedProviderHolders(ctx, embedHolders, v4Trie, v6Trie); err != nil {
+			return fmt.Errorf("embed holders: %w", err)
 		}
 	}
-	fmt.Printf(" %d prefixes\n", v6Count)
 
 	// Save indices
 	fmt.Print("Saving indices...")
@@ -199,12 +438,24 @@ func runUpdate(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("save indices: %w", err)
 	}
 	fmt.Println(" done")
+	if err := saveConflicts(snapshotDir, v4Trie, v6Trie, append(v4Builder.Duplicates(), v6Builder.Duplicates()...)); err != nil {
+		return err
+	}
+	if err := os.Rename(listsPath, config.CountryListsPath(snapshotDir)); err != nil {
+		return fmt.Errorf("save country lists: %w", err)
+	}
+	if lists != nil {
+		if err := lists.Save(config.ListsDir(snapshotDir)); err != nil {
+			return fmt.Errorf("save lists: %w", err)
+		}
+	}
 
 	// Determine actual query time from results
 	actualQueryTime := snapshotDate
-	for _, result := range results {
-		if result != nil && result.QueryTime != "" {
-			actualQueryTime = result.QueryTime
+	for _, cc := range countryCodes {
+		qt := queryTimes[strings.ToUpper(cc)]
+		if qt != "" {
+			actualQueryTime = qt
 			break
 		}
 	}
@@ -215,17 +466,27 @@ func runUpdate(cmd *cobra.Command, args []string) error {
 	meta.ActualQueryTime = actualQueryTime
 	meta.CountriesCount = len(countryCodes)
 	meta.Countries = countryCodes
+	sort.Strings(failed)
+	meta.FailedCountries = failed
 	meta.PrefixesV4 = v4Count
 	meta.PrefixesV6 = v6Count
-	meta.IsLatest = true
+	meta.CountryStats = stats
+	meta.IsLatest = !earliest
+	meta.Baseline = earliest
+	meta.Source = src.Name()
+	meta.Changelog = buildChangelog(mgr, snapshotDate, v4Trie, v6Trie)
+	meta.Holders = embedHolders
 
 	if err := meta.Save(config.MetadataPath(snapshotDir)); err != nil {
 		return fmt.Errorf("save metadata: %w", err)
 	}
 
-	// Update latest symlink
-	if err := mgr.SetLatest(snapshotDate); err != nil {
-		fmt.Printf("Warning: could not update latest symlink: %v\n", err)
+	// Update latest symlink; a historical baseline never becomes latest,
+	// nor does a repaired snapshot that was not latest before
+	if !earliest && !keepLatest {
+		if err := mgr.SetLatest(snapshotDate); err != nil {
+			fmt.Printf("Warning: could not update latest symlink: %v\n", err)
+		}
 	}
 
 	elapsed := time.Since(startTime)
@@ -235,9 +496,227 @@ func runUpdate(cmd *cobra.Command, args []string) error {
 	fmt.Printf("  IPv6 prefixes: %d\n", v6Count)
 	fmt.Printf("  Location: %s\n", snapshotDir)
 
+	// Keep the downloaded countries while some are missing
+	if len(failed) > 0 {
+		fmt.Printf("\nRun 'ip2cc update --resume' to retry the %d failed countries.\n", len(failed))
+	} else if err := os.RemoveAll(stateDir); err != nil {
+		fmt.Printf("Warning: could not remove update state: %v\n", err)
+	}
+
 	return nil
 }
 
+// findBaselineDate loads the earliest data of every country of run and
+// sets the run's date and query time to the first date all of them have
+// data, the latest of their earliest times. The data itself is dropped: the
+// baseline is then loaded as of that date, so that it does not mix data
+// from different dates.
+func findBaselineDate(ctx context.Context, fc *config.FileConfig, stateDir string, run *updateRun) error {
+	fmt.Printf("Finding the earliest data of %d countries...\n", len(run.Countries))
+	checkpoint := &source.Checkpoint{
+		Source: newUpdateSource(fc, ripestat.EarliestQueryTime, nil, nil),
+		Dir:    filepath.Join(stateDir, "earliest"),
+	}
+	times := make(map[string]string, len(run.Countries))
+	var failed []string
+	done := 0
+
+	loadCtx, stopLoad := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stopLoad()
+	err := checkpoint.Load(loadCtx, run.Countries, func(result *source.Result) {
+		if result.Err != nil {
+			failed = append(failed, strings.ToLower(result.CountryCode))
+		} else {
+			times[result.CountryCode] = result.QueryTime
+		}
+		done++
+		if done%10 == 0 || done == len(run.Countries) {
+			fmt.Printf("\rFinding earliest data: %d/%d countries...", done, len(run.Countries))
+		}
+	})
+	fmt.Println()
+	if err != nil {
+		return fmt.Errorf("find earliest data: %w (run 'ip2cc update --resume' to continue)", err)
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		fmt.Printf("Warning: the earliest data of %d countries could not be found: %s\n", len(failed), strings.Join(failed, ", "))
+	}
+
+	var date, lastCC, firstDate, firstCC string
+	for cc, qt := range times {
+		d := queryDate(qt)
+		if d > date || d == date && cc < lastCC {
+			date, lastCC = d, cc
+		}
+		if firstDate == "" || d < firstDate || d == firstDate && cc < firstCC {
+			firstDate, firstCC = d, cc
+		}
+	}
+	if date == "" {
+		return fmt.Errorf("no country data downloaded")
+	}
+	fmt.Printf("Earliest data per country: from %s (%s) to %s (%s)\n", firstDate, firstCC, date, lastCC)
+
+	run.Date, run.QueryTime, run.EarliestTimes = date, date, times
+	if err := saveJSON(updateRunPath(stateDir), run); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(checkpoint.Dir); err != nil {
+		fmt.Printf("Warning: could not remove update state: %v\n", err)
+	}
+	return nil
+}
+
+// checkNotBaseline refuses to build a snapshot for date over the baseline
+// built with --earliest for that date, which would lose its marking.
+func checkNotBaseline(mgr *snapshot.Manager, date string) error {
+	if !mgr.SnapshotExists(date) {
+		return nil
+	}
+	if _, meta, err := mgr.GetSnapshotByDate(date); err == nil && meta.Baseline {
+		return fmt.Errorf("snapshot %s is the baseline built with --earliest; rebuild it with 'ip2cc update --earliest --force'", date)
+	}
+	return nil
+}
+
+// checkUpdateSource validates --source against the other options, before
+// anything is downloaded.
+func checkUpdateSource(queryTime string, withRaw bool) error {
+	switch sourceName {
+	case "ripestat":
+		return nil
+	case "rir":
+		// The files are only published for the current day
+		if queryTime != "" {
+			return fmt.Errorf("--source rir only provides current data")
+		}
+		if withRaw {
+			return fmt.Errorf("--keep-raw is not supported with --source rir")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown source: %s (use ripestat or rir)", sourceName)
+	}
+}
+
+// newUpdateSource returns the --source data source. raw and prev are
+// optional.
+func newUpdateSource(fc *config.FileConfig, queryTime string, raw *rawstore.Stage, prev *previousLists) source.DataSource {
+	if sourceName == "rir" {
+		return &source.Delegated{URLs: fc.RIRURLs}
+	}
+	src := &source.RIPEstat{
+		Client:      ripestat.NewClient(ripestat.WithBaseURL(ripestatBaseURL(fc))),
+		QueryTime:   queryTime,
+		Concurrency: concurrency,
+		Raw:         raw,
+	}
+	if prev != nil {
+		src.Previous = prev
+	}
+	return src
+}
+
+// selectedCountries returns the countries given with --countries or
+// --countries-file, or nil if neither was.
+func selectedCountries() ([]string, error) {
+	if len(countryList) > 0 {
+		return countries.LoadFromFile(strings.Join(countryList, "\n"))
+	}
+	if countriesFile == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(countriesFile)
+	if err != nil {
+		return nil, fmt.Errorf("read countries file: %w", err)
+	}
+	countryCodes, err := countries.LoadFromFile(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("parse countries file: %w", err)
+	}
+	if countryCodes == nil {
+		countryCodes = []string{}
+	}
+	return countryCodes, nil
+}
+
+// updateASNDB downloads the ip-to-ASN table and rebuilds the offline ASN database.
+func updateASNDB(ctx context.Context) error {
+	fmt.Printf("Downloading ASN database from %s...\n", asnDBURL)
+	db, err := asndb.Download(ctx, asnDBURL)
+	if err != nil {
+		return err
+	}
+
+	l, err := lockCache(true)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+
+	if err := db.Save(config.ASNDBDir(cacheDir)); err != nil {
+		return err
+	}
+	fmt.Printf("ASN database: %d IPv4 / %d IPv6 prefixes, %d ASNs\n", db.V4.Count, db.V6.Count, len(db.Holders))
+	return nil
+}
+
+// downloadLists downloads the Tor exit list and the hosting lists, from
+// the configuration file or else the defaults.
+func downloadLists(ctx context.Context, fc *config.FileConfig) (iplist.Lists, error) {
+	urls := map[string][]string{
+		iplist.TorExit: {iplist.DefaultTorExitURL},
+		iplist.Hosting: {iplist.DefaultHostingURL},
+	}
+	if fc.TorExitListURL != "" {
+		urls[iplist.TorExit] = []string{fc.TorExitListURL}
+	}
+	if len(fc.HostingLists) > 0 {
+		urls[iplist.Hosting] = fc.HostingLists
+	}
+
+	var lists iplist.Lists
+	for _, name := range iplist.Names {
+		fmt.Printf("Downloading %s list...", name)
+		l, err := iplist.Download(ctx, name, urls[name])
+		if err != nil {
+			fmt.Println()
+			return nil, err
+		}
+		fmt.Printf(" %d prefixes\n", l.Count())
+		lists = append(lists, l)
+	}
+	return lists, nil
+}
+
+// buildChangelog diffs the new tries against the previous snapshot, if any.
+func buildChangelog(mgr *snapshot.Manager, date string, v4Trie, v6Trie *index.Trie) *snapshot.Changelog {
+	previous, ok := mgr.PreviousSnapshot(date)
+	if !ok {
+		return nil
+	}
+
+	dir := mgr.GetSnapshotDir(previous)
+	oldV4, oldV6, err := index.LoadIndex(config.IndexV4Path(dir), config.IndexV6Path(dir))
+	if err != nil {
+		fmt.Printf("Warning: could not load previous snapshot %s for changelog: %v\n", previous, err)
+		return nil
+	}
+
+	cl := snapshot.ComputeChangelog(previous, oldV4, oldV6, v4Trie, v6Trie)
+	fmt.Printf("Changes since %s: +%d / -%d prefixes in %d countries\n", previous, cl.Added, cl.Removed, len(cl.Countries))
+	return cl
+}
+
+// queryDate returns the YYYY-MM-DD part of a RIPEstat query time.
+func queryDate(queryTime string) string {
+	if len(queryTime) < 10 {
+		return queryTime
+	}
+	return queryTime[:10]
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -253,3 +732,54 @@ func saveJSON(path string, data interface{}) error {
 	}
 	return os.WriteFile(path, content, 0644)
 }
+
+// countryCount counts the prefixes of a country inserted into the tries.
+type countryCount struct {
+	countryCode string
+	v4, v6      int
+}
+
+// insertCountry adds the prefixes of result to the builders.
+func insertCountry(v4, v6 *index.Builder, result *source.Result) countryCount {
+	c := countryCount{countryCode: result.CountryCode}
+	for _, cidr := range result.IPv4 {
+		if prefix, data, err := parseSourceCIDR(result, cidr); err == nil && v4.Add(prefix, data) == nil {
+			c.v4++
+		}
+	}
+	for _, cidr := range result.IPv6 {
+		if prefix, data, err := parseSourceCIDR(result, cidr); err == nil && v6.Add(prefix, data) == nil {
+			c.v6++
+		}
+	}
+	return c
+}
+
+// saveConflicts writes the report of conflicting prefixes in freshly built
+// tries into the snapshot in dir. duplicates are those seen by the
+// builders of the tries.
+func saveConflicts(dir string, v4Trie, v6Trie *index.Trie, duplicates []index.Duplicate) error {
+	conflicts := snapshot.ComputeConflicts(v4Trie, v6Trie, duplicates)
+	if err := conflicts.Save(config.ConflictsPath(dir)); err != nil {
+		return fmt.Errorf("save conflicts report: %w", err)
+	}
+	if len(conflicts.Nested) > 0 || len(conflicts.Duplicates) > 0 {
+		fmt.Printf("Conflicts: %d prefixes nested in another country, %d listed under several countries (see %s)\n",
+			len(conflicts.Nested), len(conflicts.Duplicates), config.ConflictsFileName)
+	}
+	return nil
+}
+
+// parseSourceCIDR parses a prefix of result with what the source knows
+// about it.
+func parseSourceCIDR(result *source.Result, cidr string) (netip.Prefix, index.PrefixData, error) {
+	prefix, data, err := index.ParseCIDR(cidr, result.CountryCode)
+	if err != nil {
+		return prefix, data, err
+	}
+	if info, ok := result.Info[cidr]; ok {
+		data.RIR = index.ParseRIR(info.RIR)
+		data.Allocated = index.ParseAllocated(info.Allocated)
+	}
+	return prefix, data, nil
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"runtime"
 
+	"github.com/hightemp/ip2cc/internal/output"
+
 	"github.com/spf13/cobra"
 )
 
@@ -14,6 +16,7 @@ var versionCmd = &cobra.Command{
 		fmt.Printf("ip2cc %s\n", Version)
 		fmt.Printf("  Commit:     %s\n", Commit)
 		fmt.Printf("  Built:      %s\n", BuildTime)
+		fmt.Printf("  Schema:     v%d\n", output.SchemaVersion)
 		fmt.Printf("  Go version: %s\n", runtime.Version())
 		fmt.Printf("  OS/Arch:    %s/%s\n", runtime.GOOS, runtime.GOARCH)
 	},
@@ -2,15 +2,23 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
 	// AppName is the application name.
 	AppName = "ip2cc"
 
+	// ConfigFileName is the user configuration file name.
+	ConfigFileName = "config.json"
+
 	// CacheDirName is the cache directory name.
 	CacheDirName = ".ip2cc"
 
@@ -29,12 +37,45 @@ const (
 	// IndexV6FileName is the IPv6 index file name.
 	IndexV6FileName = "index_v6.bin"
 
+	// ConflictsFileName is the report of conflicting prefixes found while
+	// building a snapshot.
+	ConflictsFileName = "conflicts.json"
+
+	// CountryListsFileName holds the prefixes each country was listed
+	// with, for reusing unchanged countries in the next update.
+	CountryListsFileName = "country_lists.jsonl.gz"
+
+	// ListsDirName is the directory of the address lists of a snapshot.
+	ListsDirName = "lists"
+
 	// RawDirName is the raw data directory name.
 	RawDirName = "raw"
 
+	// RawArchiveFileName is the raw data archive name (tar.zst raw format).
+	RawArchiveFileName = "raw.tar.zst"
+
+	// LockFileName is the cache directory lock file name.
+	LockFileName = ".lock"
+
+	// ASNDBDirName is the offline ASN database directory name.
+	ASNDBDirName = "asndb"
+
 	// ProviderCacheFileName is the provider cache file name.
 	ProviderCacheFileName = "provider_cache.json"
 
+	// ResultCacheFileName is the file of lookup results kept across runs.
+	ResultCacheFileName = "result_cache.json"
+
+	// GeofeedDirName is the geofeed overlay directory name.
+	GeofeedDirName = "geofeed"
+
+	// UpdateStateDirName is the directory holding the progress of an
+	// unfinished update.
+	UpdateStateDirName = "update-state"
+
+	// SocketFileName is the default Unix socket name of the lookup daemon.
+	SocketFileName = "ip2cc.sock"
+
 	// DefaultConcurrency is the default download concurrency.
 	DefaultConcurrency = 8
 
@@ -47,11 +88,17 @@ const (
 	// DefaultProviderLookupConcurrency is the concurrency for provider lookups.
 	DefaultProviderLookupConcurrency = 4
 
+	// MaxLookupConcurrency is the maximum concurrency for batch and provider lookups.
+	MaxLookupConcurrency = 32
+
 	// RIPEstatSourceApp is the sourceapp parameter for RIPEstat API.
 	RIPEstatSourceApp = "ip2cc"
 
+	// DefaultMirrorURL is the official location of the latest prebuilt snapshot archive.
+	DefaultMirrorURL = "https://github.com/hightemp/ip2cc/releases/download/data/latest.tar.zst"
+
 	// IndexFormatVersion is the current index format version.
-	IndexFormatVersion uint32 = 1
+	IndexFormatVersion uint32 = 3
 )
 
 // Config holds runtime configuration.
@@ -73,6 +120,126 @@ func DefaultConfig() *Config {
 	}
 }
 
+// FileConfig holds settings read from the user configuration file.
+type FileConfig struct {
+	// TrustedKeys are minisign public keys accepted for snapshot archives.
+	// When set, archives installed with update --from-url must be signed.
+	TrustedKeys []string `json:"trusted_keys,omitempty"`
+
+	// ProviderCacheTTL is the provider cache lifetime, e.g. "7d" or "36h".
+	ProviderCacheTTL string `json:"provider_cache_ttl,omitempty"`
+
+	// ProviderCachePath overrides the provider cache file location.
+	ProviderCachePath string `json:"provider_cache_path,omitempty"`
+
+	// RIPEstatURL overrides the RIPEstat Data API base URL, e.g. to use a
+	// caching proxy or an internal mirror.
+	RIPEstatURL string `json:"ripestat_url,omitempty"`
+
+	// RIRURLs override the delegated-extended statistics files read by
+	// update --source rir, e.g. to use a local mirror.
+	RIRURLs []string `json:"rir_urls,omitempty"`
+
+	// Geofeeds are URLs of geolocation feeds (RFC 8805) fetched by
+	// 'ip2cc geofeed update' and laid over the RIR data.
+	Geofeeds []string `json:"geofeeds,omitempty"`
+
+	// Groups defines country groups by name, e.g. {"nordics": ["DK", "FI"]},
+	// in addition to the built-in eu, eea, and schengen groups.
+	Groups map[string][]string `json:"groups,omitempty"`
+
+	// Enrichers are plugin processes that add fields to lookup results.
+	Enrichers []EnricherConfig `json:"enrichers,omitempty"`
+
+	// NAT64Prefixes are the prefixes of the NAT64 translators in use, e.g.
+	// ["64:ff9b:1::/48"]. The default is the well-known 64:ff9b::/96.
+	NAT64Prefixes []string `json:"nat64_prefixes,omitempty"`
+
+	// OverridesFile is a CSV file of prefix, country and optional provider
+	// that take precedence over the registry data in lookups.
+	OverridesFile string `json:"overrides_file,omitempty"`
+
+	// Tags maps tag names to files of prefixes, one address or CIDR per
+	// line; lookups report the tags whose lists contain the address.
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// AnycastPrefixes are marked as anycast in lookup results, in addition
+	// to the built-in well-known anycast prefixes.
+	AnycastPrefixes []string `json:"anycast_prefixes,omitempty"`
+
+	// TorExitListURL replaces the Tor Project's exit list downloaded by
+	// update --lists.
+	TorExitListURL string `json:"tor_exit_list_url,omitempty"`
+
+	// HostingLists are the datacenter, hosting and VPN prefix lists
+	// downloaded by update --lists, replacing the default list.
+	HostingLists []string `json:"hosting_lists,omitempty"`
+
+	// APIKeys are the keys HTTP clients of 'ip2cc serve' must send, as a
+	// bearer token or in the X-API-Key header. Without keys the server
+	// answers everyone.
+	APIKeys []string `json:"api_keys,omitempty"`
+
+	// RateLimit is the number of requests per second 'ip2cc serve' allows
+	// each client, identified by API key or else by address; 0 disables
+	// rate limiting.
+	RateLimit float64 `json:"rate_limit,omitempty"`
+
+	// RateBurst is the number of requests a client may make at once
+	// (default: RateLimit rounded up).
+	RateBurst int `json:"rate_burst,omitempty"`
+}
+
+// EnricherConfig configures an enrichment plugin process.
+type EnricherConfig struct {
+	// Name identifies the plugin (default: the executable's base name).
+	Name string `json:"name,omitempty"`
+	// Command is the executable and its arguments.
+	Command []string `json:"command"`
+}
+
+// ParseTTL parses a duration, additionally accepting whole days ("7d").
+func ParseTTL(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid TTL: %s", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid TTL: %s", s)
+	}
+	return d, nil
+}
+
+// DefaultConfigPath returns the default configuration file path.
+func DefaultConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "."
+	}
+	return filepath.Join(home, CacheDirName, ConfigFileName)
+}
+
+// LoadFileConfig reads the configuration file. A missing file yields an
+// empty configuration.
+func LoadFileConfig(path string) (*FileConfig, error) {
+	var fc FileConfig
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &fc, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &fc); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &fc, nil
+}
+
 // DefaultCacheDir returns the default cache directory path.
 func DefaultCacheDir() string {
 	home, err := os.UserHomeDir()
@@ -113,16 +280,67 @@ func IndexV6Path(snapshotDir string) string {
 	return filepath.Join(snapshotDir, IndexV6FileName)
 }
 
+// ConflictsPath returns the conflicts report path for a snapshot.
+func ConflictsPath(snapshotDir string) string {
+	return filepath.Join(snapshotDir, ConflictsFileName)
+}
+
+// CountryListsPath returns the country lists path for a snapshot.
+func CountryListsPath(snapshotDir string) string {
+	return filepath.Join(snapshotDir, CountryListsFileName)
+}
+
 // RawDir returns the raw data directory path for a snapshot.
 func RawDir(snapshotDir string) string {
 	return filepath.Join(snapshotDir, RawDirName)
 }
 
+// ListsDir returns the address lists directory of a snapshot.
+func ListsDir(snapshotDir string) string {
+	return filepath.Join(snapshotDir, ListsDirName)
+}
+
+// RawArchivePath returns the raw data archive path for a snapshot.
+func RawArchivePath(snapshotDir string) string {
+	return filepath.Join(snapshotDir, RawArchiveFileName)
+}
+
+// LockPath returns the lock file path guarding the cache directory.
+func LockPath(cacheDir string) string {
+	return filepath.Join(cacheDir, LockFileName)
+}
+
+// GeofeedDir returns the geofeed overlay directory path.
+func GeofeedDir(cacheDir string) string {
+	return filepath.Join(cacheDir, GeofeedDirName)
+}
+
+// ASNDBDir returns the offline ASN database directory path.
+func ASNDBDir(cacheDir string) string {
+	return filepath.Join(cacheDir, ASNDBDirName)
+}
+
 // ProviderCachePath returns the provider cache file path.
 func ProviderCachePath(cacheDir string) string {
 	return filepath.Join(cacheDir, ProviderCacheFileName)
 }
 
+// ResultCachePath returns the result cache file path.
+func ResultCachePath(cacheDir string) string {
+	return filepath.Join(cacheDir, ResultCacheFileName)
+}
+
+// UpdateStateDir returns the directory holding the progress of an
+// unfinished update.
+func UpdateStateDir(cacheDir string) string {
+	return filepath.Join(cacheDir, UpdateStateDirName)
+}
+
+// SocketPath returns the default Unix socket path of the lookup daemon.
+func SocketPath(cacheDir string) string {
+	return filepath.Join(cacheDir, SocketFileName)
+}
+
 // EnsureDir creates a directory if it doesn't exist.
 func EnsureDir(dir string) error {
 	return os.MkdirAll(dir, 0755)
@@ -13,10 +13,58 @@ var iso3166Data string
 
 var (
 	codeToName map[string]string
+	codeToISO  map[string]iso
 	codes      []string
 	once       sync.Once
 )
 
+// iso holds the alpha-3 and numeric codes and the continent of a country.
+// The codes are empty for the non-ISO registry codes EU and AP.
+type iso struct {
+	alpha3    string
+	numeric   string
+	continent string
+}
+
+// Continent codes.
+const (
+	Africa       = "AF"
+	Antarctica   = "AN"
+	Asia         = "AS"
+	Europe       = "EU"
+	NorthAmerica = "NA"
+	Oceania      = "OC"
+	SouthAmerica = "SA"
+)
+
+// aliases maps codes found in registry data and common usage that are not
+// ISO-3166 alpha-2 to the ISO code.
+var aliases = map[string]string{
+	"UK": "GB", // United Kingdom
+	"EL": "GR", // Greece, as used by the EU
+}
+
+// Placeholder codes used by the RIRs for resources not assigned to a single
+// country. EU and AP are listed with the countries; ZZ is not.
+const (
+	PlaceholderEurope      = "EU"
+	PlaceholderAsiaPacific = "AP"
+	PlaceholderUnknown     = "ZZ"
+)
+
+// unknownName is the display name of codes that are not in the table.
+const unknownName = "Unknown"
+
+var continentNames = map[string]string{
+	Africa:       "Africa",
+	Antarctica:   "Antarctica",
+	Asia:         "Asia",
+	Europe:       "Europe",
+	NorthAmerica: "North America",
+	Oceania:      "Oceania",
+	SouthAmerica: "South America",
+}
+
 func init() {
 	loadData()
 }
@@ -24,6 +72,7 @@ func init() {
 func loadData() {
 	once.Do(func() {
 		codeToName = make(map[string]string)
+		codeToISO = make(map[string]iso)
 		codes = make([]string, 0, 256)
 
 		scanner := bufio.NewScanner(strings.NewReader(iso3166Data))
@@ -32,13 +81,19 @@ func loadData() {
 			if line == "" || strings.HasPrefix(line, "#") {
 				continue
 			}
-			parts := strings.SplitN(line, ",", 2)
-			if len(parts) != 2 {
+			// alpha-2,alpha-3,numeric,continent,name; names may contain commas
+			parts := strings.SplitN(line, ",", 5)
+			if len(parts) != 5 {
 				continue
 			}
 			code := strings.ToUpper(strings.TrimSpace(parts[0]))
-			name := strings.TrimSpace(parts[1])
+			name := strings.TrimSpace(parts[4])
 			codeToName[code] = name
+			codeToISO[code] = iso{
+				alpha3:    strings.TrimSpace(parts[1]),
+				numeric:   strings.TrimSpace(parts[2]),
+				continent: strings.TrimSpace(parts[3]),
+			}
 			codes = append(codes, code)
 		}
 	})
@@ -47,15 +102,71 @@ func loadData() {
 // GetName returns the country name for the given ISO-3166 alpha-2 code.
 // Returns empty string if not found.
 func GetName(code string) string {
-	return codeToName[strings.ToUpper(code)]
+	return codeToName[Normalize(code)]
 }
 
-// IsValid checks if the given code is a valid ISO-3166 alpha-2 code.
+// GetAlpha3 returns the ISO-3166 alpha-3 code for the given alpha-2 code.
+// Returns empty string if not found.
+func GetAlpha3(code string) string {
+	return codeToISO[Normalize(code)].alpha3
+}
+
+// GetNumeric returns the ISO-3166 numeric code (three digits, zero-padded)
+// for the given alpha-2 code. Returns empty string if not found.
+func GetNumeric(code string) string {
+	return codeToISO[Normalize(code)].numeric
+}
+
+// GetContinent returns the continent code (AF, AN, AS, EU, NA, OC or SA)
+// for the given alpha-2 code. Countries spanning two continents are
+// assigned one, following GeoNames. Returns empty string if not found.
+func GetContinent(code string) string {
+	return codeToISO[Normalize(code)].continent
+}
+
+// ContinentName returns the name of a continent code.
+// Returns empty string if not found.
+func ContinentName(continent string) string {
+	return continentNames[strings.ToUpper(continent)]
+}
+
+// IsValid checks if the given code is a valid ISO-3166 alpha-2 code or an
+// alias of one.
 func IsValid(code string) bool {
-	_, ok := codeToName[strings.ToUpper(code)]
+	_, ok := codeToName[Normalize(code)]
 	return ok
 }
 
+// Normalize returns code in upper case with aliases such as UK and EL
+// replaced by their ISO-3166 code. Other codes are returned unchanged.
+func Normalize(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if iso, ok := aliases[code]; ok {
+		return iso
+	}
+	return code
+}
+
+// IsPlaceholder reports whether code is an RIR placeholder (EU, AP, or ZZ)
+// rather than a country.
+func IsPlaceholder(code string) bool {
+	switch Normalize(code) {
+	case PlaceholderEurope, PlaceholderAsiaPacific, PlaceholderUnknown:
+		return true
+	}
+	return false
+}
+
+// DisplayName returns the name of code for output. Unlike GetName it never
+// returns an empty string: ZZ and codes missing from the table are shown
+// as unknown.
+func DisplayName(code string) string {
+	if name := GetName(code); name != "" {
+		return name
+	}
+	return unknownName
+}
+
 // AllCodes returns all ISO-3166 alpha-2 codes (uppercase).
 func AllCodes() []string {
 	result := make([]string, len(codes))
@@ -87,7 +198,7 @@ func LoadFromFile(content string) ([]string, error) {
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
-		code := strings.ToLower(line)
+		code := strings.ToLower(Normalize(line))
 		if len(code) == 2 {
 			result = append(result, code)
 		}
@@ -132,3 +132,98 @@ func TestLoadFromFileEmpty(t *testing.T) {
 		t.Errorf("Expected 0 codes, got %d", len(codes))
 	}
 }
+
+func TestGetAlpha3AndNumeric(t *testing.T) {
+	tests := []struct {
+		code    string
+		alpha3  string
+		numeric string
+	}{
+		{"US", "USA", "840"},
+		{"de", "DEU", "276"},
+		{"AF", "AFG", "004"},
+		{"BQ", "BES", "535"},
+		{"EU", "", ""},
+		{"XX", "", ""},
+	}
+
+	for _, tc := range tests {
+		if result := GetAlpha3(tc.code); result != tc.alpha3 {
+			t.Errorf("GetAlpha3(%q) = %q, expected %q", tc.code, result, tc.alpha3)
+		}
+		if result := GetNumeric(tc.code); result != tc.numeric {
+			t.Errorf("GetNumeric(%q) = %q, expected %q", tc.code, result, tc.numeric)
+		}
+	}
+}
+
+func TestGetContinent(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{"US", NorthAmerica},
+		{"br", SouthAmerica},
+		{"DE", Europe},
+		{"RU", Europe},
+		{"JP", Asia},
+		{"AU", Oceania},
+		{"ZA", Africa},
+		{"AQ", Antarctica},
+		{"EU", Europe},
+		{"AP", Asia},
+		{"XX", ""},
+	}
+
+	for _, tc := range tests {
+		if result := GetContinent(tc.code); result != tc.expected {
+			t.Errorf("GetContinent(%q) = %q, expected %q", tc.code, result, tc.expected)
+		}
+	}
+
+	for _, code := range AllCodes() {
+		if ContinentName(GetContinent(code)) == "" {
+			t.Errorf("No continent for %s", code)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		code        string
+		expected    string
+		placeholder bool
+		name        string
+	}{
+		{"uk", "GB", false, "United Kingdom"},
+		{"EL", "GR", false, "Greece"},
+		{" de ", "DE", false, "Germany"},
+		{"EU", "EU", true, "European Union"},
+		{"ap", "AP", true, "Asia-Pacific Region"},
+		{"ZZ", "ZZ", true, "Unknown"},
+		{"XX", "XX", false, "Unknown"},
+	}
+
+	for _, tc := range tests {
+		if result := Normalize(tc.code); result != tc.expected {
+			t.Errorf("Normalize(%q) = %q, expected %q", tc.code, result, tc.expected)
+		}
+		if result := IsPlaceholder(tc.code); result != tc.placeholder {
+			t.Errorf("IsPlaceholder(%q) = %v, expected %v", tc.code, result, tc.placeholder)
+		}
+		if result := DisplayName(tc.code); result != tc.name {
+			t.Errorf("DisplayName(%q) = %q, expected %q", tc.code, result, tc.name)
+		}
+	}
+
+	if !IsValid("UK") || GetAlpha3("UK") != "GBR" {
+		t.Error("Alias UK not resolved to GB")
+	}
+	codes, err := LoadFromFile("uk\nel\n")
+	if err != nil {
+		t.Fatalf("LoadFromFile failed: %v", err)
+	}
+	if len(codes) != 2 || codes[0] != "gb" || codes[1] != "gr" {
+		t.Errorf("LoadFromFile = %v, expected [gb gr]", codes)
+	}
+}
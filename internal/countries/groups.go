@@ -0,0 +1,111 @@
+package countries
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// builtinGroups are the country groups available without configuration.
+var builtinGroups = map[string][]string{
+	"eu": {
+		"AT", "BE", "BG", "CY", "CZ", "DE", "DK", "EE", "ES", "FI", "FR", "GR", "HR", "HU",
+		"IE", "IT", "LT", "LU", "LV", "MT", "NL", "PL", "PT", "RO", "SE", "SI", "SK",
+	},
+	"eea": {
+		"AT", "BE", "BG", "CY", "CZ", "DE", "DK", "EE", "ES", "FI", "FR", "GR", "HR", "HU",
+		"IE", "IT", "LT", "LU", "LV", "MT", "NL", "PL", "PT", "RO", "SE", "SI", "SK",
+		"IS", "LI", "NO",
+	},
+	"schengen": {
+		"AT", "BE", "BG", "CZ", "DE", "DK", "EE", "ES", "FI", "FR", "GR", "HR", "HU", "IT",
+		"LT", "LU", "LV", "MT", "NL", "PL", "PT", "RO", "SE", "SI", "SK",
+		"CH", "IS", "LI", "NO",
+	},
+}
+
+// Groups resolves the named country groups a country belongs to.
+type Groups struct {
+	members   map[string][]string
+	byCountry map[string][]string
+}
+
+// NewGroups creates the built-in groups (eu, eea, schengen) extended by
+// user-defined ones. Group names are case-insensitive; a user group replaces
+// a built-in group of the same name.
+func NewGroups(user map[string][]string) (*Groups, error) {
+	g := &Groups{
+		members:   make(map[string][]string),
+		byCountry: make(map[string][]string),
+	}
+	for name, codes := range builtinGroups {
+		g.members[name] = codes
+	}
+	for name, codes := range user {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			return nil, fmt.Errorf("group with empty name")
+		}
+		normalized := make([]string, len(codes))
+		for i, code := range codes {
+			code = Normalize(code)
+			if !IsValid(code) || IsPlaceholder(code) {
+				return nil, fmt.Errorf("group %s: unknown country code %q", name, code)
+			}
+			normalized[i] = code
+		}
+		g.members[name] = normalized
+	}
+
+	for name, codes := range g.members {
+		for _, code := range codes {
+			g.byCountry[code] = append(g.byCountry[code], name)
+		}
+	}
+	for _, names := range g.byCountry {
+		sort.Strings(names)
+	}
+	return g, nil
+}
+
+// Memberships returns the sorted names of the groups containing code.
+func (g *Groups) Memberships(code string) []string {
+	return g.byCountry[Normalize(code)]
+}
+
+// Common returns the sorted names of the groups containing all of codes,
+// never nil.
+func (g *Groups) Common(codes []string) []string {
+	common := []string{}
+	if len(codes) == 0 {
+		return common
+	}
+	for _, name := range g.Memberships(codes[0]) {
+		all := true
+		for _, code := range codes[1:] {
+			if !contains(g.Memberships(code), name) {
+				all = false
+				break
+			}
+		}
+		if all {
+			common = append(common, name)
+		}
+	}
+	return common
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Members returns the codes of the named group.
+func (g *Groups) Members(name string) ([]string, bool) {
+	codes, ok := g.members[strings.ToLower(name)]
+	return codes, ok
+}
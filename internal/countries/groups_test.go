@@ -0,0 +1,74 @@
+package countries
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGroups(t *testing.T) {
+	g, err := NewGroups(map[string][]string{
+		"Nordics": {"dk", "FI", "IS", "NO", "SE"},
+		"EU":      {"DE", "FR"},
+	})
+	if err != nil {
+		t.Fatalf("NewGroups failed: %v", err)
+	}
+
+	tests := []struct {
+		code     string
+		expected []string
+	}{
+		{"DE", []string{"eea", "eu", "schengen"}},
+		{"no", []string{"eea", "nordics", "schengen"}},
+		{"IE", []string{"eea"}},
+		{"CH", []string{"schengen"}},
+		{"US", nil},
+	}
+	for _, tc := range tests {
+		if result := g.Memberships(tc.code); !reflect.DeepEqual(result, tc.expected) {
+			t.Errorf("Memberships(%q) = %v, expected %v", tc.code, result, tc.expected)
+		}
+	}
+
+	if codes, ok := g.Members("eu"); !ok || len(codes) != 2 {
+		t.Errorf("Members(eu) = %v, %v, expected the user definition", codes, ok)
+	}
+	if _, err := NewGroups(map[string][]string{"bad": {"XX"}}); err == nil {
+		t.Error("NewGroups accepted an unknown country code")
+	}
+}
+
+func TestBuiltinGroupsValid(t *testing.T) {
+	for name, codes := range builtinGroups {
+		for _, code := range codes {
+			if !IsValid(code) {
+				t.Errorf("Group %s: invalid code %s", name, code)
+			}
+		}
+	}
+	if len(builtinGroups["eu"]) != 27 {
+		t.Errorf("EU has %d members, expected 27", len(builtinGroups["eu"]))
+	}
+}
+
+func TestGroupsCommon(t *testing.T) {
+	g, err := NewGroups(nil)
+	if err != nil {
+		t.Fatalf("NewGroups failed: %v", err)
+	}
+
+	tests := []struct {
+		codes    []string
+		expected []string
+	}{
+		{[]string{"DE", "FR"}, []string{"eea", "eu", "schengen"}},
+		{[]string{"DE", "CH"}, []string{"schengen"}},
+		{[]string{"DE", "US"}, []string{}},
+		{nil, []string{}},
+	}
+	for _, tc := range tests {
+		if result := g.Common(tc.codes); !reflect.DeepEqual(result, tc.expected) {
+			t.Errorf("Common(%v) = %v, expected %v", tc.codes, result, tc.expected)
+		}
+	}
+}
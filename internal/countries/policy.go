@@ -0,0 +1,57 @@
+package countries
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Policy decides whether countries are allowed, given either the allowed
+// or the denied countries.
+type Policy struct {
+	codes map[string]bool
+	deny  bool
+}
+
+// NewPolicy creates a policy allowing the listed countries, or with deny
+// set, allowing all but them. Entries are country codes or names of groups
+// in g, which may be nil.
+func NewPolicy(list []string, deny bool, g *Groups) (*Policy, error) {
+	p := &Policy{codes: make(map[string]bool), deny: deny}
+	for _, entry := range list {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if g != nil {
+			if members, ok := g.Members(entry); ok {
+				for _, cc := range members {
+					p.codes[Normalize(cc)] = true
+				}
+				continue
+			}
+		}
+		cc := Normalize(entry)
+		if !IsValid(cc) {
+			return nil, fmt.Errorf("invalid country code or group: %s", entry)
+		}
+		p.codes[cc] = true
+	}
+	if len(p.codes) == 0 {
+		return nil, fmt.Errorf("no countries given")
+	}
+	return p, nil
+}
+
+// Allows reports whether all of codes are allowed. An address of unknown
+// country has no codes; it is allowed only by a deny policy.
+func (p *Policy) Allows(codes []string) bool {
+	if len(codes) == 0 {
+		return p.deny
+	}
+	for _, cc := range codes {
+		if p.codes[Normalize(cc)] == p.deny {
+			return false
+		}
+	}
+	return true
+}
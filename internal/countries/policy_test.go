@@ -0,0 +1,45 @@
+package countries
+
+import "testing"
+
+func TestPolicy(t *testing.T) {
+	g, err := NewGroups(nil)
+	if err != nil {
+		t.Fatalf("NewGroups failed: %v", err)
+	}
+	allow, err := NewPolicy([]string{"us", " CA", "eu"}, false, g)
+	if err != nil {
+		t.Fatalf("NewPolicy failed: %v", err)
+	}
+	deny, err := NewPolicy([]string{"CN", "RU"}, true, g)
+	if err != nil {
+		t.Fatalf("NewPolicy failed: %v", err)
+	}
+
+	tests := []struct {
+		codes []string
+		allow bool
+		deny  bool
+	}{
+		{[]string{"US"}, true, true},
+		{[]string{"de"}, true, true},
+		{[]string{"CN"}, false, false},
+		{[]string{"US", "CN"}, false, false},
+		{[]string{"US", "GB"}, false, true},
+		{nil, false, true},
+	}
+	for _, tc := range tests {
+		if got := allow.Allows(tc.codes); got != tc.allow {
+			t.Errorf("allow.Allows(%v) = %v, expected %v", tc.codes, got, tc.allow)
+		}
+		if got := deny.Allows(tc.codes); got != tc.deny {
+			t.Errorf("deny.Allows(%v) = %v, expected %v", tc.codes, got, tc.deny)
+		}
+	}
+
+	for _, bad := range [][]string{{"XX"}, {""}, nil} {
+		if _, err := NewPolicy(bad, false, g); err == nil {
+			t.Errorf("NewPolicy(%q) succeeded, expected an error", bad)
+		}
+	}
+}
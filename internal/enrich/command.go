@@ -0,0 +1,184 @@
+package enrich
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/output"
+)
+
+// DefaultTimeout bounds the answer of a plugin process to one result.
+const DefaultTimeout = 10 * time.Second
+
+// maxResponseSize bounds a single response line of a plugin process.
+const maxResponseSize = 1 << 20
+
+// ErrPluginStopped is returned once a plugin process has exited or was
+// stopped after a timeout.
+var ErrPluginStopped = errors.New("plugin stopped")
+
+// Command is an external enricher running as a subprocess.
+//
+// For each result, ip2cc writes the result's JSON form (as printed by
+// --json) as one line to the process's stdin and reads one line from its
+// stdout: a JSON object whose fields are added to the result. An empty
+// object adds nothing. The process is started once and serves all
+// lookups; requests are sent one at a time. Its stderr is passed through.
+type Command struct {
+	name    string
+	timeout time.Duration
+
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	stdout  *bufio.Reader
+	stopped bool
+}
+
+// NewCommand starts the plugin process argv. name identifies it in error
+// reports; if empty, the base name of the executable is used.
+func NewCommand(name string, argv []string) (*Command, error) {
+	if len(argv) == 0 {
+		return nil, fmt.Errorf("plugin command is empty")
+	}
+	if name == "" {
+		name = filepath.Base(argv[0])
+	}
+
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start plugin %s: %w", name, err)
+	}
+
+	return &Command{
+		name:    name,
+		timeout: DefaultTimeout,
+		cmd:     cmd,
+		stdin:   stdin,
+		stdout:  bufio.NewReaderSize(stdout, 64*1024),
+	}, nil
+}
+
+// Name implements Enricher.
+func (c *Command) Name() string {
+	return c.name
+}
+
+// SetTimeout changes how long the plugin may take to answer.
+func (c *Command) SetTimeout(d time.Duration) {
+	c.timeout = d
+}
+
+// Enrich implements Enricher. A plugin that does not answer in time is
+// stopped, since its replies could no longer be matched to requests.
+func (c *Command) Enrich(ctx context.Context, result *output.LookupResult) error {
+	request, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		return ErrPluginStopped
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	type reply struct {
+		line string
+		err  error
+	}
+	done := make(chan reply, 1)
+	go func() {
+		if _, err := c.stdin.Write(append(request, '\n')); err != nil {
+			done <- reply{err: err}
+			return
+		}
+		line, err := readLine(c.stdout)
+		done <- reply{line, err}
+	}()
+
+	var r reply
+	select {
+	case r = <-done:
+	case <-ctx.Done():
+		c.stop()
+		<-done
+		return fmt.Errorf("plugin %s: %w", c.name, ctx.Err())
+	}
+	if r.err != nil {
+		c.stop()
+		return fmt.Errorf("plugin %s: %w", c.name, r.err)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(r.line), &fields); err != nil {
+		return fmt.Errorf("plugin %s: invalid response: %w", c.name, err)
+	}
+	for k, v := range fields {
+		result.SetExtra(k, v)
+	}
+	return nil
+}
+
+// readLine reads one response line, rejecting oversized ones.
+func readLine(r *bufio.Reader) (string, error) {
+	var sb strings.Builder
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		sb.Write(chunk)
+		if sb.Len() > maxResponseSize {
+			return "", fmt.Errorf("response exceeds %d bytes", maxResponseSize)
+		}
+		if !isPrefix {
+			return sb.String(), nil
+		}
+	}
+}
+
+// stop kills the process. The caller holds c.mu.
+func (c *Command) stop() {
+	if c.stopped {
+		return
+	}
+	c.stopped = true
+	c.cmd.Process.Kill()
+	c.stdin.Close()
+	c.cmd.Wait()
+}
+
+// Close closes the plugin's stdin and waits for it to exit.
+func (c *Command) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		return nil
+	}
+	c.stopped = true
+	c.stdin.Close()
+	return c.cmd.Wait()
+}
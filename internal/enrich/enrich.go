@@ -0,0 +1,53 @@
+// Package enrich attaches additional data, such as threat intelligence or
+// inventory records, to lookup results.
+//
+// An Enricher sees each successful lookup result and may add fields to it.
+// Built-in enrichers are Go values; external ones run as a subprocess that
+// speaks a line-based JSON protocol (see Command).
+package enrich
+
+import (
+	"context"
+
+	"github.com/hightemp/ip2cc/internal/output"
+)
+
+// Enricher adds data to lookup results. Enrich is called for every result
+// that was found, including special-purpose addresses, and may be called
+// concurrently.
+type Enricher interface {
+	// Name identifies the enricher in error reports.
+	Name() string
+	// Enrich adds fields to result, usually with result.SetExtra.
+	Enrich(ctx context.Context, result *output.LookupResult) error
+}
+
+// Apply runs enrichers on result in order. A failing enricher does not stop
+// the others; its error is recorded as the extra field "<name>_error".
+func Apply(ctx context.Context, enrichers []Enricher, result *output.LookupResult) {
+	if len(enrichers) == 0 || result.Error != "" {
+		return
+	}
+	if result.Extra == nil {
+		result.Extra = make(map[string]interface{})
+	}
+	for _, e := range enrichers {
+		if err := e.Enrich(ctx, result); err != nil {
+			result.SetExtra(e.Name()+"_error", err.Error())
+		}
+	}
+}
+
+// Close releases the resources of the enrichers that hold any, such as
+// plugin processes, and returns the first error.
+func Close(enrichers []Enricher) error {
+	var first error
+	for _, e := range enrichers {
+		if c, ok := e.(interface{ Close() error }); ok {
+			if err := c.Close(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
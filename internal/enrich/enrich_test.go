@@ -0,0 +1,123 @@
+package enrich
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/output"
+)
+
+type staticEnricher struct {
+	name string
+	err  error
+}
+
+func (e *staticEnricher) Name() string { return e.name }
+
+func (e *staticEnricher) Enrich(ctx context.Context, result *output.LookupResult) error {
+	if e.err != nil {
+		return e.err
+	}
+	result.SetExtra("owner", "team-"+result.CountryCode)
+	return nil
+}
+
+func TestApply(t *testing.T) {
+	enrichers := []Enricher{
+		&staticEnricher{name: "cmdb"},
+		&staticEnricher{name: "intel", err: errors.New("unavailable")},
+	}
+
+	result := &output.LookupResult{IP: "8.8.8.8", CountryCode: "US"}
+	Apply(context.Background(), enrichers, result)
+	if result.Extra["owner"] != "team-US" {
+		t.Errorf("Extra[owner] = %v, expected team-US", result.Extra["owner"])
+	}
+	if result.Extra["intel_error"] != "unavailable" {
+		t.Errorf("Extra[intel_error] = %v, expected unavailable", result.Extra["intel_error"])
+	}
+
+	failed := &output.LookupResult{IP: "1.1.1.1", Error: "not found in index"}
+	Apply(context.Background(), enrichers, failed)
+	if failed.Extra != nil {
+		t.Errorf("Extra of a failed lookup = %v, expected nil", failed.Extra)
+	}
+}
+
+// writePlugin writes a shell script plugin and returns its path.
+func writePlugin(t *testing.T, dir, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("shell plugins need a Unix shell")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	path := filepath.Join(dir, "plugin.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("Failed to write plugin: %v", err)
+	}
+	return path
+}
+
+func TestCommand(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Answers every request with a fixed object
+	path := writePlugin(t, tmpDir, `while read -r line; do
+  echo '{"threat": "none", "score": 3}'
+done
+`)
+	c, err := NewCommand("", []string{"sh", path})
+	if err != nil {
+		t.Fatalf("NewCommand failed: %v", err)
+	}
+	defer c.Close()
+
+	if c.Name() != "sh" {
+		t.Errorf("Name() = %s, expected sh", c.Name())
+	}
+	for i := 0; i < 3; i++ {
+		result := &output.LookupResult{IP: "8.8.8.8", CountryCode: "US"}
+		if err := c.Enrich(context.Background(), result); err != nil {
+			t.Fatalf("Enrich failed: %v", err)
+		}
+		if result.Extra["threat"] != "none" || result.Extra["score"] != float64(3) {
+			t.Errorf("Extra = %v, expected threat=none score=3", result.Extra)
+		}
+	}
+}
+
+func TestCommandTimeout(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := writePlugin(t, tmpDir, "exec sleep 30\n")
+	c, err := NewCommand("slow", []string{"sh", path})
+	if err != nil {
+		t.Fatalf("NewCommand failed: %v", err)
+	}
+	defer c.Close()
+	c.SetTimeout(100 * time.Millisecond)
+
+	result := &output.LookupResult{IP: "8.8.8.8", CountryCode: "US"}
+	if err := c.Enrich(context.Background(), result); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Enrich error = %v, expected deadline exceeded", err)
+	}
+	if err := c.Enrich(context.Background(), result); !errors.Is(err, ErrPluginStopped) {
+		t.Errorf("Enrich after timeout error = %v, expected ErrPluginStopped", err)
+	}
+}
@@ -0,0 +1,200 @@
+// Package export writes the prefixes of an index in the formats of other
+// tools, such as firewall sets.
+package export
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"github.com/hightemp/ip2cc/internal/index"
+	"github.com/hightemp/ip2cc/internal/iprange"
+)
+
+// Set is the address space of one country, as minimal lists of
+// non-overlapping prefixes sorted by address.
+type Set struct {
+	Country string
+	V4      []netip.Prefix
+	V6      []netip.Prefix
+}
+
+// Data is the input of a format writer.
+type Data struct {
+	// Sets are sorted by country.
+	Sets []Set
+	// Name is the base name of generated tables, sets, or zones.
+	Name string
+	// Snapshot is the date of the exported snapshot, for header comments.
+	Snapshot string
+}
+
+// Format writes Data in the syntax of a target tool.
+type Format struct {
+	Name        string
+	Description string
+	Write       func(w io.Writer, d *Data) error
+}
+
+// formats lists the supported formats by name.
+var formats = map[string]Format{}
+
+func register(f Format) {
+	formats[f.Name] = f
+}
+
+// Formats returns the supported formats sorted by name.
+func Formats() []Format {
+	list := make([]Format, 0, len(formats))
+	for _, f := range formats {
+		list = append(list, f)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Get returns the named format.
+func Get(name string) (Format, error) {
+	f, ok := formats[name]
+	if !ok {
+		names := make([]string, 0, len(formats))
+		for _, f := range Formats() {
+			names = append(names, f.Name)
+		}
+		return Format{}, fmt.Errorf("unknown export format: %s (use %s)", name, strings.Join(names, ", "))
+	}
+	return f, nil
+}
+
+// Collect computes the address space of the given countries (all if
+// empty). Where prefixes of different countries nest, the most specific
+// one wins, as in lookups; adjacent prefixes of a country are merged.
+func Collect(v4, v6 *index.Trie, countries []string) []Set {
+	want := make(map[string]bool, len(countries))
+	for _, cc := range countries {
+		want[strings.ToUpper(cc)] = true
+	}
+
+	byCountry := make(map[string]*Set)
+	get := func(cc string) *Set {
+		s, ok := byCountry[cc]
+		if !ok {
+			s = &Set{Country: cc}
+			byCountry[cc] = s
+		}
+		return s
+	}
+	for _, cc := range countries {
+		// Requested countries are exported even if they hold no prefixes
+		get(strings.ToUpper(cc))
+	}
+
+	for _, r := range effectiveRanges(v4) {
+		if len(want) == 0 || want[r.cc] {
+			s := get(r.cc)
+			s.V4 = appendRange(s.V4, r)
+		}
+	}
+	for _, r := range effectiveRanges(v6) {
+		if len(want) == 0 || want[r.cc] {
+			s := get(r.cc)
+			s.V6 = appendRange(s.V6, r)
+		}
+	}
+
+	sets := make([]Set, 0, len(byCountry))
+	for _, s := range byCountry {
+		sets = append(sets, *s)
+	}
+	sort.Slice(sets, func(i, j int) bool { return sets[i].Country < sets[j].Country })
+	return sets
+}
+
+// appendRange appends the prefixes covering r.
+func appendRange(prefixes []netip.Prefix, r addrRange) []netip.Prefix {
+	p, err := iprange.ToPrefixes(r.start, r.end)
+	if err != nil {
+		return prefixes
+	}
+	return append(prefixes, p...)
+}
+
+// addrRange is an inclusive address range assigned to one country.
+type addrRange struct {
+	start, end netip.Addr
+	cc         string
+}
+
+// effectiveRanges flattens the nested prefixes of trie into sorted,
+// non-overlapping ranges carrying the country of the longest match.
+// Adjacent ranges of the same country are merged.
+func effectiveRanges(trie *index.Trie) []addrRange {
+	prefixes, data := trie.Export()
+
+	var ranges []addrRange
+	emit := func(start, end netip.Addr, cc string) {
+		if !start.IsValid() || end.Less(start) {
+			return
+		}
+		if n := len(ranges); n > 0 && ranges[n-1].cc == cc && ranges[n-1].end.Next() == start {
+			ranges[n-1].end = end
+			return
+		}
+		ranges = append(ranges, addrRange{start, end, cc})
+	}
+
+	// open holds the prefixes containing the current one, outermost first;
+	// cursor is the first address of each not yet emitted.
+	type frame struct {
+		end    netip.Addr
+		cc     string
+		cursor netip.Addr
+	}
+	var open []frame
+	closeUntil := func(addr netip.Addr, all bool) {
+		for len(open) > 0 {
+			top := open[len(open)-1]
+			if !all && !top.end.Less(addr) {
+				return
+			}
+			emit(top.cursor, top.end, top.cc)
+			open = open[:len(open)-1]
+		}
+	}
+
+	for i, p := range prefixes {
+		start, end := p.Masked().Addr(), iprange.LastAddr(p)
+		closeUntil(start, false)
+		if n := len(open); n > 0 {
+			parent := &open[n-1]
+			if parent.cursor.IsValid() && parent.cursor.Less(start) {
+				emit(parent.cursor, start.Prev(), parent.cc)
+			}
+			parent.cursor = end.Next()
+		}
+		open = append(open, frame{end: end, cc: data[i].CountryCode, cursor: start})
+	}
+	closeUntil(netip.Addr{}, true)
+	return ranges
+}
+
+// header returns the comment lines opening a generated file, each prefixed
+// with the format's comment marker.
+func header(comment string, d *Data) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s Generated by ip2cc", comment)
+	if d.Snapshot != "" {
+		fmt.Fprintf(&sb, " from snapshot %s", d.Snapshot)
+	}
+	sb.WriteString("\n")
+	if len(d.Sets) > 0 && len(d.Sets) <= 10 {
+		codes := make([]string, len(d.Sets))
+		for i, s := range d.Sets {
+			codes[i] = s.Country
+		}
+		fmt.Fprintf(&sb, "%s Countries: %s\n", comment, strings.Join(codes, ", "))
+	}
+	return sb.String()
+}
@@ -0,0 +1,254 @@
+package export
+
+import (
+	"bytes"
+	"io"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/hightemp/ip2cc/internal/index"
+)
+
+func newTestTries(t *testing.T, cidrs map[string]string) (*index.Trie, *index.Trie) {
+	t.Helper()
+	v4, v6 := index.NewTrie(false), index.NewTrie(true)
+	for cidr, cc := range cidrs {
+		trie := v4
+		if strings.Contains(cidr, ":") {
+			trie = v6
+		}
+		if err := trie.InsertCIDR(cidr, cc); err != nil {
+			t.Fatalf("InsertCIDR(%s) failed: %v", cidr, err)
+		}
+	}
+	return v4, v6
+}
+
+func prefixStrings(prefixes []netip.Prefix) []string {
+	s := make([]string, len(prefixes))
+	for i, p := range prefixes {
+		s[i] = p.String()
+	}
+	return s
+}
+
+func TestCollect(t *testing.T) {
+	v4, v6 := newTestTries(t, map[string]string{
+		// Adjacent blocks merge
+		"1.0.0.0/24": "CN",
+		"1.0.1.0/24": "CN",
+		// A nested block of another country is cut out
+		"10.0.0.0/8":  "CN",
+		"10.1.0.0/16": "US",
+		// A nested block of the same country is absorbed
+		"20.0.0.0/16":   "US",
+		"20.0.10.0/24":  "US",
+		"2001:db8::/32": "CN",
+	})
+
+	sets := Collect(v4, v6, []string{"cn", "us", "ru"})
+	if len(sets) != 3 {
+		t.Fatalf("Collect returned %d sets, expected 3", len(sets))
+	}
+
+	tests := []struct {
+		country string
+		v4      []string
+		v6      []string
+	}{
+		{"CN", []string{"1.0.0.0/23", "10.0.0.0/16", "10.2.0.0/15", "10.4.0.0/14", "10.8.0.0/13", "10.16.0.0/12", "10.32.0.0/11", "10.64.0.0/10", "10.128.0.0/9"}, []string{"2001:db8::/32"}},
+		{"RU", nil, nil},
+		{"US", []string{"10.1.0.0/16", "20.0.0.0/16"}, nil},
+	}
+	for i, tt := range tests {
+		s := sets[i]
+		if s.Country != tt.country {
+			t.Errorf("Set %d country = %s, expected %s", i, s.Country, tt.country)
+			continue
+		}
+		if got := strings.Join(prefixStrings(s.V4), " "); got != strings.Join(tt.v4, " ") {
+			t.Errorf("%s V4 = %s, expected %s", tt.country, got, strings.Join(tt.v4, " "))
+		}
+		if got := strings.Join(prefixStrings(s.V6), " "); got != strings.Join(tt.v6, " ") {
+			t.Errorf("%s V6 = %s, expected %s", tt.country, got, strings.Join(tt.v6, " "))
+		}
+	}
+
+	if all := Collect(v4, v6, nil); len(all) != 2 {
+		t.Errorf("Collect of all countries returned %d sets, expected 2", len(all))
+	}
+}
+
+func TestGetUnknownFormat(t *testing.T) {
+	if _, err := Get("bogus"); err == nil {
+		t.Error("Get(bogus) should fail")
+	}
+}
+
+func testData(t *testing.T) *Data {
+	t.Helper()
+	v4, v6 := newTestTries(t, map[string]string{
+		"1.0.0.0/24":    "CN",
+		"2001:db8::/32": "CN",
+		"5.0.0.0/16":    "RU",
+	})
+	return &Data{Sets: Collect(v4, v6, []string{"CN", "RU"}), Snapshot: "2025-01-15"}
+}
+
+func writeFormat(t *testing.T, name string, d *Data) string {
+	t.Helper()
+	f, err := Get(name)
+	if err != nil {
+		t.Fatalf("Get(%s) failed: %v", name, err)
+	}
+	var buf bytes.Buffer
+	if err := f.Write(&buf, d); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	return buf.String()
+}
+
+func TestWriteNftSet(t *testing.T) {
+	out := writeFormat(t, "nftset", testData(t))
+
+	for _, want := range []string{
+		"# Generated by ip2cc from snapshot 2025-01-15\n",
+		"table inet ip2cc {\n",
+		"\tset cn_v4 {\n\t\ttype ipv4_addr\n\t\tflags interval\n\t\telements = {\n\t\t\t1.0.0.0/24\n\t\t}\n\t}\n",
+		"\tset cn_v6 {\n\t\ttype ipv6_addr\n",
+		// Empty sets have no element list
+		"\tset ru_v6 {\n\t\ttype ipv6_addr\n\t\tflags interval\n\t}\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("nftset output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteIPSet(t *testing.T) {
+	d := testData(t)
+	d.Name = "geo"
+	out := writeFormat(t, "ipset", d)
+
+	for _, want := range []string{
+		"create geo-cn-v4 hash:net family inet maxelem 65536 -exist\nflush geo-cn-v4\nadd geo-cn-v4 1.0.0.0/24\n",
+		"create geo-cn-v6 hash:net family inet6 maxelem 65536 -exist\n",
+		"add geo-ru-v4 5.0.0.0/16\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("ipset output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteNginx(t *testing.T) {
+	out := writeFormat(t, "nginx", testData(t))
+
+	want := "geo $country {\n\tdefault \"\";\n\t1.0.0.0/24 CN;\n\t5.0.0.0/16 RU;\n\t2001:db8::/32 CN;\n}\n"
+	if !strings.HasSuffix(out, want) {
+		t.Errorf("nginx output = %q, expected suffix %q", out, want)
+	}
+}
+
+func TestWriteNginxSplit(t *testing.T) {
+	d := testData(t)
+	d.Name = "$geo"
+	out := writeFormat(t, "nginx-split", d)
+
+	for _, want := range []string{
+		"geo $geo_cn {\n\tdefault 0;\n\t1.0.0.0/24 1;\n\t2001:db8::/32 1;\n}\n",
+		"geo $geo_ru {\n\tdefault 0;\n\t5.0.0.0/16 1;\n}\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("nginx-split output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWritePF(t *testing.T) {
+	out := writeFormat(t, "pf", testData(t))
+
+	want := "1.0.0.0/24\n5.0.0.0/16\n2001:db8::/32\n"
+	if !strings.HasSuffix(out, want) {
+		t.Errorf("pf output = %q, expected suffix %q", out, want)
+	}
+	if !strings.HasPrefix(out, "# Generated by ip2cc") {
+		t.Errorf("pf output = %q, expected header comment", out)
+	}
+}
+
+func TestRPZOwner(t *testing.T) {
+	tests := []struct {
+		prefix string
+		owner  string
+	}{
+		{"192.0.2.0/24", "24.0.2.0.192.rpz-ip"},
+		{"10.0.0.0/8", "8.0.0.0.10.rpz-ip"},
+		{"2001:db8::/32", "32.zz.db8.2001.rpz-ip"},
+		{"2001:db8:0:1::/64", "64.zz.1.0.db8.2001.rpz-ip"},
+		{"2001:0:0:1::/64", "64.zz.1.0.0.2001.rpz-ip"},
+	}
+	for _, tt := range tests {
+		if got := rpzOwner(netip.MustParsePrefix(tt.prefix)); got != tt.owner {
+			t.Errorf("rpzOwner(%s) = %s, expected %s", tt.prefix, got, tt.owner)
+		}
+	}
+}
+
+func TestWriteRPZ(t *testing.T) {
+	out := writeFormat(t, "rpz", testData(t))
+
+	for _, want := range []string{
+		"; Generated by ip2cc from snapshot 2025-01-15\n",
+		"@ IN SOA localhost. root.localhost. 2025011500 3600 600 86400 300\n",
+		"24.0.0.0.1.rpz-ip CNAME .\n",
+		"32.zz.db8.2001.rpz-ip CNAME .\n",
+		"16.0.0.0.5.rpz-ip CNAME .\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("rpz output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWritePostgres(t *testing.T) {
+	out := writeFormat(t, "sql", testData(t))
+
+	want := "BEGIN;\n" +
+		"CREATE TABLE IF NOT EXISTS ip2cc (network cidr PRIMARY KEY, country_code char(2) NOT NULL);\n" +
+		"TRUNCATE ip2cc;\n" +
+		"COPY ip2cc (network, country_code) FROM stdin;\n" +
+		"1.0.0.0/24\tCN\n5.0.0.0/16\tRU\n2001:db8::/32\tCN\n\\.\n" +
+		"CREATE INDEX IF NOT EXISTS ip2cc_network_idx ON ip2cc USING gist (network inet_ops);\n" +
+		"COMMIT;\n"
+	if !strings.HasSuffix(out, want) {
+		t.Errorf("sql output = %q, expected suffix %q", out, want)
+	}
+}
+
+func TestWriteClickHouse(t *testing.T) {
+	d := testData(t)
+	d.Name = "geo.networks"
+	out := writeFormat(t, "sql-clickhouse", d)
+
+	want := "TRUNCATE TABLE geo.networks;\n" +
+		"INSERT INTO geo.networks (network, country_code) VALUES\n" +
+		"('1.0.0.0/24','CN'),\n('5.0.0.0/16','RU'),\n('2001:db8::/32','CN');\n"
+	if !strings.HasSuffix(out, want) {
+		t.Errorf("sql-clickhouse output = %q, expected suffix %q", out, want)
+	}
+}
+
+func TestSQLTableName(t *testing.T) {
+	f, _ := Get("sql")
+	d := testData(t)
+	d.Name = "ip2cc; DROP TABLE users"
+	if err := f.Write(io.Discard, d); err == nil {
+		t.Error("Write should reject an invalid table name")
+	}
+
+	if got := sqlIndexName("geo.networks"); got != "networks" {
+		t.Errorf("sqlIndexName(geo.networks) = %s, expected networks", got)
+	}
+}
@@ -0,0 +1,105 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+)
+
+// ipsetMinMaxElem is the ipset default set size, raised for larger sets.
+const ipsetMinMaxElem = 65536
+
+func init() {
+	register(Format{
+		Name:        "nftset",
+		Description: "nftables table with an interval set per country and family (nft -f)",
+		Write:       writeNftSet,
+	})
+	register(Format{
+		Name:        "ipset",
+		Description: "ipset restore script with a hash:net set per country and family (ipset restore)",
+		Write:       writeIPSet,
+	})
+}
+
+// setName returns the name of the set holding the prefixes of country in
+// one family, e.g. "cn_v4". sep joins the parts.
+func setName(prefix, country, family, sep string) string {
+	parts := []string{strings.ToLower(country), family}
+	if prefix != "" {
+		parts = append([]string{prefix}, parts...)
+	}
+	return strings.Join(parts, sep)
+}
+
+// writeNftSet writes a table definition with one interval set per country
+// and address family:
+//
+//	table inet ip2cc {
+//		set cn_v4 { type ipv4_addr; flags interval; elements = { ... } }
+//	}
+func writeNftSet(w io.Writer, d *Data) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(header("#", d))
+
+	table := d.Name
+	if table == "" {
+		table = "ip2cc"
+	}
+	fmt.Fprintf(bw, "table inet %s {\n", table)
+	for _, s := range d.Sets {
+		writeNftSetBlock(bw, setName("", s.Country, "v4", "_"), "ipv4_addr", s.V4)
+		writeNftSetBlock(bw, setName("", s.Country, "v6", "_"), "ipv6_addr", s.V6)
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+func writeNftSetBlock(bw *bufio.Writer, name, typ string, prefixes []netip.Prefix) {
+	fmt.Fprintf(bw, "\tset %s {\n\t\ttype %s\n\t\tflags interval\n", name, typ)
+	if len(prefixes) > 0 {
+		// nft rejects empty element lists
+		bw.WriteString("\t\telements = {\n")
+		for i, p := range prefixes {
+			bw.WriteString("\t\t\t")
+			bw.WriteString(p.String())
+			if i < len(prefixes)-1 {
+				bw.WriteByte(',')
+			}
+			bw.WriteByte('\n')
+		}
+		bw.WriteString("\t\t}\n")
+	}
+	bw.WriteString("\t}\n")
+}
+
+// writeIPSet writes an ipset restore script that creates (or empties) one
+// hash:net set per country and family and fills it, e.g. "ip2cc-cn-v4".
+func writeIPSet(w io.Writer, d *Data) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(header("#", d))
+
+	prefix := d.Name
+	if prefix == "" {
+		prefix = "ip2cc"
+	}
+	for _, s := range d.Sets {
+		writeIPSetBlock(bw, setName(prefix, s.Country, "v4", "-"), "inet", s.V4)
+		writeIPSetBlock(bw, setName(prefix, s.Country, "v6", "-"), "inet6", s.V6)
+	}
+	return bw.Flush()
+}
+
+func writeIPSetBlock(bw *bufio.Writer, name, family string, prefixes []netip.Prefix) {
+	maxElem := ipsetMinMaxElem
+	if len(prefixes) > maxElem {
+		maxElem = len(prefixes)
+	}
+	fmt.Fprintf(bw, "create %s hash:net family %s maxelem %d -exist\n", name, family, maxElem)
+	fmt.Fprintf(bw, "flush %s\n", name)
+	for _, p := range prefixes {
+		fmt.Fprintf(bw, "add %s %s\n", name, p)
+	}
+}
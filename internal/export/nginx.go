@@ -0,0 +1,79 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+func init() {
+	register(Format{
+		Name:        "nginx",
+		Description: "nginx geo block setting $country to the country code (include in http {})",
+		Write:       writeNginx,
+	})
+	register(Format{
+		Name:        "nginx-split",
+		Description: "nginx geo block per country setting $country_<cc> to 1 (include in http {})",
+		Write:       writeNginxSplit,
+	})
+}
+
+// nginxVariable returns the geo variable name, "country" by default.
+func nginxVariable(d *Data) string {
+	if d.Name != "" {
+		return strings.TrimPrefix(d.Name, "$")
+	}
+	return "country"
+}
+
+// writeNginx writes a single geo block mapping every prefix to its country
+// code. Addresses of other countries get an empty value.
+func writeNginx(w io.Writer, d *Data) error {
+	type entry struct {
+		prefix netip.Prefix
+		cc     string
+	}
+	var entries []entry
+	for _, s := range d.Sets {
+		for _, p := range s.V4 {
+			entries = append(entries, entry{p, s.Country})
+		}
+		for _, p := range s.V6 {
+			entries = append(entries, entry{p, s.Country})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].prefix.Addr().Less(entries[j].prefix.Addr())
+	})
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(header("#", d))
+	fmt.Fprintf(bw, "geo $%s {\n\tdefault \"\";\n", nginxVariable(d))
+	for _, e := range entries {
+		fmt.Fprintf(bw, "\t%s %s;\n", e.prefix, e.cc)
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+// writeNginxSplit writes one geo block per country whose variable is 1 for
+// addresses of the country and 0 otherwise.
+func writeNginxSplit(w io.Writer, d *Data) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(header("#", d))
+	for _, s := range d.Sets {
+		fmt.Fprintf(bw, "geo $%s_%s {\n\tdefault 0;\n", nginxVariable(d), strings.ToLower(s.Country))
+		for _, p := range s.V4 {
+			fmt.Fprintf(bw, "\t%s 1;\n", p)
+		}
+		for _, p := range s.V6 {
+			fmt.Fprintf(bw, "\t%s 1;\n", p)
+		}
+		bw.WriteString("}\n")
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,34 @@
+package export
+
+import (
+	"bufio"
+	"io"
+)
+
+func init() {
+	register(Format{
+		Name:        "pf",
+		Description: "pf table file, one prefix per line (pfctl -t <table> -T replace -f)",
+		Write:       writePF,
+	})
+}
+
+// writePF writes the prefixes of all sets as one pf table: IPv4 first,
+// then IPv6, one per line.
+func writePF(w io.Writer, d *Data) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(header("#", d))
+	for _, s := range d.Sets {
+		for _, p := range s.V4 {
+			bw.WriteString(p.String())
+			bw.WriteByte('\n')
+		}
+	}
+	for _, s := range d.Sets {
+		for _, p := range s.V6 {
+			bw.WriteString(p.String())
+			bw.WriteByte('\n')
+		}
+	}
+	return bw.Flush()
+}
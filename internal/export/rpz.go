@@ -0,0 +1,92 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	register(Format{
+		Name:        "rpz",
+		Description: "BIND response policy zone answering NXDOMAIN for names resolving into the prefixes",
+		Write:       writeRPZ,
+	})
+}
+
+// writeRPZ writes a response policy zone with an rpz-ip trigger per prefix,
+// so that lookups of names resolving into the selected countries fail with
+// NXDOMAIN. The serial is derived from the snapshot date.
+func writeRPZ(w io.Writer, d *Data) error {
+	serial := "1"
+	if date := strings.ReplaceAll(d.Snapshot, "-", ""); len(date) == 8 {
+		serial = date + "00"
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(header(";", d))
+	fmt.Fprintf(bw, "$TTL 300\n@ IN SOA localhost. root.localhost. %s 3600 600 86400 300\n  IN NS localhost.\n", serial)
+	for _, s := range d.Sets {
+		for _, p := range s.V4 {
+			fmt.Fprintf(bw, "%s CNAME .\n", rpzOwner(p))
+		}
+		for _, p := range s.V6 {
+			fmt.Fprintf(bw, "%s CNAME .\n", rpzOwner(p))
+		}
+	}
+	return bw.Flush()
+}
+
+// rpzOwner returns the rpz-ip owner name of a prefix: the prefix length
+// followed by the address labels in reverse order, e.g.
+// "24.0.2.0.192.rpz-ip". IPv6 addresses use hex words with "zz" in place
+// of the longest run of zero words, e.g. "32.zz.db8.2001.rpz-ip".
+func rpzOwner(p netip.Prefix) string {
+	addr := p.Masked().Addr()
+	labels := []string{strconv.Itoa(p.Bits())}
+
+	if addr.Is4() {
+		b := addr.As4()
+		for i := 3; i >= 0; i-- {
+			labels = append(labels, strconv.Itoa(int(b[i])))
+		}
+		return strings.Join(append(labels, "rpz-ip"), ".")
+	}
+
+	b := addr.As16()
+	var words [8]uint16
+	for i := range words {
+		words[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+
+	// Longest run of at least two zero words, as in RFC 5952
+	runStart, runLen := -1, 0
+	for i := 0; i < 8; {
+		if words[i] != 0 {
+			i++
+			continue
+		}
+		j := i
+		for j < 8 && words[j] == 0 {
+			j++
+		}
+		if j-i > runLen && j-i >= 2 {
+			runStart, runLen = i, j-i
+		}
+		i = j
+	}
+
+	for i := 7; i >= 0; i-- {
+		if i >= runStart && i < runStart+runLen {
+			if i == runStart {
+				labels = append(labels, "zz")
+			}
+			continue
+		}
+		labels = append(labels, strconv.FormatUint(uint64(words[i]), 16))
+	}
+	return strings.Join(append(labels, "rpz-ip"), ".")
+}
@@ -0,0 +1,119 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"regexp"
+)
+
+// sqlInsertBatch is the number of rows per ClickHouse INSERT statement.
+const sqlInsertBatch = 10000
+
+// sqlIdentifier matches table names that need no quoting, optionally
+// qualified by a schema or database.
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+func init() {
+	register(Format{
+		Name:        "sql",
+		Description: "PostgreSQL table (network cidr, country_code) loaded with COPY (psql -f)",
+		Write:       writePostgres,
+	})
+	register(Format{
+		Name:        "sql-clickhouse",
+		Description: "ClickHouse table (network, country_code) loaded with INSERT (clickhouse-client --multiquery)",
+		Write:       writeClickHouse,
+	})
+}
+
+// sqlTable returns the table name, "ip2cc" by default.
+func sqlTable(d *Data) (string, error) {
+	if d.Name == "" {
+		return "ip2cc", nil
+	}
+	if !sqlIdentifier.MatchString(d.Name) {
+		return "", fmt.Errorf("invalid table name: %s", d.Name)
+	}
+	return d.Name, nil
+}
+
+// eachRow calls fn for every prefix, IPv4 first.
+func eachRow(d *Data, fn func(p netip.Prefix, cc string)) {
+	for _, s := range d.Sets {
+		for _, p := range s.V4 {
+			fn(p, s.Country)
+		}
+	}
+	for _, s := range d.Sets {
+		for _, p := range s.V6 {
+			fn(p, s.Country)
+		}
+	}
+}
+
+// writePostgres writes a script that creates the table if needed, replaces
+// its rows in one transaction and indexes it for containment queries
+// (network >>= '1.2.3.4').
+func writePostgres(w io.Writer, d *Data) error {
+	table, err := sqlTable(d)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(header("--", d))
+	fmt.Fprintf(bw, "BEGIN;\n")
+	fmt.Fprintf(bw, "CREATE TABLE IF NOT EXISTS %s (network cidr PRIMARY KEY, country_code char(2) NOT NULL);\n", table)
+	fmt.Fprintf(bw, "TRUNCATE %s;\n", table)
+	fmt.Fprintf(bw, "COPY %s (network, country_code) FROM stdin;\n", table)
+	eachRow(d, func(p netip.Prefix, cc string) {
+		fmt.Fprintf(bw, "%s\t%s\n", p, cc)
+	})
+	bw.WriteString("\\.\n")
+	fmt.Fprintf(bw, "CREATE INDEX IF NOT EXISTS %s_network_idx ON %s USING gist (network inet_ops);\n", sqlIndexName(table), table)
+	bw.WriteString("COMMIT;\n")
+	return bw.Flush()
+}
+
+// sqlIndexName derives an index name from a possibly qualified table name.
+func sqlIndexName(table string) string {
+	if m := sqlIdentifier.FindStringSubmatch(table); m != nil && m[1] != "" {
+		return m[1][1:]
+	}
+	return table
+}
+
+// writeClickHouse writes a script that creates the table if needed and
+// replaces its rows. ClickHouse has no transactions; the rows are inserted
+// in batches.
+func writeClickHouse(w io.Writer, d *Data) error {
+	table, err := sqlTable(d)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(header("--", d))
+	fmt.Fprintf(bw, "CREATE TABLE IF NOT EXISTS %s (network String, country_code LowCardinality(String)) ENGINE = MergeTree ORDER BY network;\n", table)
+	fmt.Fprintf(bw, "TRUNCATE TABLE %s;\n", table)
+
+	rows := 0
+	eachRow(d, func(p netip.Prefix, cc string) {
+		if rows%sqlInsertBatch == 0 {
+			if rows > 0 {
+				bw.WriteString(";\n")
+			}
+			fmt.Fprintf(bw, "INSERT INTO %s (network, country_code) VALUES\n", table)
+		} else {
+			bw.WriteString(",\n")
+		}
+		fmt.Fprintf(bw, "('%s','%s')", p, cc)
+		rows++
+	})
+	if rows > 0 {
+		bw.WriteString(";\n")
+	}
+	return bw.Flush()
+}
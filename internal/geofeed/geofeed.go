@@ -0,0 +1,303 @@
+// Package geofeed ingests self-published geolocation feeds (RFC 8805), in
+// which network operators state where their prefixes are used, and keeps
+// them as an overlay over the RIR index.
+//
+// A feed is a CSV file of prefix, country, region, city and postal code.
+// The overlay holds the country of every feed prefix in two tries; feeds
+// found through the "Geofeed" remarks of a registry record (RFC 9632) are
+// only trusted for prefixes within that record.
+package geofeed
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/config"
+	"github.com/hightemp/ip2cc/internal/countries"
+	"github.com/hightemp/ip2cc/internal/index"
+)
+
+const (
+	// Source marks the index data taken from a geofeed.
+	Source = "geofeed"
+
+	// DownloadTimeout bounds the download of one feed.
+	DownloadTimeout = time.Minute
+
+	indexV4FileName = "geofeed_v4.bin"
+	indexV6FileName = "geofeed_v6.bin"
+	feedsFileName   = "feeds.json"
+	entriesDirName  = "feeds"
+)
+
+// Entry is one line of a feed.
+type Entry struct {
+	Prefix  netip.Prefix
+	Country string
+	Region  string
+	City    string
+	Postal  string
+}
+
+// Feed describes an ingested feed.
+type Feed struct {
+	URL string `json:"url"`
+	// Scope limits the prefixes taken from the feed, for feeds found in
+	// registry remarks; empty for feeds configured by the user.
+	Scope     []string  `json:"scope,omitempty"`
+	Prefixes  int       `json:"prefixes"`
+	FetchedAt time.Time `json:"fetched_at"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// DB is a geofeed overlay.
+type DB struct {
+	V4    *index.Trie
+	V6    *index.Trie
+	Feeds []Feed
+
+	// entries holds the entries taken from each feed, by URL, so that Save
+	// can keep them for a later update in which the feed fails to download
+	entries map[string][]Entry
+}
+
+// New creates an empty overlay.
+func New() *DB {
+	return &DB{V4: index.NewTrie(false), V6: index.NewTrie(true), entries: make(map[string][]Entry)}
+}
+
+// Parse reads a feed. Comment lines and entries without a valid prefix
+// are skipped; an entry without a country states that the prefix is not
+// used in any particular one and is skipped as well.
+func Parse(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		cr := csv.NewReader(strings.NewReader(line))
+		cr.FieldsPerRecord = -1
+		fields, err := cr.Read()
+		if err != nil || len(fields) < 2 {
+			continue
+		}
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		prefix, err := netip.ParsePrefix(fields[0])
+		if err != nil {
+			continue
+		}
+		cc := countries.Normalize(fields[1])
+		if len(cc) != 2 {
+			continue
+		}
+		e := Entry{Prefix: prefix.Masked(), Country: cc}
+		if len(fields) > 2 {
+			e.Region = fields[2]
+		}
+		if len(fields) > 3 {
+			e.City = fields[3]
+		}
+		if len(fields) > 4 {
+			e.Postal = fields[4]
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// Fetch downloads and parses the feed at url.
+func Fetch(ctx context.Context, url string) ([]Entry, error) {
+	ctx, cancel := context.WithTimeout(ctx, DownloadTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", config.AppName+"/1.0")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download %s: HTTP %d", url, resp.StatusCode)
+	}
+	return Parse(resp.Body)
+}
+
+// Add adds the entries of feed to the overlay, except those outside the
+// feed's scope, and records the feed.
+func (db *DB) Add(feed Feed, entries []Entry) {
+	var scope []netip.Prefix
+	for _, s := range feed.Scope {
+		if p, err := netip.ParsePrefix(s); err == nil {
+			scope = append(scope, p)
+		}
+	}
+
+	feed.Prefixes = 0
+	var kept []Entry
+	for _, e := range entries {
+		if len(scope) > 0 && !within(e.Prefix, scope) {
+			continue
+		}
+		kept = append(kept, e)
+		trie := db.V4
+		if e.Prefix.Addr().Is6() {
+			trie = db.V6
+		}
+		data := index.PrefixData{CountryCode: e.Country}
+		if trie.Insert(e.Prefix, data) == nil {
+			feed.Prefixes++
+		}
+	}
+	if len(kept) > 0 {
+		db.entries[feed.URL] = append(db.entries[feed.URL], kept...)
+	}
+	db.Feeds = append(db.Feeds, feed)
+}
+
+// within reports whether p lies inside one of the scope prefixes.
+func within(p netip.Prefix, scope []netip.Prefix) bool {
+	for _, s := range scope {
+		if s.Bits() <= p.Bits() && s.Contains(p.Addr()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Overlay inserts the overlay's prefixes into the index tries, marked with
+// Source. The most specific prefix wins, so a feed refines the RIR data
+// below its prefixes, and replaces it for identical ones. It returns the
+// number of prefixes inserted.
+func (db *DB) Overlay(v4, v6 *index.Trie) int {
+	n := 0
+	for _, pair := range [][2]*index.Trie{{db.V4, v4}, {db.V6, v6}} {
+		prefixes, data := pair[0].Export()
+		for i, p := range prefixes {
+			d := data[i]
+			d.Source = Source
+			if pair[1].Insert(p, d) == nil {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// Save writes the overlay to dir, along with the entries of each feed.
+func (db *DB) Save(dir string) error {
+	if err := config.EnsureDir(dir); err != nil {
+		return err
+	}
+	if err := index.SaveIndex(filepath.Join(dir, indexV4FileName), filepath.Join(dir, indexV6FileName), db.V4, db.V6); err != nil {
+		return err
+	}
+	if err := db.saveEntries(dir); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(db.Feeds, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, feedsFileName), data, 0644)
+}
+
+// saveEntries replaces the entry files in dir with one CSV file per feed.
+func (db *DB) saveEntries(dir string) error {
+	entriesDir := filepath.Join(dir, entriesDirName)
+	if err := os.RemoveAll(entriesDir); err != nil {
+		return err
+	}
+	if err := config.EnsureDir(entriesDir); err != nil {
+		return err
+	}
+	for url, entries := range db.entries {
+		if err := writeEntries(entriesFile(dir, url), entries); err != nil {
+			return fmt.Errorf("save entries of %s: %w", url, err)
+		}
+	}
+	return nil
+}
+
+// writeEntries writes entries to path in the feed format read by Parse.
+func writeEntries(path string, entries []Entry) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	for _, e := range entries {
+		w.Write([]string{e.Prefix.String(), e.Country, e.Region, e.City, e.Postal})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// entriesFile returns the path of the entries of the feed at url in the
+// overlay in dir.
+func entriesFile(dir, url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(dir, entriesDirName, hex.EncodeToString(sum[:8])+".csv")
+}
+
+// LoadEntries reads the entries of the feed at url saved with the overlay
+// in dir, i.e. those of its last successful download.
+func LoadEntries(dir, url string) ([]Entry, error) {
+	f, err := os.Open(entriesFile(dir, url))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Load reads an overlay written by Save.
+func Load(dir string) (*DB, error) {
+	feeds, err := LoadFeeds(dir)
+	if err != nil {
+		return nil, err
+	}
+	v4, v6, err := index.LoadIndex(filepath.Join(dir, indexV4FileName), filepath.Join(dir, indexV6FileName))
+	if err != nil {
+		return nil, err
+	}
+	return &DB{V4: v4, V6: v6, Feeds: feeds, entries: make(map[string][]Entry)}, nil
+}
+
+// LoadFeeds reads the list of feeds of the overlay in dir, without its
+// prefixes.
+func LoadFeeds(dir string) ([]Feed, error) {
+	data, err := os.ReadFile(filepath.Join(dir, feedsFileName))
+	if err != nil {
+		return nil, err
+	}
+	var feeds []Feed
+	if err := json.Unmarshal(data, &feeds); err != nil {
+		return nil, fmt.Errorf("decode feeds: %w", err)
+	}
+	return feeds, nil
+}
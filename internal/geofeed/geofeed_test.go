@@ -0,0 +1,154 @@
+package geofeed
+
+import (
+	"net/netip"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hightemp/ip2cc/internal/index"
+)
+
+const testFeed = `# prefix,country,region,city,postal
+192.0.2.0/24,US,US-CA,Mountain View,
+192.0.2.128/25,de,DE-BE,Berlin,10115
+2001:db8::/32,NL,,,
+# no country: not used anywhere in particular
+198.51.100.0/24,,,,
+not-a-prefix,US,,,
+"203.0.113.0/24","GB","GB-ENG","London",""
+`
+
+func TestParse(t *testing.T) {
+	entries, err := Parse(strings.NewReader(testFeed))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("Parse returned %d entries, expected 4", len(entries))
+	}
+	e := entries[1]
+	if e.Prefix.String() != "192.0.2.128/25" || e.Country != "DE" || e.Region != "DE-BE" || e.City != "Berlin" || e.Postal != "10115" {
+		t.Errorf("entries[1] = %+v", e)
+	}
+	if entries[3].Country != "GB" || entries[3].City != "London" {
+		t.Errorf("entries[3] = %+v, expected quoted fields unquoted", entries[3])
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	entries, _ := Parse(strings.NewReader(testFeed))
+
+	db := New()
+	db.Add(Feed{URL: "https://example.com/feed.csv"}, entries)
+	// A feed found in remarks only counts within the record's network
+	db.Add(Feed{URL: "https://example.com/other.csv", Scope: []string{"192.0.2.0/24"}}, []Entry{
+		{Prefix: netip.MustParsePrefix("192.0.2.64/26"), Country: "FR"},
+		{Prefix: netip.MustParsePrefix("10.0.0.0/8"), Country: "FR"},
+	})
+	if db.Feeds[0].Prefixes != 4 || db.Feeds[1].Prefixes != 1 {
+		t.Errorf("Feed prefixes = %d, %d, expected 4, 1", db.Feeds[0].Prefixes, db.Feeds[1].Prefixes)
+	}
+
+	v4, v6 := index.NewTrie(false), index.NewTrie(true)
+	v4.InsertCIDR("192.0.0.0/16", "CA")
+	v4.InsertCIDR("10.0.0.0/8", "US")
+	if n := db.Overlay(v4, v6); n != 5 {
+		t.Errorf("Overlay inserted %d prefixes, expected 5", n)
+	}
+
+	tests := []struct {
+		ip     string
+		cc     string
+		source string
+	}{
+		{"192.0.2.1", "US", "geofeed"},
+		{"192.0.2.65", "FR", "geofeed"},
+		{"192.0.2.200", "DE", "geofeed"},
+		{"192.0.3.1", "CA", "rir"},
+		{"10.1.1.1", "US", "rir"},
+		{"2001:db8::1", "NL", "geofeed"},
+	}
+	for _, tt := range tests {
+		ip := netip.MustParseAddr(tt.ip)
+		trie := v4
+		if ip.Is6() {
+			trie = v6
+		}
+		data := trie.Lookup(ip)
+		if data == nil || data.CountryCode != tt.cc || data.CountrySource() != tt.source {
+			t.Errorf("Lookup(%s) = %+v, expected %s from %s", tt.ip, data, tt.cc, tt.source)
+		}
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	entries, _ := Parse(strings.NewReader(testFeed))
+	db := New()
+	db.Add(Feed{URL: "https://example.com/feed.csv"}, entries)
+	if err := db.Save(tmpDir); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(loaded.Feeds) != 1 || loaded.Feeds[0].URL != "https://example.com/feed.csv" {
+		t.Errorf("Feeds = %+v", loaded.Feeds)
+	}
+	if loaded.V4.Count != 3 || loaded.V6.Count != 1 {
+		t.Errorf("Count = %d/%d, expected 3/1", loaded.V4.Count, loaded.V6.Count)
+	}
+}
+
+func TestLoadEntries(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	entries, _ := Parse(strings.NewReader(testFeed))
+	db := New()
+	db.Add(Feed{URL: "https://example.com/feed.csv"}, entries)
+	db.Add(Feed{URL: "https://example.com/scoped.csv", Scope: []string{"203.0.113.0/24"}}, entries)
+	if err := db.Save(tmpDir); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := LoadEntries(tmpDir, "https://example.com/feed.csv")
+	if err != nil {
+		t.Fatalf("LoadEntries failed: %v", err)
+	}
+	if len(loaded) != len(entries) {
+		t.Fatalf("LoadEntries returned %d entries, expected %d", len(loaded), len(entries))
+	}
+	for i := range entries {
+		if loaded[i] != entries[i] {
+			t.Errorf("entries[%d] = %+v, expected %+v", i, loaded[i], entries[i])
+		}
+	}
+
+	scoped, err := LoadEntries(tmpDir, "https://example.com/scoped.csv")
+	if err != nil {
+		t.Fatalf("LoadEntries failed: %v", err)
+	}
+	if len(scoped) != 1 || scoped[0].Prefix.String() != "203.0.113.0/24" {
+		t.Errorf("scoped entries = %+v, expected only 203.0.113.0/24", scoped)
+	}
+
+	// Entries of feeds no longer in the overlay are removed
+	if err := New().Save(tmpDir); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := LoadEntries(tmpDir, "https://example.com/feed.csv"); !os.IsNotExist(err) {
+		t.Errorf("LoadEntries after emptying = %v, expected not exist", err)
+	}
+}
@@ -0,0 +1,341 @@
+package index
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"sync"
+
+	"github.com/hightemp/ip2cc/internal/countries"
+)
+
+// Shard widths for parallel builds: prefixes are grouped by their first
+// bits, and each group is built into its own subtree.
+const (
+	shardBitsV4 = 8
+	shardBitsV6 = 16
+)
+
+// ParseCIDR parses a CIDR string into the masked prefix and the data
+// InsertCIDR stores for it.
+func ParseCIDR(cidr string, countryCode string) (netip.Prefix, PrefixData, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return netip.Prefix{}, PrefixData{}, fmt.Errorf("invalid CIDR %q: %w", cidr, err)
+	}
+	prefix = prefix.Masked()
+	return prefix, PrefixData{
+		CountryCode: internCountry(countries.Normalize(countryCode)),
+		Bits:        uint8(prefix.Bits()),
+	}, nil
+}
+
+// BuildTrie builds a trie from prefixes and their data using up to workers
+// goroutines. The result is the same as inserting the prefixes one by one
+// in order: a prefix given twice keeps the data of its last occurrence.
+// Prefixes of the other IP version are skipped.
+func BuildTrie(isIPv6 bool, prefixes []netip.Prefix, data []PrefixData, workers int) *Trie {
+	shardBits := shardBitsV4
+	if isIPv6 {
+		shardBits = shardBitsV6
+	}
+
+	// Group by the first shardBits bits, keeping the input order within
+	// each group; shorter prefixes span groups and are inserted last
+	shards := make(map[uint32][]int)
+	var keys []uint32
+	var short []int
+	for i, p := range prefixes {
+		if p.Addr().Is6() != isIPv6 {
+			continue
+		}
+		if p.Bits() < shardBits {
+			short = append(short, i)
+			continue
+		}
+		key := shardKey(p.Addr(), shardBits)
+		if _, ok := shards[key]; !ok {
+			keys = append(keys, key)
+		}
+		shards[key] = append(shards[key], i)
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+	subtrees := make([]*Trie, len(keys))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range jobs {
+				sub := NewTrie(isIPv6)
+				for _, i := range shards[keys[k]] {
+					sub.Insert(prefixes[i], data[i])
+				}
+				subtrees[k] = sub
+			}
+		}()
+	}
+	for k := range keys {
+		jobs <- k
+	}
+	close(jobs)
+	wg.Wait()
+
+	trie := joinShards(isIPv6, subtrees)
+	for _, i := range short {
+		trie.Insert(prefixes[i], data[i])
+	}
+	return trie
+}
+
+// joinShards grafts the subtrees built for distinct shards into one trie.
+func joinShards(isIPv6 bool, subtrees []*Trie) *Trie {
+	trie := NewTrie(isIPv6)
+	for _, sub := range subtrees {
+		// All prefixes of a shard share its first bits, so the subtree
+		// hangs off a single child of its root
+		for _, child := range sub.Root.Children {
+			if child != nil {
+				trie.graft(child)
+			}
+		}
+		trie.Count += sub.Count
+	}
+	return trie
+}
+
+// Builder builds a trie from prefixes added concurrently, as they arrive,
+// with the same sharding as BuildTrie: each shard is a subtree with its own
+// lock, so adds to different shards do not wait for each other. Since the
+// order of concurrent adds is not defined, a prefix added twice keeps the
+// data with the alphabetically last country code.
+type Builder struct {
+	isIPv6    bool
+	shardBits int
+
+	mu     sync.Mutex
+	shards map[uint32]*shard
+	// short holds the prefixes spanning several shards, inserted last
+	short []shardEntry
+	// duplicates holds the countries of prefixes added for more than one
+	duplicates map[netip.Prefix]map[string]bool
+}
+
+// Duplicate is a prefix that was added for more than one country.
+type Duplicate struct {
+	Prefix netip.Prefix
+	// Countries are sorted; the trie keeps the last one.
+	Countries []string
+}
+
+type shard struct {
+	mu   sync.Mutex
+	trie *Trie
+}
+
+type shardEntry struct {
+	prefix netip.Prefix
+	data   PrefixData
+}
+
+// NewBuilder creates a builder for an IPv4 or IPv6 trie.
+func NewBuilder(isIPv6 bool) *Builder {
+	shardBits := shardBitsV4
+	if isIPv6 {
+		shardBits = shardBitsV6
+	}
+	return &Builder{isIPv6: isIPv6, shardBits: shardBits, shards: make(map[uint32]*shard)}
+}
+
+// Add adds a prefix. It is safe for concurrent use.
+func (b *Builder) Add(prefix netip.Prefix, data PrefixData) error {
+	if prefix.Addr().Is6() != b.isIPv6 {
+		return fmt.Errorf("IP version mismatch")
+	}
+	if prefix.Bits() < b.shardBits {
+		b.mu.Lock()
+		b.short = append(b.short, shardEntry{prefix, data})
+		b.mu.Unlock()
+		return nil
+	}
+
+	key := shardKey(prefix.Addr(), b.shardBits)
+	b.mu.Lock()
+	s, ok := b.shards[key]
+	if !ok {
+		s = &shard{trie: NewTrie(b.isIPv6)}
+		b.shards[key] = s
+	}
+	b.mu.Unlock()
+
+	s.mu.Lock()
+	other := s.trie.insertLatest(prefix, data)
+	s.mu.Unlock()
+	if other != "" {
+		b.mu.Lock()
+		b.addDuplicate(prefix, other, data.CountryCode)
+		b.mu.Unlock()
+	}
+	return nil
+}
+
+// addDuplicate records that prefix was added for both countries. The
+// caller holds b.mu.
+func (b *Builder) addDuplicate(prefix netip.Prefix, cc1, cc2 string) {
+	if b.duplicates == nil {
+		b.duplicates = make(map[netip.Prefix]map[string]bool)
+	}
+	set, ok := b.duplicates[prefix]
+	if !ok {
+		set = make(map[string]bool)
+		b.duplicates[prefix] = set
+	}
+	set[cc1], set[cc2] = true, true
+}
+
+// Duplicates returns the prefixes added for more than one country, sorted
+// by prefix. Call it after Trie.
+func (b *Builder) Duplicates() []Duplicate {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	dups := make([]Duplicate, 0, len(b.duplicates))
+	for p, set := range b.duplicates {
+		d := Duplicate{Prefix: p}
+		for cc := range set {
+			d.Countries = append(d.Countries, cc)
+		}
+		sort.Strings(d.Countries)
+		dups = append(dups, d)
+	}
+	sort.Slice(dups, func(i, j int) bool {
+		a, b := dups[i].Prefix, dups[j].Prefix
+		if a.Addr() != b.Addr() {
+			return a.Addr().Less(b.Addr())
+		}
+		return a.Bits() < b.Bits()
+	})
+	return dups
+}
+
+// Trie joins the shards into the finished trie. The builder must not be
+// used afterwards.
+func (b *Builder) Trie() *Trie {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subtrees := make([]*Trie, 0, len(b.shards))
+	for _, s := range b.shards {
+		subtrees = append(subtrees, s.trie)
+	}
+	trie := joinShards(b.isIPv6, subtrees)
+	for _, e := range b.short {
+		if other := trie.insertLatest(e.prefix, e.data); other != "" {
+			b.addDuplicate(e.prefix, other, e.data.CountryCode)
+		}
+	}
+	b.shards, b.short = nil, nil
+	return trie
+}
+
+// insertLatest inserts like Insert, except that an existing entry for the
+// same prefix is kept if its country code sorts after the new one. It
+// returns the country of an existing entry for another country, if any.
+func (t *Trie) insertLatest(prefix netip.Prefix, data PrefixData) string {
+	data.Bits = uint8(prefix.Bits())
+	data.CountryCode = internCountry(data.CountryCode)
+	d := &data
+	var other string
+	if existing := t.lookupExact(prefix); existing != nil {
+		if existing.CountryCode != data.CountryCode {
+			other = existing.CountryCode
+		}
+		if existing.CountryCode > data.CountryCode {
+			d = existing
+		}
+	}
+	t.insertRecursive(t.Root, prefixToBits(prefix), 0, prefix.Bits(), d)
+	t.Count++
+	return other
+}
+
+// lookupExact returns the data stored for exactly prefix, if any.
+func (t *Trie) lookupExact(prefix netip.Prefix) *PrefixData {
+	bits := prefixToBits(prefix)
+	node, pos := t.Root, 0
+	for pos < prefix.Bits() {
+		child := node.Children[getBit(bits, pos)]
+		if child == nil || pos+child.PrefixLen > prefix.Bits() {
+			return nil
+		}
+		for i := 0; i < child.PrefixLen; i++ {
+			if getBit(bits, pos+i) != getBit(child.Prefix, i) {
+				return nil
+			}
+		}
+		pos += child.PrefixLen
+		node = child
+	}
+	return node.Data
+}
+
+// shardKey returns the first bits of addr.
+func shardKey(addr netip.Addr, bits int) uint32 {
+	b := addr.AsSlice()
+	var key uint32
+	for i := 0; i < bits; i++ {
+		key = key<<1 | uint32(getBit(b, i))
+	}
+	return key
+}
+
+// graft attaches node, whose Prefix holds its path from the root, below
+// the root. Its path must not end at or pass through a node carrying
+// data, which holds for subtrees of distinct shards.
+func (t *Trie) graft(node *TrieNode) {
+	parent := t.Root
+	bits, length := node.Prefix, node.PrefixLen
+	pos := 0
+	for {
+		bit := getBit(bits, pos)
+		child := parent.Children[bit]
+		if child == nil {
+			node.Prefix = extractBits(bits, pos, length-pos)
+			node.PrefixLen = length - pos
+			parent.Children[bit] = node
+			return
+		}
+
+		commonLen := 0
+		for commonLen < child.PrefixLen && pos+commonLen < length &&
+			getBit(bits, pos+commonLen) == getBit(child.Prefix, commonLen) {
+			commonLen++
+		}
+		if commonLen == child.PrefixLen {
+			// Pass through an intermediate node
+			pos += commonLen
+			parent = child
+			continue
+		}
+
+		// Split the child where the paths diverge
+		split := &TrieNode{
+			Prefix:    extractBits(bits, pos, commonLen),
+			PrefixLen: commonLen,
+		}
+		oldBit := getBit(child.Prefix, commonLen)
+		child.Prefix = extractBits(child.Prefix, commonLen, child.PrefixLen-commonLen)
+		child.PrefixLen -= commonLen
+		split.Children[oldBit] = child
+
+		node.Prefix = extractBits(bits, pos+commonLen, length-pos-commonLen)
+		node.PrefixLen = length - pos - commonLen
+		split.Children[getBit(bits, pos+commonLen)] = node
+		parent.Children[bit] = split
+		return
+	}
+}
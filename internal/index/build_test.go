@@ -0,0 +1,161 @@
+package index
+
+import (
+	"math/rand"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func randomPrefixes(r *rand.Rand, isIPv6 bool, n int) ([]netip.Prefix, []PrefixData) {
+	codes := []string{"US", "DE", "NL", "CN"}
+	prefixes := make([]netip.Prefix, 0, n)
+	data := make([]PrefixData, 0, n)
+	for i := 0; i < n; i++ {
+		var p netip.Prefix
+		if isIPv6 {
+			var b [16]byte
+			b[0] = 0x20
+			b[1] = byte(r.Intn(4))
+			r.Read(b[2:8])
+			p = netip.PrefixFrom(netip.AddrFrom16(b), 8+r.Intn(57)).Masked()
+		} else {
+			var b [4]byte
+			r.Read(b[:])
+			p = netip.PrefixFrom(netip.AddrFrom4(b), 4+r.Intn(29)).Masked()
+		}
+		prefixes = append(prefixes, p)
+		data = append(data, PrefixData{CountryCode: codes[r.Intn(len(codes))], Bits: uint8(p.Bits())})
+	}
+	// Duplicates keep the data of the last occurrence
+	for i := 0; i < n/10; i++ {
+		prefixes = append(prefixes, prefixes[i])
+		data = append(data, PrefixData{CountryCode: "FR", Bits: uint8(prefixes[i].Bits())})
+	}
+	return prefixes, data
+}
+
+func TestBuildTrie(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, isIPv6 := range []bool{false, true} {
+		prefixes, data := randomPrefixes(r, isIPv6, 5000)
+
+		sequential := NewTrie(isIPv6)
+		for i, p := range prefixes {
+			sequential.Insert(p, data[i])
+		}
+		parallel := BuildTrie(isIPv6, prefixes, data, 4)
+
+		if parallel.Count != sequential.Count {
+			t.Errorf("IPv6=%v: Count = %d, expected %d", isIPv6, parallel.Count, sequential.Count)
+		}
+		wantPrefixes, wantData := sequential.Export()
+		gotPrefixes, gotData := parallel.Export()
+		if len(gotPrefixes) != len(wantPrefixes) {
+			t.Fatalf("IPv6=%v: Export returned %d prefixes, expected %d", isIPv6, len(gotPrefixes), len(wantPrefixes))
+		}
+		for i := range wantPrefixes {
+			if gotPrefixes[i] != wantPrefixes[i] || gotData[i] != wantData[i] {
+				t.Fatalf("IPv6=%v: entry %d = %s %+v, expected %s %+v", isIPv6, i, gotPrefixes[i], gotData[i], wantPrefixes[i], wantData[i])
+			}
+		}
+
+		// The encoded indices are identical
+		if string(encodeTrie(parallel, isIPv6)) != string(encodeTrie(sequential, isIPv6)) {
+			t.Errorf("IPv6=%v: encoded tries differ", isIPv6)
+		}
+	}
+}
+
+func TestBuildTrieSkipsOtherVersion(t *testing.T) {
+	prefixes := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("2001:db8::/32")}
+	data := []PrefixData{{CountryCode: "US"}, {CountryCode: "US"}}
+	if trie := BuildTrie(false, prefixes, data, 2); trie.Count != 1 {
+		t.Errorf("Count = %d, expected 1", trie.Count)
+	}
+}
+
+func BenchmarkBuildTrie(b *testing.B) {
+	prefixes, data := randomPrefixes(rand.New(rand.NewSource(1)), false, 200000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		BuildTrie(false, prefixes, data, 8)
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	prefixes, data := randomPrefixes(r, false, 5000)
+
+	// Concurrent adds resolve duplicates by the later country code, which
+	// is what inserting in country order gives
+	order := make([]int, len(prefixes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return data[order[a]].CountryCode < data[order[b]].CountryCode })
+	sequential := NewTrie(false)
+	for _, i := range order {
+		sequential.Insert(prefixes[i], data[i])
+	}
+
+	b := NewBuilder(false)
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := len(prefixes) - 1 - w; i >= 0; i -= 4 {
+				b.Add(prefixes[i], data[i])
+			}
+		}(w)
+	}
+	wg.Wait()
+	if err := b.Add(netip.MustParsePrefix("2001:db8::/32"), PrefixData{CountryCode: "US"}); err == nil {
+		t.Error("Add should reject a prefix of the other IP version")
+	}
+	built := b.Trie()
+
+	if built.Count != sequential.Count {
+		t.Errorf("Count = %d, expected %d", built.Count, sequential.Count)
+	}
+	if string(encodeTrie(built, false)) != string(encodeTrie(sequential, false)) {
+		t.Error("encoded tries differ")
+	}
+}
+
+func TestBuilderDuplicates(t *testing.T) {
+	b := NewBuilder(false)
+	adds := []struct {
+		cidr, cc string
+	}{
+		{"10.0.0.0/24", "DE"},
+		{"10.0.0.0/24", "NL"},
+		{"10.0.0.0/24", "DE"},
+		{"10.0.0.0/24", "AT"},
+		{"10.0.1.0/24", "DE"},
+		{"10.0.1.0/24", "DE"},
+		{"0.0.0.0/4", "US"},
+		{"0.0.0.0/4", "CA"},
+	}
+	for _, a := range adds {
+		b.Add(netip.MustParsePrefix(a.cidr), PrefixData{CountryCode: a.cc})
+	}
+	trie := b.Trie()
+
+	dups := b.Duplicates()
+	if len(dups) != 2 {
+		t.Fatalf("Duplicates = %+v, expected 2", dups)
+	}
+	if dups[0].Prefix.String() != "0.0.0.0/4" || strings.Join(dups[0].Countries, ",") != "CA,US" {
+		t.Errorf("Duplicates[0] = %+v, expected 0.0.0.0/4 CA,US", dups[0])
+	}
+	if dups[1].Prefix.String() != "10.0.0.0/24" || strings.Join(dups[1].Countries, ",") != "AT,DE,NL" {
+		t.Errorf("Duplicates[1] = %+v, expected 10.0.0.0/24 AT,DE,NL", dups[1])
+	}
+	if data, _ := trie.LookupString("10.0.0.1"); data == nil || data.CountryCode != "NL" {
+		t.Errorf("Lookup(10.0.0.1) = %+v, expected the last country NL", data)
+	}
+}
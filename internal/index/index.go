@@ -0,0 +1,17 @@
+package index
+
+import "net/netip"
+
+// Index pairs the IPv4 and IPv6 tries of one snapshot.
+type Index struct {
+	V4 *Trie
+	V6 *Trie
+}
+
+// Lookup finds the longest matching prefix in the trie for the address family.
+func (ix *Index) Lookup(ip netip.Addr) *PrefixData {
+	if ip.Is4() {
+		return ix.V4.Lookup(ip)
+	}
+	return ix.V6.Lookup(ip)
+}
@@ -0,0 +1,29 @@
+package index
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func newTestIndex(t *testing.T, cc string) *Index {
+	t.Helper()
+	ix := &Index{V4: NewTrie(false), V6: NewTrie(true)}
+	if err := ix.V4.InsertCIDR("8.8.8.0/24", cc); err != nil {
+		t.Fatalf("InsertCIDR failed: %v", err)
+	}
+	if err := ix.V6.InsertCIDR("2001:4860::/32", cc); err != nil {
+		t.Fatalf("InsertCIDR failed: %v", err)
+	}
+	return ix
+}
+
+func TestIndexLookup(t *testing.T) {
+	ix := newTestIndex(t, "US")
+
+	for _, ip := range []string{"8.8.8.8", "2001:4860::1"} {
+		data := ix.Lookup(netip.MustParseAddr(ip))
+		if data == nil || data.CountryCode != "US" {
+			t.Errorf("Lookup(%s) = %+v, expected US", ip, data)
+		}
+	}
+}
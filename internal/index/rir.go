@@ -0,0 +1,39 @@
+package index
+
+import "strings"
+
+// RIR identifies the Regional Internet Registry a prefix was delegated by.
+type RIR uint8
+
+// Regional Internet Registries
+const (
+	RIRUnknown RIR = iota
+	AFRINIC
+	APNIC
+	ARIN
+	LACNIC
+	RIPENCC
+)
+
+// rirNames are the registry names used in delegated statistics files.
+var rirNames = [...]string{"", "afrinic", "apnic", "arin", "lacnic", "ripencc"}
+
+// ParseRIR returns the registry of a name as used in delegated statistics
+// files, such as "ripencc", or RIRUnknown.
+func ParseRIR(name string) RIR {
+	name = strings.ToLower(name)
+	for i, n := range rirNames {
+		if i > 0 && n == name {
+			return RIR(i)
+		}
+	}
+	return RIRUnknown
+}
+
+// String returns the registry name, or "" for RIRUnknown.
+func (r RIR) String() string {
+	if int(r) >= len(rirNames) {
+		return ""
+	}
+	return rirNames[r]
+}
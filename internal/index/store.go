@@ -1,13 +1,41 @@
 // Package index provides binary serialization for the trie.
+//
+// Index files use a fully specified little-endian layout, independent of the
+// machine that wrote them:
+//
+//	header (32 bytes):
+//	  magic       [8]byte  "IP2CCIDX"
+//	  version     uint32
+//	  flags       uint32   FlagHasIPv4 or FlagHasIPv6
+//	  reserved    [16]byte
+//	nodes, depth first (left child before right child):
+//	  flags       uint8    nodeHasData | nodeHasLeft | nodeHasRight | nodeHasASN | nodeHasHolder | nodeHasRIR | nodeHasAllocated
+//	  prefix_len  uint8
+//	  prefix      [(prefix_len+7)/8]byte
+//	  if nodeHasData:
+//	    country   [2]byte
+//	    cidr_len  uint16
+//	    cidr      [cidr_len]byte
+//	  if nodeHasASN:
+//	    asn       uint32
+//	  if nodeHasHolder (version 3):
+//	    holder_len uint8
+//	    holder    [holder_len]byte
+//	  if nodeHasRIR (version 3):
+//	    rir       uint8    1 afrinic, 2 apnic, 3 arin, 4 lacnic, 5 ripencc
+//	  if nodeHasAllocated (version 3):
+//	    allocated uint32   allocation date as YYYYMMDD
+//	trailer:
+//	  count       uint32   number of inserted prefixes
 package index
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
 	"os"
+	"unicode/utf8"
 
 	"github.com/hightemp/ip2cc/internal/config"
 )
@@ -17,6 +45,17 @@ const (
 	Magic = "IP2CCIDX"
 	// Header size in bytes
 	HeaderSize = 32
+
+	// MaxNodes bounds the nodes read from an index file, well above the
+	// few million a full IPv6 index needs, so a corrupt file cannot make
+	// the loader allocate without limit.
+	MaxNodes = 1 << 24
+	// maxCIDRLen is the length of the longest CIDR string,
+	// "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff/128".
+	maxCIDRLen = 43
+	// MaxHolderLen is the length in bytes up to which holder names are
+	// stored; longer names are truncated.
+	MaxHolderLen = 255
 )
 
 // Flags for index file
@@ -25,6 +64,19 @@ const (
 	FlagHasIPv6
 )
 
+// Flags for serialized nodes
+const (
+	nodeHasData byte = 1 << iota
+	nodeHasLeft
+	nodeHasRight
+	nodeHasASN
+	nodeHasHolder
+	nodeHasRIR
+	nodeHasAllocated
+
+	knownNodeFlags = nodeHasData | nodeHasLeft | nodeHasRight | nodeHasASN | nodeHasHolder | nodeHasRIR | nodeHasAllocated
+)
+
 // Header represents the index file header.
 type Header struct {
 	Magic      [8]byte
@@ -77,163 +129,418 @@ func saveTrie(path string, trie *Trie, isIPv6 bool) error {
 	}
 	defer f.Close()
 
-	w := bufio.NewWriter(f)
-
-	// Write header
-	header := Header{
-		Version: config.IndexFormatVersion,
+	if _, err := f.Write(encodeTrie(trie, isIPv6)); err != nil {
+		return err
 	}
-	copy(header.Magic[:], Magic)
+	return f.Close()
+}
+
+// encodeTrie serializes a trie in the current index format.
+func encodeTrie(trie *Trie, isIPv6 bool) []byte {
+	buf := make([]byte, 0, HeaderSize+trie.Count*16)
+
+	// Header
+	buf = append(buf, Magic...)
+	buf = binary.LittleEndian.AppendUint32(buf, config.IndexFormatVersion)
 	if isIPv6 {
-		header.Flags = FlagHasIPv6
+		buf = binary.LittleEndian.AppendUint32(buf, FlagHasIPv6)
 	} else {
-		header.Flags = FlagHasIPv4
+		buf = binary.LittleEndian.AppendUint32(buf, FlagHasIPv4)
 	}
+	buf = binary.LittleEndian.AppendUint64(buf, 0) // IPv4Offset (reserved)
+	buf = binary.LittleEndian.AppendUint64(buf, 0) // IPv6Offset (reserved)
 
-	if err := binary.Write(w, binary.LittleEndian, &header); err != nil {
-		return err
-	}
+	var acc [16]byte
+	buf = appendNode(buf, trie, trie.Root, acc, 0)
 
-	// Serialize nodes
-	if err := serializeNode(w, trie.Root); err != nil {
-		return err
+	// Node count at the end for verification
+	return binary.LittleEndian.AppendUint32(buf, uint32(trie.Count))
+}
+
+// appendNode serializes node and its children; acc holds the path of depth
+// bits leading to node, from which the CIDR strings are written.
+func appendNode(buf []byte, trie *Trie, node *TrieNode, acc [16]byte, depth int) []byte {
+	var flags byte
+	if node.Data != nil {
+		flags |= nodeHasData
+	}
+	if node.Children[0] != nil {
+		flags |= nodeHasLeft
+	}
+	if node.Children[1] != nil {
+		flags |= nodeHasRight
 	}
+	if node.Data != nil && node.Data.ASN != 0 {
+		flags |= nodeHasASN
+	}
+	if node.Data != nil && node.Data.Holder != "" {
+		flags |= nodeHasHolder
+	}
+	if node.Data != nil && node.Data.RIR != RIRUnknown {
+		flags |= nodeHasRIR
+	}
+	if node.Data != nil && node.Data.Allocated != 0 {
+		flags |= nodeHasAllocated
+	}
+	buf = append(buf, flags, uint8(node.PrefixLen))
 
-	// Write node count at the end for verification
-	if err := binary.Write(w, binary.LittleEndian, uint32(trie.Count)); err != nil {
-		return err
+	// Prefix bytes, zero padded
+	prefixBytes := (node.PrefixLen + 7) / 8
+	for i := 0; i < prefixBytes; i++ {
+		if i < len(node.Prefix) {
+			buf = append(buf, node.Prefix[i])
+		} else {
+			buf = append(buf, 0)
+		}
 	}
 
-	return w.Flush()
-}
+	depth = extendPath(&acc, depth, node)
+	if node.Data != nil {
+		var cc [2]byte
+		copy(cc[:], node.Data.CountryCode)
+		buf = append(buf, cc[:]...)
+		cidr := trie.makePrefix(acc, depth).String()
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(len(cidr)))
+		buf = append(buf, cidr...)
+		if node.Data.ASN != 0 {
+			buf = binary.LittleEndian.AppendUint32(buf, node.Data.ASN)
+		}
+		if holder := TruncateHolder(node.Data.Holder); holder != "" {
+			buf = append(buf, uint8(len(holder)))
+			buf = append(buf, holder...)
+		}
+		if node.Data.RIR != RIRUnknown {
+			buf = append(buf, byte(node.Data.RIR))
+		}
+		if node.Data.Allocated != 0 {
+			buf = binary.LittleEndian.AppendUint32(buf, node.Data.Allocated)
+		}
+	}
 
-func serializeNode(w io.Writer, node *TrieNode) error {
-	if node == nil {
-		// Write nil marker
-		if err := binary.Write(w, binary.LittleEndian, uint8(0xFF)); err != nil {
-			return err
+	for _, child := range node.Children {
+		if child != nil {
+			buf = appendNode(buf, trie, child, acc, depth)
 		}
-		return nil
 	}
+	return buf
+}
 
-	// Write prefix length
-	if err := binary.Write(w, binary.LittleEndian, uint8(node.PrefixLen)); err != nil {
-		return err
+func loadTrie(path string, isIPv6 bool) (*Trie, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
 	}
+	return decodeTrie(data, isIPv6)
+}
 
-	// Write prefix bytes
-	prefixBytes := (node.PrefixLen + 7) / 8
-	if prefixBytes > 0 {
-		if len(node.Prefix) < prefixBytes {
-			// Pad with zeros
-			padded := make([]byte, prefixBytes)
-			copy(padded, node.Prefix)
-			if _, err := w.Write(padded); err != nil {
-				return err
-			}
-		} else {
-			if _, err := w.Write(node.Prefix[:prefixBytes]); err != nil {
-				return err
-			}
-		}
+// Decode parses a serialized index file held in memory.
+func Decode(data []byte, isIPv6 bool) (*Trie, error) {
+	return decodeTrie(data, isIPv6)
+}
+
+// decodeTrie parses a serialized trie of any supported format version.
+func decodeTrie(data []byte, isIPv6 bool) (*Trie, error) {
+	header, err := readHeader(data)
+	if err != nil {
+		return nil, err
 	}
 
-	// Write has data flag
-	hasData := node.Data != nil
-	if err := binary.Write(w, binary.LittleEndian, hasData); err != nil {
-		return err
+	trie := NewTrie(isIPv6)
+	var count uint32
+
+	limits := &nodeLimits{maxBits: 32}
+	if isIPv6 {
+		limits.maxBits = 128
 	}
 
-	// Write data if present
-	if hasData {
-		// Country code (2 bytes)
-		var cc [2]byte
-		if len(node.Data.CountryCode) >= 2 {
-			cc[0] = node.Data.CountryCode[0]
-			cc[1] = node.Data.CountryCode[1]
+	switch header.Version {
+	case 1:
+		r := bytes.NewReader(data[HeaderSize:])
+		root, err := deserializeNodeV1(r, 0, limits)
+		if err != nil {
+			return nil, fmt.Errorf("deserialize nodes: %w", err)
 		}
-		if _, err := w.Write(cc[:]); err != nil {
-			return err
+		trie.Root = root
+		if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+			return nil, fmt.Errorf("read count: %w", err)
 		}
-
-		// Prefix string (length + data)
-		prefixStr := []byte(node.Data.PrefixStr)
-		if err := binary.Write(w, binary.LittleEndian, uint16(len(prefixStr))); err != nil {
-			return err
+	case 2, config.IndexFormatVersion:
+		// Version 2 is version 3 without holders
+		d := &decoder{data: data, pos: HeaderSize, limits: limits, holders: make(map[string]string)}
+		root, err := d.node(0)
+		if err != nil {
+			return nil, fmt.Errorf("deserialize nodes: %w", err)
 		}
-		if _, err := w.Write(prefixStr); err != nil {
-			return err
+		trie.Root = root
+		if count, err = d.uint32(); err != nil {
+			return nil, fmt.Errorf("read count: %w", err)
 		}
+	default:
+		return nil, fmt.Errorf("unsupported index version %d (expected %d)", header.Version, config.IndexFormatVersion)
 	}
 
-	// Write children flags and recurse
-	hasLeft := node.Children[0] != nil
-	hasRight := node.Children[1] != nil
-	if err := binary.Write(w, binary.LittleEndian, hasLeft); err != nil {
-		return err
+	if trie.Root == nil {
+		trie.Root = &TrieNode{}
 	}
-	if err := binary.Write(w, binary.LittleEndian, hasRight); err != nil {
-		return err
+	// The trailer counts inserts, duplicates included; the count is taken
+	// from the prefixes read rather than trusted
+	if int(count) < limits.prefixes {
+		return nil, fmt.Errorf("trailer counts %d prefixes, but %d were read", count, limits.prefixes)
 	}
+	trie.Count = limits.prefixes
+	return trie, nil
+}
 
-	if hasLeft {
-		if err := serializeNode(w, node.Children[0]); err != nil {
-			return err
-		}
+// readHeader parses and validates the fixed-size file header.
+func readHeader(data []byte) (*Header, error) {
+	if len(data) < HeaderSize {
+		return nil, fmt.Errorf("read header: file too short")
 	}
-	if hasRight {
-		if err := serializeNode(w, node.Children[1]); err != nil {
-			return err
-		}
+
+	header := &Header{
+		Version:    binary.LittleEndian.Uint32(data[8:12]),
+		Flags:      binary.LittleEndian.Uint32(data[12:16]),
+		IPv4Offset: binary.LittleEndian.Uint64(data[16:24]),
+		IPv6Offset: binary.LittleEndian.Uint64(data[24:32]),
 	}
+	copy(header.Magic[:], data[:8])
 
-	return nil
+	// Validate magic
+	if string(header.Magic[:]) != Magic {
+		return nil, fmt.Errorf("invalid magic: %s", header.Magic)
+	}
+	return header, nil
 }
 
-func loadTrie(path string, isIPv6 bool) (*Trie, error) {
-	data, err := os.ReadFile(path)
+// ReadVersion returns the format version of an index file.
+func ReadVersion(path string) (uint32, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
+	defer f.Close()
 
-	r := bytes.NewReader(data)
+	data := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(f, data); err != nil {
+		return 0, fmt.Errorf("read header: %w", err)
+	}
+	header, err := readHeader(data)
+	if err != nil {
+		return 0, err
+	}
+	return header.Version, nil
+}
 
-	// Read header
-	var header Header
-	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
-		return nil, fmt.Errorf("read header: %w", err)
+// ConvertFile rewrites an index file in the current format version.
+// It returns the version the file had; files already current are left alone.
+func ConvertFile(path string, isIPv6 bool) (uint32, error) {
+	version, err := ReadVersion(path)
+	if err != nil {
+		return 0, err
+	}
+	if version == config.IndexFormatVersion {
+		return version, nil
 	}
 
-	// Validate magic
-	if string(header.Magic[:]) != Magic {
-		return nil, fmt.Errorf("invalid magic: %s", header.Magic)
+	trie, err := loadTrie(path, isIPv6)
+	if err != nil {
+		return version, err
 	}
 
-	// Validate version
-	if header.Version != config.IndexFormatVersion {
-		return nil, fmt.Errorf("unsupported index version %d (expected %d)", header.Version, config.IndexFormatVersion)
+	// Write to a temporary file first so a failure never leaves a truncated index
+	tmpPath := path + ".tmp"
+	if err := saveTrie(tmpPath, trie, isIPv6); err != nil {
+		os.Remove(tmpPath)
+		return version, err
 	}
+	return version, os.Rename(tmpPath, path)
+}
 
-	trie := NewTrie(isIPv6)
+// nodeLimits checks the nodes of an index file as they are read. Every
+// node below the root adds at least one bit to the path, so bounding the
+// path by the address length also bounds the recursion depth.
+type nodeLimits struct {
+	maxBits  int
+	nodes    int
+	prefixes int
+}
+
+// check accounts for a node of prefixLen bits below a path of depth bits.
+func (l *nodeLimits) check(depth, prefixLen int) error {
+	l.nodes++
+	if l.nodes > MaxNodes {
+		return fmt.Errorf("more than %d nodes", MaxNodes)
+	}
+	if depth > 0 && prefixLen == 0 {
+		return fmt.Errorf("empty node prefix at bit %d", depth)
+	}
+	if depth+prefixLen > l.maxBits {
+		return fmt.Errorf("node prefix ends at bit %d, beyond the %d address bits", depth+prefixLen, l.maxBits)
+	}
+	return nil
+}
+
+// checkCIDRLen rejects CIDR strings longer than any valid one.
+func checkCIDRLen(n uint16) error {
+	if n > maxCIDRLen {
+		return fmt.Errorf("CIDR string length %d exceeds %d", n, maxCIDRLen)
+	}
+	return nil
+}
+
+// TruncateHolder shortens holder to at most MaxHolderLen bytes, on a
+// UTF-8 character boundary.
+func TruncateHolder(holder string) string {
+	if len(holder) <= MaxHolderLen {
+		return holder
+	}
+	n := MaxHolderLen
+	for n > 0 && !utf8.RuneStart(holder[n]) {
+		n--
+	}
+	return holder[:n]
+}
 
-	// Deserialize nodes
-	root, err := deserializeNode(r)
+// decoder reads the current node format from a byte slice.
+type decoder struct {
+	data   []byte
+	pos    int
+	limits *nodeLimits
+	// holders interns holder names, which many prefixes share
+	holders map[string]string
+}
+
+func (d *decoder) next(n int) ([]byte, error) {
+	if d.pos+n > len(d.data) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *decoder) uint16() (uint16, error) {
+	b, err := d.next(2)
 	if err != nil {
-		return nil, fmt.Errorf("deserialize nodes: %w", err)
+		return 0, err
 	}
-	trie.Root = root
+	return binary.LittleEndian.Uint16(b), nil
+}
 
-	// Read node count
-	var count uint32
-	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
-		return nil, fmt.Errorf("read count: %w", err)
+func (d *decoder) uint32() (uint32, error) {
+	b, err := d.next(4)
+	if err != nil {
+		return 0, err
 	}
-	trie.Count = int(count)
+	return binary.LittleEndian.Uint32(b), nil
+}
 
-	return trie, nil
+// holder reads a length-prefixed holder name.
+func (d *decoder) holder() (string, error) {
+	n, err := d.next(1)
+	if err != nil {
+		return "", err
+	}
+	b, err := d.next(int(n[0]))
+	if err != nil {
+		return "", err
+	}
+	if s, ok := d.holders[string(b)]; ok {
+		return s, nil
+	}
+	s := string(b)
+	d.holders[s] = s
+	return s, nil
 }
 
-func deserializeNode(r io.Reader) (*TrieNode, error) {
+// node reads a node below a path of depth bits, and its children.
+func (d *decoder) node(depth int) (*TrieNode, error) {
+	b, err := d.next(2)
+	if err != nil {
+		return nil, err
+	}
+	flags, prefixLen := b[0], int(b[1])
+	if flags&^knownNodeFlags != 0 {
+		return nil, fmt.Errorf("unknown node flags %#x", flags)
+	}
+	if err := d.limits.check(depth, prefixLen); err != nil {
+		return nil, err
+	}
+
+	node := &TrieNode{PrefixLen: prefixLen}
+	depth += prefixLen
+	if prefixBytes := (prefixLen + 7) / 8; prefixBytes > 0 {
+		prefix, err := d.next(prefixBytes)
+		if err != nil {
+			return nil, err
+		}
+		node.Prefix = append([]byte(nil), prefix...)
+	}
+
+	if flags&nodeHasData != 0 {
+		cc, err := d.next(2)
+		if err != nil {
+			return nil, err
+		}
+		strLen, err := d.uint16()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkCIDRLen(strLen); err != nil {
+			return nil, err
+		}
+		// The CIDR string repeats the path and is not kept
+		if _, err := d.next(int(strLen)); err != nil {
+			return nil, err
+		}
+		node.Data = &PrefixData{
+			CountryCode: internCountry(cc),
+			Bits:        uint8(depth),
+		}
+		d.limits.prefixes++
+		if flags&nodeHasASN != 0 {
+			if node.Data.ASN, err = d.uint32(); err != nil {
+				return nil, err
+			}
+		}
+		if flags&nodeHasHolder != 0 {
+			if node.Data.Holder, err = d.holder(); err != nil {
+				return nil, err
+			}
+		}
+		if flags&nodeHasRIR != 0 {
+			rir, err := d.next(1)
+			if err != nil {
+				return nil, err
+			}
+			if node.Data.RIR = RIR(rir[0]); node.Data.RIR.String() == "" {
+				return nil, fmt.Errorf("unknown RIR %d", rir[0])
+			}
+		}
+		if flags&nodeHasAllocated != 0 {
+			if node.Data.Allocated, err = d.uint32(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for i, mask := range []byte{nodeHasLeft, nodeHasRight} {
+		if flags&mask == 0 {
+			continue
+		}
+		child, err := d.node(depth)
+		if err != nil {
+			return nil, err
+		}
+		node.Children[i] = child
+	}
+
+	return node, nil
+}
+
+// deserializeNodeV1 reads the legacy version 1 node format, which relied on
+// encoding/binary's encoding of Go bools.
+func deserializeNodeV1(r io.Reader, depth int, limits *nodeLimits) (*TrieNode, error) {
 	// Read prefix length
 	var prefixLen uint8
 	if err := binary.Read(r, binary.LittleEndian, &prefixLen); err != nil {
@@ -244,10 +551,14 @@ func deserializeNode(r io.Reader) (*TrieNode, error) {
 	if prefixLen == 0xFF {
 		return nil, nil
 	}
+	if err := limits.check(depth, int(prefixLen)); err != nil {
+		return nil, err
+	}
 
 	node := &TrieNode{
 		PrefixLen: int(prefixLen),
 	}
+	depth += int(prefixLen)
 
 	// Read prefix bytes
 	prefixBytes := (int(prefixLen) + 7) / 8
@@ -265,25 +576,27 @@ func deserializeNode(r io.Reader) (*TrieNode, error) {
 	}
 
 	if hasData {
-		node.Data = &PrefixData{}
+		node.Data = &PrefixData{Bits: uint8(depth)}
+		limits.prefixes++
 
 		// Read country code
 		var cc [2]byte
 		if _, err := io.ReadFull(r, cc[:]); err != nil {
 			return nil, err
 		}
-		node.Data.CountryCode = string(cc[:])
+		node.Data.CountryCode = internCountry(cc[:])
 
-		// Read prefix string
+		// Skip the prefix string, which repeats the path
 		var prefixStrLen uint16
 		if err := binary.Read(r, binary.LittleEndian, &prefixStrLen); err != nil {
 			return nil, err
 		}
-		prefixStr := make([]byte, prefixStrLen)
-		if _, err := io.ReadFull(r, prefixStr); err != nil {
+		if err := checkCIDRLen(prefixStrLen); err != nil {
+			return nil, err
+		}
+		if _, err := io.CopyN(io.Discard, r, int64(prefixStrLen)); err != nil {
 			return nil, err
 		}
-		node.Data.PrefixStr = string(prefixStr)
 	}
 
 	// Read children flags
@@ -296,14 +609,14 @@ func deserializeNode(r io.Reader) (*TrieNode, error) {
 	}
 
 	if hasLeft {
-		left, err := deserializeNode(r)
+		left, err := deserializeNodeV1(r, depth, limits)
 		if err != nil {
 			return nil, err
 		}
 		node.Children[0] = left
 	}
 	if hasRight {
-		right, err := deserializeNode(r)
+		right, err := deserializeNodeV1(r, depth, limits)
 		if err != nil {
 			return nil, err
 		}
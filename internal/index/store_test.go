@@ -1,9 +1,15 @@
 package index
 
 import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/hightemp/ip2cc/internal/config"
 )
 
 func TestSaveAndLoadIndex(t *testing.T) {
@@ -94,8 +100,8 @@ func TestSaveAndLoadIndex(t *testing.T) {
 	if err != nil {
 		t.Errorf("Lookup error: %v", err)
 	}
-	if result.PrefixStr != "8.8.8.0/24" {
-		t.Errorf("PrefixStr not preserved, got: %s", result.PrefixStr)
+	if got := result.Prefix(netip.MustParseAddr("8.8.8.8")).String(); got != "8.8.8.0/24" {
+		t.Errorf("Prefix not preserved, got: %s", got)
 	}
 }
 
@@ -158,3 +164,241 @@ func TestSaveAndLoadEmptyTrie(t *testing.T) {
 		t.Error("Expected nil result from empty trie")
 	}
 }
+
+// saveTrieV1 writes a trie in the legacy version 1 format.
+func saveTrieV1(t *testing.T, path string, trie *Trie, isIPv6 bool) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	header := Header{Version: 1, Flags: FlagHasIPv4}
+	if isIPv6 {
+		header.Flags = FlagHasIPv6
+	}
+	copy(header.Magic[:], Magic)
+	binary.Write(&buf, binary.LittleEndian, &header)
+
+	var writeNode func(node *TrieNode, acc [16]byte, depth int)
+	writeNode = func(node *TrieNode, acc [16]byte, depth int) {
+		depth = extendPath(&acc, depth, node)
+		binary.Write(&buf, binary.LittleEndian, uint8(node.PrefixLen))
+		padded := make([]byte, (node.PrefixLen+7)/8)
+		copy(padded, node.Prefix)
+		buf.Write(padded)
+		binary.Write(&buf, binary.LittleEndian, node.Data != nil)
+		if node.Data != nil {
+			buf.WriteString(node.Data.CountryCode)
+			cidr := trie.makePrefix(acc, depth).String()
+			binary.Write(&buf, binary.LittleEndian, uint16(len(cidr)))
+			buf.WriteString(cidr)
+		}
+		binary.Write(&buf, binary.LittleEndian, node.Children[0] != nil)
+		binary.Write(&buf, binary.LittleEndian, node.Children[1] != nil)
+		for _, child := range node.Children {
+			if child != nil {
+				writeNode(child, acc, depth)
+			}
+		}
+	}
+	writeNode(trie.Root, [16]byte{}, 0)
+	binary.Write(&buf, binary.LittleEndian, uint32(trie.Count))
+
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write v1 index: %v", err)
+	}
+}
+
+func TestEncodeTrieLayout(t *testing.T) {
+	trie := NewTrie(false)
+	if err := trie.InsertCIDR("128.0.0.0/1", "US"); err != nil {
+		t.Fatalf("InsertCIDR failed: %v", err)
+	}
+
+	expected := []byte("IP2CCIDX")
+	expected = append(expected, 3, 0, 0, 0) // version
+	expected = append(expected, 1, 0, 0, 0) // flags: IPv4
+	expected = append(expected, make([]byte, 16)...)
+	expected = append(expected, nodeHasRight, 0)      // root
+	expected = append(expected, nodeHasData, 1, 0x80) // 1-bit prefix
+	expected = append(expected, 'U', 'S', 11, 0)      // country, cidr length
+	expected = append(expected, "128.0.0.0/1"...)     // cidr
+	expected = append(expected, 1, 0, 0, 0)           // count
+
+	got := encodeTrie(trie, false)
+	if !bytes.Equal(got, expected) {
+		t.Errorf("encodeTrie layout mismatch:\n got  %v\n want %v", got, expected)
+	}
+}
+
+func TestEncodeDecodeHolders(t *testing.T) {
+	trie := NewTrie(false)
+	trie.InsertCIDR("8.8.8.0/24", "US")
+	trie.InsertCIDR("8.8.4.0/24", "US")
+	trie.InsertCIDR("1.0.0.0/8", "AU")
+	long := strings.Repeat("é", 200)
+	trie.SetHolder(netip.MustParsePrefix("8.8.8.0/24"), "GOOGLE")
+	trie.SetHolder(netip.MustParsePrefix("8.8.4.0/24"), "GOOGLE")
+	trie.SetHolder(netip.MustParsePrefix("1.0.0.0/8"), long)
+	if trie.SetHolder(netip.MustParsePrefix("9.9.9.0/24"), "QUAD9") {
+		t.Error("SetHolder for a prefix not in the trie succeeded")
+	}
+
+	loaded, err := Decode(encodeTrie(trie, false), false)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	tests := []struct {
+		ip     string
+		holder string
+	}{
+		{"8.8.8.8", "GOOGLE"},
+		{"8.8.4.4", "GOOGLE"},
+		{"1.1.1.1", long[:254]},
+	}
+	for _, tt := range tests {
+		data, _ := loaded.LookupString(tt.ip)
+		if data == nil || data.Holder != tt.holder {
+			t.Errorf("Holder of %s = %+v, expected %q", tt.ip, data, tt.holder)
+		}
+	}
+}
+
+func TestEncodeDecodeRegistration(t *testing.T) {
+	trie := NewTrie(false)
+	trie.Insert(netip.MustParsePrefix("8.8.8.0/24"), PrefixData{CountryCode: "US", RIR: ARIN, Allocated: ParseAllocated("19921201")})
+	trie.Insert(netip.MustParsePrefix("1.0.0.0/8"), PrefixData{CountryCode: "AU"})
+
+	loaded, err := Decode(encodeTrie(trie, false), false)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if data, _ := loaded.LookupString("8.8.8.8"); data == nil || data.RIR != ARIN || data.AllocatedDate() != "1992-12-01" {
+		t.Errorf("Data of 8.8.8.8 = %+v, expected arin allocated 1992-12-01", data)
+	}
+	if data, _ := loaded.LookupString("1.1.1.1"); data == nil || data.RIR != RIRUnknown || data.AllocatedDate() != "" {
+		t.Errorf("Data of 1.1.1.1 = %+v, expected no RIR or allocation date", data)
+	}
+	if d := ParseAllocated("2025-01-01"); d != 0 {
+		t.Errorf("ParseAllocated(2025-01-01) = %d, expected 0", d)
+	}
+	if r := ParseRIR("RIPENCC"); r != RIPENCC || r.String() != "ripencc" {
+		t.Errorf("ParseRIR(RIPENCC) = %v, expected ripencc", r)
+	}
+}
+
+func TestLoadLegacyV1Index(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "index_v4.bin")
+
+	trie := NewTrie(false)
+	trie.InsertCIDR("8.8.8.0/24", "US")
+	trie.InsertCIDR("1.0.0.0/8", "AU")
+	saveTrieV1(t, path, trie, false)
+
+	loaded, err := loadTrie(path, false)
+	if err != nil {
+		t.Fatalf("loadTrie v1 failed: %v", err)
+	}
+	result, _ := loaded.LookupString("8.8.8.8")
+	if result == nil || result.CountryCode != "US" || result.Prefix(netip.MustParseAddr("8.8.8.8")).String() != "8.8.8.0/24" {
+		t.Errorf("Lookup in v1 index = %+v", result)
+	}
+	if loaded.Count != 2 {
+		t.Errorf("Count = %d, expected 2", loaded.Count)
+	}
+}
+
+func TestConvertFile(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "index_v6.bin")
+
+	trie := NewTrie(true)
+	trie.InsertCIDR("2001:4860::/32", "US")
+	saveTrieV1(t, path, trie, true)
+
+	from, err := ConvertFile(path, true)
+	if err != nil {
+		t.Fatalf("ConvertFile failed: %v", err)
+	}
+	if from != 1 {
+		t.Errorf("ConvertFile reported version %d, expected 1", from)
+	}
+
+	version, err := ReadVersion(path)
+	if err != nil {
+		t.Fatalf("ReadVersion failed: %v", err)
+	}
+	if version != config.IndexFormatVersion {
+		t.Errorf("Version after convert = %d, expected %d", version, config.IndexFormatVersion)
+	}
+
+	loaded, err := loadTrie(path, true)
+	if err != nil {
+		t.Fatalf("loadTrie after convert failed: %v", err)
+	}
+	result, _ := loaded.LookupString("2001:4860::1")
+	if result == nil || result.CountryCode != "US" {
+		t.Errorf("Lookup after convert = %+v", result)
+	}
+
+	// Converting again is a no-op
+	if from, err := ConvertFile(path, true); err != nil || from != config.IndexFormatVersion {
+		t.Errorf("Second ConvertFile = %d, %v", from, err)
+	}
+}
+
+func TestDecodeRejectsCorruptNodes(t *testing.T) {
+	header := []byte("IP2CCIDX")
+	header = append(header, 2, 0, 0, 0, 1, 0, 0, 0)
+	header = append(header, make([]byte, 16)...)
+
+	tests := []struct {
+		name  string
+		nodes []byte
+	}{
+		// A 33-bit prefix does not fit an IPv4 address
+		{"prefix too long", []byte{nodeHasLeft, 0, 0, 33, 0, 0, 0, 0, 0}},
+		// Empty child prefixes would nest without bound
+		{"empty child prefix", []byte{nodeHasLeft, 0, nodeHasLeft, 0, nodeHasLeft, 0}},
+		{"CIDR string too long", []byte{nodeHasData, 0, 'U', 'S', 0xff, 0xff}},
+		{"unknown flags", []byte{0x80, 0}},
+		{"unknown RIR", []byte{nodeHasData | nodeHasRIR, 0, 'U', 'S', 0, 0, 9}},
+	}
+	for _, tt := range tests {
+		data := append(append([]byte(nil), header...), tt.nodes...)
+		data = append(data, 0, 0, 0, 0)
+		if _, err := Decode(data, false); err == nil {
+			t.Errorf("%s: Decode should fail", tt.name)
+		}
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	v4, v6 := NewTrie(false), NewTrie(true)
+	v4.InsertCIDR("8.8.8.0/24", "US")
+	v4.InsertCIDR("1.0.0.0/8", "AU")
+	v4.InsertCIDR("0.0.0.0/0", "ZZ")
+	v6.InsertCIDR("2001:db8::/32", "NL")
+	f.Add(encodeTrie(v4, false), false)
+	f.Add(encodeTrie(v6, true), true)
+
+	f.Fuzz(func(t *testing.T, data []byte, isIPv6 bool) {
+		trie, err := Decode(data, isIPv6)
+		if err != nil {
+			return
+		}
+		// Whatever decodes must be usable
+		trie.Export()
+		trie.Lookup(netip.MustParseAddr("8.8.8.8"))
+		trie.Lookup(netip.MustParseAddr("2001:db8::1"))
+	})
+}
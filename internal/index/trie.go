@@ -2,15 +2,86 @@
 package index
 
 import (
+	"errors"
 	"fmt"
 	"net/netip"
-	"strings"
+	"sort"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/countries"
 )
 
-// PrefixData holds data associated with a prefix.
+// PrefixData holds data associated with a prefix. The prefix itself is
+// not stored: Bits, set on insert, and an address within it give it back.
 type PrefixData struct {
 	CountryCode string
-	PrefixStr   string // Original CIDR string
+	ASN         uint32 // Origin AS, set only in ASN database tries
+	Allocated   uint32 // Allocation date as YYYYMMDD, if the source records it
+	Bits        uint8  // Prefix length
+	RIR         RIR    // Delegating registry, if the source records it
+	// Holder is the main provider of the prefix, embedded at build time
+	// (update --embed-holders) for offline lookups
+	Holder string
+	// Source is where the country comes from when it is not the RIR
+	// index, e.g. "geofeed" for an overlay. It is not stored in index files.
+	Source string
+}
+
+// CountrySource returns Source, or "rir" for data of the index itself.
+func (d *PrefixData) CountrySource() string {
+	if d.Source == "" {
+		return "rir"
+	}
+	return d.Source
+}
+
+// AllocatedDate returns the allocation date as YYYY-MM-DD, or "" if it is
+// not known.
+func (d *PrefixData) AllocatedDate() string {
+	if d.Allocated == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%04d-%02d-%02d", d.Allocated/10000, d.Allocated/100%100, d.Allocated%100)
+}
+
+// ParseAllocated parses a YYYYMMDD date as used in delegated statistics
+// files for PrefixData.Allocated; it returns 0 for anything else.
+func ParseAllocated(s string) uint32 {
+	t, err := time.Parse("20060102", s)
+	if err != nil || t.Year() < 1000 {
+		return 0
+	}
+	return uint32(t.Year()*10000 + int(t.Month())*100 + t.Day())
+}
+
+// Prefix returns the stored prefix containing addr, such as the address
+// it was looked up for.
+func (d *PrefixData) Prefix(addr netip.Addr) netip.Prefix {
+	p, _ := addr.Prefix(int(d.Bits))
+	return p
+}
+
+// codes holds every two-letter code as a substring of one string, so the
+// country codes of all nodes share memory instead of allocating their own.
+var codes = func() [26 * 26]string {
+	var b [26 * 26 * 2]byte
+	for i := range 26 * 26 {
+		b[2*i], b[2*i+1] = byte('A'+i/26), byte('A'+i%26)
+	}
+	all := string(b[:])
+	var codes [26 * 26]string
+	for i := range codes {
+		codes[i] = all[2*i : 2*i+2]
+	}
+	return codes
+}()
+
+// internCountry returns cc as a shared string when it is a two-letter code.
+func internCountry[T string | []byte](cc T) string {
+	if len(cc) == 2 && cc[0] >= 'A' && cc[0] <= 'Z' && cc[1] >= 'A' && cc[1] <= 'Z' {
+		return codes[int(cc[0]-'A')*26+int(cc[1]-'A')]
+	}
+	return string(cc)
 }
 
 // TrieNode represents a node in the Patricia trie.
@@ -25,11 +96,17 @@ type TrieNode struct {
 	Children [2]*TrieNode
 }
 
+// ErrFrozen is returned when inserting into a frozen trie.
+var ErrFrozen = errors.New("trie is frozen")
+
 // Trie is a Patricia trie for IP prefix lookup.
+// Lookups are safe for concurrent use as long as nothing inserts at the same
+// time; Freeze makes that guarantee explicit once a trie is shared.
 type Trie struct {
 	Root   *TrieNode
 	IsIPv6 bool
 	Count  int
+	frozen bool
 }
 
 // NewTrie creates a new empty trie.
@@ -42,6 +119,9 @@ func NewTrie(isIPv6 bool) *Trie {
 
 // Insert adds a prefix with associated data to the trie.
 func (t *Trie) Insert(prefix netip.Prefix, data PrefixData) error {
+	if t.frozen {
+		return ErrFrozen
+	}
 	if prefix.Addr().Is6() != t.IsIPv6 {
 		return fmt.Errorf("IP version mismatch")
 	}
@@ -49,11 +129,41 @@ func (t *Trie) Insert(prefix netip.Prefix, data PrefixData) error {
 	bits := prefixToBits(prefix)
 	prefixLen := prefix.Bits()
 
+	data.Bits = uint8(prefixLen)
+	data.CountryCode = internCountry(data.CountryCode)
 	t.insertRecursive(t.Root, bits, 0, prefixLen, &data)
 	t.Count++
 	return nil
 }
 
+// Override inserts prefix like Insert, and gives the more specific prefixes
+// stored within it the same data, so that lookups anywhere in prefix find
+// its data instead of that of a nested prefix.
+func (t *Trie) Override(prefix netip.Prefix, data PrefixData) error {
+	prefix = prefix.Masked()
+	if err := t.Insert(prefix, data); err != nil {
+		return err
+	}
+	d := t.lookupExact(prefix)
+	t.walk(prefix.Overlaps, func(q netip.Prefix, inner *PrefixData) bool {
+		if q.Bits() > prefix.Bits() {
+			*inner = *d
+		}
+		return true
+	})
+	return nil
+}
+
+// Freeze marks the trie read-only; further inserts return ErrFrozen.
+func (t *Trie) Freeze() {
+	t.frozen = true
+}
+
+// Frozen reports whether the trie has been frozen.
+func (t *Trie) Frozen() bool {
+	return t.frozen
+}
+
 // insertRecursive inserts data at the given path in the trie
 func (t *Trie) insertRecursive(node *TrieNode, bits []byte, pos int, prefixLen int, data *PrefixData) {
 	for {
@@ -140,19 +250,72 @@ func (t *Trie) insertRecursive(node *TrieNode, bits []byte, pos int, prefixLen i
 	}
 }
 
-// InsertCIDR parses a CIDR string and inserts it into the trie.
+// InsertCIDR parses a CIDR string and inserts it into the trie. Country
+// code aliases such as UK are stored as their ISO-3166 code.
 func (t *Trie) InsertCIDR(cidr string, countryCode string) error {
-	prefix, err := netip.ParsePrefix(cidr)
+	prefix, data, err := ParseCIDR(cidr, countryCode)
 	if err != nil {
-		return fmt.Errorf("invalid CIDR %q: %w", cidr, err)
+		return err
 	}
+	return t.Insert(prefix, data)
+}
 
-	data := PrefixData{
-		CountryCode: strings.ToUpper(countryCode),
-		PrefixStr:   prefix.Masked().String(),
+// DeleteCountries removes every prefix assigned to one of the given
+// countries and returns how many were removed. Nodes left without data
+// are pruned, so the trie is shaped as if the prefixes were never inserted.
+func (t *Trie) DeleteCountries(countryCodes []string) (int, error) {
+	if t.frozen {
+		return 0, ErrFrozen
+	}
+	remove := make(map[string]bool, len(countryCodes))
+	for _, cc := range countryCodes {
+		remove[countries.Normalize(cc)] = true
 	}
 
-	return t.Insert(prefix.Masked(), data)
+	removed := 0
+	for i, child := range t.Root.Children {
+		t.Root.Children[i] = deleteRecursive(child, remove, &removed)
+	}
+	if t.Root.Data != nil && remove[t.Root.Data.CountryCode] {
+		t.Root.Data = nil
+		removed++
+	}
+	t.Count -= removed
+	return removed, nil
+}
+
+// deleteRecursive clears the data of the removed countries below node and
+// returns what replaces node: nil if nothing is left, or its only child
+// with the paths joined.
+func deleteRecursive(node *TrieNode, remove map[string]bool, removed *int) *TrieNode {
+	if node == nil {
+		return nil
+	}
+	for i, child := range node.Children {
+		node.Children[i] = deleteRecursive(child, remove, removed)
+	}
+	if node.Data != nil && remove[node.Data.CountryCode] {
+		node.Data = nil
+		*removed++
+	}
+	if node.Data != nil {
+		return node
+	}
+
+	left, right := node.Children[0], node.Children[1]
+	switch {
+	case left == nil && right == nil:
+		return nil
+	case left != nil && right != nil:
+		return node
+	}
+	child := left
+	if child == nil {
+		child = right
+	}
+	child.Prefix = joinBits(node.Prefix, node.PrefixLen, child.Prefix, child.PrefixLen)
+	child.PrefixLen += node.PrefixLen
+	return child
 }
 
 // Lookup finds the longest matching prefix for an IP address.
@@ -226,8 +389,233 @@ func (t *Trie) LookupString(ipStr string) (*PrefixData, error) {
 	return t.Lookup(ip), nil
 }
 
+// Export returns every stored prefix and its data as parallel slices, ordered
+// by address and then by prefix length (covering prefixes first).
+// The returned data are copies; modifying them does not affect the trie.
+func (t *Trie) Export() ([]netip.Prefix, []PrefixData) {
+	prefixes := make([]netip.Prefix, 0, t.Count)
+	data := make([]PrefixData, 0, t.Count)
+	t.walk(nil, func(p netip.Prefix, d *PrefixData) bool {
+		prefixes = append(prefixes, p)
+		data = append(data, *d)
+		return true
+	})
+	return prefixes, data
+}
+
+// SetHolder sets the holder of the data stored for exactly prefix, and
+// reports whether there is any.
+func (t *Trie) SetHolder(prefix netip.Prefix, holder string) bool {
+	if t.frozen {
+		return false
+	}
+	d := t.lookupExact(prefix.Masked())
+	if d == nil {
+		return false
+	}
+	d.Holder = holder
+	return true
+}
+
+// Containment describes how a CIDR relates to the prefixes stored in the trie.
+type Containment int
+
+const (
+	// NotFound means no stored prefix overlaps the CIDR.
+	NotFound Containment = iota
+	// Contained means the whole CIDR is assigned to a single country.
+	Contained
+	// PartialOverlap means only part of the CIDR is assigned, to a single country.
+	PartialOverlap
+	// MultipleCountries means the CIDR spans assignments of more than one country.
+	MultipleCountries
+)
+
+// String returns the containment name used in output.
+func (c Containment) String() string {
+	switch c {
+	case Contained:
+		return "contained"
+	case PartialOverlap:
+		return "partial"
+	case MultipleCountries:
+		return "multiple"
+	default:
+		return "not_found"
+	}
+}
+
+// PrefixMatch is the result of a CIDR lookup.
+type PrefixMatch struct {
+	Containment Containment
+	// Covering is the most specific stored prefix containing the whole CIDR.
+	Covering *PrefixData
+	// Countries lists the distinct country codes assigned within the CIDR.
+	Countries []string
+}
+
+// LookupPrefix reports how a CIDR relates to the country assignments in the trie.
+func (t *Trie) LookupPrefix(p netip.Prefix) *PrefixMatch {
+	match := &PrefixMatch{Containment: NotFound}
+	if !p.IsValid() || p.Addr().Is6() != t.IsIPv6 {
+		return match
+	}
+	p = p.Masked()
+
+	var inner []netip.Prefix
+	seen := make(map[string]bool)
+	t.walk(p.Overlaps, func(q netip.Prefix, data *PrefixData) bool {
+		if q.Bits() <= p.Bits() {
+			// Walk order is shallow to deep, so the last one is the most specific
+			match.Covering = data
+		} else {
+			inner = append(inner, q)
+			seen[data.CountryCode] = true
+		}
+		return true
+	})
+
+	if match.Covering != nil {
+		seen[match.Covering.CountryCode] = true
+	}
+	for cc := range seen {
+		match.Countries = append(match.Countries, cc)
+	}
+	sort.Strings(match.Countries)
+
+	switch {
+	case len(match.Countries) == 0:
+		match.Containment = NotFound
+	case len(match.Countries) > 1:
+		match.Containment = MultipleCountries
+	case match.Covering != nil || coversPrefix(p, inner):
+		match.Containment = Contained
+	default:
+		match.Containment = PartialOverlap
+	}
+	return match
+}
+
+// LookupPrefixes reports how an address range made up of adjacent prefixes,
+// such as a start-end range split into CIDRs, relates to the country
+// assignments in the trie. Covering is set only if a single stored prefix
+// is the most specific one containing each of them.
+func (t *Trie) LookupPrefixes(prefixes []netip.Prefix) *PrefixMatch {
+	if len(prefixes) == 1 {
+		return t.LookupPrefix(prefixes[0])
+	}
+
+	match := &PrefixMatch{Containment: NotFound}
+	seen := make(map[string]bool)
+	contained := true
+	for i, p := range prefixes {
+		m := t.LookupPrefix(p)
+		for _, cc := range m.Countries {
+			seen[cc] = true
+		}
+		if m.Containment != Contained {
+			contained = false
+		}
+		if i == 0 {
+			match.Covering = m.Covering
+		} else if m.Covering != match.Covering {
+			match.Covering = nil
+		}
+	}
+	for cc := range seen {
+		match.Countries = append(match.Countries, cc)
+	}
+	sort.Strings(match.Countries)
+
+	switch {
+	case len(match.Countries) == 0:
+		match.Containment = NotFound
+	case len(match.Countries) > 1:
+		match.Containment = MultipleCountries
+	case contained:
+		match.Containment = Contained
+	default:
+		match.Containment = PartialOverlap
+	}
+	return match
+}
+
+// coversPrefix reports whether the given prefixes, in walk order, cover all of p.
+func coversPrefix(p netip.Prefix, prefixes []netip.Prefix) bool {
+	next := p.Addr()
+	var top netip.Prefix
+	for _, q := range prefixes {
+		if top.IsValid() && top.Contains(q.Addr()) {
+			continue
+		}
+		if q.Addr() != next {
+			return false
+		}
+		top = q
+		last := lastAddr(q)
+		if last == lastAddr(p) {
+			return true
+		}
+		next = last.Next()
+	}
+	return false
+}
+
+// walk visits every node carrying data in address order, passing the prefix
+// reconstructed from the path. Subtrees whose prefix fails descend are skipped;
+// returning false from fn stops the walk.
+func (t *Trie) walk(descend func(netip.Prefix) bool, fn func(netip.Prefix, *PrefixData) bool) {
+	var acc [16]byte
+	t.walkNode(t.Root, acc, 0, descend, fn)
+}
+
+func (t *Trie) walkNode(node *TrieNode, acc [16]byte, depth int, descend func(netip.Prefix) bool, fn func(netip.Prefix, *PrefixData) bool) bool {
+	depth = extendPath(&acc, depth, node)
+
+	p := t.makePrefix(acc, depth)
+	if descend != nil && !descend(p) {
+		return true
+	}
+	if node.Data != nil && !fn(p, node.Data) {
+		return false
+	}
+	for _, child := range node.Children {
+		if child != nil && !t.walkNode(child, acc, depth, descend, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// extendPath adds the bits of node to the path acc of depth bits leading
+// to it, and returns the new depth.
+func extendPath(acc *[16]byte, depth int, node *TrieNode) int {
+	for i := 0; i < node.PrefixLen; i++ {
+		if getBit(node.Prefix, i) == 1 {
+			acc[(depth+i)/8] |= 1 << (7 - (depth+i)%8)
+		}
+	}
+	return depth + node.PrefixLen
+}
+
+func (t *Trie) makePrefix(acc [16]byte, bits int) netip.Prefix {
+	if t.IsIPv6 {
+		return netip.PrefixFrom(netip.AddrFrom16(acc), bits)
+	}
+	return netip.PrefixFrom(netip.AddrFrom4([4]byte(acc[:4])), bits)
+}
+
 // Helper functions
 
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Masked().Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 1 << (7 - i%8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
 func prefixToBits(prefix netip.Prefix) []byte {
 	addr := prefix.Addr()
 	if addr.Is4() {
@@ -284,6 +672,23 @@ func extractBits(data []byte, start, length int) []byte {
 	return result
 }
 
+// joinBits returns the first aLen bits of a followed by the first bLen bits of b.
+func joinBits(a []byte, aLen int, b []byte, bLen int) []byte {
+	result := make([]byte, (aLen+bLen+7)/8)
+	for i := 0; i < aLen+bLen; i++ {
+		bit := 0
+		if i < aLen {
+			bit = getBit(a, i)
+		} else {
+			bit = getBit(b, i-aLen)
+		}
+		if bit == 1 {
+			result[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return result
+}
+
 func extractBitsFromSlice(data []byte, start, length int) []byte {
 	return extractBits(data, start, length)
 }
@@ -2,7 +2,9 @@ package index
 
 import (
 	"net/netip"
+	"strings"
 	"testing"
+	"unsafe"
 )
 
 func TestTrieInsertAndLookupIPv4(t *testing.T) {
@@ -51,8 +53,8 @@ func TestTrieInsertAndLookupIPv4(t *testing.T) {
 		if result.CountryCode != lt.expectedCC {
 			t.Errorf("Lookup(%s) CountryCode = %s, expected %s", lt.ip, result.CountryCode, lt.expectedCC)
 		}
-		if result.PrefixStr != lt.expectedPrefix {
-			t.Errorf("Lookup(%s) PrefixStr = %s, expected %s", lt.ip, result.PrefixStr, lt.expectedPrefix)
+		if got := result.Prefix(ip).String(); got != lt.expectedPrefix {
+			t.Errorf("Lookup(%s) Prefix = %s, expected %s", lt.ip, got, lt.expectedPrefix)
 		}
 	}
 }
@@ -98,8 +100,8 @@ func TestTrieInsertAndLookupIPv6(t *testing.T) {
 		if result.CountryCode != lt.expectedCC {
 			t.Errorf("Lookup(%s) CountryCode = %s, expected %s", lt.ip, result.CountryCode, lt.expectedCC)
 		}
-		if result.PrefixStr != lt.expectedPrefix {
-			t.Errorf("Lookup(%s) PrefixStr = %s, expected %s", lt.ip, result.PrefixStr, lt.expectedPrefix)
+		if got := result.Prefix(ip).String(); got != lt.expectedPrefix {
+			t.Errorf("Lookup(%s) Prefix = %s, expected %s", lt.ip, got, lt.expectedPrefix)
 		}
 	}
 }
@@ -119,6 +121,18 @@ func TestTrieLookupNotFound(t *testing.T) {
 	}
 }
 
+func TestTrieInsertCIDRNormalizesAliases(t *testing.T) {
+	trie := NewTrie(false)
+
+	if err := trie.InsertCIDR("81.2.69.0/24", "uk"); err != nil {
+		t.Fatalf("InsertCIDR failed: %v", err)
+	}
+	result := trie.Lookup(netip.MustParseAddr("81.2.69.1"))
+	if result == nil || result.CountryCode != "GB" {
+		t.Errorf("Lookup(81.2.69.1) = %+v, expected GB", result)
+	}
+}
+
 func TestTrieIPVersionMismatch(t *testing.T) {
 	v4Trie := NewTrie(false)
 	v6Trie := NewTrie(true)
@@ -191,6 +205,202 @@ func TestTrieInvalidCIDR(t *testing.T) {
 	}
 }
 
+func TestTrieLookupPrefix(t *testing.T) {
+	trie := NewTrie(false)
+
+	prefixes := []struct {
+		cidr string
+		cc   string
+	}{
+		{"8.8.0.0/16", "US"},
+		{"8.8.8.0/24", "US"},
+		{"10.0.0.0/25", "DE"},
+		{"10.0.0.128/25", "DE"},
+		{"10.0.1.0/25", "FR"},
+		{"172.16.0.0/24", "GB"},
+		{"192.168.0.0/16", "NL"},
+		{"192.168.1.0/24", "BE"},
+	}
+	for _, p := range prefixes {
+		if err := trie.InsertCIDR(p.cidr, p.cc); err != nil {
+			t.Fatalf("InsertCIDR(%s) failed: %v", p.cidr, err)
+		}
+	}
+
+	tests := []struct {
+		cidr        string
+		containment Containment
+		countries   []string
+		covering    string
+	}{
+		{"8.8.8.0/25", Contained, []string{"US"}, "8.8.8.0/24"},
+		{"8.8.0.0/16", Contained, []string{"US"}, "8.8.0.0/16"},
+		{"10.0.0.0/24", Contained, []string{"DE"}, ""},
+		{"10.0.0.0/23", MultipleCountries, []string{"DE", "FR"}, ""},
+		{"172.16.0.0/23", PartialOverlap, []string{"GB"}, ""},
+		{"192.168.0.0/20", MultipleCountries, []string{"BE", "NL"}, "192.168.0.0/16"},
+		{"192.168.2.0/24", Contained, []string{"NL"}, "192.168.0.0/16"},
+		{"203.0.113.0/24", NotFound, nil, ""},
+	}
+
+	for _, tc := range tests {
+		match := trie.LookupPrefix(netip.MustParsePrefix(tc.cidr))
+		if match.Containment != tc.containment {
+			t.Errorf("LookupPrefix(%s) Containment = %s, expected %s", tc.cidr, match.Containment, tc.containment)
+		}
+		if strings.Join(match.Countries, ",") != strings.Join(tc.countries, ",") {
+			t.Errorf("LookupPrefix(%s) Countries = %v, expected %v", tc.cidr, match.Countries, tc.countries)
+		}
+		covering := ""
+		if match.Covering != nil {
+			covering = match.Covering.Prefix(netip.MustParsePrefix(tc.cidr).Addr()).String()
+		}
+		if covering != tc.covering {
+			t.Errorf("LookupPrefix(%s) Covering = %q, expected %q", tc.cidr, covering, tc.covering)
+		}
+	}
+
+	// Wrong address family
+	match := trie.LookupPrefix(netip.MustParsePrefix("2001:db8::/32"))
+	if match.Containment != NotFound {
+		t.Errorf("Expected NotFound for IPv6 prefix in IPv4 trie, got %s", match.Containment)
+	}
+}
+
+func TestTrieExport(t *testing.T) {
+	trie := NewTrie(false)
+
+	// Inserted out of order on purpose
+	for _, cidr := range []string{"192.168.1.0/24", "8.8.8.0/24", "192.168.0.0/16", "1.0.0.0/8", "8.8.0.0/16"} {
+		if err := trie.InsertCIDR(cidr, "US"); err != nil {
+			t.Fatalf("InsertCIDR(%s) failed: %v", cidr, err)
+		}
+	}
+
+	prefixes, data := trie.Export()
+	expected := []string{"1.0.0.0/8", "8.8.0.0/16", "8.8.8.0/24", "192.168.0.0/16", "192.168.1.0/24"}
+	if len(prefixes) != len(expected) || len(data) != len(expected) {
+		t.Fatalf("Export returned %d prefixes and %d data, expected %d", len(prefixes), len(data), len(expected))
+	}
+	for i, cidr := range expected {
+		if prefixes[i].String() != cidr {
+			t.Errorf("prefixes[%d] = %s, expected %s", i, prefixes[i], cidr)
+		}
+		if data[i].Prefix(prefixes[i].Addr()).String() != cidr || data[i].CountryCode != "US" {
+			t.Errorf("data[%d] = %+v, expected %s/US", i, data[i], cidr)
+		}
+	}
+
+	// IPv6 prefixes are reconstructed from the trie path
+	v6 := NewTrie(true)
+	v6.InsertCIDR("2a00:1450::/32", "IE")
+	prefixes, _ = v6.Export()
+	if len(prefixes) != 1 || prefixes[0] != netip.MustParsePrefix("2a00:1450::/32") {
+		t.Errorf("IPv6 Export = %v", prefixes)
+	}
+}
+
+func TestTrieOverride(t *testing.T) {
+	trie := NewTrie(false)
+	for _, cidr := range []string{"8.0.0.0/8", "8.8.0.0/16", "8.8.8.0/24", "9.0.0.0/8"} {
+		if err := trie.InsertCIDR(cidr, "US"); err != nil {
+			t.Fatalf("InsertCIDR(%s) failed: %v", cidr, err)
+		}
+	}
+
+	if err := trie.Override(netip.MustParsePrefix("8.8.1.0/16"), PrefixData{CountryCode: "DE", Source: "override"}); err != nil {
+		t.Fatalf("Override failed: %v", err)
+	}
+
+	tests := []struct {
+		ip      string
+		country string
+		prefix  string
+	}{
+		{"8.8.8.8", "DE", "8.8.0.0/16"},
+		{"8.8.1.1", "DE", "8.8.0.0/16"},
+		{"8.9.0.1", "US", "8.0.0.0/8"},
+		{"9.0.0.1", "US", "9.0.0.0/8"},
+	}
+	for _, tc := range tests {
+		data := trie.Lookup(netip.MustParseAddr(tc.ip))
+		if data == nil {
+			t.Errorf("Lookup(%s) = nil", tc.ip)
+			continue
+		}
+		if data.CountryCode != tc.country || data.Prefix(netip.MustParseAddr(tc.ip)).String() != tc.prefix {
+			t.Errorf("Lookup(%s) = %s %s, expected %s %s", tc.ip, data.CountryCode, data.Prefix(netip.MustParseAddr(tc.ip)), tc.country, tc.prefix)
+		}
+	}
+
+	match := trie.LookupPrefix(netip.MustParsePrefix("8.8.0.0/16"))
+	if match.Containment != Contained || len(match.Countries) != 1 || match.Countries[0] != "DE" {
+		t.Errorf("LookupPrefix = %v %v, expected contained in DE", match.Containment, match.Countries)
+	}
+}
+
+func TestTrieDeleteCountries(t *testing.T) {
+	trie := NewTrie(false)
+	for cidr, cc := range map[string]string{
+		"10.0.0.0/8":     "US",
+		"10.1.0.0/16":    "DE",
+		"10.1.2.0/24":    "US",
+		"192.168.0.0/24": "DE",
+		"192.168.1.0/24": "FR",
+	} {
+		if err := trie.InsertCIDR(cidr, cc); err != nil {
+			t.Fatalf("InsertCIDR(%s) failed: %v", cidr, err)
+		}
+	}
+
+	removed, err := trie.DeleteCountries([]string{"de"})
+	if err != nil {
+		t.Fatalf("DeleteCountries failed: %v", err)
+	}
+	if removed != 2 || trie.Count != 3 {
+		t.Errorf("DeleteCountries removed %d, Count = %d, expected 2 and 3", removed, trie.Count)
+	}
+
+	tests := []struct {
+		ip     string
+		prefix string
+	}{
+		{"10.1.0.1", "10.0.0.0/8"},
+		{"10.1.2.1", "10.1.2.0/24"},
+		{"192.168.0.1", ""},
+		{"192.168.1.1", "192.168.1.0/24"},
+	}
+	for _, tt := range tests {
+		ip := netip.MustParseAddr(tt.ip)
+		data := trie.Lookup(ip)
+		got := ""
+		if data != nil {
+			got = data.Prefix(ip).String()
+		}
+		if got != tt.prefix {
+			t.Errorf("Lookup(%s) = %q, expected %q", tt.ip, got, tt.prefix)
+		}
+	}
+
+	// Pruned paths are rebuilt correctly when the country is inserted again
+	trie.InsertCIDR("192.168.0.0/23", "DE")
+	prefixes, _ := trie.Export()
+	expected := []string{"10.0.0.0/8", "10.1.2.0/24", "192.168.0.0/23", "192.168.1.0/24"}
+	if len(prefixes) != len(expected) {
+		t.Fatalf("Export = %v, expected %v", prefixes, expected)
+	}
+	for i, cidr := range expected {
+		if prefixes[i].String() != cidr {
+			t.Errorf("prefixes[%d] = %s, expected %s", i, prefixes[i], cidr)
+		}
+	}
+
+	trie.Freeze()
+	if _, err := trie.DeleteCountries([]string{"US"}); err != ErrFrozen {
+		t.Errorf("DeleteCountries on frozen trie = %v, expected ErrFrozen", err)
+	}
+}
+
 func BenchmarkTrieInsertIPv4(b *testing.B) {
 	trie := NewTrie(false)
 
@@ -199,7 +409,7 @@ func BenchmarkTrieInsertIPv4(b *testing.B) {
 		a := byte(i % 256)
 		c := byte((i / 256) % 256)
 		cidr := netip.PrefixFrom(netip.AddrFrom4([4]byte{a, c, 0, 0}), 16)
-		trie.Insert(cidr, PrefixData{CountryCode: "US", PrefixStr: cidr.String()})
+		trie.Insert(cidr, PrefixData{CountryCode: "US"})
 	}
 }
 
@@ -220,3 +430,13 @@ func BenchmarkTrieLookupIPv4(b *testing.B) {
 		trie.Lookup(ip)
 	}
 }
+
+func TestInternCountry(t *testing.T) {
+	a, b := internCountry("US"), internCountry([]byte("US"))
+	if a != "US" || unsafe.StringData(a) != unsafe.StringData(b) {
+		t.Errorf("internCountry did not share the code: %q %q", a, b)
+	}
+	if got := internCountry("xx1"); got != "xx1" {
+		t.Errorf("internCountry(xx1) = %q", got)
+	}
+}
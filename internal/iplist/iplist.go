@@ -0,0 +1,295 @@
+// Package iplist flags addresses found on address lists in lookup results:
+// downloaded lists of Tor exit nodes and hosting or VPN networks, and tag
+// lists of the user's own.
+//
+// Lists are plain text with one address or CIDR per line; blank lines and
+// lines starting with '#' are skipped. Downloaded lists are stored with the
+// snapshot as index tries, one pair per list; tag lists are read from their
+// files at lookup time.
+package iplist
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/config"
+	"github.com/hightemp/ip2cc/internal/index"
+	"github.com/hightemp/ip2cc/internal/output"
+)
+
+const (
+	// TorExit names the list of Tor exit node addresses.
+	TorExit = "tor_exit"
+	// Hosting names the list of datacenter, hosting and VPN networks.
+	Hosting = "hosting"
+
+	// DefaultTorExitURL is the Tor Project's list of exit node addresses.
+	DefaultTorExitURL = "https://check.torproject.org/torbulkexitlist"
+	// DefaultHostingURL is a public list of datacenter IPv4 networks.
+	DefaultHostingURL = "https://raw.githubusercontent.com/X4BNet/lists_vpn/main/output/datacenter/ipv4.txt"
+
+	// DownloadTimeout bounds the download of a list.
+	DownloadTimeout = 2 * time.Minute
+)
+
+// Names are the known lists, in the order they are loaded.
+var Names = []string{TorExit, Hosting}
+
+// List is a named set of prefixes.
+type List struct {
+	Name string
+	V4   *index.Trie
+	V6   *index.Trie
+}
+
+// NewList creates an empty list.
+func NewList(name string) *List {
+	return &List{Name: name, V4: index.NewTrie(false), V6: index.NewTrie(true)}
+}
+
+// Contains reports whether ip is on the list.
+func (l *List) Contains(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if ip.Is4() {
+		return l.V4.Lookup(ip) != nil
+	}
+	return l.V6.Lookup(ip) != nil
+}
+
+// ContainsPrefixes reports whether the whole address range made up of the
+// adjacent prefixes is on the list.
+func (l *List) ContainsPrefixes(prefixes []netip.Prefix) bool {
+	if len(prefixes) == 1 && prefixes[0].IsSingleIP() {
+		return l.Contains(prefixes[0].Addr())
+	}
+	trie := l.V4
+	if prefixes[0].Addr().Is6() {
+		trie = l.V6
+	}
+	return trie.LookupPrefixes(prefixes).Containment == index.Contained
+}
+
+// Count returns the number of prefixes on the list.
+func (l *List) Count() int {
+	return l.V4.Count + l.V6.Count
+}
+
+// Parse adds the addresses and prefixes listed in r to the list.
+func (l *List) Parse(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		s := strings.TrimSpace(scanner.Text())
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+		// Some lists annotate entries after the address
+		s = strings.Fields(s)[0]
+
+		var prefix netip.Prefix
+		if strings.Contains(s, "/") {
+			p, err := netip.ParsePrefix(s)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+			prefix = p.Masked()
+		} else {
+			ip, err := netip.ParseAddr(s)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+			ip = ip.Unmap()
+			prefix = netip.PrefixFrom(ip, ip.BitLen())
+		}
+
+		trie := l.V4
+		if prefix.Addr().Is6() {
+			trie = l.V6
+		}
+		if err := trie.Insert(prefix, index.PrefixData{}); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// Download creates a list from the lists at urls.
+func Download(ctx context.Context, name string, urls []string) (*List, error) {
+	l := NewList(name)
+	for _, url := range urls {
+		if err := l.download(ctx, url); err != nil {
+			return nil, fmt.Errorf("%s list: %w", name, err)
+		}
+	}
+	return l, nil
+}
+
+func (l *List) download(ctx context.Context, url string) error {
+	ctx, cancel := context.WithTimeout(ctx, DownloadTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", config.AppName+"/1.0")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download %s: HTTP %d", url, resp.StatusCode)
+	}
+	if err := l.Parse(resp.Body); err != nil {
+		return fmt.Errorf("parse %s: %w", url, err)
+	}
+	return nil
+}
+
+// ParseFile creates a list from a file.
+func ParseFile(name, path string) (*List, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	l := NewList(name)
+	if err := l.Parse(f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return l, nil
+}
+
+// Lists are the lists stored with a snapshot.
+type Lists []*List
+
+// Save writes the lists to dir.
+func (ls Lists) Save(dir string) error {
+	if err := config.EnsureDir(dir); err != nil {
+		return err
+	}
+	for _, l := range ls {
+		v4Path, v6Path := paths(dir, l.Name)
+		if err := index.SaveIndex(v4Path, v6Path, l.V4, l.V6); err != nil {
+			return fmt.Errorf("save %s list: %w", l.Name, err)
+		}
+	}
+	return nil
+}
+
+// Load reads the lists written by Save. Lists that were not downloaded are
+// left out; a snapshot without lists has none.
+func Load(dir string) (Lists, error) {
+	var ls Lists
+	for _, name := range Names {
+		v4Path, v6Path := paths(dir, name)
+		if _, err := os.Stat(v4Path); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		v4, v6, err := index.LoadIndex(v4Path, v6Path)
+		if err != nil {
+			return nil, fmt.Errorf("load %s list: %w", name, err)
+		}
+		ls = append(ls, &List{Name: name, V4: v4, V6: v6})
+	}
+	return ls, nil
+}
+
+func paths(dir, name string) (string, string) {
+	return filepath.Join(dir, name+"_v4.bin"), filepath.Join(dir, name+"_v6.bin")
+}
+
+// Enricher sets the extra field named after each list that contains the
+// looked up address to true. The lists can be swapped while it is in use,
+// e.g. when a server reloads its snapshot.
+type Enricher struct {
+	lists atomic.Pointer[Lists]
+}
+
+// NewEnricher creates an enricher for ls.
+func NewEnricher(ls Lists) *Enricher {
+	e := &Enricher{}
+	e.Swap(ls)
+	return e
+}
+
+// Swap replaces the lists.
+func (e *Enricher) Swap(ls Lists) {
+	e.lists.Store(&ls)
+}
+
+// Name implements enrich.Enricher.
+func (e *Enricher) Name() string {
+	return "lists"
+}
+
+// Enrich implements enrich.Enricher. Only single addresses are checked;
+// NAT64 and other translated addresses are checked as their IPv4 address.
+func (e *Enricher) Enrich(ctx context.Context, result *output.LookupResult) error {
+	s := result.IP
+	if result.EmbeddedIPv4 != "" {
+		s = result.EmbeddedIPv4
+	}
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return nil
+	}
+	for _, l := range *e.lists.Load() {
+		if l.Contains(ip) {
+			result.SetExtra(l.Name, true)
+		}
+	}
+	return nil
+}
+
+// Tags are user-defined lists, such as the ranges of a corporate VPN,
+// reported by name in lookup results.
+type Tags struct {
+	lists Lists
+}
+
+// LoadTags reads the tag lists from files, given by tag name.
+func LoadTags(files map[string]string) (*Tags, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	t := &Tags{}
+	for _, name := range names {
+		l, err := ParseFile(name, files[name])
+		if err != nil {
+			return nil, fmt.Errorf("tag %s: %w", name, err)
+		}
+		t.lists = append(t.lists, l)
+	}
+	return t, nil
+}
+
+// Match returns the sorted names of the tags whose lists contain the whole
+// address range made up of the adjacent prefixes, or an empty list.
+func (t *Tags) Match(prefixes []netip.Prefix) []string {
+	names := []string{}
+	for _, l := range t.lists {
+		if l.ContainsPrefixes(prefixes) {
+			names = append(names, l.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,173 @@
+package iplist
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hightemp/ip2cc/internal/output"
+)
+
+const sampleList = "# exit nodes\n" +
+	"185.220.101.1\n" +
+	"\n" +
+	"45.0.0.0/24 some provider\n" +
+	"2a0b:f4c2::/32\n"
+
+func TestParse(t *testing.T) {
+	l := NewList(TorExit)
+	if err := l.Parse(strings.NewReader(sampleList)); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if l.Count() != 3 {
+		t.Errorf("Count = %d, expected 3", l.Count())
+	}
+
+	tests := []struct {
+		ip       string
+		expected bool
+	}{
+		{"185.220.101.1", true},
+		{"185.220.101.2", false},
+		{"45.0.0.200", true},
+		{"::ffff:45.0.0.1", true},
+		{"2a0b:f4c2:1::1", true},
+		{"2a0c::1", false},
+	}
+	for _, tc := range tests {
+		if got := l.Contains(netip.MustParseAddr(tc.ip)); got != tc.expected {
+			t.Errorf("Contains(%s) = %v, expected %v", tc.ip, got, tc.expected)
+		}
+	}
+
+	if err := NewList(Hosting).Parse(strings.NewReader("not-an-ip\n")); err == nil {
+		t.Error("Expected an error for an invalid line")
+	}
+}
+
+func TestDownloadSaveLoad(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(sampleList))
+	}))
+	defer server.Close()
+
+	if _, err := Download(context.Background(), Hosting, []string{server.URL + "/missing"}); err == nil {
+		t.Error("Expected an error for a missing list")
+	}
+	l, err := Download(context.Background(), Hosting, []string{server.URL + "/list.txt"})
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if ls, err := Load(tmpDir); err != nil || len(ls) != 0 {
+		t.Fatalf("Load of an empty directory = %v, %v, expected no lists", ls, err)
+	}
+	if err := (Lists{l}).Save(tmpDir); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	ls, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(ls) != 1 || ls[0].Name != Hosting || ls[0].Count() != 3 {
+		t.Fatalf("Load = %v, expected the hosting list with 3 prefixes", ls)
+	}
+}
+
+func TestEnricher(t *testing.T) {
+	tor := NewList(TorExit)
+	hosting := NewList(Hosting)
+	if err := tor.Parse(strings.NewReader("185.220.101.1\n")); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if err := hosting.Parse(strings.NewReader("185.220.101.0/24\n")); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	e := NewEnricher(Lists{tor, hosting})
+
+	tests := []struct {
+		result   *output.LookupResult
+		expected string
+	}{
+		{&output.LookupResult{IP: "185.220.101.1"}, "hosting,tor_exit"},
+		{&output.LookupResult{IP: "185.220.101.2"}, "hosting"},
+		{&output.LookupResult{IP: "64:ff9b::b9dc:6501", EmbeddedIPv4: "185.220.101.1"}, "hosting,tor_exit"},
+		{&output.LookupResult{IP: "8.8.8.8"}, ""},
+		{&output.LookupResult{IP: "185.220.101.0/24"}, ""},
+	}
+	for _, tc := range tests {
+		if err := e.Enrich(context.Background(), tc.result); err != nil {
+			t.Fatalf("Enrich failed: %v", err)
+		}
+		var flags []string
+		for _, name := range []string{Hosting, TorExit} {
+			if tc.result.Extra[name] == true {
+				flags = append(flags, name)
+			}
+		}
+		if got := strings.Join(flags, ","); got != tc.expected {
+			t.Errorf("Flags of %s = %q, expected %q", tc.result.IP, got, tc.expected)
+		}
+	}
+
+	e.Swap(nil)
+	r := &output.LookupResult{IP: "185.220.101.1"}
+	if err := e.Enrich(context.Background(), r); err != nil || r.Extra != nil {
+		t.Errorf("Enrich after Swap(nil) = %v, %v, expected no fields", r.Extra, err)
+	}
+}
+
+func TestTags(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	vpn := filepath.Join(tmpDir, "vpn.txt")
+	partners := filepath.Join(tmpDir, "partners.txt")
+	os.WriteFile(vpn, []byte("10.8.0.0/16\n"), 0644)
+	os.WriteFile(partners, []byte("10.8.1.0/25\n10.8.1.128/25\n2001:db8::/48\n"), 0644)
+
+	tags, err := LoadTags(map[string]string{"partner-ranges": partners, "corp-vpn": vpn})
+	if err != nil {
+		t.Fatalf("LoadTags failed: %v", err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"10.8.1.5/32", "corp-vpn,partner-ranges"},
+		{"10.8.2.5/32", "corp-vpn"},
+		{"10.8.1.0/24", "corp-vpn,partner-ranges"},
+		{"10.8.0.0/23", "corp-vpn"},
+		{"10.9.0.1/32", ""},
+		{"2001:db8::1/128", "partner-ranges"},
+	}
+	for _, tc := range tests {
+		got := tags.Match([]netip.Prefix{netip.MustParsePrefix(tc.input)})
+		if got == nil || strings.Join(got, ",") != tc.expected {
+			t.Errorf("Match(%s) = %v, expected %q", tc.input, got, tc.expected)
+		}
+	}
+
+	if _, err := LoadTags(map[string]string{"missing": filepath.Join(tmpDir, "missing.txt")}); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
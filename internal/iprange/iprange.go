@@ -0,0 +1,130 @@
+// Package iprange converts between address ranges and CIDR prefixes.
+package iprange
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// Parse parses an inclusive range written as "start-end", such as
+// "192.0.2.10-192.0.2.200". Spaces around the addresses are ignored.
+func Parse(s string) (start, end netip.Addr, err error) {
+	first, last, ok := strings.Cut(s, "-")
+	if !ok {
+		return start, end, fmt.Errorf("missing '-' in %q", s)
+	}
+	if start, err = netip.ParseAddr(strings.TrimSpace(first)); err != nil {
+		return start, end, err
+	}
+	if end, err = netip.ParseAddr(strings.TrimSpace(last)); err != nil {
+		return start, end, err
+	}
+	if start.Is4() != end.Is4() {
+		return start, end, fmt.Errorf("range %s-%s mixes IPv4 and IPv6", start, end)
+	}
+	if end.Less(start) {
+		return start, end, fmt.Errorf("range start %s is after end %s", start, end)
+	}
+	return start, end, nil
+}
+
+// LooksLikeRange reports whether s is meant as a range: an address
+// followed by '-', whether or not the rest is valid.
+func LooksLikeRange(s string) bool {
+	first, _, ok := strings.Cut(s, "-")
+	if !ok {
+		return false
+	}
+	_, err := netip.ParseAddr(strings.TrimSpace(first))
+	return err == nil
+}
+
+// ToPrefixes returns the minimal list of prefixes exactly covering the
+// inclusive range [start, end].
+func ToPrefixes(start, end netip.Addr) ([]netip.Prefix, error) {
+	if !start.IsValid() || !end.IsValid() || start.Is4() != end.Is4() {
+		return nil, fmt.Errorf("invalid range %s-%s", start, end)
+	}
+	if end.Less(start) {
+		return nil, fmt.Errorf("range start %s is after end %s", start, end)
+	}
+
+	var prefixes []netip.Prefix
+	for {
+		// Largest block aligned at start that does not extend past end
+		var p netip.Prefix
+		for bits := 0; bits <= start.BitLen(); bits++ {
+			p = netip.PrefixFrom(start, bits).Masked()
+			if p.Addr() == start && !end.Less(LastAddr(p)) {
+				break
+			}
+		}
+		prefixes = append(prefixes, p)
+
+		last := LastAddr(p)
+		if last == end {
+			return prefixes, nil
+		}
+		start = last.Next()
+	}
+}
+
+// LastAddr returns the last address covered by p.
+func LastAddr(p netip.Prefix) netip.Addr {
+	b := p.Masked().Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 1 << (7 - i%8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// Sampler draws addresses uniformly at random from the address space of a
+// list of non-overlapping prefixes.
+type Sampler struct {
+	prefixes []netip.Prefix
+	// ends holds the number of addresses in prefixes[:i+1].
+	ends []*big.Int
+}
+
+// NewSampler creates a sampler over prefixes.
+func NewSampler(prefixes []netip.Prefix) *Sampler {
+	s := &Sampler{prefixes: prefixes, ends: make([]*big.Int, len(prefixes))}
+	total := new(big.Int)
+	for i, p := range prefixes {
+		size := new(big.Int).Lsh(big.NewInt(1), uint(p.Addr().BitLen()-p.Bits()))
+		total = new(big.Int).Add(total, size)
+		s.ends[i] = total
+	}
+	return s
+}
+
+// Size returns the number of addresses sampled from.
+func (s *Sampler) Size() *big.Int {
+	if len(s.ends) == 0 {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(s.ends[len(s.ends)-1])
+}
+
+// Sample returns a random address, or the zero Addr if there are none.
+func (s *Sampler) Sample(rng *rand.Rand) netip.Addr {
+	if len(s.ends) == 0 {
+		return netip.Addr{}
+	}
+	n := new(big.Int).Rand(rng, s.ends[len(s.ends)-1])
+	i := sort.Search(len(s.ends), func(i int) bool { return s.ends[i].Cmp(n) > 0 })
+	if i > 0 {
+		n.Sub(n, s.ends[i-1])
+	}
+
+	b := s.prefixes[i].Masked().Addr().AsSlice()
+	n.Add(n, new(big.Int).SetBytes(b))
+	n.FillBytes(b)
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
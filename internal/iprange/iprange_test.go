@@ -0,0 +1,106 @@
+package iprange
+
+import (
+	"math/rand"
+	"net/netip"
+	"testing"
+)
+
+func TestToPrefixes(t *testing.T) {
+	tests := []struct {
+		start, end string
+		expected   []string
+	}{
+		{"1.0.0.0", "1.0.0.255", []string{"1.0.0.0/24"}},
+		{"1.0.0.1", "1.0.0.1", []string{"1.0.0.1/32"}},
+		{"1.0.0.0", "1.0.2.255", []string{"1.0.0.0/23", "1.0.2.0/24"}},
+		{"10.0.0.5", "10.0.0.18", []string{"10.0.0.5/32", "10.0.0.6/31", "10.0.0.8/29", "10.0.0.16/31", "10.0.0.18/32"}},
+		{"0.0.0.0", "255.255.255.255", []string{"0.0.0.0/0"}},
+		{"255.255.255.254", "255.255.255.255", []string{"255.255.255.254/31"}},
+		{"2001:db8::", "2001:db8::ffff", []string{"2001:db8::/112"}},
+		{"2001:db8::1", "2001:db8::2", []string{"2001:db8::1/128", "2001:db8::2/128"}},
+	}
+
+	for _, tc := range tests {
+		prefixes, err := ToPrefixes(netip.MustParseAddr(tc.start), netip.MustParseAddr(tc.end))
+		if err != nil {
+			t.Errorf("ToPrefixes(%s, %s) error: %v", tc.start, tc.end, err)
+			continue
+		}
+		if len(prefixes) != len(tc.expected) {
+			t.Errorf("ToPrefixes(%s, %s) = %v, expected %v", tc.start, tc.end, prefixes, tc.expected)
+			continue
+		}
+		for i, p := range prefixes {
+			if p.String() != tc.expected[i] {
+				t.Errorf("ToPrefixes(%s, %s)[%d] = %s, expected %s", tc.start, tc.end, i, p, tc.expected[i])
+			}
+		}
+	}
+}
+
+func TestToPrefixesInvalid(t *testing.T) {
+	if _, err := ToPrefixes(netip.MustParseAddr("1.0.0.2"), netip.MustParseAddr("1.0.0.1")); err == nil {
+		t.Error("expected error for reversed range")
+	}
+	if _, err := ToPrefixes(netip.MustParseAddr("1.0.0.0"), netip.MustParseAddr("::1")); err == nil {
+		t.Error("expected error for mixed families")
+	}
+}
+
+func TestParse(t *testing.T) {
+	start, end, err := Parse("192.0.2.10 - 192.0.2.200")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if start.String() != "192.0.2.10" || end.String() != "192.0.2.200" {
+		t.Errorf("Parse = %s-%s, expected 192.0.2.10-192.0.2.200", start, end)
+	}
+
+	for _, s := range []string{"192.0.2.10", "192.0.2.200-192.0.2.10", "192.0.2.10-::1", "a-b", "192.0.2.10-"} {
+		if _, _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) succeeded, expected an error", s)
+		}
+	}
+	if _, _, err := Parse("2001:db8::1-2001:db8::ff"); err != nil {
+		t.Errorf("Parse(2001:db8::1-2001:db8::ff) failed: %v", err)
+	}
+	if !LooksLikeRange("192.0.2.200-192.0.2.10") || LooksLikeRange("my-host.example") {
+		t.Error("LooksLikeRange should accept an address followed by '-' and nothing else")
+	}
+}
+
+func TestSampler(t *testing.T) {
+	prefixes := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/30"),
+		netip.MustParsePrefix("10.0.1.0/24"),
+	}
+	s := NewSampler(prefixes)
+	if s.Size().Int64() != 260 {
+		t.Errorf("Size = %s, expected 260", s.Size())
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	inFirst := 0
+	for i := 0; i < 2600; i++ {
+		addr := s.Sample(rng)
+		switch {
+		case prefixes[0].Contains(addr):
+			inFirst++
+		case !prefixes[1].Contains(addr):
+			t.Fatalf("Sample = %s, outside of %v", addr, prefixes)
+		}
+	}
+	// 4 of 260 addresses: about 40 of 2600 samples
+	if inFirst < 10 || inFirst > 100 {
+		t.Errorf("%d of 2600 samples in %s, expected about 40", inFirst, prefixes[0])
+	}
+
+	v6 := NewSampler([]netip.Prefix{netip.MustParsePrefix("2001:db8::/32")})
+	if addr := v6.Sample(rng); !netip.MustParsePrefix("2001:db8::/32").Contains(addr) {
+		t.Errorf("Sample = %s, outside of 2001:db8::/32", addr)
+	}
+	if addr := NewSampler(nil).Sample(rng); addr.IsValid() {
+		t.Errorf("Sample of no prefixes = %s, expected none", addr)
+	}
+}
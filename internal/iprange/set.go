@@ -0,0 +1,163 @@
+package iprange
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// addrRange is an inclusive address range of one family.
+type addrRange struct {
+	start, end netip.Addr
+}
+
+// ParseList reads a list of prefixes with one CIDR, address or range per
+// line. Blank lines and lines starting with '#' are skipped, as is anything
+// after the first field of a CIDR or address.
+func ParseList(r io.Reader) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		s := strings.TrimSpace(scanner.Text())
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+
+		if LooksLikeRange(s) {
+			start, end, err := Parse(s)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			p, err := ToPrefixes(start.Unmap(), end.Unmap())
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			prefixes = append(prefixes, p...)
+			continue
+		}
+
+		s = strings.Fields(s)[0]
+		if strings.Contains(s, "/") {
+			p, err := netip.ParsePrefix(s)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		ip, err := netip.ParseAddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		ip = ip.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(ip, ip.BitLen()))
+	}
+	return prefixes, scanner.Err()
+}
+
+// Aggregate returns the minimal sorted list of prefixes covering the same
+// addresses as prefixes, merging overlapping and adjacent ones.
+func Aggregate(prefixes []netip.Prefix) []netip.Prefix {
+	return fromRanges(toRanges(prefixes))
+}
+
+// Subtract returns the minimal sorted list of prefixes covering the
+// addresses of a that are not in b.
+func Subtract(a, b []netip.Prefix) []netip.Prefix {
+	rb := toRanges(b)
+	var out []addrRange
+	j := 0
+	for _, r := range toRanges(a) {
+		// Ranges of b ending before r also end before the ranges after it
+		for j < len(rb) && rb[j].end.Less(r.start) {
+			j++
+		}
+		start := r.start
+		for k := j; k < len(rb) && !r.end.Less(rb[k].start); k++ {
+			if start.Less(rb[k].start) {
+				out = append(out, addrRange{start, rb[k].start.Prev()})
+			}
+			if !rb[k].end.Less(r.end) {
+				start = netip.Addr{}
+				break
+			}
+			start = rb[k].end.Next()
+		}
+		if start.IsValid() {
+			out = append(out, addrRange{start, r.end})
+		}
+	}
+	return fromRanges(out)
+}
+
+// Intersect returns the minimal sorted list of prefixes covering the
+// addresses in both a and b.
+func Intersect(a, b []netip.Prefix) []netip.Prefix {
+	ra, rb := toRanges(a), toRanges(b)
+	var out []addrRange
+	for i, j := 0, 0; i < len(ra) && j < len(rb); {
+		start, end := ra[i].start, ra[i].end
+		if start.Less(rb[j].start) {
+			start = rb[j].start
+		}
+		if rb[j].end.Less(end) {
+			end = rb[j].end
+		}
+		// Ranges of different families never overlap, as all IPv4
+		// addresses sort before IPv6 ones
+		if !end.Less(start) {
+			out = append(out, addrRange{start, end})
+		}
+		if ra[i].end.Less(rb[j].end) {
+			i++
+		} else {
+			j++
+		}
+	}
+	return fromRanges(out)
+}
+
+// toRanges converts prefixes to sorted, non-overlapping ranges, merging
+// overlapping and adjacent ones.
+func toRanges(prefixes []netip.Prefix) []addrRange {
+	ranges := make([]addrRange, 0, len(prefixes))
+	for _, p := range prefixes {
+		if p.IsValid() {
+			ranges = append(ranges, addrRange{p.Masked().Addr(), LastAddr(p)})
+		}
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start.Less(ranges[j].start) })
+
+	var merged []addrRange
+	for _, r := range ranges {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			if !last.end.Less(r.start) || last.end.Next() == r.start {
+				if last.end.Less(r.end) {
+					last.end = r.end
+				}
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// fromRanges converts ranges to prefixes.
+func fromRanges(ranges []addrRange) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, r := range ranges {
+		p, err := ToPrefixes(r.start, r.end)
+		if err != nil {
+			continue
+		}
+		prefixes = append(prefixes, p...)
+	}
+	return prefixes
+}
@@ -0,0 +1,105 @@
+package iprange
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func prefixList(t *testing.T, s string) []netip.Prefix {
+	t.Helper()
+	var prefixes []netip.Prefix
+	for _, f := range strings.Fields(s) {
+		prefixes = append(prefixes, netip.MustParsePrefix(f))
+	}
+	return prefixes
+}
+
+func joinPrefixes(prefixes []netip.Prefix) string {
+	s := make([]string, len(prefixes))
+	for i, p := range prefixes {
+		s[i] = p.String()
+	}
+	return strings.Join(s, " ")
+}
+
+func TestParseList(t *testing.T) {
+	input := "# allowlist\n" +
+		"10.0.0.0/24 office\n" +
+		"\n" +
+		"192.0.2.1\n" +
+		"192.0.2.10 - 192.0.2.11\n" +
+		"10.1.2.3/16\n" +
+		"::ffff:198.51.100.7\n" +
+		"2001:db8::/32\n"
+	prefixes, err := ParseList(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseList failed: %v", err)
+	}
+	expected := "10.0.0.0/24 192.0.2.1/32 192.0.2.10/31 10.1.0.0/16 198.51.100.7/32 2001:db8::/32"
+	if got := joinPrefixes(prefixes); got != expected {
+		t.Errorf("ParseList = %s, expected %s", got, expected)
+	}
+
+	for _, bad := range []string{"10.0.0.0/33\n", "not-an-ip\n", "10.0.0.9-10.0.0.1\n"} {
+		if _, err := ParseList(strings.NewReader(bad)); err == nil {
+			t.Errorf("ParseList(%q) succeeded, expected an error", bad)
+		}
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"10.0.0.0/24 10.0.1.0/24", "10.0.0.0/23"},
+		{"10.0.1.0/24 10.0.0.0/24 10.0.0.128/25", "10.0.0.0/23"},
+		{"10.0.0.0/24 10.0.2.0/24", "10.0.0.0/24 10.0.2.0/24"},
+		{"2001:db8::/33 255.255.255.255/32 2001:db8:8000::/33 0.0.0.0/32", "0.0.0.0/32 255.255.255.255/32 2001:db8::/32"},
+		{"", ""},
+	}
+	for _, tc := range tests {
+		if got := joinPrefixes(Aggregate(prefixList(t, tc.input))); got != tc.expected {
+			t.Errorf("Aggregate(%s) = %s, expected %s", tc.input, got, tc.expected)
+		}
+	}
+}
+
+func TestSubtract(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected string
+	}{
+		{"10.0.0.0/23", "10.0.1.0/24", "10.0.0.0/24"},
+		{"10.0.0.0/24", "10.0.0.0/26 10.0.0.192/26", "10.0.0.64/26 10.0.0.128/26"},
+		{"10.0.0.0/24", "10.0.0.7/32", "10.0.0.0/30 10.0.0.4/31 10.0.0.6/32 10.0.0.8/29 10.0.0.16/28 10.0.0.32/27 10.0.0.64/26 10.0.0.128/25"},
+		{"10.0.0.0/24 10.0.2.0/24", "10.0.0.0/8", ""},
+		{"10.0.0.0/24 2001:db8::/32", "2001:db8::/33", "10.0.0.0/24 2001:db8:8000::/33"},
+		{"0.0.0.0/0", "255.255.255.0/24", "0.0.0.0/1 128.0.0.0/2 192.0.0.0/3 224.0.0.0/4 240.0.0.0/5 248.0.0.0/6 252.0.0.0/7 254.0.0.0/8 255.0.0.0/9 255.128.0.0/10 255.192.0.0/11 255.224.0.0/12 255.240.0.0/13 255.248.0.0/14 255.252.0.0/15 255.254.0.0/16 255.255.0.0/17 255.255.128.0/18 255.255.192.0/19 255.255.224.0/20 255.255.240.0/21 255.255.248.0/22 255.255.252.0/23 255.255.254.0/24"},
+		{"10.0.0.0/24", "", "10.0.0.0/24"},
+	}
+	for _, tc := range tests {
+		if got := joinPrefixes(Subtract(prefixList(t, tc.a), prefixList(t, tc.b))); got != tc.expected {
+			t.Errorf("Subtract(%s, %s) = %s, expected %s", tc.a, tc.b, got, tc.expected)
+		}
+	}
+}
+
+func TestIntersect(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected string
+	}{
+		{"10.0.0.0/23", "10.0.1.0/24 10.0.2.0/24", "10.0.1.0/24"},
+		{"10.0.0.0/24 10.0.2.0/24", "10.0.0.128/25 10.0.1.0/24 10.0.2.0/23", "10.0.0.128/25 10.0.2.0/24"},
+		{"10.0.0.0/8", "2001:db8::/32", ""},
+		{"255.255.255.255/32", "::/0", ""},
+		{"2001:db8::/32", "2001:db8:1::/48 10.0.0.0/8", "2001:db8:1::/48"},
+	}
+	for _, tc := range tests {
+		if got := joinPrefixes(Intersect(prefixList(t, tc.a), prefixList(t, tc.b))); got != tc.expected {
+			t.Errorf("Intersect(%s, %s) = %s, expected %s", tc.a, tc.b, got, tc.expected)
+		}
+	}
+}
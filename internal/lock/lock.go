@@ -0,0 +1,52 @@
+// Package lock provides advisory file locks that serialize access to the
+// cache directory between ip2cc processes.
+package lock
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrLocked is returned by TryAcquire when the lock is held elsewhere.
+var ErrLocked = errors.New("lock is held by another process")
+
+// Lock is a held advisory lock.
+type Lock struct {
+	f *os.File
+}
+
+// Acquire blocks until the lock on path is obtained. Exclusive locks are
+// for writers; any number of shared locks may be held at once.
+func Acquire(path string, exclusive bool) (*Lock, error) {
+	return acquire(path, exclusive, true)
+}
+
+// TryAcquire is like Acquire but returns ErrLocked instead of waiting.
+func TryAcquire(path string, exclusive bool) (*Lock, error) {
+	return acquire(path, exclusive, false)
+}
+
+func acquire(path string, exclusive, wait bool) (*Lock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f, exclusive, wait); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Lock{f: f}, nil
+}
+
+// Release releases the lock. The lock file itself is left in place.
+func (l *Lock) Release() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	err := unlockFile(l.f)
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	l.f = nil
+	return err
+}
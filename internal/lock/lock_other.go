@@ -0,0 +1,15 @@
+//go:build !unix && !windows
+
+package lock
+
+import "os"
+
+// Platforms without file locking run unlocked.
+
+func lockFile(f *os.File, exclusive, wait bool) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,68 @@
+//go:build unix
+
+package lock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockExclusion(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	path := filepath.Join(tmpDir, ".lock")
+
+	// Shared locks coexist
+	r1, err := TryAcquire(path, false)
+	if err != nil {
+		t.Fatalf("TryAcquire shared failed: %v", err)
+	}
+	r2, err := TryAcquire(path, false)
+	if err != nil {
+		t.Fatalf("second TryAcquire shared failed: %v", err)
+	}
+
+	// Writers are kept out while readers hold the lock
+	if _, err := TryAcquire(path, true); err != ErrLocked {
+		t.Errorf("TryAcquire exclusive = %v, expected %v", err, ErrLocked)
+	}
+	r1.Release()
+	r2.Release()
+
+	w, err := TryAcquire(path, true)
+	if err != nil {
+		t.Fatalf("TryAcquire exclusive failed: %v", err)
+	}
+	if _, err := TryAcquire(path, false); err != ErrLocked {
+		t.Errorf("TryAcquire shared = %v, expected %v", err, ErrLocked)
+	}
+
+	// A blocked Acquire proceeds once the writer releases
+	acquired := make(chan *Lock)
+	go func() {
+		l, err := Acquire(path, false)
+		if err != nil {
+			t.Errorf("Acquire failed: %v", err)
+		}
+		acquired <- l
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("Acquire returned while exclusive lock was held")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	w.Release()
+	select {
+	case l := <-acquired:
+		l.Release()
+	case <-time.After(5 * time.Second):
+		t.Fatal("Acquire did not return after release")
+	}
+}
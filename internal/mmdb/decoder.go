@@ -0,0 +1,214 @@
+package mmdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// Data section field types.
+const (
+	typeExtended = 0
+	typePointer  = 1
+	typeString   = 2
+	typeDouble   = 3
+	typeBytes    = 4
+	typeUint16   = 5
+	typeUint32   = 6
+	typeMap      = 7
+	typeInt32    = 8
+	typeUint64   = 9
+	typeUint128  = 10
+	typeArray    = 11
+	typeBool     = 14
+	typeFloat    = 15
+)
+
+// maxDepth bounds the nesting of decoded values, so that a malformed
+// file with pointer cycles cannot recurse forever.
+const maxDepth = 64
+
+type decoder struct {
+	buf   []byte
+	depth int
+}
+
+// decode decodes the value at offset and returns it with the offset of the
+// next value.
+func (d *decoder) decode(offset uint) (interface{}, uint, error) {
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > maxDepth {
+		return nil, 0, fmt.Errorf("values nested too deeply")
+	}
+
+	typ, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typ == typePointer {
+		target, next, err := d.pointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		v, _, err := d.decode(target)
+		return v, next, err
+	}
+
+	switch typ {
+	case typeMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			k, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("map key is not a string")
+			}
+			v, next, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			offset = next
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			v, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			offset = next
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	end := offset + size
+	if end > uint(len(d.buf)) || end < offset {
+		return nil, 0, fmt.Errorf("value at %d exceeds data section", offset)
+	}
+	b := d.buf[offset:end]
+
+	switch typ {
+	case typeString:
+		return string(b), end, nil
+	case typeBytes:
+		return append([]byte(nil), b...), end, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), end, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size %d", size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), end, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("invalid integer size %d", size)
+		}
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, end, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("invalid int32 size %d", size)
+		}
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int64(int32(v)), end, nil
+	case typeUint128:
+		return new(big.Int).SetBytes(b), end, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported data type %d", typ)
+	}
+}
+
+// control decodes the control byte (and extended type and size bytes) at
+// offset. For pointers, size holds the raw size bits.
+func (d *decoder) control(offset uint) (typ int, size uint, next uint, err error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, 0, 0, fmt.Errorf("offset %d exceeds data section", offset)
+	}
+	ctrl := d.buf[offset]
+	offset++
+	typ = int(ctrl >> 5)
+	if typ == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return 0, 0, 0, fmt.Errorf("truncated extended type")
+		}
+		typ = 7 + int(d.buf[offset])
+		offset++
+	}
+	size = uint(ctrl & 0x1f)
+	if typ == typePointer {
+		return typ, size, offset, nil
+	}
+
+	var extra uint
+	switch size {
+	case 29:
+		extra = 1
+	case 30:
+		extra = 2
+	case 31:
+		extra = 3
+	default:
+		return typ, size, offset, nil
+	}
+	if offset+extra > uint(len(d.buf)) {
+		return 0, 0, 0, fmt.Errorf("truncated size")
+	}
+	var n uint
+	for _, c := range d.buf[offset : offset+extra] {
+		n = n<<8 | uint(c)
+	}
+	switch size {
+	case 29:
+		size = 29 + n
+	case 30:
+		size = 285 + n
+	default:
+		size = 65821 + n
+	}
+	return typ, size, offset + extra, nil
+}
+
+// pointer decodes a pointer whose size bits are sizeBits and whose value
+// bytes start at offset.
+func (d *decoder) pointer(sizeBits, offset uint) (target uint, next uint, err error) {
+	n := (sizeBits >> 3) + 1
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, fmt.Errorf("truncated pointer")
+	}
+	var v uint
+	for _, c := range d.buf[offset : offset+n] {
+		v = v<<8 | uint(c)
+	}
+	vvv := sizeBits & 0x7
+	switch n {
+	case 1:
+		target = vvv<<8 | v
+	case 2:
+		target = (vvv<<16 | v) + 2048
+	case 3:
+		target = (vvv<<24 | v) + 526336
+	default:
+		target = v
+	}
+	return target, offset + n, nil
+}
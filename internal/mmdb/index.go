@@ -0,0 +1,43 @@
+package mmdb
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/hightemp/ip2cc/internal/countries"
+	"github.com/hightemp/ip2cc/internal/index"
+)
+
+// LoadIndex builds index tries holding the country of every network, so
+// that the database can be queried like a snapshot. Networks without a
+// country, such as anonymous proxies in GeoLite2, are left out.
+func (r *Reader) LoadIndex() (*index.Trie, *index.Trie, error) {
+	v4, v6 := index.NewTrie(false), index.NewTrie(true)
+
+	// Many networks share a record; decode each one once
+	codes := make(map[uint]string)
+	err := r.Networks(func(prefix netip.Prefix, offset uint) error {
+		cc, ok := codes[offset]
+		if !ok {
+			record, err := r.Decode(offset)
+			if err != nil {
+				return fmt.Errorf("record of %s: %w", prefix, err)
+			}
+			cc = countries.Normalize(CountryCode(record))
+			codes[offset] = cc
+		}
+		if cc == "" {
+			return nil
+		}
+
+		trie := v4
+		if prefix.Addr().Is6() {
+			trie = v6
+		}
+		return trie.Insert(prefix, index.PrefixData{CountryCode: cc})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return v4, v6, nil
+}
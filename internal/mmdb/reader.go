@@ -0,0 +1,235 @@
+// Package mmdb reads MaxMind DB files such as GeoLite2-Country.mmdb.
+//
+// Only what ip2cc needs is implemented: the metadata, enumeration of the
+// networks in the search tree, and decoding of their data records. The
+// format is described at https://maxmind.github.io/MaxMind-DB/.
+package mmdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"time"
+)
+
+// metadataMarker precedes the metadata map at the end of the file.
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// dataSectionSeparator is the size of the zero block between the search
+// tree and the data section.
+const dataSectionSeparator = 16
+
+// ErrInvalid is returned for files that are not valid MaxMind DBs.
+var ErrInvalid = errors.New("invalid MaxMind DB")
+
+// Metadata describes a database.
+type Metadata struct {
+	DatabaseType string
+	BuildTime    time.Time
+	IPVersion    int
+	RecordSize   int
+	NodeCount    int
+	Description  string
+}
+
+// Reader is an opened database. The whole file is held in memory.
+type Reader struct {
+	Metadata Metadata
+	buf      []byte
+	data     []byte
+	nodeSize int
+}
+
+// Open reads the database at path.
+func Open(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := FromBytes(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return r, nil
+}
+
+// FromBytes parses a database held in buf.
+func FromBytes(buf []byte) (*Reader, error) {
+	i := bytes.LastIndex(buf, metadataMarker)
+	if i < 0 {
+		return nil, fmt.Errorf("%w: metadata not found", ErrInvalid)
+	}
+	d := decoder{buf: buf[i+len(metadataMarker):]}
+	raw, _, err := d.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: metadata: %v", ErrInvalid, err)
+	}
+	m, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata is not a map", ErrInvalid)
+	}
+
+	meta := Metadata{
+		DatabaseType: stringField(m, "database_type"),
+		IPVersion:    int(uintField(m, "ip_version")),
+		RecordSize:   int(uintField(m, "record_size")),
+		NodeCount:    int(uintField(m, "node_count")),
+	}
+	if epoch := uintField(m, "build_epoch"); epoch > 0 {
+		meta.BuildTime = time.Unix(int64(epoch), 0).UTC()
+	}
+	if desc, ok := m["description"].(map[string]interface{}); ok {
+		meta.Description = stringField(desc, "en")
+	}
+
+	switch meta.RecordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("%w: unsupported record size %d", ErrInvalid, meta.RecordSize)
+	}
+	if meta.IPVersion != 4 && meta.IPVersion != 6 {
+		return nil, fmt.Errorf("%w: unsupported IP version %d", ErrInvalid, meta.IPVersion)
+	}
+
+	nodeSize := meta.RecordSize / 4
+	treeSize := meta.NodeCount * nodeSize
+	if treeSize+dataSectionSeparator > i {
+		return nil, fmt.Errorf("%w: search tree exceeds file", ErrInvalid)
+	}
+	return &Reader{
+		Metadata: meta,
+		buf:      buf,
+		data:     buf[treeSize+dataSectionSeparator : i],
+		nodeSize: nodeSize,
+	}, nil
+}
+
+// readNode returns the left (bit 0) and right (bit 1) records of a node.
+func (r *Reader) readNode(node int) (uint, uint) {
+	b := r.buf[node*r.nodeSize:]
+	switch r.Metadata.RecordSize {
+	case 24:
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]),
+			uint(b[3])<<16 | uint(b[4])<<8 | uint(b[5])
+	case 28:
+		return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]),
+			uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(b[0])<<24 | uint(b[1])<<16 | uint(b[2])<<8 | uint(b[3]),
+			uint(b[4])<<24 | uint(b[5])<<16 | uint(b[6])<<8 | uint(b[7])
+	}
+}
+
+// Networks calls fn for every network in the database with the offset of
+// its data record, which Decode resolves. Records shared by several
+// networks have the same offset. IPv4 networks of an IPv6 database are
+// reported once, as IPv4 prefixes; the aliases of the IPv4 space at
+// ::ffff:0:0/96 and 2002::/16 are skipped.
+func (r *Reader) Networks(fn func(prefix netip.Prefix, offset uint) error) error {
+	if r.Metadata.IPVersion == 4 {
+		return r.walk(0, [16]byte{}, 0, false, -1, fn)
+	}
+
+	// The IPv4 space is the subtree at ::/96
+	ipv4Start := 0
+	for depth := 0; depth < 96 && ipv4Start < r.Metadata.NodeCount; depth++ {
+		left, _ := r.readNode(ipv4Start)
+		ipv4Start = int(left)
+	}
+	if ipv4Start < r.Metadata.NodeCount {
+		if err := r.walk(ipv4Start, [16]byte{}, 0, false, -1, fn); err != nil {
+			return err
+		}
+	}
+	return r.walk(0, [16]byte{}, 0, true, ipv4Start, fn)
+}
+
+// walk descends from node at depth, reporting the networks below it. For
+// IPv6, the subtree at skip (the IPv4 space and its aliases) is left out.
+func (r *Reader) walk(node int, acc [16]byte, depth int, ipv6 bool, skip int, fn func(netip.Prefix, uint) error) error {
+	maxDepth := 32
+	if ipv6 {
+		maxDepth = 128
+	}
+	nodeCount := uint(r.Metadata.NodeCount)
+
+	for bit := 0; bit < 2; bit++ {
+		next := acc
+		if bit == 1 {
+			next[depth/8] |= 0x80 >> (depth % 8)
+		}
+		left, right := r.readNode(node)
+		record := left
+		if bit == 1 {
+			record = right
+		}
+
+		switch {
+		case record == nodeCount:
+			// Empty
+		case record > nodeCount:
+			offset := record - nodeCount - dataSectionSeparator
+			if err := fn(makePrefix(next, depth+1, ipv6), offset); err != nil {
+				return err
+			}
+		case int(record) == skip:
+			// IPv4 space, reported separately
+		case depth+1 >= maxDepth:
+			return fmt.Errorf("%w: search tree deeper than %d bits", ErrInvalid, maxDepth)
+		default:
+			if err := r.walk(int(record), next, depth+1, ipv6, skip, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func makePrefix(acc [16]byte, bits int, ipv6 bool) netip.Prefix {
+	if !ipv6 {
+		return netip.PrefixFrom(netip.AddrFrom4([4]byte{acc[0], acc[1], acc[2], acc[3]}), bits)
+	}
+	return netip.PrefixFrom(netip.AddrFrom16(acc), bits)
+}
+
+// Decode returns the data record at offset, as reported by Networks. Maps
+// decode to map[string]interface{}, arrays to []interface{}, and numbers to
+// uint64, int64 or float64.
+func (r *Reader) Decode(offset uint) (interface{}, error) {
+	if offset >= uint(len(r.data)) {
+		return nil, fmt.Errorf("%w: data offset %d out of range", ErrInvalid, offset)
+	}
+	d := decoder{buf: r.data}
+	v, _, err := d.decode(offset)
+	return v, err
+}
+
+// CountryCode extracts the ISO country code of a GeoIP2/GeoLite2 record:
+// the country of the network, falling back to the registered country, or
+// a top-level "country_code" as used by other vendors.
+func CountryCode(record interface{}) string {
+	m, ok := record.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	for _, key := range []string{"country", "registered_country"} {
+		if c, ok := m[key].(map[string]interface{}); ok {
+			if code := stringField(c, "iso_code"); code != "" {
+				return code
+			}
+		}
+	}
+	return stringField(m, "country_code")
+}
+
+func stringField(m map[string]interface{}, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+func uintField(m map[string]interface{}, key string) uint64 {
+	v, _ := m[key].(uint64)
+	return v
+}
@@ -0,0 +1,256 @@
+package mmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testDB builds MaxMind DBs with 24-bit records for tests.
+type testDB struct {
+	ipVersion int
+	nodes     [][2]int // child node index, or -1 for empty, or -2-data
+	data      bytes.Buffer
+}
+
+func newTestDB(ipVersion int) *testDB {
+	return &testDB{ipVersion: ipVersion, nodes: [][2]int{{-1, -1}}}
+}
+
+// insert adds a network whose record is a GeoIP2-style country map.
+func (db *testDB) insert(t *testing.T, cidr, cc string) {
+	t.Helper()
+	prefix := netip.MustParsePrefix(cidr)
+	addr := prefix.Addr()
+	bits := prefix.Bits()
+	if db.ipVersion == 6 && addr.Is4() {
+		addr = netip.AddrFrom16(addr.As16())
+		bits += 96
+		// As16 maps to ::ffff:a.b.c.d; the IPv4 space is at ::a.b.c.d
+		b := addr.As16()
+		b[10], b[11] = 0, 0
+		addr = netip.AddrFrom16(b)
+	}
+	raw := addr.AsSlice()
+
+	offset := db.data.Len()
+	writeMap(&db.data, 1)
+	writeString(&db.data, "country")
+	writeMap(&db.data, 1)
+	writeString(&db.data, "iso_code")
+	writeString(&db.data, cc)
+
+	node := 0
+	for i := 0; i < bits; i++ {
+		bit := int(raw[i/8]>>(7-i%8)) & 1
+		if i == bits-1 {
+			db.nodes[node][bit] = -2 - offset
+			return
+		}
+		if db.nodes[node][bit] < 0 {
+			db.nodes = append(db.nodes, [2]int{-1, -1})
+			db.nodes[node][bit] = len(db.nodes) - 1
+		}
+		node = db.nodes[node][bit]
+	}
+}
+
+// alias points the network at cidr to the node at the end of the path of
+// target, like the IPv4 aliases of MaxMind IPv6 databases.
+func (db *testDB) alias(cidr, target string) {
+	targetPrefix := netip.MustParsePrefix(target)
+	tb := targetPrefix.Addr().AsSlice()
+	targetNode := 0
+	for i := 0; i < targetPrefix.Bits(); i++ {
+		targetNode = db.nodes[targetNode][int(tb[i/8]>>(7-i%8))&1]
+	}
+
+	prefix := netip.MustParsePrefix(cidr)
+	raw := prefix.Addr().AsSlice()
+	node := 0
+	for i := 0; i < prefix.Bits(); i++ {
+		bit := int(raw[i/8]>>(7-i%8)) & 1
+		if i == prefix.Bits()-1 {
+			db.nodes[node][bit] = targetNode
+			return
+		}
+		if db.nodes[node][bit] < 0 {
+			db.nodes = append(db.nodes, [2]int{-1, -1})
+			db.nodes[node][bit] = len(db.nodes) - 1
+		}
+		node = db.nodes[node][bit]
+	}
+}
+
+func (db *testDB) bytes() []byte {
+	var out bytes.Buffer
+	n := len(db.nodes)
+	for _, node := range db.nodes {
+		for _, rec := range node {
+			v := rec
+			switch {
+			case rec == -1:
+				v = n
+			case rec <= -2:
+				v = n + 16 + (-2 - rec)
+			}
+			out.Write([]byte{byte(v >> 16), byte(v >> 8), byte(v)})
+		}
+	}
+	out.Write(make([]byte, 16))
+	out.Write(db.data.Bytes())
+
+	out.Write(metadataMarker)
+	writeMap(&out, 5)
+	writeString(&out, "node_count")
+	writeUint(&out, 6, uint64(n))
+	writeString(&out, "record_size")
+	writeUint(&out, 5, 24)
+	writeString(&out, "ip_version")
+	writeUint(&out, 5, uint64(db.ipVersion))
+	writeString(&out, "database_type")
+	writeString(&out, "Test-Country")
+	writeString(&out, "build_epoch")
+	out.Write([]byte{0<<5 | 8, typeUint64 - 7})
+	binary.Write(&out, binary.BigEndian, uint64(1736899200))
+	return out.Bytes()
+}
+
+func writeMap(b *bytes.Buffer, n int) {
+	b.WriteByte(byte(typeMap<<5 | n))
+}
+
+func writeString(b *bytes.Buffer, s string) {
+	b.WriteByte(byte(typeString<<5 | len(s)))
+	b.WriteString(s)
+}
+
+func writeUint(b *bytes.Buffer, typ int, v uint64) {
+	var raw []byte
+	for v > 0 {
+		raw = append([]byte{byte(v)}, raw...)
+		v >>= 8
+	}
+	b.WriteByte(byte(typ<<5 | len(raw)))
+	b.Write(raw)
+}
+
+func TestReaderIPv6Database(t *testing.T) {
+	db := newTestDB(6)
+	db.insert(t, "8.8.8.0/24", "us")
+	db.insert(t, "193.0.0.0/21", "NL")
+	db.insert(t, "2001:4860::/32", "US")
+	db.alias("::ffff:0:0/96", "::/96")
+	db.alias("2002::/16", "::/96")
+
+	r, err := FromBytes(db.bytes())
+	if err != nil {
+		t.Fatalf("FromBytes failed: %v", err)
+	}
+	if r.Metadata.DatabaseType != "Test-Country" || r.Metadata.IPVersion != 6 {
+		t.Errorf("Metadata = %+v, expected Test-Country IPv6", r.Metadata)
+	}
+	if got := r.Metadata.BuildTime.Format("2006-01-02"); got != "2025-01-15" {
+		t.Errorf("BuildTime = %s, expected 2025-01-15", got)
+	}
+
+	var networks []string
+	if err := r.Networks(func(p netip.Prefix, offset uint) error {
+		networks = append(networks, p.String())
+		return nil
+	}); err != nil {
+		t.Fatalf("Networks failed: %v", err)
+	}
+	expected := []string{"8.8.8.0/24", "193.0.0.0/21", "2001:4860::/32"}
+	if len(networks) != len(expected) {
+		t.Fatalf("Networks = %v, expected %v", networks, expected)
+	}
+	for i := range expected {
+		if networks[i] != expected[i] {
+			t.Errorf("Network %d = %s, expected %s", i, networks[i], expected[i])
+		}
+	}
+
+	v4, v6, err := r.LoadIndex()
+	if err != nil {
+		t.Fatalf("LoadIndex failed: %v", err)
+	}
+	tests := []struct {
+		ip string
+		cc string
+	}{
+		{"8.8.8.8", "US"},
+		{"193.0.6.139", "NL"},
+		{"2001:4860::8888", "US"},
+	}
+	for _, tt := range tests {
+		ip := netip.MustParseAddr(tt.ip)
+		trie := v4
+		if ip.Is6() {
+			trie = v6
+		}
+		data := trie.Lookup(ip)
+		if data == nil || data.CountryCode != tt.cc {
+			t.Errorf("Lookup(%s) = %+v, expected %s", tt.ip, data, tt.cc)
+		}
+	}
+	if data := v4.Lookup(netip.MustParseAddr("1.1.1.1")); data != nil {
+		t.Errorf("Lookup(1.1.1.1) = %+v, expected nil", data)
+	}
+}
+
+func TestReaderIPv4Database(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	db := newTestDB(4)
+	db.insert(t, "1.0.0.0/24", "AU")
+	path := filepath.Join(tmpDir, "test.mmdb")
+	if err := os.WriteFile(path, db.bytes(), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	v4, _, err := r.LoadIndex()
+	if err != nil {
+		t.Fatalf("LoadIndex failed: %v", err)
+	}
+	ip := netip.MustParseAddr("1.0.0.1")
+	if data := v4.Lookup(ip); data == nil || data.Prefix(ip).String() != "1.0.0.0/24" {
+		t.Errorf("Lookup(1.0.0.1) = %+v, expected 1.0.0.0/24", data)
+	}
+}
+
+func TestFromBytesInvalid(t *testing.T) {
+	if _, err := FromBytes([]byte("not a database")); err == nil {
+		t.Error("FromBytes should reject data without metadata")
+	}
+}
+
+func TestDecodePointer(t *testing.T) {
+	// A map whose value is a pointer to a string stored before it
+	var b bytes.Buffer
+	writeString(&b, "DE")
+	mapOffset := b.Len()
+	writeMap(&b, 1)
+	writeString(&b, "country_code")
+	b.Write([]byte{typePointer << 5, 0})
+
+	d := decoder{buf: b.Bytes()}
+	v, _, err := d.decode(uint(mapOffset))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if cc := CountryCode(v); cc != "DE" {
+		t.Errorf("CountryCode = %q, expected DE", cc)
+	}
+}
@@ -0,0 +1,167 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// SIEMVendor and SIEMProduct identify ip2cc in CEF and LEEF headers.
+const (
+	SIEMVendor  = "ip2cc"
+	SIEMProduct = "ip2cc"
+)
+
+// siemField is a field of a CEF or LEEF record.
+type siemField struct {
+	// leef is the LEEF key; cef and cefLabel are the CEF key and, for
+	// custom fields, the label naming it.
+	leef, cef, cefLabel string
+	value               string
+}
+
+// siemFields returns the fields of r reported in CEF and LEEF records.
+func siemFields(r *LookupResult) []siemField {
+	var fields []siemField
+	add := func(leef, cef, cefLabel, value string) {
+		if value != "" {
+			fields = append(fields, siemField{leef, cef, cefLabel, value})
+		}
+	}
+
+	// Addresses go in the source address fields, other inputs in a custom one
+	if ip, err := netip.ParseAddr(r.IP); err == nil && ip.Is4() {
+		add("src", "src", "", r.IP)
+	} else if err == nil {
+		add("src", "c6a2", "Source IPv6 Address", r.IP)
+	} else {
+		add("input", "cs6", "Input", r.IP)
+	}
+	add("srcCountry", "cs1", "Country", r.CountryCode)
+	add("srcCountryName", "cs2", "Country Name", r.CountryName)
+	add("srcNetwork", "cs3", "Network", r.Network)
+	if r.Provider != nil && r.Provider.Error == "" {
+		asns := make([]string, len(r.Provider.ASNs))
+		for i, asn := range r.Provider.ASNs {
+			asns[i] = strconv.Itoa(asn)
+		}
+		add("srcASN", "cs4", "ASN", strings.Join(asns, ","))
+		if len(r.Provider.Holders) > 0 {
+			add("srcProvider", "cs5", "Provider", r.Provider.Holders[0])
+		}
+	}
+	add("tags", "flexString1", "Tags", strings.Join(r.Tags, ","))
+	if r.Geolocation != nil {
+		add("srcLat", "slat", "", strconv.FormatFloat(r.Geolocation.Latitude, 'f', -1, 64))
+		add("srcLong", "slong", "", strconv.FormatFloat(r.Geolocation.Longitude, 'f', -1, 64))
+	}
+	add("snapshot", "flexString2", "Snapshot", r.SnapshotTime)
+	add("error", "msg", "", r.Error)
+	return fields
+}
+
+// siemEvent returns the event ID and name of r.
+func siemEvent(r *LookupResult) (string, string) {
+	if r.Error != "" {
+		return "lookup-error", "IP lookup failed"
+	}
+	return "lookup", "IP lookup"
+}
+
+// CEFWriter writes results as ArcSight Common Event Format records, one
+// per line.
+type CEFWriter struct {
+	w       io.Writer
+	version string
+}
+
+// NewCEFWriter creates a writer of CEF records to w. version is the
+// product version reported in the header.
+func NewCEFWriter(w io.Writer, version string) *CEFWriter {
+	return &CEFWriter{w: w, version: version}
+}
+
+// Write writes a result.
+func (c *CEFWriter) Write(r *LookupResult) error {
+	_, err := fmt.Fprintln(c.w, FormatCEF(r, c.version))
+	return err
+}
+
+// Close does nothing; every record is complete once written.
+func (c *CEFWriter) Close() error {
+	return nil
+}
+
+// FormatCEF formats r as a CEF record.
+func FormatCEF(r *LookupResult, version string) string {
+	id, name := siemEvent(r)
+	severity := "0"
+	if r.Error != "" {
+		severity = "3"
+	}
+	header := []string{"CEF:0", SIEMVendor, SIEMProduct, version, id, name, severity}
+	for i := 1; i < len(header); i++ {
+		header[i] = cefHeaderEscaper.Replace(header[i])
+	}
+
+	var ext []string
+	for _, f := range siemFields(r) {
+		ext = append(ext, f.cef+"="+cefValueEscaper.Replace(f.value))
+		if f.cefLabel != "" {
+			ext = append(ext, f.cef+"Label="+cefValueEscaper.Replace(f.cefLabel))
+		}
+	}
+	return strings.Join(header, "|") + "|" + strings.Join(ext, " ")
+}
+
+var (
+	cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, "|", `\|`, "\n", " ", "\r", " ")
+	cefValueEscaper  = strings.NewReplacer(`\`, `\\`, "=", `\=`, "\n", `\n`, "\r", `\r`)
+)
+
+// LEEFWriter writes results as IBM QRadar Log Event Extended Format 1.0
+// records, one per line.
+type LEEFWriter struct {
+	w       io.Writer
+	version string
+}
+
+// NewLEEFWriter creates a writer of LEEF records to w. version is the
+// product version reported in the header.
+func NewLEEFWriter(w io.Writer, version string) *LEEFWriter {
+	return &LEEFWriter{w: w, version: version}
+}
+
+// Write writes a result.
+func (l *LEEFWriter) Write(r *LookupResult) error {
+	_, err := fmt.Fprintln(l.w, FormatLEEF(r, l.version))
+	return err
+}
+
+// Close does nothing; every record is complete once written.
+func (l *LEEFWriter) Close() error {
+	return nil
+}
+
+// FormatLEEF formats r as a LEEF 1.0 record, with tab-separated
+// attributes.
+func FormatLEEF(r *LookupResult, version string) string {
+	id, _ := siemEvent(r)
+	header := []string{"LEEF:1.0", SIEMVendor, SIEMProduct, version, id}
+	for i := 1; i < len(header); i++ {
+		header[i] = leefHeaderEscaper.Replace(header[i])
+	}
+
+	attrs := make([]string, 0, 8)
+	for _, f := range siemFields(r) {
+		attrs = append(attrs, f.leef+"="+leefValueEscaper.Replace(f.value))
+	}
+	return strings.Join(header, "|") + "|" + strings.Join(attrs, "\t")
+}
+
+var (
+	leefHeaderEscaper = strings.NewReplacer("|", `\|`, "\t", " ", "\n", " ", "\r", " ")
+	leefValueEscaper  = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+)
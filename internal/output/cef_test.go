@@ -0,0 +1,66 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hightemp/ip2cc/internal/provider"
+)
+
+func TestFormatCEF(t *testing.T) {
+	tests := []struct {
+		result   *LookupResult
+		expected string
+	}{
+		{
+			&LookupResult{
+				IP:           "193.0.6.139",
+				CountryCode:  "NL",
+				CountryName:  "Netherlands",
+				Network:      "193.0.0.0/21",
+				Provider:     &provider.Result{ASNs: []int{3333}, Holders: []string{"RIPE-NCC-AS a=b|c"}},
+				Tags:         []string{"corp-vpn"},
+				SnapshotTime: "2025-01-15",
+			},
+			`CEF:0|ip2cc|ip2cc|1.2|lookup|IP lookup|0|src=193.0.6.139 cs1=NL cs1Label=Country cs2=Netherlands cs2Label=Country Name cs3=193.0.0.0/21 cs3Label=Network cs4=3333 cs4Label=ASN cs5=RIPE-NCC-AS a\=b|c cs5Label=Provider flexString1=corp-vpn flexString1Label=Tags flexString2=2025-01-15 flexString2Label=Snapshot`,
+		},
+		{
+			&LookupResult{IP: "2001:db8::1", Error: "not found\nin index"},
+			`CEF:0|ip2cc|ip2cc|1.2|lookup-error|IP lookup failed|3|c6a2=2001:db8::1 c6a2Label=Source IPv6 Address msg=not found\nin index`,
+		},
+		{
+			&LookupResult{IP: "10.0.0.0/8", CountryCode: "PRIVATE", Special: true},
+			`CEF:0|ip2cc|ip2cc|1.2|lookup|IP lookup|0|cs6=10.0.0.0/8 cs6Label=Input cs1=PRIVATE cs1Label=Country`,
+		},
+	}
+	for _, tc := range tests {
+		if got := FormatCEF(tc.result, "1.2"); got != tc.expected {
+			t.Errorf("FormatCEF(%s) =\n%s\nexpected\n%s", tc.result.IP, got, tc.expected)
+		}
+	}
+	if got := FormatCEF(&LookupResult{IP: "8.8.8.8"}, `v1|x\y`); got != `CEF:0|ip2cc|ip2cc|v1\|x\\y|lookup|IP lookup|0|src=8.8.8.8` {
+		t.Errorf("FormatCEF with an escaped version = %s", got)
+	}
+}
+
+func TestFormatLEEF(t *testing.T) {
+	r := &LookupResult{
+		IP:          "193.0.6.139",
+		CountryCode: "NL",
+		Network:     "193.0.0.0/21",
+		Provider:    &provider.Result{ASNs: []int{3333, 1}, Holders: []string{"RIPE\tNCC"}},
+		Geolocation: &provider.Geolocation{Latitude: 52.37, Longitude: 4.89},
+	}
+	expected := "LEEF:1.0|ip2cc|ip2cc|1.2|lookup|src=193.0.6.139\tsrcCountry=NL\tsrcNetwork=193.0.0.0/21\tsrcASN=3333,1\tsrcProvider=RIPE NCC\tsrcLat=52.37\tsrcLong=4.89"
+	if got := FormatLEEF(r, "1.2"); got != expected {
+		t.Errorf("FormatLEEF =\n%q\nexpected\n%q", got, expected)
+	}
+
+	var buf bytes.Buffer
+	w := NewLEEFWriter(&buf, "1.2")
+	w.Write(&LookupResult{IP: "2001:db8::1", Error: "not found in index"})
+	w.Close()
+	if got := buf.String(); got != "LEEF:1.0|ip2cc|ip2cc|1.2|lookup-error|src=2001:db8::1\terror=not found in index\n" {
+		t.Errorf("LEEFWriter wrote %q", got)
+	}
+}
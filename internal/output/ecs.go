@@ -0,0 +1,173 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/countries"
+)
+
+// ECSVersion is the version of the Elastic Common Schema written by
+// ECSWriter.
+const ECSVersion = "8.11.0"
+
+// ecsDocument is a result laid out in Elastic Common Schema fields. Fields
+// without an ECS counterpart are in the custom ip2cc field set.
+type ecsDocument struct {
+	Timestamp time.Time `json:"@timestamp"`
+	ECS       struct {
+		Version string `json:"version"`
+	} `json:"ecs"`
+	Event  ecsEvent  `json:"event"`
+	Source ecsSource `json:"source"`
+	Tags   []string  `json:"tags,omitempty"`
+	Error  *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+	IP2CC ecsCustom `json:"ip2cc"`
+}
+
+type ecsEvent struct {
+	Kind     string   `json:"kind"`
+	Category []string `json:"category"`
+	Type     []string `json:"type"`
+	Dataset  string   `json:"dataset"`
+	Outcome  string   `json:"outcome"`
+}
+
+type ecsSource struct {
+	Address string  `json:"address"`
+	IP      string  `json:"ip,omitempty"`
+	Geo     *ecsGeo `json:"geo,omitempty"`
+	AS      *ecsAS  `json:"as,omitempty"`
+}
+
+type ecsGeo struct {
+	CountryISOCode string       `json:"country_iso_code,omitempty"`
+	CountryName    string       `json:"country_name,omitempty"`
+	ContinentCode  string       `json:"continent_code,omitempty"`
+	ContinentName  string       `json:"continent_name,omitempty"`
+	CityName       string       `json:"city_name,omitempty"`
+	Location       *ecsLocation `json:"location,omitempty"`
+}
+
+type ecsLocation struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+type ecsAS struct {
+	Number       int `json:"number,omitempty"`
+	Organization struct {
+		Name string `json:"name,omitempty"`
+	} `json:"organization"`
+}
+
+type ecsCustom struct {
+	Network       string                 `json:"network,omitempty"`
+	Containment   string                 `json:"containment,omitempty"`
+	Countries     []string               `json:"countries,omitempty"`
+	CountrySource string                 `json:"country_source,omitempty"`
+	RIR           string                 `json:"rir,omitempty"`
+	Allocated     string                 `json:"allocated,omitempty"`
+	ASNs          []int                  `json:"asns,omitempty"`
+	Special       bool                   `json:"special,omitempty"`
+	Anycast       bool                   `json:"anycast,omitempty"`
+	Snapshot      string                 `json:"snapshot,omitempty"`
+	Extra         map[string]interface{} `json:"extra,omitempty"`
+}
+
+// FormatECS formats r as a JSON document in Elastic Common Schema fields,
+// with @timestamp set to ts.
+func FormatECS(r *LookupResult, ts time.Time) ([]byte, error) {
+	doc := ecsDocument{
+		Timestamp: ts.UTC(),
+		Event: ecsEvent{
+			Kind:     "enrichment",
+			Category: []string{"network"},
+			Type:     []string{"info"},
+			Dataset:  "ip2cc.lookup",
+			Outcome:  "success",
+		},
+		Source: ecsSource{Address: r.IP},
+		Tags:   r.Tags,
+		IP2CC: ecsCustom{
+			Network:       r.Network,
+			Containment:   r.Containment,
+			Countries:     r.Countries,
+			CountrySource: r.CountrySource,
+			RIR:           r.RIR,
+			Allocated:     r.Allocated,
+			Special:       r.Special,
+			Anycast:       r.Anycast,
+			Snapshot:      r.SnapshotTime,
+			Extra:         r.Extra,
+		},
+	}
+	doc.ECS.Version = ECSVersion
+	if ip, err := netip.ParseAddr(r.IP); err == nil {
+		doc.Source.IP = ip.String()
+	}
+	if r.Error != "" {
+		doc.Event.Outcome = "failure"
+		doc.Error = &struct {
+			Message string `json:"message"`
+		}{r.Error}
+	}
+
+	// Special-purpose pseudo-codes such as PRIVATE are not ISO codes
+	geo := &ecsGeo{ContinentCode: r.Continent, ContinentName: countries.ContinentName(r.Continent)}
+	if !r.Special {
+		geo.CountryISOCode, geo.CountryName = r.CountryCode, r.CountryName
+	}
+	if g := r.Geolocation; g != nil {
+		geo.CityName = g.City
+		geo.Location = &ecsLocation{Lat: g.Latitude, Lon: g.Longitude}
+	}
+	if *geo != (ecsGeo{}) {
+		doc.Source.Geo = geo
+	}
+
+	if p := r.Provider; p != nil && p.Error == "" && (len(p.ASNs) > 0 || len(p.Holders) > 0) {
+		doc.Source.AS = &ecsAS{}
+		if len(p.ASNs) > 0 {
+			doc.Source.AS.Number = p.ASNs[0]
+			doc.IP2CC.ASNs = p.ASNs
+		}
+		if len(p.Holders) > 0 {
+			doc.Source.AS.Organization.Name = p.Holders[0]
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// ECSWriter writes results as newline-delimited ECS documents, ready for
+// the Elasticsearch bulk API or a log shipper.
+type ECSWriter struct {
+	w   io.Writer
+	now func() time.Time
+}
+
+// NewECSWriter creates a writer of ECS documents to w, timestamped with
+// the time they are written.
+func NewECSWriter(w io.Writer) *ECSWriter {
+	return &ECSWriter{w: w, now: time.Now}
+}
+
+// Write writes a result as one line.
+func (e *ECSWriter) Write(r *LookupResult) error {
+	data, err := FormatECS(r, e.now())
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(e.w, "%s\n", data)
+	return err
+}
+
+// Close does nothing; every document is complete once written.
+func (e *ECSWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,64 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/provider"
+)
+
+func TestFormatECS(t *testing.T) {
+	ts := time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		result   *LookupResult
+		expected string
+	}{
+		{
+			&LookupResult{
+				IP:           "193.0.6.139",
+				CountryCode:  "NL",
+				CountryName:  "Netherlands",
+				Continent:    "EU",
+				Network:      "193.0.0.0/21",
+				Provider:     &provider.Result{ASNs: []int{3333}, Holders: []string{"RIPE-NCC-AS"}},
+				Geolocation:  &provider.Geolocation{City: "Amsterdam", Latitude: 52.37, Longitude: 4.89},
+				Tags:         []string{"corp-vpn"},
+				SnapshotTime: "2025-01-15",
+			},
+			`{"@timestamp":"2025-01-15T12:00:00Z","ecs":{"version":"8.11.0"},"event":{"kind":"enrichment","category":["network"],"type":["info"],"dataset":"ip2cc.lookup","outcome":"success"},"source":{"address":"193.0.6.139","ip":"193.0.6.139","geo":{"country_iso_code":"NL","country_name":"Netherlands","continent_code":"EU","continent_name":"Europe","city_name":"Amsterdam","location":{"lat":52.37,"lon":4.89}},"as":{"number":3333,"organization":{"name":"RIPE-NCC-AS"}}},"tags":["corp-vpn"],"ip2cc":{"network":"193.0.0.0/21","asns":[3333],"snapshot":"2025-01-15"}}`,
+		},
+		{
+			&LookupResult{IP: "10.0.0.0/8", CountryCode: "PRIVATE", Special: true},
+			`{"@timestamp":"2025-01-15T12:00:00Z","ecs":{"version":"8.11.0"},"event":{"kind":"enrichment","category":["network"],"type":["info"],"dataset":"ip2cc.lookup","outcome":"success"},"source":{"address":"10.0.0.0/8"},"ip2cc":{"special":true}}`,
+		},
+		{
+			&LookupResult{IP: "2001:db8::1", Error: "not found in index"},
+			`{"@timestamp":"2025-01-15T12:00:00Z","ecs":{"version":"8.11.0"},"event":{"kind":"enrichment","category":["network"],"type":["info"],"dataset":"ip2cc.lookup","outcome":"failure"},"source":{"address":"2001:db8::1","ip":"2001:db8::1"},"error":{"message":"not found in index"},"ip2cc":{}}`,
+		},
+	}
+	for _, tc := range tests {
+		data, err := FormatECS(tc.result, ts)
+		if err != nil {
+			t.Fatalf("FormatECS(%s) failed: %v", tc.result.IP, err)
+		}
+		if string(data) != tc.expected {
+			t.Errorf("FormatECS(%s) =\n%s\nexpected\n%s", tc.result.IP, data, tc.expected)
+		}
+	}
+
+	var buf bytes.Buffer
+	w := NewECSWriter(&buf)
+	w.now = func() time.Time { return ts }
+	for _, ip := range []string{"8.8.8.8", "1.1.1.1"} {
+		if err := w.Write(&LookupResult{IP: ip}); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if lines := bytes.Count(buf.Bytes(), []byte("\n")); lines != 2 {
+		t.Errorf("ECSWriter wrote %d lines, expected 2", lines)
+	}
+}
@@ -4,22 +4,80 @@ package output
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/hightemp/ip2cc/internal/countries"
 	"github.com/hightemp/ip2cc/internal/provider"
+	"github.com/hightemp/ip2cc/internal/special"
 )
 
 // LookupResult contains the result of an IP lookup.
 type LookupResult struct {
-	IP           string           `json:"ip"`
-	CountryCode  string           `json:"country_code"`
-	CountryName  string           `json:"country_name"`
-	Network      string           `json:"network"`
+	IP             string   `json:"ip"`
+	CountryCode    string   `json:"country_code"`
+	CountryName    string   `json:"country_name"`
+	CountryAlpha3  string   `json:"country_alpha3,omitempty"`
+	CountryNumeric string   `json:"country_numeric,omitempty"`
+	Continent      string   `json:"continent,omitempty"`
+	Network        string   `json:"network"`
+	Containment    string   `json:"containment,omitempty"`
+	Countries      []string `json:"countries,omitempty"`
+	// CountrySource is "rir", "geofeed" or "override", the origin of the
+	// country when a geofeed overlay or an overrides file is in use.
+	CountrySource string `json:"country_source,omitempty"`
+	// RIR is the registry that delegated the network, e.g. "ripencc",
+	// when the index records it.
+	RIR string `json:"rir,omitempty"`
+	// Allocated is the date the network was allocated or assigned by its
+	// registry (YYYY-MM-DD), when the index records it.
+	Allocated    string           `json:"allocated,omitempty"`
 	Provider     *provider.Result `json:"provider,omitempty"`
 	SnapshotTime string           `json:"snapshot_time"`
 	IndexBuiltAt time.Time        `json:"index_built_at"`
 	Error        string           `json:"error,omitempty"`
+
+	// Special is set for special-purpose addresses such as private or
+	// loopback ranges; CountryCode then holds a pseudo-code like "PRIVATE".
+	Special bool `json:"special,omitempty"`
+	// Anycast is set for addresses in well-known anycast prefixes, which
+	// are served from many locations whatever their registration country.
+	Anycast bool `json:"anycast,omitempty"`
+	// Groups are the country groups the country belongs to (--groups).
+	// It is non-nil when requested, and empty if there are none.
+	Groups []string `json:"groups,omitempty"`
+	// Tags are the names of the user's tag lists containing the address or
+	// block. It is non-nil when tag lists are configured, and empty if none
+	// contains it.
+	Tags []string `json:"tags,omitempty"`
+	// EmbeddedIPv4 is the IPv4 address an IPv4-mapped, 6to4, or Teredo
+	// input was looked up as, and Embedding names the kind of embedding.
+	EmbeddedIPv4 string `json:"embedded_ipv4,omitempty"`
+	Embedding    string `json:"embedding,omitempty"`
+	// Hostname is the input name the address was resolved from (--resolve).
+	Hostname string `json:"hostname,omitempty"`
+	// AbuseContacts is non-nil when abuse contacts were requested (--abuse),
+	// and empty if none are registered.
+	AbuseContacts []string `json:"abuse_contacts,omitempty"`
+	// Geolocation is the best-guess physical location of the network
+	// (--geo). It is not the registration country.
+	Geolocation *provider.Geolocation `json:"geolocation,omitempty"`
+	// Invalid marks a result for input that is not an address, CIDR or
+	// range, as opposed to one that was not found.
+	Invalid bool `json:"invalid,omitempty"`
+	// GeoRequested adds the geolocation column to text output, "-" when
+	// no location is known.
+	GeoRequested bool `json:"-"`
+	// Alpha3 shows ISO-3166 alpha-3 codes in the country column of text
+	// output.
+	Alpha3 bool `json:"-"`
+	// Timing breaks down the time the lookup took (--timing).
+	Timing *Timing `json:"timing,omitempty"`
+	// Extra holds the fields added by enrichers. It is non-nil when
+	// enrichers ran, and empty if they added nothing.
+	Extra map[string]interface{} `json:"extra,omitempty"`
 }
 
 // FormatText formats result as tab-separated text.
@@ -33,13 +91,175 @@ func (r *LookupResult) FormatText() string {
 		providerStr = r.Provider.GetHolderString()
 	}
 
-	return fmt.Sprintf("%s\t%s\t%s\t%s\t%s",
-		r.IP,
-		r.CountryCode,
-		r.CountryName,
+	countryCode, countryName := r.CountryCode, r.CountryName
+	if r.Alpha3 && r.CountryAlpha3 != "" {
+		countryCode = r.CountryAlpha3
+	}
+	if countryCode == "" && len(r.Countries) > 1 {
+		// CIDR spanning several countries
+		codes := r.Countries
+		if r.Alpha3 {
+			codes = make([]string, len(r.Countries))
+			for i, cc := range r.Countries {
+				if codes[i] = countries.GetAlpha3(cc); codes[i] == "" {
+					codes[i] = cc
+				}
+			}
+		}
+		countryCode = strings.Join(codes, ",")
+		countryName = "multiple countries"
+	}
+
+	if r.CountrySource == "override" {
+		countryName += " (override)"
+	}
+	if r.Anycast {
+		countryName += " (anycast)"
+	}
+
+	ip := r.IP
+	if r.Hostname != "" {
+		ip = fmt.Sprintf("%s (%s)", r.Hostname, r.IP)
+	}
+
+	line := fmt.Sprintf("%s\t%s\t%s\t%s\t%s",
+		ip,
+		countryCode,
+		countryName,
 		r.Network,
 		providerStr,
 	)
+	if r.AbuseContacts != nil {
+		abuse := "-"
+		if len(r.AbuseContacts) > 0 {
+			abuse = strings.Join(r.AbuseContacts, ",")
+		}
+		line += "\t" + abuse
+	}
+	if r.GeoRequested {
+		line += "\t" + geoLabel(r.Geolocation)
+	}
+	if r.Groups != nil {
+		groups := "-"
+		if len(r.Groups) > 0 {
+			groups = strings.Join(r.Groups, ",")
+		}
+		line += "\t" + groups
+	}
+	if r.Tags != nil {
+		tags := "-"
+		if len(r.Tags) > 0 {
+			tags = strings.Join(r.Tags, ",")
+		}
+		line += "\t" + tags
+	}
+	if r.Extra != nil {
+		line += "\t" + extraLabel(r.Extra)
+	}
+	return line
+}
+
+// Timing breaks down where the time of a lookup went, in milliseconds:
+// loading the index, looking up the trie, and resolving the provider
+// (including abuse contacts and geolocation).
+type Timing struct {
+	IndexLoadMS float64 `json:"index_load_ms"`
+	LookupMS    float64 `json:"lookup_ms"`
+	ProviderMS  float64 `json:"provider_ms"`
+}
+
+// NewTiming creates a Timing from durations.
+func NewTiming(indexLoad, lookup, provider time.Duration) *Timing {
+	return &Timing{
+		IndexLoadMS: milliseconds(indexLoad),
+		LookupMS:    milliseconds(lookup),
+		ProviderMS:  milliseconds(provider),
+	}
+}
+
+// String formats the timing for the stderr summary of text output.
+func (t *Timing) String() string {
+	return fmt.Sprintf("Timing: index load %.3fms, lookup %.3fms, provider %.3fms", t.IndexLoadMS, t.LookupMS, t.ProviderMS)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// SetExtra adds an enrichment field.
+func (r *LookupResult) SetExtra(key string, value interface{}) {
+	if r.Extra == nil {
+		r.Extra = make(map[string]interface{})
+	}
+	r.Extra[key] = value
+}
+
+// extraLabel formats enrichment fields for text output as key=value pairs
+// sorted by key, "-" when there are none.
+func extraLabel(extra map[string]interface{}) string {
+	if len(extra) == 0 {
+		return "-"
+	}
+	keys := make([]string, 0, len(extra))
+	for k := range extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		v := extra[k]
+		if _, ok := v.(string); !ok {
+			if data, err := json.Marshal(v); err == nil {
+				v = string(data)
+			}
+		}
+		pairs[i] = fmt.Sprintf("%s=%v", k, v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+// SetCountry sets the registration country from an alpha-2 code.
+func (r *LookupResult) SetCountry(code string) {
+	code = countries.Normalize(code)
+	r.CountryCode = code
+	r.CountryName = countries.DisplayName(code)
+	r.CountryAlpha3 = countries.GetAlpha3(code)
+	r.CountryNumeric = countries.GetNumeric(code)
+	r.Continent = countries.GetContinent(code)
+}
+
+// SetGroups sets the groups in g containing the country. A CIDR spanning
+// several countries is in the groups common to all of them.
+func (r *LookupResult) SetGroups(g *countries.Groups) {
+	codes := r.Countries
+	if r.CountryCode != "" {
+		codes = []string{r.CountryCode}
+	}
+	r.Groups = g.Common(codes)
+}
+
+// SetSpecial fills in the special-purpose block r in place of a
+// registration country.
+func (r *LookupResult) SetSpecial(sr special.Range) {
+	r.CountryCode = sr.Code
+	r.CountryName = sr.Name
+	r.Network = sr.Prefix.String()
+	r.Special = true
+}
+
+// geoLabel formats a geolocation for text output, prefixed with "geo:" to
+// set it apart from the registration country.
+func geoLabel(g *provider.Geolocation) string {
+	if g == nil {
+		return "-"
+	}
+	var place []string
+	for _, s := range []string{g.City, g.Country} {
+		if s != "" {
+			place = append(place, s)
+		}
+	}
+	return fmt.Sprintf("geo:%s (%.4f,%.4f)", strings.Join(place, ", "), g.Latitude, g.Longitude)
 }
 
 // FormatJSON formats result as JSON.
@@ -78,3 +298,73 @@ func (b *BatchResult) FormatJSON() (string, error) {
 func FormatError(ip string, err error) string {
 	return fmt.Sprintf("%s\t-\t-\t-\tERROR: %s", ip, err.Error())
 }
+
+// ResultWriter writes results one by one in a streaming output format.
+type ResultWriter interface {
+	Write(r *LookupResult) error
+	// Close finishes the output; it does not close the underlying writer.
+	Close() error
+}
+
+// JSONArrayWriter streams results as a JSON array laid out like
+// BatchResult.FormatJSON, without holding them in memory.
+type JSONArrayWriter struct {
+	w io.Writer
+	n int
+}
+
+// NewJSONArrayWriter creates a writer for a JSON array of results.
+func NewJSONArrayWriter(w io.Writer) *JSONArrayWriter {
+	return &JSONArrayWriter{w: w}
+}
+
+// Write appends a result to the array.
+func (a *JSONArrayWriter) Write(r *LookupResult) error {
+	data, err := json.MarshalIndent(r, "  ", "  ")
+	if err != nil {
+		return err
+	}
+	sep := ",\n  "
+	if a.n == 0 {
+		sep = "[\n  "
+	}
+	a.n++
+	_, err = fmt.Fprintf(a.w, "%s%s", sep, data)
+	return err
+}
+
+// Close terminates the array.
+func (a *JSONArrayWriter) Close() error {
+	if a.n == 0 {
+		_, err := io.WriteString(a.w, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(a.w, "\n]\n")
+	return err
+}
+
+// NDJSONWriter streams results as newline-delimited JSON, one compact
+// object per line.
+type NDJSONWriter struct {
+	w io.Writer
+}
+
+// NewNDJSONWriter creates a writer for newline-delimited JSON results.
+func NewNDJSONWriter(w io.Writer) *NDJSONWriter {
+	return &NDJSONWriter{w: w}
+}
+
+// Write writes a result as one line.
+func (n *NDJSONWriter) Write(r *LookupResult) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(n.w, "%s\n", data)
+	return err
+}
+
+// Close does nothing; every result is complete once written.
+func (n *NDJSONWriter) Close() error {
+	return nil
+}
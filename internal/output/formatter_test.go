@@ -77,6 +77,152 @@ func TestLookupResultFormatTextNoProvider(t *testing.T) {
 	}
 }
 
+func TestLookupResultFormatTextMultipleCountries(t *testing.T) {
+	result := &LookupResult{
+		IP:          "10.0.0.0/23",
+		Network:     "10.0.0.0/23",
+		Containment: "multiple",
+		Countries:   []string{"DE", "FR"},
+	}
+
+	parts := strings.Split(result.FormatText(), "\t")
+	if len(parts) != 5 {
+		t.Fatalf("Expected 5 tab-separated parts, got %d", len(parts))
+	}
+	if parts[1] != "DE,FR" {
+		t.Errorf("CountryCode = %s, expected DE,FR", parts[1])
+	}
+	if parts[2] != "multiple countries" {
+		t.Errorf("CountryName = %s, expected multiple countries", parts[2])
+	}
+}
+
+func TestLookupResultFormatTextMarks(t *testing.T) {
+	result := &LookupResult{
+		IP:          "1.1.1.1",
+		CountryCode: "AU",
+		CountryName: "Australia",
+		Network:     "1.1.1.0/24",
+		Anycast:     true,
+	}
+
+	parts := strings.Split(result.FormatText(), "\t")
+	if len(parts) != 5 {
+		t.Fatalf("Expected 5 tab-separated parts, got %d", len(parts))
+	}
+	if parts[2] != "Australia (anycast)" {
+		t.Errorf("CountryName = %s, expected Australia (anycast)", parts[2])
+	}
+
+	result.CountrySource = "override"
+	parts = strings.Split(result.FormatText(), "\t")
+	if parts[2] != "Australia (override) (anycast)" {
+		t.Errorf("CountryName = %s, expected Australia (override) (anycast)", parts[2])
+	}
+}
+
+func TestLookupResultFormatTextAbuse(t *testing.T) {
+	result := &LookupResult{
+		IP:            "193.0.6.139",
+		CountryCode:   "NL",
+		CountryName:   "Netherlands",
+		Network:       "193.0.0.0/21",
+		AbuseContacts: []string{"abuse@ripe.net"},
+	}
+
+	parts := strings.Split(result.FormatText(), "\t")
+	if len(parts) != 6 {
+		t.Fatalf("Expected 6 tab-separated parts, got %d", len(parts))
+	}
+	if parts[5] != "abuse@ripe.net" {
+		t.Errorf("Abuse = %s, expected abuse@ripe.net", parts[5])
+	}
+
+	result.AbuseContacts = []string{}
+	parts = strings.Split(result.FormatText(), "\t")
+	if len(parts) != 6 || parts[5] != "-" {
+		t.Errorf("Expected - for no abuse contacts, got %v", parts)
+	}
+}
+
+func TestLookupResultFormatTextGeo(t *testing.T) {
+	result := &LookupResult{
+		IP:           "8.8.8.8",
+		CountryCode:  "US",
+		CountryName:  "United States",
+		Network:      "8.8.8.0/24",
+		GeoRequested: true,
+		Geolocation:  &provider.Geolocation{City: "Mountain View", Country: "US", Latitude: 37.4056, Longitude: -122.0775},
+	}
+
+	parts := strings.Split(result.FormatText(), "\t")
+	if len(parts) != 6 {
+		t.Fatalf("Expected 6 tab-separated parts, got %d", len(parts))
+	}
+	if expected := "geo:Mountain View, US (37.4056,-122.0775)"; parts[5] != expected {
+		t.Errorf("Geo = %s, expected %s", parts[5], expected)
+	}
+
+	result.Geolocation = nil
+	parts = strings.Split(result.FormatText(), "\t")
+	if len(parts) != 6 || parts[5] != "-" {
+		t.Errorf("Expected - for unknown location, got %v", parts)
+	}
+}
+
+func TestLookupResultFormatTextTags(t *testing.T) {
+	result := &LookupResult{
+		IP:          "10.8.0.5",
+		CountryCode: "PRIVATE",
+		CountryName: "Private network (RFC 1918)",
+		Network:     "10.0.0.0/8",
+		Groups:      []string{},
+		Tags:        []string{"corp-vpn", "office"},
+	}
+
+	parts := strings.Split(result.FormatText(), "\t")
+	if len(parts) != 7 {
+		t.Fatalf("Expected 7 tab-separated parts, got %d", len(parts))
+	}
+	if parts[5] != "-" || parts[6] != "corp-vpn,office" {
+		t.Errorf("Groups, Tags = %s, %s, expected -, corp-vpn,office", parts[5], parts[6])
+	}
+
+	result.Tags = []string{}
+	parts = strings.Split(result.FormatText(), "\t")
+	if len(parts) != 7 || parts[6] != "-" {
+		t.Errorf("Expected - for no tags, got %v", parts)
+	}
+}
+
+func TestLookupResultAlpha3(t *testing.T) {
+	result := &LookupResult{IP: "8.8.8.8", Network: "8.8.8.0/24"}
+	result.SetCountry("US")
+	if result.CountryAlpha3 != "USA" || result.CountryNumeric != "840" {
+		t.Errorf("Alpha3, Numeric = %s, %s, expected USA, 840", result.CountryAlpha3, result.CountryNumeric)
+	}
+
+	result.Alpha3 = true
+	parts := strings.Split(result.FormatText(), "\t")
+	if parts[1] != "USA" {
+		t.Errorf("CountryCode = %s, expected USA", parts[1])
+	}
+
+	multi := &LookupResult{IP: "10.0.0.0/23", Countries: []string{"DE", "FR"}, Alpha3: true}
+	parts = strings.Split(multi.FormatText(), "\t")
+	if parts[1] != "DEU,FRA" {
+		t.Errorf("CountryCode = %s, expected DEU,FRA", parts[1])
+	}
+
+	data, err := result.FormatJSON()
+	if err != nil {
+		t.Fatalf("FormatJSON failed: %v", err)
+	}
+	if !strings.Contains(data, `"country_alpha3": "USA"`) || !strings.Contains(data, `"country_numeric": "840"`) {
+		t.Errorf("JSON lacks alpha-3 or numeric code: %s", data)
+	}
+}
+
 func TestLookupResultFormatJSON(t *testing.T) {
 	now := time.Now()
 	result := &LookupResult{
@@ -0,0 +1,125 @@
+package output
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/hightemp/ip2cc/internal/parquet"
+)
+
+// parquetColumns are the columns of Parquet output, flattened from the
+// JSON fields. Lists are joined with commas, and empty fields are null.
+var parquetColumns = []parquet.Column{
+	{Name: "ip", Type: parquet.String},
+	{Name: "country_code", Type: parquet.String, Optional: true},
+	{Name: "country_name", Type: parquet.String, Optional: true},
+	{Name: "country_alpha3", Type: parquet.String, Optional: true},
+	{Name: "country_numeric", Type: parquet.String, Optional: true},
+	{Name: "continent", Type: parquet.String, Optional: true},
+	{Name: "network", Type: parquet.String, Optional: true},
+	{Name: "containment", Type: parquet.String, Optional: true},
+	{Name: "countries", Type: parquet.String, Optional: true},
+	{Name: "country_source", Type: parquet.String, Optional: true},
+	{Name: "rir", Type: parquet.String, Optional: true},
+	{Name: "allocated", Type: parquet.String, Optional: true},
+	{Name: "asn", Type: parquet.Int64, Optional: true},
+	{Name: "provider", Type: parquet.String, Optional: true},
+	{Name: "special", Type: parquet.Bool},
+	{Name: "anycast", Type: parquet.Bool},
+	{Name: "hostname", Type: parquet.String, Optional: true},
+	{Name: "embedded_ipv4", Type: parquet.String, Optional: true},
+	{Name: "groups", Type: parquet.String, Optional: true},
+	{Name: "tags", Type: parquet.String, Optional: true},
+	{Name: "abuse_contacts", Type: parquet.String, Optional: true},
+	{Name: "geo_city", Type: parquet.String, Optional: true},
+	{Name: "geo_country", Type: parquet.String, Optional: true},
+	{Name: "latitude", Type: parquet.Double, Optional: true},
+	{Name: "longitude", Type: parquet.Double, Optional: true},
+	{Name: "extra", Type: parquet.String, Optional: true},
+	{Name: "snapshot_time", Type: parquet.String},
+	{Name: "index_built_at", Type: parquet.TimestampMillis},
+	{Name: "error", Type: parquet.String, Optional: true},
+}
+
+// ParquetWriter writes results as the rows of a Parquet file.
+type ParquetWriter struct {
+	w *parquet.Writer
+}
+
+// NewParquetWriter creates a writer of a Parquet file of results to w.
+func NewParquetWriter(w io.Writer) (*ParquetWriter, error) {
+	pw, err := parquet.NewWriter(w, parquetColumns)
+	if err != nil {
+		return nil, err
+	}
+	return &ParquetWriter{w: pw}, nil
+}
+
+// Write adds a result as a row.
+func (p *ParquetWriter) Write(r *LookupResult) error {
+	row := []interface{}{
+		r.IP,
+		nullable(r.CountryCode),
+		nullable(r.CountryName),
+		nullable(r.CountryAlpha3),
+		nullable(r.CountryNumeric),
+		nullable(r.Continent),
+		nullable(r.Network),
+		nullable(r.Containment),
+		nullable(strings.Join(r.Countries, ",")),
+		nullable(r.CountrySource),
+		nullable(r.RIR),
+		nullable(r.Allocated),
+		nil,
+		nil,
+		r.Special,
+		r.Anycast,
+		nullable(r.Hostname),
+		nullable(r.EmbeddedIPv4),
+		nullable(strings.Join(r.Groups, ",")),
+		nullable(strings.Join(r.Tags, ",")),
+		nullable(strings.Join(r.AbuseContacts, ",")),
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		r.SnapshotTime,
+		r.IndexBuiltAt.UnixMilli(),
+		nullable(r.Error),
+	}
+	if r.Provider != nil {
+		if len(r.Provider.ASNs) > 0 {
+			row[12] = int64(r.Provider.ASNs[0])
+		}
+		if len(r.Provider.Holders) > 0 {
+			row[13] = r.Provider.Holders[0]
+		}
+	}
+	if g := r.Geolocation; g != nil {
+		row[21], row[22] = nullable(g.City), nullable(g.Country)
+		row[23], row[24] = g.Latitude, g.Longitude
+	}
+	if len(r.Extra) > 0 {
+		extra, err := json.Marshal(r.Extra)
+		if err != nil {
+			return err
+		}
+		row[25] = string(extra)
+	}
+	return p.w.Write(row)
+}
+
+// Close writes the footer of the file.
+func (p *ParquetWriter) Close() error {
+	return p.w.Close()
+}
+
+// nullable returns s, or nil for an empty string.
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,419 @@
+package output
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/provider"
+)
+
+// Protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// maxProtoMessage bounds the size of a message read by ReadProto.
+const maxProtoMessage = 16 << 20
+
+// MarshalProto encodes the result as an ip2cc.v1.LookupResult message
+// (lookup_result.proto). Extra values are JSON-encoded.
+func (r *LookupResult) MarshalProto() ([]byte, error) {
+	var b []byte
+	b = appendString(b, 1, r.IP)
+	b = appendString(b, 2, r.CountryCode)
+	b = appendString(b, 3, r.CountryName)
+	b = appendString(b, 4, r.CountryAlpha3)
+	b = appendString(b, 5, r.CountryNumeric)
+	b = appendString(b, 6, r.Continent)
+	b = appendString(b, 7, r.Network)
+	b = appendString(b, 8, r.Containment)
+	b = appendStrings(b, 9, r.Countries)
+	b = appendString(b, 10, r.CountrySource)
+	b = appendString(b, 24, r.RIR)
+	b = appendString(b, 25, r.Allocated)
+	if r.Provider != nil {
+		b = appendBytes(b, 11, marshalProvider(r.Provider))
+	}
+	b = appendString(b, 12, r.SnapshotTime)
+	if !r.IndexBuiltAt.IsZero() {
+		var ts []byte
+		ts = appendVarintField(ts, 1, uint64(r.IndexBuiltAt.Unix()))
+		ts = appendVarintField(ts, 2, uint64(r.IndexBuiltAt.Nanosecond()))
+		b = appendBytes(b, 13, ts)
+	}
+	b = appendString(b, 14, r.Error)
+	b = appendBool(b, 15, r.Special)
+	b = appendBool(b, 26, r.Anycast)
+	b = appendStrings(b, 16, r.Groups)
+	b = appendStrings(b, 27, r.Tags)
+	b = appendString(b, 17, r.EmbeddedIPv4)
+	b = appendString(b, 18, r.Embedding)
+	b = appendString(b, 19, r.Hostname)
+	b = appendStrings(b, 20, r.AbuseContacts)
+	if g := r.Geolocation; g != nil {
+		var gb []byte
+		gb = appendString(gb, 1, g.City)
+		gb = appendString(gb, 2, g.Country)
+		gb = appendDouble(gb, 3, g.Latitude)
+		gb = appendDouble(gb, 4, g.Longitude)
+		gb = appendDouble(gb, 5, g.Coverage)
+		gb = appendString(gb, 6, g.Source)
+		b = appendBytes(b, 21, gb)
+	}
+	if t := r.Timing; t != nil {
+		var tb []byte
+		tb = appendDouble(tb, 1, t.IndexLoadMS)
+		tb = appendDouble(tb, 2, t.LookupMS)
+		tb = appendDouble(tb, 3, t.ProviderMS)
+		b = appendBytes(b, 22, tb)
+	}
+	keys := make([]string, 0, len(r.Extra))
+	for k := range r.Extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		value, err := json.Marshal(r.Extra[k])
+		if err != nil {
+			return nil, fmt.Errorf("extra field %s: %w", k, err)
+		}
+		var entry []byte
+		entry = appendString(entry, 1, k)
+		entry = appendString(entry, 2, string(value))
+		b = appendBytes(b, 23, entry)
+	}
+	return b, nil
+}
+
+func marshalProvider(p *provider.Result) []byte {
+	var b []byte
+	b = appendString(b, 1, string(p.Mode))
+	if len(p.ASNs) > 0 {
+		var packed []byte
+		for _, asn := range p.ASNs {
+			packed = binary.AppendUvarint(packed, uint64(asn))
+		}
+		b = appendBytes(b, 2, packed)
+	}
+	b = appendStrings(b, 3, p.Holders)
+	b = appendString(b, 4, p.Source)
+	b = appendBool(b, 5, p.Cached)
+	b = appendString(b, 6, p.Error)
+	return b
+}
+
+// UnmarshalProto decodes an ip2cc.v1.LookupResult message into r.
+func (r *LookupResult) UnmarshalProto(data []byte) error {
+	*r = LookupResult{}
+	return walkProto(data, func(field int, wire int, v uint64, b []byte) error {
+		switch field {
+		case 1:
+			r.IP = string(b)
+		case 2:
+			r.CountryCode = string(b)
+		case 3:
+			r.CountryName = string(b)
+		case 4:
+			r.CountryAlpha3 = string(b)
+		case 5:
+			r.CountryNumeric = string(b)
+		case 6:
+			r.Continent = string(b)
+		case 7:
+			r.Network = string(b)
+		case 8:
+			r.Containment = string(b)
+		case 9:
+			r.Countries = append(r.Countries, string(b))
+		case 10:
+			r.CountrySource = string(b)
+		case 11:
+			r.Provider = &provider.Result{}
+			return unmarshalProvider(b, r.Provider)
+		case 12:
+			r.SnapshotTime = string(b)
+		case 13:
+			var sec, nsec int64
+			err := walkProto(b, func(field int, wire int, v uint64, _ []byte) error {
+				switch field {
+				case 1:
+					sec = int64(v)
+				case 2:
+					nsec = int64(v)
+				}
+				return nil
+			})
+			r.IndexBuiltAt = time.Unix(sec, nsec).UTC()
+			return err
+		case 14:
+			r.Error = string(b)
+		case 15:
+			r.Special = v != 0
+		case 16:
+			r.Groups = append(r.Groups, string(b))
+		case 17:
+			r.EmbeddedIPv4 = string(b)
+		case 18:
+			r.Embedding = string(b)
+		case 19:
+			r.Hostname = string(b)
+		case 20:
+			r.AbuseContacts = append(r.AbuseContacts, string(b))
+		case 21:
+			g := &provider.Geolocation{}
+			r.Geolocation = g
+			return walkProto(b, func(field int, wire int, v uint64, b []byte) error {
+				switch field {
+				case 1:
+					g.City = string(b)
+				case 2:
+					g.Country = string(b)
+				case 3:
+					g.Latitude = math.Float64frombits(v)
+				case 4:
+					g.Longitude = math.Float64frombits(v)
+				case 5:
+					g.Coverage = math.Float64frombits(v)
+				case 6:
+					g.Source = string(b)
+				}
+				return nil
+			})
+		case 22:
+			t := &Timing{}
+			r.Timing = t
+			return walkProto(b, func(field int, wire int, v uint64, _ []byte) error {
+				switch field {
+				case 1:
+					t.IndexLoadMS = math.Float64frombits(v)
+				case 2:
+					t.LookupMS = math.Float64frombits(v)
+				case 3:
+					t.ProviderMS = math.Float64frombits(v)
+				}
+				return nil
+			})
+		case 23:
+			var key, value string
+			err := walkProto(b, func(field int, wire int, v uint64, b []byte) error {
+				switch field {
+				case 1:
+					key = string(b)
+				case 2:
+					value = string(b)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			var decoded interface{}
+			if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+				return fmt.Errorf("extra field %s: %w", key, err)
+			}
+			if r.Extra == nil {
+				r.Extra = make(map[string]interface{})
+			}
+			r.Extra[key] = decoded
+		case 24:
+			r.RIR = string(b)
+		case 25:
+			r.Allocated = string(b)
+		case 26:
+			r.Anycast = v != 0
+		case 27:
+			r.Tags = append(r.Tags, string(b))
+		}
+		return nil
+	})
+}
+
+func unmarshalProvider(data []byte, p *provider.Result) error {
+	return walkProto(data, func(field int, wire int, v uint64, b []byte) error {
+		switch field {
+		case 1:
+			p.Mode = provider.Mode(b)
+		case 2:
+			if wire == wireVarint {
+				p.ASNs = append(p.ASNs, int(v))
+				return nil
+			}
+			for len(b) > 0 {
+				asn, n := binary.Uvarint(b)
+				if n <= 0 {
+					return errors.New("invalid packed varint")
+				}
+				p.ASNs = append(p.ASNs, int(asn))
+				b = b[n:]
+			}
+		case 3:
+			p.Holders = append(p.Holders, string(b))
+		case 4:
+			p.Source = string(b)
+		case 5:
+			p.Cached = v != 0
+		case 6:
+			p.Error = string(b)
+		}
+		return nil
+	})
+}
+
+// ProtoWriter writes results as length-delimited messages.
+type ProtoWriter struct {
+	w io.Writer
+}
+
+// NewProtoWriter creates a writer of length-delimited messages to w.
+func NewProtoWriter(w io.Writer) *ProtoWriter {
+	return &ProtoWriter{w: w}
+}
+
+// Write writes a result.
+func (p *ProtoWriter) Write(r *LookupResult) error {
+	return WriteProto(p.w, r)
+}
+
+// Close does nothing; messages are not framed beyond their sizes.
+func (p *ProtoWriter) Close() error {
+	return nil
+}
+
+// WriteProto writes r to w as a length-delimited message.
+func WriteProto(w io.Writer, r *LookupResult) error {
+	msg, err := r.MarshalProto()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(binary.AppendUvarint(nil, uint64(len(msg))), msg...))
+	return err
+}
+
+// ReadProto reads a length-delimited message written by WriteProto. It
+// returns io.EOF when r ends before the next message.
+func ReadProto(r *bufio.Reader) (*LookupResult, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("read message size: %w", err)
+	}
+	if size > maxProtoMessage {
+		return nil, fmt.Errorf("message of %d bytes exceeds the limit of %d", size, maxProtoMessage)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, fmt.Errorf("read message: %w", err)
+	}
+	result := &LookupResult{}
+	if err := result.UnmarshalProto(msg); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// walkProto calls fn for each field of the message in data, with the
+// value of varint and fixed fields in v and the contents of
+// length-delimited fields in b. Unknown fields are left to fn to skip.
+func walkProto(data []byte, fn func(field int, wire int, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.New("invalid field key")
+		}
+		data = data[n:]
+		field, wire := int(key>>3), int(key&7)
+		var v uint64
+		var b []byte
+		switch wire {
+		case wireVarint:
+			if v, n = binary.Uvarint(data); n <= 0 {
+				return fmt.Errorf("field %d: invalid varint", field)
+			}
+			data = data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return fmt.Errorf("field %d: truncated", field)
+			}
+			v = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return fmt.Errorf("field %d: truncated", field)
+			}
+			v = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		case wireBytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || size > uint64(len(data)-n) {
+				return fmt.Errorf("field %d: truncated", field)
+			}
+			b = data[n : n+int(size)]
+			data = data[n+int(size):]
+		default:
+			return fmt.Errorf("field %d: unsupported wire type %d", field, wire)
+		}
+		if err := fn(field, wire, v, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appendTag(b []byte, field, wire int) []byte {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wire))
+}
+
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	return binary.AppendUvarint(appendTag(b, field, wireVarint), v)
+}
+
+func appendBool(b []byte, field int, v bool) []byte {
+	if !v {
+		return b
+	}
+	return appendVarintField(b, field, 1)
+}
+
+func appendDouble(b []byte, field int, v float64) []byte {
+	if v == 0 {
+		return b
+	}
+	return binary.LittleEndian.AppendUint64(appendTag(b, field, wireFixed64), math.Float64bits(v))
+}
+
+func appendBytes(b []byte, field int, v []byte) []byte {
+	b = binary.AppendUvarint(appendTag(b, field, wireBytes), uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendString(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = binary.AppendUvarint(appendTag(b, field, wireBytes), uint64(len(s)))
+	return append(b, s...)
+}
+
+// appendStrings appends a repeated string field; empty elements are kept.
+func appendStrings(b []byte, field int, values []string) []byte {
+	for _, s := range values {
+		b = binary.AppendUvarint(appendTag(b, field, wireBytes), uint64(len(s)))
+		b = append(b, s...)
+	}
+	return b
+}
@@ -0,0 +1,105 @@
+package output
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/provider"
+)
+
+func TestMarshalProtoWireFormat(t *testing.T) {
+	r := &LookupResult{
+		IP:          "1.2.3.4",
+		CountryCode: "AU",
+		Special:     true,
+		Provider:    &provider.Result{ASNs: []int{150, 13335}},
+	}
+	got, err := r.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{
+		0x0a, 7, '1', '.', '2', '.', '3', '.', '4', // ip = 1
+		0x12, 2, 'A', 'U', // country_code = 2
+		0x5a, 6, 0x12, 4, 0x96, 0x01, 0x97, 0x68, // provider = 11 {asns = 2, packed}
+		0x78, 1, // special = 15
+	}
+	if !bytes.Equal(got, expected) {
+		t.Errorf("MarshalProto() = % x, expected % x", got, expected)
+	}
+}
+
+func TestProtoRoundTrip(t *testing.T) {
+	results := []*LookupResult{
+		{
+			IP:             "8.8.8.8",
+			CountryCode:    "US",
+			CountryName:    "United States",
+			CountryAlpha3:  "USA",
+			CountryNumeric: "840",
+			Continent:      "NA",
+			Network:        "8.8.8.0/24",
+			Countries:      []string{"US", "CA"},
+			CountrySource:  "geofeed",
+			RIR:            "arin",
+			Allocated:      "1992-12-01",
+			Anycast:        true,
+			Provider: &provider.Result{
+				Mode:    provider.ModeBGP,
+				ASNs:    []int{15169},
+				Holders: []string{"GOOGLE LLC"},
+				Source:  "RIPEstat",
+				Cached:  true,
+			},
+			SnapshotTime:  "2025-02-02",
+			IndexBuiltAt:  time.Date(2025, 2, 2, 10, 0, 0, 5, time.UTC),
+			Groups:        []string{},
+			Tags:          []string{"corp-vpn", "partners"},
+			AbuseContacts: []string{"abuse@example.com"},
+			Geolocation:   &provider.Geolocation{City: "Mountain View", Country: "US", Latitude: 37.4, Longitude: -122.1, Coverage: 100, Source: "ipmap"},
+			Timing:        &Timing{IndexLoadMS: 1.5, LookupMS: 0.001},
+			Extra:         map[string]interface{}{"tag": "x", "score": float64(3)},
+		},
+		{IP: "bogus", Error: "invalid IP address"},
+	}
+
+	var buf bytes.Buffer
+	for _, r := range results {
+		if err := WriteProto(&buf, r); err != nil {
+			t.Fatalf("WriteProto() error = %v", err)
+		}
+	}
+
+	br := bufio.NewReader(&buf)
+	for i, expected := range results {
+		got, err := ReadProto(br)
+		if err != nil {
+			t.Fatalf("ReadProto() #%d error = %v", i, err)
+		}
+		if len(expected.Groups) == 0 {
+			// An empty repeated field reads back as nil
+			expected.Groups = nil
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("ReadProto() #%d = %+v, expected %+v", i, got, expected)
+		}
+	}
+	if _, err := ReadProto(br); err != io.EOF {
+		t.Errorf("ReadProto() at end error = %v, expected io.EOF", err)
+	}
+}
+
+func TestUnmarshalProtoRejectsTruncated(t *testing.T) {
+	data, err := (&LookupResult{IP: "8.8.8.8", Network: "8.8.8.0/24"}).MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r LookupResult
+	if err := r.UnmarshalProto(data[:len(data)-1]); err == nil {
+		t.Error("UnmarshalProto() of a truncated message succeeded")
+	}
+}
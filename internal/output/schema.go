@@ -0,0 +1,148 @@
+package output
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/provider"
+)
+
+// SchemaVersion is the version of the JSON output contract described by
+// the schema. Within a version fields are only ever added; removing,
+// renaming or retyping one bumps it.
+const SchemaVersion = 1
+
+// SchemaID identifies the schema of the current version.
+var SchemaID = fmt.Sprintf("urn:ip2cc:lookup-result:v%d", SchemaVersion)
+
+//go:embed schema.json
+var schemaJSON []byte
+
+// JSONSchema returns the JSON Schema (draft 2020-12) of JSON lookup output:
+// a LookupResult object, or an array of them for batch output.
+func JSONSchema() []byte {
+	return schemaJSON
+}
+
+// schemaTypes names the struct types of the output, in the schema's $defs.
+var schemaTypes = map[reflect.Type]string{
+	reflect.TypeOf(LookupResult{}):         "LookupResult",
+	reflect.TypeOf(Timing{}):               "Timing",
+	reflect.TypeOf(provider.Result{}):      "Provider",
+	reflect.TypeOf(provider.Geolocation{}): "Geolocation",
+}
+
+// generateSchema builds the schema embedded as schema.json from the json
+// tags of the output types: fields without omitempty are required.
+func generateSchema() ([]byte, error) {
+	defs := make(map[string]interface{})
+	for t, name := range schemaTypes {
+		def, err := structSchema(t)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		defs[name] = def
+	}
+	ref := map[string]interface{}{"$ref": "#/$defs/LookupResult"}
+	schema := map[string]interface{}{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"$id":         SchemaID,
+		"title":       "ip2cc lookup result",
+		"description": "Output of ip2cc --json: one result for a single lookup, an array of results in batch mode.",
+		"oneOf": []interface{}{
+			ref,
+			map[string]interface{}{"type": "array", "items": ref},
+		},
+		"$defs": defs,
+	}
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// ObjectSchema returns the JSON Schema of the struct v, such as a response
+// of the HTTP server, derived from its json tags like the output types.
+// References to output types point into the $defs of JSONSchema.
+func ObjectSchema(v interface{}) (map[string]interface{}, error) {
+	return structSchema(reflect.TypeOf(v))
+}
+
+func structSchema(t reflect.Type) (map[string]interface{}, error) {
+	properties := make(map[string]interface{})
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		s, err := typeSchema(f.Type)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		properties[name] = s
+		if !strings.Contains(","+opts+",", ",omitempty,") {
+			required = append(required, name)
+		}
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}, nil
+}
+
+func typeSchema(t reflect.Type) (map[string]interface{}, error) {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}, nil
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return typeSchema(t.Elem())
+	case reflect.Struct:
+		name, ok := schemaTypes[t]
+		if !ok {
+			return nil, fmt.Errorf("type %s is not in the schema", t)
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + name}, nil
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}, nil
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}, nil
+	case reflect.Slice:
+		items, err := typeSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "array", "items": items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("map key type %s", t.Key())
+		}
+		// Values of enrichment fields can be anything
+		if t.Elem().Kind() == reflect.Interface {
+			return map[string]interface{}{"type": "object"}, nil
+		}
+		values, err := typeSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "object", "additionalProperties": values}, nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
@@ -0,0 +1,94 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/provider"
+)
+
+var updateSchema = flag.Bool("update", false, "rewrite schema.json from the output types")
+
+func TestJSONSchemaUpToDate(t *testing.T) {
+	generated, err := generateSchema()
+	if err != nil {
+		t.Fatalf("generateSchema() error = %v", err)
+	}
+	if *updateSchema {
+		if err := os.WriteFile("schema.json", generated, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	if !bytes.Equal(generated, JSONSchema()) {
+		t.Errorf("schema.json is out of date with the output types; run 'go test ./internal/output -run TestJSONSchemaUpToDate -update', and bump SchemaVersion if a field was removed, renamed or retyped")
+	}
+}
+
+func TestJSONSchemaCoversOutput(t *testing.T) {
+	var schema struct {
+		ID   string `json:"$id"`
+		Defs map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+			Required   []string                   `json:"required"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(JSONSchema(), &schema); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+	if schema.ID != SchemaID {
+		t.Errorf("$id = %q, expected %q", schema.ID, SchemaID)
+	}
+
+	result := &LookupResult{
+		IP:             "8.8.8.8",
+		CountryCode:    "US",
+		CountryName:    "United States",
+		CountryAlpha3:  "USA",
+		CountryNumeric: "840",
+		Continent:      "NA",
+		Network:        "8.8.8.0/24",
+		Containment:    "contained",
+		Countries:      []string{"US"},
+		CountrySource:  "rir",
+		RIR:            "arin",
+		Allocated:      "1992-12-01",
+		Provider:       &provider.Result{Mode: "bgp", ASNs: []int{15169}, Holders: []string{"GOOGLE LLC"}, Error: "x"},
+		SnapshotTime:   "2025-02-02",
+		IndexBuiltAt:   time.Now(),
+		Error:          "x",
+		Special:        true,
+		Anycast:        true,
+		Groups:         []string{"eu"},
+		Tags:           []string{"corp-vpn"},
+		EmbeddedIPv4:   "192.0.2.1",
+		Embedding:      "6to4",
+		Hostname:       "dns.google",
+		AbuseContacts:  []string{"abuse@example.com"},
+		Geolocation:    &provider.Geolocation{City: "Mountain View", Country: "US"},
+		Timing:         &Timing{},
+		Extra:          map[string]interface{}{"tag": "x"},
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for name := range fields {
+		if _, ok := schema.Defs["LookupResult"].Properties[name]; !ok {
+			t.Errorf("field %q is missing from the schema", name)
+		}
+	}
+	for _, name := range schema.Defs["LookupResult"].Required {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("required field %q is missing from the output", name)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package output
+
+import (
+	"io"
+
+	"github.com/hightemp/ip2cc/internal/sqlite"
+)
+
+// sqliteColumns are the columns of the results table of SQLite output.
+var sqliteColumns = []sqlite.Column{
+	{Name: "ip", Type: sqlite.Text},
+	{Name: "country_code", Type: sqlite.Text},
+	{Name: "network", Type: sqlite.Text},
+	{Name: "asn", Type: sqlite.Integer},
+	{Name: "holder", Type: sqlite.Text},
+	{Name: "snapshot_date", Type: sqlite.Text},
+}
+
+// SQLiteWriter writes results into the "results" table of a SQLite
+// database, indexed on ip.
+type SQLiteWriter struct {
+	w *sqlite.Writer
+}
+
+// NewSQLiteWriter creates a writer of a SQLite database of results to w,
+// which must be an empty file.
+func NewSQLiteWriter(w io.WriteSeeker) (*SQLiteWriter, error) {
+	sw, err := sqlite.NewWriter(w, "results", sqliteColumns, "ip")
+	if err != nil {
+		return nil, err
+	}
+	return &SQLiteWriter{w: sw}, nil
+}
+
+// Write adds a result as a row. The country code of a CIDR spanning
+// several countries is null, as are the fields of failed lookups.
+func (s *SQLiteWriter) Write(r *LookupResult) error {
+	row := []interface{}{r.IP, nullable(r.CountryCode), nullable(r.Network), nil, nil, nullable(r.SnapshotTime)}
+	if r.Provider != nil {
+		if len(r.Provider.ASNs) > 0 {
+			row[3] = int64(r.Provider.ASNs[0])
+		}
+		if len(r.Provider.Holders) > 0 {
+			row[4] = r.Provider.Holders[0]
+		}
+	}
+	return s.w.Write(row)
+}
+
+// Close writes the index and the schema.
+func (s *SQLiteWriter) Close() error {
+	return s.w.Close()
+}
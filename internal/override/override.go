@@ -0,0 +1,146 @@
+// Package override applies the user's corrections to the index: prefixes
+// mapped to a country, and optionally a provider, that take precedence over
+// the registry data, e.g. to fix known-wrong registrations or to map
+// internal ranges.
+//
+// The overrides file is CSV with prefix, country and an optional provider
+// per line; lines starting with '#' are comments:
+//
+//	# prefix,country,provider
+//	10.20.0.0/16,DE,Frankfurt office
+//	203.0.113.0/24,NL
+package override
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hightemp/ip2cc/internal/countries"
+	"github.com/hightemp/ip2cc/internal/index"
+	"github.com/hightemp/ip2cc/internal/provider"
+)
+
+// Source marks the index data taken from the overrides file.
+const Source = "override"
+
+// Entry is one line of the overrides file.
+type Entry struct {
+	Prefix      netip.Prefix
+	CountryCode string
+	// Provider is the holder reported for the prefix, if given.
+	Provider string
+}
+
+// Parse reads an overrides file.
+func Parse(r io.Reader) ([]Entry, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	var entries []Entry
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line %d: expected prefix and country", line)
+		}
+
+		prefix, err := parsePrefix(strings.TrimSpace(record[0]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		cc := countries.Normalize(record[1])
+		if !countries.IsValid(cc) && !countries.IsPlaceholder(cc) {
+			return nil, fmt.Errorf("line %d: invalid country code %q", line, record[1])
+		}
+		e := Entry{Prefix: prefix, CountryCode: cc}
+		if len(record) > 2 {
+			e.Provider = strings.TrimSpace(record[2])
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// parsePrefix parses a CIDR or a single address.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return p.Masked(), nil
+	}
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	ip = ip.Unmap()
+	return netip.PrefixFrom(ip, ip.BitLen()), nil
+}
+
+// Load reads the overrides file at path.
+func Load(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// Apply inserts the entries into the index tries, marked with Source. An
+// entry replaces the registry data of its whole prefix, including more
+// specific prefixes within it; of nested entries, the more specific one
+// wins, and of entries for the same prefix, the last one. It returns the
+// number of entries applied.
+func Apply(v4, v6 *index.Trie, entries []Entry) (int, error) {
+	sorted := make([]Entry, len(entries))
+	copy(sorted, entries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Prefix.Bits() < sorted[j].Prefix.Bits()
+	})
+
+	for _, e := range sorted {
+		trie := v4
+		if e.Prefix.Addr().Is6() {
+			trie = v6
+		}
+		data := index.PrefixData{CountryCode: e.CountryCode, Holder: e.Provider, Source: Source}
+		if err := trie.Override(e.Prefix, data); err != nil {
+			return 0, fmt.Errorf("override %s: %w", e.Prefix, err)
+		}
+	}
+	return len(sorted), nil
+}
+
+// IsOverride reports whether data comes from the overrides file.
+func IsOverride(data *index.PrefixData) bool {
+	return data != nil && data.Source == Source
+}
+
+// Provider returns the provider the overrides file sets for data, or nil
+// if it sets none.
+func Provider(data *index.PrefixData) *provider.Result {
+	if !IsOverride(data) || data.Holder == "" {
+		return nil
+	}
+	return provider.OverrideResult(data.Holder)
+}
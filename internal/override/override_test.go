@@ -0,0 +1,114 @@
+package override
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hightemp/ip2cc/internal/index"
+	"github.com/hightemp/ip2cc/internal/provider"
+)
+
+const sampleOverrides = "# prefix,country,provider\n" +
+	"10.20.0.0/16,de,Frankfurt office\n" +
+	"10.20.5.0/24, NL\n" +
+	"8.8.8.8,CH\n" +
+	"2001:db8::/32,FR,\"Lab, building 2\"\n"
+
+func TestParse(t *testing.T) {
+	entries, err := Parse(strings.NewReader(sampleOverrides))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	expected := []Entry{
+		{netip.MustParsePrefix("10.20.0.0/16"), "DE", "Frankfurt office"},
+		{netip.MustParsePrefix("10.20.5.0/24"), "NL", ""},
+		{netip.MustParsePrefix("8.8.8.8/32"), "CH", ""},
+		{netip.MustParsePrefix("2001:db8::/32"), "FR", "Lab, building 2"},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("Parse returned %d entries, expected %d", len(entries), len(expected))
+	}
+	for i, e := range expected {
+		if entries[i] != e {
+			t.Errorf("entries[%d] = %+v, expected %+v", i, entries[i], e)
+		}
+	}
+
+	for _, bad := range []string{"10.0.0.0/8\n", "10.0.0.0/33,DE\n", "10.0.0.0/8,XX\n"} {
+		if _, err := Parse(strings.NewReader(bad)); err == nil {
+			t.Errorf("Parse(%q) succeeded, expected an error", bad)
+		}
+	}
+}
+
+func TestLoadAndApply(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	path := filepath.Join(tmpDir, "overrides.csv")
+	if err := os.WriteFile(path, []byte(sampleOverrides), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	v4, v6 := index.NewTrie(false), index.NewTrie(true)
+	v4.InsertCIDR("8.8.8.0/24", "US")
+	v4.InsertCIDR("10.20.5.128/25", "US")
+	// Applied in file order the /24 would be hidden by the /16 given first
+	n, err := Apply(v4, v6, entries)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if n != 4 {
+		t.Errorf("Apply = %d, expected 4", n)
+	}
+
+	tests := []struct {
+		ip       string
+		country  string
+		prefix   string
+		provider string
+	}{
+		{"10.20.1.1", "DE", "10.20.0.0/16", "Frankfurt office"},
+		{"10.20.5.200", "NL", "10.20.5.0/24", ""},
+		{"8.8.8.8", "CH", "8.8.8.8/32", ""},
+		{"8.8.8.9", "US", "8.8.8.0/24", ""},
+		{"2001:db8::1", "FR", "2001:db8::/32", "Lab, building 2"},
+	}
+	for _, tc := range tests {
+		ip := netip.MustParseAddr(tc.ip)
+		trie := v4
+		if ip.Is6() {
+			trie = v6
+		}
+		data := trie.Lookup(ip)
+		if data == nil || data.CountryCode != tc.country || data.Prefix(ip).String() != tc.prefix {
+			t.Errorf("Lookup(%s) = %+v, expected %s %s", tc.ip, data, tc.country, tc.prefix)
+			continue
+		}
+		if IsOverride(data) != (tc.country != "US") {
+			t.Errorf("IsOverride(%s) = %v", tc.ip, IsOverride(data))
+		}
+		p := Provider(data)
+		if tc.provider == "" {
+			if p != nil {
+				t.Errorf("Provider(%s) = %+v, expected nil", tc.ip, p)
+			}
+		} else if p == nil || p.Mode != provider.ModeOverride || p.GetHolderString() != tc.provider {
+			t.Errorf("Provider(%s) = %+v, expected %s", tc.ip, p, tc.provider)
+		}
+	}
+
+	if _, err := Load(filepath.Join(tmpDir, "missing.csv")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
@@ -0,0 +1,343 @@
+// Package parquet writes flat tables as Apache Parquet files, with one
+// zstd-compressed data page per column chunk.
+package parquet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Type is the type of a column.
+type Type int
+
+const (
+	// String is a UTF-8 string column.
+	String Type = iota
+	// Int64 is a signed 64-bit integer column.
+	Int64
+	// Double is a 64-bit floating point column.
+	Double
+	// Bool is a boolean column.
+	Bool
+	// TimestampMillis is a timestamp column in milliseconds since the
+	// epoch (UTC), written from int64 values.
+	TimestampMillis
+)
+
+// Column describes a column of the table.
+type Column struct {
+	Name string
+	Type Type
+	// Optional columns accept nil values (nulls).
+	Optional bool
+}
+
+// Parquet physical types, encodings, and other enum values
+const (
+	typeBoolean   = 0
+	typeInt64     = 2
+	typeDouble    = 5
+	typeByteArray = 6
+
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+
+	repetitionRequired = 0
+	repetitionOptional = 1
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	codecZstd    = 6
+	pageTypeData = 0
+)
+
+// RowGroupRows is the number of rows buffered into each row group.
+const RowGroupRows = 1 << 17
+
+var magic = []byte("PAR1")
+
+// Writer writes rows to a Parquet file.
+type Writer struct {
+	w       io.Writer
+	columns []Column
+	enc     *zstd.Encoder
+
+	// offset is the number of bytes written so far
+	offset    int64
+	rows      int
+	totalRows int64
+	values    [][]byte
+	defLevels [][]bool
+	bits      []int
+	rowGroups [][]chunkMeta
+	err       error
+}
+
+// chunkMeta is what the footer records about a column chunk.
+type chunkMeta struct {
+	offset           int64
+	values           int64
+	compressedSize   int64
+	uncompressedSize int64
+}
+
+// NewWriter creates a writer of a table with the given columns to w.
+func NewWriter(w io.Writer, columns []Column) (*Writer, error) {
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	pw := &Writer{
+		w:         w,
+		columns:   columns,
+		enc:       enc,
+		values:    make([][]byte, len(columns)),
+		defLevels: make([][]bool, len(columns)),
+		bits:      make([]int, len(columns)),
+	}
+	pw.write(magic)
+	return pw, pw.err
+}
+
+// Write adds a row of one value per column: string, int64, float64, bool,
+// or int64 milliseconds for TimestampMillis, or nil in optional columns.
+func (pw *Writer) Write(row []interface{}) error {
+	if pw.err != nil {
+		return pw.err
+	}
+	if len(row) != len(pw.columns) {
+		return fmt.Errorf("row has %d values, expected %d", len(row), len(pw.columns))
+	}
+	// Check the whole row first, so that a bad one leaves no partial row
+	for i, v := range row {
+		if err := checkValue(pw.columns[i], v); err != nil {
+			return fmt.Errorf("column %s: %w", pw.columns[i].Name, err)
+		}
+	}
+	for i, v := range row {
+		if pw.columns[i].Optional {
+			pw.defLevels[i] = append(pw.defLevels[i], v != nil)
+		}
+		if v != nil {
+			pw.appendValue(i, v)
+		}
+	}
+	pw.rows++
+	if pw.rows >= RowGroupRows {
+		pw.flushRowGroup()
+	}
+	return pw.err
+}
+
+// checkValue checks that v fits col.
+func checkValue(col Column, v interface{}) error {
+	var ok bool
+	switch col.Type {
+	case String:
+		_, ok = v.(string)
+	case Int64, TimestampMillis:
+		_, ok = v.(int64)
+	case Double:
+		_, ok = v.(float64)
+	case Bool:
+		_, ok = v.(bool)
+	}
+	switch {
+	case v == nil && !col.Optional:
+		return fmt.Errorf("null in a required column")
+	case v != nil && !ok:
+		return fmt.Errorf("value %v (%T) does not fit the column type", v, v)
+	}
+	return nil
+}
+
+// appendValue appends v, PLAIN-encoded, to the values of column i.
+func (pw *Writer) appendValue(i int, v interface{}) {
+	buf := pw.values[i]
+	switch v := v.(type) {
+	case string:
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(v)))
+		buf = append(buf, v...)
+	case int64:
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(v))
+	case float64:
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(v))
+	case bool:
+		// Booleans are bit-packed, least significant bit first
+		if pw.bits[i]%8 == 0 {
+			buf = append(buf, 0)
+		}
+		if v {
+			buf[len(buf)-1] |= 1 << (pw.bits[i] % 8)
+		}
+		pw.bits[i]++
+	}
+	pw.values[i] = buf
+}
+
+// flushRowGroup writes the buffered rows as a row group.
+func (pw *Writer) flushRowGroup() {
+	if pw.rows == 0 || pw.err != nil {
+		return
+	}
+	chunks := make([]chunkMeta, len(pw.columns))
+	for i, col := range pw.columns {
+		var page []byte
+		if col.Optional {
+			levels := encodeLevels(pw.defLevels[i])
+			page = binary.LittleEndian.AppendUint32(page, uint32(len(levels)))
+			page = append(page, levels...)
+		}
+		page = append(page, pw.values[i]...)
+		compressed := pw.enc.EncodeAll(page, nil)
+
+		var h thriftWriter
+		h.begin(0)
+		h.i32(1, pageTypeData)
+		h.i32(2, int32(len(page)))
+		h.i32(3, int32(len(compressed)))
+		h.begin(5)
+		h.i32(1, int32(pw.rows))
+		h.i32(2, encodingPlain)
+		h.i32(3, encodingRLE)
+		h.i32(4, encodingRLE)
+		h.end()
+		h.end()
+
+		chunks[i] = chunkMeta{
+			offset:           pw.offset,
+			values:           int64(pw.rows),
+			compressedSize:   int64(len(h.buf) + len(compressed)),
+			uncompressedSize: int64(len(h.buf) + len(page)),
+		}
+		pw.write(h.buf)
+		pw.write(compressed)
+
+		pw.values[i] = pw.values[i][:0]
+		pw.defLevels[i] = pw.defLevels[i][:0]
+		pw.bits[i] = 0
+	}
+	pw.rowGroups = append(pw.rowGroups, chunks)
+	pw.totalRows += int64(pw.rows)
+	pw.rows = 0
+}
+
+// encodeLevels encodes definition levels of bit width 1 as runs of the
+// RLE/bit-packing hybrid encoding.
+func encodeLevels(levels []bool) []byte {
+	var buf []byte
+	for i := 0; i < len(levels); {
+		j := i
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		buf = binary.AppendUvarint(buf, uint64(j-i)<<1)
+		if levels[i] {
+			buf = append(buf, 1)
+		} else {
+			buf = append(buf, 0)
+		}
+		i = j
+	}
+	return buf
+}
+
+// Close writes the remaining rows and the footer. It does not close the
+// underlying writer.
+func (pw *Writer) Close() error {
+	pw.flushRowGroup()
+	defer pw.enc.Close()
+	if pw.err != nil {
+		return pw.err
+	}
+
+	var t thriftWriter
+	t.begin(0)
+	t.i32(1, 1)
+	t.list(2, compactStruct, len(pw.columns)+1)
+	t.begin(0)
+	t.binary(4, "schema")
+	t.i32(5, int32(len(pw.columns)))
+	t.end()
+	for _, col := range pw.columns {
+		t.begin(0)
+		t.i32(1, physicalType(col.Type))
+		repetition := int32(repetitionRequired)
+		if col.Optional {
+			repetition = repetitionOptional
+		}
+		t.i32(3, repetition)
+		t.binary(4, col.Name)
+		switch col.Type {
+		case String:
+			t.i32(6, convertedUTF8)
+		case TimestampMillis:
+			t.i32(6, convertedTimestampMillis)
+		}
+		t.end()
+	}
+	t.i64(3, pw.totalRows)
+	t.list(4, compactStruct, len(pw.rowGroups))
+	for _, chunks := range pw.rowGroups {
+		t.begin(0)
+		t.list(1, compactStruct, len(chunks))
+		var total, rows int64
+		for i, c := range chunks {
+			col := pw.columns[i]
+			t.begin(0)
+			t.i64(2, c.offset)
+			t.begin(3)
+			t.i32(1, physicalType(col.Type))
+			t.list(2, compactI32, 2)
+			t.listI32(encodingPlain)
+			t.listI32(encodingRLE)
+			t.list(3, compactBinary, 1)
+			t.listBinary(col.Name)
+			t.i32(4, codecZstd)
+			t.i64(5, c.values)
+			t.i64(6, c.uncompressedSize)
+			t.i64(7, c.compressedSize)
+			t.i64(9, c.offset)
+			t.end()
+			t.end()
+			total += c.uncompressedSize
+			rows = c.values
+		}
+		t.i64(2, total)
+		t.i64(3, rows)
+		t.end()
+	}
+	t.binary(6, "ip2cc")
+	t.end()
+
+	pw.write(t.buf)
+	pw.write(binary.LittleEndian.AppendUint32(nil, uint32(len(t.buf))))
+	pw.write(magic)
+	return pw.err
+}
+
+func physicalType(t Type) int32 {
+	switch t {
+	case Int64, TimestampMillis:
+		return typeInt64
+	case Double:
+		return typeDouble
+	case Bool:
+		return typeBoolean
+	}
+	return typeByteArray
+}
+
+func (pw *Writer) write(b []byte) {
+	if pw.err != nil {
+		return
+	}
+	n, err := pw.w.Write(b)
+	pw.offset += int64(n)
+	pw.err = err
+}
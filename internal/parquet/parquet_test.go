@@ -0,0 +1,241 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compactReader decodes Thrift compact structs into maps of field id to
+// value, enough to check the metadata the writer produces.
+type compactReader struct {
+	b []byte
+}
+
+func (r *compactReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		panic("invalid varint")
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *compactReader) varint() int64 {
+	v, n := binary.Varint(r.b)
+	if n <= 0 {
+		panic("invalid varint")
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *compactReader) value(typ byte) interface{} {
+	switch typ {
+	case 1:
+		return true
+	case 2:
+		return false
+	case compactI32, compactI64:
+		return r.varint()
+	case compactBinary:
+		n := r.uvarint()
+		s := string(r.b[:n])
+		r.b = r.b[n:]
+		return s
+	case compactList:
+		h := r.b[0]
+		r.b = r.b[1:]
+		n, elem := int(h>>4), h&0x0f
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = r.value(elem)
+		}
+		return list
+	case compactStruct:
+		return r.structure()
+	}
+	panic(fmt.Sprintf("unsupported type %d", typ))
+}
+
+func (r *compactReader) structure() map[int16]interface{} {
+	fields := make(map[int16]interface{})
+	var id int16
+	for {
+		h := r.b[0]
+		r.b = r.b[1:]
+		if h == 0 {
+			return fields
+		}
+		if delta := int16(h >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(r.varint())
+		}
+		fields[id] = r.value(h & 0x0f)
+	}
+}
+
+// readColumn reads the values of column i of every row group of file.
+func readColumn(t *testing.T, file []byte, meta map[int16]interface{}, i int) []interface{} {
+	t.Helper()
+	schema := meta[2].([]interface{})[i+1].(map[int16]interface{})
+	optional := schema[3].(int64) == repetitionOptional
+	physical := schema[1].(int64)
+
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dec.Close()
+
+	var values []interface{}
+	for _, rg := range meta[4].([]interface{}) {
+		chunk := rg.(map[int16]interface{})[1].([]interface{})[i].(map[int16]interface{})
+		cm := chunk[3].(map[int16]interface{})
+		r := &compactReader{b: file[cm[9].(int64):]}
+		header := r.structure()
+		rows := int(header[5].(map[int16]interface{})[1].(int64))
+		page, err := dec.DecodeAll(r.b[:header[3].(int64)], nil)
+		if err != nil {
+			t.Fatalf("decompress page: %v", err)
+		}
+		if int64(len(page)) != header[2].(int64) {
+			t.Fatalf("page size = %d, expected %d", len(page), header[2])
+		}
+
+		defined := make([]bool, rows)
+		for j := range defined {
+			defined[j] = true
+		}
+		if optional {
+			n := binary.LittleEndian.Uint32(page)
+			lr := &compactReader{b: page[4 : 4+n]}
+			page = page[4+n:]
+			for j := 0; j < rows; {
+				run := int(lr.uvarint() >> 1)
+				level := lr.b[0]
+				lr.b = lr.b[1:]
+				for k := 0; k < run; k++ {
+					defined[j] = level == 1
+					j++
+				}
+			}
+		}
+
+		bit := 0
+		for _, d := range defined {
+			if !d {
+				values = append(values, nil)
+				continue
+			}
+			switch physical {
+			case typeByteArray:
+				n := binary.LittleEndian.Uint32(page)
+				values = append(values, string(page[4:4+n]))
+				page = page[4+n:]
+			case typeInt64:
+				values = append(values, int64(binary.LittleEndian.Uint64(page)))
+				page = page[8:]
+			case typeDouble:
+				values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(page)))
+				page = page[8:]
+			case typeBoolean:
+				values = append(values, page[bit/8]&(1<<(bit%8)) != 0)
+				bit++
+			}
+		}
+	}
+	return values
+}
+
+func TestWriter(t *testing.T) {
+	columns := []Column{
+		{Name: "ip", Type: String},
+		{Name: "asn", Type: Int64, Optional: true},
+		{Name: "latitude", Type: Double, Optional: true},
+		{Name: "special", Type: Bool},
+		{Name: "built_at", Type: TimestampMillis},
+	}
+	rows := [][]interface{}{
+		{"8.8.8.8", int64(15169), 37.4, false, int64(1738490400000)},
+		{"10.0.0.1", nil, nil, true, int64(1738490400000)},
+	}
+	// Enough rows for two row groups
+	for len(rows) < RowGroupRows+10 {
+		rows = append(rows, []interface{}{fmt.Sprintf("1.1.%d.%d", len(rows)/256%256, len(rows)%256), int64(len(rows)), nil, len(rows)%3 == 0, int64(0)})
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	file := buf.Bytes()
+	if !bytes.HasPrefix(file, magic) || !bytes.HasSuffix(file, magic) {
+		t.Fatal("file does not start and end with PAR1")
+	}
+	footerLen := binary.LittleEndian.Uint32(file[len(file)-8:])
+	footer := file[len(file)-8-int(footerLen) : len(file)-8]
+	meta := (&compactReader{b: footer}).structure()
+
+	if meta[3].(int64) != int64(len(rows)) {
+		t.Errorf("num_rows = %v, expected %d", meta[3], len(rows))
+	}
+	if n := len(meta[4].([]interface{})); n != 2 {
+		t.Errorf("row groups = %d, expected 2", n)
+	}
+	schema := meta[2].([]interface{})
+	if len(schema) != len(columns)+1 || schema[0].(map[int16]interface{})[5].(int64) != int64(len(columns)) {
+		t.Fatalf("schema = %v", schema)
+	}
+	if converted := schema[5].(map[int16]interface{})[6]; converted != int64(convertedTimestampMillis) {
+		t.Errorf("built_at converted type = %v, expected %d", converted, convertedTimestampMillis)
+	}
+
+	for i, col := range columns {
+		got := readColumn(t, file, meta, i)
+		if len(got) != len(rows) {
+			t.Fatalf("column %s has %d values, expected %d", col.Name, len(got), len(rows))
+		}
+		for j, row := range rows {
+			if !reflect.DeepEqual(got[j], row[i]) {
+				t.Errorf("column %s row %d = %v, expected %v", col.Name, j, got[j], row[i])
+				break
+			}
+		}
+	}
+}
+
+func TestWriterRejectsInvalidRows(t *testing.T) {
+	w, err := NewWriter(&bytes.Buffer{}, []Column{{Name: "ip", Type: String}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write([]interface{}{nil}); err == nil {
+		t.Error("Write() of a null in a required column succeeded")
+	}
+	if err := w.Write([]interface{}{int64(1)}); err == nil {
+		t.Error("Write() of an int64 in a string column succeeded")
+	}
+	if err := w.Write([]interface{}{"a", "b"}); err == nil {
+		t.Error("Write() of too many values succeeded")
+	}
+}
@@ -0,0 +1,82 @@
+package parquet
+
+import "encoding/binary"
+
+// Thrift compact protocol types, as used by the Parquet metadata
+const (
+	compactI32    = 5
+	compactI64    = 6
+	compactBinary = 8
+	compactList   = 9
+	compactStruct = 12
+)
+
+// thriftWriter encodes structs with the Thrift compact protocol.
+type thriftWriter struct {
+	buf []byte
+	// last holds the last field id written of each open struct
+	last []int16
+}
+
+func (t *thriftWriter) fieldHeader(id int16, typ byte) {
+	last := &t.last[len(t.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.buf = binary.AppendVarint(t.buf, int64(id))
+	}
+	*last = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.fieldHeader(id, compactI32)
+	t.buf = binary.AppendVarint(t.buf, int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.fieldHeader(id, compactI64)
+	t.buf = binary.AppendVarint(t.buf, v)
+}
+
+func (t *thriftWriter) binary(id int16, v string) {
+	t.fieldHeader(id, compactBinary)
+	t.buf = binary.AppendUvarint(t.buf, uint64(len(v)))
+	t.buf = append(t.buf, v...)
+}
+
+// list starts a list field of n elements of type elem.
+func (t *thriftWriter) list(id int16, elem byte, n int) {
+	t.fieldHeader(id, compactList)
+	if n < 15 {
+		t.buf = append(t.buf, byte(n)<<4|elem)
+	} else {
+		t.buf = append(t.buf, 0xf0|elem)
+		t.buf = binary.AppendUvarint(t.buf, uint64(n))
+	}
+}
+
+// listI32 writes an element of a list of i32.
+func (t *thriftWriter) listI32(v int32) {
+	t.buf = binary.AppendVarint(t.buf, int64(v))
+}
+
+// listBinary writes an element of a list of binary.
+func (t *thriftWriter) listBinary(v string) {
+	t.buf = binary.AppendUvarint(t.buf, uint64(len(v)))
+	t.buf = append(t.buf, v...)
+}
+
+// begin starts a struct: a field when id is non-zero, or a list element.
+func (t *thriftWriter) begin(id int16) {
+	if id != 0 {
+		t.fieldHeader(id, compactStruct)
+	}
+	t.last = append(t.last, 0)
+}
+
+// end closes the struct begun last.
+func (t *thriftWriter) end() {
+	t.buf = append(t.buf, 0)
+	t.last = t.last[:len(t.last)-1]
+}
@@ -0,0 +1,31 @@
+package provider
+
+import (
+	"context"
+)
+
+// AbuseContacts returns the abuse email addresses registered for the
+// network of prefix (the matched index prefix). Answers are kept for the
+// lifetime of the resolver, so a batch queries each prefix only once.
+func (r *Resolver) AbuseContacts(ctx context.Context, prefix string) ([]string, error) {
+	r.abuseMu.Lock()
+	contacts, ok := r.abuse[prefix]
+	r.abuseMu.Unlock()
+	if ok {
+		return contacts, nil
+	}
+
+	result, err := r.client.GetAbuseContacts(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	contacts = result.Contacts
+	if contacts == nil {
+		contacts = []string{}
+	}
+
+	r.abuseMu.Lock()
+	r.abuse[prefix] = contacts
+	r.abuseMu.Unlock()
+	return contacts, nil
+}
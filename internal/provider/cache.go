@@ -3,6 +3,7 @@ package provider
 
 import (
 	"encoding/json"
+	"net/netip"
 	"os"
 	"sync"
 	"time"
@@ -15,24 +16,91 @@ type CacheEntry struct {
 	ExpiresAt time.Time `json:"expires_at"`
 }
 
-// Cache is a persistent cache for ASN holder information.
+// PrefixEntry records the routing of a prefix. An entry without ASNs
+// marks the prefix as not routed.
+type PrefixEntry struct {
+	ASNs      []int     `json:"asns,omitempty"`
+	CachedAt  time.Time `json:"cached_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// cacheFileVersion is the current on-disk cache format version. Version 0
+// files are a bare ASN holder map.
+const cacheFileVersion = 1
+
+// cacheFile is the on-disk cache layout.
+type cacheFile struct {
+	Version  int                     `json:"version"`
+	ASNs     map[int]*CacheEntry     `json:"asns"`
+	Prefixes map[string]*PrefixEntry `json:"prefixes,omitempty"`
+}
+
+// Cache is a persistent cache for ASN holder information and the routing
+// state of prefixes.
 type Cache struct {
-	mu      sync.RWMutex
-	entries map[int]*CacheEntry
-	path    string
-	ttl     time.Duration
-	dirty   bool
+	mu          sync.RWMutex
+	entries     map[int]*CacheEntry
+	prefixes    map[netip.Prefix]*PrefixEntry
+	path        string
+	ttl         time.Duration
+	negativeTTL time.Duration
+	dirty       bool
 }
 
 // NewCache creates a new provider cache.
 func NewCache(path string, ttlDays int) *Cache {
 	return &Cache{
-		entries: make(map[int]*CacheEntry),
-		path:    path,
-		ttl:     time.Duration(ttlDays) * 24 * time.Hour,
+		entries:     make(map[int]*CacheEntry),
+		prefixes:    make(map[netip.Prefix]*PrefixEntry),
+		path:        path,
+		ttl:         time.Duration(ttlDays) * 24 * time.Hour,
+		negativeTTL: DefaultNegativeTTL,
 	}
 }
 
+// DefaultNegativeTTL is how long a prefix stays cached as not routed.
+// It is kept short because new announcements appear at any time.
+const DefaultNegativeTTL = time.Hour
+
+// SetTTL changes the lifetime of ASN holder and routed prefix entries.
+func (c *Cache) SetTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttl = ttl
+}
+
+// SetNegativeTTL changes the lifetime of not-routed entries.
+func (c *Cache) SetNegativeTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.negativeTTL = ttl
+}
+
+// decodeCacheFile parses both the current and the legacy cache layout.
+func decodeCacheFile(data []byte) (*cacheFile, error) {
+	var f cacheFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	if f.Version == 0 {
+		f = cacheFile{}
+		if err := json.Unmarshal(data, &f.ASNs); err != nil {
+			return nil, err
+		}
+	}
+	return &f, nil
+}
+
+func (f *cacheFile) prefixEntries() map[netip.Prefix]*PrefixEntry {
+	prefixes := make(map[netip.Prefix]*PrefixEntry, len(f.Prefixes))
+	for s, entry := range f.Prefixes {
+		if p, err := netip.ParsePrefix(s); err == nil {
+			prefixes[p] = entry
+		}
+	}
+	return prefixes
+}
+
 // Load loads the cache from disk.
 func (c *Cache) Load() error {
 	c.mu.Lock()
@@ -46,12 +114,43 @@ func (c *Cache) Load() error {
 		return err
 	}
 
-	var entries map[int]*CacheEntry
-	if err := json.Unmarshal(data, &entries); err != nil {
+	f, err := decodeCacheFile(data)
+	if err != nil {
 		return err
 	}
 
-	c.entries = entries
+	c.entries = f.ASNs
+	if c.entries == nil {
+		c.entries = make(map[int]*CacheEntry)
+	}
+	c.prefixes = f.prefixEntries()
+	return nil
+}
+
+// Import merges entries from serialized cache data (e.g. a snapshot bundle).
+// Entries already present and not expired are kept.
+func (c *Cache) Import(data []byte) error {
+	f, err := decodeCacheFile(data)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for asn, entry := range f.ASNs {
+		if existing, ok := c.entries[asn]; ok && now.Before(existing.ExpiresAt) {
+			continue
+		}
+		c.entries[asn] = entry
+	}
+	for p, entry := range f.prefixEntries() {
+		if existing, ok := c.prefixes[p]; ok && now.Before(existing.ExpiresAt) {
+			continue
+		}
+		c.prefixes[p] = entry
+	}
 	return nil
 }
 
@@ -64,7 +163,16 @@ func (c *Cache) Save() error {
 		return nil
 	}
 
-	data, err := json.MarshalIndent(c.entries, "", "  ")
+	f := cacheFile{
+		Version:  cacheFileVersion,
+		ASNs:     c.entries,
+		Prefixes: make(map[string]*PrefixEntry, len(c.prefixes)),
+	}
+	for p, entry := range c.prefixes {
+		f.Prefixes[p.String()] = entry
+	}
+
+	data, err := json.MarshalIndent(f, "", "  ")
 	if err != nil {
 		return err
 	}
@@ -103,12 +211,61 @@ func (c *Cache) Set(asn int, holder string) {
 	c.dirty = true
 }
 
+// GetPrefix returns the ASNs of the most specific cached prefix containing
+// ip. An empty, found result means the address is known to be unrouted.
+func (c *Cache) GetPrefix(ip netip.Addr) ([]int, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if len(c.prefixes) == 0 {
+		return nil, false
+	}
+	ip = ip.Unmap()
+	now := time.Now()
+	for bits := ip.BitLen(); bits >= 0; bits-- {
+		p, _ := ip.Prefix(bits)
+		entry, ok := c.prefixes[p]
+		if !ok {
+			continue
+		}
+		if now.After(entry.ExpiresAt) {
+			continue
+		}
+		return entry.ASNs, true
+	}
+	return nil, false
+}
+
+// SetPrefix caches the ASNs announcing prefix for the regular TTL.
+func (c *Cache) SetPrefix(prefix netip.Prefix, asns []int) {
+	c.setPrefix(prefix, asns, c.ttl)
+}
+
+// SetNotRouted marks a prefix as not routed for the negative TTL.
+func (c *Cache) SetNotRouted(prefix netip.Prefix) {
+	c.setPrefix(prefix, nil, c.negativeTTL)
+}
+
+func (c *Cache) setPrefix(prefix netip.Prefix, asns []int, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.prefixes[prefix.Masked()] = &PrefixEntry{
+		ASNs:      asns,
+		CachedAt:  now,
+		ExpiresAt: now.Add(ttl),
+	}
+	c.dirty = true
+}
+
 // Clear removes all cache entries.
 func (c *Cache) Clear() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	c.entries = make(map[int]*CacheEntry)
+	c.prefixes = make(map[netip.Prefix]*PrefixEntry)
 	c.dirty = true
 }
 
@@ -125,13 +282,19 @@ func (c *Cache) Cleanup() int {
 			removed++
 		}
 	}
+	for p, entry := range c.prefixes {
+		if now.After(entry.ExpiresAt) {
+			delete(c.prefixes, p)
+			removed++
+		}
+	}
 	if removed > 0 {
 		c.dirty = true
 	}
 	return removed
 }
 
-// Size returns the number of cached entries.
+// Size returns the number of cached ASN holder entries.
 func (c *Cache) Size() int {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -0,0 +1,51 @@
+package provider
+
+import (
+	"context"
+)
+
+// Geolocation is a best-guess physical location of a network. It is
+// unrelated to, and may differ from, the registration country.
+type Geolocation struct {
+	City      string  `json:"city,omitempty"`
+	Country   string  `json:"country,omitempty"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	// Coverage is the share of the network (in percent) at this location.
+	Coverage float64 `json:"coverage_percent"`
+	Source   string  `json:"source"`
+}
+
+// Geolocate returns the location covering most of prefix (the matched
+// index prefix), or nil if none is known. Answers are kept for the
+// lifetime of the resolver.
+func (r *Resolver) Geolocate(ctx context.Context, prefix string) (*Geolocation, error) {
+	r.geoMu.Lock()
+	geo, ok := r.geo[prefix]
+	r.geoMu.Unlock()
+	if ok {
+		return geo, nil
+	}
+
+	locations, err := r.client.GetGeoloc(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, loc := range locations {
+		if geo == nil || loc.CoveredPercentage > geo.Coverage {
+			geo = &Geolocation{
+				City:      loc.City,
+				Country:   loc.Country,
+				Latitude:  loc.Latitude,
+				Longitude: loc.Longitude,
+				Coverage:  loc.CoveredPercentage,
+				Source:    "RIPEstat geoloc",
+			}
+		}
+	}
+
+	r.geoMu.Lock()
+	r.geo[prefix] = geo
+	r.geoMu.Unlock()
+	return geo, nil
+}
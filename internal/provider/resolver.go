@@ -3,10 +3,15 @@ package provider
 import (
 	"context"
 	"fmt"
+	"net/netip"
 	"sync"
+	"time"
 
+	"github.com/hightemp/ip2cc/internal/asndb"
 	"github.com/hightemp/ip2cc/internal/config"
+	"github.com/hightemp/ip2cc/internal/rdap"
 	"github.com/hightemp/ip2cc/internal/ripestat"
+	"github.com/hightemp/ip2cc/internal/whois"
 )
 
 // Mode represents the provider resolution mode.
@@ -17,8 +22,22 @@ const (
 	ModeBGP Mode = "bgp"
 	// ModeWhois uses whois API.
 	ModeWhois Mode = "whois"
+	// ModeWhois43 queries registry whois servers directly over TCP port 43.
+	ModeWhois43 Mode = "whois43"
+	// ModeLocal uses the offline ASN database built by update --asn-db.
+	ModeLocal Mode = "local"
+	// ModeRDAP queries the registry's RDAP server via rdap.org.
+	ModeRDAP Mode = "rdap"
+	// ModeAuto tries BGP first and falls back to whois.
+	ModeAuto Mode = "auto"
 	// ModeOff disables provider lookup.
 	ModeOff Mode = "off"
+	// ModeIndex labels holders embedded in the index at build time, which
+	// answer lookups without a resolver. It is not a selectable mode.
+	ModeIndex Mode = "index"
+	// ModeOverride labels providers set by the local overrides file, which
+	// take precedence over any mode. It is not a selectable mode.
+	ModeOverride Mode = "override"
 )
 
 // ParseMode parses a mode string.
@@ -28,10 +47,18 @@ func ParseMode(s string) (Mode, error) {
 		return ModeBGP, nil
 	case "whois":
 		return ModeWhois, nil
+	case "whois43":
+		return ModeWhois43, nil
+	case "rdap":
+		return ModeRDAP, nil
+	case "local":
+		return ModeLocal, nil
+	case "auto":
+		return ModeAuto, nil
 	case "off":
 		return ModeOff, nil
 	default:
-		return "", fmt.Errorf("invalid provider mode: %s (use bgp, whois, or off)", s)
+		return "", fmt.Errorf("invalid provider mode: %s (use bgp, whois, whois43, rdap, local, auto, or off)", s)
 	}
 }
 
@@ -45,33 +72,94 @@ type Result struct {
 	Error   string   `json:"error,omitempty"`
 }
 
+// EmbeddedResult returns the provider result for a holder embedded in the
+// index.
+func EmbeddedResult(holder string) *Result {
+	return &Result{
+		Mode:    ModeIndex,
+		Holders: []string{holder},
+		Source:  "index (embedded at build time)",
+	}
+}
+
+// OverrideResult returns the provider result for a holder set by the local
+// overrides file.
+func OverrideResult(holder string) *Result {
+	return &Result{
+		Mode:    ModeOverride,
+		Holders: []string{holder},
+		Source:  "local overrides file",
+	}
+}
+
 // Resolver resolves provider information for IP addresses.
 type Resolver struct {
 	client      *ripestat.Client
+	rdap        *rdap.Client
+	whois       *whois.Client
+	asnDB       *asndb.DB
+	asnDBErr    error
 	cache       *Cache
 	mode        Mode
 	useCache    bool
 	concurrency int
+
+	abuseMu sync.Mutex
+	abuse   map[string][]string
+	geoMu   sync.Mutex
+	geo     map[string]*Geolocation
+}
+
+// Options configures a Resolver.
+type Options struct {
+	// CacheDir is the ip2cc cache directory.
+	CacheDir string
+	// UseCache enables the persistent provider cache.
+	UseCache bool
+	// CachePath overrides the cache file (default: <CacheDir>/provider_cache.json).
+	CachePath string
+	// CacheTTL overrides the cache lifetime (default: 7 days).
+	CacheTTL time.Duration
+	// RIPEstatURL overrides the RIPEstat Data API base URL.
+	RIPEstatURL string
+	// Concurrency limits the parallel holder lookups of one resolution
+	// (default: config.DefaultProviderLookupConcurrency).
+	Concurrency int
 }
 
 // NewResolver creates a new provider resolver.
-func NewResolver(mode Mode, cacheDir string, useCache bool) *Resolver {
+func NewResolver(mode Mode, opts Options) *Resolver {
 	var cache *Cache
-	if useCache && mode != ModeOff {
-		cache = NewCache(
-			config.ProviderCachePath(cacheDir),
-			config.DefaultProviderCacheTTLDays,
-		)
+	if opts.UseCache && mode != ModeOff {
+		path := opts.CachePath
+		if path == "" {
+			path = config.ProviderCachePath(opts.CacheDir)
+		}
+		cache = NewCache(path, config.DefaultProviderCacheTTLDays)
+		if opts.CacheTTL > 0 {
+			cache.SetTTL(opts.CacheTTL)
+		}
 		cache.Load()
 	}
 
-	return &Resolver{
-		client:      ripestat.NewClient(),
+	r := &Resolver{
+		client:      ripestat.NewClient(ripestat.WithBaseURL(opts.RIPEstatURL)),
+		rdap:        rdap.NewClient(),
+		whois:       whois.NewClient(),
 		cache:       cache,
 		mode:        mode,
-		useCache:    useCache,
+		useCache:    opts.UseCache,
 		concurrency: config.DefaultProviderLookupConcurrency,
+		abuse:       make(map[string][]string),
+		geo:         make(map[string]*Geolocation),
+	}
+	if opts.Concurrency > 0 {
+		r.concurrency = opts.Concurrency
 	}
+	if mode == ModeLocal {
+		r.asnDB, r.asnDBErr = asndb.Load(config.ASNDBDir(opts.CacheDir))
+	}
+	return r
 }
 
 // Resolve resolves provider information for an IP.
@@ -88,6 +176,14 @@ func (r *Resolver) Resolve(ctx context.Context, ip string, matchedPrefix string)
 		return r.resolveBGP(ctx, ip)
 	case ModeWhois:
 		return r.resolveWhois(ctx, matchedPrefix)
+	case ModeWhois43:
+		return r.resolveWhois43(ctx, ip)
+	case ModeRDAP:
+		return r.resolveRDAP(ctx, matchedPrefix)
+	case ModeLocal:
+		return r.resolveLocal(ip)
+	case ModeAuto:
+		return r.resolveAuto(ctx, ip, matchedPrefix)
 	default:
 		return nil, fmt.Errorf("unknown mode: %s", r.mode)
 	}
@@ -99,29 +195,29 @@ func (r *Resolver) resolveBGP(ctx context.Context, ip string) (*Result, error) {
 		Source: "RIPEstat network-info + as-overview",
 	}
 
-	// Get network info
-	netInfo, err := r.client.GetNetworkInfo(ctx, ip)
+	asns, prefixCached, err := r.networkASNs(ctx, ip)
 	if err != nil {
 		result.Error = err.Error()
 		return result, nil
 	}
 
-	if len(netInfo.ASNs) == 0 {
+	if len(asns) == 0 {
 		result.Error = "no ASN found (not routed)"
+		result.Cached = prefixCached
 		return result, nil
 	}
 
-	result.ASNs = netInfo.ASNs
+	result.ASNs = asns
 
 	// Resolve holders for each ASN
 	var mu sync.Mutex
 	var wg sync.WaitGroup
-	holders := make([]string, 0, len(netInfo.ASNs))
-	allCached := true
+	holders := make([]string, 0, len(asns))
+	allCached := prefixCached
 
 	sem := make(chan struct{}, r.concurrency)
 
-	for _, asn := range netInfo.ASNs {
+	for _, asn := range asns {
 		// Check cache first
 		if r.cache != nil {
 			if holder, ok := r.cache.Get(asn); ok {
@@ -161,6 +257,77 @@ func (r *Resolver) resolveBGP(ctx context.Context, ip string) (*Result, error) {
 	return result, nil
 }
 
+// networkASNs returns the ASNs announcing ip, from the prefix cache when
+// a covering announced prefix is cached, otherwise via network-info.
+func (r *Resolver) networkASNs(ctx context.Context, ip string) ([]int, bool, error) {
+	addr, addrErr := netip.ParseAddr(ip)
+	if r.cache != nil && addrErr == nil {
+		if asns, ok := r.cache.GetPrefix(addr); ok {
+			return asns, true, nil
+		}
+	}
+
+	netInfo, err := r.client.GetNetworkInfo(ctx, ip)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if r.cache != nil && addrErr == nil {
+		if len(netInfo.ASNs) == 0 {
+			r.cache.SetNotRouted(notRoutedPrefix(addr, netInfo.Prefix))
+		} else if p, err := netip.ParsePrefix(netInfo.Prefix); err == nil && p.Contains(addr.Unmap()) {
+			r.cache.SetPrefix(p, netInfo.ASNs)
+		}
+	}
+	return netInfo.ASNs, false, nil
+}
+
+// notRoutedPrefix picks the range to cache as not routed: the prefix
+// network-info reported, or else the /24 (/48 for IPv6) around addr, the
+// longest prefixes commonly accepted in the global routing table.
+func notRoutedPrefix(addr netip.Addr, reported string) netip.Prefix {
+	addr = addr.Unmap()
+	if p, err := netip.ParsePrefix(reported); err == nil && p.Contains(addr) {
+		return p
+	}
+	bits := 24
+	if addr.Is6() {
+		bits = 48
+	}
+	p, _ := addr.Prefix(bits)
+	return p
+}
+
+// resolveAuto runs the fallback chain bgp -> whois -> off. Source names the
+// step that produced the answer; if every step fails the BGP error is kept.
+func (r *Resolver) resolveAuto(ctx context.Context, ip string, prefix string) (*Result, error) {
+	result, err := r.resolveBGP(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+	result.Mode = ModeAuto
+	if result.Error == "" && len(result.Holders) > 0 {
+		return result, nil
+	}
+
+	if result.Error == "" {
+		result.Error = "no holder found"
+	}
+
+	fallback, err := r.resolveWhois(ctx, prefix)
+	if err != nil || fallback.Error != "" {
+		if fallback != nil && fallback.Error != "" {
+			result.Error = fmt.Sprintf("%s; whois fallback: %s", result.Error, fallback.Error)
+		}
+		return result, nil
+	}
+
+	fallback.Mode = ModeAuto
+	fallback.ASNs = result.ASNs
+	fallback.Source += " (fallback from bgp)"
+	return fallback, nil
+}
+
 func (r *Resolver) resolveWhois(ctx context.Context, prefix string) (*Result, error) {
 	result := &Result{
 		Mode:   ModeWhois,
@@ -177,6 +344,101 @@ func (r *Resolver) resolveWhois(ctx context.Context, prefix string) (*Result, er
 	return result, nil
 }
 
+func (r *Resolver) resolveWhois43(ctx context.Context, ip string) (*Result, error) {
+	result := &Result{
+		Mode:   ModeWhois43,
+		Source: "whois (port 43)",
+	}
+
+	record, err := r.whois.Lookup(ctx, ip)
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+	result.Source = "whois (port 43) " + record.Server
+
+	if provider := record.Provider(); provider != "" {
+		result.Holders = []string{provider}
+	} else {
+		result.Error = fmt.Sprintf("no provider information found in whois for %s", ip)
+	}
+	return result, nil
+}
+
+func (r *Resolver) resolveLocal(ip string) (*Result, error) {
+	result := &Result{
+		Mode:   ModeLocal,
+		Source: "local ASN database",
+	}
+
+	if r.asnDB == nil {
+		result.Error = fmt.Sprintf("ASN database not available (run: ip2cc update --asn-db): %v", r.asnDBErr)
+		return result, nil
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	entry, ok := r.asnDB.Lookup(addr)
+	if !ok {
+		result.Error = "no ASN found (not routed)"
+		return result, nil
+	}
+
+	result.ASNs = []int{int(entry.ASN)}
+	if entry.Holder != "" {
+		result.Holders = []string{entry.Holder}
+	}
+	return result, nil
+}
+
+func (r *Resolver) resolveRDAP(ctx context.Context, prefix string) (*Result, error) {
+	result := &Result{
+		Mode:   ModeRDAP,
+		Source: "RDAP (rdap.org bootstrap)",
+	}
+
+	network, err := r.rdap.LookupIP(ctx, prefix)
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	// Prefer the registrant organization over the network name
+	switch {
+	case network.Registrant != "":
+		result.Holders = []string{network.Registrant}
+	case network.Name != "":
+		result.Holders = []string{network.Name}
+	default:
+		result.Error = fmt.Sprintf("no registrant found in RDAP for %s", prefix)
+	}
+	return result, nil
+}
+
+// MemoKey returns a key under which a result can be shared between lookups
+// of one run. Modes that only look at the matched prefix share results per
+// prefix; all others per IP.
+func (r *Resolver) MemoKey(ip string, matchedPrefix string) string {
+	switch r.mode {
+	case ModeWhois, ModeRDAP:
+		return "prefix:" + matchedPrefix
+	default:
+		return "ip:" + ip
+	}
+}
+
+// ImportCache merges ASN holder entries from serialized cache data.
+func (r *Resolver) ImportCache(data []byte) error {
+	if r.cache != nil {
+		return r.cache.Import(data)
+	}
+	return nil
+}
+
 // SaveCache persists the cache to disk.
 func (r *Resolver) SaveCache() error {
 	if r.cache != nil {
@@ -1,10 +1,13 @@
 package provider
 
 import (
+	"net/netip"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/hightemp/ip2cc/internal/config"
 )
 
 func TestParseMode(t *testing.T) {
@@ -16,6 +19,10 @@ func TestParseMode(t *testing.T) {
 		{"bgp", ModeBGP, false},
 		{"", ModeBGP, false},
 		{"whois", ModeWhois, false},
+		{"whois43", ModeWhois43, false},
+		{"rdap", ModeRDAP, false},
+		{"local", ModeLocal, false},
+		{"auto", ModeAuto, false},
 		{"off", ModeOff, false},
 		{"invalid", "", true},
 		{"BGP", "", true}, // Case sensitive
@@ -174,6 +181,28 @@ func TestCacheClear(t *testing.T) {
 	}
 }
 
+func TestCacheImport(t *testing.T) {
+	cache := NewCache("/nonexistent/path/cache.json", 7)
+	cache.Set(15169, "GOOGLE LLC")
+
+	future := time.Now().Add(time.Hour).Format(time.RFC3339)
+	data := []byte(`{
+		"15169": {"holder": "OTHER", "expires_at": "` + future + `"},
+		"13335": {"holder": "CLOUDFLARE INC", "expires_at": "` + future + `"}
+	}`)
+	if err := cache.Import(data); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	// Existing entries win
+	if holder, _ := cache.Get(15169); holder != "GOOGLE LLC" {
+		t.Errorf("Holder for 15169 = %q, expected GOOGLE LLC", holder)
+	}
+	if holder, ok := cache.Get(13335); !ok || holder != "CLOUDFLARE INC" {
+		t.Errorf("Holder for 13335 = %q, expected CLOUDFLARE INC", holder)
+	}
+}
+
 func TestCacheLoadNonexistent(t *testing.T) {
 	cache := NewCache("/nonexistent/path/cache.json", 7)
 	err := cache.Load()
@@ -212,3 +241,147 @@ func TestResultGetHolderString(t *testing.T) {
 		}
 	}
 }
+
+func TestCacheNotRouted(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cachePath := filepath.Join(tmpDir, "cache.json")
+	cache := NewCache(cachePath, 7)
+	cache.SetNotRouted(netip.MustParsePrefix("192.0.2.0/24"))
+
+	asns, ok := cache.GetPrefix(netip.MustParseAddr("192.0.2.77"))
+	if !ok || len(asns) != 0 {
+		t.Errorf("GetPrefix(192.0.2.77) = %v, %v, expected not-routed hit", asns, ok)
+	}
+	if _, ok := cache.GetPrefix(netip.MustParseAddr("192.0.3.1")); ok {
+		t.Error("GetPrefix(192.0.3.1) should miss")
+	}
+
+	// Survives a save/load round trip
+	cache.Save()
+	cache2 := NewCache(cachePath, 7)
+	if err := cache2.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if _, ok := cache2.GetPrefix(netip.MustParseAddr("192.0.2.1")); !ok {
+		t.Error("Loaded cache missing not-routed prefix")
+	}
+
+	// Negative entries expire on their own TTL
+	cache.SetNegativeTTL(0)
+	cache.SetNotRouted(netip.MustParsePrefix("198.51.100.0/24"))
+	time.Sleep(10 * time.Millisecond)
+	if _, ok := cache.GetPrefix(netip.MustParseAddr("198.51.100.1")); ok {
+		t.Error("Expected not-routed entry to be expired")
+	}
+}
+
+func TestCacheLoadLegacyFormat(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cachePath := filepath.Join(tmpDir, "cache.json")
+	future := time.Now().Add(time.Hour).Format(time.RFC3339)
+	os.WriteFile(cachePath, []byte(`{"15169": {"holder": "GOOGLE LLC", "expires_at": "`+future+`"}}`), 0644)
+
+	cache := NewCache(cachePath, 7)
+	if err := cache.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if holder, ok := cache.Get(15169); !ok || holder != "GOOGLE LLC" {
+		t.Errorf("Holder for 15169 = %q, expected GOOGLE LLC", holder)
+	}
+}
+
+func TestNotRoutedPrefix(t *testing.T) {
+	tests := []struct {
+		ip       string
+		reported string
+		expected string
+	}{
+		{"192.0.2.77", "", "192.0.2.0/24"},
+		{"192.0.2.77", "192.0.0.0/16", "192.0.0.0/16"},
+		{"192.0.2.77", "10.0.0.0/8", "192.0.2.0/24"}, // does not contain the IP
+		{"2001:db8:1:2::1", "", "2001:db8:1::/48"},
+	}
+
+	for _, tc := range tests {
+		got := notRoutedPrefix(netip.MustParseAddr(tc.ip), tc.reported)
+		if got.String() != tc.expected {
+			t.Errorf("notRoutedPrefix(%s, %q) = %s, expected %s", tc.ip, tc.reported, got, tc.expected)
+		}
+	}
+}
+
+func TestCachePrefixLongestMatch(t *testing.T) {
+	cache := NewCache("/nonexistent/path/cache.json", 7)
+	cache.SetPrefix(netip.MustParsePrefix("8.0.0.0/8"), []int{3356})
+	cache.SetPrefix(netip.MustParsePrefix("8.8.8.0/24"), []int{15169})
+	cache.SetPrefix(netip.MustParsePrefix("2001:4860::/32"), []int{15169})
+
+	tests := []struct {
+		ip       string
+		expected int
+	}{
+		{"8.8.8.8", 15169},
+		{"8.1.2.3", 3356},
+		{"::ffff:8.8.8.8", 15169},
+		{"2001:4860:4860::8888", 15169},
+	}
+
+	for _, tc := range tests {
+		asns, ok := cache.GetPrefix(netip.MustParseAddr(tc.ip))
+		if !ok || len(asns) != 1 || asns[0] != tc.expected {
+			t.Errorf("GetPrefix(%s) = %v, %v, expected [%d]", tc.ip, asns, ok, tc.expected)
+		}
+	}
+
+	if _, ok := cache.GetPrefix(netip.MustParseAddr("9.9.9.9")); ok {
+		t.Error("GetPrefix(9.9.9.9) should miss")
+	}
+}
+
+func TestNewResolverOptions(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cachePath := filepath.Join(tmpDir, "custom", "providers.json")
+	os.MkdirAll(filepath.Dir(cachePath), 0755)
+
+	r := NewResolver(ModeBGP, Options{CacheDir: tmpDir, UseCache: true, CachePath: cachePath, CacheTTL: time.Hour})
+	r.cache.Set(15169, "GOOGLE LLC")
+	if err := r.SaveCache(); err != nil {
+		t.Fatalf("SaveCache failed: %v", err)
+	}
+	if _, err := os.Stat(cachePath); err != nil {
+		t.Errorf("cache not written to %s: %v", cachePath, err)
+	}
+
+	r.cache.mu.RLock()
+	expires := r.cache.entries[15169].ExpiresAt
+	r.cache.mu.RUnlock()
+	if until := time.Until(expires); until > time.Hour || until < 59*time.Minute {
+		t.Errorf("entry expires in %v, expected about 1h", until)
+	}
+}
+
+func TestNewResolverConcurrency(t *testing.T) {
+	r := NewResolver(ModeOff, Options{})
+	if r.concurrency != config.DefaultProviderLookupConcurrency {
+		t.Errorf("concurrency = %d, expected %d", r.concurrency, config.DefaultProviderLookupConcurrency)
+	}
+	r = NewResolver(ModeOff, Options{Concurrency: 16})
+	if r.concurrency != 16 {
+		t.Errorf("concurrency = %d, expected 16", r.concurrency)
+	}
+}
@@ -0,0 +1,238 @@
+// Package rawstore stores raw per-country API responses kept with --keep-raw.
+package rawstore
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/config"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Format selects how raw responses are stored.
+type Format string
+
+const (
+	// FormatJSON stores plain <cc>.json files in the raw directory.
+	FormatJSON Format = "json"
+	// FormatGzip stores gzip-compressed <cc>.json.gz files in the raw directory.
+	FormatGzip Format = "gzip"
+	// FormatTarZstd stores all responses in a single zstd-compressed tar archive.
+	FormatTarZstd Format = "tar.zst"
+)
+
+// ParseFormat parses a raw format string.
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case FormatJSON, FormatGzip, FormatTarZstd:
+		return Format(s), nil
+	case "":
+		return FormatGzip, nil
+	default:
+		return "", fmt.Errorf("invalid raw format: %s (use gzip, tar.zst, or json)", s)
+	}
+}
+
+// Writer stores raw responses for one snapshot.
+type Writer interface {
+	// Write stores the raw response for a country.
+	Write(countryCode string, data []byte) error
+	// Close flushes and closes the underlying files.
+	Close() error
+}
+
+// NewWriter creates a writer storing raw responses for the snapshot in snapshotDir.
+func NewWriter(snapshotDir string, format Format) (Writer, error) {
+	switch format {
+	case FormatTarZstd:
+		return newTarWriter(config.RawArchivePath(snapshotDir))
+	case FormatJSON, FormatGzip:
+		dir := config.RawDir(snapshotDir)
+		if err := config.EnsureDir(dir); err != nil {
+			return nil, err
+		}
+		return &fileWriter{dir: dir, gzip: format == FormatGzip}, nil
+	default:
+		return nil, fmt.Errorf("invalid raw format: %s", format)
+	}
+}
+
+// fileWriter writes one file per country.
+type fileWriter struct {
+	dir  string
+	gzip bool
+}
+
+func (w *fileWriter) Write(countryCode string, data []byte) error {
+	name := strings.ToLower(countryCode) + ".json"
+	if !w.gzip {
+		return os.WriteFile(filepath.Join(w.dir, name), data, 0644)
+	}
+
+	f, err := os.Create(filepath.Join(w.dir, name+".gz"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zw := gzip.NewWriter(f)
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (w *fileWriter) Close() error {
+	return nil
+}
+
+// tarWriter appends every country to a single tar.zst archive.
+type tarWriter struct {
+	mu sync.Mutex
+	f  *os.File
+	zw *zstd.Encoder
+	tw *tar.Writer
+}
+
+func newTarWriter(path string) (*tarWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	zw, err := zstd.NewWriter(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &tarWriter{f: f, zw: zw, tw: tar.NewWriter(zw)}, nil
+}
+
+func (w *tarWriter) Write(countryCode string, data []byte) error {
+	return w.add(countryCode, int64(len(data)), bytes.NewReader(data))
+}
+
+// add copies size bytes from r into the archive entry of a country.
+func (w *tarWriter) add(countryCode string, size int64, r io.Reader) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	header := &tar.Header{
+		Name:    strings.ToLower(countryCode) + ".json",
+		Mode:    0644,
+		Size:    size,
+		ModTime: time.Now(),
+	}
+	if err := w.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := io.CopyN(w.tw, r, size)
+	return err
+}
+
+func (w *tarWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.tw.Close(); err != nil {
+		w.f.Close()
+		return err
+	}
+	if err := w.zw.Close(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+// Read calls fn for every raw response stored for the snapshot, in any
+// of the supported formats. Country codes are passed in lowercase.
+func Read(snapshotDir string, fn func(countryCode string, data []byte) error) error {
+	if f, err := os.Open(config.RawArchivePath(snapshotDir)); err == nil {
+		defer f.Close()
+		return readTar(f, fn)
+	}
+
+	entries, err := os.ReadDir(config.RawDir(snapshotDir))
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := filepath.Join(config.RawDir(snapshotDir), name)
+		var data []byte
+		switch {
+		case strings.HasSuffix(name, ".json.gz"):
+			data, err = readGzip(path)
+		case strings.HasSuffix(name, ".json"):
+			data, err = os.ReadFile(path)
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("read %s: %w", name, err)
+		}
+		cc := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ".json")
+		if err := fn(cc, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readGzip(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+func readTar(r io.Reader, fn func(countryCode string, data []byte) error) error {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	tr := tar.NewReader(zr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		if err := fn(strings.TrimSuffix(header.Name, ".json"), data); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package rawstore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hightemp/ip2cc/internal/config"
+)
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Format
+		hasError bool
+	}{
+		{"gzip", FormatGzip, false},
+		{"", FormatGzip, false},
+		{"tar.zst", FormatTarZstd, false},
+		{"json", FormatJSON, false},
+		{"zip", "", true},
+	}
+
+	for _, tc := range tests {
+		format, err := ParseFormat(tc.input)
+		if tc.hasError {
+			if err == nil {
+				t.Errorf("ParseFormat(%q) expected error", tc.input)
+			}
+			continue
+		}
+		if err != nil || format != tc.expected {
+			t.Errorf("ParseFormat(%q) = %q, %v, expected %q", tc.input, format, err, tc.expected)
+		}
+	}
+}
+
+func TestWriteAndRead(t *testing.T) {
+	responses := map[string]string{
+		"us": `{"resources":{"ipv4":["8.8.8.0/24"]}}`,
+		"de": `{"resources":{"ipv4":["5.1.0.0/16"]}}`,
+	}
+
+	for _, format := range []Format{FormatJSON, FormatGzip, FormatTarZstd} {
+		t.Run(string(format), func(t *testing.T) {
+			tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(tmpDir)
+
+			w, err := NewWriter(tmpDir, format)
+			if err != nil {
+				t.Fatalf("NewWriter failed: %v", err)
+			}
+			for cc, data := range responses {
+				if err := w.Write(cc, []byte(data)); err != nil {
+					t.Fatalf("Write failed: %v", err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			got := make(map[string]string)
+			err = Read(tmpDir, func(cc string, data []byte) error {
+				got[cc] = string(data)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			if len(got) != len(responses) {
+				t.Fatalf("Read %d countries, expected %d", len(got), len(responses))
+			}
+			for cc, data := range responses {
+				if got[cc] != data {
+					t.Errorf("Data for %s = %q, expected %q", cc, got[cc], data)
+				}
+			}
+		})
+	}
+}
+
+func TestGzipFileNames(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	w, _ := NewWriter(tmpDir, FormatGzip)
+	w.Write("US", []byte("{}"))
+	w.Close()
+
+	if _, err := os.Stat(filepath.Join(config.RawDir(tmpDir), "us.json.gz")); err != nil {
+		t.Errorf("Expected us.json.gz: %v", err)
+	}
+}
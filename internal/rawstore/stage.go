@@ -0,0 +1,181 @@
+package rawstore
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hightemp/ip2cc/internal/config"
+)
+
+// Stage collects raw responses on disk while they are downloaded, before
+// the snapshot directory exists, so they never have to be held in memory.
+// Commit copies them into a snapshot in the stage's format.
+type Stage struct {
+	dir    string
+	format Format
+}
+
+// NewStage creates a staging directory below parentDir.
+func NewStage(parentDir string, format Format) (*Stage, error) {
+	if err := config.EnsureDir(parentDir); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(parentDir, ".raw-*")
+	if err != nil {
+		return nil, err
+	}
+	return &Stage{dir: dir, format: format}, nil
+}
+
+// OpenStage opens the staging directory dir, creating it if needed. Unlike
+// with NewStage, the responses staged in dir by an earlier, interrupted
+// run are kept.
+func OpenStage(dir string, format Format) (*Stage, error) {
+	if err := config.EnsureDir(dir); err != nil {
+		return nil, err
+	}
+	return &Stage{dir: dir, format: format}, nil
+}
+
+func (s *Stage) path(countryCode string) string {
+	name := strings.ToLower(countryCode) + ".json"
+	if s.format == FormatGzip {
+		name += ".gz"
+	}
+	return filepath.Join(s.dir, name)
+}
+
+// Create opens the staged response of a country for writing, replacing
+// anything staged for it before.
+func (s *Stage) Create(countryCode string) (io.WriteCloser, error) {
+	f, err := os.Create(s.path(countryCode))
+	if err != nil {
+		return nil, err
+	}
+	if s.format != FormatGzip {
+		return f, nil
+	}
+	return &gzipFile{Writer: gzip.NewWriter(f), f: f}, nil
+}
+
+// Write stages a complete response.
+func (s *Stage) Write(countryCode string, data []byte) error {
+	w, err := s.Create(countryCode)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// Discard removes the staged response of a country, e.g. after a failed download.
+func (s *Stage) Discard(countryCode string) {
+	os.Remove(s.path(countryCode))
+}
+
+// Commit copies the staged responses into snapshotDir, as hard links where
+// possible. The stage keeps them until Remove.
+func (s *Stage) Commit(snapshotDir string) error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+
+	if s.format != FormatTarZstd {
+		return s.commitFiles(config.RawDir(snapshotDir), names)
+	}
+
+	w, err := newTarWriter(config.RawArchivePath(snapshotDir))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := addFile(w, filepath.Join(s.dir, name)); err != nil {
+			w.Close()
+			return fmt.Errorf("archive %s: %w", name, err)
+		}
+	}
+	return w.Close()
+}
+
+// Remove deletes the stage and anything left in it.
+func (s *Stage) Remove() error {
+	return os.RemoveAll(s.dir)
+}
+
+// commitFiles replaces rawDir with the staged files.
+func (s *Stage) commitFiles(rawDir string, names []string) error {
+	if err := os.RemoveAll(rawDir); err != nil {
+		return err
+	}
+	if err := config.EnsureDir(rawDir); err != nil {
+		return err
+	}
+	for _, name := range names {
+		src, dst := filepath.Join(s.dir, name), filepath.Join(rawDir, name)
+		if os.Link(src, dst) == nil {
+			continue
+		}
+		if err := copyFile(src, dst); err != nil {
+			return fmt.Errorf("copy %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func addFile(w *tarWriter, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return w.add(strings.TrimSuffix(filepath.Base(path), ".json"), info.Size(), f)
+}
+
+// gzipFile compresses into a file and closes both on Close.
+type gzipFile struct {
+	*gzip.Writer
+	f *os.File
+}
+
+func (g *gzipFile) Close() error {
+	if err := g.Writer.Close(); err != nil {
+		g.f.Close()
+		return err
+	}
+	return g.f.Close()
+}
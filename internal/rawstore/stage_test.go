@@ -0,0 +1,112 @@
+package rawstore
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStageCommit(t *testing.T) {
+	for _, format := range []Format{FormatJSON, FormatGzip, FormatTarZstd} {
+		t.Run(string(format), func(t *testing.T) {
+			tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(tmpDir)
+
+			stage, err := NewStage(tmpDir, format)
+			if err != nil {
+				t.Fatalf("NewStage failed: %v", err)
+			}
+			defer stage.Remove()
+
+			// A retried download replaces the partial response
+			w, err := stage.Create("US")
+			if err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+			io.WriteString(w, `{"partial`)
+			w.Close()
+			w, _ = stage.Create("US")
+			io.WriteString(w, `{"resources":{}}`)
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			stage.Write("de", []byte(`{}`))
+			stage.Write("fr", []byte(`{"partial`))
+			stage.Discard("fr")
+
+			snapshotDir := filepath.Join(tmpDir, "2024-01-15")
+			if err := os.Mkdir(snapshotDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := stage.Commit(snapshotDir); err != nil {
+				t.Fatalf("Commit failed: %v", err)
+			}
+
+			got := make(map[string]string)
+			err = Read(snapshotDir, func(cc string, data []byte) error {
+				got[cc] = string(data)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			expected := map[string]string{"us": `{"resources":{}}`, "de": `{}`}
+			if len(got) != len(expected) {
+				t.Fatalf("Read %v, expected %v", got, expected)
+			}
+			for cc, data := range expected {
+				if got[cc] != data {
+					t.Errorf("Data for %s = %q, expected %q", cc, got[cc], data)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenStageKeepsResponses(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	stageDir := filepath.Join(tmpDir, "raw")
+	stage, err := OpenStage(stageDir, FormatJSON)
+	if err != nil {
+		t.Fatalf("OpenStage failed: %v", err)
+	}
+	stage.Write("nl", []byte(`{"nl"}`))
+
+	// A resumed run adds to what the interrupted one staged
+	stage, err = OpenStage(stageDir, FormatJSON)
+	if err != nil {
+		t.Fatalf("OpenStage failed: %v", err)
+	}
+	stage.Write("de", []byte(`{"de"}`))
+
+	snapshotDir := filepath.Join(tmpDir, "2024-01-15")
+	if err := os.Mkdir(snapshotDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := stage.Commit(snapshotDir); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	count := 0
+	Read(snapshotDir, func(cc string, data []byte) error {
+		count++
+		return nil
+	})
+	if count != 2 {
+		t.Errorf("Read %d responses, expected 2", count)
+	}
+	// The stage keeps its responses until removed
+	if _, err := os.Stat(filepath.Join(stageDir, "nl.json")); err != nil {
+		t.Errorf("Staged response removed by Commit: %v", err)
+	}
+}
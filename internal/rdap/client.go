@@ -0,0 +1,197 @@
+// Package rdap provides a minimal RDAP (RFC 9082/9083) client for IP network lookups.
+package rdap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/config"
+)
+
+const (
+	// BootstrapURL is the rdap.org bootstrap service, which redirects each
+	// query to the RDAP server of the responsible RIR.
+	BootstrapURL = "https://rdap.org"
+
+	// DefaultTimeout for HTTP requests, including redirects.
+	DefaultTimeout = 30 * time.Second
+)
+
+// Client is an HTTP client for RDAP servers.
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+}
+
+// NewClient creates a new RDAP client using the rdap.org bootstrap service.
+func NewClient() *Client {
+	return &Client{
+		httpClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+		baseURL: BootstrapURL,
+	}
+}
+
+// Network is the parsed result of an IP network query.
+type Network struct {
+	Handle       string
+	Name         string
+	Country      string
+	StartAddress string
+	EndAddress   string
+	// Registrant is the organization the network is registered to, taken
+	// from the registrant entity (or the first entity carrying a name).
+	Registrant string
+	// Port43 is the whois server of the registry that answered.
+	Port43 string
+	// Geofeed is the URL of the operator's geolocation feed, from a
+	// "Geofeed" remark of the network (RFC 9632), if any.
+	Geofeed string
+}
+
+// ipNetwork is the RDAP IP network object.
+type ipNetwork struct {
+	Handle       string   `json:"handle"`
+	Name         string   `json:"name"`
+	Country      string   `json:"country"`
+	StartAddress string   `json:"startAddress"`
+	EndAddress   string   `json:"endAddress"`
+	Port43       string   `json:"port43"`
+	Entities     []entity `json:"entities"`
+	Remarks      []remark `json:"remarks"`
+}
+
+// remark is an RDAP remark, whose description holds lines of text.
+type remark struct {
+	Title       string   `json:"title"`
+	Description []string `json:"description"`
+}
+
+// entity is an RDAP entity object with its jCard.
+type entity struct {
+	Handle     string          `json:"handle"`
+	Roles      []string        `json:"roles"`
+	VCardArray json.RawMessage `json:"vcardArray"`
+	Entities   []entity        `json:"entities"`
+}
+
+// LookupIP queries the network containing resource, an IP address or CIDR prefix.
+func (c *Client) LookupIP(ctx context.Context, resource string) (*Network, error) {
+	url := fmt.Sprintf("%s/ip/%s", c.baseURL, resource)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/rdap+json")
+	req.Header.Set("User-Agent", config.AppName+"/1.0")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("rdap query for %s: %w", resource, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("rdap query for %s: HTTP %d: %s", resource, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var data ipNetwork
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("decode rdap response: %w", err)
+	}
+
+	return &Network{
+		Handle:       data.Handle,
+		Name:         data.Name,
+		Country:      data.Country,
+		StartAddress: data.StartAddress,
+		EndAddress:   data.EndAddress,
+		Registrant:   registrant(data.Entities),
+		Port43:       data.Port43,
+		Geofeed:      geofeedURL(data.Remarks),
+	}, nil
+}
+
+// geofeedURL returns the URL of the first "Geofeed https://..." remark line.
+func geofeedURL(remarks []remark) string {
+	for _, r := range remarks {
+		for _, line := range r.Description {
+			fields := strings.Fields(line)
+			if len(fields) == 2 && strings.EqualFold(strings.TrimSuffix(fields[0], ":"), "geofeed") && strings.HasPrefix(fields[1], "https://") {
+				return fields[1]
+			}
+		}
+	}
+	return ""
+}
+
+// registrant returns the name of the registrant entity, falling back to
+// the first named entity that is not a contact role.
+func registrant(entities []entity) string {
+	fallback := ""
+	for _, e := range entities {
+		name := e.name()
+		if name == "" {
+			continue
+		}
+		for _, role := range e.Roles {
+			if role == "registrant" {
+				return name
+			}
+		}
+		if fallback == "" && !e.isContact() {
+			fallback = name
+		}
+	}
+	return fallback
+}
+
+func (e *entity) isContact() bool {
+	for _, role := range e.Roles {
+		switch role {
+		case "abuse", "technical", "administrative", "noc":
+		default:
+			return false
+		}
+	}
+	return len(e.Roles) > 0
+}
+
+// name extracts the "fn" (or "org") property of the entity's jCard:
+// ["vcard", [["version", {}, "text", "4.0"], ["fn", {}, "text", "Name"], ...]]
+func (e *entity) name() string {
+	var card []json.RawMessage
+	if err := json.Unmarshal(e.VCardArray, &card); err != nil || len(card) != 2 {
+		return ""
+	}
+	var props [][]json.RawMessage
+	if err := json.Unmarshal(card[1], &props); err != nil {
+		return ""
+	}
+
+	values := make(map[string]string)
+	for _, prop := range props {
+		if len(prop) < 4 {
+			continue
+		}
+		var key, value string
+		if json.Unmarshal(prop[0], &key) != nil || json.Unmarshal(prop[3], &value) != nil {
+			continue
+		}
+		if _, ok := values[key]; !ok {
+			values[key] = value
+		}
+	}
+
+	if values["org"] != "" {
+		return values["org"]
+	}
+	return values["fn"]
+}
@@ -0,0 +1,81 @@
+package rdap
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const arinResponse = `{
+  "objectClassName": "ip network",
+  "handle": "NET-8-8-8-0-2",
+  "startAddress": "8.8.8.0",
+  "endAddress": "8.8.8.255",
+  "name": "GOGL",
+  "port43": "whois.arin.net",
+  "remarks": [
+    {"title": "Registration Comments", "description": ["Geofeed https://www.gstatic.com/geofeed/corp_external"]}
+  ],
+  "entities": [
+    {
+      "handle": "ABUSE5250-ARIN",
+      "roles": ["abuse"],
+      "vcardArray": ["vcard", [["version", {}, "text", "4.0"], ["fn", {}, "text", "Abuse"]]]
+    },
+    {
+      "handle": "GOGL",
+      "roles": ["registrant"],
+      "vcardArray": ["vcard", [["version", {}, "text", "4.0"], ["fn", {}, "text", "Google LLC"], ["kind", {}, "text", "org"]]]
+    }
+  ]
+}`
+
+func TestLookupIP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// rdap.org answers with a redirect to the responsible registry
+		if r.URL.Path == "/ip/8.8.8.0/24" {
+			http.Redirect(w, r, "/registry/ip/8.8.8.0/24", http.StatusFound)
+			return
+		}
+		if r.URL.Path != "/registry/ip/8.8.8.0/24" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/rdap+json")
+		w.Write([]byte(arinResponse))
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	client.baseURL = server.URL
+
+	network, err := client.LookupIP(context.Background(), "8.8.8.0/24")
+	if err != nil {
+		t.Fatalf("LookupIP failed: %v", err)
+	}
+	if network.Registrant != "Google LLC" {
+		t.Errorf("Registrant = %q, expected %q", network.Registrant, "Google LLC")
+	}
+	if network.Name != "GOGL" || network.Port43 != "whois.arin.net" {
+		t.Errorf("Name/Port43 = %q/%q, expected GOGL/whois.arin.net", network.Name, network.Port43)
+	}
+	if network.Geofeed != "https://www.gstatic.com/geofeed/corp_external" {
+		t.Errorf("Geofeed = %q, expected the remark's URL", network.Geofeed)
+	}
+
+	if _, err := client.LookupIP(context.Background(), "10.0.0.0/8"); err == nil {
+		t.Error("LookupIP should fail for unknown network")
+	}
+}
+
+func TestRegistrantFallback(t *testing.T) {
+	entities := []entity{
+		{Roles: []string{"abuse"}, VCardArray: []byte(`["vcard", [["fn", {}, "text", "Abuse Desk"]]]`)},
+		{Roles: []string{"administrative", "technical"}, VCardArray: []byte(`["vcard", [["fn", {}, "text", "NOC"]]]`)},
+		{Roles: []string{"sponsor"}, VCardArray: []byte(`["vcard", [["fn", {}, "text", "Person"], ["org", {}, "text", "Example Org"]]]`)},
+	}
+	if got := registrant(entities); got != "Example Org" {
+		t.Errorf("registrant() = %q, expected %q", got, "Example Org")
+	}
+}
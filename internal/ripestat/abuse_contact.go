@@ -0,0 +1,45 @@
+package ripestat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// AbuseContactFinderData is the response data from abuse-contact-finder endpoint.
+type AbuseContactFinderData struct {
+	AbuseContacts    []string `json:"abuse_contacts"`
+	AuthoritativeRIR string   `json:"authoritative_rir"`
+	QueryTime        string   `json:"query_time"`
+}
+
+// AbuseContactResult contains the result of an abuse contact query.
+type AbuseContactResult struct {
+	Resource         string
+	Contacts         []string
+	AuthoritativeRIR string
+}
+
+// GetAbuseContacts fetches the abuse contact email addresses registered for
+// an IP address, prefix or ASN.
+func (c *Client) GetAbuseContacts(ctx context.Context, resource string) (*AbuseContactResult, error) {
+	params := url.Values{}
+	params.Set("resource", resource)
+
+	resp, err := c.Get(ctx, "abuse-contact-finder", params)
+	if err != nil {
+		return nil, fmt.Errorf("get abuse-contact-finder for %s: %w", resource, err)
+	}
+
+	var data AbuseContactFinderData
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		return nil, fmt.Errorf("decode abuse-contact-finder data: %w", err)
+	}
+
+	return &AbuseContactResult{
+		Resource:         resource,
+		Contacts:         data.AbuseContacts,
+		AuthoritativeRIR: data.AuthoritativeRIR,
+	}, nil
+}
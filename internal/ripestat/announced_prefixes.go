@@ -0,0 +1,57 @@
+package ripestat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// AnnouncedPrefixesData is the response data from announced-prefixes endpoint.
+type AnnouncedPrefixesData struct {
+	Prefixes []struct {
+		Prefix    string `json:"prefix"`
+		Timelines []struct {
+			StartTime string `json:"starttime"`
+			EndTime   string `json:"endtime"`
+		} `json:"timelines"`
+	} `json:"prefixes"`
+	QueryStartTime string `json:"query_starttime"`
+	QueryEndTime   string `json:"query_endtime"`
+	Resource       string `json:"resource"`
+}
+
+// AnnouncedPrefixesResult contains the result of an announced prefixes query.
+type AnnouncedPrefixesResult struct {
+	ASN      int
+	Prefixes []string
+	// QueryEndTime is the end of the window the prefixes were seen in.
+	QueryEndTime string
+}
+
+// GetAnnouncedPrefixes fetches the prefixes an ASN has announced recently
+// (RIPEstat's default window is the last two weeks).
+func (c *Client) GetAnnouncedPrefixes(ctx context.Context, asn int) (*AnnouncedPrefixesResult, error) {
+	params := url.Values{}
+	params.Set("resource", fmt.Sprintf("AS%d", asn))
+
+	resp, err := c.Get(ctx, "announced-prefixes", params)
+	if err != nil {
+		return nil, fmt.Errorf("get announced-prefixes for AS%d: %w", asn, err)
+	}
+
+	var data AnnouncedPrefixesData
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		return nil, fmt.Errorf("decode announced-prefixes data: %w", err)
+	}
+
+	result := &AnnouncedPrefixesResult{
+		ASN:          asn,
+		Prefixes:     make([]string, 0, len(data.Prefixes)),
+		QueryEndTime: data.QueryEndTime,
+	}
+	for _, p := range data.Prefixes {
+		result.Prefixes = append(result.Prefixes, p.Prefix)
+	}
+	return result, nil
+}
@@ -2,13 +2,16 @@
 package ripestat
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/hightemp/ip2cc/internal/config"
@@ -38,26 +41,44 @@ type Client struct {
 	baseURL    string
 }
 
+// Option configures a Client.
+type Option func(*Client)
+
+// WithBaseURL points the client at a different Data API endpoint, such as
+// a caching proxy or an internal mirror. An empty URL keeps the default.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		if baseURL != "" {
+			c.baseURL = strings.TrimSuffix(baseURL, "/")
+		}
+	}
+}
+
+// WithTimeout sets the HTTP request timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.httpClient.Timeout = timeout
+	}
+}
+
 // NewClient creates a new RIPEstat client.
-func NewClient() *Client {
-	return &Client{
+func NewClient(opts ...Option) *Client {
+	c := &Client{
 		httpClient: &http.Client{
 			Timeout: DefaultTimeout,
 		},
 		sourceApp: config.RIPEstatSourceApp,
 		baseURL:   BaseURL,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 // NewClientWithTimeout creates a new RIPEstat client with custom timeout.
 func NewClientWithTimeout(timeout time.Duration) *Client {
-	return &Client{
-		httpClient: &http.Client{
-			Timeout: timeout,
-		},
-		sourceApp: config.RIPEstatSourceApp,
-		baseURL:   BaseURL,
-	}
+	return NewClient(WithTimeout(timeout))
 }
 
 // Response is the generic RIPEstat API response wrapper.
@@ -76,10 +97,39 @@ type Response struct {
 	ServerID       string          `json:"server_id"`
 	BuildVersion   string          `json:"build_version"`
 	Time           string          `json:"time"`
+
+	// ETag and LastModified are the cache validators sent with the response.
+	ETag         string `json:"-"`
+	LastModified string `json:"-"`
 }
 
-// Get performs a GET request to the specified endpoint with retries.
+// Get performs a GET request to the specified endpoint. Transient failures
+// (see IsTemporary) are retried with exponential backoff, or after the
+// server's Retry-After delay when one is given; permanent failures are
+// returned immediately.
 func (c *Client) Get(ctx context.Context, endpoint string, params url.Values) (*Response, error) {
+	return c.get(ctx, endpoint, params, requestOptions{})
+}
+
+// requestOptions extends a Get request.
+type requestOptions struct {
+	// header holds extra request headers.
+	header http.Header
+	// data, if set, receives the decoded "data" field instead of Response.Data.
+	data interface{}
+	// raw, if set, opens a writer that receives the raw response body while
+	// it is decoded. It is called again for every attempt.
+	raw func() (io.WriteCloser, error)
+}
+
+// envelope is a Response whose data is decoded into a caller-provided value.
+type envelope struct {
+	Response
+	Data interface{} `json:"data"`
+}
+
+// get is Get with request options.
+func (c *Client) get(ctx context.Context, endpoint string, params url.Values, opts requestOptions) (*Response, error) {
 	if params == nil {
 		params = url.Values{}
 	}
@@ -91,6 +141,10 @@ func (c *Client) Get(ctx context.Context, endpoint string, params url.Values) (*
 	for attempt := 0; attempt <= MaxRetries; attempt++ {
 		if attempt > 0 {
 			backoff := c.calculateBackoff(attempt)
+			var statusErr *StatusError
+			if errors.As(lastErr, &statusErr) && statusErr.RetryAfter > 0 {
+				backoff = statusErr.RetryAfter
+			}
 			select {
 			case <-ctx.Done():
 				return nil, ctx.Err()
@@ -98,7 +152,7 @@ func (c *Client) Get(ctx context.Context, endpoint string, params url.Values) (*
 			}
 		}
 
-		resp, err := c.doRequest(ctx, fullURL)
+		resp, err := c.doRequest(ctx, fullURL, opts)
 		if err == nil {
 			return resp, nil
 		}
@@ -108,19 +162,28 @@ func (c *Client) Get(ctx context.Context, endpoint string, params url.Values) (*
 		if ctx.Err() != nil {
 			return nil, ctx.Err()
 		}
+		if !IsTemporary(err) {
+			return nil, err
+		}
 	}
 
 	return nil, fmt.Errorf("after %d retries: %w", MaxRetries, lastErr)
 }
 
-func (c *Client) doRequest(ctx context.Context, url string) (*Response, error) {
+func (c *Client) doRequest(ctx context.Context, url string, opts requestOptions) (*Response, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
+	for key, values := range opts.header {
+		req.Header[key] = values
+	}
 
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("User-Agent", "ip2cc/1.0")
+	// Set explicitly (which disables the transport's transparent
+	// decompression) so that proxies and mirrors also compress responses.
+	req.Header.Set("Accept-Encoding", "gzip")
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -128,25 +191,68 @@ func (c *Client) doRequest(ctx context.Context, url string) (*Response, error) {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, ErrNotModified
+	}
+
+	var reader io.Reader = resp.Body
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("decompress body: %w", err)
+		}
+		defer zr.Close()
+		reader = zr
+	}
+
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+		body, _ := io.ReadAll(reader)
+		return nil, &StatusError{
+			StatusCode: resp.StatusCode,
+			Message:    string(body),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
 	}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("read body: %w", err)
+	var raw io.WriteCloser
+	if opts.raw != nil {
+		if raw, err = opts.raw(); err != nil {
+			return nil, fmt.Errorf("open raw output: %w", err)
+		}
+		defer raw.Close()
+		reader = io.TeeReader(reader, raw)
 	}
 
-	var result Response
-	if err := json.Unmarshal(body, &result); err != nil {
+	// Decode from the stream so that large responses are never held in
+	// memory as a whole in addition to the decoded data
+	env := envelope{Data: opts.data}
+	if opts.data == nil {
+		env.Data = &env.Response.Data
+	}
+	if err := json.NewDecoder(reader).Decode(&env); err != nil {
 		return nil, fmt.Errorf("decode response: %w", err)
 	}
+	result := env.Response
+
+	if raw != nil {
+		// Pass trailing whitespace through to the raw output
+		if _, err := io.Copy(io.Discard, reader); err != nil {
+			return nil, fmt.Errorf("read body: %w", err)
+		}
+		if err := raw.Close(); err != nil {
+			return nil, fmt.Errorf("write raw output: %w", err)
+		}
+	}
 
 	if result.Status != "ok" {
-		return nil, fmt.Errorf("API error: status=%s, messages=%v", result.Status, result.Messages)
+		return nil, &StatusError{
+			StatusCode: result.StatusCode,
+			Message:    fmt.Sprintf("API error: status=%s, messages=%v", result.Status, result.Messages),
+		}
 	}
 
+	result.ETag = resp.Header.Get("ETag")
+	result.LastModified = resp.Header.Get("Last-Modified")
 	return &result, nil
 }
 
@@ -1,8 +1,12 @@
 package ripestat
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -156,3 +160,347 @@ func TestCalculateBackoff(t *testing.T) {
 		t.Errorf("Backoff exceeded max: %v > %v", b10, MaxBackoff)
 	}
 }
+
+func TestGetCountryResourceListEarliest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("time"); got != EarliestQueryTime {
+			t.Errorf("time = %q, expected %q", got, EarliestQueryTime)
+		}
+		resp := Response{
+			Status: "ok",
+			Data:   json.RawMessage(`{"resources":{"ipv4":["193.0.0.0/21"],"ipv6":[]},"query_time":"2003-11-25T00:00:00","resource":"nl"}`),
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	client.baseURL = server.URL
+
+	result, err := client.GetCountryResourceList(context.Background(), "nl", EarliestQueryTime)
+	if err != nil {
+		t.Fatalf("GetCountryResourceList failed: %v", err)
+	}
+	if result.QueryTime != "2003-11-25T00:00:00" {
+		t.Errorf("QueryTime = %s, expected 2003-11-25T00:00:00", result.QueryTime)
+	}
+	if result.CountryCode != "NL" || len(result.IPv4) != 1 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+}
+
+func TestGetCountryResourceListEarliestWithoutQueryTime(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := Response{
+			Status: "ok",
+			Data:   json.RawMessage(`{"resources":{"ipv4":["193.0.0.0/21"],"ipv6":[]},"resource":"nl"}`),
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	client.baseURL = server.URL
+
+	// Without query_time the date of the earliest data is unknown
+	if _, err := client.GetCountryResourceList(context.Background(), "nl", EarliestQueryTime); err == nil {
+		t.Error("GetCountryResourceList succeeded without query_time, expected an error")
+	}
+	if _, err := client.GetCountryResourceList(context.Background(), "nl", ""); err != nil {
+		t.Errorf("GetCountryResourceList for the latest data failed: %v", err)
+	}
+}
+
+func TestClientGetGzip(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Accept-Encoding"); got != "gzip" {
+			t.Errorf("Accept-Encoding = %q, expected gzip", got)
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		json.NewEncoder(zw).Encode(Response{
+			Status: "ok",
+			Data:   json.RawMessage(`{"resources":{"ipv4":["193.0.0.0/21"],"ipv6":["2001:67c::/32"]},"resource":"nl"}`),
+		})
+		zw.Close()
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	client.baseURL = server.URL
+
+	result, err := client.GetCountryResourceList(context.Background(), "nl", "")
+	if err != nil {
+		t.Fatalf("GetCountryResourceList failed: %v", err)
+	}
+	if len(result.IPv4) != 1 || len(result.IPv6) != 1 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+}
+
+func TestNewClientWithBaseURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/data/test/data.json" {
+			t.Errorf("Path = %s, expected /data/test/data.json", r.URL.Path)
+		}
+		json.NewEncoder(w).Encode(Response{Status: "ok", Data: json.RawMessage(`{}`)})
+	}))
+	defer server.Close()
+
+	client := NewClient(WithBaseURL(server.URL + "/data/"))
+	if _, err := client.Get(context.Background(), "test", nil); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+
+	if c := NewClient(WithBaseURL("")); c.baseURL != BaseURL {
+		t.Errorf("baseURL = %s, expected %s", c.baseURL, BaseURL)
+	}
+}
+
+func TestClientGetNoRetryOnClientError(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	client.baseURL = server.URL
+
+	_, err := client.Get(context.Background(), "test", nil)
+	if err == nil {
+		t.Fatal("Expected error")
+	}
+	if attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", attempts)
+	}
+	if IsTemporary(err) {
+		t.Errorf("IsTemporary(%v) = true, expected false", err)
+	}
+}
+
+func TestClientGetRetryAfter(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.Header().Set("Retry-After", "2")
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+		json.NewEncoder(w).Encode(Response{Status: "ok", Data: json.RawMessage(`{}`)})
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	client.baseURL = server.URL
+
+	start := time.Now()
+	if _, err := client.Get(context.Background(), "test", nil); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", attempts)
+	}
+	// The first backoff is at most 1.25s, so a longer wait means Retry-After was used
+	if elapsed := time.Since(start); elapsed < 2*time.Second {
+		t.Errorf("Retry took %v, expected at least the 2s Retry-After delay", elapsed)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"", 0},
+		{"5", 5 * time.Second},
+		{"Mon, 15 Jan 2024 12:00:10 GMT", 10 * time.Second},
+		{"Mon, 15 Jan 2024 11:00:00 GMT", 0},
+		{"3600", MaxRetryAfter},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.expected {
+			t.Errorf("parseRetryAfter(%q) = %v, expected %v", tt.value, got, tt.expected)
+		}
+	}
+}
+
+func TestFetchCountryResourceListConditional(t *testing.T) {
+	const etag = `"nl-v1"`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		json.NewEncoder(w).Encode(Response{
+			Status: "ok",
+			Data:   json.RawMessage(`{"resources":{"ipv4":["193.0.0.0/21"],"ipv6":[]},"resource":"nl"}`),
+		})
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	client.baseURL = server.URL
+	ctx := context.Background()
+
+	result, err := client.FetchCountryResourceList(ctx, CountryResourceListRequest{CountryCode: "nl"})
+	if err != nil {
+		t.Fatalf("FetchCountryResourceList failed: %v", err)
+	}
+	if result.ETag != etag {
+		t.Errorf("ETag = %s, expected %s", result.ETag, etag)
+	}
+
+	_, err = client.FetchCountryResourceList(ctx, CountryResourceListRequest{CountryCode: "nl", ETag: result.ETag})
+	if !errors.Is(err, ErrNotModified) {
+		t.Errorf("err = %v, expected ErrNotModified", err)
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestFetchCountryResourceListRaw(t *testing.T) {
+	body := `{"status":"ok","data":{"resources":{"ipv4":["193.0.0.0/21"],"ipv6":["2001:67c::/32"]},"query_time":"2024-01-15T00:00:00","resource":"nl"}}` + "\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	client.baseURL = server.URL
+
+	var raw bytes.Buffer
+	result, err := client.FetchCountryResourceList(context.Background(), CountryResourceListRequest{
+		CountryCode: "nl",
+		Raw: func() (io.WriteCloser, error) {
+			raw.Reset()
+			return nopWriteCloser{&raw}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("FetchCountryResourceList failed: %v", err)
+	}
+	if len(result.IPv4) != 1 || len(result.IPv6) != 1 || result.QueryTime != "2024-01-15T00:00:00" {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if raw.String() != body {
+		t.Errorf("raw = %q, expected %q", raw.String(), body)
+	}
+
+	// The kept response decodes to the same lists
+	parsed, err := ParseCountryResourceList("nl", raw.Bytes())
+	if err != nil {
+		t.Fatalf("ParseCountryResourceList failed: %v", err)
+	}
+	if parsed.CountryCode != "NL" || parsed.IPv4[0] != "193.0.0.0/21" || parsed.IPv6[0] != "2001:67c::/32" || parsed.QueryTime != result.QueryTime {
+		t.Errorf("ParseCountryResourceList = %+v", parsed)
+	}
+	if _, err := ParseCountryResourceList("nl", []byte("{")); err == nil {
+		t.Error("ParseCountryResourceList should fail on truncated data")
+	}
+}
+
+func TestGetAbuseContacts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/abuse-contact-finder/data.json" {
+			t.Errorf("Path = %s, expected /abuse-contact-finder/data.json", r.URL.Path)
+		}
+		json.NewEncoder(w).Encode(Response{
+			Status: "ok",
+			Data:   json.RawMessage(`{"abuse_contacts":["abuse@ripe.net"],"authoritative_rir":"ripe","resource":"193.0.0.0/21"}`),
+		})
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	client.baseURL = server.URL
+
+	result, err := client.GetAbuseContacts(context.Background(), "193.0.0.0/21")
+	if err != nil {
+		t.Fatalf("GetAbuseContacts failed: %v", err)
+	}
+	if len(result.Contacts) != 1 || result.Contacts[0] != "abuse@ripe.net" {
+		t.Errorf("Contacts = %v, expected [abuse@ripe.net]", result.Contacts)
+	}
+	if result.AuthoritativeRIR != "ripe" {
+		t.Errorf("AuthoritativeRIR = %s, expected ripe", result.AuthoritativeRIR)
+	}
+}
+
+func TestGetGeoloc(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Response{
+			Status: "ok",
+			Data:   json.RawMessage(`{"locations":[{"country":"US","city":"Mountain View","latitude":37.4056,"longitude":-122.0775,"resources":["8.8.8.0/24"],"covered_percentage":100}]}`),
+		})
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	client.baseURL = server.URL
+
+	locations, err := client.GetGeoloc(context.Background(), "8.8.8.0/24")
+	if err != nil {
+		t.Fatalf("GetGeoloc failed: %v", err)
+	}
+	if len(locations) != 1 || locations[0].City != "Mountain View" || locations[0].CoveredPercentage != 100 {
+		t.Errorf("Unexpected locations: %+v", locations)
+	}
+}
+
+func TestGetAnnouncedPrefixes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("resource"); got != "AS3333" {
+			t.Errorf("resource = %s, expected AS3333", got)
+		}
+		json.NewEncoder(w).Encode(Response{
+			Status: "ok",
+			Data:   json.RawMessage(`{"prefixes":[{"prefix":"193.0.0.0/21","timelines":[{"starttime":"2024-01-01T00:00:00","endtime":"2024-01-15T00:00:00"}]},{"prefix":"2001:67c:2e8::/48","timelines":[]}],"query_endtime":"2024-01-15T00:00:00","resource":"3333"}`),
+		})
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	client.baseURL = server.URL
+
+	result, err := client.GetAnnouncedPrefixes(context.Background(), 3333)
+	if err != nil {
+		t.Fatalf("GetAnnouncedPrefixes failed: %v", err)
+	}
+	if len(result.Prefixes) != 2 || result.Prefixes[0] != "193.0.0.0/21" || result.Prefixes[1] != "2001:67c:2e8::/48" {
+		t.Errorf("Prefixes = %v", result.Prefixes)
+	}
+}
+
+func TestGetRIRStatsCountry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("resource"); got != "AS3333" {
+			t.Errorf("resource = %s, expected AS3333", got)
+		}
+		json.NewEncoder(w).Encode(Response{
+			Status: "ok",
+			Data:   json.RawMessage(`{"located_resources":[{"resource":"3333","location":"NL"}],"query_time":"2024-01-15T00:00:00"}`),
+		})
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	client.baseURL = server.URL
+
+	country, err := client.GetRIRStatsCountry(context.Background(), "AS3333")
+	if err != nil {
+		t.Fatalf("GetRIRStatsCountry failed: %v", err)
+	}
+	if country != "NL" {
+		t.Errorf("country = %q, expected NL", country)
+	}
+}
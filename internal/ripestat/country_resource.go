@@ -4,10 +4,20 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"net/url"
 	"strings"
 )
 
+// EarliestQueryTime is a query time before the start of RIPEstat's archive.
+// RIPEstat has no data call reporting where the archive of a country starts,
+// but it answers a query for a time before it with the earliest data it has,
+// reporting the time used in query_time. This is how the API behaves rather
+// than a documented guarantee, so a response to this query without a
+// query_time is rejected.
+const EarliestQueryTime = "2000-01-01T00:00:00"
+
 // CountryResourceListData is the response data from country-resource-list endpoint.
 type CountryResourceListData struct {
 	Resources struct {
@@ -25,36 +35,86 @@ type CountryResourceListResult struct {
 	IPv4        []string
 	IPv6        []string
 	QueryTime   string
-	RawJSON     []byte
+	// ETag and LastModified identify the response for conditional requests.
+	ETag         string
+	LastModified string
+}
+
+// CountryResourceListRequest describes a country-resource-list query.
+type CountryResourceListRequest struct {
+	// CountryCode is the ISO-3166 alpha-2 code of the country.
+	CountryCode string
+	// QueryTime is optional (format: YYYY-MM-DD or empty for latest, or
+	// EarliestQueryTime for the oldest available data).
+	QueryTime string
+	// ETag and LastModified are the validators of an earlier response. When
+	// set, the request is conditional and ErrNotModified is returned if the
+	// list has not changed since.
+	ETag         string
+	LastModified string
+	// Raw, if set, opens a writer that receives the raw response while it
+	// is decoded. It is called again for every retry.
+	Raw func() (io.WriteCloser, error)
 }
 
 // GetCountryResourceList fetches IPv4 and IPv6 prefixes for a country.
 // countryCode should be lowercase ISO-3166 alpha-2 code.
-// time is optional (format: YYYY-MM-DD or empty for latest).
+// time is optional (format: YYYY-MM-DD or empty for latest, or
+// EarliestQueryTime for the oldest available data).
 func (c *Client) GetCountryResourceList(ctx context.Context, countryCode string, queryTime string) (*CountryResourceListResult, error) {
+	return c.FetchCountryResourceList(ctx, CountryResourceListRequest{CountryCode: countryCode, QueryTime: queryTime})
+}
+
+// FetchCountryResourceList performs a country-resource-list query. The
+// response is decoded as it streams in, straight into the prefix lists.
+func (c *Client) FetchCountryResourceList(ctx context.Context, r CountryResourceListRequest) (*CountryResourceListResult, error) {
 	params := url.Values{}
-	params.Set("resource", strings.ToLower(countryCode))
+	params.Set("resource", strings.ToLower(r.CountryCode))
 	params.Set("v4_format", "prefix")
 
-	if queryTime != "" {
-		params.Set("time", queryTime)
+	if r.QueryTime != "" {
+		params.Set("time", r.QueryTime)
+	}
+
+	opts := requestOptions{header: http.Header{}, raw: r.Raw}
+	if r.ETag != "" {
+		opts.header.Set("If-None-Match", r.ETag)
 	}
+	if r.LastModified != "" {
+		opts.header.Set("If-Modified-Since", r.LastModified)
+	}
+	var data CountryResourceListData
+	opts.data = &data
 
-	resp, err := c.Get(ctx, "country-resource-list", params)
+	resp, err := c.get(ctx, "country-resource-list", params, opts)
 	if err != nil {
-		return nil, fmt.Errorf("get country-resource-list for %s: %w", countryCode, err)
+		return nil, fmt.Errorf("get country-resource-list for %s: %w", r.CountryCode, err)
 	}
+	if r.QueryTime == EarliestQueryTime && data.QueryTime == "" {
+		return nil, fmt.Errorf("country-resource-list for %s: no query_time reported for the earliest data", r.CountryCode)
+	}
+
+	return &CountryResourceListResult{
+		CountryCode:  strings.ToUpper(r.CountryCode),
+		IPv4:         data.Resources.IPv4,
+		IPv6:         data.Resources.IPv6,
+		QueryTime:    data.QueryTime,
+		ETag:         resp.ETag,
+		LastModified: resp.LastModified,
+	}, nil
+}
 
+// ParseCountryResourceList decodes a raw country-resource-list response,
+// as kept with a snapshot.
+func ParseCountryResourceList(countryCode string, raw []byte) (*CountryResourceListResult, error) {
 	var data CountryResourceListData
-	if err := json.Unmarshal(resp.Data, &data); err != nil {
-		return nil, fmt.Errorf("decode country-resource-list data: %w", err)
+	if err := json.Unmarshal(raw, &envelope{Data: &data}); err != nil {
+		return nil, fmt.Errorf("decode country-resource-list for %s: %w", countryCode, err)
 	}
-
 	return &CountryResourceListResult{
 		CountryCode: strings.ToUpper(countryCode),
 		IPv4:        data.Resources.IPv4,
 		IPv6:        data.Resources.IPv6,
 		QueryTime:   data.QueryTime,
-		RawJSON:     resp.Data,
 	}, nil
 }
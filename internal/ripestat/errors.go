@@ -0,0 +1,77 @@
+package ripestat
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotModified is returned by conditional requests when the resource has
+// not changed since the response the validators came from.
+var ErrNotModified = errors.New("not modified")
+
+// MaxRetryAfter caps the wait requested by a server's Retry-After header.
+const MaxRetryAfter = 2 * time.Minute
+
+// StatusError is returned when RIPEstat answers with an unsuccessful HTTP
+// status or an API-level error.
+type StatusError struct {
+	// StatusCode is the HTTP status, or the API status code of an error
+	// response delivered with HTTP 200 (0 if none was given).
+	StatusCode int
+	Message    string
+	// RetryAfter is the wait requested by the server, if any.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Message)
+}
+
+// Temporary reports whether retrying the request may succeed: rate limiting
+// (429) and server errors (5xx) are transient, other statuses are not.
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// IsTemporary reports whether err is a transient failure worth retrying:
+// a network error, a truncated response, rate limiting or a server error.
+// Client errors (4xx) and malformed responses are permanent.
+func IsTemporary(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Temporary()
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an
+// HTTP date. It returns 0 if the header is missing or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	var d time.Duration
+	if secs, err := strconv.Atoi(value); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(value); err == nil {
+		d = t.Sub(now)
+	}
+	if d < 0 {
+		return 0
+	}
+	if d > MaxRetryAfter {
+		return MaxRetryAfter
+	}
+	return d
+}
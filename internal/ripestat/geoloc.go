@@ -0,0 +1,43 @@
+package ripestat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// GeolocData is the response data from geoloc endpoint.
+type GeolocData struct {
+	Locations []GeolocLocation `json:"locations"`
+	QueryTime string           `json:"query_time"`
+}
+
+// GeolocLocation is one location of the resources within a queried prefix.
+type GeolocLocation struct {
+	Country           string   `json:"country"`
+	City              string   `json:"city"`
+	Latitude          float64  `json:"latitude"`
+	Longitude         float64  `json:"longitude"`
+	Resources         []string `json:"resources"`
+	CoveredPercentage float64  `json:"covered_percentage"`
+}
+
+// GetGeoloc fetches the geolocation of an IP address or prefix. A prefix
+// can span several locations; each reports how much of it it covers.
+func (c *Client) GetGeoloc(ctx context.Context, resource string) ([]GeolocLocation, error) {
+	params := url.Values{}
+	params.Set("resource", resource)
+
+	resp, err := c.Get(ctx, "geoloc", params)
+	if err != nil {
+		return nil, fmt.Errorf("get geoloc for %s: %w", resource, err)
+	}
+
+	var data GeolocData
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		return nil, fmt.Errorf("decode geoloc data: %w", err)
+	}
+
+	return data.Locations, nil
+}
@@ -0,0 +1,42 @@
+package ripestat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// RIRStatsCountryData is the response data from rir-stats-country endpoint.
+type RIRStatsCountryData struct {
+	LocatedResources []struct {
+		Resource string `json:"resource"`
+		Location string `json:"location"`
+	} `json:"located_resources"`
+	QueryTime string `json:"query_time"`
+}
+
+// GetRIRStatsCountry fetches the country a resource (an IP address, prefix
+// or ASN such as "AS3333") is registered to in the RIR statistics files.
+// It returns "" if the resource is not registered.
+func (c *Client) GetRIRStatsCountry(ctx context.Context, resource string) (string, error) {
+	params := url.Values{}
+	params.Set("resource", resource)
+
+	resp, err := c.Get(ctx, "rir-stats-country", params)
+	if err != nil {
+		return "", fmt.Errorf("get rir-stats-country for %s: %w", resource, err)
+	}
+
+	var data RIRStatsCountryData
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		return "", fmt.Errorf("decode rir-stats-country data: %w", err)
+	}
+
+	for _, r := range data.LocatedResources {
+		if r.Location != "" {
+			return r.Location, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"crypto/subtle"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SetAPIKeys requires clients to send one of keys, as a bearer token or in
+// the X-API-Key header. It must be called before Handler.
+func (s *Server) SetAPIKeys(keys []string) {
+	s.apiKeys = keys
+}
+
+// SetRateLimit limits each client to rate requests per second with bursts
+// of up to burst requests. Clients are identified by API key if keys are
+// set, or else by address. It must be called before Handler.
+func (s *Server) SetRateLimit(rate float64, burst int) {
+	s.limiter = newRateLimiter(rate, burst, func() time.Time { return s.now() })
+}
+
+// guard wraps next with the authentication and rate limiting configured.
+func (s *Server) guard(next http.Handler) http.Handler {
+	if len(s.apiKeys) == 0 && s.limiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := clientAddr(r)
+		// The API description is public so that clients can be built and
+		// keys entered in Swagger UI
+		public := r.URL.Path == "/openapi.json" || r.URL.Path == "/docs"
+		if len(s.apiKeys) > 0 && !public {
+			key, ok := s.authenticate(r)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="ip2cc"`)
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing or invalid API key"})
+				return
+			}
+			client = "key " + key
+		}
+		if s.limiter != nil {
+			if wait, ok := s.limiter.allow(client); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": "rate limit exceeded"})
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticate returns the API key sent with r if it is one of the keys.
+func (s *Server) authenticate(r *http.Request) (string, bool) {
+	sent := r.Header.Get("X-API-Key")
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		sent = strings.TrimSpace(token)
+	}
+	return s.matchKey(sent)
+}
+
+// matchKey returns sent if it is one of the API keys.
+func (s *Server) matchKey(sent string) (string, bool) {
+	if sent == "" {
+		return "", false
+	}
+	for _, key := range s.apiKeys {
+		if subtle.ConstantTimeCompare([]byte(sent), []byte(key)) == 1 {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// clientAddr returns the address of the client of r, without the port.
+func clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimitSweep is how often the buckets of idle clients are dropped.
+const rateLimitSweep = time.Minute
+
+// rateLimiter keeps a token bucket per client.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int, now func() time.Time) *rateLimiter {
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	return &rateLimiter{
+		rate:      rate,
+		burst:     float64(burst),
+		now:       now,
+		buckets:   make(map[string]*bucket),
+		lastSweep: now(),
+	}
+}
+
+// allow takes a token from the bucket of client. If there is none, it
+// returns how long until there is one.
+func (l *rateLimiter) allow(client string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= rateLimitSweep {
+		// A full bucket is the same as none
+		for c, b := range l.buckets {
+			if l.refill(b, now) >= l.burst {
+				delete(l.buckets, c)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / l.rate * float64(time.Second)), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// refill returns the tokens in b at now.
+func (l *rateLimiter) refill(b *bucket, now time.Time) float64 {
+	return math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+}
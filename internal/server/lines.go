@@ -0,0 +1,167 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/output"
+)
+
+const (
+	// LineIdleTimeout is how long a line protocol connection may go
+	// without a request, or take to accept an answer, before it is closed.
+	LineIdleTimeout = 5 * time.Minute
+
+	// MaxLineConns is how many line protocol connections are served at
+	// once; further clients wait to be accepted.
+	MaxLineConns = 256
+)
+
+// ServeLines answers lookups on l with a line protocol: every non-empty
+// line sent holds an IP address or CIDR and is answered with one line in
+// the tab-separated text format of the CLI. Errors are reported in the
+// line as well. It returns nil once l is closed.
+//
+// A "FORMAT json" or "FORMAT text" line switches the answers of the
+// connection to the format of ServeLinesJSON or ServeLines; it is not
+// answered itself unless the format is unknown.
+//
+// On TCP, the API keys and rate limit of the server apply: with keys set,
+// the first line of a connection must be "AUTH <key>", and requests over
+// the rate limit of the key or client address are answered with an error.
+// Unix domain sockets are left to file permissions.
+func (s *Server) ServeLines(ctx context.Context, l net.Listener) error {
+	return s.serveLines(ctx, l, false)
+}
+
+// ServeLinesJSON answers lookups on l like ServeLines, but with one
+// compact JSON result object per line, for the enrichment stages of log
+// shippers. Every line is answered, blank ones with an error, so answers
+// can be matched to requests by their order.
+func (s *Server) ServeLinesJSON(ctx context.Context, l net.Listener) error {
+	return s.serveLines(ctx, l, true)
+}
+
+func (s *Server) serveLines(ctx context.Context, l net.Listener, jsonLines bool) error {
+	slots := make(chan struct{}, MaxLineConns)
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil
+		}
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			defer func() { <-slots }()
+			s.serveLinesConn(ctx, conn, jsonLines)
+		}()
+	}
+}
+
+func (s *Server) serveLinesConn(ctx context.Context, conn net.Conn, jsonLines bool) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	defer w.Flush()
+	answer := func(result *output.LookupResult) bool {
+		if jsonLines {
+			data, err := json.Marshal(result)
+			if err != nil {
+				return false
+			}
+			w.Write(data)
+		} else {
+			w.WriteString(result.FormatText())
+		}
+		w.WriteByte('\n')
+		// Answer pipelined requests in one write
+		if r.Buffered() > 0 {
+			return true
+		}
+		conn.SetWriteDeadline(time.Now().Add(s.lineIdle))
+		return w.Flush() == nil
+	}
+
+	guarded := conn.LocalAddr().Network() == "tcp"
+	client := ""
+	if guarded {
+		client, _, _ = net.SplitHostPort(conn.RemoteAddr().String())
+	}
+	authenticated := !guarded || len(s.apiKeys) == 0
+	for {
+		conn.SetReadDeadline(time.Now().Add(s.lineIdle))
+		line, isPrefix, err := r.ReadLine()
+		if err != nil || isPrefix {
+			// Closed, idle, or a line too long to be an address
+			return
+		}
+		input := strings.TrimSpace(string(line))
+
+		if !authenticated {
+			key, ok := s.authenticateLine(input)
+			if !ok {
+				answer(&output.LookupResult{Error: "missing or invalid API key"})
+				return
+			}
+			authenticated, client = true, "key "+key
+			continue
+		}
+
+		if format, ok := strings.CutPrefix(input, "FORMAT "); ok {
+			switch strings.TrimSpace(format) {
+			case "json":
+				jsonLines = true
+			case "text":
+				jsonLines = false
+			default:
+				if !answer(&output.LookupResult{Error: "unknown format " + strings.TrimSpace(format) + " (use text or json)"}) {
+					return
+				}
+			}
+			continue
+		}
+
+		var result *output.LookupResult
+		switch {
+		case input == "" && !jsonLines:
+			continue
+		case input == "":
+			result = &output.LookupResult{Error: "empty request"}
+		case guarded && s.limiter != nil && !s.allowLine(client):
+			result = &output.LookupResult{IP: input, Error: "rate limit exceeded"}
+		default:
+			result = s.processor().Lookup(ctx, input)
+		}
+		if !answer(result) {
+			return
+		}
+	}
+}
+
+// authenticateLine returns the API key sent in an "AUTH <key>" line if it
+// is one of the keys.
+func (s *Server) authenticateLine(line string) (string, bool) {
+	sent, ok := strings.CutPrefix(line, "AUTH ")
+	if !ok {
+		return "", false
+	}
+	return s.matchKey(strings.TrimSpace(sent))
+}
+
+// allowLine takes a request of client from the rate limiter.
+func (s *Server) allowLine(client string) bool {
+	_, ok := s.limiter.allow(client)
+	return ok
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hightemp/ip2cc/internal/output"
+)
+
+// SetSwaggerUI serves a Swagger UI page for the OpenAPI document at /docs.
+// The page loads the UI scripts from a public CDN. It must be called
+// before Handler.
+func (s *Server) SetSwaggerUI(enabled bool) {
+	s.swaggerUI = enabled
+}
+
+// OpenAPI returns the OpenAPI 3.1 document describing the HTTP endpoints.
+// The result schemas are those of the JSON output (see output.JSONSchema).
+func (s *Server) OpenAPI() ([]byte, error) {
+	var outputSchema struct {
+		Defs map[string]interface{} `json:"$defs"`
+	}
+	if err := json.Unmarshal(output.JSONSchema(), &outputSchema); err != nil {
+		return nil, fmt.Errorf("output schema: %w", err)
+	}
+	schemas := outputSchema.Defs
+	snapshotInfo, err := output.ObjectSchema(SnapshotInfo{})
+	if err != nil {
+		return nil, fmt.Errorf("snapshot info schema: %w", err)
+	}
+	schemas["SnapshotInfo"] = snapshotInfo
+	schemas["Error"] = map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"error": map[string]interface{}{"type": "string"}},
+		"required":   []string{"error"},
+	}
+	rewriteRefs(schemas)
+
+	result := jsonContent(schemaRef("LookupResult"))
+	errorResponse := func(description string) map[string]interface{} {
+		return map[string]interface{}{"description": description, "content": jsonContent(schemaRef("Error"))}
+	}
+
+	lookup := map[string]interface{}{
+		"summary":     "Look up an IP address, CIDR, or range",
+		"operationId": "lookup",
+		"parameters": []interface{}{map[string]interface{}{
+			"name":        "ip",
+			"in":          "path",
+			"required":    true,
+			"description": "IP address, CIDR (escape '/' as %2F), or range",
+			"schema":      map[string]interface{}{"type": "string"},
+		}},
+		"responses": map[string]interface{}{
+			"200": map[string]interface{}{"description": "Lookup result", "content": result},
+			"400": map[string]interface{}{"description": "Invalid address; the result's error field says why", "content": result},
+			"404": map[string]interface{}{"description": "Not in the index; the result's error field says why", "content": result},
+		},
+	}
+	results := map[string]interface{}{"type": "array", "items": schemaRef("LookupResult")}
+	bulkLookup := map[string]interface{}{
+		"summary":     "Look up many addresses",
+		"description": "Results are in input order; repeated addresses are looked up once. Failed lookups are reported in the error field of their result.",
+		"operationId": "bulkLookup",
+		"requestBody": map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+				},
+				"text/plain": map[string]interface{}{
+					"schema": map[string]interface{}{"type": "string", "description": "One address per line"},
+				},
+			},
+		},
+		"responses": map[string]interface{}{
+			"200": map[string]interface{}{
+				"description": "Lookup results, as NDJSON (one result per line) if accepted by the client",
+				"content": map[string]interface{}{
+					"application/json":     map[string]interface{}{"schema": results},
+					"application/x-ndjson": map[string]interface{}{"schema": schemaRef("LookupResult")},
+				},
+			},
+			"400": errorResponse("Malformed request body"),
+			"413": errorResponse(fmt.Sprintf("Request body larger than %d bytes", MaxBulkBody)),
+		},
+	}
+	snapshot := map[string]interface{}{
+		"summary":     "Describe the snapshot being served",
+		"operationId": "snapshot",
+		"responses": map[string]interface{}{
+			"200": map[string]interface{}{"description": "Snapshot metadata", "content": jsonContent(schemaRef("SnapshotInfo"))},
+		},
+	}
+
+	operations := []map[string]interface{}{lookup, bulkLookup, snapshot}
+	components := map[string]interface{}{"schemas": schemas}
+	if len(s.apiKeys) > 0 {
+		components["securitySchemes"] = map[string]interface{}{
+			"bearer": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			"apiKey": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+		}
+	}
+	for _, op := range operations {
+		responses := op["responses"].(map[string]interface{})
+		if len(s.apiKeys) > 0 {
+			op["security"] = []interface{}{
+				map[string]interface{}{"bearer": []string{}},
+				map[string]interface{}{"apiKey": []string{}},
+			}
+			responses["401"] = errorResponse("Missing or invalid API key")
+		}
+		if s.limiter != nil {
+			responses["429"] = errorResponse("Rate limit exceeded; retry after the seconds in the Retry-After header")
+		}
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]interface{}{
+			"title":       "ip2cc",
+			"description": "Country and provider lookups of IP addresses from RIR delegation data.",
+			"version":     fmt.Sprintf("%d", output.SchemaVersion),
+		},
+		"paths": map[string]interface{}{
+			"/lookup/{ip}": map[string]interface{}{"get": lookup},
+			"/lookup":      map[string]interface{}{"post": bulkLookup},
+			"/snapshot":    map[string]interface{}{"get": snapshot},
+		},
+		"components": components,
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func schemaRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+// rewriteRefs points the references of the output schema into the
+// components of the OpenAPI document.
+func rewriteRefs(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			if ref, ok := e.(string); ok && k == "$ref" {
+				v[k] = strings.Replace(ref, "#/$defs/", "#/components/schemas/", 1)
+				continue
+			}
+			rewriteRefs(e)
+		}
+	case []interface{}:
+		for _, e := range v {
+			rewriteRefs(e)
+		}
+	}
+}
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	doc, err := s.OpenAPI()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(doc)
+}
+
+// swaggerUIPage shows the OpenAPI document with Swagger UI.
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>ip2cc API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>SwaggerUIBundle({url: "openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
+
+func (s *Server) handleSwaggerUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(swaggerUIPage))
+}
@@ -0,0 +1,246 @@
+// Package server implements the HTTP lookup server.
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/anycast"
+	"github.com/hightemp/ip2cc/internal/batch"
+	"github.com/hightemp/ip2cc/internal/enrich"
+	"github.com/hightemp/ip2cc/internal/index"
+	"github.com/hightemp/ip2cc/internal/iplist"
+	"github.com/hightemp/ip2cc/internal/output"
+	"github.com/hightemp/ip2cc/internal/provider"
+	"github.com/hightemp/ip2cc/internal/snapshot"
+)
+
+// Timeouts of the HTTP server, so that idle or slow clients cannot hold
+// connections open indefinitely.
+const (
+	ReadHeaderTimeout = 10 * time.Second
+	IdleTimeout       = 2 * time.Minute
+)
+
+// MaxBulkBody bounds the request body of a bulk lookup.
+const MaxBulkBody = 16 << 20
+
+// SnapshotInfo describes the snapshot the server is answering from.
+type SnapshotInfo struct {
+	Date            string    `json:"date"`
+	ActualQueryTime string    `json:"actual_query_time"`
+	CreatedAt       time.Time `json:"created_at"`
+	AgeSeconds      int64     `json:"age_seconds"`
+	CountriesCount  int       `json:"countries_count"`
+	PrefixesV4      int       `json:"prefixes_v4"`
+	PrefixesV6      int       `json:"prefixes_v6"`
+	FailedCountries []string  `json:"failed_countries"`
+	Source          string    `json:"source"`
+}
+
+// Server answers lookups over HTTP.
+type Server struct {
+	db        *snapshot.Database
+	resolver  *provider.Resolver
+	enrichers []enrich.Enricher
+	nat64     []netip.Prefix
+	anycast   *anycast.List
+	tags      *iplist.Tags
+	apiKeys   []string
+	limiter   *rateLimiter
+	swaggerUI bool
+	extra     map[string]http.Handler
+	lineIdle  time.Duration
+	now       func() time.Time
+}
+
+// New creates a new server for the given index and snapshot metadata.
+// resolver may be nil to disable provider lookups.
+func New(ix *index.Index, resolver *provider.Resolver, meta *snapshot.Metadata) *Server {
+	s := &Server{
+		db:       snapshot.NewDatabase(&snapshot.Loaded{Index: ix, Meta: meta}),
+		resolver: resolver,
+		lineIdle: LineIdleTimeout,
+		now:      time.Now,
+	}
+	return s
+}
+
+// Reload swaps in a new snapshot. Requests already in flight finish on the
+// index they started with.
+func (s *Server) Reload(ix *index.Index, meta *snapshot.Metadata) {
+	s.db.Swap(&snapshot.Loaded{Index: ix, Meta: meta})
+}
+
+// SetNAT64Prefixes sets the NAT64 prefixes whose addresses are looked up
+// as the IPv4 address they were synthesized from (default 64:ff9b::/96).
+// It must be called before the server starts handling requests.
+func (s *Server) SetNAT64Prefixes(prefixes []netip.Prefix) {
+	s.nat64 = prefixes
+}
+
+// SetAnycast sets the anycast prefixes whose addresses are marked as
+// anycast (default: the built-in list). It must be called before the
+// server starts handling requests.
+func (s *Server) SetAnycast(l *anycast.List) {
+	s.anycast = l
+}
+
+// SetTags enables reporting the tag lists containing each result. It must
+// be called before the server starts handling requests.
+func (s *Server) SetTags(t *iplist.Tags) {
+	s.tags = t
+}
+
+// AddEnricher registers an enricher that runs on every lookup result. It
+// must be called before the server starts handling requests.
+func (s *Server) AddEnricher(e enrich.Enricher) {
+	s.enrichers = append(s.enrichers, e)
+}
+
+func (s *Server) processor() *batch.Processor {
+	current := s.db.Current()
+	p := batch.NewProcessor(current.Index.V4, current.Index.V6, s.resolver, current.Meta)
+	for _, e := range s.enrichers {
+		p.AddEnricher(e)
+	}
+	if s.nat64 != nil {
+		p.SetNAT64Prefixes(s.nat64)
+	}
+	if s.anycast != nil {
+		p.SetAnycast(s.anycast)
+	}
+	p.SetTags(s.tags)
+	return p
+}
+
+// Handle registers handler for pattern next to the lookup routes, behind
+// the same authentication and rate limiting. It must be called before
+// Handler.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	if s.extra == nil {
+		s.extra = make(map[string]http.Handler)
+	}
+	s.extra[pattern] = handler
+}
+
+// Handler returns the HTTP handler with all routes registered, behind the
+// authentication and rate limiting configured.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	for pattern, handler := range s.extra {
+		mux.Handle(pattern, handler)
+	}
+	mux.HandleFunc("GET /lookup/{ip}", s.handleLookup)
+	mux.HandleFunc("POST /lookup", s.handleBulkLookup)
+	mux.HandleFunc("GET /snapshot", s.handleSnapshot)
+	mux.HandleFunc("GET /openapi.json", s.handleOpenAPI)
+	if s.swaggerUI {
+		mux.HandleFunc("GET /docs", s.handleSwaggerUI)
+	}
+	return s.guard(mux)
+}
+
+func (s *Server) handleLookup(w http.ResponseWriter, r *http.Request) {
+	result := s.processor().Lookup(r.Context(), r.PathValue("ip"))
+
+	status := http.StatusOK
+	switch {
+	case result.Invalid:
+		status = http.StatusBadRequest
+	case result.Error != "":
+		status = http.StatusNotFound
+	}
+	writeJSON(w, status, result)
+}
+
+// handleBulkLookup looks up the addresses in the request body, a JSON array
+// of strings or one address per line, and answers with a JSON array of
+// results, or NDJSON if the client accepts it. Repeated addresses are
+// looked up once, and results stream in input order as they are ready.
+func (s *Server) handleBulkLookup(w http.ResponseWriter, r *http.Request) {
+	inputs, err := readBulkInputs(r.Header.Get("Content-Type"), http.MaxBytesReader(w, r.Body, MaxBulkBody))
+	if err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+
+	var rw output.ResultWriter
+	if strings.Contains(r.Header.Get("Accept"), "application/x-ndjson") {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		rw = output.NewNDJSONWriter(w)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		rw = output.NewJSONArrayWriter(w)
+	}
+	p := s.processor()
+	p.SetResultWriter(rw)
+	// Errors here are failed writes to a client that went away
+	if err := p.ProcessInputConcurrent(r.Context(), strings.NewReader(strings.Join(inputs, "\n")), w, false); err != nil {
+		return
+	}
+	rw.Close()
+}
+
+// readBulkInputs reads the addresses of a bulk lookup request body.
+func readBulkInputs(contentType string, body io.Reader) ([]string, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType != "application/json" {
+		return strings.Split(string(data), "\n"), nil
+	}
+
+	var inputs []string
+	if err := json.Unmarshal(data, &inputs); err != nil {
+		return nil, fmt.Errorf("body must be a JSON array of strings: %w", err)
+	}
+	for _, input := range inputs {
+		if strings.ContainsAny(input, "\r\n") {
+			return nil, fmt.Errorf("invalid input %q", input)
+		}
+	}
+	return inputs, nil
+}
+
+func (s *Server) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.snapshotInfo())
+}
+
+func (s *Server) snapshotInfo() *SnapshotInfo {
+	meta := s.db.Current().Meta
+	failed := meta.FailedCountries
+	if failed == nil {
+		failed = []string{}
+	}
+	return &SnapshotInfo{
+		Date:            meta.RequestedTime,
+		ActualQueryTime: meta.ActualQueryTime,
+		CreatedAt:       meta.CreatedAt,
+		AgeSeconds:      int64(s.now().Sub(meta.CreatedAt) / time.Second),
+		CountriesCount:  meta.CountriesCount,
+		PrefixesV4:      meta.PrefixesV4,
+		PrefixesV6:      meta.PrefixesV6,
+		FailedCountries: failed,
+		Source:          meta.Source,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,694 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/index"
+	"github.com/hightemp/ip2cc/internal/output"
+	"github.com/hightemp/ip2cc/internal/snapshot"
+)
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	v4 := index.NewTrie(false)
+	v6 := index.NewTrie(true)
+	if err := v4.InsertCIDR("8.8.8.0/24", "US"); err != nil {
+		t.Fatalf("InsertCIDR failed: %v", err)
+	}
+
+	meta := snapshot.NewMetadata()
+	meta.RequestedTime = "2025-01-15"
+	meta.CreatedAt = time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	meta.CountriesCount = 249
+	meta.PrefixesV4 = 1
+	meta.FailedCountries = []string{"xk"}
+
+	srv := New(&index.Index{V4: v4, V6: v6}, nil, meta)
+	srv.now = func() time.Time { return meta.CreatedAt.Add(2 * time.Hour) }
+	return srv
+}
+
+func TestHandleSnapshot(t *testing.T) {
+	srv := newTestServer(t)
+
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/snapshot", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, expected 200", rec.Code)
+	}
+
+	var info SnapshotInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if info.Date != "2025-01-15" {
+		t.Errorf("Date = %s, expected 2025-01-15", info.Date)
+	}
+	if info.AgeSeconds != 7200 {
+		t.Errorf("AgeSeconds = %d, expected 7200", info.AgeSeconds)
+	}
+	if info.CountriesCount != 249 {
+		t.Errorf("CountriesCount = %d, expected 249", info.CountriesCount)
+	}
+	if len(info.FailedCountries) != 1 || info.FailedCountries[0] != "xk" {
+		t.Errorf("FailedCountries = %v, expected [xk]", info.FailedCountries)
+	}
+}
+
+func TestHandleLookup(t *testing.T) {
+	srv := newTestServer(t)
+
+	tests := []struct {
+		ip     string
+		status int
+		cc     string
+	}{
+		{"8.8.8.8", http.StatusOK, "US"},
+		{"1.1.1.1", http.StatusNotFound, ""},
+		{"not-an-ip", http.StatusBadRequest, ""},
+		{"8.8.8.0%2F24", http.StatusOK, "US"},
+		{"8.8.8.0%2F33", http.StatusBadRequest, ""},
+		{"8.8.8.9-8.8.8.1", http.StatusBadRequest, ""},
+	}
+
+	for _, tc := range tests {
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/lookup/"+tc.ip, nil))
+
+		if rec.Code != tc.status {
+			t.Errorf("GET /lookup/%s status = %d, expected %d", tc.ip, rec.Code, tc.status)
+		}
+
+		var result output.LookupResult
+		if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+			t.Fatalf("Invalid JSON: %v", err)
+		}
+		if result.CountryCode != tc.cc {
+			t.Errorf("GET /lookup/%s country_code = %q, expected %q", tc.ip, result.CountryCode, tc.cc)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	srv := newTestServer(t)
+
+	v4 := index.NewTrie(false)
+	if err := v4.InsertCIDR("8.8.8.0/24", "DE"); err != nil {
+		t.Fatalf("InsertCIDR failed: %v", err)
+	}
+	meta := snapshot.NewMetadata()
+	meta.RequestedTime = "2025-02-01"
+	srv.Reload(&index.Index{V4: v4, V6: index.NewTrie(true)}, meta)
+
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/lookup/8.8.8.8", nil))
+	var result output.LookupResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if result.CountryCode != "DE" || result.SnapshotTime != "2025-02-01" {
+		t.Errorf("Lookup after reload = %s from %s, expected DE from 2025-02-01", result.CountryCode, result.SnapshotTime)
+	}
+}
+
+func TestServeLines(t *testing.T) {
+	srv := newTestServer(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- srv.ServeLines(context.Background(), l) }()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	// Pipelined requests, with a blank line that gets no answer
+	if _, err := conn.Write([]byte("8.8.8.8\n\n1.1.1.1\nnot-an-ip\n")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	r := bufio.NewReader(conn)
+	expected := []string{"8.8.8.8\tUS\t", "1.1.1.1\t-\t-\t-\tERROR: not found", "not-an-ip\t-\t-\t-\tERROR: invalid IP"}
+	for _, prefix := range expected {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("ReadString failed: %v", err)
+		}
+		if !strings.HasPrefix(line, prefix) {
+			t.Errorf("Response = %q, expected prefix %q", line, prefix)
+		}
+	}
+
+	l.Close()
+	if err := <-done; err != nil {
+		t.Errorf("ServeLines after close = %v, expected nil", err)
+	}
+}
+
+func TestServeLinesFormat(t *testing.T) {
+	srv := newTestServer(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer l.Close()
+	go srv.ServeLines(context.Background(), l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("FORMAT json\nnot-an-ip\n1.1.1.1\nFORMAT text\n8.8.8.8\nFORMAT xml\n")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	r := bufio.NewReader(conn)
+	for _, expected := range []struct {
+		invalid bool
+		error   string
+	}{{true, "invalid IP"}, {false, "not found"}} {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			t.Fatalf("ReadBytes failed: %v", err)
+		}
+		var result output.LookupResult
+		if err := json.Unmarshal(line, &result); err != nil {
+			t.Fatalf("Answer %q is not JSON: %v", line, err)
+		}
+		if result.Invalid != expected.invalid || !strings.HasPrefix(result.Error, expected.error) {
+			t.Errorf("Answer = invalid %v, error %q, expected %v, %q", result.Invalid, result.Error, expected.invalid, expected.error)
+		}
+	}
+	for _, prefix := range []string{"8.8.8.8\tUS\t", "\t-\t-\t-\tERROR: unknown format xml"} {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("ReadString failed: %v", err)
+		}
+		if !strings.HasPrefix(line, prefix) {
+			t.Errorf("Response = %q, expected prefix %q", line, prefix)
+		}
+	}
+}
+
+func TestServeLinesGuard(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetAPIKeys([]string{"secret"})
+	srv.SetRateLimit(0.001, 2)
+	srv.lineIdle = 100 * time.Millisecond
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer l.Close()
+	go srv.ServeLinesJSON(context.Background(), l)
+
+	exchange := func(request string) []output.LookupResult {
+		t.Helper()
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("Dial failed: %v", err)
+		}
+		defer conn.Close()
+		if _, err := conn.Write([]byte(request)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		// The server closes the connection once it is idle
+		var results []output.LookupResult
+		dec := json.NewDecoder(conn)
+		for {
+			var result output.LookupResult
+			if err := dec.Decode(&result); err != nil {
+				return results
+			}
+			results = append(results, result)
+		}
+	}
+
+	results := exchange("8.8.8.8\n8.8.8.8\n")
+	if len(results) != 1 || results[0].Error != "missing or invalid API key" {
+		t.Errorf("Answers without AUTH = %+v, expected one key error", results)
+	}
+	results = exchange("AUTH wrong\n8.8.8.8\n")
+	if len(results) != 1 || results[0].Error != "missing or invalid API key" {
+		t.Errorf("Answers with a wrong key = %+v, expected one key error", results)
+	}
+
+	// The key allows bursts of 2 requests
+	results = exchange("AUTH secret\n8.8.8.8\n8.8.8.8\n8.8.8.8\n")
+	var got []string
+	for _, r := range results {
+		got = append(got, r.CountryCode+"/"+r.Error)
+	}
+	if s := strings.Join(got, ","); s != "US/,US/,/rate limit exceeded" {
+		t.Errorf("Answers with the key = %s", s)
+	}
+}
+
+// shipperEvent is a log event of mockShipper, enriched with the answer
+// to its client address.
+type shipperEvent struct {
+	Client string
+	Geo    output.LookupResult
+}
+
+// mockShipper enriches events like the socket stage of a log shipper: it
+// writes the client address of every event on one connection while reading
+// the answers from it, and matches them to the events by their order.
+func mockShipper(conn net.Conn, events []shipperEvent) error {
+	writeErr := make(chan error, 1)
+	go func() {
+		w := bufio.NewWriter(conn)
+		for _, e := range events {
+			fmt.Fprintf(w, "%s\n", e.Client)
+		}
+		writeErr <- w.Flush()
+	}()
+
+	r := bufio.NewReader(conn)
+	for i := range events {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return fmt.Errorf("answer %d: %w", i, err)
+		}
+		if err := json.Unmarshal(line, &events[i].Geo); err != nil {
+			return fmt.Errorf("answer %d %q: %w", i, line, err)
+		}
+	}
+	return <-writeErr
+}
+
+func TestServeLinesJSON(t *testing.T) {
+	srv := newTestServer(t)
+
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for _, network := range []string{"tcp", "unix"} {
+		addr := "127.0.0.1:0"
+		if network == "unix" {
+			addr = filepath.Join(tmpDir, "ip2cc.sock")
+		}
+		l, err := net.Listen(network, addr)
+		if err != nil {
+			t.Fatalf("Listen(%s) failed: %v", network, err)
+		}
+		done := make(chan error, 1)
+		go func() { done <- srv.ServeLinesJSON(context.Background(), l) }()
+
+		conn, err := net.Dial(network, l.Addr().String())
+		if err != nil {
+			t.Fatalf("Dial(%s) failed: %v", network, err)
+		}
+
+		// Enough events that answers are read while requests are written
+		var events []shipperEvent
+		for i := 0; i < 2000; i++ {
+			client := []string{"8.8.8.8", " 1.1.1.1", "", "not-an-ip", "8.8.8.0/25"}[i%5]
+			events = append(events, shipperEvent{Client: client})
+		}
+		if err := mockShipper(conn, events); err != nil {
+			t.Fatalf("mockShipper(%s) failed: %v", network, err)
+		}
+		conn.Close()
+
+		for i, e := range events {
+			var expectIP, expectCC string
+			expectError := true
+			switch i % 5 {
+			case 0:
+				expectIP, expectCC, expectError = "8.8.8.8", "US", false
+			case 1:
+				expectIP = "1.1.1.1"
+			case 3:
+				expectIP = "not-an-ip"
+			case 4:
+				expectIP, expectCC, expectError = "8.8.8.0/25", "US", false
+			}
+			if e.Geo.IP != expectIP || e.Geo.CountryCode != expectCC || (e.Geo.Error != "") != expectError {
+				t.Fatalf("%s event %d (%q) = ip %q, country %q, error %q", network, i, e.Client, e.Geo.IP, e.Geo.CountryCode, e.Geo.Error)
+			}
+		}
+
+		l.Close()
+		if err := <-done; err != nil {
+			t.Errorf("ServeLinesJSON(%s) after close = %v, expected nil", network, err)
+		}
+	}
+}
+
+func TestHandleBulkLookup(t *testing.T) {
+	srv := newTestServer(t)
+
+	tests := []struct {
+		body        string
+		contentType string
+		accept      string
+	}{
+		{`["8.8.8.8", "1.1.1.1", "8.8.8.8", "not-an-ip"]`, "application/json", ""},
+		{"8.8.8.8\n1.1.1.1\n\n8.8.8.8\nnot-an-ip\n", "text/plain", ""},
+		{`["8.8.8.8", "1.1.1.1", "8.8.8.8", "not-an-ip"]`, "application/json; charset=utf-8", "application/x-ndjson"},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/lookup", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", tc.contentType)
+		req.Header.Set("Accept", tc.accept)
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("POST /lookup status = %d, expected %d: %s", rec.Code, http.StatusOK, rec.Body)
+		}
+		var results []output.LookupResult
+		if tc.accept != "" {
+			if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+				t.Errorf("Content-Type = %q, expected application/x-ndjson", ct)
+			}
+			for _, line := range strings.Split(strings.TrimSpace(rec.Body.String()), "\n") {
+				var result output.LookupResult
+				if err := json.Unmarshal([]byte(line), &result); err != nil {
+					t.Fatalf("Invalid NDJSON line %q: %v", line, err)
+				}
+				results = append(results, result)
+			}
+		} else if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+			t.Fatalf("Invalid JSON: %v", err)
+		}
+
+		var got []string
+		for _, r := range results {
+			got = append(got, r.IP+"="+r.CountryCode)
+		}
+		if s := strings.Join(got, ","); s != "8.8.8.8=US,1.1.1.1=,8.8.8.8=US,not-an-ip=" {
+			t.Errorf("POST /lookup (%s) = %s", tc.contentType, s)
+		}
+		if results[1].Error == "" || results[3].Error == "" {
+			t.Errorf("Expected errors for 1.1.1.1 and not-an-ip, got %q and %q", results[1].Error, results[3].Error)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/lookup", strings.NewReader(`{"ip": "8.8.8.8"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("POST /lookup with a JSON object status = %d, expected %d", rec.Code, http.StatusBadRequest)
+	}
+
+	// Lists of lines are bounded like JSON bodies
+	req = httptest.NewRequest(http.MethodPost, "/lookup", strings.NewReader(strings.Repeat("8.8.8.8\n", MaxBulkBody/8+1)))
+	req.Header.Set("Content-Type", "text/plain")
+	rec = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("POST /lookup with a large body status = %d, expected %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestGuard(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetAPIKeys([]string{"secret-1", "secret-2"})
+	now := srv.now()
+	srv.now = func() time.Time { return now }
+	srv.SetRateLimit(1, 2)
+	handler := srv.Handler()
+
+	get := func(header, value, remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/lookup/8.8.8.8", nil)
+		req.RemoteAddr = remote
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, tc := range []struct{ header, value string }{{"", ""}, {"X-API-Key", "wrong"}, {"Authorization", "secret-1"}} {
+		if rec := get(tc.header, tc.value, "192.0.2.1:1000"); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s %q status = %d, expected %d", tc.header, tc.value, rec.Code, http.StatusUnauthorized)
+		}
+	}
+
+	// The burst of the first key is used up from two addresses
+	for _, remote := range []string{"192.0.2.1:1000", "192.0.2.2:1000"} {
+		if rec := get("Authorization", "Bearer secret-1", remote); rec.Code != http.StatusOK {
+			t.Errorf("Request from %s status = %d, expected %d", remote, rec.Code, http.StatusOK)
+		}
+	}
+	rec := get("X-API-Key", "secret-1", "192.0.2.3:1000")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("Request over the limit status = %d, Retry-After %q, expected %d, 1", rec.Code, rec.Header().Get("Retry-After"), http.StatusTooManyRequests)
+	}
+	if rec := get("X-API-Key", "secret-2", "192.0.2.3:1000"); rec.Code != http.StatusOK {
+		t.Errorf("Request with another key status = %d, expected %d", rec.Code, http.StatusOK)
+	}
+
+	now = now.Add(time.Second)
+	if rec := get("X-API-Key", "secret-1", "192.0.2.3:1000"); rec.Code != http.StatusOK {
+		t.Errorf("Request after a second status = %d, expected %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestGuardExtraRoutes(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetAPIKeys([]string{"secret"})
+	srv.Handle("/debug/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("debug"))
+	}))
+	handler := srv.Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Request without key status = %d, expected %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+	req.Header.Set("X-API-Key", "secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "debug" {
+		t.Errorf("Request with key = %d %q, expected %d \"debug\"", rec.Code, rec.Body.String(), http.StatusOK)
+	}
+}
+
+func TestRateLimitByAddress(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetRateLimit(0.5, 1)
+	handler := srv.Handler()
+
+	codes := make([]int, 0, 3)
+	for _, remote := range []string{"192.0.2.1:1000", "192.0.2.1:2000", "[2001:db8::1]:1000"} {
+		req := httptest.NewRequest(http.MethodGet, "/snapshot", nil)
+		req.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests || codes[2] != http.StatusOK {
+		t.Errorf("Status codes = %v, expected [200 429 200]", codes)
+	}
+}
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1 and its key
+// to dir, named after name, and returns the certificate.
+func writeTestCert(t *testing.T, dir, name string, serial int64) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(filepath.Join(dir, name+".crt"), certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestTLS(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	first := writeTestCert(t, tmpDir, "server", 1)
+	writeTestCert(t, tmpDir, "client", 3)
+	certFile, keyFile := filepath.Join(tmpDir, "server.crt"), filepath.Join(tmpDir, "server.key")
+	serverTLS, err := NewTLS(certFile, keyFile, filepath.Join(tmpDir, "client.crt"))
+	if err != nil {
+		t.Fatalf("NewTLS failed: %v", err)
+	}
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", serverTLS.Config())
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer l.Close()
+	go http.Serve(l, newTestServer(t).Handler())
+
+	roots := x509.NewCertPool()
+	roots.AddCert(first)
+	clientCert, err := tls.LoadX509KeyPair(filepath.Join(tmpDir, "client.crt"), filepath.Join(tmpDir, "client.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// serial connects with or without the client certificate and returns
+	// the serial number of the server certificate
+	serial := func(withCert bool) (int64, error) {
+		config := &tls.Config{RootCAs: roots}
+		if withCert {
+			config.Certificates = []tls.Certificate{clientCert}
+		}
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+		defer c.CloseIdleConnections()
+		resp, err := c.Get("https://" + l.Addr().String() + "/snapshot")
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return 0, fmt.Errorf("status %d", resp.StatusCode)
+		}
+		return resp.TLS.PeerCertificates[0].SerialNumber.Int64(), nil
+	}
+
+	if n, err := serial(true); err != nil || n != 1 {
+		t.Fatalf("Request = serial %d, %v, expected serial 1", n, err)
+	}
+	if _, err := serial(false); err == nil {
+		t.Error("Request without a client certificate succeeded")
+	}
+
+	second := writeTestCert(t, tmpDir, "server", 2)
+	roots.AddCert(second)
+	if err := serverTLS.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if n, err := serial(true); err != nil || n != 2 {
+		t.Errorf("Request after reload = serial %d, %v, expected serial 2", n, err)
+	}
+
+	os.WriteFile(keyFile, []byte("garbage"), 0600)
+	if err := serverTLS.Reload(); err == nil {
+		t.Error("Reload of a broken key succeeded")
+	}
+	if n, err := serial(true); err != nil || n != 2 {
+		t.Errorf("Request after failed reload = serial %d, %v, expected serial 2", n, err)
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetAPIKeys([]string{"secret"})
+	srv.SetSwaggerUI(true)
+	handler := srv.Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.json status = %d, expected %d", rec.Code, http.StatusOK)
+	}
+
+	var doc struct {
+		OpenAPI    string                                `json:"openapi"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas         map[string]json.RawMessage `json:"schemas"`
+			SecuritySchemes map[string]json.RawMessage `json:"securitySchemes"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if doc.OpenAPI != "3.1.0" {
+		t.Errorf("openapi = %q, expected 3.1.0", doc.OpenAPI)
+	}
+
+	// Every route of the handler is described
+	for path, method := range map[string]string{"/lookup/{ip}": "get", "/lookup": "post", "/snapshot": "get"} {
+		if _, ok := doc.Paths[path][method]; !ok {
+			t.Errorf("Missing operation %s %s", method, path)
+		}
+	}
+	for _, name := range []string{"LookupResult", "Provider", "Geolocation", "Timing", "SnapshotInfo", "Error"} {
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("Missing schema %s", name)
+		}
+	}
+	if len(doc.Components.SecuritySchemes) != 2 {
+		t.Errorf("securitySchemes = %d, expected 2", len(doc.Components.SecuritySchemes))
+	}
+
+	// References all resolve to a schema of the document
+	for _, ref := range strings.Split(rec.Body.String(), `"$ref": "`)[1:] {
+		ref = ref[:strings.Index(ref, `"`)]
+		name, ok := strings.CutPrefix(ref, "#/components/schemas/")
+		if _, found := doc.Components.Schemas[name]; !ok || !found {
+			t.Errorf("Unresolved reference %s", ref)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "openapi.json") {
+		t.Errorf("GET /docs status = %d, expected the Swagger UI page", rec.Code)
+	}
+}
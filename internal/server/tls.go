@@ -0,0 +1,77 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// TLS serves a certificate and optionally requires client certificates
+// signed by the CAs in a file. Reload reads the files again, so renewed
+// certificates are picked up without a restart.
+type TLS struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+	state        atomic.Pointer[tlsState]
+}
+
+type tlsState struct {
+	cert      tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+// NewTLS loads the certificate and key, and the client CAs if clientCAFile
+// is not empty.
+func NewTLS(certFile, keyFile, clientCAFile string) (*TLS, error) {
+	t := &TLS{certFile: certFile, keyFile: keyFile, clientCAFile: clientCAFile}
+	if err := t.Reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Reload reads the files again. On error the files loaded before stay in
+// use.
+func (t *TLS) Reload() error {
+	cert, err := tls.LoadX509KeyPair(t.certFile, t.keyFile)
+	if err != nil {
+		return fmt.Errorf("load TLS certificate: %w", err)
+	}
+	st := &tlsState{cert: cert}
+	if t.clientCAFile != "" {
+		data, err := os.ReadFile(t.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("load client CAs: %w", err)
+		}
+		st.clientCAs = x509.NewCertPool()
+		if !st.clientCAs.AppendCertsFromPEM(data) {
+			return fmt.Errorf("load client CAs: no certificates in %s", t.clientCAFile)
+		}
+	}
+	t.state.Store(st)
+	return nil
+}
+
+// Config returns a server configuration that uses the files loaded last
+// for every new connection.
+func (t *TLS) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			st := t.state.Load()
+			c := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{st.cert},
+				NextProtos:   []string{"h2", "http/1.1"},
+			}
+			if st.clientCAs != nil {
+				c.ClientCAs = st.clientCAs
+				c.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return c, nil
+		},
+	}
+}
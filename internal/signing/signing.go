@@ -0,0 +1,206 @@
+// Package signing signs and verifies snapshot archives with Ed25519.
+//
+// Public keys and signatures use the minisign format, so archives can also
+// be checked with `minisign -V -P <key> -m <archive>`. Signatures are the
+// legacy "Ed" algorithm (signature over the raw file). Secret keys are
+// stored unencrypted in a minisign-like text file and must be kept private.
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// SignatureExtension is appended to a file name to get its signature file.
+	SignatureExtension = ".minisig"
+
+	// PublicKeyExtension is appended to a secret key path to get its public key file.
+	PublicKeyExtension = ".pub"
+
+	untrustedPrefix = "untrusted comment: "
+	trustedPrefix   = "trusted comment: "
+)
+
+var algorithm = [2]byte{'E', 'd'}
+
+// ErrUntrusted is returned when a signature was made by a key that is not trusted.
+var ErrUntrusted = errors.New("signature made by an untrusted key")
+
+// PublicKey is an Ed25519 public key with its minisign key ID.
+type PublicKey struct {
+	ID  [8]byte
+	Key ed25519.PublicKey
+}
+
+// SecretKey is an Ed25519 private key with its minisign key ID.
+type SecretKey struct {
+	ID  [8]byte
+	Key ed25519.PrivateKey
+}
+
+// GenerateKey creates a new key pair with a random key ID.
+func GenerateKey() (*PublicKey, *SecretKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, nil, err
+	}
+	return &PublicKey{ID: id, Key: pub}, &SecretKey{ID: id, Key: priv}, nil
+}
+
+// KeyID returns the key ID as shown by minisign.
+func (pk *PublicKey) KeyID() string {
+	return fmt.Sprintf("%X", reverse(pk.ID))
+}
+
+// String returns the base64 encoded key as used in trusted_keys and .pub files.
+func (pk *PublicKey) String() string {
+	buf := make([]byte, 0, 42)
+	buf = append(buf, algorithm[:]...)
+	buf = append(buf, pk.ID[:]...)
+	buf = append(buf, pk.Key...)
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+// Encode returns the contents of a minisign public key file.
+func (pk *PublicKey) Encode() []byte {
+	return []byte(untrustedPrefix + "minisign public key " + pk.KeyID() + "\n" + pk.String() + "\n")
+}
+
+// ParsePublicKey parses a base64 public key or the contents of a .pub file.
+func ParsePublicKey(s string) (*PublicKey, error) {
+	raw, err := decodeLine(lastLine(s))
+	if err != nil {
+		return nil, fmt.Errorf("decode public key: %w", err)
+	}
+	if len(raw) != 42 || !bytes.Equal(raw[:2], algorithm[:]) {
+		return nil, fmt.Errorf("invalid public key")
+	}
+	pk := &PublicKey{Key: ed25519.PublicKey(raw[10:])}
+	copy(pk.ID[:], raw[2:10])
+	return pk, nil
+}
+
+// Public returns the public half of the key.
+func (sk *SecretKey) Public() *PublicKey {
+	return &PublicKey{ID: sk.ID, Key: sk.Key.Public().(ed25519.PublicKey)}
+}
+
+// Save writes the secret key to path, readable only by the owner.
+func (sk *SecretKey) Save(path string) error {
+	buf := make([]byte, 0, 74)
+	buf = append(buf, algorithm[:]...)
+	buf = append(buf, sk.ID[:]...)
+	buf = append(buf, sk.Key...)
+	data := untrustedPrefix + "ip2cc secret key " + sk.Public().KeyID() + "\n" +
+		base64.StdEncoding.EncodeToString(buf) + "\n"
+	return os.WriteFile(path, []byte(data), 0600)
+}
+
+// LoadSecretKey reads a secret key written by Save.
+func LoadSecretKey(path string) (*SecretKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := decodeLine(lastLine(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("decode secret key: %w", err)
+	}
+	if len(raw) != 10+ed25519.PrivateKeySize || !bytes.Equal(raw[:2], algorithm[:]) {
+		return nil, fmt.Errorf("invalid secret key")
+	}
+	sk := &SecretKey{Key: ed25519.PrivateKey(raw[10:])}
+	copy(sk.ID[:], raw[2:10])
+	return sk, nil
+}
+
+// Sign returns a minisign signature file for data. The trusted comment is
+// covered by the signature.
+func Sign(sk *SecretKey, data []byte, trustedComment string) []byte {
+	sig := ed25519.Sign(sk.Key, data)
+	globalSig := ed25519.Sign(sk.Key, append(append([]byte{}, sig...), trustedComment...))
+
+	line := make([]byte, 0, 74)
+	line = append(line, algorithm[:]...)
+	line = append(line, sk.ID[:]...)
+	line = append(line, sig...)
+
+	var buf bytes.Buffer
+	buf.WriteString(untrustedPrefix + "signature from ip2cc secret key\n")
+	buf.WriteString(base64.StdEncoding.EncodeToString(line) + "\n")
+	buf.WriteString(trustedPrefix + trustedComment + "\n")
+	buf.WriteString(base64.StdEncoding.EncodeToString(globalSig) + "\n")
+	return buf.Bytes()
+}
+
+// Verify checks a minisign signature of data against the trusted keys and
+// returns the key that made it and the trusted comment.
+func Verify(keys []*PublicKey, data, signature []byte) (*PublicKey, string, error) {
+	lines := strings.Split(strings.TrimRight(string(signature), "\r\n"), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[2], trustedPrefix) {
+		return nil, "", fmt.Errorf("malformed signature file")
+	}
+
+	line, err := decodeLine(lines[1])
+	if err != nil || len(line) != 10+ed25519.SignatureSize {
+		return nil, "", fmt.Errorf("malformed signature")
+	}
+	if !bytes.Equal(line[:2], algorithm[:]) {
+		return nil, "", fmt.Errorf("unsupported signature algorithm %q", line[:2])
+	}
+	var id [8]byte
+	copy(id[:], line[2:10])
+	sig := line[10:]
+
+	var key *PublicKey
+	for _, k := range keys {
+		if k.ID == id {
+			key = k
+			break
+		}
+	}
+	if key == nil {
+		return nil, "", ErrUntrusted
+	}
+
+	if !ed25519.Verify(key.Key, data, sig) {
+		return nil, "", fmt.Errorf("signature verification failed")
+	}
+
+	trustedComment := strings.TrimSuffix(strings.TrimPrefix(lines[2], trustedPrefix), "\r")
+	globalSig, err := decodeLine(lines[3])
+	if err != nil || !ed25519.Verify(key.Key, append(append([]byte{}, sig...), trustedComment...), globalSig) {
+		return nil, "", fmt.Errorf("trusted comment verification failed")
+	}
+
+	return key, trustedComment, nil
+}
+
+func decodeLine(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return lines[len(lines)-1]
+}
+
+// reverse returns the key ID in the byte order minisign prints it.
+func reverse(id [8]byte) []byte {
+	out := make([]byte, 8)
+	for i := range id {
+		out[i] = id[7-i]
+	}
+	return out
+}
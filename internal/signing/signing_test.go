@@ -0,0 +1,89 @@
+package signing
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSignVerify(t *testing.T) {
+	pk, sk, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	data := []byte("snapshot archive contents")
+
+	sig := Sign(sk, data, "ip2cc snapshot 2025-01-01")
+	key, comment, err := Verify([]*PublicKey{pk}, data, sig)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if key.ID != pk.ID {
+		t.Errorf("key ID = %s, expected %s", key.KeyID(), pk.KeyID())
+	}
+	if comment != "ip2cc snapshot 2025-01-01" {
+		t.Errorf("comment = %q, expected %q", comment, "ip2cc snapshot 2025-01-01")
+	}
+
+	// Tampered data
+	if _, _, err := Verify([]*PublicKey{pk}, []byte("tampered"), sig); err == nil {
+		t.Error("Verify should fail for tampered data")
+	}
+
+	// Tampered trusted comment
+	forged := strings.Replace(string(sig), "2025-01-01", "2099-01-01", 1)
+	if _, _, err := Verify([]*PublicKey{pk}, data, []byte(forged)); err == nil {
+		t.Error("Verify should fail for a modified trusted comment")
+	}
+
+	// Untrusted key
+	other, _, _ := GenerateKey()
+	if _, _, err := Verify([]*PublicKey{other}, data, sig); err != ErrUntrusted {
+		t.Errorf("Verify error = %v, expected %v", err, ErrUntrusted)
+	}
+}
+
+func TestKeyFiles(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	pk, sk, _ := GenerateKey()
+	path := filepath.Join(tmpDir, "ip2cc.key")
+	if err := sk.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := LoadSecretKey(path)
+	if err != nil {
+		t.Fatalf("LoadSecretKey failed: %v", err)
+	}
+	if loaded.Public().String() != pk.String() {
+		t.Errorf("loaded public key = %s, expected %s", loaded.Public().String(), pk.String())
+	}
+
+	// Both the bare key and a full .pub file parse
+	for _, s := range []string{pk.String(), string(pk.Encode())} {
+		parsed, err := ParsePublicKey(s)
+		if err != nil {
+			t.Fatalf("ParsePublicKey(%q) failed: %v", s, err)
+		}
+		if parsed.String() != pk.String() {
+			t.Errorf("ParsePublicKey = %s, expected %s", parsed.String(), pk.String())
+		}
+	}
+}
+
+func TestParseMinisignPublicKey(t *testing.T) {
+	// Example key from the minisign documentation
+	pk, err := ParsePublicKey("RWQf6LRCGA9i53mlYecO4IzT51TGPpvWucNSCh1CBM0QTaLn73Y7GFO3")
+	if err != nil {
+		t.Fatalf("ParsePublicKey failed: %v", err)
+	}
+	if pk.KeyID() != "E7620F1842B4E81F" {
+		t.Errorf("KeyID = %s, expected E7620F1842B4E81F", pk.KeyID())
+	}
+}
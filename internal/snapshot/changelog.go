@@ -0,0 +1,90 @@
+package snapshot
+
+import (
+	"net/netip"
+	"sort"
+
+	"github.com/hightemp/ip2cc/internal/index"
+)
+
+// Changelog summarizes how a snapshot differs from the one before it.
+type Changelog struct {
+	Previous  string                   `json:"previous"`
+	Added     int                      `json:"added"`
+	Removed   int                      `json:"removed"`
+	Countries map[string]CountryChange `json:"countries,omitempty"`
+}
+
+// CountryChange counts prefixes added and removed for one country.
+type CountryChange struct {
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+}
+
+// ComputeChangelog compares the tries of the previous snapshot with the
+// freshly built ones. A prefix that moved to another country is counted as
+// removed from the old country and added to the new one.
+func ComputeChangelog(previous string, oldV4, oldV6, newV4, newV6 *index.Trie) *Changelog {
+	cl := &Changelog{
+		Previous:  previous,
+		Countries: make(map[string]CountryChange),
+	}
+	cl.diff(oldV4, newV4)
+	cl.diff(oldV6, newV6)
+	return cl
+}
+
+func (cl *Changelog) diff(oldTrie, newTrie *index.Trie) {
+	old := make(map[netip.Prefix]string)
+	if oldTrie != nil {
+		prefixes, data := oldTrie.Export()
+		for i, p := range prefixes {
+			old[p] = data[i].CountryCode
+		}
+	}
+
+	if newTrie != nil {
+		prefixes, data := newTrie.Export()
+		for i, p := range prefixes {
+			cc := data[i].CountryCode
+			prev, ok := old[p]
+			delete(old, p)
+			if ok && prev == cc {
+				continue
+			}
+			if ok {
+				cl.record(prev, 0, 1)
+			}
+			cl.record(cc, 1, 0)
+		}
+	}
+
+	for _, cc := range old {
+		cl.record(cc, 0, 1)
+	}
+}
+
+func (cl *Changelog) record(cc string, added, removed int) {
+	c := cl.Countries[cc]
+	c.Added += added
+	c.Removed += removed
+	cl.Countries[cc] = c
+	cl.Added += added
+	cl.Removed += removed
+}
+
+// CountryCodes returns the changed countries sorted by total churn, largest first.
+func (cl *Changelog) CountryCodes() []string {
+	codes := make([]string, 0, len(cl.Countries))
+	for cc := range cl.Countries {
+		codes = append(codes, cc)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		a, b := cl.Countries[codes[i]], cl.Countries[codes[j]]
+		if a.Added+a.Removed != b.Added+b.Removed {
+			return a.Added+a.Removed > b.Added+b.Removed
+		}
+		return codes[i] < codes[j]
+	})
+	return codes
+}
@@ -0,0 +1,114 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hightemp/ip2cc/internal/index"
+)
+
+func TestComputeChangelog(t *testing.T) {
+	oldV4 := index.NewTrie(false)
+	oldV4.InsertCIDR("1.0.0.0/24", "AU")
+	oldV4.InsertCIDR("2.0.0.0/16", "FR")
+	oldV4.InsertCIDR("3.0.0.0/8", "US")
+
+	newV4 := index.NewTrie(false)
+	newV4.InsertCIDR("1.0.0.0/24", "AU") // unchanged
+	newV4.InsertCIDR("2.0.0.0/16", "DE") // moved FR -> DE
+	newV4.InsertCIDR("4.0.0.0/8", "US")  // 3.0.0.0/8 replaced
+
+	newV6 := index.NewTrie(true)
+	newV6.InsertCIDR("2001:db8::/32", "DE")
+
+	cl := ComputeChangelog("2025-01-01", oldV4, nil, newV4, newV6)
+
+	if cl.Previous != "2025-01-01" {
+		t.Errorf("Previous = %s, expected 2025-01-01", cl.Previous)
+	}
+	if cl.Added != 3 || cl.Removed != 2 {
+		t.Errorf("Added/Removed = %d/%d, expected 3/2", cl.Added, cl.Removed)
+	}
+
+	expected := map[string]CountryChange{
+		"DE": {Added: 2},
+		"FR": {Removed: 1},
+		"US": {Added: 1, Removed: 1},
+	}
+	if len(cl.Countries) != len(expected) {
+		t.Errorf("Countries = %v, expected %v", cl.Countries, expected)
+	}
+	for cc, want := range expected {
+		if got := cl.Countries[cc]; got != want {
+			t.Errorf("Countries[%s] = %+v, expected %+v", cc, got, want)
+		}
+	}
+
+	codes := cl.CountryCodes()
+	if len(codes) != 3 || codes[0] != "DE" || codes[1] != "US" || codes[2] != "FR" {
+		t.Errorf("CountryCodes() = %v, expected [DE US FR]", codes)
+	}
+}
+
+func TestManagerPreviousSnapshot(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mgr := NewManager(tmpDir)
+	for _, date := range []string{"2025-01-01", "2025-01-10", "2025-01-20"} {
+		dir, _ := mgr.CreateSnapshot(date)
+		NewMetadata().Save(filepath.Join(dir, "metadata.json"))
+	}
+
+	if prev, ok := mgr.PreviousSnapshot("2025-01-15"); !ok || prev != "2025-01-10" {
+		t.Errorf("PreviousSnapshot(2025-01-15) = %s, %v, expected 2025-01-10, true", prev, ok)
+	}
+	if prev, ok := mgr.PreviousSnapshot("2025-01-20"); !ok || prev != "2025-01-10" {
+		t.Errorf("PreviousSnapshot(2025-01-20) = %s, %v, expected 2025-01-10, true", prev, ok)
+	}
+	if _, ok := mgr.PreviousSnapshot("2025-01-01"); ok {
+		t.Error("PreviousSnapshot(2025-01-01) should find nothing")
+	}
+}
+
+func TestManagerNearestSnapshot(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mgr := NewManager(tmpDir)
+	if _, err := mgr.NearestSnapshot("2025-01-15"); err == nil {
+		t.Error("NearestSnapshot should fail without snapshots")
+	}
+	for _, date := range []string{"2024-12-28", "2025-01-10", "2025-01-20"} {
+		dir, _ := mgr.CreateSnapshot(date)
+		NewMetadata().Save(filepath.Join(dir, "metadata.json"))
+	}
+	// Without metadata a snapshot is not complete
+	mgr.CreateSnapshot("2025-01-14")
+
+	tests := []struct {
+		date    string
+		nearest string
+	}{
+		{"2025-01-10", "2025-01-10"},
+		{"2025-01-16", "2025-01-20"},
+		{"2025-01-15", "2025-01-10"}, // a tie goes to the earlier date
+		{"2025-01-03", "2024-12-28"}, // across a month boundary
+		{"2030-01-01", "2025-01-20"},
+	}
+	for _, tt := range tests {
+		if got, err := mgr.NearestSnapshot(tt.date); err != nil || got != tt.nearest {
+			t.Errorf("NearestSnapshot(%s) = %s, %v, expected %s", tt.date, got, err, tt.nearest)
+		}
+	}
+	if _, err := mgr.NearestSnapshot("2025-13-01"); err == nil {
+		t.Error("NearestSnapshot should reject an invalid date")
+	}
+}
@@ -0,0 +1,105 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"net/netip"
+	"os"
+
+	"github.com/hightemp/ip2cc/internal/index"
+)
+
+// Conflicts reports where the country data of a snapshot disagrees with
+// itself, for auditing.
+type Conflicts struct {
+	// Nested lists prefixes of another country than the most specific
+	// prefix covering them. Lookups report the inner country.
+	Nested []NestedConflict `json:"nested"`
+	// Duplicates lists prefixes listed under several countries. The index
+	// keeps the alphabetically last one.
+	Duplicates []DuplicateConflict `json:"duplicates"`
+}
+
+// NestedConflict is a prefix nested in a prefix of another country.
+type NestedConflict struct {
+	Prefix          string `json:"prefix"`
+	Country         string `json:"country"`
+	Covering        string `json:"covering"`
+	CoveringCountry string `json:"covering_country"`
+}
+
+// DuplicateConflict is a prefix listed under several countries.
+type DuplicateConflict struct {
+	Prefix    string   `json:"prefix"`
+	Countries []string `json:"countries"`
+	Kept      string   `json:"kept"`
+}
+
+// ComputeConflicts finds the nested conflicts of the tries and adds the
+// duplicates the builders saw.
+func ComputeConflicts(v4, v6 *index.Trie, duplicates []index.Duplicate) *Conflicts {
+	c := &Conflicts{
+		Nested:     []NestedConflict{},
+		Duplicates: make([]DuplicateConflict, 0, len(duplicates)),
+	}
+	c.findNested(v4)
+	c.findNested(v6)
+	for _, d := range duplicates {
+		c.Duplicates = append(c.Duplicates, DuplicateConflict{
+			Prefix:    d.Prefix.String(),
+			Countries: d.Countries,
+			Kept:      d.Countries[len(d.Countries)-1],
+		})
+	}
+	return c
+}
+
+func (c *Conflicts) findNested(trie *index.Trie) {
+	if trie == nil {
+		return
+	}
+	type entry struct {
+		prefix netip.Prefix
+		cc     string
+	}
+	// Export lists covering prefixes first, so open holds the prefixes
+	// containing the current one, outermost first
+	var open []entry
+	prefixes, data := trie.Export()
+	for i, p := range prefixes {
+		for len(open) > 0 && !open[len(open)-1].prefix.Contains(p.Addr()) {
+			open = open[:len(open)-1]
+		}
+		cc := data[i].CountryCode
+		if n := len(open); n > 0 && open[n-1].cc != cc {
+			c.Nested = append(c.Nested, NestedConflict{
+				Prefix:          p.String(),
+				Country:         cc,
+				Covering:        open[n-1].prefix.String(),
+				CoveringCountry: open[n-1].cc,
+			})
+		}
+		open = append(open, entry{p, cc})
+	}
+}
+
+// LoadConflicts reads a report written by Save.
+func LoadConflicts(path string) (*Conflicts, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Conflicts
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Save writes the report to a file.
+func (c *Conflicts) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
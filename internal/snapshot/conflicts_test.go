@@ -0,0 +1,62 @@
+package snapshot
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hightemp/ip2cc/internal/index"
+)
+
+func TestComputeConflicts(t *testing.T) {
+	v4 := index.NewTrie(false)
+	v4.InsertCIDR("10.0.0.0/8", "US")
+	v4.InsertCIDR("10.1.0.0/16", "US")    // same country: no conflict
+	v4.InsertCIDR("10.1.2.0/24", "DE")    // nested in 10.1.0.0/16
+	v4.InsertCIDR("10.1.2.128/25", "DE")  // nested in a prefix of its country
+	v4.InsertCIDR("10.2.0.0/16", "CA")    // nested in 10.0.0.0/8
+	v4.InsertCIDR("192.168.0.0/16", "NL") // not nested
+
+	v6 := index.NewTrie(true)
+	v6.InsertCIDR("2001:db8::/32", "DE")
+	v6.InsertCIDR("2001:db8:1::/48", "FR")
+
+	dups := []index.Duplicate{{Prefix: netip.MustParsePrefix("10.3.0.0/16"), Countries: []string{"AT", "DE"}}}
+	c := ComputeConflicts(v4, v6, dups)
+
+	expected := []NestedConflict{
+		{"10.1.2.0/24", "DE", "10.1.0.0/16", "US"},
+		{"10.2.0.0/16", "CA", "10.0.0.0/8", "US"},
+		{"2001:db8:1::/48", "FR", "2001:db8::/32", "DE"},
+	}
+	if len(c.Nested) != len(expected) {
+		t.Fatalf("Nested = %+v, expected %+v", c.Nested, expected)
+	}
+	for i, want := range expected {
+		if c.Nested[i] != want {
+			t.Errorf("Nested[%d] = %+v, expected %+v", i, c.Nested[i], want)
+		}
+	}
+	if len(c.Duplicates) != 1 || c.Duplicates[0].Prefix != "10.3.0.0/16" || c.Duplicates[0].Kept != "DE" {
+		t.Errorf("Duplicates = %+v, expected 10.3.0.0/16 kept as DE", c.Duplicates)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "conflicts.json")
+	if err := c.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	loaded, err := LoadConflicts(path)
+	if err != nil {
+		t.Fatalf("LoadConflicts failed: %v", err)
+	}
+	if len(loaded.Nested) != 3 || len(loaded.Duplicates) != 1 {
+		t.Errorf("Saved report = %+v, expected 3 nested and 1 duplicate conflicts", loaded)
+	}
+}
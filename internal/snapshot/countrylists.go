@@ -0,0 +1,92 @@
+package snapshot
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// CountryList holds the prefixes the source listed for a country. Unlike
+// the index, which keeps one country per prefix, it keeps every prefix of
+// the country, so that an unchanged country can be reused as it was.
+type CountryList struct {
+	CountryCode string   `json:"country_code"`
+	IPv4        []string `json:"ipv4"`
+	IPv6        []string `json:"ipv6"`
+}
+
+// CountryListWriter writes the country lists of a snapshot one country at
+// a time, as gzip-compressed JSON lines.
+type CountryListWriter struct {
+	path string
+	f    *os.File
+	gz   *gzip.Writer
+	enc  *json.Encoder
+}
+
+// CreateCountryLists starts writing country lists to path. They are
+// written next to it and only replace it on Close.
+func CreateCountryLists(path string) (*CountryListWriter, error) {
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(f)
+	return &CountryListWriter{path: path, f: f, gz: gz, enc: json.NewEncoder(gz)}, nil
+}
+
+// Write adds the list of a country.
+func (w *CountryListWriter) Write(list CountryList) error {
+	return w.enc.Encode(list)
+}
+
+// Close finishes the file and moves it to its path.
+func (w *CountryListWriter) Close() error {
+	err := w.gz.Close()
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(w.f.Name())
+		return err
+	}
+	return os.Rename(w.f.Name(), w.path)
+}
+
+// Abort discards the lists written so far.
+func (w *CountryListWriter) Abort() {
+	w.f.Close()
+	os.Remove(w.f.Name())
+}
+
+// LoadCountryLists reads the country lists written by a
+// CountryListWriter, keyed by uppercase country code.
+func LoadCountryLists(path string) (map[string]CountryList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	lists := make(map[string]CountryList)
+	dec := json.NewDecoder(gz)
+	for {
+		var list CountryList
+		if err := dec.Decode(&list); errors.Is(err, io.EOF) {
+			return lists, nil
+		} else if err != nil {
+			return nil, err
+		}
+		list.CountryCode = strings.ToUpper(list.CountryCode)
+		lists[list.CountryCode] = list
+	}
+}
@@ -0,0 +1,56 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCountryLists(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	path := filepath.Join(tmpDir, "country_lists.jsonl.gz")
+
+	// A prefix listed by two countries stays in both lists
+	w, err := CreateCountryLists(path)
+	if err != nil {
+		t.Fatalf("CreateCountryLists failed: %v", err)
+	}
+	w.Write(CountryList{CountryCode: "de", IPv4: []string{"193.0.0.0/21", "5.1.0.0/24"}})
+	w.Write(CountryList{CountryCode: "NL", IPv4: []string{"193.0.0.0/21"}, IPv6: []string{"2001:67c::/32"}})
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("lists exist before Close: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	lists, err := LoadCountryLists(path)
+	if err != nil {
+		t.Fatalf("LoadCountryLists failed: %v", err)
+	}
+	if len(lists) != 2 {
+		t.Fatalf("lists = %+v, expected DE and NL", lists)
+	}
+	if de := lists["DE"]; !slices.Equal(de.IPv4, []string{"193.0.0.0/21", "5.1.0.0/24"}) {
+		t.Errorf("DE IPv4 = %v, expected both prefixes", de.IPv4)
+	}
+	if nl := lists["NL"]; !slices.Equal(nl.IPv4, []string{"193.0.0.0/21"}) || !slices.Equal(nl.IPv6, []string{"2001:67c::/32"}) {
+		t.Errorf("NL = %+v, expected its own prefixes", nl)
+	}
+
+	// An aborted write leaves the previous lists in place
+	w, err = CreateCountryLists(path)
+	if err != nil {
+		t.Fatalf("CreateCountryLists failed: %v", err)
+	}
+	w.Write(CountryList{CountryCode: "FR"})
+	w.Abort()
+	if lists, err = LoadCountryLists(path); err != nil || len(lists) != 2 {
+		t.Errorf("lists after Abort = %+v (%v), expected DE and NL", lists, err)
+	}
+}
@@ -0,0 +1,76 @@
+package snapshot
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/hightemp/ip2cc/internal/config"
+	"github.com/hightemp/ip2cc/internal/index"
+)
+
+// Loaded is a snapshot read into memory.
+type Loaded struct {
+	Index *index.Index
+	Meta  *Metadata
+}
+
+// Load reads the metadata and index of the snapshot in dir.
+func Load(dir string) (*Loaded, error) {
+	meta, err := LoadMetadata(config.MetadataPath(dir))
+	if err != nil {
+		return nil, fmt.Errorf("load metadata: %w", err)
+	}
+	v4, v6, err := index.LoadIndex(config.IndexV4Path(dir), config.IndexV6Path(dir))
+	if err != nil {
+		return nil, fmt.Errorf("load index: %w", err)
+	}
+	return &Loaded{Index: &index.Index{V4: v4, V6: v6}, Meta: meta}, nil
+}
+
+// Database holds the snapshot a long-running process answers from. The
+// tries and metadata are replaced together, so a lookup never pairs the
+// index of one snapshot with the metadata of another, and lookups in
+// flight keep using the snapshot they started with.
+type Database struct {
+	current atomic.Pointer[Loaded]
+}
+
+// NewDatabase creates a database serving l.
+func NewDatabase(l *Loaded) *Database {
+	db := &Database{}
+	db.Swap(l)
+	return db
+}
+
+// OpenDatabase creates a database serving the snapshot in dir.
+func OpenDatabase(dir string) (*Database, error) {
+	l, err := Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	return NewDatabase(l), nil
+}
+
+// Current returns the snapshot currently being served.
+func (db *Database) Current() *Loaded {
+	return db.current.Load()
+}
+
+// Swap freezes the tries of l, publishes it, and returns the previous
+// snapshot.
+func (db *Database) Swap(l *Loaded) *Loaded {
+	l.Index.V4.Freeze()
+	l.Index.V6.Freeze()
+	return db.current.Swap(l)
+}
+
+// Reload reads the snapshot in dir and swaps it in. On error the current
+// snapshot stays in place.
+func (db *Database) Reload(dir string) error {
+	l, err := Load(dir)
+	if err != nil {
+		return err
+	}
+	db.Swap(l)
+	return nil
+}
@@ -0,0 +1,121 @@
+package snapshot
+
+import (
+	"net/netip"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/hightemp/ip2cc/internal/config"
+	"github.com/hightemp/ip2cc/internal/index"
+)
+
+func newTestLoaded(t *testing.T, cc, date string) *Loaded {
+	t.Helper()
+	ix := &index.Index{V4: index.NewTrie(false), V6: index.NewTrie(true)}
+	if err := ix.V4.InsertCIDR("8.8.8.0/24", cc); err != nil {
+		t.Fatalf("InsertCIDR failed: %v", err)
+	}
+	if err := ix.V6.InsertCIDR("2001:4860::/32", cc); err != nil {
+		t.Fatalf("InsertCIDR failed: %v", err)
+	}
+	meta := NewMetadata()
+	meta.RequestedTime = date
+	return &Loaded{Index: ix, Meta: meta}
+}
+
+func TestDatabaseSwapFreezes(t *testing.T) {
+	first := newTestLoaded(t, "US", "2025-01-01")
+	db := NewDatabase(first)
+
+	if err := first.Index.V4.InsertCIDR("1.0.0.0/8", "AU"); err != index.ErrFrozen {
+		t.Errorf("Insert into published trie error = %v, expected ErrFrozen", err)
+	}
+
+	second := newTestLoaded(t, "DE", "2025-02-01")
+	if prev := db.Swap(second); prev != first {
+		t.Error("Swap should return the previous snapshot")
+	}
+	if !second.Index.V4.Frozen() || !second.Index.V6.Frozen() {
+		t.Error("Swap should freeze the new tries")
+	}
+
+	current := db.Current()
+	data := current.Index.Lookup(netip.MustParseAddr("8.8.8.8"))
+	if data == nil || data.CountryCode != "DE" {
+		t.Errorf("Lookup after swap = %+v, expected DE", data)
+	}
+	if current.Meta.RequestedTime != "2025-02-01" {
+		t.Errorf("Meta after swap = %s, expected 2025-02-01", current.Meta.RequestedTime)
+	}
+}
+
+func TestDatabaseConcurrentSwap(t *testing.T) {
+	db := NewDatabase(newTestLoaded(t, "US", "2025-01-01"))
+	ip := netip.MustParseAddr("8.8.8.8")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				if data := db.Current().Index.Lookup(ip); data == nil {
+					t.Error("Lookup returned nil during swap")
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 50; i++ {
+		db.Swap(newTestLoaded(t, "DE", "2025-02-01"))
+	}
+	wg.Wait()
+}
+
+func TestDatabaseReload(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mgr := NewManager(tmpDir)
+	for date, cc := range map[string]string{"2025-01-01": "US", "2025-02-01": "DE"} {
+		dir, err := mgr.CreateSnapshot(date)
+		if err != nil {
+			t.Fatalf("CreateSnapshot failed: %v", err)
+		}
+		l := newTestLoaded(t, cc, date)
+		if err := index.SaveIndex(config.IndexV4Path(dir), config.IndexV6Path(dir), l.Index.V4, l.Index.V6); err != nil {
+			t.Fatalf("SaveIndex failed: %v", err)
+		}
+		if err := l.Meta.Save(config.MetadataPath(dir)); err != nil {
+			t.Fatalf("Save metadata failed: %v", err)
+		}
+	}
+
+	db, err := OpenDatabase(mgr.GetSnapshotDir("2025-01-01"))
+	if err != nil {
+		t.Fatalf("OpenDatabase failed: %v", err)
+	}
+	held := db.Current()
+
+	if err := db.Reload(mgr.GetSnapshotDir("2025-02-01")); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if got := db.Current().Meta.RequestedTime; got != "2025-02-01" {
+		t.Errorf("Snapshot after reload = %s, expected 2025-02-01", got)
+	}
+	if data := held.Index.Lookup(netip.MustParseAddr("8.8.8.8")); data == nil || data.CountryCode != "US" {
+		t.Errorf("Held snapshot lookup = %+v, expected US", data)
+	}
+
+	if err := db.Reload(mgr.GetSnapshotDir("2025-03-01")); err == nil {
+		t.Error("Reload of a missing snapshot should fail")
+	}
+	if got := db.Current().Meta.RequestedTime; got != "2025-02-01" {
+		t.Errorf("Snapshot after failed reload = %s, expected 2025-02-01", got)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/hightemp/ip2cc/internal/config"
 )
@@ -34,6 +35,23 @@ func (m *Manager) CreateSnapshot(date string) (string, error) {
 	return dir, nil
 }
 
+// Install moves a fully prepared snapshot directory into place for date,
+// replacing any existing snapshot for that date. The date must be
+// YYYY-MM-DD, as it names the directory that is replaced.
+func (m *Manager) Install(srcDir, date string) (string, error) {
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return "", fmt.Errorf("invalid snapshot date: %q", date)
+	}
+	dir := m.GetSnapshotDir(date)
+	if err := os.RemoveAll(dir); err != nil {
+		return "", fmt.Errorf("remove existing snapshot: %w", err)
+	}
+	if err := os.Rename(srcDir, dir); err != nil {
+		return "", fmt.Errorf("install snapshot: %w", err)
+	}
+	return dir, nil
+}
+
 // SnapshotExists checks if a snapshot exists for the given date.
 func (m *Manager) SnapshotExists(date string) bool {
 	dir := m.GetSnapshotDir(date)
@@ -127,15 +145,71 @@ func (m *Manager) ListSnapshots() ([]string, error) {
 	return dates, nil
 }
 
+// PreviousSnapshot returns the most recent snapshot date before date.
+func (m *Manager) PreviousSnapshot(date string) (string, bool) {
+	snapshots, err := m.ListSnapshots()
+	if err != nil {
+		return "", false
+	}
+
+	previous := ""
+	for _, d := range snapshots {
+		if d < date && d > previous && m.SnapshotExists(d) {
+			previous = d
+		}
+	}
+	return previous, previous != ""
+}
+
+// NearestSnapshot returns the snapshot date closest to date, preferring
+// the earlier one of two equally close dates.
+func (m *Manager) NearestSnapshot(date string) (string, error) {
+	target, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return "", fmt.Errorf("invalid date %q: expected YYYY-MM-DD", date)
+	}
+	snapshots, err := m.ListSnapshots()
+	if err != nil {
+		return "", err
+	}
+
+	nearest := ""
+	var best time.Duration
+	for _, d := range snapshots {
+		t, err := time.Parse("2006-01-02", d)
+		if err != nil || !m.SnapshotExists(d) {
+			continue
+		}
+		dist := t.Sub(target).Abs()
+		if nearest == "" || dist < best || dist == best && d < nearest {
+			nearest, best = d, dist
+		}
+	}
+	if nearest == "" {
+		return "", fmt.Errorf("no snapshots available")
+	}
+	return nearest, nil
+}
+
 // SetLatest updates the latest symlink to point to the given date.
+// The link is replaced atomically where the platform allows it, so readers
+// never observe a missing latest pointer.
 func (m *Manager) SetLatest(date string) error {
 	latestPath := config.LatestSnapshotPath(m.cacheDir)
 
-	// Remove existing symlink
-	os.Remove(latestPath)
-
-	// Create new symlink (relative path)
-	return os.Symlink(date, latestPath)
+	// Create new symlink (relative path) next to the old one and rename it over
+	tmpPath := latestPath + ".tmp"
+	os.Remove(tmpPath)
+	if err := os.Symlink(date, tmpPath); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, latestPath); err != nil {
+		// Renaming over an existing link fails on some platforms
+		os.Remove(tmpPath)
+		os.Remove(latestPath)
+		return os.Symlink(date, latestPath)
+	}
+	return nil
 }
 
 // DeleteSnapshot removes a snapshot.
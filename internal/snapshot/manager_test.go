@@ -191,6 +191,39 @@ func TestManagerDeleteSnapshot(t *testing.T) {
 	}
 }
 
+func TestManagerInstall(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cacheDir := filepath.Join(tmpDir, "cache")
+	mgr := NewManager(cacheDir)
+	os.MkdirAll(filepath.Join(cacheDir, "snapshots"), 0755)
+	victim := filepath.Join(tmpDir, "victim")
+	os.MkdirAll(victim, 0755)
+
+	srcDir := filepath.Join(tmpDir, "src")
+	os.MkdirAll(srcDir, 0755)
+	for _, date := range []string{"../../victim", "..", "2025-01-15/x", ""} {
+		if _, err := mgr.Install(srcDir, date); err == nil {
+			t.Errorf("Install(%q) succeeded, expected an error", date)
+		}
+	}
+	if _, err := os.Stat(victim); err != nil {
+		t.Errorf("Directory outside the cache was removed: %v", err)
+	}
+
+	dir, err := mgr.Install(srcDir, "2025-01-15")
+	if err != nil {
+		t.Fatalf("Install failed: %v", err)
+	}
+	if expected := filepath.Join(cacheDir, "snapshots", "2025-01-15"); dir != expected {
+		t.Errorf("Install dir = %s, expected %s", dir, expected)
+	}
+}
+
 func TestMetadataSaveAndLoad(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
 	if err != nil {
@@ -209,6 +242,10 @@ func TestMetadataSaveAndLoad(t *testing.T) {
 	meta.PrefixesV4 = 450000
 	meta.PrefixesV6 = 120000
 	meta.IsLatest = true
+	meta.CountryStats = map[string]CountryStats{
+		"US": {PrefixesV4: 300000, PrefixesV6: 80000},
+		"GB": {Error: "timeout"},
+	}
 
 	if err := meta.Save(metaPath); err != nil {
 		t.Fatalf("Save failed: %v", err)
@@ -232,6 +269,11 @@ func TestMetadataSaveAndLoad(t *testing.T) {
 	if loaded.PrefixesV6 != meta.PrefixesV6 {
 		t.Errorf("PrefixesV6 = %d, expected %d", loaded.PrefixesV6, meta.PrefixesV6)
 	}
+	for cc, want := range meta.CountryStats {
+		if got := loaded.CountryStats[cc]; got != want {
+			t.Errorf("CountryStats[%s] = %+v, expected %+v", cc, got, want)
+		}
+	}
 }
 
 func TestNewMetadata(t *testing.T) {
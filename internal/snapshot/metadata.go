@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"os"
 	"time"
+
+	"github.com/hightemp/ip2cc/internal/config"
 )
 
 // Metadata contains snapshot metadata.
@@ -15,11 +17,49 @@ type Metadata struct {
 	ActualQueryTime    string    `json:"actual_query_time"`
 	CountriesCount     int       `json:"countries_count"`
 	Countries          []string  `json:"countries"`
+	FailedCountries    []string  `json:"failed_countries,omitempty"`
 	PrefixesV4         int       `json:"prefixes_v4"`
 	PrefixesV6         int       `json:"prefixes_v6"`
 	IndexFormatVersion int       `json:"index_format_version"`
 	Source             string    `json:"source"`
 	IsLatest           bool      `json:"is_latest"`
+	// Baseline is set for the snapshot built with update --earliest, as of
+	// the first date all countries have data.
+	Baseline  bool       `json:"baseline,omitempty"`
+	Changelog *Changelog `json:"changelog,omitempty"`
+	// CountryStats maps uppercase country codes to their prefix counts.
+	// Countries that failed to download carry the error instead.
+	CountryStats map[string]CountryStats `json:"country_stats,omitempty"`
+	// Holders is the provider mode the holders embedded in the index were
+	// resolved with (update --embed-holders), if any.
+	Holders string `json:"holders,omitempty"`
+
+	// GeofeedPrefixes is the number of geofeed prefixes laid over the index
+	// when it was loaded. It is not stored.
+	GeofeedPrefixes int `json:"-"`
+	// OverridePrefixes is the number of entries of the local overrides
+	// file applied to the index when it was loaded. It is not stored.
+	OverridePrefixes int `json:"-"`
+}
+
+// Overlaid reports whether geofeed or override prefixes were laid over the
+// index, so that results name the source of their country.
+func (m *Metadata) Overlaid() bool {
+	return m.GeofeedPrefixes > 0 || m.OverridePrefixes > 0
+}
+
+// CountryStats holds per-country coverage of a snapshot.
+type CountryStats struct {
+	PrefixesV4 int    `json:"prefixes_v4"`
+	PrefixesV6 int    `json:"prefixes_v6"`
+	Error      string `json:"error,omitempty"`
+	// ETag and LastModified are the validators of the RIPEstat response,
+	// sent by the next update to skip countries that did not change.
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	// QueryTime is the time of the earliest data RIPEstat has for the
+	// country, recorded for baseline snapshots.
+	QueryTime string `json:"query_time,omitempty"`
 }
 
 // MetadataVersion is the current metadata format version.
@@ -30,7 +70,7 @@ func NewMetadata() *Metadata {
 	return &Metadata{
 		Version:            MetadataVersion,
 		CreatedAt:          time.Now().UTC(),
-		IndexFormatVersion: 1,
+		IndexFormatVersion: int(config.IndexFormatVersion),
 		Source:             "RIPEstat country-resource-list",
 	}
 }
@@ -50,7 +90,11 @@ func LoadMetadata(path string) (*Metadata, error) {
 	if err != nil {
 		return nil, err
 	}
+	return ParseMetadata(data)
+}
 
+// ParseMetadata decodes metadata from JSON.
+func ParseMetadata(data []byte) (*Metadata, error) {
 	var m Metadata
 	if err := json.Unmarshal(data, &m); err != nil {
 		return nil, err
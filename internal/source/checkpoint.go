@@ -0,0 +1,119 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hightemp/ip2cc/internal/config"
+)
+
+// Checkpoint wraps a DataSource and saves every country it loads in Dir,
+// so that an interrupted update can be resumed: countries saved by an
+// earlier load are yielded from Dir instead of being loaded again. Failed
+// countries are not saved and are loaded again.
+type Checkpoint struct {
+	Source DataSource
+	Dir    string
+}
+
+// checkpointEntry is the saved form of a Result.
+type checkpointEntry struct {
+	CountryCode  string   `json:"country_code"`
+	IPv4         []string `json:"ipv4"`
+	IPv6         []string `json:"ipv6"`
+	QueryTime    string   `json:"query_time,omitempty"`
+	ETag         string   `json:"etag,omitempty"`
+	LastModified string   `json:"last_modified,omitempty"`
+	Reused       bool     `json:"reused,omitempty"`
+
+	Info map[string]PrefixInfo `json:"info,omitempty"`
+}
+
+// Name implements DataSource.
+func (c *Checkpoint) Name() string {
+	return c.Source.Name()
+}
+
+// Load implements DataSource.
+func (c *Checkpoint) Load(ctx context.Context, countries []string, fn func(*Result)) error {
+	if err := config.EnsureDir(c.Dir); err != nil {
+		return err
+	}
+
+	var remaining []string
+	for _, cc := range countries {
+		result, err := c.load(cc)
+		if err != nil {
+			// Not saved yet, or unreadable: load it again
+			remaining = append(remaining, cc)
+			continue
+		}
+		fn(result)
+	}
+
+	return c.Source.Load(ctx, remaining, func(result *Result) {
+		if result.Err == nil {
+			// A country that cannot be saved is only loaded again on resume
+			c.save(result)
+		}
+		fn(result)
+	})
+}
+
+// Saved returns the number of countries saved in Dir.
+func (c *Checkpoint) Saved() int {
+	matches, _ := filepath.Glob(filepath.Join(c.Dir, "*.json"))
+	return len(matches)
+}
+
+func (c *Checkpoint) path(countryCode string) string {
+	return filepath.Join(c.Dir, strings.ToLower(countryCode)+".json")
+}
+
+func (c *Checkpoint) load(countryCode string) (*Result, error) {
+	data, err := os.ReadFile(c.path(countryCode))
+	if err != nil {
+		return nil, err
+	}
+	var e checkpointEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	return &Result{
+		CountryCode:  e.CountryCode,
+		IPv4:         e.IPv4,
+		IPv6:         e.IPv6,
+		QueryTime:    e.QueryTime,
+		ETag:         e.ETag,
+		LastModified: e.LastModified,
+		Reused:       e.Reused,
+		Info:         e.Info,
+	}, nil
+}
+
+// save writes result atomically, so that an interruption never leaves a
+// partial entry behind.
+func (c *Checkpoint) save(result *Result) error {
+	data, err := json.Marshal(checkpointEntry{
+		CountryCode:  result.CountryCode,
+		IPv4:         result.IPv4,
+		IPv6:         result.IPv6,
+		QueryTime:    result.QueryTime,
+		ETag:         result.ETag,
+		LastModified: result.LastModified,
+		Reused:       result.Reused,
+		Info:         result.Info,
+	})
+	if err != nil {
+		return err
+	}
+	path := c.path(result.CountryCode)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
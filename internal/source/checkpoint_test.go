@@ -0,0 +1,76 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// fakeSource loads every country but those in fail, recording the
+// countries it was asked for.
+type fakeSource struct {
+	fail      map[string]bool
+	requested []string
+}
+
+func (s *fakeSource) Name() string { return "fake" }
+
+func (s *fakeSource) Load(ctx context.Context, countries []string, fn func(*Result)) error {
+	s.requested = append(s.requested, countries...)
+	for _, cc := range countries {
+		cc = strings.ToUpper(cc)
+		if s.fail[cc] {
+			fn(&Result{CountryCode: cc, Err: errors.New("connection reset")})
+			continue
+		}
+		fn(&Result{CountryCode: cc, IPv4: []string{"192.0.2.0/24"}, QueryTime: "2024-01-15T00:00:00"})
+	}
+	return nil
+}
+
+func TestCheckpointResume(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	countries := []string{"de", "fr", "nl"}
+
+	// The first run fails for FR
+	first := &fakeSource{fail: map[string]bool{"FR": true}}
+	c := &Checkpoint{Source: first, Dir: tmpDir}
+	if err := c.Load(context.Background(), countries, func(*Result) {}); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if c.Saved() != 2 {
+		t.Errorf("Saved = %d, expected 2", c.Saved())
+	}
+
+	// The resumed run only loads FR
+	second := &fakeSource{}
+	c = &Checkpoint{Source: second, Dir: tmpDir}
+	var loaded []string
+	err = c.Load(context.Background(), countries, func(r *Result) {
+		if r.Err != nil {
+			t.Errorf("Result for %s has error %v", r.CountryCode, r.Err)
+		}
+		if len(r.IPv4) != 1 || r.QueryTime == "" {
+			t.Errorf("Result for %s = %+v, expected its prefixes and query time", r.CountryCode, r)
+		}
+		loaded = append(loaded, r.CountryCode)
+	})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(second.requested) != 1 || second.requested[0] != "fr" {
+		t.Errorf("Resumed load requested %v, expected [fr]", second.requested)
+	}
+	sort.Strings(loaded)
+	if strings.Join(loaded, ",") != "DE,FR,NL" {
+		t.Errorf("Loaded %v, expected DE, FR and NL", loaded)
+	}
+}
@@ -0,0 +1,217 @@
+package source
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hightemp/ip2cc/internal/countries"
+	"github.com/hightemp/ip2cc/internal/iprange"
+)
+
+// DelegatedURLs are the latest delegated-extended statistics files of the
+// five Regional Internet Registries.
+var DelegatedURLs = []string{
+	"https://ftp.afrinic.net/pub/stats/afrinic/delegated-afrinic-extended-latest",
+	"https://ftp.apnic.net/stats/apnic/delegated-apnic-extended-latest",
+	"https://ftp.arin.net/pub/stats/arin/delegated-arin-extended-latest",
+	"https://ftp.lacnic.net/pub/stats/lacnic/delegated-lacnic-extended-latest",
+	"https://ftp.ripe.net/pub/stats/ripencc/delegated-ripencc-extended-latest",
+}
+
+// Delegated loads countries from the RIRs' delegated-extended statistics
+// files, which list every allocation and assignment with its country. All
+// countries come from a handful of downloads, one per registry.
+type Delegated struct {
+	// URLs are the files to read (default DelegatedURLs).
+	URLs []string
+	// Client performs the downloads (default http.DefaultClient).
+	Client *http.Client
+}
+
+// Name implements DataSource.
+func (s *Delegated) Name() string {
+	return "RIR delegated-extended statistics"
+}
+
+// delegatedFile is the content of one statistics file, by uppercase country.
+type delegatedFile struct {
+	ipv4, ipv6 map[string][]string
+	// info describes the prefixes, by CIDR
+	info map[string]PrefixInfo
+	// date is the end date of the file (YYYYMMDD), if its header has one.
+	date string
+}
+
+// Load implements DataSource. Every file must download; the files are
+// only complete together.
+func (s *Delegated) Load(ctx context.Context, countryCodes []string, fn func(*Result)) error {
+	urls := s.URLs
+	if len(urls) == 0 {
+		urls = DelegatedURLs
+	}
+
+	files := make([]*delegatedFile, len(urls))
+	errs := make([]error, len(urls))
+	var wg sync.WaitGroup
+	for i, url := range urls {
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+			files[i], errs[i] = s.fetch(ctx, url)
+		}(i, url)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("download %s: %w", urls[i], err)
+		}
+	}
+
+	// The data is as recent as the oldest file
+	date := ""
+	for _, f := range files {
+		if f.date != "" && (date == "" || f.date < date) {
+			date = f.date
+		}
+	}
+	queryTime := ""
+	if len(date) == 8 {
+		queryTime = date[:4] + "-" + date[4:6] + "-" + date[6:] + "T00:00:00"
+	}
+
+	for _, cc := range countryCodes {
+		result := &Result{CountryCode: strings.ToUpper(cc), QueryTime: queryTime, Info: make(map[string]PrefixInfo)}
+		for _, f := range files {
+			for _, cidr := range f.ipv4[result.CountryCode] {
+				result.IPv4 = append(result.IPv4, cidr)
+				result.Info[cidr] = f.info[cidr]
+			}
+			for _, cidr := range f.ipv6[result.CountryCode] {
+				result.IPv6 = append(result.IPv6, cidr)
+				result.Info[cidr] = f.info[cidr]
+			}
+		}
+		fn(result)
+	}
+	return ctx.Err()
+}
+
+func (s *Delegated) fetch(ctx context.Context, url string) (*delegatedFile, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return parseDelegated(bufio.NewScanner(resp.Body))
+}
+
+// parseDelegated reads a delegated-extended statistics file:
+//
+//	2.3|ripencc|20250115|...|19830705|20250114|+0100   (header)
+//	ripencc|*|ipv4|*|105334|summary                   (summary)
+//	ripencc|NL|ipv4|193.0.0.0|2048|19930901|allocated|...
+//	ripencc|NL|ipv6|2001:67c::|32|20040801|allocated|...
+//
+// IPv4 records give a start address and an address count, which need not
+// be a power of two; they are split into CIDRs. Only allocated and
+// assigned records are used.
+func parseDelegated(scanner *bufio.Scanner) (*delegatedFile, error) {
+	f := &delegatedFile{
+		ipv4: make(map[string][]string),
+		ipv6: make(map[string][]string),
+		info: make(map[string]PrefixInfo),
+	}
+	header := true
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "|")
+		if header {
+			// The version line comes first
+			header = false
+			if len(fields) >= 6 && len(fields[5]) == 8 {
+				f.date = fields[5]
+			}
+			continue
+		}
+		if len(fields) < 7 || fields[1] == "*" {
+			continue
+		}
+		if status := fields[6]; status != "allocated" && status != "assigned" {
+			continue
+		}
+		cc := countries.Normalize(fields[1])
+		if cc == "" || cc == "ZZ" {
+			continue
+		}
+		info := PrefixInfo{RIR: strings.ToLower(fields[0]), Allocated: fields[5]}
+
+		switch fields[2] {
+		case "ipv4":
+			prefixes, err := ipv4Range(fields[3], fields[4])
+			if err != nil {
+				return nil, fmt.Errorf("invalid record %q: %w", line, err)
+			}
+			for _, p := range prefixes {
+				f.ipv4[cc] = append(f.ipv4[cc], p.String())
+				f.info[p.String()] = info
+			}
+		case "ipv6":
+			addr, err := netip.ParseAddr(fields[3])
+			if err != nil {
+				return nil, fmt.Errorf("invalid record %q: %w", line, err)
+			}
+			bits, err := strconv.Atoi(fields[4])
+			if err != nil || bits < 0 || bits > 128 {
+				return nil, fmt.Errorf("invalid record %q: bad prefix length", line)
+			}
+			cidr := netip.PrefixFrom(addr, bits).Masked().String()
+			f.ipv6[cc] = append(f.ipv6[cc], cidr)
+			f.info[cidr] = info
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// ipv4Range returns the CIDRs covering count addresses from start.
+func ipv4Range(start, count string) ([]netip.Prefix, error) {
+	addr, err := netip.ParseAddr(start)
+	if err != nil || !addr.Is4() {
+		return nil, fmt.Errorf("bad IPv4 address %q", start)
+	}
+	n, err := strconv.ParseUint(count, 10, 64)
+	if err != nil || n == 0 {
+		return nil, fmt.Errorf("bad address count %q", count)
+	}
+	a4 := addr.As4()
+	last := uint64(binary.BigEndian.Uint32(a4[:])) + n - 1
+	if last > 0xffffffff {
+		return nil, fmt.Errorf("range exceeds the IPv4 space")
+	}
+	var end [4]byte
+	binary.BigEndian.PutUint32(end[:], uint32(last))
+	return iprange.ToPrefixes(addr, netip.AddrFrom4(end))
+}
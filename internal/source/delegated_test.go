@@ -0,0 +1,101 @@
+package source
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testDelegatedRIPE = `2.3|ripencc|20250115|4|19830705|20250114|+0100
+# comment
+ripencc|*|ipv4|*|3|summary
+ripencc|NL|ipv4|193.0.0.0|2048|19930901|allocated|1
+ripencc|DE|ipv4|10.0.0.0|768|20000101|assigned|2
+ripencc|UK|ipv4|10.0.4.0|256|20000101|allocated|3
+ripencc|NL|ipv6|2001:67c::|32|20040801|allocated|1
+ripencc||ipv4|10.1.0.0|256||available|
+ripencc|NL|asn|3333|1|19940101|allocated|1
+`
+
+const testDelegatedARIN = `2|arin|20250116|2|19700101|20250115|-0500
+arin|US|ipv4|8.8.8.0|256|19920101|allocated|4
+arin|NL|ipv4|192.0.2.0|256|19920101|reserved|5
+`
+
+func TestDelegatedLoad(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ripencc":
+			w.Write([]byte(testDelegatedRIPE))
+		case "/arin":
+			w.Write([]byte(testDelegatedARIN))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	src := &Delegated{URLs: []string{server.URL + "/ripencc", server.URL + "/arin"}}
+	results := make(map[string]*Result)
+	err := src.Load(context.Background(), []string{"nl", "de", "gb", "us", "fr"}, func(r *Result) {
+		results[r.CountryCode] = r
+	})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(results) != 5 {
+		t.Fatalf("Load returned %d countries, expected 5", len(results))
+	}
+
+	tests := []struct {
+		cc   string
+		ipv4 string
+		ipv6 string
+	}{
+		{"NL", "193.0.0.0/21", "2001:67c::/32"},
+		// 768 addresses are not a single CIDR
+		{"DE", "10.0.0.0/23 10.0.2.0/24", ""},
+		{"GB", "10.0.4.0/24", ""},
+		{"US", "8.8.8.0/24", ""},
+		{"FR", "", ""},
+	}
+	for _, tt := range tests {
+		r := results[tt.cc]
+		if got := strings.Join(r.IPv4, " "); got != tt.ipv4 {
+			t.Errorf("%s IPv4 = %s, expected %s", tt.cc, got, tt.ipv4)
+		}
+		if got := strings.Join(r.IPv6, " "); got != tt.ipv6 {
+			t.Errorf("%s IPv6 = %s, expected %s", tt.cc, got, tt.ipv6)
+		}
+		if r.QueryTime != "2025-01-14T00:00:00" {
+			t.Errorf("%s QueryTime = %s, expected 2025-01-14T00:00:00", tt.cc, r.QueryTime)
+		}
+	}
+
+	infos := map[string]PrefixInfo{
+		"8.8.8.0/24":    {RIR: "arin", Allocated: "19920101"},
+		"2001:67c::/32": {RIR: "ripencc", Allocated: "20040801"},
+		"10.0.2.0/24":   {RIR: "ripencc", Allocated: "20000101"},
+	}
+	for cidr, expected := range infos {
+		found := false
+		for _, r := range results {
+			if info, ok := r.Info[cidr]; ok {
+				found = true
+				if info != expected {
+					t.Errorf("Info of %s = %+v, expected %+v", cidr, info, expected)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("No info for %s", cidr)
+		}
+	}
+
+	src.URLs = append(src.URLs, server.URL+"/missing")
+	if err := src.Load(context.Background(), []string{"nl"}, func(*Result) {}); err == nil {
+		t.Error("Load should fail when a file cannot be downloaded")
+	}
+}
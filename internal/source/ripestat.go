@@ -0,0 +1,107 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/hightemp/ip2cc/internal/rawstore"
+	"github.com/hightemp/ip2cc/internal/ripestat"
+)
+
+// Previous gives access to the data of an earlier snapshot, so that
+// countries reported unchanged need not be downloaded again.
+type Previous interface {
+	// Validators returns the ETag and Last-Modified of a country's data.
+	Validators(countryCode string) (etag, lastModified string)
+	// Lists returns the prefixes of a country.
+	Lists(countryCode string) (ipv4, ipv6 []string)
+}
+
+// RIPEstat loads countries from RIPEstat's country-resource-list data call.
+type RIPEstat struct {
+	Client *ripestat.Client
+	// QueryTime selects historical data; empty for the latest.
+	QueryTime string
+	// Concurrency is the number of parallel downloads.
+	Concurrency int
+	// Previous, if set, makes requests conditional on the previous snapshot.
+	Previous Previous
+	// Raw, if set, receives the raw responses as they download.
+	Raw *rawstore.Stage
+}
+
+// Name implements DataSource.
+func (s *RIPEstat) Name() string {
+	return "RIPEstat country-resource-list"
+}
+
+// Load implements DataSource.
+func (s *RIPEstat) Load(ctx context.Context, countries []string, fn func(*Result)) error {
+	concurrency := s.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var mu sync.Mutex
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, cc := range countries {
+		wg.Add(1)
+		go func(countryCode string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			result := s.fetch(ctx, countryCode)
+
+			mu.Lock()
+			fn(result)
+			mu.Unlock()
+		}(cc)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// fetch downloads the resource list of a country, sending the validators
+// of the previous snapshot when there is one.
+func (s *RIPEstat) fetch(ctx context.Context, countryCode string) *Result {
+	cc := strings.ToUpper(countryCode)
+	req := ripestat.CountryResourceListRequest{CountryCode: countryCode, QueryTime: s.QueryTime}
+	if s.Raw != nil {
+		req.Raw = func() (io.WriteCloser, error) { return s.Raw.Create(countryCode) }
+	}
+	if s.Previous != nil {
+		req.ETag, req.LastModified = s.Previous.Validators(cc)
+	}
+
+	data, err := s.Client.FetchCountryResourceList(ctx, req)
+	switch {
+	case errors.Is(err, ripestat.ErrNotModified):
+		ipv4, ipv6 := s.Previous.Lists(cc)
+		return &Result{
+			CountryCode:  cc,
+			IPv4:         ipv4,
+			IPv6:         ipv6,
+			ETag:         req.ETag,
+			LastModified: req.LastModified,
+			Reused:       true,
+		}
+	case err != nil:
+		if s.Raw != nil {
+			s.Raw.Discard(countryCode)
+		}
+		return &Result{CountryCode: cc, Err: err}
+	}
+	return &Result{
+		CountryCode:  data.CountryCode,
+		IPv4:         data.IPv4,
+		IPv6:         data.IPv6,
+		QueryTime:    data.QueryTime,
+		ETag:         data.ETag,
+		LastModified: data.LastModified,
+	}
+}
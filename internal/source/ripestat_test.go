@@ -0,0 +1,71 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hightemp/ip2cc/internal/ripestat"
+)
+
+type fakePrevious map[string][]string
+
+func (p fakePrevious) Validators(countryCode string) (string, string) {
+	if _, ok := p[countryCode]; ok {
+		return `"` + countryCode + `"`, ""
+	}
+	return "", ""
+}
+
+func (p fakePrevious) Lists(countryCode string) ([]string, []string) {
+	return p[countryCode], nil
+}
+
+func TestRIPEstatLoad(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("resource") {
+		case "nl":
+			if r.Header.Get("If-None-Match") == `"NL"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "xx":
+			http.Error(w, "unknown country", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(ripestat.Response{
+			Status: "ok",
+			Data:   json.RawMessage(`{"resources":{"ipv4":["8.8.8.0/24"],"ipv6":["2001:4860::/32"]},"query_time":"2024-01-15T00:00:00"}`),
+		})
+	}))
+	defer server.Close()
+
+	src := &RIPEstat{
+		Client:      ripestat.NewClient(ripestat.WithBaseURL(server.URL)),
+		Concurrency: 2,
+		Previous:    fakePrevious{"NL": {"193.0.0.0/21"}},
+	}
+
+	results := make(map[string]*Result)
+	err := src.Load(context.Background(), []string{"us", "nl", "xx"}, func(r *Result) {
+		results[r.CountryCode] = r
+	})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Got %d results, expected 3", len(results))
+	}
+
+	if us := results["US"]; us.Err != nil || us.Reused || len(us.IPv4) != 1 || len(us.IPv6) != 1 {
+		t.Errorf("US = %+v", us)
+	}
+	if nl := results["NL"]; nl.Err != nil || !nl.Reused || len(nl.IPv4) != 1 || nl.IPv4[0] != "193.0.0.0/21" {
+		t.Errorf("NL = %+v, expected the previous list", nl)
+	}
+	if xx := results["XX"]; xx.Err == nil {
+		t.Errorf("XX = %+v, expected an error", xx)
+	}
+}
@@ -0,0 +1,50 @@
+// Package source defines where the prefix data of an index comes from.
+//
+// A DataSource yields the IPv4 and IPv6 prefixes of each country; the
+// update command turns them into tries. RIPEstat's country-resource-list
+// is the default source.
+package source
+
+import (
+	"context"
+)
+
+// Result is the data of one country, or the error that prevented loading it.
+type Result struct {
+	// CountryCode is the uppercase ISO-3166 alpha-2 code.
+	CountryCode string
+	IPv4        []string
+	IPv6        []string
+	// QueryTime is the time of the data as reported by the source, if any.
+	QueryTime string
+	// ETag and LastModified identify the data for conditional requests.
+	ETag         string
+	LastModified string
+	// Reused is set when the data was taken unchanged from the previous snapshot.
+	Reused bool
+	Err    error
+	// Info holds what the source knows about prefixes besides their
+	// country, by CIDR as listed in IPv4 and IPv6. It may be nil.
+	Info map[string]PrefixInfo
+}
+
+// PrefixInfo describes the registration of a prefix.
+type PrefixInfo struct {
+	// RIR is the registry that delegated the prefix, as named in
+	// delegated statistics files, e.g. "ripencc".
+	RIR string `json:"rir,omitempty"`
+	// Allocated is the date the prefix was allocated or assigned, as
+	// YYYYMMDD.
+	Allocated string `json:"allocated,omitempty"`
+}
+
+// DataSource yields per-country prefix lists.
+type DataSource interface {
+	// Name describes the source; it is recorded in snapshot metadata.
+	Name() string
+	// Load calls fn once for every country in countries (lowercase codes),
+	// in any order. Calls to fn are never concurrent. A failure affecting
+	// a single country is passed to fn in Result.Err; the returned error
+	// aborts the whole load.
+	Load(ctx context.Context, countries []string, fn func(*Result)) error
+}
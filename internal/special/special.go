@@ -0,0 +1,172 @@
+// Package special classifies special-purpose addresses (RFC 6890 and the
+// IANA special-purpose registries), which are not delegated to any country.
+package special
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// Pseudo country codes reported for special-purpose addresses.
+const (
+	Private       = "PRIVATE"
+	Loopback      = "LOOPBACK"
+	LinkLocal     = "LINKLOCAL"
+	CGNAT         = "CGNAT"
+	Multicast     = "MULTICAST"
+	Documentation = "DOCUMENTATION"
+	Reserved      = "RESERVED"
+)
+
+// Range is a special-purpose block.
+type Range struct {
+	Prefix netip.Prefix
+	// Code is one of the pseudo country codes above.
+	Code string
+	// Name describes the block.
+	Name string
+}
+
+var ranges = []Range{
+	{netip.MustParsePrefix("0.0.0.0/8"), Reserved, "\"This network\" (RFC 791)"},
+	{netip.MustParsePrefix("10.0.0.0/8"), Private, "Private network (RFC 1918)"},
+	{netip.MustParsePrefix("100.64.0.0/10"), CGNAT, "Shared address space for carrier-grade NAT (RFC 6598)"},
+	{netip.MustParsePrefix("127.0.0.0/8"), Loopback, "Loopback (RFC 1122)"},
+	{netip.MustParsePrefix("169.254.0.0/16"), LinkLocal, "Link-local (RFC 3927)"},
+	{netip.MustParsePrefix("172.16.0.0/12"), Private, "Private network (RFC 1918)"},
+	{netip.MustParsePrefix("192.0.0.0/24"), Reserved, "IETF protocol assignments (RFC 6890)"},
+	{netip.MustParsePrefix("192.0.2.0/24"), Documentation, "Documentation, TEST-NET-1 (RFC 5737)"},
+	{netip.MustParsePrefix("192.88.99.0/24"), Reserved, "Deprecated 6to4 relay anycast (RFC 7526)"},
+	{netip.MustParsePrefix("192.168.0.0/16"), Private, "Private network (RFC 1918)"},
+	{netip.MustParsePrefix("198.18.0.0/15"), Reserved, "Benchmarking (RFC 2544)"},
+	{netip.MustParsePrefix("198.51.100.0/24"), Documentation, "Documentation, TEST-NET-2 (RFC 5737)"},
+	{netip.MustParsePrefix("203.0.113.0/24"), Documentation, "Documentation, TEST-NET-3 (RFC 5737)"},
+	{netip.MustParsePrefix("224.0.0.0/4"), Multicast, "Multicast (RFC 5771)"},
+	{netip.MustParsePrefix("240.0.0.0/4"), Reserved, "Reserved for future use and limited broadcast (RFC 1112, RFC 919)"},
+
+	{netip.MustParsePrefix("::/128"), Reserved, "Unspecified address (RFC 4291)"},
+	{netip.MustParsePrefix("::1/128"), Loopback, "Loopback (RFC 4291)"},
+	{netip.MustParsePrefix("100::/64"), Reserved, "Discard-only (RFC 6666)"},
+	{netip.MustParsePrefix("2001::/23"), Reserved, "IETF protocol assignments (RFC 2928)"},
+	{netip.MustParsePrefix("2001:db8::/32"), Documentation, "Documentation (RFC 3849)"},
+	{netip.MustParsePrefix("3fff::/20"), Documentation, "Documentation (RFC 9637)"},
+	{netip.MustParsePrefix("fc00::/7"), Private, "Unique local address (RFC 4193)"},
+	{netip.MustParsePrefix("fe80::/10"), LinkLocal, "Link-local (RFC 4291)"},
+	{netip.MustParsePrefix("ff00::/8"), Multicast, "Multicast (RFC 4291)"},
+}
+
+// Lookup returns the special-purpose block containing ip.
+func Lookup(ip netip.Addr) (Range, bool) {
+	ip = ip.Unmap()
+	for _, r := range ranges {
+		if r.Prefix.Contains(ip) {
+			return r, true
+		}
+	}
+	return Range{}, false
+}
+
+// LookupPrefix returns the special-purpose block containing all of prefix.
+func LookupPrefix(prefix netip.Prefix) (Range, bool) {
+	r, ok := Lookup(prefix.Addr())
+	if !ok || r.Prefix.Bits() > prefix.Bits() {
+		return Range{}, false
+	}
+	return r, true
+}
+
+// LookupRange returns the special-purpose block containing all of the
+// inclusive range [start, end].
+func LookupRange(start, end netip.Addr) (Range, bool) {
+	r, ok := Lookup(start)
+	if !ok || !r.Prefix.Contains(end) {
+		return Range{}, false
+	}
+	return r, true
+}
+
+// IPv6 embeddings of IPv4 addresses, as reported by EmbeddedIPv4.
+const (
+	IPv4Mapped = "ipv4-mapped"
+	SixToFour  = "6to4"
+	Teredo     = "teredo"
+	NAT64      = "nat64"
+)
+
+// WellKnownNAT64Prefix is the NAT64 prefix reserved by RFC 6052.
+var WellKnownNAT64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+
+var (
+	sixToFourPrefix = netip.MustParsePrefix("2002::/16")
+	teredoPrefix    = netip.MustParsePrefix("2001::/32")
+)
+
+// EmbeddedIPv4 returns the IPv4 address carried by an IPv4-mapped
+// (::ffff:0:0/96), 6to4 (2002::/16), or Teredo (2001::/32) address and the
+// kind of embedding. For Teredo this is the client's public address.
+func EmbeddedIPv4(ip netip.Addr) (netip.Addr, string, bool) {
+	if !ip.Is6() {
+		return netip.Addr{}, "", false
+	}
+	if ip.Is4In6() {
+		return ip.Unmap(), IPv4Mapped, true
+	}
+	b := ip.As16()
+	switch {
+	case sixToFourPrefix.Contains(ip):
+		return netip.AddrFrom4([4]byte{b[2], b[3], b[4], b[5]}), SixToFour, true
+	case teredoPrefix.Contains(ip):
+		// The client address is stored with all bits inverted (RFC 4380)
+		return netip.AddrFrom4([4]byte{^b[12], ^b[13], ^b[14], ^b[15]}), Teredo, true
+	}
+	return netip.Addr{}, "", false
+}
+
+// ParseNAT64Prefix parses a NAT64 prefix, which must be an IPv6 prefix of
+// one of the lengths allowed by RFC 6052: 32, 40, 48, 56, 64, or 96.
+func ParseNAT64Prefix(s string) (netip.Prefix, error) {
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid NAT64 prefix: %w", err)
+	}
+	if !prefix.Addr().Is6() || prefix.Addr().Is4In6() {
+		return netip.Prefix{}, fmt.Errorf("invalid NAT64 prefix %s: not an IPv6 prefix", s)
+	}
+	switch prefix.Bits() {
+	case 32, 40, 48, 56, 64, 96:
+		return prefix.Masked(), nil
+	}
+	return netip.Prefix{}, fmt.Errorf("invalid NAT64 prefix %s: length must be 32, 40, 48, 56, 64, or 96", s)
+}
+
+// NAT64IPv4 returns the IPv4 address a NAT64 translator using prefix
+// embedded in ip (RFC 6052). Bits 64 to 71 of the address are reserved
+// and never hold IPv4 bits.
+func NAT64IPv4(ip netip.Addr, prefix netip.Prefix) (netip.Addr, bool) {
+	if !prefix.Contains(ip) {
+		return netip.Addr{}, false
+	}
+	b := ip.As16()
+	var v4 [4]byte
+	pos := prefix.Bits() / 8
+	for i := range v4 {
+		if pos == 8 {
+			pos++
+		}
+		v4[i] = b[pos]
+		pos++
+	}
+	return netip.AddrFrom4(v4), true
+}
+
+// TranslatedIPv4 returns the IPv4 address ip stands for: the address a
+// NAT64 translator using one of the nat64 prefixes synthesized ip from, or
+// the address ip embeds (see EmbeddedIPv4), and the kind of translation.
+func TranslatedIPv4(ip netip.Addr, nat64 []netip.Prefix) (netip.Addr, string, bool) {
+	for _, prefix := range nat64 {
+		if v4, ok := NAT64IPv4(ip, prefix); ok {
+			return v4, NAT64, true
+		}
+	}
+	return EmbeddedIPv4(ip)
+}
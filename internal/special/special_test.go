@@ -0,0 +1,111 @@
+package special
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		ip       string
+		expected string
+	}{
+		{"10.1.2.3", Private},
+		{"172.31.255.255", Private},
+		{"172.32.0.1", ""},
+		{"100.64.0.1", CGNAT},
+		{"127.0.0.1", Loopback},
+		{"169.254.1.1", LinkLocal},
+		{"192.0.2.10", Documentation},
+		{"224.0.0.251", Multicast},
+		{"255.255.255.255", Reserved},
+		{"8.8.8.8", ""},
+		{"::ffff:192.168.1.1", Private},
+		{"::1", Loopback},
+		{"fd00::1", Private},
+		{"fe80::1", LinkLocal},
+		{"2001:db8::1", Documentation},
+		{"ff02::1", Multicast},
+		{"2001:4860::1", ""},
+	}
+	for _, tt := range tests {
+		r, ok := Lookup(netip.MustParseAddr(tt.ip))
+		if ok != (tt.expected != "") || r.Code != tt.expected {
+			t.Errorf("Lookup(%s) = %q, %v, expected %q", tt.ip, r.Code, ok, tt.expected)
+		}
+	}
+}
+
+func TestLookupPrefix(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		expected string
+	}{
+		{"10.20.0.0/16", Private},
+		{"10.0.0.0/8", Private},
+		{"10.0.0.0/7", ""},
+		{"192.168.1.0/24", Private},
+		{"8.8.8.0/24", ""},
+	}
+	for _, tt := range tests {
+		r, ok := LookupPrefix(netip.MustParsePrefix(tt.prefix))
+		if ok != (tt.expected != "") || r.Code != tt.expected {
+			t.Errorf("LookupPrefix(%s) = %q, %v, expected %q", tt.prefix, r.Code, ok, tt.expected)
+		}
+	}
+}
+
+func TestEmbeddedIPv4(t *testing.T) {
+	tests := []struct {
+		ip       string
+		expected string
+		kind     string
+	}{
+		{"::ffff:8.8.8.8", "8.8.8.8", IPv4Mapped},
+		{"2002:c000:204::1", "192.0.2.4", SixToFour},
+		{"2001:0:4136:e378:8000:63bf:3fff:fdd2", "192.0.2.45", Teredo},
+		{"2001:4860::1", "", ""},
+		{"2001:db8::1", "", ""},
+		{"8.8.8.8", "", ""},
+	}
+	for _, tt := range tests {
+		v4, kind, ok := EmbeddedIPv4(netip.MustParseAddr(tt.ip))
+		if ok != (tt.expected != "") || kind != tt.kind || (ok && v4.String() != tt.expected) {
+			t.Errorf("EmbeddedIPv4(%s) = %v, %q, %v, expected %s %q", tt.ip, v4, kind, ok, tt.expected, tt.kind)
+		}
+	}
+}
+
+func TestNAT64IPv4(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		ip       string
+		expected string
+	}{
+		// Examples of RFC 6052, section 2.4
+		{"2001:db8::/32", "2001:db8:c000:221::", "192.0.2.33"},
+		{"2001:db8:100::/40", "2001:db8:1c0:2:21::", "192.0.2.33"},
+		{"2001:db8:122::/48", "2001:db8:122:c000:2:2100::", "192.0.2.33"},
+		{"2001:db8:122:300::/56", "2001:db8:122:3c0:0:221::", "192.0.2.33"},
+		{"2001:db8:122:344::/64", "2001:db8:122:344:c0:2:2100:0", "192.0.2.33"},
+		{"2001:db8:122:344::/96", "2001:db8:122:344::192.0.2.33", "192.0.2.33"},
+		{"64:ff9b::/96", "64:ff9b::8.8.8.8", "8.8.8.8"},
+		{"64:ff9b::/96", "2001:4860::1", ""},
+	}
+	for _, tt := range tests {
+		prefix, err := ParseNAT64Prefix(tt.prefix)
+		if err != nil {
+			t.Fatalf("ParseNAT64Prefix(%s) failed: %v", tt.prefix, err)
+		}
+		v4, ok := NAT64IPv4(netip.MustParseAddr(tt.ip), prefix)
+		if ok != (tt.expected != "") || (ok && v4.String() != tt.expected) {
+			t.Errorf("NAT64IPv4(%s, %s) = %v, %v, expected %s", tt.ip, tt.prefix, v4, ok, tt.expected)
+		}
+	}
+
+	for _, s := range []string{"64:ff9b::/80", "192.0.2.0/24", "bogus"} {
+		if _, err := ParseNAT64Prefix(s); err == nil {
+			t.Errorf("ParseNAT64Prefix(%s) should fail", s)
+		}
+	}
+}
@@ -0,0 +1,485 @@
+// Package sqlite writes a single table, with an index on one column, as a
+// SQLite 3 database file. The file is written in one pass and is not meant
+// to be updated in place by this package; SQLite itself can modify it
+// afterwards.
+package sqlite
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"unicode/utf8"
+)
+
+// Type is the declared type of a column.
+type Type int
+
+const (
+	// Text is a TEXT column, written from string values.
+	Text Type = iota
+	// Integer is an INTEGER column, written from int64 values.
+	Integer
+)
+
+// Column describes a column of the table. Every column accepts nil values
+// (NULL).
+type Column struct {
+	Name string
+	Type Type
+}
+
+// MaxText is the longest text value stored, in bytes; longer values are
+// truncated, so that every row fits in a single page.
+const MaxText = 512
+
+// truncateText cuts v to at most MaxText bytes, at a character boundary so
+// that the stored text stays valid UTF-8.
+func truncateText(v string) string {
+	if len(v) <= MaxText {
+		return v
+	}
+	n := MaxText
+	for n > 0 && !utf8.RuneStart(v[n]) {
+		n--
+	}
+	return v[:n]
+}
+
+const (
+	pageSize = 4096
+
+	pageTableInterior = 0x05
+	pageTableLeaf     = 0x0d
+	pageIndexInterior = 0x02
+	pageIndexLeaf     = 0x0a
+
+	// lockBytePage is the page holding the lock bytes at offset 1 GiB,
+	// which is never used for data.
+	lockBytePage = 1<<30/pageSize + 1
+)
+
+// Writer writes rows to a SQLite database file.
+type Writer struct {
+	w       io.WriteSeeker
+	table   string
+	columns []Column
+	index   int
+
+	nextPage uint32
+	rowid    int64
+	// leaf is the table leaf page being filled
+	leaf *page
+	// leaves are the finished table leaf pages with their largest rowids
+	leaves []child
+	// keys are the values of the indexed column, with their rowids
+	keys []indexKey
+	err  error
+}
+
+type child struct {
+	page uint32
+	key  int64
+}
+
+type indexKey struct {
+	value string
+	rowid int64
+}
+
+// NewWriter creates a writer of a database with the table and an index on
+// its column named index. It writes to w from its current position.
+func NewWriter(w io.WriteSeeker, table string, columns []Column, index string) (*Writer, error) {
+	sw := &Writer{w: w, table: table, columns: columns, index: -1, nextPage: 2}
+	for i, col := range columns {
+		if col.Name == index {
+			sw.index = i
+		}
+	}
+	if sw.index < 0 || columns[sw.index].Type != Text {
+		return nil, fmt.Errorf("index column %q is not a text column of the table", index)
+	}
+	sw.leaf = newPage(pageTableLeaf, 0)
+	return sw, nil
+}
+
+// Write adds a row of one value per column: string, int64, or nil.
+func (sw *Writer) Write(row []interface{}) error {
+	if sw.err != nil {
+		return sw.err
+	}
+	if len(row) != len(sw.columns) {
+		return fmt.Errorf("row has %d values, expected %d", len(row), len(sw.columns))
+	}
+	values := make([]interface{}, len(row))
+	for i, v := range row {
+		switch v := v.(type) {
+		case nil:
+		case string:
+			if sw.columns[i].Type != Text {
+				return fmt.Errorf("column %s: value %q is not an integer", sw.columns[i].Name, v)
+			}
+			values[i] = truncateText(v)
+		case int64:
+			if sw.columns[i].Type != Integer {
+				return fmt.Errorf("column %s: value %d is not text", sw.columns[i].Name, v)
+			}
+			values[i] = v
+		default:
+			return fmt.Errorf("column %s: unsupported value %v (%T)", sw.columns[i].Name, v, v)
+		}
+	}
+
+	record := encodeRecord(values)
+	cell := appendVarint(nil, uint64(len(record)))
+	cell = appendVarint(cell, uint64(sw.rowid+1))
+	cell = append(cell, record...)
+	if !newPage(pageTableLeaf, 0).fits(cell) {
+		return fmt.Errorf("row of %d bytes does not fit in a page", len(record))
+	}
+	if !sw.leaf.fits(cell) {
+		sw.finishLeaf()
+	}
+	sw.rowid++
+	sw.leaf.add(cell)
+
+	if key, ok := values[sw.index].(string); ok {
+		sw.keys = append(sw.keys, indexKey{key, sw.rowid})
+	}
+	return sw.err
+}
+
+// finishLeaf writes the table leaf page being filled.
+func (sw *Writer) finishLeaf() {
+	n := sw.allocPage()
+	sw.writePage(n, sw.leaf)
+	sw.leaves = append(sw.leaves, child{n, sw.rowid})
+	sw.leaf = newPage(pageTableLeaf, 0)
+}
+
+// Close writes the rest of the table, the index, and the schema.
+func (sw *Writer) Close() error {
+	if sw.err != nil {
+		return sw.err
+	}
+	tableRoot := uint32(0)
+	if len(sw.leaves) == 0 {
+		// A table fitting one leaf has it as its root
+		tableRoot = sw.allocPage()
+		sw.writePage(tableRoot, sw.leaf)
+	} else {
+		if len(sw.leaf.cells) > 0 {
+			sw.finishLeaf()
+		}
+		tableRoot = sw.buildTableInterior(sw.leaves)
+	}
+	indexRoot := sw.buildIndex()
+
+	indexName := sw.table + "_" + sw.columns[sw.index].Name
+	schema := newPage(pageTableLeaf, 100)
+	for i, entry := range [][]interface{}{
+		{"table", sw.table, sw.table, int64(tableRoot), sw.createTable()},
+		{"index", indexName, sw.table, int64(indexRoot), fmt.Sprintf("CREATE INDEX %s ON %s (%s)", indexName, sw.table, sw.columns[sw.index].Name)},
+	} {
+		record := encodeRecord(entry)
+		cell := appendVarint(nil, uint64(len(record)))
+		cell = appendVarint(cell, uint64(i+1))
+		cell = append(cell, record...)
+		if !schema.fits(cell) {
+			return fmt.Errorf("schema does not fit the first page")
+		}
+		schema.add(cell)
+	}
+	sw.writePage(1, schema)
+	sw.writeHeader()
+	return sw.err
+}
+
+func (sw *Writer) createTable() string {
+	sql := "CREATE TABLE " + sw.table + " ("
+	for i, col := range sw.columns {
+		if i > 0 {
+			sql += ", "
+		}
+		sql += col.Name
+		if col.Type == Integer {
+			sql += " INTEGER"
+		} else {
+			sql += " TEXT"
+		}
+	}
+	return sql + ")"
+}
+
+// buildTableInterior builds the interior levels of the table b-tree over
+// children, returning its root page.
+func (sw *Writer) buildTableInterior(children []child) uint32 {
+	for len(children) > 1 {
+		// Spread the children evenly, so that every page has at least two
+		perPage := (pageSize - 12) / (2 + 4 + 9)
+		pages := (len(children) + perPage) / (perPage + 1)
+		var parents []child
+		for p := 0; p < pages; p++ {
+			group := children[p*len(children)/pages : (p+1)*len(children)/pages]
+			pg := newPage(pageTableInterior, 0)
+			for _, c := range group[:len(group)-1] {
+				cell := binary.BigEndian.AppendUint32(nil, c.page)
+				pg.add(appendVarint(cell, uint64(c.key)))
+			}
+			last := group[len(group)-1]
+			pg.right = last.page
+			n := sw.allocPage()
+			sw.writePage(n, pg)
+			parents = append(parents, child{n, last.key})
+		}
+		children = parents
+	}
+	return children[0].page
+}
+
+// buildIndex writes the index b-tree, returning its root page.
+func (sw *Writer) buildIndex() uint32 {
+	sort.Slice(sw.keys, func(i, j int) bool {
+		a, b := sw.keys[i], sw.keys[j]
+		return a.value < b.value || a.value == b.value && a.rowid < b.rowid
+	})
+	entries := make([][]byte, len(sw.keys))
+	for i, k := range sw.keys {
+		entries[i] = encodeRecord([]interface{}{k.value, k.rowid})
+	}
+	sw.keys = nil
+
+	// Unlike the table, the index is a B-tree: the entry between two
+	// pages moves up to their parent as the divider
+	var pages []uint32
+	var dividers [][]byte
+	for start := 0; ; {
+		pg := newPage(pageIndexLeaf, 0)
+		end := start
+		for end < len(entries) && pg.fits(indexLeafCell(entries[end])) {
+			pg.add(indexLeafCell(entries[end]))
+			end++
+		}
+		// The last page must not be left empty: stop one entry early
+		if end == len(entries)-1 && end > start+1 {
+			end--
+			pg.pop()
+		}
+		n := sw.allocPage()
+		sw.writePage(n, pg)
+		pages = append(pages, n)
+		if end >= len(entries) {
+			break
+		}
+		dividers = append(dividers, entries[end])
+		start = end + 1
+	}
+
+	for len(pages) > 1 {
+		var parents []uint32
+		var parentDividers [][]byte
+		for start := 0; start < len(pages); {
+			pg := newPage(pageIndexInterior, 0)
+			end := start
+			for end < len(dividers) && pg.fits(indexInteriorCell(pages[end], dividers[end])) {
+				pg.add(indexInteriorCell(pages[end], dividers[end]))
+				end++
+			}
+			if end == len(dividers)-1 && end > start+1 {
+				end--
+				pg.pop()
+			}
+			pg.right = pages[end]
+			n := sw.allocPage()
+			sw.writePage(n, pg)
+			parents = append(parents, n)
+			if end < len(dividers) {
+				parentDividers = append(parentDividers, dividers[end])
+			}
+			start = end + 1
+		}
+		pages, dividers = parents, parentDividers
+	}
+	return pages[0]
+}
+
+func indexLeafCell(record []byte) []byte {
+	return append(appendVarint(nil, uint64(len(record))), record...)
+}
+
+func indexInteriorCell(child uint32, record []byte) []byte {
+	cell := binary.BigEndian.AppendUint32(nil, child)
+	cell = appendVarint(cell, uint64(len(record)))
+	return append(cell, record...)
+}
+
+func (sw *Writer) allocPage() uint32 {
+	n := sw.nextPage
+	if n == lockBytePage {
+		n++
+	}
+	sw.nextPage = n + 1
+	return n
+}
+
+func (sw *Writer) writePage(n uint32, pg *page) {
+	if sw.err != nil {
+		return
+	}
+	if _, err := sw.w.Seek(int64(n-1)*pageSize, io.SeekStart); err != nil {
+		sw.err = err
+		return
+	}
+	_, sw.err = sw.w.Write(pg.bytes())
+}
+
+// writeHeader writes the database header at the start of the first page.
+func (sw *Writer) writeHeader() {
+	if sw.err != nil {
+		return
+	}
+	h := make([]byte, 100)
+	copy(h, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(h[16:], pageSize)
+	h[18], h[19] = 1, 1
+	h[21], h[22], h[23] = 64, 32, 32
+	binary.BigEndian.PutUint32(h[24:], 1)             // change counter
+	binary.BigEndian.PutUint32(h[28:], sw.nextPage-1) // pages
+	binary.BigEndian.PutUint32(h[40:], 1)             // schema cookie
+	binary.BigEndian.PutUint32(h[44:], 4)             // schema format
+	binary.BigEndian.PutUint32(h[56:], 1)             // UTF-8
+	binary.BigEndian.PutUint32(h[92:], 1)             // version-valid-for
+	binary.BigEndian.PutUint32(h[96:], 3045000)       // SQLite version
+	if _, err := sw.w.Seek(0, io.SeekStart); err != nil {
+		sw.err = err
+		return
+	}
+	if _, err := sw.w.Write(h); err != nil {
+		sw.err = err
+		return
+	}
+	// Leave the file positioned at its end
+	_, sw.err = sw.w.Seek(int64(sw.nextPage-1)*pageSize, io.SeekStart)
+}
+
+// page is a b-tree page being filled.
+type page struct {
+	kind byte
+	// offset is where the page header starts: 100 on the first page
+	offset int
+	cells  [][]byte
+	used   int
+	right  uint32
+}
+
+func newPage(kind byte, offset int) *page {
+	return &page{kind: kind, offset: offset}
+}
+
+func (p *page) headerSize() int {
+	if p.kind == pageTableLeaf || p.kind == pageIndexLeaf {
+		return 8
+	}
+	return 12
+}
+
+// fits reports whether cell fits in the page beside its cells.
+func (p *page) fits(cell []byte) bool {
+	return p.offset+p.headerSize()+2*(len(p.cells)+1)+p.used+len(cell) <= pageSize
+}
+
+func (p *page) add(cell []byte) {
+	p.cells = append(p.cells, cell)
+	p.used += len(cell)
+}
+
+// pop removes the last cell.
+func (p *page) pop() {
+	p.used -= len(p.cells[len(p.cells)-1])
+	p.cells = p.cells[:len(p.cells)-1]
+}
+
+// bytes lays out the page: the header and cell pointers at the start, the
+// cells at the end, in order.
+func (p *page) bytes() []byte {
+	b := make([]byte, pageSize)
+	h := b[p.offset:]
+	h[0] = p.kind
+	binary.BigEndian.PutUint16(h[3:], uint16(len(p.cells)))
+	if p.headerSize() == 12 {
+		binary.BigEndian.PutUint32(h[8:], p.right)
+	}
+	pos := pageSize
+	for i, cell := range p.cells {
+		pos -= len(cell)
+		copy(b[pos:], cell)
+		binary.BigEndian.PutUint16(h[p.headerSize()+2*i:], uint16(pos))
+	}
+	binary.BigEndian.PutUint16(h[5:], uint16(pos))
+	return b
+}
+
+// encodeRecord encodes values in the SQLite record format.
+func encodeRecord(values []interface{}) []byte {
+	var types, body []byte
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+			types = appendVarint(types, 0)
+		case string:
+			types = appendVarint(types, uint64(13+2*len(v)))
+			body = append(body, v...)
+		case int64:
+			switch {
+			case v == 0:
+				types = appendVarint(types, 8)
+			case v == 1:
+				types = appendVarint(types, 9)
+			case v >= -1<<7 && v < 1<<7:
+				types = appendVarint(types, 1)
+				body = append(body, byte(v))
+			case v >= -1<<15 && v < 1<<15:
+				types = appendVarint(types, 2)
+				body = binary.BigEndian.AppendUint16(body, uint16(v))
+			case v >= -1<<31 && v < 1<<31:
+				types = appendVarint(types, 4)
+				body = binary.BigEndian.AppendUint32(body, uint32(v))
+			default:
+				types = appendVarint(types, 6)
+				body = binary.BigEndian.AppendUint64(body, uint64(v))
+			}
+		}
+	}
+	// The header size counts itself; it stays one byte for our records
+	// unless the types run past 126 bytes
+	size := len(types) + 1
+	if size > 127 {
+		size++
+	}
+	record := appendVarint(nil, uint64(size))
+	record = append(record, types...)
+	return append(record, body...)
+}
+
+// appendVarint appends v as a SQLite varint: big-endian groups of seven
+// bits, with the ninth byte, if any, holding eight.
+func appendVarint(b []byte, v uint64) []byte {
+	if v > 1<<56-1 {
+		var buf [9]byte
+		buf[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			buf[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		return append(b, buf[:]...)
+	}
+	var buf [8]byte
+	i := len(buf) - 1
+	buf[i] = byte(v & 0x7f)
+	for v >>= 7; v > 0; v >>= 7 {
+		i--
+		buf[i] = byte(v&0x7f) | 0x80
+	}
+	return append(b, buf[i:]...)
+}
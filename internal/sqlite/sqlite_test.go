@@ -0,0 +1,157 @@
+package sqlite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestAppendVarint(t *testing.T) {
+	tests := []struct {
+		v        uint64
+		expected []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x81, 0x00}},
+		{300, []byte{0x82, 0x2c}},
+		{1<<56 - 1, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}},
+		{1 << 63, []byte{0xc0, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x00}},
+	}
+	for _, tt := range tests {
+		if got := appendVarint(nil, tt.v); !bytes.Equal(got, tt.expected) {
+			t.Errorf("appendVarint(%d) = % x, expected % x", tt.v, got, tt.expected)
+		}
+	}
+}
+
+func writeTestDB(t *testing.T, rows int) string {
+	t.Helper()
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	path := filepath.Join(tmpDir, "results.db")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w, err := NewWriter(f, "results", []Column{{"ip", Text}, {"asn", Integer}, {"holder", Text}}, "ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < rows; i++ {
+		var asn interface{}
+		if i%3 != 0 {
+			asn = int64(i * 7919)
+		}
+		ip := fmt.Sprintf("10.%d.%d.%d", i*37%256, i/256%256, i%256)
+		if err := w.Write([]interface{}{ip, asn, strings.Repeat("h", i%700)}); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	return path
+}
+
+func TestWriterHeader(t *testing.T) {
+	path := writeTestDB(t, 1000)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("SQLite format 3\x00")) {
+		t.Fatal("missing SQLite header")
+	}
+	if len(data)%pageSize != 0 {
+		t.Errorf("file size %d is not a multiple of the page size", len(data))
+	}
+	if pages := binary.BigEndian.Uint32(data[28:]); int(pages)*pageSize != len(data) {
+		t.Errorf("header page count = %d, file has %d pages", pages, len(data)/pageSize)
+	}
+}
+
+// TestWriterSQLite checks the database with the sqlite3 shell, if installed.
+func TestWriterSQLite(t *testing.T) {
+	sqlite3, err := exec.LookPath("sqlite3")
+	if err != nil {
+		t.Skip("sqlite3 not installed")
+	}
+	for _, rows := range []int{0, 1, 20000} {
+		path := writeTestDB(t, rows)
+		out, err := exec.Command(sqlite3, path,
+			"PRAGMA integrity_check; SELECT count(*), count(asn) FROM results; SELECT asn FROM results WHERE ip = '10.37.0.1';").CombinedOutput()
+		if err != nil {
+			t.Fatalf("sqlite3 error = %v: %s", err, out)
+		}
+		expected := fmt.Sprintf("ok\n%d|%d\n", rows, rows-(rows+2)/3)
+		if rows > 1 {
+			expected += "7919\n"
+		}
+		if string(out) != expected {
+			t.Errorf("%d rows: sqlite3 output = %q, expected %q", rows, out, expected)
+		}
+	}
+}
+
+func TestWriterRejectsInvalidRows(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	f, err := os.Create(filepath.Join(tmpDir, "results.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := NewWriter(f, "results", []Column{{"asn", Integer}}, "asn"); err == nil {
+		t.Error("NewWriter() with an integer index column succeeded")
+	}
+	w, err := NewWriter(f, "results", []Column{{"ip", Text}, {"asn", Integer}}, "ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write([]interface{}{"8.8.8.8", "15169"}); err == nil {
+		t.Error("Write() of text in an integer column succeeded")
+	}
+	if err := w.Write([]interface{}{"8.8.8.8"}); err == nil {
+		t.Error("Write() of too few values succeeded")
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected int
+	}{
+		{"short", 5},
+		{strings.Repeat("a", MaxText), MaxText},
+		{strings.Repeat("a", MaxText+1), MaxText},
+		// "é" is two bytes; the last one would cross the limit
+		{"a" + strings.Repeat("é", MaxText/2), MaxText - 1},
+		// "€" is three bytes
+		{strings.Repeat("€", MaxText), MaxText - MaxText%3},
+	}
+	for _, tt := range tests {
+		got := truncateText(tt.in)
+		if len(got) != tt.expected {
+			t.Errorf("truncateText(%d bytes) = %d bytes, expected %d", len(tt.in), len(got), tt.expected)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncateText(%d bytes) is not valid UTF-8", len(tt.in))
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Package whois implements a TCP whois (RFC 3912, port 43) client that
+// starts at IANA and follows referrals to the responsible registry.
+package whois
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// RootServer is the whois server queried first.
+	RootServer = "whois.iana.org"
+
+	// DefaultTimeout bounds each query, including the connect.
+	DefaultTimeout = 15 * time.Second
+
+	// MaxReferrals is the maximum number of referrals followed.
+	MaxReferrals = 3
+
+	// maxResponseSize bounds a single whois response.
+	maxResponseSize = 1 << 20
+)
+
+// Client queries whois servers over TCP.
+type Client struct {
+	rootServer string
+	timeout    time.Duration
+	dial       func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// NewClient creates a new whois client starting at IANA.
+func NewClient() *Client {
+	d := &net.Dialer{}
+	return &Client{
+		rootServer: RootServer,
+		timeout:    DefaultTimeout,
+		dial:       d.DialContext,
+	}
+}
+
+// Record is the parsed answer of the authoritative registry.
+type Record struct {
+	Server      string
+	OrgName     string
+	Description string
+	Country     string
+	NetName     string
+	Raw         string
+}
+
+// Provider returns the most descriptive holder name in the record.
+func (r *Record) Provider() string {
+	switch {
+	case r.OrgName != "":
+		return r.OrgName
+	case r.Description != "":
+		return r.Description
+	default:
+		return r.NetName
+	}
+}
+
+// Lookup queries resource (an IP address or prefix), following referrals
+// from IANA to the regional registry that holds the record.
+func (c *Client) Lookup(ctx context.Context, resource string) (*Record, error) {
+	server := c.rootServer
+	seen := make(map[string]bool)
+
+	for hop := 0; ; hop++ {
+		seen[server] = true
+		raw, err := c.Query(ctx, server, queryFor(server, resource))
+		if err != nil {
+			return nil, err
+		}
+
+		next := referral(raw)
+		if next == "" || seen[next] || hop >= MaxReferrals {
+			record := parse(raw)
+			record.Server = server
+			return record, nil
+		}
+		server = next
+	}
+}
+
+// Query sends a single query to server and returns the raw response.
+func (c *Client) Query(ctx context.Context, server, query string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	address := server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		address = net.JoinHostPort(server, "43")
+	}
+
+	conn, err := c.dial(ctx, "tcp", address)
+	if err != nil {
+		return "", fmt.Errorf("connect to %s: %w", server, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := io.WriteString(conn, query+"\r\n"); err != nil {
+		return "", fmt.Errorf("query %s: %w", server, err)
+	}
+	data, err := io.ReadAll(io.LimitReader(conn, maxResponseSize))
+	if err != nil {
+		return "", fmt.Errorf("read from %s: %w", server, err)
+	}
+	return string(data), nil
+}
+
+// queryFor formats the query for registries with non-default syntax.
+func queryFor(server, resource string) string {
+	if strings.HasPrefix(server, "whois.arin.net") {
+		// Network records only, with full details
+		return "n + " + resource
+	}
+	return resource
+}
+
+// referral extracts the next server from "refer:" (IANA), "whois:" or
+// "ReferralServer:" (ARIN) lines.
+func referral(raw string) string {
+	scanner := bufio.NewScanner(strings.NewReader(raw))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "refer", "whois", "referralserver":
+			value = strings.TrimSpace(value)
+			value = strings.TrimPrefix(value, "whois://")
+			value = strings.TrimPrefix(value, "rwhois://")
+			value = strings.TrimSuffix(value, "/")
+			if value != "" {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// parse extracts the provider-related fields of a whois response.
+func parse(raw string) *Record {
+	record := &Record{Raw: raw}
+	scanner := bufio.NewScanner(strings.NewReader(raw))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "%") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		var field *string
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "org-name", "orgname", "owner":
+			field = &record.OrgName
+		case "descr", "description":
+			field = &record.Description
+		case "country":
+			field = &record.Country
+		case "netname", "net-name":
+			field = &record.NetName
+		}
+		if field != nil && *field == "" {
+			*field = value
+		}
+	}
+	return record
+}
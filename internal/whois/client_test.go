@@ -0,0 +1,83 @@
+package whois
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeServers answers whois queries in memory, keyed by host.
+func fakeServers(t *testing.T, responses map[string]string, queries *[]string) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, _ := net.SplitHostPort(address)
+		if port != "43" {
+			t.Errorf("dialed port %s, expected 43", port)
+		}
+		response, ok := responses[host]
+		if !ok {
+			return nil, fmt.Errorf("unknown host %s", host)
+		}
+
+		client, server := net.Pipe()
+		go func() {
+			defer server.Close()
+			query, _ := bufio.NewReader(server).ReadString('\n')
+			*queries = append(*queries, host+" "+strings.TrimSpace(query))
+			io.WriteString(server, response)
+		}()
+		return client, nil
+	}
+}
+
+func TestLookupFollowsReferrals(t *testing.T) {
+	var queries []string
+	client := NewClient()
+	client.dial = fakeServers(t, map[string]string{
+		"whois.iana.org": "% IANA WHOIS server\nrefer:        whois.arin.net\n\ninetnum:      8.0.0.0 - 8.255.255.255\n",
+		"whois.arin.net": "NetRange: 8.8.8.0 - 8.8.8.255\nNetName: GOGL\nOrgName: Google LLC\nCountry: US\n",
+	}, &queries)
+
+	record, err := client.Lookup(context.Background(), "8.8.8.8")
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+
+	if record.Server != "whois.arin.net" {
+		t.Errorf("Server = %s, expected whois.arin.net", record.Server)
+	}
+	if record.Provider() != "Google LLC" {
+		t.Errorf("Provider() = %q, expected %q", record.Provider(), "Google LLC")
+	}
+	if record.NetName != "GOGL" || record.Country != "US" {
+		t.Errorf("NetName/Country = %s/%s, expected GOGL/US", record.NetName, record.Country)
+	}
+
+	expected := []string{"whois.iana.org 8.8.8.8", "whois.arin.net n + 8.8.8.8"}
+	if strings.Join(queries, "|") != strings.Join(expected, "|") {
+		t.Errorf("queries = %v, expected %v", queries, expected)
+	}
+}
+
+func TestLookupReferralLoop(t *testing.T) {
+	var queries []string
+	client := NewClient()
+	client.dial = fakeServers(t, map[string]string{
+		"whois.iana.org": "refer: whois.ripe.net\n",
+		"whois.ripe.net": "ReferralServer: whois://whois.iana.org\nnetname: LOOP\ndescr: Loop Net\n",
+	}, &queries)
+
+	record, err := client.Lookup(context.Background(), "193.0.0.1")
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	if record.Server != "whois.ripe.net" || record.Provider() != "Loop Net" {
+		t.Errorf("Server/Provider = %s/%q, expected whois.ripe.net/\"Loop Net\"", record.Server, record.Provider())
+	}
+	if len(queries) != 2 {
+		t.Errorf("queries = %v, expected 2", queries)
+	}
+}
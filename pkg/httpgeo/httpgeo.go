@@ -0,0 +1,179 @@
+// Package httpgeo is net/http middleware that looks up the client of each
+// request in an ip2cc snapshot, for Go web applications embedding ip2cc:
+//
+//	db, err := ip2cc.Open(ip2cc.Options{})
+//	if err != nil {
+//		return err
+//	}
+//	handler = httpgeo.Middleware(db, httpgeo.Options{})(handler)
+//
+// Handlers read the result with FromContext or CountryCode, and responses
+// carry the country code in the X-Country-Code header.
+//
+// The client is the peer of the connection unless it is one of the
+// TrustedProxies; then the forwarding header is followed back to the first
+// address that is not a trusted proxy. Without trusted proxies forwarding
+// headers are ignored, as any client can send them.
+package httpgeo
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/hightemp/ip2cc/pkg/ip2cc"
+)
+
+const (
+	// XForwardedFor is the de facto standard forwarding header.
+	XForwardedFor = "X-Forwarded-For"
+	// Forwarded is the forwarding header of RFC 7239.
+	Forwarded = "Forwarded"
+
+	// DefaultResponseHeader carries the country code in responses.
+	DefaultResponseHeader = "X-Country-Code"
+)
+
+// Looker looks up addresses; *ip2cc.DB implements it.
+type Looker interface {
+	LookupAddr(ctx context.Context, ip netip.Addr) (*ip2cc.Result, error)
+}
+
+// Options configures Middleware.
+type Options struct {
+	// TrustedProxies are the prefixes of the reverse proxies whose
+	// forwarding headers are believed.
+	TrustedProxies []netip.Prefix
+	// ForwardingHeader is the header the proxies add the client to:
+	// XForwardedFor (default) or Forwarded.
+	ForwardingHeader string
+	// ResponseHeader names the response header set to the country code
+	// (default DefaultResponseHeader); "-" sets none.
+	ResponseHeader string
+}
+
+type contextKey struct{}
+
+// Middleware returns middleware that looks up the client of every request
+// in db. Requests whose client cannot be looked up are passed on without a
+// result.
+func Middleware(db Looker, opts Options) func(http.Handler) http.Handler {
+	header := opts.ResponseHeader
+	if header == "" {
+		header = DefaultResponseHeader
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip, ok := ClientIP(r, opts)
+			if ok {
+				if result, err := db.LookupAddr(r.Context(), ip); err == nil {
+					r = r.WithContext(context.WithValue(r.Context(), contextKey{}, result))
+					if header != "-" {
+						w.Header().Set(header, result.CountryCode)
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// FromContext returns the lookup result of the client of a request
+// handled by Middleware.
+func FromContext(ctx context.Context) (*ip2cc.Result, bool) {
+	result, ok := ctx.Value(contextKey{}).(*ip2cc.Result)
+	return result, ok
+}
+
+// CountryCode returns the country code of the client of a request handled
+// by Middleware, or "" if it is unknown.
+func CountryCode(ctx context.Context) string {
+	if result, ok := FromContext(ctx); ok {
+		return result.CountryCode
+	}
+	return ""
+}
+
+// ClientIP returns the address of the client of r, following the
+// forwarding header through the trusted proxies of opts.
+func ClientIP(r *http.Request, opts Options) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	ip = ip.Unmap()
+	if !trusted(ip, opts.TrustedProxies) {
+		return ip, true
+	}
+
+	var hops []string
+	if opts.ForwardingHeader == Forwarded {
+		hops = forwardedFor(r.Header.Values(Forwarded))
+	} else {
+		for _, v := range r.Header.Values(XForwardedFor) {
+			hops = append(hops, strings.Split(v, ",")...)
+		}
+	}
+	// Each proxy appends the address it received the request from, so the
+	// last hop not added by a trusted proxy is the client
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, ok := parseHop(hops[i])
+		if !ok {
+			// An obfuscated or unknown hop hides the addresses before it
+			return netip.Addr{}, false
+		}
+		ip = hop
+		if !trusted(ip, opts.TrustedProxies) {
+			break
+		}
+	}
+	return ip, true
+}
+
+func trusted(ip netip.Addr, proxies []netip.Prefix) bool {
+	for _, p := range proxies {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor returns the for= parameters of Forwarded header values, in
+// order.
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, v := range values {
+		for _, element := range strings.Split(v, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(name, "for") {
+					hops = append(hops, strings.Trim(value, `"`))
+				}
+			}
+		}
+	}
+	return hops
+}
+
+// parseHop parses an address of a forwarding header, with an optional
+// port; IPv6 addresses with a port are in brackets.
+func parseHop(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if ip, err := netip.ParseAddr(s); err == nil {
+		return ip.Unmap(), true
+	}
+	if ap, err := netip.ParseAddrPort(s); err == nil {
+		return ap.Addr().Unmap(), true
+	}
+	if ip, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")); err == nil {
+		return ip.Unmap(), true
+	}
+	return netip.Addr{}, false
+}
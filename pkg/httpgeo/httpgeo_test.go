@@ -0,0 +1,102 @@
+package httpgeo
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/hightemp/ip2cc/pkg/ip2cc"
+)
+
+// fakeDB knows 193.0.0.0/21 as NL.
+type fakeDB struct{}
+
+func (fakeDB) LookupAddr(ctx context.Context, ip netip.Addr) (*ip2cc.Result, error) {
+	if netip.MustParsePrefix("193.0.0.0/21").Contains(ip) {
+		return &ip2cc.Result{IP: ip.String(), CountryCode: "NL", Network: "193.0.0.0/21"}, nil
+	}
+	return nil, ip2cc.ErrNotFound
+}
+
+func TestClientIP(t *testing.T) {
+	proxies := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("2001:db8::/32")}
+
+	tests := []struct {
+		name     string
+		remote   string
+		header   string
+		values   []string
+		proxies  []netip.Prefix
+		expected string
+	}{
+		{"no proxies", "198.51.100.1:1234", XForwardedFor, []string{"193.0.6.139"}, nil, "198.51.100.1"},
+		{"untrusted peer", "198.51.100.1:1234", XForwardedFor, []string{"193.0.6.139"}, proxies, "198.51.100.1"},
+		{"one proxy", "10.0.0.1:1234", XForwardedFor, []string{"193.0.6.139"}, proxies, "193.0.6.139"},
+		{"spoofed hop", "10.0.0.1:1234", XForwardedFor, []string{"1.2.3.4, 193.0.6.139, 10.0.0.2"}, proxies, "193.0.6.139"},
+		{"several headers", "10.0.0.1:1234", XForwardedFor, []string{"1.2.3.4", "193.0.6.139"}, proxies, "193.0.6.139"},
+		{"only proxies", "10.0.0.1:1234", XForwardedFor, []string{"10.0.0.3, 10.0.0.2"}, proxies, "10.0.0.3"},
+		{"no header", "10.0.0.1:1234", XForwardedFor, nil, proxies, "10.0.0.1"},
+		{"mapped peer", "[::ffff:10.0.0.1]:1234", XForwardedFor, []string{"193.0.6.139"}, proxies, "193.0.6.139"},
+		{"forwarded", "[2001:db8::1]:443", Forwarded, []string{`for=1.2.3.4, for="[2001:67c:2e8::1]:4711";proto=https`}, proxies, "2001:67c:2e8::1"},
+		{"forwarded by proxy", "10.0.0.1:1234", Forwarded, []string{"for=193.0.6.139;by=10.0.0.1", "For=10.0.0.2"}, proxies, "193.0.6.139"},
+	}
+	for _, tc := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tc.remote
+		for _, v := range tc.values {
+			r.Header.Add(tc.header, v)
+		}
+		ip, ok := ClientIP(r, Options{TrustedProxies: tc.proxies, ForwardingHeader: tc.header})
+		if !ok || ip.String() != tc.expected {
+			t.Errorf("%s: ClientIP = %v, %v, expected %s", tc.name, ip, ok, tc.expected)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set(Forwarded, "for=_hidden, for=10.0.0.2")
+	if ip, ok := ClientIP(r, Options{TrustedProxies: proxies, ForwardingHeader: Forwarded}); ok {
+		t.Errorf("ClientIP behind an obfuscated hop = %v, expected none", ip)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var seen string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = CountryCode(r.Context())
+		if result, ok := FromContext(r.Context()); ok && result.Network != "193.0.0.0/21" {
+			t.Errorf("Network = %s, expected 193.0.0.0/21", result.Network)
+		}
+	})
+
+	tests := []struct {
+		remote   string
+		opts     Options
+		country  string
+		header   string
+		expected string
+	}{
+		{"193.0.6.139:1234", Options{}, "NL", DefaultResponseHeader, "NL"},
+		{"10.0.0.1:1234", Options{TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}, "NL", DefaultResponseHeader, "NL"},
+		{"8.8.8.8:1234", Options{}, "", DefaultResponseHeader, ""},
+		{"193.0.6.139:1234", Options{ResponseHeader: "X-Geo"}, "NL", "X-Geo", "NL"},
+		{"193.0.6.139:1234", Options{ResponseHeader: "-"}, "NL", DefaultResponseHeader, ""},
+	}
+	for _, tc := range tests {
+		seen = "unset"
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tc.remote
+		r.Header.Set(XForwardedFor, "193.0.6.139")
+		rec := httptest.NewRecorder()
+		Middleware(fakeDB{}, tc.opts)(handler).ServeHTTP(rec, r)
+
+		if seen != tc.country {
+			t.Errorf("%s: CountryCode = %q, expected %q", tc.remote, seen, tc.country)
+		}
+		if got := rec.Header().Get(tc.header); got != tc.expected {
+			t.Errorf("%s: %s = %q, expected %q", tc.remote, tc.header, got, tc.expected)
+		}
+	}
+}
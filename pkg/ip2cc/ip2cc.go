@@ -0,0 +1,224 @@
+// Package ip2cc looks up the registration country, network and provider of
+// IP addresses in the snapshots maintained by the ip2cc command.
+//
+// Snapshots are created with "ip2cc update"; this package only reads them:
+//
+//	db, err := ip2cc.Open(ip2cc.Options{})
+//	if err != nil {
+//		return err
+//	}
+//	defer db.Close()
+//
+//	result, err := db.Lookup(ctx, "193.0.6.139")
+//	// result.CountryCode == "NL", result.Network == "193.0.0.0/21"
+//
+// A DB is safe for concurrent use.
+package ip2cc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/hightemp/ip2cc/internal/batch"
+	"github.com/hightemp/ip2cc/internal/config"
+	"github.com/hightemp/ip2cc/internal/lock"
+	"github.com/hightemp/ip2cc/internal/output"
+	"github.com/hightemp/ip2cc/internal/provider"
+	"github.com/hightemp/ip2cc/internal/snapshot"
+)
+
+var (
+	// ErrInvalidInput is returned for input that is neither an IP address
+	// nor a CIDR.
+	ErrInvalidInput = errors.New("invalid IP address or CIDR")
+
+	// ErrNotFound is returned for addresses not covered by the snapshot.
+	ErrNotFound = errors.New("not found in index")
+)
+
+// Options configures Open.
+type Options struct {
+	// CacheDir is the ip2cc cache directory (default: ~/.ip2cc/cache).
+	CacheDir string
+	// Date selects the snapshot of a day (YYYY-MM-DD); empty selects the
+	// latest snapshot.
+	Date string
+	// ProviderMode enables provider lookups: "bgp", "whois", "whois43",
+	// "rdap", "local" or "auto". Empty or "off" disables them. All modes but
+	// "local" query remote services.
+	ProviderMode string
+}
+
+// Snapshot describes the snapshot a DB answers from.
+type Snapshot struct {
+	Date       string
+	CreatedAt  time.Time
+	PrefixesV4 int
+	PrefixesV6 int
+}
+
+// Provider is the network operator of an address.
+type Provider struct {
+	ASNs    []int
+	Holders []string
+	Source  string
+}
+
+// Result is the answer to a lookup.
+type Result struct {
+	IP          string
+	CountryCode string
+	CountryName string
+	Network     string
+	// Containment and Countries are set for CIDR lookups: whether the block
+	// lies within a single assignment, and the countries it overlaps.
+	Containment string
+	Countries   []string
+	// Special is set for private and other special-purpose addresses, which
+	// carry a pseudo country code such as "PRIVATE".
+	Special bool
+	// EmbeddedIPv4 is set for IPv4-mapped, 6to4, and Teredo addresses,
+	// which are looked up as the IPv4 address they carry.
+	EmbeddedIPv4 string
+	Provider     *Provider
+}
+
+// DB is an opened snapshot.
+type DB struct {
+	cacheDir string
+	date     string
+	current  *snapshot.Database
+	resolver *provider.Resolver
+}
+
+// Open loads a snapshot from the cache directory.
+func Open(opts Options) (*DB, error) {
+	cacheDir := opts.CacheDir
+	if cacheDir == "" {
+		cacheDir = config.DefaultCacheDir()
+	}
+
+	var resolver *provider.Resolver
+	if opts.ProviderMode != "" {
+		mode, err := provider.ParseMode(opts.ProviderMode)
+		if err != nil {
+			return nil, err
+		}
+		if mode != provider.ModeOff {
+			resolver = provider.NewResolver(mode, provider.Options{CacheDir: cacheDir, UseCache: true})
+		}
+	}
+
+	db := &DB{cacheDir: cacheDir, date: opts.Date, resolver: resolver}
+	l, err := db.load()
+	if err != nil {
+		return nil, err
+	}
+	db.current = snapshot.NewDatabase(l)
+	return db, nil
+}
+
+// Reload loads the snapshot selected by the options again, e.g. the latest
+// one after an update, and swaps it in. Lookups in progress finish on the
+// previous snapshot; on error the DB keeps answering from it.
+func (db *DB) Reload() error {
+	l, err := db.load()
+	if err != nil {
+		return err
+	}
+	db.current.Swap(l)
+	return nil
+}
+
+// load reads the selected snapshot while holding a shared cache lock, so
+// that an update does not replace it halfway.
+func (db *DB) load() (*snapshot.Loaded, error) {
+	if err := config.EnsureDir(db.cacheDir); err != nil {
+		return nil, fmt.Errorf("create cache dir: %w", err)
+	}
+	l, err := lock.Acquire(config.LockPath(db.cacheDir), false)
+	if err != nil {
+		return nil, fmt.Errorf("lock cache: %w", err)
+	}
+	defer l.Release()
+
+	mgr := snapshot.NewManager(db.cacheDir)
+	var dir string
+	if db.date != "" {
+		dir, _, err = mgr.GetSnapshotByDate(db.date)
+	} else {
+		dir, _, err = mgr.GetLatestSnapshot()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.Load(dir)
+}
+
+// Snapshot returns information about the snapshot currently answering.
+func (db *DB) Snapshot() Snapshot {
+	meta := db.current.Current().Meta
+	return Snapshot{
+		Date:       meta.RequestedTime,
+		CreatedAt:  meta.CreatedAt,
+		PrefixesV4: meta.PrefixesV4,
+		PrefixesV6: meta.PrefixesV6,
+	}
+}
+
+// Lookup looks up an IP address or CIDR. It returns ErrInvalidInput for
+// malformed input and ErrNotFound for addresses outside the snapshot.
+func (db *DB) Lookup(ctx context.Context, input string) (*Result, error) {
+	input = strings.TrimSpace(input)
+	if _, err := netip.ParsePrefix(input); err != nil {
+		if _, err := netip.ParseAddr(input); err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidInput, input)
+		}
+	}
+
+	current := db.current.Current()
+	p := batch.NewProcessor(current.Index.V4, current.Index.V6, db.resolver, current.Meta)
+	r := p.Lookup(ctx, input)
+	if r.Error != "" {
+		return nil, fmt.Errorf("%s: %w", input, ErrNotFound)
+	}
+	return newResult(r), nil
+}
+
+// LookupAddr looks up a parsed IP address.
+func (db *DB) LookupAddr(ctx context.Context, ip netip.Addr) (*Result, error) {
+	return db.Lookup(ctx, ip.String())
+}
+
+// Close persists the provider cache.
+func (db *DB) Close() error {
+	if db.resolver != nil {
+		return db.resolver.SaveCache()
+	}
+	return nil
+}
+
+func newResult(r *output.LookupResult) *Result {
+	result := &Result{
+		IP:           r.IP,
+		CountryCode:  r.CountryCode,
+		CountryName:  r.CountryName,
+		Network:      r.Network,
+		Containment:  r.Containment,
+		Countries:    r.Countries,
+		Special:      r.Special,
+		EmbeddedIPv4: r.EmbeddedIPv4,
+	}
+	if r.Provider != nil && r.Provider.Error == "" {
+		result.Provider = &Provider{
+			ASNs:    r.Provider.ASNs,
+			Holders: r.Provider.Holders,
+			Source:  r.Provider.Source,
+		}
+	}
+	return result
+}
@@ -0,0 +1,159 @@
+package ip2cc
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hightemp/ip2cc/internal/config"
+	"github.com/hightemp/ip2cc/internal/index"
+	"github.com/hightemp/ip2cc/internal/snapshot"
+)
+
+// writeSnapshot creates a snapshot for date in cacheDir.
+func writeSnapshot(t *testing.T, cacheDir, date string, cidrs map[string]string) {
+	t.Helper()
+	mgr := snapshot.NewManager(cacheDir)
+	dir, err := mgr.CreateSnapshot(date)
+	if err != nil {
+		t.Fatalf("CreateSnapshot failed: %v", err)
+	}
+
+	v4, v6 := index.NewTrie(false), index.NewTrie(true)
+	for cidr, cc := range cidrs {
+		trie := v4
+		if strings.Contains(cidr, ":") {
+			trie = v6
+		}
+		if err := trie.InsertCIDR(cidr, cc); err != nil {
+			t.Fatalf("InsertCIDR(%s) failed: %v", cidr, err)
+		}
+	}
+	if err := index.SaveIndex(config.IndexV4Path(dir), config.IndexV6Path(dir), v4, v6); err != nil {
+		t.Fatalf("SaveIndex failed: %v", err)
+	}
+
+	meta := snapshot.NewMetadata()
+	meta.RequestedTime = date
+	meta.PrefixesV4 = v4.Count
+	meta.PrefixesV6 = v6.Count
+	if err := meta.Save(config.MetadataPath(dir)); err != nil {
+		t.Fatalf("Save metadata failed: %v", err)
+	}
+	if err := mgr.SetLatest(date); err != nil {
+		t.Fatalf("SetLatest failed: %v", err)
+	}
+}
+
+func TestOpenAndLookup(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	writeSnapshot(t, tmpDir, "2025-01-15", map[string]string{
+		"193.0.0.0/21":  "NL",
+		"2001:67c::/32": "NL",
+	})
+
+	db, err := Open(Options{CacheDir: tmpDir})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	if got := db.Snapshot().Date; got != "2025-01-15" {
+		t.Errorf("Snapshot().Date = %s, expected 2025-01-15", got)
+	}
+
+	ctx := context.Background()
+	tests := []struct {
+		input   string
+		country string
+		network string
+	}{
+		{"193.0.6.139", "NL", "193.0.0.0/21"},
+		{"2001:67c:2e8::1", "NL", "2001:67c::/32"},
+		{"193.0.4.0/24", "NL", "193.0.0.0/21"},
+		{"10.1.2.3", "PRIVATE", "10.0.0.0/8"},
+	}
+	for _, tt := range tests {
+		result, err := db.Lookup(ctx, tt.input)
+		if err != nil {
+			t.Errorf("Lookup(%s) failed: %v", tt.input, err)
+			continue
+		}
+		if result.CountryCode != tt.country {
+			t.Errorf("Lookup(%s).CountryCode = %s, expected %s", tt.input, result.CountryCode, tt.country)
+		}
+		if result.Network != tt.network {
+			t.Errorf("Lookup(%s).Network = %s, expected %s", tt.input, result.Network, tt.network)
+		}
+	}
+
+	if _, err := db.Lookup(ctx, "8.8.8.8"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Lookup(8.8.8.8) error = %v, expected ErrNotFound", err)
+	}
+	if _, err := db.Lookup(ctx, "not-an-ip"); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Lookup(not-an-ip) error = %v, expected ErrInvalidInput", err)
+	}
+}
+
+func TestOpenByDate(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	writeSnapshot(t, tmpDir, "2025-01-01", map[string]string{"193.0.0.0/21": "DE"})
+	writeSnapshot(t, tmpDir, "2025-01-15", map[string]string{"193.0.0.0/21": "NL"})
+
+	db, err := Open(Options{CacheDir: tmpDir, Date: "2025-01-01"})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	result, err := db.Lookup(context.Background(), "193.0.6.139")
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	if result.CountryCode != "DE" {
+		t.Errorf("CountryCode = %s, expected DE", result.CountryCode)
+	}
+
+	if _, err := Open(Options{CacheDir: tmpDir, Date: "2024-12-31"}); err == nil {
+		t.Error("Open of a missing snapshot should fail")
+	}
+}
+
+func TestReload(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "ip2cc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	writeSnapshot(t, tmpDir, "2025-01-01", map[string]string{"193.0.0.0/21": "DE"})
+	db, err := Open(Options{CacheDir: tmpDir})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	writeSnapshot(t, tmpDir, "2025-01-15", map[string]string{"193.0.0.0/21": "NL"})
+	if err := db.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if got := db.Snapshot().Date; got != "2025-01-15" {
+		t.Errorf("Snapshot().Date after reload = %s, expected 2025-01-15", got)
+	}
+	result, err := db.Lookup(context.Background(), "193.0.6.139")
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	if result.CountryCode != "NL" {
+		t.Errorf("CountryCode after reload = %s, expected NL", result.CountryCode)
+	}
+}